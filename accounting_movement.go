@@ -218,7 +218,7 @@ func (am *AccountingMovement) deleteAccountingMovement(userId int32, trans *gorm
 type PostInvoiceResult struct {
 	Invoice int64 `json:"invoice"`
 	Ok      bool  `json:"ok"`
-	Result  int8  `json:"result"` // 0: Internal error, 1: The customer/supplier in the invoice has no account
+	Result  int8  `json:"result"` // 0: Internal error, 1: The customer/supplier in the invoice has no account, 2: The invoice can't be added to the invoice register (the enterprise has no tax ID or country), 3: The purchase invoice is blocked by the three-way match
 }
 
 // Transfer the sales invoices from management to accounting. Create the movements and the details for all the selected invoices.
@@ -262,6 +262,10 @@ func salesPostInvoices(invoiceIds []int64, enterpriseId int32, userId int32) []P
 			result[i].Result = 1
 			continue
 		}
+		if settings.InvoiceRegister != "_" && (len(settings.EnterpriseTaxId) == 0 || settings.EnterpriseCountryId == nil) {
+			result[i].Result = 2
+			continue
+		}
 		// get the account row
 		a := getAccountRow(*c.AccountId)
 		if a.Id <= 0 {
@@ -473,6 +477,12 @@ func salesPostInvoices(invoiceIds []int64, enterpriseId int32, userId int32) []P
 			return result
 		}
 
+		// add the invoice to the tamper-evident invoice register
+		if settings.InvoiceRegister != "_" && !registerSalesInvoice(invoiceIds[i], enterpriseId, trans) {
+			trans.Rollback()
+			return result
+		}
+
 		insertTransactionalLog(a.EnterpriseId, "sales_invoice", int(invoiceIds[i]), userId, "U")
 		result[i].Ok = true
 	}
@@ -480,6 +490,10 @@ func salesPostInvoices(invoiceIds []int64, enterpriseId int32, userId int32) []P
 	///
 	trans.Commit()
 	///
+
+	if settings.InvoiceRegister != "_" && len(settings.InvoiceRegisterUrl) > 0 {
+		go submitSalesInvoiceRegister(enterpriseId)
+	}
 	return result
 }
 
@@ -530,6 +544,17 @@ func purchasePostInvoices(invoiceIds []int64, enterpriseId int32, userId int32)
 			trans.Rollback()
 			return result
 		}
+		// the invoices that don't match the purchase orders and the delivery notes can't be posted until an administrator releases them
+		if settings.ThreeWayMatch && inv.MatchStatus != "R" {
+			match := matchPurchaseInvoice(inv.Id, enterpriseId)
+			if !match.setPurchaseInvoiceMatchStatus(enterpriseId, *trans) {
+				return result
+			}
+			if match.Status == "B" {
+				result[i].Result = 3
+				continue
+			}
+		}
 
 		// create the accounting movement
 		m := AccountingMovement{}
@@ -135,7 +135,7 @@ type InventoyValuationQuery struct {
 type InventoyValuation struct {
 	Product     int32   `json:"product"`
 	ProductName string  `json:"productName"`
-	Quantity    int32   `json:"quantity"`
+	Quantity    float64 `json:"quantity"`
 	CostPrice   float64 `json:"costPrice"`
 	Value       float64 `json:"value"`
 }
@@ -159,15 +159,41 @@ func (q *InventoyValuationQuery) getInventoyValuation(enterpriseId int32) []Inve
 	}
 
 	sqlStatement := `SELECT dragged_stock FROM warehouse_movement WHERE product = $1 ORDER BY id DESC LIMIT 1`
+	sqlStatementLayers := `SELECT COUNT(*), COALESCE(SUM(quantity_remaining), 0), COALESCE(SUM(quantity_remaining * unit_cost), 0) FROM cost_layer WHERE product = $1 AND enterprise = $2`
 	var productId int32
 	var costPrice float64
 	var productName string
-	var draggedStock int32
+	var draggedStock float64
 	for rows.Next() {
 		rows.Scan(&productId, &costPrice, &productName)
 
+		// the stock in the cost layers, valued at the cost of each layer
+		var layers int64
+		var quantity float64
+		var value float64
+		row := db.QueryRow(sqlStatementLayers, productId, enterpriseId)
+		if row.Err() != nil {
+			log("DB", row.Err().Error())
+		} else {
+			row.Scan(&layers, &quantity, &value)
+		}
+		if layers > 0 {
+			i := InventoyValuation{
+				Product:     productId,
+				ProductName: productName,
+				Quantity:    roundQuantity(quantity),
+				Value:       value,
+			}
+			if i.Quantity != 0 {
+				i.CostPrice = value / quantity
+			}
+			inventoyValuation = append(inventoyValuation, i)
+			continue
+		}
+
+		// the products that have not been costed are valued at the cost price
 		// get inventory at date:
-		row := db.QueryRow(sqlStatement, productId)
+		row = db.QueryRow(sqlStatement, productId)
 		if row.Err() != nil {
 			log("DB", row.Err().Error())
 			draggedStock = 0
@@ -206,7 +232,7 @@ type IntrastatReportDetail struct {
 	HSCode        string
 	IsoCode2      string
 	Weight        float64
-	Quantity      int64
+	Quantity      float64
 	TotalInvoiced float64
 }
 
@@ -237,7 +263,7 @@ func (q *IntrastatReportQuery) intrastatReport() IntrastatReport {
 	// details
 	var weight float64
 	var hsCode *string
-	var quantity int32
+	var quantity float64
 	var totalAmount float64
 	for rows.Next() {
 		rows.Scan(&saleOrderId, &destinationCountryIso2)
@@ -261,8 +287,8 @@ func (q *IntrastatReportQuery) intrastatReport() IntrastatReport {
 			for i := 0; i < len(salesDetails); i++ {
 				var salesDetail IntrastatReportDetail = salesDetails[i]
 				if salesDetail.HSCode == *hsCode && salesDetail.IsoCode2 == destinationCountryIso2 {
-					salesDetail.Weight = weight * float64(quantity)
-					salesDetail.Quantity += int64(quantity)
+					salesDetail.Weight = weight * quantity
+					salesDetail.Quantity = roundQuantity(salesDetail.Quantity + quantity)
 					salesDetail.TotalInvoiced += totalAmount
 					ok = true
 					break
@@ -272,8 +298,8 @@ func (q *IntrastatReportQuery) intrastatReport() IntrastatReport {
 				salesDetails = append(salesDetails, IntrastatReportDetail{
 					HSCode:        *hsCode,
 					IsoCode2:      destinationCountryIso2,
-					Weight:        weight * float64(quantity),
-					Quantity:      int64(quantity),
+					Weight:        weight * quantity,
+					Quantity:      quantity,
 					TotalInvoiced: totalAmount,
 				})
 			}
@@ -314,8 +340,8 @@ func (q *IntrastatReportQuery) intrastatReport() IntrastatReport {
 			for i := 0; i < len(purchasesDetails); i++ {
 				var purchasesDetail IntrastatReportDetail = purchasesDetails[i]
 				if purchasesDetail.HSCode == *hsCode && purchasesDetail.IsoCode2 == destinationCountryIso2 {
-					purchasesDetail.Weight = weight * float64(quantity)
-					purchasesDetail.Quantity += int64(quantity)
+					purchasesDetail.Weight = weight * quantity
+					purchasesDetail.Quantity = roundQuantity(purchasesDetail.Quantity + quantity)
 					purchasesDetail.TotalInvoiced += totalAmount
 					ok = true
 					break
@@ -325,8 +351,8 @@ func (q *IntrastatReportQuery) intrastatReport() IntrastatReport {
 				purchasesDetails = append(purchasesDetails, IntrastatReportDetail{
 					HSCode:        *hsCode,
 					IsoCode2:      destinationCountryIso2,
-					Weight:        weight * float64(quantity),
-					Quantity:      int64(quantity),
+					Weight:        weight * quantity,
+					Quantity:      quantity,
 					TotalInvoiced: totalAmount,
 				})
 			}
@@ -336,13 +362,13 @@ func (q *IntrastatReportQuery) intrastatReport() IntrastatReport {
 	// GENERATE REPORT: SALES
 	for i := 0; i < len(salesDetails); i++ {
 		var salesDetail IntrastatReportDetail = salesDetails[i]
-		report.ReportSales += q.CountryOriginCode + ";" + strconv.Itoa(q.StateOriginCode) + ";DDP;11;3;;" + salesDetail.HSCode + ";" + salesDetail.IsoCode2 + ";1;" + fmt.Sprintf("%.3f", salesDetail.Weight) + ";" + strconv.Itoa(int(salesDetail.Quantity)) + ";" + fmt.Sprintf("%.2f", salesDetail.TotalInvoiced) + ";" + fmt.Sprintf("%.2f", salesDetail.TotalInvoiced) + "\n"
+		report.ReportSales += q.CountryOriginCode + ";" + strconv.Itoa(q.StateOriginCode) + ";DDP;11;3;;" + salesDetail.HSCode + ";" + salesDetail.IsoCode2 + ";1;" + fmt.Sprintf("%.3f", salesDetail.Weight) + ";" + formatQuantity(salesDetail.Quantity) + ";" + fmt.Sprintf("%.2f", salesDetail.TotalInvoiced) + ";" + fmt.Sprintf("%.2f", salesDetail.TotalInvoiced) + "\n"
 	}
 
 	// GENERATE REPORT: PURCHASES
 	for i := 0; i < len(purchasesDetails); i++ {
 		var purchasesDetail IntrastatReportDetail = purchasesDetails[i]
-		report.ReportPurchase += q.CountryOriginCode + ";" + strconv.Itoa(q.StateOriginCode) + ";DDP;11;3;;" + purchasesDetail.HSCode + ";" + purchasesDetail.IsoCode2 + ";1;" + fmt.Sprintf("%.3f", purchasesDetail.Weight) + ";" + strconv.Itoa(int(purchasesDetail.Quantity)) + ";" + fmt.Sprintf("%.2f", purchasesDetail.TotalInvoiced) + ";" + fmt.Sprintf("%.2f", purchasesDetail.TotalInvoiced) + "\n"
+		report.ReportPurchase += q.CountryOriginCode + ";" + strconv.Itoa(q.StateOriginCode) + ";DDP;11;3;;" + purchasesDetail.HSCode + ";" + purchasesDetail.IsoCode2 + ";1;" + fmt.Sprintf("%.3f", purchasesDetail.Weight) + ";" + formatQuantity(purchasesDetail.Quantity) + ";" + fmt.Sprintf("%.2f", purchasesDetail.TotalInvoiced) + ";" + fmt.Sprintf("%.2f", purchasesDetail.TotalInvoiced) + "\n"
 	}
 
 	return report
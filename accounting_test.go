@@ -11,7 +11,22 @@ You should have received a copy of the GNU Affero General Public License along w
 package main
 
 import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 // ===== JOURNAL
@@ -599,6 +614,534 @@ func TestSalesPostInvoices(t *testing.T) {
 	}
 }
 
+// ===== SALES INVOICE REGISTER
+
+func TestSalesInvoiceRegister(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	var product int32 = 4
+
+	// local stand-in for the submission service of the tax agency
+	var submitted string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		submitted = string(body)
+		w.Write([]byte("<EstadoEnvio>Correcto</EstadoEnvio>"))
+	}))
+	defer server.Close()
+
+	settingsInDisk := getSettingsRecordById(1)
+	address := getAddressRow(1)
+	dbOrm.Model(&Settings{}).Where("id = ?", 1).Updates(map[string]interface{}{
+		"enterprise_tax_id":    "B12345674",
+		"enterprise_country":   address.CountryId,
+		"invoice_register":     "V",
+		"invoice_register_url": "",
+	})
+	defer dbOrm.Model(&Settings{}).Where("id = ?", 1).Updates(map[string]interface{}{
+		"enterprise_tax_id":    settingsInDisk.EnterpriseTaxId,
+		"enterprise_country":   settingsInDisk.EnterpriseCountryId,
+		"invoice_register":     settingsInDisk.InvoiceRegister,
+		"invoice_register_url": settingsInDisk.InvoiceRegisterUrl,
+	})
+
+	// insert and post two invoices, the second one is chained to the first one
+	invoiceIds := make([]int64, 0)
+	for j := 0; j < 2; j++ {
+		i := SalesInvoice{
+			CustomerId:       1,
+			PaymentMethodId:  1,
+			BillingSeriesId:  "INT",
+			CurrencyId:       1,
+			BillingAddressId: 1,
+			EnterpriseId:     1,
+		}
+		_, invoiceId := i.insertSalesInvoice(0, nil)
+		d := SalesInvoiceDetail{
+			InvoiceId:    invoiceId,
+			ProductId:    &product,
+			Price:        9.99,
+			Quantity:     2,
+			VatPercent:   21,
+			EnterpriseId: 1,
+		}
+		d.insertSalesInvoiceDetail(nil, 0)
+		invoiceIds = append(invoiceIds, invoiceId)
+	}
+	result := salesPostInvoices(invoiceIds, 1, 0)
+	if len(result) != 2 || !result[0].Ok || !result[1].Ok {
+		t.Error("Can't post the sale invoices")
+		return
+	}
+
+	first := getSalesInvoiceRegisterByInvoice(invoiceIds[0], 1)
+	second := getSalesInvoiceRegisterByInvoice(invoiceIds[1], 1)
+	if first.Id <= 0 || second.Id <= 0 {
+		t.Error("The invoices are not in the register")
+		return
+	}
+	if second.Sequence != first.Sequence+1 || second.PreviousHash != first.Hash || len(second.Hash) != 64 || second.calculateHash() != second.Hash || second.calculateIntegrityHash() != second.IntegrityHash {
+		t.Error("The records of the register are not chained")
+		return
+	}
+	if !verifySalesInvoiceRegister(1).Ok {
+		t.Error("The chain of the register is not valid")
+		return
+	}
+
+	// the registered invoices can't be deleted
+	i := getSalesInvoiceRow(invoiceIds[1])
+	if i.deleteSalesInvoice(0).ErrorCode != 5 {
+		t.Error("A registered invoice has been deleted")
+		return
+	}
+
+	// registration file and QR code
+	document, ok := generateSalesInvoiceRegisterXML(invoiceIds[1], 1)
+	if !ok.Ok {
+		t.Error("Can't generate the registration file", ok.ErrorCode)
+		return
+	}
+	var alta struct {
+		Huella          string `xml:"RegistroFactura>RegistroAlta>Huella"`
+		HuellaAnterior  string `xml:"RegistroFactura>RegistroAlta>Encadenamiento>RegistroAnterior>Huella"`
+		NumSerieFactura string `xml:"RegistroFactura>RegistroAlta>IDFactura>NumSerieFactura"`
+	}
+	err := xml.Unmarshal(document, &alta)
+	if err != nil || alta.Huella != second.Hash || alta.HuellaAnterior != first.Hash || alta.NumSerieFactura != second.InvoiceName {
+		t.Error("The registration file is not correct", err)
+		return
+	}
+	qr := getSalesInvoiceRegisterQrPayload(invoiceIds[1], 1)
+	if !strings.HasPrefix(qr, VERIFACTU_QR_URL) || !strings.Contains(qr, "importe=24.18") {
+		t.Error("The QR code is not correct", qr)
+		return
+	}
+
+	// submission
+	dbOrm.Model(&Settings{}).Where("id = ?", 1).Update("invoice_register_url", server.URL)
+	if !submitSalesInvoiceRegister(1) {
+		t.Error("Can't submit the register")
+		return
+	}
+	second = getSalesInvoiceRegisterByInvoice(invoiceIds[1], 1)
+	if second.SubmissionStatus != "S" || !strings.Contains(submitted, second.Hash) || !strings.Contains(submitted, "soapenv:Envelope") {
+		t.Error("The register has not been submitted")
+		return
+	}
+
+	// any modification breaks the chain
+	dbOrm.Model(&SalesInvoiceRegister{}).Where("id = ?", first.Id).Update("total_amount", first.TotalAmount+1)
+	verification := verifySalesInvoiceRegister(1)
+	if verification.Ok || len(verification.Breaks) == 0 || verification.Breaks[0].InvoiceId != invoiceIds[0] || verification.Breaks[0].Reason != 1 {
+		t.Error("The modification of the register has not been detected")
+		return
+	}
+	dbOrm.Model(&SalesInvoiceRegister{}).Where("id = ?", first.Id).Update("total_amount", first.TotalAmount)
+
+	// the VAT breakdown is not part of the VeriFactu hash, but it's protected by the integrity hash
+	dbOrm.Model(&SalesInvoiceRegister{}).Where("id = ?", first.Id).Update("vat_breakdown", "[]")
+	verification = verifySalesInvoiceRegister(1)
+	if verification.Ok || len(verification.Breaks) == 0 || verification.Breaks[0].InvoiceId != invoiceIds[0] || verification.Breaks[0].Reason != 1 {
+		t.Error("The modification of the VAT breakdown has not been detected")
+		return
+	}
+	dbOrm.Model(&SalesInvoiceRegister{}).Where("id = ?", first.Id).Update("vat_breakdown", first.VatBreakdown)
+
+	// the invoices generated from a sale order are registered when they are issued, before they are posted
+	dbOrm.Model(&Settings{}).Where("id = ?", 1).Update("invoice_register_url", "")
+	o := SaleOrder{
+		CustomerId:        1,
+		PaymentMethodId:   1,
+		BillingSeriesId:   "INT",
+		CurrencyId:        1,
+		BillingAddressId:  1,
+		ShippingAddressId: 1,
+		EnterpriseId:      1,
+	}
+	_, orderId := o.insertSalesOrder(0, nil)
+	od := SalesOrderDetail{
+		OrderId:      orderId,
+		ProductId:    product,
+		Price:        9.99,
+		Quantity:     1,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+	od.insertSalesOrderDetail(0, nil)
+	if !invoiceAllSaleOrder(orderId, 1, 0).Ok {
+		t.Error("Can't invoice the sale order")
+		return
+	}
+	issued := getSalesOrderRelations(orderId, 1).Invoices
+	if len(issued) != 1 {
+		t.Error("The sale order has not been invoiced")
+		return
+	}
+	third := getSalesInvoiceRegisterByInvoice(issued[0].Id, 1)
+	if third.Id <= 0 || third.PreviousHash != second.Hash {
+		t.Error("The invoice has not been registered when it was issued")
+		return
+	}
+	d := SalesInvoiceDetail{
+		InvoiceId:    issued[0].Id,
+		ProductId:    &product,
+		Price:        1,
+		Quantity:     1,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+	if d.insertSalesInvoiceDetail(nil, 0).ErrorCode != 4 {
+		t.Error("A detail has been added to a registered invoice")
+		return
+	}
+	if issued[0].deleteSalesInvoice(0).ErrorCode != 5 {
+		t.Error("A registered invoice that is not posted has been deleted")
+		return
+	}
+
+	// DELETE
+	dbOrm.Where("id IN ?", []int64{first.Id, second.Id, third.Id}).Delete(&SalesInvoiceRegister{})
+	if !issued[0].deleteSalesInvoice(0).Ok {
+		t.Error("Delete error, can't delete sale invoice")
+		return
+	}
+	details := getSalesOrderDetail(orderId, 1)
+	details[0].EnterpriseId = 1
+	details[0].deleteSalesOrderDetail(0, nil)
+	o.Id = orderId
+	o.deleteSalesOrder(0)
+	for j := len(invoiceIds) - 1; j >= 0; j-- {
+		i := getSalesInvoiceRow(invoiceIds[j])
+		am := getAccountingMovementRow(*i.AccountingMovementId)
+		if !am.deleteAccountingMovement(0, nil) {
+			t.Error("Delete error, can't delete accounting movement")
+			return
+		}
+		if !i.deleteSalesInvoice(0).Ok {
+			t.Error("Delete error, can't delete sale invoice")
+			return
+		}
+	}
+}
+
+func TestInvoiceRegisterCRC8(t *testing.T) {
+	if crc8([]byte("123456789")) != 0xF4 {
+		t.Error("The CRC-8 is not correct")
+		return
+	}
+
+	r := SalesInvoiceRegister{IssuerTaxId: "B12345674", BillingSeriesId: "INT", InvoiceName: "INT/2022/000001", InvoiceNumber: 1, TotalAmount: 121, Hash: strings.Repeat("A", 64), SignatureValue: strings.Repeat("Qk", 172)}
+	id := r.getTicketBaiId()
+	if len(id) != 39 || !strings.HasPrefix(id, "TBAI-B12345674-") {
+		t.Error("The TicketBAI identifier is not correct", id)
+		return
+	}
+	qr := r.getQrPayload("T")
+	if !strings.HasPrefix(qr, TICKETBAI_QR_URL) || !strings.HasSuffix(qr, "&cr="+fmt.Sprintf("%03d", crc8([]byte(qr[:strings.Index(qr, "&cr=")])))) {
+		t.Error("The TicketBAI QR code is not correct", qr)
+		return
+	}
+}
+
+// The hash is calculated with the fields of the RegistroAlta of VeriFactu in the order of the specification of the AEAT.
+func TestInvoiceRegisterHash(t *testing.T) {
+	r := SalesInvoiceRegister{
+		IssuerTaxId:   "89890001K",
+		InvoiceName:   "12345678/G33",
+		InvoiceDate:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		InvoiceType:   "F1",
+		VatAmount:     12.35,
+		TotalAmount:   123.45,
+		VatBreakdown:  `[{"taxCategory":"S","vatPercent":21,"taxableAmount":111.1,"vatAmount":12.35}]`,
+		PreviousHash:  "",
+		DateCreated:   time.Date(2024, 1, 1, 18, 20, 30, 0, time.UTC),
+		InvoiceNumber: 1,
+	}
+	if r.calculateHash() != "84389B4E3B0A2FAB60501643B6F4505D11F498BACE43A9DC6C3F27BF96F1C5D3" {
+		t.Error("The VeriFactu hash is not correct", r.calculateHash())
+		return
+	}
+
+	// the VAT breakdown only changes the internal integrity hash
+	hash := r.calculateHash()
+	integrityHash := r.calculateIntegrityHash()
+	r.VatBreakdown = "[]"
+	if r.calculateHash() != hash || r.calculateIntegrityHash() == integrityHash {
+		t.Error("The integrity hash is not correct")
+		return
+	}
+}
+
+func TestTicketBaiSignature(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "MARKETNET"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+	}
+	certData, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	cert, _ := x509.ParseCertificate(certData)
+
+	// the file is chained to the first 100 characters of the signature value of the previous file
+	previous := SalesInvoiceRegister{BillingSeriesId: "INT", InvoiceNumber: 1, InvoiceDate: time.Now(), SignatureValue: strings.Repeat("Qk", 172)}
+	r := SalesInvoiceRegister{IssuerTaxId: "B12345674", BillingSeriesId: "INT", InvoiceName: "INT/2022/000002", InvoiceNumber: 2, InvoiceDate: time.Now(), InvoiceType: "F2", TotalAmount: 121, VatBreakdown: `[{"taxCategory":"S","vatPercent":21,"taxableAmount":100,"vatAmount":21}]`}
+	e := EN16931Invoice{Invoice: SalesInvoice{SimplifiedInvoice: true, DateCreated: time.Now()}, Settings: Settings{EnterpriseName: "MARKETNET"}}
+	tbai := generateSalesInvoiceTicketBai(r, e, &previous)
+	if tbai.HuellaTBAI.EncadenamientoFacturaAnterior == nil || tbai.HuellaTBAI.EncadenamientoFacturaAnterior.SignatureValueFirmaFacturaAnterior != previous.SignatureValue[:100] {
+		t.Error("The TicketBAI file is not chained to the signature of the previous file")
+		return
+	}
+
+	document, err := tbai.marshalContent()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	signedDocument, signatureValue, err := signXAdES("T:TicketBai", TICKETBAI_NAMESPACE_DECLARATIONS, document, ticketBaiSignaturePolicy, cert, key, time.Now())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var file struct {
+		XMLName        xml.Name
+		Emisor         string `xml:"Sujetos>Emisor>NIF"`
+		SignatureValue string `xml:"Signature>SignatureValue"`
+		Policy         string `xml:"Signature>Object>QualifyingProperties>SignedProperties>SignedSignatureProperties>SignaturePolicyIdentifier>SignaturePolicyId>SigPolicyId>Identifier"`
+	}
+	err = xml.Unmarshal([]byte(signedDocument), &file)
+	if err != nil || file.XMLName.Space != TICKETBAI_NAMESPACE || file.XMLName.Local != "TicketBai" || file.Emisor != r.IssuerTaxId || file.SignatureValue != signatureValue || file.Policy != TICKETBAI_SIGNATURE_POLICY {
+		t.Error("The signed TicketBAI file is not correct", err)
+		return
+	}
+
+	// the signature value is calculated over the canonical form of the SignedInfo element
+	signedInfo := signedDocument[strings.Index(signedDocument, "<ds:SignedInfo") : strings.Index(signedDocument, "</ds:SignedInfo>")+len("</ds:SignedInfo>")]
+	signedInfo = strings.Replace(signedInfo, "<ds:SignedInfo", "<ds:SignedInfo"+TICKETBAI_NAMESPACE_DECLARATIONS, 1)
+	signedInfoDigest := sha256.Sum256([]byte(signedInfo))
+	signatureData, _ := base64.StdEncoding.DecodeString(signatureValue)
+	err = rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, signedInfoDigest[:], signatureData)
+	if err != nil {
+		t.Error("The signature is not valid", err)
+		return
+	}
+	r.SignatureValue = signatureValue
+	if !strings.Contains(r.getTicketBaiId(), "-"+signatureValue[:13]+"-") {
+		t.Error("The TicketBAI identifier doesn't contain the signature value", r.getTicketBaiId())
+		return
+	}
+}
+
+// ===== STATEMENT OF ACCOUNT
+
+func TestStatementOfAccount(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	var product int32 = 4
+	var customerId int32 = 1
+	q := StatementOfAccountQuery{CustomerId: &customerId}
+	before := q.getStatementOfAccount(1)
+
+	// insert an invoice that is not posted
+	i := SalesInvoice{
+		CustomerId:       customerId,
+		PaymentMethodId:  1,
+		BillingSeriesId:  "INT",
+		CurrencyId:       1,
+		BillingAddressId: 1,
+		EnterpriseId:     1,
+	}
+	_, invoiceId := i.insertSalesInvoice(0, nil)
+	d := SalesInvoiceDetail{
+		InvoiceId:    invoiceId,
+		ProductId:    &product,
+		Price:        9.99,
+		Quantity:     2,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+	d.insertSalesInvoiceDetail(nil, 0)
+	i = getSalesInvoiceRow(invoiceId)
+
+	statement := q.getStatementOfAccount(1)
+	if len(statement.Entries) != len(before.Entries)+1 || absf(statement.ClosingBalance-(before.ClosingBalance+i.TotalAmount)) > 0.000001 {
+		t.Error("The invoice is not in the statement of account")
+		return
+	}
+	for j := 1; j < len(statement.Entries); j++ {
+		if statement.Entries[j].Date.Before(statement.Entries[j-1].Date) {
+			t.Error("The statement of account is not in date order")
+			return
+		}
+	}
+
+	// the entries before the start date are in the opening balance
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	q.DateStart = &tomorrow
+	statement = q.getStatementOfAccount(1)
+	if len(statement.Entries) != 0 || absf(statement.OpeningBalance-statement.ClosingBalance) > 0.000001 {
+		t.Error("The opening balance of the statement of account is not correct")
+		return
+	}
+
+	// the new invoice is pending in the first bucket
+	aging := AgingReportQuery{Type: "C"}
+	report := aging.getAgingReport(1)
+	var found bool
+	for j := 0; j < len(report.Rows); j++ {
+		if report.Rows[j].Id == customerId {
+			found = report.Rows[j].Days0To30 >= i.TotalAmount
+			break
+		}
+	}
+	if !found {
+		t.Error("The invoice is not in the aging report")
+		return
+	}
+
+	// DELETE
+	if !i.deleteSalesInvoice(0).Ok {
+		t.Error("Delete error, can't delete sale invoice")
+		return
+	}
+}
+
+func TestAgingReportBuckets(t *testing.T) {
+	var r AgingReportRow
+	r.add(0, 1)
+	r.add(30, 2)
+	r.add(31, 4)
+	r.add(60, 8)
+	r.add(61, 16)
+	r.add(90, 32)
+	r.add(91, 64)
+	if r.Days0To30 != 3 || r.Days31To60 != 12 || r.Days61To90 != 48 || r.DaysOver90 != 64 || r.Total != 127 {
+		t.Error("The aging buckets are not correct", r)
+		return
+	}
+}
+
+// ===== DUNNING
+
+func TestDunning(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	var product int32 = 4
+
+	l := DunningLevel{
+		Name:         "Test reminder",
+		Days:         9999,
+		Subject:      "Reminder $$document_name$$",
+		Body:         "<p>$$customer_name$$, $$pending$$ are pending since $$date_expiration$$</p>",
+		EnterpriseId: 1,
+	}
+	if !l.insertDunningLevel() {
+		t.Error("Insert error, can't insert dunning level")
+		return
+	}
+
+	// insert and post an invoice
+	i := SalesInvoice{
+		CustomerId:       1,
+		PaymentMethodId:  1,
+		BillingSeriesId:  "INT",
+		CurrencyId:       1,
+		BillingAddressId: 1,
+		EnterpriseId:     1,
+	}
+	_, invoiceId := i.insertSalesInvoice(0, nil)
+	d := SalesInvoiceDetail{
+		InvoiceId:    invoiceId,
+		ProductId:    &product,
+		Price:        9.99,
+		Quantity:     2,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+	d.insertSalesInvoiceDetail(nil, 0)
+	result := salesPostInvoices([]int64{invoiceId}, 1, 0)
+	if len(result) == 0 || !result[0].Ok {
+		t.Error("Can't post sale invoice")
+		return
+	}
+	i = getSalesInvoiceRow(invoiceId)
+	collectionOperations := getColletionOperations(*i.AccountingMovementId, 1)
+	if len(collectionOperations) == 0 {
+		t.Error("The collection operation has not been created")
+		return
+	}
+	co := collectionOperations[0]
+
+	// the collection operation is overdue
+	dbOrm.Model(&CollectionOperation{}).Where("id = ? AND enterprise = ?", co.Id, 1).Update("date_expiration", time.Now().AddDate(0, 0, -10000))
+	runDunning(1)
+	history := getDunningHistory(co.Id, 1)
+	if len(history) != 1 || history[0].DunningLevelId != l.Id || history[0].DaysOverdue < 9999 {
+		t.Error("The reminder has not been recorded in the dunning history")
+		return
+	}
+
+	// each level is sent only once, and the reminders that could not be sent are tried again in the same row
+	runDunning(1)
+	retried := getDunningHistory(co.Id, 1)
+	if len(retried) != 1 {
+		t.Error("The reminder has been sent twice")
+		return
+	}
+	if history[0].Ok != !retried[0].DateSent.After(history[0].DateSent) {
+		t.Error("The reminder has been sent again, or the failed reminder has not been tried again")
+		return
+	}
+
+	// DELETE
+	dbOrm.Where("dunning_level = ? AND enterprise = ?", l.Id, 1).Delete(&DunningHistory{})
+	if !l.deleteDunningLevel() {
+		t.Error("Delete error, can't delete dunning level")
+		return
+	}
+	am := getAccountingMovementRow(*i.AccountingMovementId)
+	if !am.deleteAccountingMovement(0, nil) {
+		t.Error("Delete error, can't delete accounting movement")
+		return
+	}
+	if !i.deleteSalesInvoice(0).Ok {
+		t.Error("Delete error, can't delete sale invoice")
+		return
+	}
+}
+
+func TestReplaceDunningTemplate(t *testing.T) {
+	co := CollectionOperation{
+		DocumentName:   "INT/2022/000001",
+		DateCreated:    time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		DateExpiration: time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC),
+		Total:          121,
+		Paid:           21,
+		Pending:        100,
+	}
+	text := replaceDunningTemplate("$$customer_name$$: $$document_name$$ $$date_expiration$$ $$days_overdue$$ $$pending$$ $$enterprise_name$$", &co, "Customer", 15, "Enterprise")
+	if text != "Customer: INT/2022/000001 2022-01-31 15 100.00 Enterprise" {
+		t.Error("The dunning template has not been replaced", text)
+		return
+	}
+}
+
 // ===== POST PURCHASE INVOICES
 
 func TestPurchasePostInvoices(t *testing.T) {
@@ -37,6 +37,7 @@ type Address struct {
 	PrestaShopId      int32     `json:"-" gorm:"column:ps_id;not null;index:address_ps_id,unique:true,priority:2,where:ps_id <> 0"`
 	ZipCode           string    `json:"zipCode" gorm:"type:character varying(12);not null:true"`
 	ShopifyId         int64     `json:"-" gorm:"column:sy_id;not null;index:address_sy_id,unique:true,priority:2,where:sy_id <> 0"`
+	Gln               string    `json:"gln" gorm:"type:character varying(13);not null:true;default:''"` // Global Location Number of the delivery point or the invoicee in the EDI messages
 	EnterpriseId      int32     `json:"-" gorm:"column:enterprise;not null:true;index:address_id_enterprise,unique:true,priority:2;index:address_ps_id,unique:true,priority:1,where:ps_id <> 0;index:address_sy_id,unique:true,priority:1,where:sy_id <> 0"`
 	Enterprise        Settings  `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 }
@@ -100,7 +101,7 @@ func (s *PaginatedSearch) searchAddresses() Addresses {
 }
 
 func (a *Address) isValid() bool {
-	return !((a.CustomerId == nil && a.SupplierId == nil) || (a.CustomerId != nil && *a.CustomerId <= 0) || (a.SupplierId != nil && *a.SupplierId <= 0) || len(a.Address) == 0 || len(a.Address) > 200 || len(a.Address2) > 200 || len(a.City) == 0 || len(a.City) > 100 || a.CountryId <= 0 || (a.PrivateOrBusiness != "P" && a.PrivateOrBusiness != "B" && a.PrivateOrBusiness != "_") || len(a.Notes) > 1000 || len(a.ZipCode) > 12)
+	return !((a.CustomerId == nil && a.SupplierId == nil) || (a.CustomerId != nil && *a.CustomerId <= 0) || (a.SupplierId != nil && *a.SupplierId <= 0) || len(a.Address) == 0 || len(a.Address) > 200 || len(a.Address2) > 200 || len(a.City) == 0 || len(a.City) > 100 || a.CountryId <= 0 || (a.PrivateOrBusiness != "P" && a.PrivateOrBusiness != "B" && a.PrivateOrBusiness != "_") || len(a.Notes) > 1000 || len(a.ZipCode) > 12 || !glnIsValid(a.Gln))
 }
 
 func (a *Address) BeforeCreate(tx *gorm.DB) (err error) {
@@ -174,6 +175,7 @@ func (a *Address) updateAddress() bool {
 	address.PrivateOrBusiness = a.PrivateOrBusiness
 	address.Notes = a.Notes
 	address.ZipCode = a.ZipCode
+	address.Gln = a.Gln
 
 	result = dbOrm.Save(&address)
 	if result.Error != nil {
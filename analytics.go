@@ -727,8 +727,10 @@ type BenefitsStatisticsQuery struct {
 }
 
 type BenefitsStatistics struct {
-	Sales     []BenefitsStatisticsValue `json:"sales"`
-	Purchases []BenefitsStatisticsValue `json:"purchases"`
+	Sales           []BenefitsStatisticsValue `json:"sales"`
+	Purchases       []BenefitsStatisticsValue `json:"purchases"`
+	CostOfGoodsSold []BenefitsStatisticsValue `json:"costOfGoodsSold"` // Cost of the stock delivered in the sales delivery notes
+	GrossMargin     []BenefitsStatisticsValue `json:"grossMargin"`     // Sales without taxes minus the cost of the goods sold
 }
 
 type BenefitsStatisticsValue struct {
@@ -741,6 +743,8 @@ func (q *BenefitsStatisticsQuery) benefitsStatistics(enterpriseId int32) Benefit
 	var benefits BenefitsStatistics = BenefitsStatistics{}
 	benefits.Sales = make([]BenefitsStatisticsValue, 0)
 	benefits.Purchases = make([]BenefitsStatisticsValue, 0)
+	benefits.CostOfGoodsSold = make([]BenefitsStatisticsValue, 0)
+	benefits.GrossMargin = make([]BenefitsStatisticsValue, 0)
 
 	if q.Purchases {
 		sqlStatement := `SELECT EXTRACT(YEAR FROM date_created), EXTRACT(MONTH FROM date_created), SUM(total_amount) FROM purchase_invoice WHERE date_created >= $1 AND date_created <= $2 AND enterprise = $3 GROUP BY EXTRACT(YEAR FROM date_created), EXTRACT(MONTH FROM date_created) ORDER BY EXTRACT(YEAR FROM date_created), EXTRACT(MONTH FROM date_created) ASC`
@@ -770,6 +774,32 @@ func (q *BenefitsStatisticsQuery) benefitsStatistics(enterpriseId int32) Benefit
 			rows.Scan(&v.Year, &v.Month, &v.Value)
 			benefits.Sales = append(benefits.Sales, v)
 		}
+
+		sqlStatement = `SELECT EXTRACT(YEAR FROM date_created), EXTRACT(MONTH FROM date_created), SUM(cost_of_goods_sold) FROM sales_delivery_note WHERE date_created >= $1 AND date_created <= $2 AND enterprise = $3 GROUP BY EXTRACT(YEAR FROM date_created), EXTRACT(MONTH FROM date_created) ORDER BY EXTRACT(YEAR FROM date_created), EXTRACT(MONTH FROM date_created) ASC`
+		rows, err = db.Query(sqlStatement, q.DateStart, q.DateEnd, enterpriseId)
+		if err != nil {
+			log("DB", err.Error())
+			return benefits
+		}
+
+		for rows.Next() {
+			v := BenefitsStatisticsValue{}
+			rows.Scan(&v.Year, &v.Month, &v.Value)
+			benefits.CostOfGoodsSold = append(benefits.CostOfGoodsSold, v)
+		}
+
+		sqlStatement = `SELECT COALESCE(s.year, c.year), COALESCE(s.month, c.month), COALESCE(s.amount, 0) - COALESCE(c.amount, 0) FROM (SELECT EXTRACT(YEAR FROM date_created) AS year, EXTRACT(MONTH FROM date_created) AS month, SUM(total_with_discount) AS amount FROM sales_invoice WHERE date_created >= $1 AND date_created <= $2 AND enterprise = $3 GROUP BY EXTRACT(YEAR FROM date_created), EXTRACT(MONTH FROM date_created)) s FULL OUTER JOIN (SELECT EXTRACT(YEAR FROM date_created) AS year, EXTRACT(MONTH FROM date_created) AS month, SUM(cost_of_goods_sold) AS amount FROM sales_delivery_note WHERE date_created >= $1 AND date_created <= $2 AND enterprise = $3 GROUP BY EXTRACT(YEAR FROM date_created), EXTRACT(MONTH FROM date_created)) c ON s.year = c.year AND s.month = c.month ORDER BY 1, 2 ASC`
+		rows, err = db.Query(sqlStatement, q.DateStart, q.DateEnd, enterpriseId)
+		if err != nil {
+			log("DB", err.Error())
+			return benefits
+		}
+
+		for rows.Next() {
+			v := BenefitsStatisticsValue{}
+			rows.Scan(&v.Year, &v.Month, &v.Value)
+			benefits.GrossMargin = append(benefits.GrossMargin, v)
+		}
 	}
 
 	return benefits
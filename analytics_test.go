@@ -10,7 +10,10 @@ You should have received a copy of the GNU Affero General Public License along w
 
 package main
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestMonthlySalesAmount(t *testing.T) {
 	if db == nil {
@@ -99,6 +102,61 @@ func TestPurchaseOrdersByMonthAmount(t *testing.T) {
 	}
 }
 
+func TestSupplierScorecard(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	q := SupplierScorecardQuery{}
+	s := q.getSupplierScorecard(1)
+	if len(s) == 0 || s[0].SupplierId <= 0 || s[0].Lines <= 0 {
+		t.Error("Can't scan the supplier scorecard")
+		return
+	}
+}
+
+func TestComputeSupplierScorecard(t *testing.T) {
+	promised := time.Date(2022, 3, 10, 0, 0, 0, 0, time.UTC)
+	onTime := time.Date(2022, 3, 10, 18, 30, 0, 0, time.UTC)
+	late := time.Date(2022, 3, 11, 9, 0, 0, 0, time.UTC)
+
+	lines := []SupplierScorecardLine{
+		{SupplierId: 2, SupplierName: "B", Quantity: 10, Price: 5, DatePromised: &promised, QuantityReceived: 10, DateLastReceived: &onTime, QuantityInvoiced: 10, AmountInvoiced: 55, QuantityReturned: 1},
+		{SupplierId: 2, SupplierName: "B", Quantity: 10, Price: 5, DatePromised: &promised, QuantityReceived: 8, DateLastReceived: &late, QuantityInvoiced: 8, AmountInvoiced: 40},
+		{SupplierId: 2, SupplierName: "B", Quantity: 4, Price: 5, DatePromised: &promised, QuantityReceived: 4, DateLastReceived: &late},
+		{SupplierId: 1, SupplierName: "A", Quantity: 5, Price: 2},
+	}
+
+	s := computeSupplierScorecard(lines)
+	if len(s) != 2 || s[0].SupplierId != 1 || s[1].SupplierId != 2 {
+		t.Error("There must be a scorecard for each supplier sorted by name", s)
+		return
+	}
+	if s[0].Lines != 1 || s[0].OnTimeRate != 0 || s[0].QuantityAccuracy != 0 || s[0].PriceVariance != 0 || s[0].RejectionRate != 0 {
+		t.Error("A supplier without receipts can't be scored", s[0])
+		return
+	}
+
+	// the line partially received is not measured for the on time rate
+	b := s[1]
+	if b.Lines != 3 || b.LinesPromised != 2 || b.LinesOnTime != 1 || b.OnTimeRate != 50 {
+		t.Error("The on time rate is not correct", b)
+		return
+	}
+	if b.LinesReceived != 3 || b.LinesExact != 2 || b.QuantityAccuracy != 66.67 {
+		t.Error("The quantity accuracy is not correct", b)
+		return
+	}
+	if b.AmountOrdered != 90 || b.AmountInvoiced != 95 || b.PriceVariance != 5.56 {
+		t.Error("The price variance is not correct", b)
+		return
+	}
+	if b.QuantityReceived != 22 || b.QuantityReturned != 1 || b.RejectionRate != 4.55 {
+		t.Error("The rejection rate is not correct", b)
+		return
+	}
+}
+
 func TestPaymentMethodsSaleOrdersAmount(t *testing.T) {
 	if db == nil {
 		ConnectTestWithDB(t)
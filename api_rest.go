@@ -34,13 +34,19 @@ func addHttpHandlerFuncions() {
 	http.HandleFunc("/api/sale_order_details_digital_product_data", apiSaleOrderDetailsDigitalProductData)
 	http.HandleFunc("/api/sale_invoices", apiSaleInvoices)
 	http.HandleFunc("/api/sale_invoice_details", apiSaleInvoiceDetals)
+	http.HandleFunc("/api/sale_invoice_facturae", apiSaleInvoiceFacturae)
+	http.HandleFunc("/api/sale_invoice_ubl", apiSaleInvoiceUBL)
+	http.HandleFunc("/api/sale_invoice_register", apiSaleInvoiceRegister)
+	http.HandleFunc("/api/sale_invoice_register_verification", apiSaleInvoiceRegisterVerification)
 	http.HandleFunc("/api/sale_delivery_notes", apiSaleDeliveryNotes)
 	// purchases
 	http.HandleFunc("/api/purchase_orders", apiPurchaseOrders)
 	http.HandleFunc("/api/purchase_order_details", apiPurchaseOrderDetails)
 	http.HandleFunc("/api/purchase_invoices", apiPurchaseInvoices)
 	http.HandleFunc("/api/purchase_invoice_details", apiPurchaseInvoiceDetails)
+	http.HandleFunc("/api/purchase_invoice_ubl", apiPurchaseInvoiceUBL)
 	http.HandleFunc("/api/purchase_delivery_notes", apiPurchaseDeliveryNotes)
+	http.HandleFunc("/api/supplier_scorecard", apiSupplierScorecard)
 	// masters
 	http.HandleFunc("/api/customers", apiCustomers)
 	http.HandleFunc("/api/suppliers", apiSuppliers)
@@ -62,9 +68,12 @@ func addHttpHandlerFuncions() {
 	// warehouse
 	http.HandleFunc("/api/warehouses", apiWarehouses)
 	http.HandleFunc("/api/warehouse_movements", apiWarehouseMovements)
+	http.HandleFunc("/api/lot_recall", apiLotRecall)
+	http.HandleFunc("/api/serial_number_history", apiSerialNumberHistory)
 	http.HandleFunc("/api/transfer_between_warehouses", apiTransferBetweenWarehouses)
 	http.HandleFunc("/api/transfer_between_warehouses_details", apiTransferBetweenWarehousesDetails)
 	http.HandleFunc("/api/product_minimum_stock", apiTransferBetweenWarehousesMinimumStock)
+	http.HandleFunc("/api/product_supplier", apiProductSupplier)
 	// manufacturing
 	http.HandleFunc("/api/manufacturing_orders", apiManufacturingOrders)
 	http.HandleFunc("/api/manufacturing_order_types", apiManufacturingOrderTypes)
@@ -87,6 +96,8 @@ func addHttpHandlerFuncions() {
 	http.HandleFunc("/api/payment", apiPayments)
 	http.HandleFunc("/api/post_sale_invoice", apiPostSaleInvoices)
 	http.HandleFunc("/api/post_purchase_invoice", apiPostPurchaseInvoices)
+	http.HandleFunc("/api/statement_of_account", apiStatementOfAccount)
+	http.HandleFunc("/api/aging_report", apiAgingReport)
 }
 
 func apiSaleOrders(w http.ResponseWriter, r *http.Request) {
@@ -134,17 +145,20 @@ func apiSaleOrders(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
+		var okAndErr OkAndErrorCodeReturn
 		if string(body[0]) == "{" {
 			var saleOrder SaleOrder
 			json.Unmarshal(body, &saleOrder)
 			saleOrder.EnterpriseId = enterpriseId
-			ok, _ = saleOrder.insertSalesOrder(userId)
+			okAndErr, _ = saleOrder.insertSalesOrder(userId, nil)
+			ok = okAndErr.Ok
 		} else if string(body[0]) == "[" {
 			var saleOrders []SaleOrder
 			json.Unmarshal(body, &saleOrders)
 			for i := 0; i < len(saleOrders); i++ {
 				saleOrders[i].EnterpriseId = enterpriseId
-				ok, _ = saleOrders[i].insertSalesOrder(userId)
+				okAndErr, _ = saleOrders[i].insertSalesOrder(userId, nil)
+				ok = okAndErr.Ok
 				if !ok {
 					break
 				}
@@ -152,6 +166,13 @@ func apiSaleOrders(w http.ResponseWriter, r *http.Request) {
 		} else {
 			ok = false
 		}
+		// the order was rejected because of the customer's risk, return the error code to the client
+		if !ok && okAndErr.ErrorCode > 0 {
+			resp, _ := json.Marshal(okAndErr)
+			w.WriteHeader(http.StatusNotAcceptable)
+			w.Write(resp)
+			return
+		}
 	case "PUT":
 		if !permission.SaleOrders.Put {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -234,13 +255,13 @@ func apiSaleOrderDetails(w http.ResponseWriter, r *http.Request) {
 			var saleOrderDetail SalesOrderDetail
 			json.Unmarshal(body, &saleOrderDetail)
 			saleOrderDetail.EnterpriseId = enterpriseId
-			ok = saleOrderDetail.insertSalesOrderDetail(userId).Ok
+			ok = saleOrderDetail.insertSalesOrderDetail(userId, nil).Ok
 		} else if string(body[0]) == "[" {
 			var saleOrderDetails []SalesOrderDetail
 			json.Unmarshal(body, &saleOrderDetails)
 			for i := 0; i < len(saleOrderDetails); i++ {
 				saleOrderDetails[i].EnterpriseId = enterpriseId
-				ok = saleOrderDetails[i].insertSalesOrderDetail(userId).Ok
+				ok = saleOrderDetails[i].insertSalesOrderDetail(userId, nil).Ok
 				if !ok {
 					break
 				}
@@ -554,6 +575,187 @@ func apiSaleInvoiceDetals(w http.ResponseWriter, r *http.Request) {
 	w.Write(resp)
 }
 
+func apiSaleInvoiceFacturae(w http.ResponseWriter, r *http.Request) {
+	// headers
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Access-Control-Allow-Headers", "content-type")
+	// auth
+	ok, _, enterpriseId, permission := checkApiKey(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// check body length
+	if r.ContentLength > settings.Server.WebSecurity.MaxRequestBodyLength {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, settings.Server.WebSecurity.MaxRequestBodyLength)
+	// read body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	// methods
+	switch r.Method {
+	case "GET":
+		if !permission.SaleInvoices.Get {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id, err := strconv.Atoi(string(body))
+		if err != nil || id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		document, result := generateSalesInvoiceFacturae(int64(id), enterpriseId)
+		if !result.Ok {
+			resp, _ := json.Marshal(result)
+			w.Header().Add("Content-type", "application/json")
+			w.WriteHeader(http.StatusNotAcceptable)
+			w.Write(resp)
+			return
+		}
+		w.Header().Add("Content-type", "application/xml")
+		w.Write(document)
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+func apiSaleInvoiceUBL(w http.ResponseWriter, r *http.Request) {
+	// headers
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Access-Control-Allow-Headers", "content-type")
+	// auth
+	ok, _, enterpriseId, permission := checkApiKey(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// check body length
+	if r.ContentLength > settings.Server.WebSecurity.MaxRequestBodyLength {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, settings.Server.WebSecurity.MaxRequestBodyLength)
+	// read body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	// methods
+	switch r.Method {
+	case "GET":
+		if !permission.SaleInvoices.Get {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id, err := strconv.Atoi(string(body))
+		if err != nil || id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		document, result := generateSalesInvoiceUBL(int64(id), enterpriseId)
+		if !result.Ok {
+			resp, _ := json.Marshal(result)
+			w.Header().Add("Content-type", "application/json")
+			w.WriteHeader(http.StatusNotAcceptable)
+			w.Write(resp)
+			return
+		}
+		w.Header().Add("Content-type", "application/xml")
+		w.Write(document)
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+func apiSaleInvoiceRegister(w http.ResponseWriter, r *http.Request) {
+	// headers
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Access-Control-Allow-Headers", "content-type")
+	// auth
+	ok, _, enterpriseId, permission := checkApiKey(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// check body length
+	if r.ContentLength > settings.Server.WebSecurity.MaxRequestBodyLength {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, settings.Server.WebSecurity.MaxRequestBodyLength)
+	// read body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	// methods
+	switch r.Method {
+	case "GET":
+		if !permission.SaleInvoices.Get {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id, err := strconv.Atoi(string(body))
+		if err != nil || id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		document, result := generateSalesInvoiceRegisterXML(int64(id), enterpriseId)
+		if !result.Ok {
+			resp, _ := json.Marshal(result)
+			w.Header().Add("Content-type", "application/json")
+			w.WriteHeader(http.StatusNotAcceptable)
+			w.Write(resp)
+			return
+		}
+		w.Header().Add("Content-type", "application/xml")
+		w.Write(document)
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+func apiSaleInvoiceRegisterVerification(w http.ResponseWriter, r *http.Request) {
+	// headers
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Access-Control-Allow-Headers", "content-type")
+	w.Header().Add("Content-type", "application/json")
+	// auth
+	ok, _, enterpriseId, permission := checkApiKey(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// methods
+	switch r.Method {
+	case "GET":
+		if !permission.SaleInvoices.Get {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, _ := json.Marshal(verifySalesInvoiceRegister(enterpriseId))
+		w.Write(data)
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
 func apiSaleDeliveryNotes(w http.ResponseWriter, r *http.Request) {
 	// headers
 	w.Header().Add("Access-Control-Allow-Origin", "*")
@@ -1000,6 +1202,49 @@ func apiPurchaseInvoiceDetails(w http.ResponseWriter, r *http.Request) {
 	w.Write(resp)
 }
 
+func apiPurchaseInvoiceUBL(w http.ResponseWriter, r *http.Request) {
+	// headers
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Access-Control-Allow-Headers", "content-type")
+	w.Header().Add("Content-type", "application/json")
+	// auth
+	ok, userId, enterpriseId, permission := checkApiKey(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// check body length
+	if r.ContentLength > settings.Server.WebSecurity.MaxRequestBodyLength {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, settings.Server.WebSecurity.MaxRequestBodyLength)
+	// read body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	// methods
+	switch r.Method {
+	case "POST":
+		if !permission.PurchaseInvoices.Post {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		result := importPurchaseInvoiceUBL(body, enterpriseId, userId)
+		resp, _ := json.Marshal(result)
+		if !result.Ok {
+			w.WriteHeader(http.StatusNotAcceptable)
+		}
+		w.Write(resp)
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
 func apiPurchaseDeliveryNotes(w http.ResponseWriter, r *http.Request) {
 	// headers
 	w.Header().Add("Access-Control-Allow-Origin", "*")
@@ -1082,6 +1327,47 @@ func apiPurchaseDeliveryNotes(w http.ResponseWriter, r *http.Request) {
 	w.Write(resp)
 }
 
+func apiSupplierScorecard(w http.ResponseWriter, r *http.Request) {
+	// headers
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Access-Control-Allow-Headers", "content-type")
+	w.Header().Add("Content-type", "application/json")
+	// auth
+	ok, _, enterpriseId, permission := checkApiKey(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// check body length
+	if r.ContentLength > settings.Server.WebSecurity.MaxRequestBodyLength {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, settings.Server.WebSecurity.MaxRequestBodyLength)
+	// read body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	// methods
+	switch r.Method {
+	case "GET":
+		if !permission.PurchaseOrders.Get {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var query SupplierScorecardQuery
+		json.Unmarshal(body, &query)
+		data, _ := json.Marshal(query.getSupplierScorecard(enterpriseId))
+		w.Write(data)
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
 func apiCustomers(w http.ResponseWriter, r *http.Request) {
 	// headers
 	w.Header().Add("Access-Control-Allow-Origin", "*")
@@ -2604,6 +2890,89 @@ func apiWarehouseMovements(w http.ResponseWriter, r *http.Request) {
 	w.Write(resp)
 }
 
+func apiLotRecall(w http.ResponseWriter, r *http.Request) {
+	// headers
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Access-Control-Allow-Headers", "content-type")
+	w.Header().Add("Content-type", "application/json")
+	// auth
+	ok, _, enterpriseId, permission := checkApiKey(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// check body length
+	if r.ContentLength > settings.Server.WebSecurity.MaxRequestBodyLength {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, settings.Server.WebSecurity.MaxRequestBodyLength)
+	// read body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	// methods
+	switch r.Method {
+	case "GET":
+		if !permission.WarehouseMovements.Get {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id, err := strconv.Atoi(string(body))
+		if err != nil || id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := json.Marshal(getLotRecall(int64(id), enterpriseId))
+		w.Write(data)
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+func apiSerialNumberHistory(w http.ResponseWriter, r *http.Request) {
+	// headers
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Access-Control-Allow-Headers", "content-type")
+	w.Header().Add("Content-type", "application/json")
+	// auth
+	ok, _, enterpriseId, permission := checkApiKey(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// check body length
+	if r.ContentLength > settings.Server.WebSecurity.MaxRequestBodyLength {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, settings.Server.WebSecurity.MaxRequestBodyLength)
+	// read body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	// methods
+	switch r.Method {
+	case "GET":
+		if !permission.WarehouseMovements.Get {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, _ := json.Marshal(getSerialNumberHistory(string(body), enterpriseId))
+		w.Write(data)
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
 func apiTransferBetweenWarehouses(w http.ResponseWriter, r *http.Request) {
 	// headers
 	w.Header().Add("Access-Control-Allow-Origin", "*")
@@ -2836,6 +3205,88 @@ func apiTransferBetweenWarehousesMinimumStock(w http.ResponseWriter, r *http.Req
 	w.Write(resp)
 }
 
+func apiProductSupplier(w http.ResponseWriter, r *http.Request) {
+	// headers
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Access-Control-Allow-Headers", "content-type")
+	w.Header().Add("Content-type", "application/json")
+	// auth
+	ok, _, enterpriseId, permission := checkApiKey(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// check body length
+	if r.ContentLength > settings.Server.WebSecurity.MaxRequestBodyLength {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, settings.Server.WebSecurity.MaxRequestBodyLength)
+	// read body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	// methods
+	ok = false
+	switch r.Method {
+	case "GET":
+		if !permission.Products.Get {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id, err := strconv.Atoi(string(body))
+		if err != nil || id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := json.Marshal(getProductSuppliers(int32(id), enterpriseId))
+		w.Write(data)
+		return
+	case "POST":
+		if !permission.Products.Post {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var productSupplier ProductSupplier
+		json.Unmarshal(body, &productSupplier)
+		productSupplier.EnterpriseId = enterpriseId
+		ok = productSupplier.insertProductSupplier()
+	case "PUT":
+		if !permission.Products.Put {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var productSupplier ProductSupplier
+		json.Unmarshal(body, &productSupplier)
+		productSupplier.EnterpriseId = enterpriseId
+		ok = productSupplier.updateProductSupplier()
+	case "DELETE":
+		if !permission.Products.Delete {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id, err := strconv.Atoi(string(body))
+		if err != nil || id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var productSupplier ProductSupplier
+		productSupplier.Id = int32(id)
+		productSupplier.EnterpriseId = enterpriseId
+		ok = productSupplier.deleteProductSupplier()
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	resp, _ := json.Marshal(ok)
+	if !ok {
+		w.WriteHeader(http.StatusNotAcceptable)
+	}
+	w.Write(resp)
+}
+
 func apiManufacturingOrders(w http.ResponseWriter, r *http.Request) {
 	// headers
 	w.Header().Add("Access-Control-Allow-Origin", "*")
@@ -4196,3 +4647,93 @@ func apiPostPurchaseInvoices(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func apiStatementOfAccount(w http.ResponseWriter, r *http.Request) {
+	// headers
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Access-Control-Allow-Headers", "content-type")
+	w.Header().Add("Content-type", "application/json")
+	// auth
+	ok, _, enterpriseId, permission := checkApiKey(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// check body length
+	if r.ContentLength > settings.Server.WebSecurity.MaxRequestBodyLength {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, settings.Server.WebSecurity.MaxRequestBodyLength)
+	// read body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	// methods
+	switch r.Method {
+	case "GET":
+		var query StatementOfAccountQuery
+		json.Unmarshal(body, &query)
+		if !query.isValid() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if (query.CustomerId != nil && !permission.CollectionOperation.Get) || (query.SupplierId != nil && !permission.PaymentTransaction.Get) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, _ := json.Marshal(query.getStatementOfAccount(enterpriseId))
+		w.Write(data)
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
+
+func apiAgingReport(w http.ResponseWriter, r *http.Request) {
+	// headers
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Access-Control-Allow-Headers", "content-type")
+	w.Header().Add("Content-type", "application/json")
+	// auth
+	ok, _, enterpriseId, permission := checkApiKey(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// check body length
+	if r.ContentLength > settings.Server.WebSecurity.MaxRequestBodyLength {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, settings.Server.WebSecurity.MaxRequestBodyLength)
+	// read body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	// methods
+	switch r.Method {
+	case "GET":
+		var query AgingReportQuery
+		json.Unmarshal(body, &query)
+		if query.Type != "C" && query.Type != "S" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if (query.Type == "C" && !permission.CollectionOperation.Get) || (query.Type == "S" && !permission.PaymentTransaction.Get) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, _ := json.Marshal(query.getAgingReport(enterpriseId))
+		w.Write(data)
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+}
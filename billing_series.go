@@ -110,6 +110,20 @@ func getNextSaleOrderNumber(billingSerieId string, enterpriseId int32) int32 {
 	return (orderNumber + 1)
 }
 
+func getNextSalesQuotationNumber(billingSerieId string, enterpriseId int32) int32 {
+	var quotationNumber int32
+	var rowsCount int64
+	result := dbOrm.Model(&SalesQuotation{}).Where("billing_series = ? AND enterprise = ?", billingSerieId, enterpriseId).Order("quotation_number DESC").Limit(1).Select("quotation_number").Count(&rowsCount).Pluck("quotation_number", &quotationNumber)
+	if rowsCount == 0 {
+		return 1
+	}
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return 0
+	}
+	return (quotationNumber + 1)
+}
+
 func getNextSaleInvoiceNumber(billingSerieId string, enterpriseId int32) int32 {
 	var orderNumber int32
 	var rowsCount int64
@@ -233,7 +233,14 @@ func (c *CollectionOperation) deleteCollectionOperation(userId int32, trans *gor
 
 	insertTransactionalLog(c.EnterpriseId, "collection_operation", int(c.Id), userId, "D")
 
-	result := trans.Where("id = ? AND enterprise = ?", c.Id, c.EnterpriseId).Delete(&CollectionOperation{})
+	result := trans.Where("collection_operation = ? AND enterprise = ?", c.Id, c.EnterpriseId).Delete(&DunningHistory{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("id = ? AND enterprise = ?", c.Id, c.EnterpriseId).Delete(&CollectionOperation{})
 	if result.Error != nil {
 		log("DB", result.Error.Error())
 		trans.Rollback()
@@ -40,6 +40,8 @@ type ComplexManufacturingOrder struct {
 	DateTagPrinted             *time.Time             `json:"dateTagPrinted" gorm:"column:date_tag_printed;type:timestamp(3) with time zone"`
 	UserTagPrintedId           *int32                 `json:"userTagPrintedId" gorm:"column:user_tag_printed"`
 	UserTagPrinted             *User                  `json:"userTagPrinted" gorm:"foreignKey:UserTagPrintedId,EnterpriseId;references:Id,EnterpriseId"`
+	LotNumber                  string                 `json:"lotNumber" gorm:"column:lot_number;type:character varying(40);not null:true;default:''"` // Lot of the outputs with lot tracking. It's generated when manufacturing if it's empty.
+	ExpiryDate                 *time.Time             `json:"expiryDate" gorm:"column:expiry_date;type:timestamp(3) with time zone"`
 }
 
 func (c *ComplexManufacturingOrder) TableName() string {
@@ -206,7 +208,7 @@ func (orderInfo *ManufacturingOrderGenerate) complexManufacturingOrderPartiallyS
 		}
 
 		orderDetail := getSalesOrderDetailRow(orderInfoSelection.Id)
-		if orderDetail.Id <= 0 || orderDetail.OrderId != orderInfoSelection.OrderId || orderInfoSelection.Quantity == 0 || orderInfoSelection.Quantity > orderDetail.Quantity {
+		if orderDetail.Id <= 0 || orderDetail.OrderId != orderInfoSelection.OrderId || orderInfoSelection.Quantity == 0 || float64(orderInfoSelection.Quantity) > orderDetail.Quantity {
 			return false
 		}
 		if orderDetail.Status == "C" {
@@ -253,7 +255,7 @@ func complexManufacturingOrerGeneration(userId int32, enterpriseId int32, detail
 			return false
 		}
 
-		for j := 0; j < int(orderDetail.Quantity); j += int(component.Quantity) {
+		for j := 0.0; j < orderDetail.Quantity; j = roundQuantity(j + component.Quantity) {
 			cmo := ComplexManufacturingOrder{
 				TypeId:       manufacturingOrderType.Id,
 				EnterpriseId: enterpriseId,
@@ -293,7 +295,7 @@ func complexManufacturingOrerGeneration(userId int32, enterpriseId int32, detail
 				trans.Rollback()
 				return false
 			}
-		} // for j := 0; j < int(orderDetail.Quantity); j += int(component.Quantity) {
+		} // for j := 0.0; j < orderDetail.Quantity; j = roundQuantity(j + component.Quantity) {
 	} // for i := 0; i < len(details); i++
 
 	///
@@ -454,7 +456,7 @@ func (c *ComplexManufacturingOrder) insertComplexManufacturingOrder(userId int32
 					}
 
 					// associate with the existing orders
-					if quantityManufacturedForStock >= manufacturingOrderTypeComponent.Quantity {
+					if float64(quantityManufacturedForStock) >= manufacturingOrderTypeComponent.Quantity {
 						var quantityAdded int32 = 0
 						// the orders come sorted by date_created ASC, so the ones that are older are first (the ones we expect to manufacture before)
 						for i := 0; i < len(manufacturingOrders); i++ {
@@ -478,13 +480,13 @@ func (c *ComplexManufacturingOrder) insertComplexManufacturingOrder(userId int32
 							insertTransactionalLog(c.EnterpriseId, "manufacturing_order", int(manufacturingOrders[i].Id), userId, "U")
 							// stop the loop as soon as we get enought quantity
 							quantityAdded += manufacturingOrders[i].QuantityManufactured
-							if quantityAdded >= manufacturingOrderTypeComponent.Quantity {
+							if float64(quantityAdded) >= manufacturingOrderTypeComponent.Quantity {
 								break
 							}
 						}
 					} else { // there are no stock orders, create a new one
 						manufacturingOrderType := getManufacturingOrderTypeRow(*product.ManufacturingOrderTypeId)
-						for i := 0; i < int(manufacturingOrderTypeComponent.Quantity); i += int(manufacturingOrderType.QuantityManufactured) {
+						for i := 0.0; i < manufacturingOrderTypeComponent.Quantity; i += float64(manufacturingOrderType.QuantityManufactured) {
 							mo := ManufacturingOrder{
 								ProductId:    manufacturingOrderTypeComponent.ProductId,
 								TypeId:       manufacturingOrderTypeComponent.ManufacturingOrderTypeId,
@@ -686,6 +688,12 @@ func toggleManufactuedComplexManufacturingOrder(orderid int64, userId int32, ent
 
 	cmomo := getComplexManufacturingOrderManufacturingOrder(orderid, enterpriseId)
 	if !inMemoryComplexManufacturingOrder.Manufactured {
+		// the outputs with lot tracking get the lot of the order
+		lotNumber := inMemoryComplexManufacturingOrder.LotNumber
+		if len(lotNumber) == 0 {
+			lotNumber = generateManufacturingLotNumber(time.Now(), inMemoryComplexManufacturingOrder.Id)
+		}
+
 		for i := 0; i < len(cmomo); i++ {
 			if cmomo[i].Type == "I" {
 				continue
@@ -697,8 +705,10 @@ func toggleManufactuedComplexManufacturingOrder(orderid int64, userId int32, ent
 				ProductId:    cmomo[i].ProductId,
 				WarehouseId:  inMemoryComplexManufacturingOrder.WarehouseId,
 				Quantity:     com.Quantity,
-				Type:         "O",
+				Type:         "I", // the outputs enter the warehouse
 				EnterpriseId: enterpriseId,
+				LotNumber:    lotNumber,
+				ExpiryDate:   inMemoryComplexManufacturingOrder.ExpiryDate,
 			}
 			wm.insertWarehouseMovement(userId, trans)
 
@@ -0,0 +1,501 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// How the cost of the stock is calculated when the products enter and leave the warehouses
+const (
+	COSTING_METHOD_WEIGHTED_AVERAGE = "W" // Each product has a single cost per warehouse, the average of the units in stock, recalculated on every input
+	COSTING_METHOD_FIFO             = "F" // Each input creates a cost layer, the outputs take the units from the oldest layers first
+)
+
+// Units of a product that have entered a warehouse at a unit cost.
+// With the weighted average costing method there is only one layer with stock per product and warehouse.
+type CostLayer struct {
+	Id                int64     `json:"id" gorm:"index:cost_layer_id_enterprise,unique:true,priority:1"`
+	ProductId         int32     `json:"productId" gorm:"column:product;not null:true;index:cost_layer_product_warehouse,priority:2"`
+	Product           Product   `json:"-" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	WarehouseId       string    `json:"warehouseId" gorm:"column:warehouse;type:character(2);not null:true;index:cost_layer_product_warehouse,priority:3"`
+	Warehouse         Warehouse `json:"-" gorm:"foreignKey:WarehouseId,EnterpriseId;references:Id,EnterpriseId"`
+	DateCreated       time.Time `json:"dateCreated" gorm:"column:date_created;type:timestamp(3) with time zone;not null:true"`
+	Quantity          float64   `json:"quantity" gorm:"column:quantity;type:numeric(14,6);not null:true"`                    // Units that have entered the layer
+	QuantityRemaining float64   `json:"quantityRemaining" gorm:"column:quantity_remaining;type:numeric(14,6);not null:true"` // Units of the layer that are still in stock
+	UnitCost          float64   `json:"unitCost" gorm:"column:unit_cost;type:numeric(14,6);not null:true"`
+	EnterpriseId      int32     `json:"-" gorm:"column:enterprise;not null:true;index:cost_layer_id_enterprise,unique:true,priority:2;index:cost_layer_product_warehouse,priority:1"`
+	Enterprise        Settings  `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (l *CostLayer) TableName() string {
+	return "cost_layer"
+}
+
+func (l *CostLayer) BeforeCreate(tx *gorm.DB) (err error) {
+	var costLayer CostLayer
+	tx.Model(&CostLayer{}).Last(&costLayer)
+	l.Id = costLayer.Id + 1
+	return nil
+}
+
+// Cost layers of a product in all the warehouses, the ones with stock and the ones that have been used up.
+func getCostLayers(productId int32, enterpriseId int32) []CostLayer {
+	var layers []CostLayer = make([]CostLayer, 0)
+	result := dbOrm.Model(&CostLayer{}).Where("product = ? AND enterprise = ?", productId, enterpriseId).Order("warehouse ASC, date_created ASC, id ASC").Find(&layers)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return layers
+}
+
+// The layers of the product in the warehouse that have stock, the oldest goes first.
+func getCostLayersWithStock(productId int32, warehouseId string, enterpriseId int32, trans *gorm.DB) []CostLayer {
+	var layers []CostLayer = make([]CostLayer, 0)
+	result := trans.Model(&CostLayer{}).Where("product = ? AND warehouse = ? AND enterprise = ? AND quantity_remaining > 0", productId, warehouseId, enterpriseId).Order("date_created ASC, id ASC").Find(&layers)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return layers
+}
+
+// Quantity of a cost layer that has entered or left the warehouse in a warehouse movement, and the unit cost it had.
+// The quantity is positive if it has been added to the layer, and negative if it has been taken from the layer.
+type WarehouseMovementCostLayer struct {
+	WarehouseMovementId int64             `json:"warehouseMovementId" gorm:"primaryKey;column:warehouse_movement;not null:true"`
+	WarehouseMovement   WarehouseMovement `json:"-" gorm:"foreignKey:WarehouseMovementId,EnterpriseId;references:Id,EnterpriseId"`
+	CostLayerId         int64             `json:"costLayerId" gorm:"primaryKey;column:cost_layer;not null:true;index:warehouse_movement_cost_layer_cost_layer"`
+	CostLayer           CostLayer         `json:"costLayer" gorm:"foreignKey:CostLayerId,EnterpriseId;references:Id,EnterpriseId"`
+	Quantity            float64           `json:"quantity" gorm:"column:quantity;type:numeric(14,6);not null:true"`
+	UnitCost            float64           `json:"unitCost" gorm:"column:unit_cost;type:numeric(14,6);not null:true"`
+	EnterpriseId        int32             `json:"-" gorm:"primaryKey;column:enterprise;not null:true"`
+	Enterprise          Settings          `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (w *WarehouseMovementCostLayer) TableName() string {
+	return "warehouse_movement_cost_layer"
+}
+
+func getWarehouseMovementCostLayers(warehouseMovementId int64, enterpriseId int32) []WarehouseMovementCostLayer {
+	var layers []WarehouseMovementCostLayer = make([]WarehouseMovementCostLayer, 0)
+	result := dbOrm.Model(&WarehouseMovementCostLayer{}).Where("warehouse_movement_cost_layer.warehouse_movement = ? AND warehouse_movement_cost_layer.enterprise = ?", warehouseMovementId, enterpriseId).Joins("CostLayer").Order("warehouse_movement_cost_layer.cost_layer ASC").Find(&layers)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return layers
+}
+
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func getCostingMethod(enterpriseId int32, trans gorm.DB) string {
+	var costingMethod string
+	result := trans.Model(&Settings{}).Where("id = ?", enterpriseId).Pluck("costing_method", &costingMethod)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	if costingMethod != COSTING_METHOD_FIFO {
+		return COSTING_METHOD_WEIGHTED_AVERAGE
+	}
+	return costingMethod
+}
+
+// Cost of the units of a product that enter the warehouse without a known cost, or leave the warehouse without stock in the layers:
+// the cost of the last layer of the product in the warehouse, or the cost price of the product if it has never been costed.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func getCurrentUnitCost(productId int32, warehouseId string, enterpriseId int32, trans gorm.DB) float64 {
+	var layers []CostLayer
+	result := trans.Model(&CostLayer{}).Where("product = ? AND warehouse = ? AND enterprise = ?", productId, warehouseId, enterpriseId).Order("quantity_remaining > 0 DESC, date_created DESC, id DESC").Limit(1).Find(&layers)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	if len(layers) > 0 {
+		return layers[0].UnitCost
+	}
+
+	var costPrice float64
+	result = trans.Model(&Product{}).Where("id = ? AND enterprise = ?", productId, enterpriseId).Pluck("cost_price", &costPrice)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return costPrice
+}
+
+// Unit cost of the units that enter the warehouse in an inbound movement.
+// The purchases and the manual inputs with a price enter at their price, the sales returns enter at the cost they left with,
+// and the rest of the inputs (manufacturing, inventory...) enter at the current cost.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func (m *WarehouseMovement) getInboundUnitCost(quantity float64, trans gorm.DB) float64 {
+	if m.CostAmount > 0 {
+		return m.CostAmount / quantity
+	}
+	if m.Type == "I" && (m.PurchaseOrderDetailId != nil || m.PurchaseDeliveryNoteId != nil || (m.Manual && m.Price > 0)) {
+		return m.Price
+	}
+	if m.Type == "I" && m.SalesOrderId != nil && m.SalesOrderDetailId == nil {
+		var sold struct {
+			Quantity   float64
+			CostAmount float64
+		}
+		result := trans.Model(&WarehouseMovement{}).Where("sales_order = ? AND product = ? AND type = 'O' AND enterprise = ?", *m.SalesOrderId, m.ProductId, m.EnterpriseId).Select("COALESCE(SUM(quantity), 0) AS quantity, COALESCE(SUM(cost_amount), 0) AS cost_amount").Scan(&sold)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+		}
+		if sold.Quantity < 0 {
+			return sold.CostAmount / sold.Quantity
+		}
+	}
+	return getCurrentUnitCost(m.ProductId, m.WarehouseId, m.EnterpriseId, trans)
+}
+
+type CostLayerConsumption struct {
+	CostLayerId int64
+	Quantity    float64
+	UnitCost    float64
+}
+
+// Takes the quantity from the cost layers in the order that they are given, until the quantity is completed or there are no more layers.
+// Returns the quantity that has been taken from each layer, and the quantity that the layers could not cover.
+func consumeCostLayers(layers []CostLayer, quantity float64) ([]CostLayerConsumption, float64) {
+	consumption := make([]CostLayerConsumption, 0)
+	for i := 0; i < len(layers) && quantity > 0; i++ {
+		if layers[i].QuantityRemaining <= 0 {
+			continue
+		}
+		q := layers[i].QuantityRemaining
+		if q > quantity {
+			q = quantity
+		}
+		consumption = append(consumption, CostLayerConsumption{CostLayerId: layers[i].Id, Quantity: q, UnitCost: layers[i].UnitCost})
+		quantity = roundQuantity(quantity - q)
+	}
+	return consumption, quantity
+}
+
+// Unit cost of the stock after adding (or removing, with a negative quantity) units at a unit cost to the stock.
+// If there is no stock left, the unit cost doesn't change.
+func weightedAverageCost(quantity float64, unitCost float64, quantityAdded float64, unitCostAdded float64) float64 {
+	total := roundQuantity(quantity + quantityAdded)
+	if total <= 0 {
+		return unitCost
+	}
+	cost := (quantity*unitCost + quantityAdded*unitCostAdded) / total
+	if cost < 0 {
+		return 0
+	}
+	return cost
+}
+
+// Updates the cost layers of the product in the warehouse with a new warehouse movement, and sets the cost amount of the movement.
+// Inbound movements create a new layer (FIFO) or are added to the layer with the average cost, outbound movements take the units from the layers.
+// Inventory regularizations enter or take the difference between the quantity counted and the quantity in the layers.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func allocateWarehouseMovementCostLayers(m *WarehouseMovement, trans gorm.DB) bool {
+	layers := getCostLayersWithStock(m.ProductId, m.WarehouseId, m.EnterpriseId, &trans)
+
+	var quantity float64
+	if m.Type == "R" {
+		var quantityInLayers float64
+		for i := 0; i < len(layers); i++ {
+			quantityInLayers = roundQuantity(quantityInLayers + layers[i].QuantityRemaining)
+		}
+		quantity = roundQuantity(m.Quantity - quantityInLayers)
+	} else if isWarehouseMovementInbound(m) {
+		quantity = absf(m.Quantity)
+	} else {
+		quantity = -absf(m.Quantity)
+	}
+
+	if quantity > 0 {
+		unitCost := m.getInboundUnitCost(quantity, trans)
+		m.CostAmount = quantity * unitCost
+
+		var layer CostLayer
+		if getCostingMethod(m.EnterpriseId, trans) == COSTING_METHOD_WEIGHTED_AVERAGE && len(layers) > 0 {
+			// all the stock goes to a single layer at the average cost
+			layer = layers[0]
+			for i := 1; i < len(layers); i++ {
+				layer.UnitCost = weightedAverageCost(layer.QuantityRemaining, layer.UnitCost, layers[i].QuantityRemaining, layers[i].UnitCost)
+				layer.QuantityRemaining = roundQuantity(layer.QuantityRemaining + layers[i].QuantityRemaining)
+				result := trans.Model(&CostLayer{}).Where("id = ? AND enterprise = ?", layers[i].Id, m.EnterpriseId).Update("quantity_remaining", 0)
+				if result.Error != nil {
+					log("DB", result.Error.Error())
+					trans.Rollback()
+					return false
+				}
+			}
+			layer.UnitCost = weightedAverageCost(layer.QuantityRemaining, layer.UnitCost, quantity, unitCost)
+			layer.Quantity = roundQuantity(layer.Quantity + quantity)
+			layer.QuantityRemaining = roundQuantity(layer.QuantityRemaining + quantity)
+			result := trans.Save(&layer)
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				trans.Rollback()
+				return false
+			}
+		} else {
+			layer = CostLayer{
+				ProductId:         m.ProductId,
+				WarehouseId:       m.WarehouseId,
+				DateCreated:       m.DateCreated,
+				Quantity:          quantity,
+				QuantityRemaining: quantity,
+				UnitCost:          unitCost,
+				EnterpriseId:      m.EnterpriseId,
+			}
+			result := trans.Create(&layer)
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				trans.Rollback()
+				return false
+			}
+		}
+		if !addWarehouseMovementCostLayer(m, layer.Id, quantity, unitCost, trans) {
+			return false
+		}
+	} else if quantity < 0 {
+		consumption, quantityNotCovered := consumeCostLayers(layers, -quantity)
+		m.CostAmount = 0
+		for i := 0; i < len(consumption); i++ {
+			c := consumption[i]
+			for j := 0; j < len(layers); j++ {
+				if layers[j].Id == c.CostLayerId {
+					layers[j].QuantityRemaining = roundQuantity(layers[j].QuantityRemaining - c.Quantity)
+					result := trans.Model(&CostLayer{}).Where("id = ? AND enterprise = ?", c.CostLayerId, m.EnterpriseId).Update("quantity_remaining", layers[j].QuantityRemaining)
+					if result.Error != nil {
+						log("DB", result.Error.Error())
+						trans.Rollback()
+						return false
+					}
+					break
+				}
+			}
+			if !addWarehouseMovementCostLayer(m, c.CostLayerId, -c.Quantity, c.UnitCost, trans) {
+				return false
+			}
+			m.CostAmount -= c.Quantity * c.UnitCost
+		}
+		// the units that are not in the layers leave at the last known cost
+		if quantityNotCovered > 0 {
+			m.CostAmount -= quantityNotCovered * getCurrentUnitCost(m.ProductId, m.WarehouseId, m.EnterpriseId, trans)
+		}
+	} else {
+		m.CostAmount = 0
+	}
+
+	result := trans.Model(&WarehouseMovement{}).Where("id = ? AND enterprise = ?", m.Id, m.EnterpriseId).Update("cost_amount", m.CostAmount)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func addWarehouseMovementCostLayer(m *WarehouseMovement, costLayerId int64, quantity float64, unitCost float64, trans gorm.DB) bool {
+	result := trans.Create(&WarehouseMovementCostLayer{
+		WarehouseMovementId: m.Id,
+		CostLayerId:         costLayerId,
+		Quantity:            quantity,
+		UnitCost:            unitCost,
+		EnterpriseId:        m.EnterpriseId,
+	})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
+// Undoes the changes of a warehouse movement in the cost layers: the units taken go back to the layers, and the units added are taken out of the layers with their cost.
+// The layers that are left without stock and without movements are deleted.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func deallocateWarehouseMovementCostLayers(m *WarehouseMovement, trans gorm.DB) bool {
+	var movementLayers []WarehouseMovementCostLayer
+	result := trans.Model(&WarehouseMovementCostLayer{}).Where("warehouse_movement = ? AND enterprise = ?", m.Id, m.EnterpriseId).Find(&movementLayers)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	for i := 0; i < len(movementLayers); i++ {
+		var layer CostLayer
+		result = trans.Model(&CostLayer{}).Where("id = ? AND enterprise = ?", movementLayers[i].CostLayerId, m.EnterpriseId).First(&layer)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+
+		layer.UnitCost = weightedAverageCost(layer.QuantityRemaining, layer.UnitCost, -movementLayers[i].Quantity, movementLayers[i].UnitCost)
+		layer.QuantityRemaining = roundQuantity(layer.QuantityRemaining - movementLayers[i].Quantity)
+		if layer.QuantityRemaining < 0 {
+			layer.QuantityRemaining = 0
+		}
+		if movementLayers[i].Quantity > 0 {
+			layer.Quantity = roundQuantity(layer.Quantity - movementLayers[i].Quantity)
+		}
+
+		result = trans.Save(&layer)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+	}
+
+	result = trans.Where("warehouse_movement = ? AND enterprise = ?", m.Id, m.EnterpriseId).Delete(&WarehouseMovementCostLayer{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("product = ? AND warehouse = ? AND enterprise = ? AND quantity_remaining = 0 AND NOT EXISTS (SELECT 1 FROM warehouse_movement_cost_layer WHERE warehouse_movement_cost_layer.cost_layer = cost_layer.id AND warehouse_movement_cost_layer.enterprise = cost_layer.enterprise)", m.ProductId, m.WarehouseId, m.EnterpriseId).Delete(&CostLayer{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
+// Adds an amount (or removes it, if it's negative) to the cost of the units that an inbound warehouse movement has added to the cost layers,
+// used when the landed costs of a purchase are distributed after the goods have been received.
+// Only the share of the amount of the units that are still in stock is added to the layer. The units that have already left the warehouse
+// keep the cost they left with, and their share of the amount is not added to the cost of the goods sold.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func addWarehouseMovementCostAmount(movementId int64, enterpriseId int32, amount float64, trans gorm.DB) bool {
+	if amount == 0 {
+		return true
+	}
+
+	var movementLayers []WarehouseMovementCostLayer
+	result := trans.Model(&WarehouseMovementCostLayer{}).Where("warehouse_movement = ? AND enterprise = ? AND quantity > 0", movementId, enterpriseId).Find(&movementLayers)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	if len(movementLayers) == 0 {
+		return true
+	}
+	movementLayer := movementLayers[0]
+
+	var layer CostLayer
+	result = trans.Model(&CostLayer{}).Where("id = ? AND enterprise = ?", movementLayer.CostLayerId, enterpriseId).First(&layer)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	if layer.QuantityRemaining > 0 && layer.Quantity > 0 {
+		// FIFO: each unit in stock gets the amount per unit of the movement.
+		// Weighted average: the units of the movement that are in stock are in the same proportion as all the units of the layer.
+		share := layer.QuantityRemaining / layer.Quantity
+		if share > 1 {
+			share = 1
+		}
+		layer.UnitCost += (amount * share) / layer.QuantityRemaining
+		if layer.UnitCost < 0 {
+			layer.UnitCost = 0
+		}
+		result = trans.Model(&CostLayer{}).Where("id = ? AND enterprise = ?", layer.Id, enterpriseId).Update("unit_cost", layer.UnitCost)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+	}
+
+	movementLayer.UnitCost += amount / movementLayer.Quantity
+	result = trans.Model(&WarehouseMovementCostLayer{}).Where("warehouse_movement = ? AND cost_layer = ? AND enterprise = ?", movementId, movementLayer.CostLayerId, enterpriseId).Update("unit_cost", movementLayer.UnitCost)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Model(&WarehouseMovement{}).Where("id = ? AND enterprise = ?", movementId, enterpriseId).Update("cost_amount", gorm.Expr("cost_amount + ?", amount))
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
+// Deletes and rebuilds the cost layers of all the products with the current costing method, going through all the warehouse movements in order.
+// Used to start costing the stock of an existing database, or after changing the costing method.
+// The purchases enter at their price (including the landed costs), the rest of the inputs enter at the current cost of the warehouse.
+func regenerateCostLayers(enterpriseId int32) bool {
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return false
+	}
+	///
+
+	result := trans.Where("enterprise = ?", enterpriseId).Delete(&WarehouseMovementCostLayer{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	result = trans.Where("enterprise = ?", enterpriseId).Delete(&CostLayer{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	result = trans.Model(&WarehouseMovement{}).Where("enterprise = ?", enterpriseId).Update("cost_amount", 0)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	result = trans.Model(&SalesDeliveryNote{}).Where("enterprise = ?", enterpriseId).Update("cost_of_goods_sold", 0)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	rows, err := dbOrm.Model(&WarehouseMovement{}).Where("enterprise = ?", enterpriseId).Order("date_created ASC, id ASC").Rows()
+	if err != nil {
+		log("DB", err.Error())
+		trans.Rollback()
+		return false
+	}
+	defer rows.Close()
+
+	// for each warehouse movement...
+	for rows.Next() {
+		var m WarehouseMovement
+		dbOrm.ScanRows(rows, &m)
+		m.CostAmount = 0
+
+		if !allocateWarehouseMovementCostLayers(&m, *trans) {
+			return false
+		}
+		if m.SalesDeliveryNoteId != nil && !addCostOfGoodsSoldSalesDeliveryNote(*m.SalesDeliveryNoteId, -m.CostAmount, enterpriseId, *trans) {
+			return false
+		}
+	}
+
+	///
+	result = trans.Commit()
+	return result.Error == nil
+	///
+}
@@ -52,6 +52,19 @@ type Customer struct {
 	Account               *Account       `json:"account" gorm:"foreignKey:AccountId,EnterpriseId;references:Id,EnterpriseId"`
 	WooCommerceId         int32          `json:"-" gorm:"column:wc_id;not null:true;index:customer_wc_id,unique:true,priority:2,where:wc_id <> 0"`
 	ShopifyId             int64          `json:"-" gorm:"column:sy_id;not null:true;index:customer_sy_id,unique:true,priority:2,where:sy_id <> 0"`
+	CustomerGroupId       *int32         `json:"customerGroupId" gorm:"column:customer_group"`
+	CustomerGroup         *CustomerGroup `json:"customerGroup" gorm:"foreignKey:CustomerGroupId,EnterpriseId;references:Id,EnterpriseId"`
+	PriceListId           *int32         `json:"priceListId" gorm:"column:price_list"`
+	PriceList             *PriceList     `json:"priceList" gorm:"foreignKey:PriceListId,EnterpriseId;references:Id,EnterpriseId"`
+	CreditLimit           float64        `json:"creditLimit" gorm:"type:numeric(14,6);not null:true;default:0"` // 0 = No limit
+	BlockOnOverdue        bool           `json:"blockOnOverdue" gorm:"not null:true;default:false"`
+	CreditRiskAction      string         `json:"creditRiskAction" gorm:"type:character(1);not null:true;default:'R'"` // R = Reject the new orders, H = Put the new orders on hold
+	SalesAgentId          *int32         `json:"salesAgentId" gorm:"column:sales_agent"`
+	SalesAgent            *SalesAgent    `json:"salesAgent" gorm:"foreignKey:SalesAgentId,EnterpriseId;references:Id,EnterpriseId"`
+	Dir3AccountingOffice  string         `json:"dir3AccountingOffice" gorm:"type:character varying(10);not null:true;default:''"` // DIR3 codes of the public administration customers, required by FACe in the Facturae invoices
+	Dir3ManagementBody    string         `json:"dir3ManagementBody" gorm:"type:character varying(10);not null:true;default:''"`
+	Dir3ProcessingUnit    string         `json:"dir3ProcessingUnit" gorm:"type:character varying(10);not null:true;default:''"`
+	Gln                   string         `json:"gln" gorm:"type:character varying(13);not null:true;default:'';index:customer_gln,where:gln <> ''"` // Global Location Number, identifies the customer in the EDI messages
 	EnterpriseId          int32          `json:"-" gorm:"column:enterprise;not null:true;index:customer_id_enterprise,unique:true,priority:2;index:customer_ps_id,unique:true,priority:1,where:ps_id <> 0;index:customer_wc_id,unique:true,priority:1,where:wc_id <> 0;index:customer_sy_id,unique:true,priority:1,where:sy_id <> 0"`
 	Enterprise            Settings       `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 }
@@ -119,7 +132,7 @@ func getCustomerEnterpriseRow(customerId int32, enterpriseId int32) Customer {
 }
 
 func (c *Customer) isValid() bool {
-	return !(len(c.Name) == 0 || len(c.Name) > 303 || len(c.Tradename) == 0 || len(c.Tradename) > 150 || len(c.FiscalName) == 0 || len(c.FiscalName) > 150 || len(c.TaxId) > 25 || len(c.VatNumber) > 25 || len(c.Phone) > 25 || len(c.Email) > 100 || (len(c.Email) > 0 && !emailIsValid(c.Email)) || (len(c.Phone) > 0 && !phoneIsValid(c.Phone)))
+	return !(len(c.Name) == 0 || len(c.Name) > 303 || len(c.Tradename) == 0 || len(c.Tradename) > 150 || len(c.FiscalName) == 0 || len(c.FiscalName) > 150 || len(c.TaxId) > 25 || len(c.VatNumber) > 25 || len(c.Phone) > 25 || len(c.Email) > 100 || (len(c.Email) > 0 && !emailIsValid(c.Email)) || (len(c.Phone) > 0 && !phoneIsValid(c.Phone)) || c.CreditLimit < 0 || (c.CreditRiskAction != "R" && c.CreditRiskAction != "H") || len(c.Dir3AccountingOffice) > 10 || len(c.Dir3ManagementBody) > 10 || len(c.Dir3ProcessingUnit) > 10 || !glnIsValid(c.Gln))
 }
 
 // set the new customer id before create in gorm
@@ -133,6 +146,9 @@ func (c *Customer) BeforeCreate(tx *gorm.DB) (err error) {
 // 1 = Invalid
 // 2 = Database error
 func (c *Customer) insertCustomer(userId int32) OperationResult {
+	if c.CreditRiskAction == "" {
+		c.CreditRiskAction = "R"
+	}
 	if !c.isValid() {
 		return OperationResult{Code: 1}
 	}
@@ -165,6 +181,9 @@ func (c *Customer) insertCustomer(userId int32) OperationResult {
 }
 
 func (c *Customer) updateCustomer(userId int32) bool {
+	if c.CreditRiskAction == "" {
+		c.CreditRiskAction = "R"
+	}
 	if c.Id <= 0 || !c.isValid() {
 		return false
 	}
@@ -204,6 +223,16 @@ func (c *Customer) updateCustomer(userId int32) bool {
 	customer.PaymentMethodId = c.PaymentMethodId
 	customer.BillingSeriesId = c.BillingSeriesId
 	customer.AccountId = c.AccountId
+	customer.CustomerGroupId = c.CustomerGroupId
+	customer.PriceListId = c.PriceListId
+	customer.CreditLimit = c.CreditLimit
+	customer.BlockOnOverdue = c.BlockOnOverdue
+	customer.CreditRiskAction = c.CreditRiskAction
+	customer.SalesAgentId = c.SalesAgentId
+	customer.Dir3AccountingOffice = c.Dir3AccountingOffice
+	customer.Dir3ManagementBody = c.Dir3ManagementBody
+	customer.Dir3ProcessingUnit = c.Dir3ProcessingUnit
+	customer.Gln = c.Gln
 
 	// update the customer in the database
 	result = dbOrm.Save(&customer)
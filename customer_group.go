@@ -0,0 +1,110 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CustomerGroup struct {
+	Id           int32      `json:"id" gorm:"index:customer_group_id_enterprise,unique:true,priority:1"`
+	Name         string     `json:"name" gorm:"type:character varying(100);not null:true"`
+	PriceListId  *int32     `json:"priceListId" gorm:"column:price_list"`
+	PriceList    *PriceList `json:"priceList" gorm:"foreignKey:PriceListId,EnterpriseId;references:Id,EnterpriseId"`
+	EnterpriseId int32      `json:"-" gorm:"column:enterprise;not null:true;index:customer_group_id_enterprise,unique:true,priority:2"`
+	Enterprise   Settings   `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (g *CustomerGroup) TableName() string {
+	return "customer_group"
+}
+
+func getCustomerGroups(enterpriseId int32) []CustomerGroup {
+	var groups []CustomerGroup = make([]CustomerGroup, 0)
+	result := dbOrm.Model(&CustomerGroup{}).Where("enterprise = ?", enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&groups)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return groups
+}
+
+func getCustomerGroupRow(customerGroupId int32) CustomerGroup {
+	g := CustomerGroup{}
+	result := dbOrm.Model(&CustomerGroup{}).Where("id = ?", customerGroupId).First(&g)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return g
+}
+
+func (g *CustomerGroup) isValid() bool {
+	return !(len(g.Name) == 0 || len(g.Name) > 100)
+}
+
+func (g *CustomerGroup) BeforeCreate(tx *gorm.DB) (err error) {
+	var customerGroup CustomerGroup
+	tx.Model(&CustomerGroup{}).Last(&customerGroup)
+	g.Id = customerGroup.Id + 1
+	return nil
+}
+
+func (g *CustomerGroup) insertCustomerGroup() bool {
+	if !g.isValid() {
+		return false
+	}
+
+	result := dbOrm.Create(&g)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (g *CustomerGroup) updateCustomerGroup() bool {
+	if g.Id <= 0 || !g.isValid() {
+		return false
+	}
+
+	var customerGroup CustomerGroup
+	result := dbOrm.Where("id = ? AND enterprise = ?", g.Id, g.EnterpriseId).First(&customerGroup)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	customerGroup.Name = g.Name
+	customerGroup.PriceListId = g.PriceListId
+
+	result = dbOrm.Save(&customerGroup)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (g *CustomerGroup) deleteCustomerGroup() bool {
+	if g.Id <= 0 {
+		return false
+	}
+
+	result := dbOrm.Where("id = ? AND enterprise = ?", g.Id, g.EnterpriseId).Delete(&CustomerGroup{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
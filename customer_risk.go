@@ -0,0 +1,154 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The risk of a customer is the amount of money that the customer owes us, or will owe us when the pending orders are invoiced.
+type CustomerRisk struct {
+	CreditLimit                 float64 `json:"creditLimit"`
+	OpenOrders                  float64 `json:"openOrders"`                  // Amount of the sale order details that are not invoiced yet
+	UnpaidInvoices              float64 `json:"unpaidInvoices"`              // Amount of the invoices that are not posted in the accounting yet
+	PendingCollectionOperations float64 `json:"pendingCollectionOperations"` // Amount pending of collection in the customer's account
+	Exposure                    float64 `json:"exposure"`
+	Overdue                     float64 `json:"overdue"` // Amount of the collection operations pending of collection after the expiration date
+	BlockOnOverdue              bool    `json:"blockOnOverdue"`
+}
+
+func getCustomerRisk(customerId int32, enterpriseId int32) CustomerRisk {
+	risk := CustomerRisk{}
+	customer := getCustomerRow(customerId)
+	if customer.Id <= 0 || customer.EnterpriseId != enterpriseId {
+		return risk
+	}
+	risk.CreditLimit = customer.CreditLimit
+	risk.BlockOnOverdue = customer.BlockOnOverdue
+
+	sqlStatement := `SELECT COALESCE(SUM((sales_order_detail.quantity - sales_order_detail.quantity_invoiced) * sales_order_detail.price * (1 + (sales_order_detail.vat_percent / 100))), 0) FROM sales_order_detail INNER JOIN sales_order ON sales_order.id = sales_order_detail."order" WHERE sales_order.customer = $1 AND sales_order.enterprise = $2 AND NOT sales_order.cancelled AND NOT sales_order_detail.cancelled AND sales_order_detail.quantity_invoiced < sales_order_detail.quantity`
+	row := db.QueryRow(sqlStatement, customerId, enterpriseId)
+	if row.Err() != nil {
+		log("DB", row.Err().Error())
+		return risk
+	}
+	row.Scan(&risk.OpenOrders)
+
+	sqlStatement = `SELECT COALESCE(SUM(total_amount), 0) FROM sales_invoice WHERE customer = $1 AND enterprise = $2 AND accounting_movement IS NULL`
+	row = db.QueryRow(sqlStatement, customerId, enterpriseId)
+	if row.Err() != nil {
+		log("DB", row.Err().Error())
+		return risk
+	}
+	row.Scan(&risk.UnpaidInvoices)
+
+	// the invoices that are posted in the accounting generate collection operations in the customer's account
+	if customer.AccountId != nil {
+		sqlStatement = `SELECT COALESCE(SUM(pending), 0) FROM collection_operation WHERE account = $1 AND enterprise = $2 AND status <> 'C'`
+		row = db.QueryRow(sqlStatement, *customer.AccountId, enterpriseId)
+		if row.Err() != nil {
+			log("DB", row.Err().Error())
+			return risk
+		}
+		row.Scan(&risk.PendingCollectionOperations)
+
+		sqlStatement = `SELECT COALESCE(SUM(pending), 0) FROM collection_operation WHERE account = $1 AND enterprise = $2 AND status <> 'C' AND date_expiration < $3`
+		row = db.QueryRow(sqlStatement, *customer.AccountId, enterpriseId, time.Now())
+		if row.Err() != nil {
+			log("DB", row.Err().Error())
+			return risk
+		}
+		row.Scan(&risk.Overdue)
+	}
+
+	risk.Exposure = risk.OpenOrders + risk.UnpaidInvoices + risk.PendingCollectionOperations
+	return risk
+}
+
+// Checks if the customer can be sold an additional amount of money.
+// The extra data contains the exposure and the credit limit of the customer, or the overdue amount.
+//
+// ERROR CODES:
+// 1. The customer has exceeded the credit limit
+// 2. The customer has overdue payments
+func checkCustomerRisk(customerId int32, enterpriseId int32, amount float64) OkAndErrorCodeReturn {
+	risk := getCustomerRisk(customerId, enterpriseId)
+	if risk.BlockOnOverdue && risk.Overdue > 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2, ExtraData: []string{strconv.FormatFloat(risk.Overdue, 'f', 2, 64)}}
+	}
+	if risk.CreditLimit > 0 && (risk.Exposure+amount) > risk.CreditLimit {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1, ExtraData: []string{strconv.FormatFloat(risk.Exposure+amount, 'f', 2, 64), strconv.FormatFloat(risk.CreditLimit, 'f', 2, 64)}}
+	}
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+// Checks if adding an amount to a sale order exceeds the risk of the customer.
+// The check is skipped if the order is already on hold.
+// Returns the result of the risk check, and if the order must be put on hold instead of rejecting the change.
+func checkSalesOrderDetailCustomerRisk(saleOrder SaleOrder, amount float64) (OkAndErrorCodeReturn, bool) {
+	if saleOrder.CreditHold {
+		return OkAndErrorCodeReturn{Ok: true}, false
+	}
+	risk := checkCustomerRisk(saleOrder.CustomerId, saleOrder.EnterpriseId, amount)
+	if risk.Ok {
+		return risk, false
+	}
+	return risk, getCustomerRow(saleOrder.CustomerId).CreditRiskAction == "H"
+}
+
+// Prevents a sale order from being delivered or invoiced until the credit hold is released.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func putSalesOrderOnCreditHold(orderId int64, enterpriseId int32, trans gorm.DB) bool {
+	result := trans.Model(&SaleOrder{}).Where("id = ? AND enterprise = ?", orderId, enterpriseId).Update("credit_hold", true)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
+// Returns a text to add to the error messages that are not shown in the client, like the e-commerce import errors.
+func getCustomerRiskErrorMessage(okAndErr OkAndErrorCodeReturn) string {
+	switch okAndErr.ErrorCode {
+	case 1:
+		return ". The customer has exceeded the credit limit. Exposure " + okAndErr.ExtraData[0] + " limit " + okAndErr.ExtraData[1]
+	case 2:
+		return ". The customer has overdue payments. Overdue " + okAndErr.ExtraData[0]
+	default:
+		return ""
+	}
+}
+
+// Allows a sale order that was put on hold because of the customer's risk to be delivered and invoiced.
+func releaseCreditHoldSalesOrder(orderId int64, enterpriseId int32, userId int32) bool {
+	saleOrder := getSalesOrderRow(orderId)
+	if saleOrder.Id <= 0 || saleOrder.EnterpriseId != enterpriseId || !saleOrder.CreditHold {
+		return false
+	}
+
+	result := dbOrm.Model(&SaleOrder{}).Where("id = ? AND enterprise = ?", orderId, enterpriseId).Update("credit_hold", false)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	saleOrder.CreditHold = false
+
+	insertTransactionalLog(enterpriseId, "sales_order", int(orderId), userId, "U")
+	json, _ := json.Marshal(saleOrder)
+	go fireWebHook(enterpriseId, "sales_order", "PUT", string(json))
+
+	return true
+}
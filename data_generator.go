@@ -221,9 +221,9 @@ func generateSaleOrders(enterpriseId int32) {
 			o.BillingAddressId = addresses[rand.Intn(len(addresses))].Id
 			o.ShippingAddressId = addresses[rand.Intn(len(addresses))].Id
 			o.EnterpriseId = 1
-			ok, id := o.insertSalesOrder(1)
+			okAndErr, id := o.insertSalesOrder(1, nil)
 
-			if !ok {
+			if !okAndErr.Ok {
 				continue
 			}
 
@@ -235,10 +235,10 @@ func generateSaleOrders(enterpriseId int32) {
 				d.OrderId = id
 				d.ProductId = product.Id
 				d.Price = product.Price
-				d.Quantity = int32(rand.Intn(10) + 1)
+				d.Quantity = float64(rand.Intn(10) + 1)
 				d.VatPercent = product.VatPercent
 				d.EnterpriseId = 1
-				d.insertSalesOrderDetail(0)
+				d.insertSalesOrderDetail(0, nil)
 			}
 		}
 	}
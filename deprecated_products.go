@@ -489,13 +489,13 @@ type DeprecatedProductInUse struct {
 	PurchaseOrders                     []DeprecatedProductInUseOrders `json:"purchaseOrder"`
 	ManufacturingOrdersQuantity        int64                          `json:"manufacturingOrdersQuantity"`
 	ComplexManufacturingOrdersQuantity int64                          `json:"complexManufacturingOrdersQuantity"`
-	UnitsInStock                       int32                          `json:"unitsInStock"`
+	UnitsInStock                       float64                        `json:"unitsInStock"`
 	NoUses                             bool                           `json:"noUses"`
 }
 
 type DeprecatedProductInUseOrders struct {
-	OrderName string `json:"orderName"`
-	Quantity  int32  `json:"quantity"`
+	OrderName string  `json:"orderName"`
+	Quantity  float64 `json:"quantity"`
 }
 
 func (d *DeprecatedProductInUse) deprecatedProductHasNoUses() bool {
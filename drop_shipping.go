@@ -0,0 +1,364 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The details of a sales delivery note that were shipped by the supplier directly to the customer.
+// These details replace the warehouse movements of the delivery note, as the goods don't go through our warehouses.
+type DropShippingDeliveryNoteDetail struct {
+	Id                    int64               `json:"id" gorm:"index:drop_shipping_delivery_note_detail_id_enterprise,unique:true,priority:1"`
+	DeliveryNoteId        int64               `json:"deliveryNoteId" gorm:"column:sales_delivery_note;not null:true;index:drop_shipping_delivery_note_detail_sales_delivery_note"`
+	DeliveryNote          SalesDeliveryNote   `json:"-" gorm:"foreignKey:DeliveryNoteId,EnterpriseId;references:Id,EnterpriseId"`
+	SalesOrderId          int64               `json:"salesOrderId" gorm:"column:sales_order;not null:true"`
+	SalesOrder            SaleOrder           `json:"-" gorm:"foreignKey:SalesOrderId,EnterpriseId;references:Id,EnterpriseId"`
+	SalesOrderDetailId    int64               `json:"salesOrderDetailId" gorm:"column:sales_order_detail;not null:true"`
+	SalesOrderDetail      SalesOrderDetail    `json:"-" gorm:"foreignKey:SalesOrderDetailId,EnterpriseId;references:Id,EnterpriseId"`
+	PurchaseOrderDetailId int64               `json:"purchaseOrderDetailId" gorm:"column:purchase_order_detail;not null:true"`
+	PurchaseOrderDetail   PurchaseOrderDetail `json:"-" gorm:"foreignKey:PurchaseOrderDetailId,EnterpriseId;references:Id,EnterpriseId"`
+	ProductId             int32               `json:"productId" gorm:"column:product;not null:true"`
+	Product               Product             `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	Quantity              float64             `json:"quantity" gorm:"type:numeric(14,6);not null:true"`
+	Price                 float64             `json:"price" gorm:"type:numeric(14,6);not null:true"`
+	VatPercent            float64             `json:"vatPercent" gorm:"type:numeric(14,6);not null:true"`
+	TotalAmount           float64             `json:"totalAmount" gorm:"type:numeric(14,6);not null:true"`
+	EnterpriseId          int32               `json:"-" gorm:"column:enterprise;not null:true;index:drop_shipping_delivery_note_detail_id_enterprise,unique:true,priority:2"`
+	Enterprise            Settings            `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (d *DropShippingDeliveryNoteDetail) TableName() string {
+	return "drop_shipping_delivery_note_detail"
+}
+
+func (d *DropShippingDeliveryNoteDetail) BeforeCreate(tx *gorm.DB) (err error) {
+	var dropShippingDeliveryNoteDetail DropShippingDeliveryNoteDetail
+	tx.Model(&DropShippingDeliveryNoteDetail{}).Last(&dropShippingDeliveryNoteDetail)
+	d.Id = dropShippingDeliveryNoteDetail.Id + 1
+	return nil
+}
+
+func getDropShippingDeliveryNoteDetails(noteId int64, enterpriseId int32) []DropShippingDeliveryNoteDetail {
+	var details []DropShippingDeliveryNoteDetail = make([]DropShippingDeliveryNoteDetail, 0)
+	result := dbOrm.Model(&DropShippingDeliveryNoteDetail{}).Where("sales_delivery_note = ? AND enterprise = ?", noteId, enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&details)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return details
+}
+
+// Creates a purchase order for each supplier with the drop shipping details of the sale order that are waiting for a purchase order.
+// The purchase orders are shipped to the shipping address of the sale order, and the sale order details are associated to the new purchase order details.
+// Returns the IDs of the new purchase orders in the extra data.
+//
+// ERROR CODES:
+// 1. There are no drop shipping details waiting for a purchase order
+// 2. The product does not have a supplier: <product name>
+// 3. The supplier does not have a main billing address, a payment method or a billing series: <supplier name>
+// 4. Error creating the purchase order detail: <error code>, <product name>
+func generateDropShippingPurchaseOrders(saleOrderId int64, enterpriseId int32, userId int32) OkAndErrorCodeReturn {
+	saleOrder := getSalesOrderRow(saleOrderId)
+	if saleOrder.Id <= 0 || saleOrder.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	details := getSalesOrderDetail(saleOrderId, enterpriseId)
+	details = filterSalesOrderDetails(details, func(sod SalesOrderDetail) bool { return sod.DropShipping && sod.Status == "A" })
+	if len(details) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	// group the details by the supplier of the product, keeping the order of the details
+	var supplierIds []int32 = make([]int32, 0)
+	var supplierDetails map[int32][]SalesOrderDetail = make(map[int32][]SalesOrderDetail)
+	for i := 0; i < len(details); i++ {
+		if details[i].Product.SupplierId == nil || *details[i].Product.SupplierId <= 0 {
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2, ExtraData: []string{details[i].Product.Name}}
+		}
+		supplierId := *details[i].Product.SupplierId
+		if _, ok := supplierDetails[supplierId]; !ok {
+			supplierIds = append(supplierIds, supplierId)
+		}
+		supplierDetails[supplierId] = append(supplierDetails[supplierId], details[i])
+	}
+
+	// the supplier gets the address of the customer in the notes of the purchase order
+	shippingAddress := getAddressRow(saleOrder.ShippingAddressId)
+	notes := "Ship to: " + saleOrder.Customer.Name + ", " + shippingAddress.Address + " " + shippingAddress.Address2 + ", " + shippingAddress.ZipCode + " " + shippingAddress.City + " - " + shippingAddress.Country.Name
+	notes = truncateString(notes, 250)
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	var purchaseOrderIds []string = make([]string, 0)
+	for i := 0; i < len(supplierIds); i++ {
+		supplier := getSupplierRow(supplierIds[i])
+		if supplier.MainBillingAddressId == nil || supplier.PaymentMethodId == nil || supplier.BillingSeriesId == nil {
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3, ExtraData: []string{supplier.Name}}
+		}
+
+		o := PurchaseOrder{
+			SupplierId:        supplier.Id,
+			PaymentMethodId:   *supplier.PaymentMethodId,
+			BillingSeriesId:   *supplier.BillingSeriesId,
+			CurrencyId:        saleOrder.CurrencyId,
+			BillingAddressId:  *supplier.MainBillingAddressId,
+			ShippingAddressId: saleOrder.ShippingAddressId,
+			Notes:             notes,
+			DropShipping:      true,
+			SalesOrderId:      &saleOrder.Id,
+			EnterpriseId:      enterpriseId,
+		}
+		ok, purchaseOrderId := o.insertPurchaseOrder(userId, trans)
+		if !ok || purchaseOrderId <= 0 {
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		purchaseOrderIds = append(purchaseOrderIds, strconv.Itoa(int(purchaseOrderId)))
+
+		for j := 0; j < len(supplierDetails[supplier.Id]); j++ {
+			salesDetail := supplierDetails[supplier.Id][j]
+
+			d := PurchaseOrderDetail{
+				OrderId:      purchaseOrderId,
+				ProductId:    salesDetail.ProductId,
+				Price:        salesDetail.Product.PurchasePrice,
+				Quantity:     salesDetail.Quantity,
+				VatPercent:   salesDetail.Product.VatPercent,
+				WarehouseId:  salesDetail.WarehouseId,
+				EnterpriseId: enterpriseId,
+			}
+			okAndErr, purchaseDetailId := d.insertPurchaseOrderDetail(userId, trans)
+			if !okAndErr.Ok {
+				trans.Rollback()
+				return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4, ExtraData: []string{strconv.Itoa(int(okAndErr.ErrorCode)), salesDetail.Product.Name}}
+			}
+
+			// advance the status to "Purchase order pending"
+			result := trans.Model(&SalesOrderDetail{}).Where("id = ?", salesDetail.Id).Updates(map[string]interface{}{
+				"status":                "B",
+				"purchase_order_detail": purchaseDetailId,
+			})
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				trans.Rollback()
+				return OkAndErrorCodeReturn{Ok: false}
+			}
+			insertTransactionalLog(enterpriseId, "sales_order_detail", int(salesDetail.Id), userId, "U")
+
+			if !addQuantityAssignedSalePurchaseOrder(purchaseDetailId, salesDetail.Quantity, enterpriseId, userId, *trans) {
+				return OkAndErrorCodeReturn{Ok: false}
+			}
+		}
+	}
+
+	if !setSalesOrderState(enterpriseId, saleOrder.Id, userId, *trans) {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result := trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	return OkAndErrorCodeReturn{Ok: true, ExtraData: purchaseOrderIds}
+}
+
+// The supplier has shipped a drop shipping purchase order to the customer.
+// Closes the purchase order details and the sale order details, and creates the sales delivery note of the sale order without any warehouse movement.
+// Returns the ID of the new sales delivery note in the extra data.
+//
+// ERROR CODES:
+// 1. The purchase order is not a drop shipping purchase order
+// 2. The dispatch of the purchase order is already confirmed
+// 3. The sale order is on hold because of the customer's risk
+func confirmDropShippingPurchaseOrder(purchaseOrderId int64, enterpriseId int32, userId int32) OkAndErrorCodeReturn {
+	purchaseOrder := getPurchaseOrderRow(purchaseOrderId)
+	if purchaseOrder.Id <= 0 || purchaseOrder.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if !purchaseOrder.DropShipping || purchaseOrder.SalesOrderId == nil {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+	if purchaseOrder.DeliveryNoteLines >= purchaseOrder.LinesNumber {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+	saleOrder := getSalesOrderRow(*purchaseOrder.SalesOrderId)
+	if saleOrder.Id <= 0 {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if saleOrder.CreditHold {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+
+	purchaseDetails := getPurchaseOrderDetail(purchaseOrderId, enterpriseId)
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	n := SalesDeliveryNote{
+		CustomerId:        saleOrder.CustomerId,
+		ShippingAddressId: saleOrder.ShippingAddressId,
+		CurrencyId:        saleOrder.CurrencyId,
+		PaymentMethodId:   saleOrder.PaymentMethodId,
+		BillingSeriesId:   saleOrder.BillingSeriesId,
+		EnterpriseId:      enterpriseId,
+	}
+	ok, deliveryNoteId := n.insertSalesDeliveryNotes(userId, trans)
+	if !ok {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	for i := 0; i < len(purchaseDetails); i++ {
+		purchaseDetail := purchaseDetails[i]
+		if purchaseDetail.Cancelled || purchaseDetail.QuantityDeliveryNote >= purchaseDetail.Quantity {
+			continue
+		}
+
+		// close the purchase order detail, there is nothing to receive
+		result := trans.Model(&PurchaseOrderDetail{}).Where("id = ?", purchaseDetail.Id).Update("quantity_delivery_note", purchaseDetail.Quantity)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		insertTransactionalLog(enterpriseId, "purchase_order_detail", int(purchaseDetail.Id), userId, "U")
+		if !addPurchaseOrderDeliveryNoteLines(purchaseOrderId, enterpriseId, userId, *trans) {
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+
+		salesDetails := getSalesOrderDetailPurchaseOrderPending(purchaseDetail.Id)
+		for j := 0; j < len(salesDetails); j++ {
+			salesDetail := salesDetails[j]
+			quantity := roundQuantity(salesDetail.Quantity - salesDetail.QuantityDeliveryNote)
+
+			d := DropShippingDeliveryNoteDetail{
+				DeliveryNoteId:        deliveryNoteId,
+				SalesOrderId:          salesDetail.OrderId,
+				SalesOrderDetailId:    salesDetail.Id,
+				PurchaseOrderDetailId: purchaseDetail.Id,
+				ProductId:             salesDetail.ProductId,
+				Quantity:              quantity,
+				Price:                 salesDetail.Price,
+				VatPercent:            salesDetail.VatPercent,
+				TotalAmount:           (salesDetail.Price * quantity) * (1 + (salesDetail.VatPercent / 100)),
+				EnterpriseId:          enterpriseId,
+			}
+			result = trans.Create(&d)
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				trans.Rollback()
+				return OkAndErrorCodeReturn{Ok: false}
+			}
+
+			if !addQuantityDeliveryNoteSalesOrderDetail(salesDetail.Id, quantity, userId, *trans) {
+				trans.Rollback()
+				return OkAndErrorCodeReturn{Ok: false}
+			}
+			// the supplier has shipped the goods, there is nothing to prepare or pack
+			result = trans.Model(&SalesOrderDetail{}).Where("id = ?", salesDetail.Id).Updates(map[string]interface{}{
+				"status":                     "G",
+				"quantity_pending_packaging": 0,
+			})
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				trans.Rollback()
+				return OkAndErrorCodeReturn{Ok: false}
+			}
+			if !addTotalProductsSalesDeliveryNote(deliveryNoteId, salesDetail.Price*quantity, salesDetail.VatPercent, enterpriseId, userId, *trans) {
+				trans.Rollback()
+				return OkAndErrorCodeReturn{Ok: false}
+			}
+		}
+	}
+
+	if !setSalesOrderState(enterpriseId, saleOrder.Id, userId, *trans) {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result := trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	return OkAndErrorCodeReturn{Ok: true, ExtraData: []string{strconv.Itoa(int(deliveryNoteId))}}
+}
+
+// The sales delivery note with drop shipping details is being deleted. Reopens the sale order details and the purchase order details.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION
+func deleteDropShippingDeliveryNoteDetails(noteId int64, enterpriseId int32, userId int32, trans gorm.DB) bool {
+	details := getDropShippingDeliveryNoteDetails(noteId, enterpriseId)
+	for i := 0; i < len(details); i++ {
+		d := details[i]
+
+		if !addQuantityDeliveryNoteSalesOrderDetail(d.SalesOrderDetailId, -d.Quantity, userId, trans) {
+			trans.Rollback()
+			return false
+		}
+		// back to "Purchase order pending"
+		result := trans.Model(&SalesOrderDetail{}).Where("id = ?", d.SalesOrderDetailId).Updates(map[string]interface{}{
+			"status":                     "B",
+			"quantity_pending_packaging": roundQuantity(d.SalesOrderDetail.Quantity - d.SalesOrderDetail.QuantityDeliveryNote + d.Quantity),
+		})
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+
+		purchaseDetail := getPurchaseOrderDetailRowTransaction(d.PurchaseOrderDetailId, trans)
+		if purchaseDetail.QuantityDeliveryNote == purchaseDetail.Quantity {
+			if !removePurchaseOrderDeliveryNoteLines(purchaseDetail.OrderId, enterpriseId, userId, trans) {
+				return false
+			}
+		}
+		result = trans.Model(&PurchaseOrderDetail{}).Where("id = ?", d.PurchaseOrderDetailId).Update("quantity_delivery_note", roundQuantity(purchaseDetail.QuantityDeliveryNote-d.Quantity))
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+		insertTransactionalLog(enterpriseId, "purchase_order_detail", int(d.PurchaseOrderDetailId), userId, "U")
+
+		result = trans.Delete(&DropShippingDeliveryNoteDetail{}, "id = ?", d.Id)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+
+		if !setSalesOrderState(enterpriseId, d.SalesOrderId, userId, trans) {
+			trans.Rollback()
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,392 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A reminder that is sent to the customer when a collection operation is overdue by a number of days.
+// The subject and the body are the default email template, and can be translated to the language of the customer in DunningLevelTranslation.
+type DunningLevel struct {
+	Id           int32    `json:"id" gorm:"index:dunning_level_id_enterprise,unique:true,priority:1"`
+	Name         string   `json:"name" gorm:"type:character varying(50);not null:true"`
+	Days         int16    `json:"days" gorm:"not null:true;index:dunning_level_days_enterprise,unique:true,priority:2"` // Days after the expiration date
+	Subject      string   `json:"subject" gorm:"type:character varying(100);not null:true"`
+	Body         string   `json:"body" gorm:"type:text;not null:true"`
+	EnterpriseId int32    `json:"-" gorm:"column:enterprise;not null:true;index:dunning_level_id_enterprise,unique:true,priority:2;index:dunning_level_days_enterprise,unique:true,priority:1"`
+	Enterprise   Settings `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (l *DunningLevel) TableName() string {
+	return "dunning_level"
+}
+
+func getDunningLevels(enterpriseId int32) []DunningLevel {
+	var levels []DunningLevel = make([]DunningLevel, 0)
+	result := dbOrm.Model(&DunningLevel{}).Where("enterprise = ?", enterpriseId).Order("days ASC").Find(&levels)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return levels
+}
+
+func (l *DunningLevel) isValid() bool {
+	return !(len(l.Name) == 0 || len(l.Name) > 50 || l.Days < 0 || len(l.Subject) == 0 || len(l.Subject) > 100 || len(l.Body) == 0)
+}
+
+func (l *DunningLevel) BeforeCreate(tx *gorm.DB) (err error) {
+	var dunningLevel DunningLevel
+	tx.Model(&DunningLevel{}).Last(&dunningLevel)
+	l.Id = dunningLevel.Id + 1
+	return nil
+}
+
+func (l *DunningLevel) insertDunningLevel() bool {
+	if !l.isValid() {
+		return false
+	}
+
+	result := dbOrm.Create(&l)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (l *DunningLevel) updateDunningLevel() bool {
+	if l.Id <= 0 || !l.isValid() {
+		return false
+	}
+
+	var dunningLevel DunningLevel
+	result := dbOrm.Where("id = ? AND enterprise = ?", l.Id, l.EnterpriseId).First(&dunningLevel)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	dunningLevel.Name = l.Name
+	dunningLevel.Days = l.Days
+	dunningLevel.Subject = l.Subject
+	dunningLevel.Body = l.Body
+
+	result = dbOrm.Save(&dunningLevel)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+// The levels that were already sent to a customer can't be deleted, to keep the dunning history.
+func (l *DunningLevel) deleteDunningLevel() bool {
+	if l.Id <= 0 {
+		return false
+	}
+
+	///
+	trans := dbOrm.Begin()
+	///
+
+	result := trans.Where("dunning_level = ? AND enterprise = ?", l.Id, l.EnterpriseId).Delete(&DunningLevelTranslation{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("id = ? AND enterprise = ?", l.Id, l.EnterpriseId).Delete(&DunningLevel{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	///
+	result = trans.Commit()
+	return result.Error == nil
+	///
+}
+
+// The email template of a dunning level in the language of the customer.
+type DunningLevelTranslation struct {
+	EnterpriseId   int32        `json:"-" gorm:"primaryKey;column:enterprise;not null:true"`
+	Enterprise     Settings     `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+	DunningLevelId int32        `json:"dunningLevelId" gorm:"primaryKey;column:dunning_level;not null:true"`
+	DunningLevel   DunningLevel `json:"-" gorm:"foreignKey:DunningLevelId,EnterpriseId;references:Id,EnterpriseId"`
+	LanguageId     int32        `json:"languageId" gorm:"primaryKey;column:language;not null:true"`
+	Language       Language     `json:"language" gorm:"foreignKey:LanguageId,EnterpriseId;references:Id,EnterpriseId"`
+	Subject        string       `json:"subject" gorm:"type:character varying(100);not null:true"`
+	Body           string       `json:"body" gorm:"type:text;not null:true"`
+}
+
+func (t *DunningLevelTranslation) TableName() string {
+	return "dunning_level_translation"
+}
+
+func getDunningLevelTranslations(dunningLevelId int32, enterpriseId int32) []DunningLevelTranslation {
+	var translations []DunningLevelTranslation = make([]DunningLevelTranslation, 0)
+	result := dbOrm.Where("dunning_level = ? AND enterprise = ?", dunningLevelId, enterpriseId).Order("language ASC").Preload("Language").Find(&translations)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return translations
+}
+
+func (t *DunningLevelTranslation) isValid() bool {
+	return !(t.EnterpriseId <= 0 || t.DunningLevelId <= 0 || t.LanguageId <= 0 || len(t.Subject) == 0 || len(t.Subject) > 100 || len(t.Body) == 0)
+}
+
+func (t *DunningLevelTranslation) insertDunningLevelTranslation() bool {
+	if !t.isValid() {
+		return false
+	}
+
+	result := dbOrm.Create(&t)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+func (t *DunningLevelTranslation) updateDunningLevelTranslation() bool {
+	if !t.isValid() {
+		return false
+	}
+
+	result := dbOrm.Model(&DunningLevelTranslation{}).Where("enterprise = ? AND dunning_level = ? AND language = ?", t.EnterpriseId, t.DunningLevelId, t.LanguageId).Updates(map[string]interface{}{
+		"subject": t.Subject,
+		"body":    t.Body,
+	})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+func (t *DunningLevelTranslation) deleteDunningLevelTranslation() bool {
+	if t.EnterpriseId <= 0 || t.DunningLevelId <= 0 || t.LanguageId <= 0 {
+		return false
+	}
+
+	result := dbOrm.Where("enterprise = ? AND dunning_level = ? AND language = ?", t.EnterpriseId, t.DunningLevelId, t.LanguageId).Delete(&DunningLevelTranslation{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+// Returns the subject and the body of the email in the language of the customer, or the default template if there is no translation.
+func (l *DunningLevel) getTemplate(languageId *int32) (string, string) {
+	if languageId != nil {
+		var translation DunningLevelTranslation
+		result := dbOrm.Where("enterprise = ? AND dunning_level = ? AND language = ?", l.EnterpriseId, l.Id, *languageId).Limit(1).Find(&translation)
+		if result.Error == nil && result.RowsAffected > 0 {
+			return translation.Subject, translation.Body
+		}
+	}
+	return l.Subject, l.Body
+}
+
+// Replaces the variables of the email template with the data of the collection operation.
+func replaceDunningTemplate(template string, co *CollectionOperation, customerName string, daysOverdue int, enterpriseName string) string {
+	template = strings.Replace(template, "$$customer_name$$", customerName, -1)
+	template = strings.Replace(template, "$$document_name$$", strings.TrimSpace(co.DocumentName), -1)
+	template = strings.Replace(template, "$$date_created$$", co.DateCreated.Format("2006-01-02"), -1)
+	template = strings.Replace(template, "$$date_expiration$$", co.DateExpiration.Format("2006-01-02"), -1)
+	template = strings.Replace(template, "$$days_overdue$$", strconv.Itoa(daysOverdue), -1)
+	template = strings.Replace(template, "$$total$$", fmt.Sprintf("%.2f", co.Total), -1)
+	template = strings.Replace(template, "$$paid$$", fmt.Sprintf("%.2f", co.Paid), -1)
+	template = strings.Replace(template, "$$pending$$", fmt.Sprintf("%.2f", co.Pending), -1)
+	template = strings.Replace(template, "$$enterprise_name$$", enterpriseName, -1)
+	return template
+}
+
+// A reminder sent to the customer for an overdue collection operation. Each level is sent only once for every collection operation.
+type DunningHistory struct {
+	Id                    int64               `json:"id" gorm:"index:dunning_history_id_enterprise,unique:true,priority:1"`
+	CollectionOperationId int32               `json:"collectionOperationId" gorm:"column:collection_operation;not null:true;index:dunning_history_collection_operation_level,unique:true,priority:2"`
+	CollectionOperation   CollectionOperation `json:"-" gorm:"foreignKey:CollectionOperationId,EnterpriseId;references:Id,EnterpriseId"`
+	DunningLevelId        int32               `json:"dunningLevelId" gorm:"column:dunning_level;not null:true;index:dunning_history_collection_operation_level,unique:true,priority:3"`
+	DunningLevel          DunningLevel        `json:"dunningLevel" gorm:"foreignKey:DunningLevelId,EnterpriseId;references:Id,EnterpriseId"`
+	DateSent              time.Time           `json:"dateSent" gorm:"type:timestamp(3) with time zone;not null:true"`
+	DaysOverdue           int16               `json:"daysOverdue" gorm:"not null:true"`
+	Pending               float64             `json:"pending" gorm:"type:numeric(14,6);not null:true"` // Amount pending when the reminder was sent
+	Email                 string              `json:"email" gorm:"type:character varying(150);not null:true"`
+	EmailLogId            *int64              `json:"emailLogId" gorm:"column:email_log"`
+	EmailLog              *EmailLog           `json:"-" gorm:"foreignKey:EmailLogId;references:Id"`
+	Ok                    bool                `json:"ok" gorm:"not null:true"`
+	ErrorMessage          string              `json:"errorMessage" gorm:"type:character varying(250);not null:true"`
+	EnterpriseId          int32               `json:"-" gorm:"column:enterprise;not null:true;index:dunning_history_id_enterprise,unique:true,priority:2;index:dunning_history_collection_operation_level,unique:true,priority:1"`
+	Enterprise            Settings            `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (h *DunningHistory) TableName() string {
+	return "dunning_history"
+}
+
+func (h *DunningHistory) BeforeCreate(tx *gorm.DB) (err error) {
+	var dunningHistory DunningHistory
+	tx.Model(&DunningHistory{}).Last(&dunningHistory)
+	h.Id = dunningHistory.Id + 1
+	return nil
+}
+
+func getDunningHistory(collectionOperationId int32, enterpriseId int32) []DunningHistory {
+	var history []DunningHistory = make([]DunningHistory, 0)
+	result := dbOrm.Model(&DunningHistory{}).Where("collection_operation = ? AND enterprise = ?", collectionOperationId, enterpriseId).Order("date_sent ASC").Preload(clause.Associations).Find(&history)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return history
+}
+
+func (h *DunningHistory) insertDunningHistory() bool {
+	h.DateSent = time.Now()
+	h.ErrorMessage = truncateString(h.ErrorMessage, 250)
+
+	result := dbOrm.Create(&h)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+// Records the result of a new attempt to send a reminder that could not be sent before.
+func (h *DunningHistory) updateDunningHistory() bool {
+	if h.Id <= 0 {
+		return false
+	}
+	h.DateSent = time.Now()
+	h.ErrorMessage = truncateString(h.ErrorMessage, 250)
+
+	result := dbOrm.Model(&DunningHistory{}).Where("id = ? AND enterprise = ?", h.Id, h.EnterpriseId).Updates(map[string]interface{}{
+		"date_sent":     h.DateSent,
+		"days_overdue":  h.DaysOverdue,
+		"pending":       h.Pending,
+		"email":         h.Email,
+		"email_log":     h.EmailLogId,
+		"ok":            h.Ok,
+		"error_message": h.ErrorMessage,
+	})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+// Sends the reminders of the collection operations of the enterprise that are overdue and not paid yet. Called by the cron.
+// Only the highest level reached by every collection operation is sent, and only if neither that level nor a higher one has been sent before,
+// so a collection operation that is overdue for a long time doesn't receive all the levels at once.
+// The reminders that could not be sent are tried again in the next run, updating the same row of the history.
+// The collection operations that are paid are not selected, so the reminders stop once the customer pays.
+func runDunning(enterpriseId int32) []DunningHistory {
+	sent := make([]DunningHistory, 0)
+	levels := getDunningLevels(enterpriseId)
+	if len(levels) == 0 {
+		return sent
+	}
+	s := getSettingsRecordById(enterpriseId)
+
+	now := time.Now()
+	var collectionOperations []CollectionOperation = make([]CollectionOperation, 0)
+	result := dbOrm.Model(&CollectionOperation{}).Where("enterprise = ? AND status <> 'C' AND pending > 0 AND date_expiration <= ?", enterpriseId, now.AddDate(0, 0, -int(levels[0].Days))).Order("date_expiration ASC, id ASC").Find(&collectionOperations)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return sent
+	}
+
+	for i := 0; i < len(collectionOperations); i++ {
+		co := collectionOperations[i]
+		daysOverdue := int(now.Sub(co.DateExpiration).Hours() / 24)
+
+		var level *DunningLevel
+		for j := len(levels) - 1; j >= 0; j-- {
+			if int(levels[j].Days) <= daysOverdue {
+				level = &levels[j]
+				break
+			}
+		}
+		if level == nil {
+			continue
+		}
+
+		var alreadySent int64
+		result = dbOrm.Model(&DunningHistory{}).Joins("INNER JOIN dunning_level ON dunning_level.id = dunning_history.dunning_level AND dunning_level.enterprise = dunning_history.enterprise").Where("dunning_history.collection_operation = ? AND dunning_history.enterprise = ? AND dunning_level.days >= ? AND dunning_history.ok = true", co.Id, enterpriseId, level.Days).Count(&alreadySent)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			continue
+		}
+		if alreadySent > 0 {
+			continue
+		}
+
+		// a previous attempt of this level that failed
+		var previousAttempt DunningHistory
+		result = dbOrm.Model(&DunningHistory{}).Where("collection_operation = ? AND dunning_level = ? AND enterprise = ?", co.Id, level.Id, enterpriseId).Limit(1).Find(&previousAttempt)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			continue
+		}
+
+		h := DunningHistory{
+			CollectionOperationId: co.Id,
+			DunningLevelId:        level.Id,
+			DaysOverdue:           int16(daysOverdue),
+			Pending:               co.Pending,
+			EnterpriseId:          enterpriseId,
+		}
+
+		var customer Customer
+		result = dbOrm.Model(&Customer{}).Where("account = ? AND enterprise = ?", co.AccountId, enterpriseId).Limit(1).Find(&customer)
+		if result.Error != nil || result.RowsAffected == 0 {
+			h.ErrorMessage = "There is no customer for the account of the collection operation"
+		} else if len(customer.Email) == 0 {
+			h.ErrorMessage = "The customer has no email address"
+		} else {
+			h.Email = customer.Email
+			subject, body := level.getTemplate(customer.LanguageId)
+			subject = replaceDunningTemplate(subject, &co, customer.Name, daysOverdue, s.EnterpriseName)
+			body = replaceDunningTemplate(body, &co, customer.Name, daysOverdue, s.EnterpriseName)
+			subject = truncateString(subject, 100)
+			h.Ok, h.EmailLogId = sendEmailWithEmailLog(customer.Email, customer.Name, subject, body, nil, enterpriseId)
+			if !h.Ok {
+				h.ErrorMessage = "The email could not be sent"
+			}
+		}
+
+		if previousAttempt.Id > 0 {
+			h.Id = previousAttempt.Id
+			if h.updateDunningHistory() {
+				sent = append(sent, h)
+			}
+		} else if h.insertDunningHistory() {
+			sent = append(sent, h)
+		}
+	}
+
+	return sent
+}
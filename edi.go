@@ -0,0 +1,924 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The EDIFACT messages are exchanged with the customers as files in the inbound and outbound directories of the settings.
+// Inbound: ORDERS D.96A are imported as sales orders.
+// Outbound: DESADV (despatch advice) from the shippings and INVOIC (invoice) from the sales invoices.
+
+const EDIFACT_SERVICE_STRING_ADVICE = "UNA:+.? '"
+
+const (
+	EDI_MESSAGE_ORDERS = "ORDERS"
+	EDI_MESSAGE_DESADV = "DESADV"
+	EDI_MESSAGE_INVOIC = "INVOIC"
+)
+
+// Log of every EDI message received or sent, with the result of the processing.
+type EdiMessage struct {
+	Id                   int64     `json:"id" gorm:"index:edi_message_id_enterprise,unique:true,priority:1"`
+	DateCreated          time.Time `json:"dateCreated" gorm:"type:timestamp(3) with time zone;not null:true;index:edi_message_date_created,sort:desc"`
+	Direction            string    `json:"direction" gorm:"type:character(1);not null:true"` // I = Inbound, O = Outbound
+	MessageType          string    `json:"messageType" gorm:"type:character varying(6);not null:true"`
+	FileName             string    `json:"fileName" gorm:"type:character varying(255);not null:true"`
+	InterchangeReference string    `json:"interchangeReference" gorm:"type:character varying(14);not null:true"`
+	DocumentNumber       string    `json:"documentNumber" gorm:"type:character varying(35);not null:true"` // Number of the document in the BGM segment
+	Status               string    `json:"status" gorm:"type:character(1);not null:true"`                  // P = Processed, E = Error
+	ErrorMessage         string    `json:"errorMessage" gorm:"type:text;not null:true"`
+	Content              string    `json:"content" gorm:"type:text;not null:true"`
+	CustomerId           *int32    `json:"customerId" gorm:"column:customer"`
+	Customer             *Customer `json:"customer" gorm:"foreignKey:CustomerId,EnterpriseId;references:Id,EnterpriseId"`
+	SalesOrderId         *int64    `json:"salesOrderId" gorm:"column:sales_order"` // The documents are not foreign keys, the log is kept when they are deleted
+	ShippingId           *int64    `json:"shippingId" gorm:"column:shipping"`
+	SalesInvoiceId       *int64    `json:"salesInvoiceId" gorm:"column:sales_invoice"`
+	EnterpriseId         int32     `json:"-" gorm:"column:enterprise;not null:true;index:edi_message_id_enterprise,unique:true,priority:2"`
+	Enterprise           Settings  `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (m *EdiMessage) TableName() string {
+	return "edi_message"
+}
+
+type EdiMessages struct {
+	Rows     int64        `json:"rows"`
+	Messages []EdiMessage `json:"messages"`
+}
+
+func (q *PaginationQuery) getEdiMessages() EdiMessages {
+	em := EdiMessages{}
+	if !q.isValid() {
+		return em
+	}
+
+	em.Messages = make([]EdiMessage, 0)
+	result := dbOrm.Model(&EdiMessage{}).Where("enterprise = ?", q.enterprise).Count(&em.Rows)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return em
+	}
+	result = dbOrm.Model(&EdiMessage{}).Where("enterprise = ?", q.enterprise).Order("id DESC").Offset(int(q.Offset)).Limit(int(q.Limit)).Preload(clause.Associations).Find(&em.Messages)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return em
+}
+
+func (m *EdiMessage) BeforeCreate(tx *gorm.DB) (err error) {
+	var ediMessage EdiMessage
+	tx.Model(&EdiMessage{}).Last(&ediMessage)
+	m.Id = ediMessage.Id + 1
+	return nil
+}
+
+func (m *EdiMessage) insertEdiMessage() bool {
+	m.DateCreated = time.Now()
+	if len(m.DocumentNumber) > 35 {
+		m.DocumentNumber = m.DocumentNumber[:35]
+	}
+	if len(m.InterchangeReference) > 14 {
+		m.InterchangeReference = m.InterchangeReference[:14]
+	}
+
+	result := dbOrm.Create(&m)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+func (m *EdiMessage) updateEdiMessage() bool {
+	result := dbOrm.Model(&EdiMessage{}).Where("id = ? AND enterprise = ?", m.Id, m.EnterpriseId).Updates(map[string]interface{}{
+		"file_name":             m.FileName,
+		"interchange_reference": m.InterchangeReference,
+		"document_number":       m.DocumentNumber,
+		"status":                m.Status,
+		"error_message":         m.ErrorMessage,
+		"content":               m.Content,
+	})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+// A GLN (Global Location Number) has 13 digits, with the same check digit as the EAN13 codes. Empty = not set.
+func glnIsValid(gln string) bool {
+	return len(gln) == 0 || checkEan13(gln)
+}
+
+/* EDIFACT SYNTAX */
+
+type EdifactSegment struct {
+	Tag      string
+	Elements [][]string // Data elements, each one with its components
+}
+
+// Returns the component of the data element, or an empty string if it's not in the segment. The indexes start at 0, without counting the tag.
+func (s *EdifactSegment) value(element int, component int) string {
+	if element >= len(s.Elements) || component >= len(s.Elements[element]) {
+		return ""
+	}
+	return s.Elements[element][component]
+}
+
+// Splits an EDIFACT interchange in segments, data elements and components.
+// The separators are read from the UNA segment if it's present, otherwise the default ones are used.
+func parseEdifact(content string) ([]EdifactSegment, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	content = strings.TrimLeft(content, " \r\n\t")
+
+	var componentSeparator byte = ':'
+	var elementSeparator byte = '+'
+	var releaseCharacter byte = '?'
+	var segmentTerminator byte = '\''
+	if strings.HasPrefix(content, "UNA") {
+		if len(content) < 9 {
+			return nil, errors.New("the UNA segment is not complete")
+		}
+		componentSeparator = content[3]
+		elementSeparator = content[4]
+		releaseCharacter = content[6]
+		segmentTerminator = content[8]
+		content = content[9:]
+	}
+
+	segments := make([]EdifactSegment, 0)
+	elements := make([][]string, 0)
+	components := make([]string, 0)
+	var current strings.Builder
+	var released bool = false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if released {
+			current.WriteByte(c)
+			released = false
+			continue
+		}
+		switch c {
+		case releaseCharacter:
+			released = true
+		case componentSeparator:
+			components = append(components, current.String())
+			current.Reset()
+		case elementSeparator:
+			components = append(components, current.String())
+			elements = append(elements, components)
+			components = make([]string, 0)
+			current.Reset()
+		case segmentTerminator:
+			components = append(components, current.String())
+			elements = append(elements, components)
+			tag := strings.TrimSpace(elements[0][0])
+			if len(tag) != 3 {
+				return nil, errors.New("invalid segment tag " + tag)
+			}
+			segments = append(segments, EdifactSegment{Tag: tag, Elements: elements[1:]})
+			elements = make([][]string, 0)
+			components = make([]string, 0)
+			current.Reset()
+		case '\r', '\n':
+			// line breaks between the segments are not part of the data
+			if current.Len() > 0 || len(components) > 0 || len(elements) > 0 {
+				current.WriteByte(c)
+			}
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if released {
+		return nil, errors.New("the interchange ends with a release character")
+	}
+	if len(strings.TrimSpace(current.String())) > 0 || len(components) > 0 || len(elements) > 0 {
+		return nil, errors.New("the last segment is not terminated")
+	}
+	if len(segments) == 0 {
+		return nil, errors.New("the interchange is empty")
+	}
+	return segments, nil
+}
+
+// Groups the segments of the interchange by message, from UNH to UNT.
+func splitEdifactMessages(segments []EdifactSegment) [][]EdifactSegment {
+	messages := make([][]EdifactSegment, 0)
+	var message []EdifactSegment = nil
+	for i := 0; i < len(segments); i++ {
+		switch segments[i].Tag {
+		case "UNH":
+			message = []EdifactSegment{segments[i]}
+		case "UNT":
+			if message != nil {
+				message = append(message, segments[i])
+				messages = append(messages, message)
+				message = nil
+			}
+		default:
+			if message != nil {
+				message = append(message, segments[i])
+			}
+		}
+	}
+	return messages
+}
+
+// Builds an EDIFACT interchange with the default separators.
+type EdifactWriter struct {
+	segments        []string
+	messageSegments int
+	messages        int
+}
+
+// Escapes the separators in a value with the release character.
+func edifactEscape(value string) string {
+	value = strings.ReplaceAll(value, "?", "??")
+	value = strings.ReplaceAll(value, "+", "?+")
+	value = strings.ReplaceAll(value, ":", "?:")
+	value = strings.ReplaceAll(value, "'", "?'")
+	return value
+}
+
+// Joins the components of a data element, removing the empty components at the end.
+func edifactElement(components ...string) string {
+	for len(components) > 0 && components[len(components)-1] == "" {
+		components = components[:len(components)-1]
+	}
+	for i := 0; i < len(components); i++ {
+		components[i] = edifactEscape(components[i])
+	}
+	return strings.Join(components, ":")
+}
+
+// Adds a segment, the elements must be built with edifactElement. The empty elements at the end are removed.
+func (w *EdifactWriter) add(tag string, elements ...string) {
+	for len(elements) > 0 && elements[len(elements)-1] == "" {
+		elements = elements[:len(elements)-1]
+	}
+	if len(elements) == 0 {
+		w.segments = append(w.segments, tag)
+	} else {
+		w.segments = append(w.segments, tag+"+"+strings.Join(elements, "+"))
+	}
+	w.messageSegments++
+}
+
+func newEdifactInterchange(senderGln string, recipientGln string, reference string, date time.Time) *EdifactWriter {
+	w := EdifactWriter{segments: make([]string, 0)}
+	w.add("UNB", edifactElement("UNOC", "3"), edifactElement(senderGln, "14"), edifactElement(recipientGln, "14"), edifactElement(date.Format("060102"), date.Format("1504")), edifactElement(reference))
+	return &w
+}
+
+// EANCOM subset of the D.96A directory. ORDERS = EAN008, DESADV = EAN005, INVOIC = EAN008.
+func (w *EdifactWriter) beginMessage(reference string, messageType string, associationCode string) {
+	w.messageSegments = 0
+	w.messages++
+	w.add("UNH", edifactElement(reference), edifactElement(messageType, "D", "96A", "UN", associationCode))
+}
+
+func (w *EdifactWriter) endMessage(reference string) {
+	w.add("UNT", strconv.Itoa(w.messageSegments+1), edifactElement(reference))
+}
+
+func (w *EdifactWriter) String(reference string) string {
+	return EDIFACT_SERVICE_STRING_ADVICE + strings.Join(w.segments, "'") + "'UNZ+" + strconv.Itoa(w.messages) + "+" + edifactEscape(reference) + "'"
+}
+
+func edifactDate(date time.Time) string {
+	return date.Format("20060102")
+}
+
+func parseEdifactDate(value string, format string) *time.Time {
+	var layout string
+	switch format {
+	case "102":
+		layout = "20060102"
+	case "203":
+		layout = "200601021504"
+	default:
+		return nil
+	}
+	date, err := time.Parse(layout, value)
+	if err != nil {
+		return nil
+	}
+	return &date
+}
+
+func edifactAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+func parseEdifactNumber(value string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+}
+
+/* INBOUND: ORDERS */
+
+type EdiOrder struct {
+	MessageReference string
+	DocumentNumber   string
+	DocumentDate     *time.Time
+	DeliveryDate     *time.Time
+	BuyerGln         string
+	DeliveryGln      string
+	InvoiceeGln      string
+	SupplierGln      string
+	Currency         string
+	Lines            []EdiOrderLine
+}
+
+type EdiOrderLine struct {
+	Ean      string
+	Quantity float64
+	Price    *float64
+}
+
+// Reads a purchase order of the customer from the segments of an ORDERS message.
+func parseEdiOrder(message []EdifactSegment) (EdiOrder, error) {
+	order := EdiOrder{Lines: make([]EdiOrderLine, 0)}
+	if len(message) == 0 || message[0].Tag != "UNH" {
+		return order, errors.New("the message doesn't start with UNH")
+	}
+	order.MessageReference = message[0].value(0, 0)
+	if message[0].value(1, 0) != EDI_MESSAGE_ORDERS || message[0].value(1, 1) != "D" || message[0].value(1, 2) != "96A" {
+		return order, errors.New("unsupported message " + message[0].value(1, 0) + " " + message[0].value(1, 1) + "." + message[0].value(1, 2) + ", only ORDERS D.96A can be imported")
+	}
+
+	var line *EdiOrderLine = nil
+	for i := 1; i < len(message); i++ {
+		s := message[i]
+		switch s.Tag {
+		case "BGM":
+			order.DocumentNumber = s.value(1, 0)
+		case "DTM":
+			date := parseEdifactDate(s.value(0, 1), s.value(0, 2))
+			switch s.value(0, 0) {
+			case "137": // document date
+				order.DocumentDate = date
+			case "2", "64": // delivery date requested, earliest delivery date
+				if order.DeliveryDate == nil {
+					order.DeliveryDate = date
+				}
+			}
+		case "NAD":
+			gln := s.value(1, 0)
+			switch s.value(0, 0) {
+			case "BY":
+				order.BuyerGln = gln
+			case "DP", "ST":
+				order.DeliveryGln = gln
+			case "IV":
+				order.InvoiceeGln = gln
+			case "SU":
+				order.SupplierGln = gln
+			}
+		case "CUX":
+			order.Currency = s.value(0, 1)
+		case "LIN":
+			if line != nil {
+				order.Lines = append(order.Lines, *line)
+			}
+			line = &EdiOrderLine{Ean: s.value(2, 0)}
+		case "QTY":
+			if line == nil || (s.value(0, 0) != "21" && s.value(0, 0) != "1") {
+				continue
+			}
+			quantity, err := parseEdifactNumber(s.value(0, 1))
+			if err != nil || quantity <= 0 || quantity != math.Trunc(quantity) {
+				return order, errors.New("invalid quantity " + s.value(0, 1) + " in the line of the product " + line.Ean)
+			}
+			line.Quantity = quantity
+		case "PRI":
+			if line == nil || (s.value(0, 0) != "AAA" && s.value(0, 0) != "AAB") {
+				continue
+			}
+			price, err := parseEdifactNumber(s.value(0, 1))
+			if err != nil || price < 0 {
+				return order, errors.New("invalid price " + s.value(0, 1) + " in the line of the product " + line.Ean)
+			}
+			line.Price = &price
+		case "UNS":
+			if line != nil {
+				order.Lines = append(order.Lines, *line)
+				line = nil
+			}
+		}
+	}
+	if line != nil {
+		order.Lines = append(order.Lines, *line)
+	}
+
+	if len(order.DocumentNumber) == 0 {
+		return order, errors.New("the order has no document number (BGM)")
+	}
+	if len(order.BuyerGln) == 0 {
+		return order, errors.New("the order has no buyer (NAD+BY)")
+	}
+	if len(order.Lines) == 0 {
+		return order, errors.New("the order has no lines")
+	}
+	for i := 0; i < len(order.Lines); i++ {
+		if len(order.Lines[i].Ean) == 0 {
+			return order, errors.New("the line " + strconv.Itoa(i+1) + " has no EAN code")
+		}
+		if order.Lines[i].Quantity <= 0 {
+			return order, errors.New("the line of the product " + order.Lines[i].Ean + " has no ordered quantity (QTY+21)")
+		}
+	}
+	return order, nil
+}
+
+// Reads the files in the inbound directory, imports the messages and moves the files to the "processed" or the "error" subdirectory.
+func processEdiInbound(enterpriseId int32) []EdiMessage {
+	messages := make([]EdiMessage, 0)
+	settings := getSettingsRecordById(enterpriseId)
+	if len(settings.EdiInboundDirectory) == 0 {
+		return messages
+	}
+
+	files, err := os.ReadDir(settings.EdiInboundDirectory)
+	if err != nil {
+		log("EDI", err.Error())
+		return messages
+	}
+	for i := 0; i < len(files); i++ {
+		if files[i].IsDir() || strings.HasPrefix(files[i].Name(), ".") {
+			continue
+		}
+		path := filepath.Join(settings.EdiInboundDirectory, files[i].Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log("EDI", err.Error())
+			continue
+		}
+
+		fileMessages := processEdiFile(files[i].Name(), string(content), enterpriseId)
+		subdirectory := "processed"
+		for j := 0; j < len(fileMessages); j++ {
+			if fileMessages[j].Status != "P" {
+				subdirectory = "error"
+			}
+		}
+		messages = append(messages, fileMessages...)
+
+		err = os.MkdirAll(filepath.Join(settings.EdiInboundDirectory, subdirectory), 0755)
+		if err == nil {
+			err = os.Rename(path, filepath.Join(settings.EdiInboundDirectory, subdirectory, files[i].Name()))
+		}
+		if err != nil {
+			log("EDI", err.Error())
+		}
+	}
+	return messages
+}
+
+// Imports all the messages in an interchange, and logs the result of each one.
+func processEdiFile(fileName string, content string, enterpriseId int32) []EdiMessage {
+	messages := make([]EdiMessage, 0)
+
+	segments, err := parseEdifact(content)
+	var interchangeReference string
+	if err == nil && segments[0].Tag == "UNB" {
+		interchangeReference = segments[0].value(4, 0)
+	}
+	var ediMessages [][]EdifactSegment
+	if err == nil {
+		ediMessages = splitEdifactMessages(segments)
+		if len(ediMessages) == 0 {
+			err = errors.New("the interchange has no messages")
+		}
+	}
+	if err != nil {
+		m := EdiMessage{Direction: "I", FileName: fileName, InterchangeReference: interchangeReference, Status: "E", ErrorMessage: err.Error(), Content: content, EnterpriseId: enterpriseId}
+		m.insertEdiMessage()
+		return append(messages, m)
+	}
+
+	for i := 0; i < len(ediMessages); i++ {
+		m := EdiMessage{Direction: "I", MessageType: ediMessages[i][0].value(1, 0), FileName: fileName, InterchangeReference: interchangeReference, Content: edifactMessageContent(ediMessages[i]), EnterpriseId: enterpriseId}
+		if len(m.MessageType) > 6 {
+			m.MessageType = m.MessageType[:6]
+		}
+		if m.MessageType == EDI_MESSAGE_ORDERS {
+			m.importEdiOrder(ediMessages[i])
+		} else {
+			m.Status = "E"
+			m.ErrorMessage = "Unsupported message type " + m.MessageType
+		}
+		m.insertEdiMessage()
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+// Rebuilds the text of a single message to keep it in the log.
+func edifactMessageContent(message []EdifactSegment) string {
+	segments := make([]string, 0)
+	for i := 0; i < len(message); i++ {
+		elements := []string{message[i].Tag}
+		for j := 0; j < len(message[i].Elements); j++ {
+			elements = append(elements, edifactElement(append([]string{}, message[i].Elements[j]...)...))
+		}
+		segments = append(segments, strings.Join(elements, "+"))
+	}
+	return strings.Join(segments, "'\n") + "'"
+}
+
+// Creates a sales order from an ORDERS message. The customer is found by the GLN of the buyer, the addresses by the GLN of the delivery party and the invoicee,
+// and the products by the EAN13 bar code. If anything can't be found, nothing is created and the error is saved in the message.
+func (m *EdiMessage) importEdiOrder(message []EdifactSegment) {
+	m.Status = "E"
+	order, err := parseEdiOrder(message)
+	m.DocumentNumber = order.DocumentNumber
+	if err != nil {
+		m.ErrorMessage = err.Error()
+		return
+	}
+
+	// customer
+	var customer Customer
+	result := dbOrm.Model(&Customer{}).Where("gln = ? AND enterprise = ?", order.BuyerGln, m.EnterpriseId).Limit(1).Find(&customer)
+	if result.Error != nil || result.RowsAffected == 0 {
+		m.ErrorMessage = "There is no customer with the GLN " + order.BuyerGln
+		return
+	}
+	m.CustomerId = &customer.Id
+	if customer.BillingSeriesId == nil || customer.PaymentMethodId == nil {
+		m.ErrorMessage = "The customer " + customer.Name + " has no billing series or payment method"
+		return
+	}
+
+	// the same order can't be imported twice
+	var imported int64
+	result = dbOrm.Model(&EdiMessage{}).Where("direction = 'I' AND message_type = ? AND status = 'P' AND customer = ? AND document_number = ? AND enterprise = ?", EDI_MESSAGE_ORDERS, customer.Id, m.DocumentNumber, m.EnterpriseId).Count(&imported)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		m.ErrorMessage = "Internal error"
+		return
+	}
+	if imported > 0 {
+		m.ErrorMessage = "The order " + order.DocumentNumber + " has already been imported"
+		return
+	}
+
+	// addresses
+	billingAddressId, ok := findEdiAddress(order.InvoiceeGln, customer.MainBillingAddressId, customer.Id, m.EnterpriseId)
+	if !ok {
+		m.ErrorMessage = "There is no billing address for the GLN " + order.InvoiceeGln
+		return
+	}
+	shippingAddressId, ok := findEdiAddress(order.DeliveryGln, customer.MainShippingAddressId, customer.Id, m.EnterpriseId)
+	if !ok {
+		m.ErrorMessage = "There is no delivery address for the GLN " + order.DeliveryGln
+		return
+	}
+
+	// currency
+	if len(order.Currency) == 0 {
+		m.ErrorMessage = "The order has no currency (CUX)"
+		return
+	}
+	var currency Currency
+	result = dbOrm.Model(&Currency{}).Where("iso_code = ? AND enterprise = ?", order.Currency, m.EnterpriseId).Limit(1).Find(&currency)
+	if result.Error != nil || result.RowsAffected == 0 {
+		m.ErrorMessage = "The currency " + order.Currency + " does not exist"
+		return
+	}
+
+	// products
+	products := make([]Product, len(order.Lines))
+	for i := 0; i < len(order.Lines); i++ {
+		products[i] = getProductByBarcode(order.Lines[i].Ean, m.EnterpriseId)
+		if products[i].Id <= 0 {
+			m.ErrorMessage = "There is no product with the EAN code " + order.Lines[i].Ean
+			return
+		}
+		if products[i].Off {
+			m.ErrorMessage = "The product " + products[i].Name + " is deactivated"
+			return
+		}
+	}
+
+	s := SaleOrder{
+		Reference:         order.DocumentNumber,
+		CustomerId:        customer.Id,
+		PaymentMethodId:   *customer.PaymentMethodId,
+		BillingSeriesId:   *customer.BillingSeriesId,
+		CurrencyId:        currency.Id,
+		BillingAddressId:  billingAddressId,
+		ShippingAddressId: shippingAddressId,
+		Description:       "EDI order " + order.DocumentNumber,
+		EnterpriseId:      m.EnterpriseId,
+	}
+	if len(s.Reference) > 15 {
+		s.Reference = s.Reference[:15]
+	}
+	if order.DeliveryDate != nil {
+		s.Notes = "Requested delivery date: " + order.DeliveryDate.Format("2006-01-02")
+	}
+	okAndErr, orderId := s.insertSalesOrder(0, nil)
+	if !okAndErr.Ok {
+		m.ErrorMessage = "The sales order could not be created" + getCustomerRiskErrorMessage(okAndErr)
+		return
+	}
+	m.SalesOrderId = &orderId
+
+	for i := 0; i < len(order.Lines); i++ {
+		d := SalesOrderDetail{
+			OrderId:      orderId,
+			ProductId:    products[i].Id,
+			Quantity:     order.Lines[i].Quantity,
+			Price:        products[i].Price,
+			VatPercent:   products[i].VatPercent,
+			EnterpriseId: m.EnterpriseId,
+		}
+		if order.Lines[i].Price != nil {
+			d.Price = *order.Lines[i].Price
+		} else if price, ok := getProductPriceForSaleOrder(products[i].Id, orderId, d.Quantity, m.EnterpriseId); ok {
+			// apply the price list of the customer, if there is any
+			d.Price = price
+		}
+		if !d.insertSalesOrderDetail(0, nil).Ok {
+			m.ErrorMessage = "The line of the product " + order.Lines[i].Ean + " could not be added to the sales order"
+			s.Id = orderId
+			s.deleteSalesOrder(0)
+			m.SalesOrderId = nil
+			return
+		}
+	}
+
+	m.Status = "P"
+}
+
+// Returns the address of the customer with the GLN, or the default address if the GLN is not set.
+func findEdiAddress(gln string, defaultAddressId *int32, customerId int32, enterpriseId int32) (int32, bool) {
+	if len(gln) == 0 {
+		if defaultAddressId == nil {
+			return 0, false
+		}
+		return *defaultAddressId, true
+	}
+
+	var address Address
+	result := dbOrm.Model(&Address{}).Where("gln = ? AND customer = ? AND enterprise = ?", gln, customerId, enterpriseId).Limit(1).Find(&address)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return 0, false
+	}
+	if result.RowsAffected == 0 {
+		// the buyer is also the delivery party or the invoicee
+		var customer Customer
+		result = dbOrm.Model(&Customer{}).Where("id = ? AND gln = ? AND enterprise = ?", customerId, gln, enterpriseId).Limit(1).Find(&customer)
+		if result.Error != nil || result.RowsAffected == 0 || defaultAddressId == nil {
+			return 0, false
+		}
+		return *defaultAddressId, true
+	}
+	return address.Id, true
+}
+
+/* OUTBOUND: DESADV, INVOIC */
+
+// Generates the despatch advice of the shipping, and writes it to the outbound directory.
+// ERROR CODES:
+// 1. The enterprise has no GLN or the outbound directory is not set in the settings
+// 2. The customer has no GLN
+// 3. The shipping has no packages
+// 4. The file could not be written in the outbound directory
+func generateEdiDesadv(shippingId int64, enterpriseId int32) OkAndErrorCodeReturn {
+	shipping := getShippingRow(shippingId)
+	if shipping.Id <= 0 || shipping.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	settings := getSettingsRecordById(enterpriseId)
+	if len(settings.EnterpriseGln) == 0 || len(settings.EdiOutboundDirectory) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+	customer := getCustomerRow(shipping.Order.CustomerId)
+	if len(customer.Gln) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+	packaging := getPackagingByShipping(shippingId, enterpriseId)
+	if len(packaging) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+
+	m := EdiMessage{Direction: "O", MessageType: EDI_MESSAGE_DESADV, DocumentNumber: strings.TrimSpace(shipping.DeliveryNote.DeliveryNoteName), Status: "E", CustomerId: &customer.Id, SalesOrderId: &shipping.OrderId, ShippingId: &shipping.Id, EnterpriseId: enterpriseId}
+	if !m.insertEdiMessage() {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	reference := strconv.Itoa(int(m.Id))
+	now := time.Now()
+	dateSent := now
+	if shipping.DateSent != nil {
+		dateSent = *shipping.DateSent
+	}
+	deliveryGln := shipping.DeliveryAddress.Gln
+	if len(deliveryGln) == 0 {
+		deliveryGln = customer.Gln
+	}
+
+	w := newEdifactInterchange(settings.EnterpriseGln, customer.Gln, reference, now)
+	w.beginMessage(reference, EDI_MESSAGE_DESADV, "EAN005")
+	w.add("BGM", "351", edifactElement(m.DocumentNumber), "9")
+	w.add("DTM", edifactElement("137", edifactDate(now), "102"))
+	w.add("DTM", edifactElement("11", edifactDate(dateSent), "102"))
+	if len(shipping.Order.Reference) > 0 {
+		w.add("RFF", edifactElement("ON", shipping.Order.Reference))
+	}
+	w.add("NAD", "SU", edifactElement(settings.EnterpriseGln, "", "9"))
+	w.add("NAD", "BY", edifactElement(customer.Gln, "", "9"))
+	w.add("NAD", "DP", edifactElement(deliveryGln, "", "9"))
+	if len(shipping.TrackingNumber) > 0 {
+		w.add("RFF", edifactElement("CN", shipping.TrackingNumber))
+	}
+
+	// hierarchy: consignment -> pallets -> packages -> lines
+	w.add("CPS", "1")
+	var hierarchy int = 1
+	var lines int = 0
+	palletHierarchy := make(map[int32]int)
+	for i := 0; i < len(packaging); i++ {
+		p := packaging[i]
+		parent := 1
+		if p.PalletId != nil {
+			if h, ok := palletHierarchy[*p.PalletId]; ok {
+				parent = h
+			} else {
+				hierarchy++
+				palletHierarchy[*p.PalletId] = hierarchy
+				parent = hierarchy
+				w.add("CPS", strconv.Itoa(hierarchy), "1")
+				w.add("PAC", "1", "", "201")
+				if p.Pallet != nil {
+					w.add("MEA", "PD", "AAB", edifactElement("KGM", strconv.FormatFloat(p.Pallet.Weight, 'f', 3, 64)))
+				}
+			}
+		}
+		hierarchy++
+		w.add("CPS", strconv.Itoa(hierarchy), strconv.Itoa(parent))
+		w.add("PAC", "1", "", "CT")
+		w.add("MEA", "PD", "AAB", edifactElement("KGM", strconv.FormatFloat(p.Weight, 'f', 3, 64)))
+		for j := 0; j < len(p.DetailsPackaged); j++ {
+			lines++
+			w.add("LIN", strconv.Itoa(lines), "", edifactElement(p.DetailsPackaged[j].OrderDetail.Product.BarCode, "EN"))
+			w.add("QTY", edifactElement("12", formatQuantity(p.DetailsPackaged[j].Quantity)))
+		}
+	}
+	w.add("CNT", edifactElement("2", strconv.Itoa(lines)))
+	w.endMessage(reference)
+
+	return m.writeEdiOutbound(w.String(reference), reference, settings)
+}
+
+// Generates the invoice message of the sales invoice, and writes it to the outbound directory.
+// ERROR CODES:
+// 1. The enterprise has no GLN or the outbound directory is not set in the settings
+// 2. The customer has no GLN
+// 3. The invoice has no lines, or the enterprise has no tax ID or country
+// 4. The file could not be written in the outbound directory
+func generateEdiInvoic(invoiceId int64, enterpriseId int32) OkAndErrorCodeReturn {
+	settings := getSettingsRecordById(enterpriseId)
+	if len(settings.EnterpriseGln) == 0 || len(settings.EdiOutboundDirectory) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+	e, result := getEN16931Invoice(invoiceId, enterpriseId)
+	if !result.Ok {
+		if result.ErrorCode == 0 {
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+	customer := e.Invoice.Customer
+	if len(customer.Gln) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+
+	m := EdiMessage{Direction: "O", MessageType: EDI_MESSAGE_INVOIC, DocumentNumber: strings.TrimSpace(e.Invoice.InvoiceName), Status: "E", CustomerId: &customer.Id, SalesInvoiceId: &e.Invoice.Id, EnterpriseId: enterpriseId}
+	orders := getSalesInvoiceOrders(e.Invoice.Id, enterpriseId)
+	if len(orders) > 0 {
+		m.SalesOrderId = &orders[0].Id
+	}
+	if !m.insertEdiMessage() {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	reference := strconv.Itoa(int(m.Id))
+	invoiceeGln := e.Address.Gln
+	if len(invoiceeGln) == 0 {
+		invoiceeGln = customer.Gln
+	}
+
+	w := newEdifactInterchange(settings.EnterpriseGln, customer.Gln, reference, time.Now())
+	w.beginMessage(reference, EDI_MESSAGE_INVOIC, "EAN008")
+	documentType := "380" // commercial invoice
+	if e.Invoice.Amending {
+		documentType = "381" // credit note
+	}
+	w.add("BGM", documentType, edifactElement(m.DocumentNumber), "9")
+	w.add("DTM", edifactElement("137", edifactDate(e.Invoice.DateCreated), "102"))
+	if len(orders) > 0 && len(orders[0].Reference) > 0 {
+		w.add("RFF", edifactElement("ON", orders[0].Reference))
+	}
+	if e.AmendedInvoice != nil {
+		w.add("RFF", edifactElement("IV", strings.TrimSpace(e.AmendedInvoice.InvoiceName)))
+	}
+	w.add("NAD", "SU", edifactElement(settings.EnterpriseGln, "", "9"))
+	w.add("RFF", edifactElement("VA", settings.EnterpriseTaxId))
+	w.add("NAD", "BY", edifactElement(customer.Gln, "", "9"))
+	if len(e.CustomerVatNumber) > 0 {
+		w.add("RFF", edifactElement("VA", e.CustomerVatNumber))
+	}
+	w.add("NAD", "IV", edifactElement(invoiceeGln, "", "9"))
+	if len(orders) > 0 {
+		deliveryAddress := getAddressRow(orders[0].ShippingAddressId)
+		if len(deliveryAddress.Gln) > 0 {
+			w.add("NAD", "DP", edifactElement(deliveryAddress.Gln, "", "9"))
+		}
+	}
+	w.add("CUX", edifactElement("2", e.Invoice.Currency.IsoCode, "4"))
+
+	for i := 0; i < len(e.Allowances); i++ {
+		if e.Allowances[i].Charge {
+			w.add("ALC", "C", "", "", "", edifactElement("", "", "", e.Allowances[i].Reason))
+			w.add("MOA", edifactElement("23", edifactAmount(e.Allowances[i].Amount)))
+		} else {
+			w.add("ALC", "A", "", "", "", edifactElement("", "", "", e.Allowances[i].Reason))
+			w.add("MOA", edifactElement("204", edifactAmount(e.Allowances[i].Amount)))
+		}
+	}
+
+	for i := 0; i < len(e.Lines); i++ {
+		l := e.Lines[i]
+		if l.Detail.Product != nil && len(l.Detail.Product.BarCode) > 0 {
+			w.add("LIN", strconv.Itoa(i+1), "", edifactElement(l.Detail.Product.BarCode, "EN"))
+		} else {
+			w.add("LIN", strconv.Itoa(i+1))
+		}
+		w.add("IMD", "F", "", edifactElement("", "", "", l.Name))
+		w.add("QTY", edifactElement("47", formatQuantity(l.Detail.Quantity)))
+		w.add("MOA", edifactElement("203", edifactAmount(l.Amount)))
+		w.add("PRI", edifactElement("AAA", strconv.FormatFloat(l.Price, 'f', -1, 64)))
+		w.add("TAX", "7", "VAT", "", "", edifactElement("", "", "", formatEN16931Percent(l.TaxCategory.Percent)), l.TaxCategory.Code)
+	}
+
+	w.add("UNS", "S")
+	w.add("CNT", edifactElement("2", strconv.Itoa(len(e.Lines))))
+	w.add("MOA", edifactElement("77", edifactAmount(e.TaxInclusiveAmount)))
+	w.add("MOA", edifactElement("79", edifactAmount(e.LineTotalAmount)))
+	w.add("MOA", edifactElement("125", edifactAmount(e.TaxExclusiveAmount)))
+	w.add("MOA", edifactElement("176", edifactAmount(e.TaxTotal)))
+	for i := 0; i < len(e.TaxSubtotals); i++ {
+		t := e.TaxSubtotals[i]
+		w.add("TAX", "7", "VAT", "", "", edifactElement("", "", "", formatEN16931Percent(t.TaxCategory.Percent)), t.TaxCategory.Code)
+		w.add("MOA", edifactElement("124", edifactAmount(t.TaxAmount)))
+		w.add("MOA", edifactElement("125", edifactAmount(t.TaxableAmount)))
+	}
+	w.endMessage(reference)
+
+	return m.writeEdiOutbound(w.String(reference), reference, settings)
+}
+
+// Writes the interchange to the outbound directory, and saves the result in the message log.
+func (m *EdiMessage) writeEdiOutbound(content string, reference string, settings Settings) OkAndErrorCodeReturn {
+	m.Content = content
+	m.InterchangeReference = reference
+	m.FileName = fmt.Sprintf("%s_%d.edi", m.MessageType, m.Id)
+
+	err := os.WriteFile(filepath.Join(settings.EdiOutboundDirectory, m.FileName), []byte(content), 0644)
+	if err != nil {
+		log("EDI", err.Error())
+		m.Status = "E"
+		m.ErrorMessage = err.Error()
+	} else {
+		m.Status = "P"
+		m.ErrorMessage = ""
+	}
+	m.updateEdiMessage()
+
+	if err != nil {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4}
+	}
+	return OkAndErrorCodeReturn{Ok: true, ExtraData: []string{m.FileName}}
+}
@@ -0,0 +1,688 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// THIS FILE CONTAINS THE EXPORT OF THE SALES INVOICES TO THE SPANISH FACTURAE 3.2.2 FORMAT, REQUIRED BY THE PUBLIC ADMINISTRATION CUSTOMERS.
+
+const FACTURAE_NAMESPACE = "http://www.facturae.gob.es/formato/Versiones/Facturaev3_2_2.xml"
+const FACTURAE_XMLDSIG_NAMESPACE = "http://www.w3.org/2000/09/xmldsig#"
+const FACTURAE_XADES_NAMESPACE = "http://uri.etsi.org/01903/v1.3.2#"
+const FACTURAE_SIGNATURE_POLICY = "http://www.facturae.es/politica_de_firma_formato_facturae/politica_de_firma_formato_facturae_v3_1.pdf"
+const FACTURAE_SIGNATURE_POLICY_HASH = "Ohixl6upD6av8N7pEvDABhEL6hM=" // SHA-1 of the signature policy document
+const XMLDSIG_SHA1 = "http://www.w3.org/2000/09/xmldsig#sha1"
+const XMLENC_SHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+
+// Namespace declarations of the root element, sorted by prefix as they are rendered in the canonical form.
+// All the namespaces are declared in the root element, so the canonical form of any element is the same as it's written in the document
+// adding this declarations in the first element.
+const FACTURAE_NAMESPACE_DECLARATIONS = ` xmlns:ds="` + FACTURAE_XMLDSIG_NAMESPACE + `" xmlns:etsi="` + FACTURAE_XADES_NAMESPACE + `" xmlns:fe="` + FACTURAE_NAMESPACE + `"`
+
+type FacturaeFileHeader struct {
+	XMLName           xml.Name      `xml:"FileHeader"`
+	SchemaVersion     string        `xml:"SchemaVersion"`
+	Modality          string        `xml:"Modality"`          // I = Individual (one invoice per file)
+	InvoiceIssuerType string        `xml:"InvoiceIssuerType"` // EM = Issued by the seller
+	Batch             FacturaeBatch `xml:"Batch"`
+}
+
+type FacturaeBatch struct {
+	BatchIdentifier        string         `xml:"BatchIdentifier"`
+	InvoicesCount          int            `xml:"InvoicesCount"`
+	TotalInvoicesAmount    FacturaeAmount `xml:"TotalInvoicesAmount"`
+	TotalOutstandingAmount FacturaeAmount `xml:"TotalOutstandingAmount"`
+	TotalExecutableAmount  FacturaeAmount `xml:"TotalExecutableAmount"`
+	InvoiceCurrencyCode    string         `xml:"InvoiceCurrencyCode"`
+}
+
+type FacturaeAmount struct {
+	TotalAmount string `xml:"TotalAmount"`
+}
+
+type FacturaeParties struct {
+	XMLName     xml.Name         `xml:"Parties"`
+	SellerParty FacturaeBusiness `xml:"SellerParty"`
+	BuyerParty  FacturaeBusiness `xml:"BuyerParty"`
+}
+
+type FacturaeBusiness struct {
+	TaxIdentification     FacturaeTaxIdentification      `xml:"TaxIdentification"`
+	AdministrativeCentres *FacturaeAdministrativeCentres `xml:"AdministrativeCentres,omitempty"`
+	LegalEntity           *FacturaeLegalEntity           `xml:"LegalEntity,omitempty"`
+	Individual            *FacturaeIndividual            `xml:"Individual,omitempty"`
+}
+
+type FacturaeTaxIdentification struct {
+	PersonTypeCode          string `xml:"PersonTypeCode"`    // F = Individual, J = Legal entity
+	ResidenceTypeCode       string `xml:"ResidenceTypeCode"` // R = Resident in Spain, U = Resident in the European Union, E = Foreigner
+	TaxIdentificationNumber string `xml:"TaxIdentificationNumber"`
+}
+
+type FacturaeAdministrativeCentres struct {
+	AdministrativeCentre []FacturaeAdministrativeCentre `xml:"AdministrativeCentre"`
+}
+
+type FacturaeAdministrativeCentre struct {
+	CentreCode      string                   `xml:"CentreCode"`
+	RoleTypeCode    string                   `xml:"RoleTypeCode"` // 01 = Accounting office, 02 = Management body, 03 = Processing unit
+	AddressInSpain  *FacturaeAddressInSpain  `xml:"AddressInSpain,omitempty"`
+	OverseasAddress *FacturaeOverseasAddress `xml:"OverseasAddress,omitempty"`
+}
+
+type FacturaeLegalEntity struct {
+	CorporateName   string                   `xml:"CorporateName"`
+	TradeName       string                   `xml:"TradeName,omitempty"`
+	AddressInSpain  *FacturaeAddressInSpain  `xml:"AddressInSpain,omitempty"`
+	OverseasAddress *FacturaeOverseasAddress `xml:"OverseasAddress,omitempty"`
+}
+
+type FacturaeIndividual struct {
+	Name            string                   `xml:"Name"`
+	FirstSurname    string                   `xml:"FirstSurname"`
+	AddressInSpain  *FacturaeAddressInSpain  `xml:"AddressInSpain,omitempty"`
+	OverseasAddress *FacturaeOverseasAddress `xml:"OverseasAddress,omitempty"`
+}
+
+type FacturaeAddressInSpain struct {
+	Address     string `xml:"Address"`
+	PostCode    string `xml:"PostCode"`
+	Town        string `xml:"Town"`
+	Province    string `xml:"Province"`
+	CountryCode string `xml:"CountryCode"`
+}
+
+type FacturaeOverseasAddress struct {
+	Address         string `xml:"Address"`
+	PostCodeAndTown string `xml:"PostCodeAndTown"`
+	Province        string `xml:"Province"`
+	CountryCode     string `xml:"CountryCode"`
+}
+
+type FacturaeInvoices struct {
+	XMLName xml.Name          `xml:"Invoices"`
+	Invoice []FacturaeInvoice `xml:"Invoice"`
+}
+
+type FacturaeInvoice struct {
+	InvoiceHeader    FacturaeInvoiceHeader    `xml:"InvoiceHeader"`
+	InvoiceIssueData FacturaeInvoiceIssueData `xml:"InvoiceIssueData"`
+	TaxesOutputs     FacturaeTaxes            `xml:"TaxesOutputs"`
+	InvoiceTotals    FacturaeInvoiceTotals    `xml:"InvoiceTotals"`
+	Items            FacturaeItems            `xml:"Items"`
+}
+
+type FacturaeInvoiceHeader struct {
+	InvoiceNumber       string              `xml:"InvoiceNumber"`
+	InvoiceSeriesCode   string              `xml:"InvoiceSeriesCode"`
+	InvoiceDocumentType string              `xml:"InvoiceDocumentType"` // FC = Complete invoice, FA = Simplified invoice
+	InvoiceClass        string              `xml:"InvoiceClass"`        // OO = Original, OR = Corrective
+	Corrective          *FacturaeCorrective `xml:"Corrective,omitempty"`
+}
+
+type FacturaeCorrective struct {
+	InvoiceNumber               string         `xml:"InvoiceNumber"`
+	InvoiceSeriesCode           string         `xml:"InvoiceSeriesCode"`
+	ReasonCode                  string         `xml:"ReasonCode"`
+	ReasonDescription           string         `xml:"ReasonDescription"`
+	TaxPeriod                   FacturaePeriod `xml:"TaxPeriod"`
+	CorrectionMethod            string         `xml:"CorrectionMethod"`
+	CorrectionMethodDescription string         `xml:"CorrectionMethodDescription"`
+}
+
+type FacturaePeriod struct {
+	StartDate string `xml:"StartDate"`
+	EndDate   string `xml:"EndDate"`
+}
+
+type FacturaeInvoiceIssueData struct {
+	IssueDate           string                       `xml:"IssueDate"`
+	InvoiceCurrencyCode string                       `xml:"InvoiceCurrencyCode"`
+	ExchangeRateDetails *FacturaeExchangeRateDetails `xml:"ExchangeRateDetails,omitempty"`
+	TaxCurrencyCode     string                       `xml:"TaxCurrencyCode"`
+	LanguageName        string                       `xml:"LanguageName"`
+}
+
+type FacturaeExchangeRateDetails struct {
+	ExchangeRate     string `xml:"ExchangeRate"`
+	ExchangeRateDate string `xml:"ExchangeRateDate"`
+}
+
+type FacturaeTaxes struct {
+	Tax []FacturaeTax `xml:"Tax"`
+}
+
+type FacturaeTax struct {
+	TaxTypeCode string         `xml:"TaxTypeCode"` // 01 = VAT
+	TaxRate     string         `xml:"TaxRate"`
+	TaxableBase FacturaeAmount `xml:"TaxableBase"`
+	TaxAmount   FacturaeAmount `xml:"TaxAmount"`
+}
+
+type FacturaeInvoiceTotals struct {
+	TotalGrossAmount            string             `xml:"TotalGrossAmount"`
+	GeneralDiscounts            *FacturaeDiscounts `xml:"GeneralDiscounts,omitempty"`
+	GeneralSurcharges           *FacturaeCharges   `xml:"GeneralSurcharges,omitempty"`
+	TotalGeneralDiscounts       string             `xml:"TotalGeneralDiscounts"`
+	TotalGeneralSurcharges      string             `xml:"TotalGeneralSurcharges"`
+	TotalGrossAmountBeforeTaxes string             `xml:"TotalGrossAmountBeforeTaxes"`
+	TotalTaxOutputs             string             `xml:"TotalTaxOutputs"`
+	TotalTaxesWithheld          string             `xml:"TotalTaxesWithheld"`
+	InvoiceTotal                string             `xml:"InvoiceTotal"`
+	TotalOutstandingAmount      string             `xml:"TotalOutstandingAmount"`
+	TotalExecutableAmount       string             `xml:"TotalExecutableAmount"`
+}
+
+type FacturaeDiscounts struct {
+	Discount []FacturaeDiscount `xml:"Discount"`
+}
+
+type FacturaeDiscount struct {
+	DiscountReason string `xml:"DiscountReason"`
+	DiscountRate   string `xml:"DiscountRate,omitempty"`
+	DiscountAmount string `xml:"DiscountAmount"`
+}
+
+type FacturaeCharges struct {
+	Charge []FacturaeCharge `xml:"Charge"`
+}
+
+type FacturaeCharge struct {
+	ChargeReason string `xml:"ChargeReason"`
+	ChargeAmount string `xml:"ChargeAmount"`
+}
+
+type FacturaeItems struct {
+	InvoiceLine []FacturaeInvoiceLine `xml:"InvoiceLine"`
+}
+
+type FacturaeInvoiceLine struct {
+	ItemDescription     string        `xml:"ItemDescription"`
+	Quantity            string        `xml:"Quantity"`
+	UnitOfMeasure       string        `xml:"UnitOfMeasure"` // 01 = Units
+	UnitPriceWithoutTax string        `xml:"UnitPriceWithoutTax"`
+	TotalCost           string        `xml:"TotalCost"`
+	GrossAmount         string        `xml:"GrossAmount"`
+	TaxesOutputs        FacturaeTaxes `xml:"TaxesOutputs"`
+	ArticleCode         string        `xml:"ArticleCode,omitempty"`
+}
+
+// Returns the Facturae XML of the sales invoice, signed with the certificate of the enterprise if there is one configured.
+// ERROR CODES:
+// 1. The enterprise has no tax ID or country in the settings
+// 2. The customer has no tax ID
+// 3. The invoice has no details
+// 4. The certificate of the enterprise can't be loaded or the invoice can't be signed
+func generateSalesInvoiceFacturae(invoiceId int64, enterpriseId int32) ([]byte, OkAndErrorCodeReturn) {
+	invoice := getSalesInvoiceRow(invoiceId)
+	if invoice.Id <= 0 || invoice.EnterpriseId != enterpriseId {
+		return nil, OkAndErrorCodeReturn{Ok: false}
+	}
+
+	settings := getSettingsRecordById(enterpriseId)
+	if len(settings.EnterpriseTaxId) == 0 || settings.EnterpriseCountry == nil {
+		return nil, OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+	customer := invoice.Customer
+	customerTaxId := customer.TaxId
+	if len(customerTaxId) == 0 {
+		customerTaxId = customer.VatNumber
+	}
+	if len(customerTaxId) == 0 {
+		return nil, OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+	details := getSalesInvoiceDetail(invoice.Id, enterpriseId)
+	if len(details) == 0 {
+		return nil, OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+	address := getAddressRow(invoice.BillingAddressId)
+
+	// parties
+	seller := FacturaeBusiness{
+		TaxIdentification: FacturaeTaxIdentification{
+			PersonTypeCode:          facturaePersonTypeCode(settings.EnterpriseTaxId),
+			ResidenceTypeCode:       facturaeResidenceTypeCode(settings.EnterpriseCountry.Zone),
+			TaxIdentificationNumber: settings.EnterpriseTaxId,
+		},
+	}
+	sellerAddressInSpain, sellerOverseasAddress := facturaeAddress(settings.EnterpriseAddress, settings.EnterpriseZipCode, settings.EnterpriseCity, settings.EnterpriseProvince, *settings.EnterpriseCountry)
+	seller.setName(settings.EnterpriseName, "", sellerAddressInSpain, sellerOverseasAddress)
+
+	stateName := ""
+	if address.State != nil {
+		stateName = address.State.Name
+	}
+	buyerAddressInSpain, buyerOverseasAddress := facturaeAddress(strings.TrimSpace(address.Address+" "+address.Address2), address.ZipCode, address.City, stateName, address.Country)
+	buyer := FacturaeBusiness{
+		TaxIdentification: FacturaeTaxIdentification{
+			PersonTypeCode:          facturaePersonTypeCode(customerTaxId),
+			ResidenceTypeCode:       facturaeResidenceTypeCode(address.Country.Zone),
+			TaxIdentificationNumber: customerTaxId,
+		},
+	}
+	// public administration customers receive the invoices in FACe using the DIR3 codes
+	if len(customer.Dir3AccountingOffice) > 0 && len(customer.Dir3ManagementBody) > 0 && len(customer.Dir3ProcessingUnit) > 0 {
+		buyer.AdministrativeCentres = &FacturaeAdministrativeCentres{
+			AdministrativeCentre: []FacturaeAdministrativeCentre{
+				{CentreCode: customer.Dir3AccountingOffice, RoleTypeCode: "01", AddressInSpain: buyerAddressInSpain, OverseasAddress: buyerOverseasAddress},
+				{CentreCode: customer.Dir3ManagementBody, RoleTypeCode: "02", AddressInSpain: buyerAddressInSpain, OverseasAddress: buyerOverseasAddress},
+				{CentreCode: customer.Dir3ProcessingUnit, RoleTypeCode: "03", AddressInSpain: buyerAddressInSpain, OverseasAddress: buyerOverseasAddress},
+			},
+		}
+	}
+	customerName := customer.FiscalName
+	if len(customerName) == 0 {
+		customerName = customer.Name
+	}
+	buyer.setName(customerName, customer.Tradename, buyerAddressInSpain, buyerOverseasAddress)
+
+	// lines and taxes, the VAT is calculated over the products of the invoice
+	lines := make([]FacturaeInvoiceLine, 0)
+	var totalGrossAmount float64
+	taxableBases := make(map[float64]float64)
+	for i := 0; i < len(details); i++ {
+		d := details[i]
+		totalCost := d.Price * d.Quantity
+		totalGrossAmount += totalCost
+		taxableBases[d.VatPercent] += totalCost
+
+		line := FacturaeInvoiceLine{
+			ItemDescription:     d.Description,
+			Quantity:            fmt.Sprintf("%.2f", d.Quantity),
+			UnitOfMeasure:       "01",
+			UnitPriceWithoutTax: fmt.Sprintf("%.6f", d.Price),
+			TotalCost:           fmt.Sprintf("%.6f", totalCost),
+			GrossAmount:         fmt.Sprintf("%.6f", totalCost),
+			TaxesOutputs: FacturaeTaxes{Tax: []FacturaeTax{{
+				TaxTypeCode: "01",
+				TaxRate:     fmt.Sprintf("%.2f", d.VatPercent),
+				TaxableBase: FacturaeAmount{TotalAmount: fmt.Sprintf("%.2f", totalCost)},
+				TaxAmount:   FacturaeAmount{TotalAmount: fmt.Sprintf("%.2f", totalCost*(d.VatPercent/100))},
+			}}},
+		}
+		if d.Product != nil {
+			if len(line.ItemDescription) == 0 {
+				line.ItemDescription = d.Product.Name
+			}
+			line.ArticleCode = d.Product.Reference
+		}
+		lines = append(lines, line)
+	}
+
+	vatPercents := make([]float64, 0)
+	for vatPercent := range taxableBases {
+		vatPercents = append(vatPercents, vatPercent)
+	}
+	sort.Float64s(vatPercents)
+	taxes := make([]FacturaeTax, 0)
+	var totalTaxOutputs float64
+	for i := 0; i < len(vatPercents); i++ {
+		taxAmount := roundFacturaeAmount(taxableBases[vatPercents[i]] * (vatPercents[i] / 100))
+		totalTaxOutputs += taxAmount
+		taxes = append(taxes, FacturaeTax{
+			TaxTypeCode: "01",
+			TaxRate:     fmt.Sprintf("%.2f", vatPercents[i]),
+			TaxableBase: FacturaeAmount{TotalAmount: fmt.Sprintf("%.2f", taxableBases[vatPercents[i]])},
+			TaxAmount:   FacturaeAmount{TotalAmount: fmt.Sprintf("%.2f", taxAmount)},
+		})
+	}
+
+	// discounts and shipping of the invoice
+	totalGrossAmount = roundFacturaeAmount(totalGrossAmount)
+	discounts := make([]FacturaeDiscount, 0)
+	var totalGeneralDiscounts float64
+	if invoice.DiscountPercent != 0 {
+		discountAmount := roundFacturaeAmount(totalGrossAmount * (invoice.DiscountPercent / 100))
+		totalGeneralDiscounts += discountAmount
+		discounts = append(discounts, FacturaeDiscount{DiscountReason: "Descuento", DiscountRate: fmt.Sprintf("%.4f", invoice.DiscountPercent), DiscountAmount: fmt.Sprintf("%.2f", discountAmount)})
+	}
+	if invoice.FixDiscount != 0 {
+		totalGeneralDiscounts += roundFacturaeAmount(invoice.FixDiscount)
+		discounts = append(discounts, FacturaeDiscount{DiscountReason: "Descuento", DiscountAmount: fmt.Sprintf("%.2f", invoice.FixDiscount)})
+	}
+	if invoice.ShippingDiscount != 0 {
+		totalGeneralDiscounts += roundFacturaeAmount(invoice.ShippingDiscount)
+		discounts = append(discounts, FacturaeDiscount{DiscountReason: "Descuento en portes", DiscountAmount: fmt.Sprintf("%.2f", invoice.ShippingDiscount)})
+	}
+	var totalGeneralSurcharges float64
+	if invoice.ShippingPrice != 0 {
+		totalGeneralSurcharges = roundFacturaeAmount(invoice.ShippingPrice)
+	}
+	totalGrossAmountBeforeTaxes := roundFacturaeAmount(totalGrossAmount - totalGeneralDiscounts + totalGeneralSurcharges)
+	invoiceTotal := roundFacturaeAmount(totalGrossAmountBeforeTaxes + totalTaxOutputs)
+
+	totals := FacturaeInvoiceTotals{
+		TotalGrossAmount:            fmt.Sprintf("%.2f", totalGrossAmount),
+		TotalGeneralDiscounts:       fmt.Sprintf("%.2f", totalGeneralDiscounts),
+		TotalGeneralSurcharges:      fmt.Sprintf("%.2f", totalGeneralSurcharges),
+		TotalGrossAmountBeforeTaxes: fmt.Sprintf("%.2f", totalGrossAmountBeforeTaxes),
+		TotalTaxOutputs:             fmt.Sprintf("%.2f", totalTaxOutputs),
+		TotalTaxesWithheld:          fmt.Sprintf("%.2f", 0.0),
+		InvoiceTotal:                fmt.Sprintf("%.2f", invoiceTotal),
+		TotalOutstandingAmount:      fmt.Sprintf("%.2f", invoiceTotal),
+		TotalExecutableAmount:       fmt.Sprintf("%.2f", invoiceTotal),
+	}
+	if len(discounts) > 0 {
+		totals.GeneralDiscounts = &FacturaeDiscounts{Discount: discounts}
+	}
+	if totalGeneralSurcharges != 0 {
+		totals.GeneralSurcharges = &FacturaeCharges{Charge: []FacturaeCharge{{ChargeReason: "Portes", ChargeAmount: fmt.Sprintf("%.2f", totalGeneralSurcharges)}}}
+	}
+
+	// header
+	header := FacturaeInvoiceHeader{
+		InvoiceNumber:       strings.TrimSpace(invoice.InvoiceName),
+		InvoiceSeriesCode:   invoice.BillingSeriesId,
+		InvoiceDocumentType: "FC",
+		InvoiceClass:        "OO",
+	}
+	if invoice.SimplifiedInvoice {
+		header.InvoiceDocumentType = "FA"
+	}
+	if invoice.Amending && invoice.AmendedInvoiceId != nil {
+		amendedInvoice := getSalesInvoiceRow(*invoice.AmendedInvoiceId)
+		periodStart := time.Date(amendedInvoice.DateCreated.Year(), amendedInvoice.DateCreated.Month(), 1, 0, 0, 0, 0, amendedInvoice.DateCreated.Location())
+		header.InvoiceClass = "OR"
+		header.Corrective = &FacturaeCorrective{
+			InvoiceNumber:               strings.TrimSpace(amendedInvoice.InvoiceName),
+			InvoiceSeriesCode:           amendedInvoice.BillingSeriesId,
+			ReasonCode:                  "16",
+			ReasonDescription:           "Base imponible",
+			TaxPeriod:                   FacturaePeriod{StartDate: periodStart.Format("2006-01-02"), EndDate: periodStart.AddDate(0, 1, -1).Format("2006-01-02")},
+			CorrectionMethod:            "02",
+			CorrectionMethodDescription: "Rectificación por diferencias",
+		}
+	}
+
+	issueData := FacturaeInvoiceIssueData{
+		IssueDate:           invoice.DateCreated.Format("2006-01-02"),
+		InvoiceCurrencyCode: invoice.Currency.IsoCode,
+		TaxCurrencyCode:     "EUR",
+		LanguageName:        "es",
+	}
+	if invoice.Currency.IsoCode != "EUR" {
+		issueData.ExchangeRateDetails = &FacturaeExchangeRateDetails{ExchangeRate: fmt.Sprintf("%.6f", invoice.CurrencyChange), ExchangeRateDate: invoice.DateCreated.Format("2006-01-02")}
+	}
+
+	fileHeader := FacturaeFileHeader{
+		SchemaVersion:     "3.2.2",
+		Modality:          "I",
+		InvoiceIssuerType: "EM",
+		Batch: FacturaeBatch{
+			BatchIdentifier:        settings.EnterpriseTaxId + strings.TrimSpace(invoice.InvoiceName),
+			InvoicesCount:          1,
+			TotalInvoicesAmount:    FacturaeAmount{TotalAmount: totals.InvoiceTotal},
+			TotalOutstandingAmount: FacturaeAmount{TotalAmount: totals.TotalOutstandingAmount},
+			TotalExecutableAmount:  FacturaeAmount{TotalAmount: totals.TotalExecutableAmount},
+			InvoiceCurrencyCode:    invoice.Currency.IsoCode,
+		},
+	}
+	parties := FacturaeParties{SellerParty: seller, BuyerParty: buyer}
+	invoices := FacturaeInvoices{Invoice: []FacturaeInvoice{{
+		InvoiceHeader:    header,
+		InvoiceIssueData: issueData,
+		TaxesOutputs:     FacturaeTaxes{Tax: taxes},
+		InvoiceTotals:    totals,
+		Items:            FacturaeItems{InvoiceLine: lines},
+	}}}
+
+	document := ""
+	for _, element := range []interface{}{fileHeader, parties, invoices} {
+		data, err := xml.Marshal(element)
+		if err != nil {
+			log("Facturae", err.Error())
+			return nil, OkAndErrorCodeReturn{Ok: false}
+		}
+		document += string(data)
+	}
+	document = canonicalFacturaeText(document)
+
+	if len(settings.FacturaeCertificate) > 0 {
+		cert, key, err := loadFacturaeCertificate(settings.FacturaeCertificate, settings.FacturaeCertificatePassword)
+		if err != nil {
+			log("Facturae", err.Error())
+			return nil, OkAndErrorCodeReturn{Ok: false, ErrorCode: 4}
+		}
+		document, err = signFacturae(document, cert, key, time.Now())
+		if err != nil {
+			log("Facturae", err.Error())
+			return nil, OkAndErrorCodeReturn{Ok: false, ErrorCode: 4}
+		}
+	} else {
+		document = "<fe:Facturae" + FACTURAE_NAMESPACE_DECLARATIONS + ">" + document + "</fe:Facturae>"
+	}
+
+	return []byte(xml.Header + document), OkAndErrorCodeReturn{Ok: true}
+}
+
+// Sets the name and the address of the party as a legal entity or as an individual depending on the person type.
+func (b *FacturaeBusiness) setName(name string, tradeName string, addressInSpain *FacturaeAddressInSpain, overseasAddress *FacturaeOverseasAddress) {
+	if b.TaxIdentification.PersonTypeCode == "F" {
+		// the name of the individuals is written as "Name Surnames"
+		firstName := strings.TrimSpace(name)
+		surname := firstName
+		if index := strings.Index(firstName, " "); index > 0 {
+			surname = strings.TrimSpace(firstName[index+1:])
+			firstName = firstName[:index]
+		}
+		b.Individual = &FacturaeIndividual{Name: firstName, FirstSurname: surname, AddressInSpain: addressInSpain, OverseasAddress: overseasAddress}
+	} else {
+		if tradeName == name {
+			tradeName = ""
+		}
+		b.LegalEntity = &FacturaeLegalEntity{CorporateName: name, TradeName: tradeName, AddressInSpain: addressInSpain, OverseasAddress: overseasAddress}
+	}
+}
+
+// The Spanish tax IDs of the individuals start with a number (DNI) or with X, Y, Z, K, L or M (NIE and special NIF).
+// The companies start with any other letter.
+func facturaePersonTypeCode(taxId string) string {
+	taxId = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(taxId)), "ES")
+	if len(taxId) == 0 || strings.ContainsAny(taxId[:1], "0123456789XYZKLM") {
+		return "F"
+	}
+	return "J"
+}
+
+func facturaeResidenceTypeCode(countryZone string) string {
+	switch countryZone {
+	case "U":
+		return "U"
+	case "E":
+		return "E"
+	default:
+		return "R"
+	}
+}
+
+// Returns the address in Spain for the Spanish addresses, or the overseas address for all other countries.
+func facturaeAddress(address string, zipCode string, city string, province string, country Country) (*FacturaeAddressInSpain, *FacturaeOverseasAddress) {
+	if country.Iso3 == "ESP" {
+		return &FacturaeAddressInSpain{Address: address, PostCode: zipCode, Town: city, Province: province, CountryCode: country.Iso3}, nil
+	} else {
+		return nil, &FacturaeOverseasAddress{Address: address, PostCodeAndTown: strings.TrimSpace(zipCode + " " + city), Province: province, CountryCode: country.Iso3}
+	}
+}
+
+func roundFacturaeAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// encoding/xml escapes the quotes, the tabs and the line breaks in the text, but the canonical XML writes them as they are.
+// The XML is kept in the canonical form, so the digests of the signature can be calculated over the same text that is written in the file.
+func canonicalFacturaeText(document string) string {
+	return strings.NewReplacer("&#34;", "\"", "&#39;", "'", "&#x9;", "\t", "&#xA;", "\n").Replace(document)
+}
+
+// Escapes the text of the signature elements as in the canonical XML.
+func escapeFacturaeText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;").Replace(text)
+}
+
+// Reads the PKCS#12 file (encoded in base64) of the settings, and returns the RSA private key and the certificate of the key.
+func loadFacturaeCertificate(certificate string, password string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	data, err := base64.StdEncoding.DecodeString(certificate)
+	if err != nil {
+		return nil, nil, err
+	}
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var key *rsa.PrivateKey
+	certificates := make([]*x509.Certificate, 0)
+	for i := 0; i < len(blocks); i++ {
+		switch blocks[i].Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(blocks[i].Bytes)
+			if err != nil {
+				return nil, nil, errors.New("only RSA keys can sign the Facturae invoices")
+			}
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(blocks[i].Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			certificates = append(certificates, cert)
+		}
+	}
+	if key == nil {
+		return nil, nil, errors.New("the certificate file does not contain a private key")
+	}
+
+	// the file can contain the certification chain, search the certificate of the key
+	for i := 0; i < len(certificates); i++ {
+		publicKey, ok := certificates[i].PublicKey.(*rsa.PublicKey)
+		if ok && publicKey.N.Cmp(key.N) == 0 && publicKey.E == key.E {
+			return certificates[i], key, nil
+		}
+	}
+	return nil, nil, errors.New("the certificate file does not contain the certificate of the private key")
+}
+
+// Signature policy of a XAdES-EPES signature
+type XAdESSignaturePolicy struct {
+	Identifier      string
+	Description     string
+	DigestAlgorithm string
+	DigestValue     string
+	ClaimedRole     string // Optional
+}
+
+var facturaeSignaturePolicy XAdESSignaturePolicy = XAdESSignaturePolicy{
+	Identifier:      FACTURAE_SIGNATURE_POLICY,
+	Description:     "Política de Firma FacturaE v3.1",
+	DigestAlgorithm: XMLDSIG_SHA1,
+	DigestValue:     FACTURAE_SIGNATURE_POLICY_HASH,
+	ClaimedRole:     "emisor",
+}
+
+// Signs the content of the Facturae document with an enveloped XAdES-EPES signature, using the Facturae signature policy.
+// The document must be in the canonical form, and it's returned inside of the root element with the signature at the end.
+func signFacturae(document string, cert *x509.Certificate, key *rsa.PrivateKey, signingTime time.Time) (string, error) {
+	signedDocument, _, err := signXAdES("fe:Facturae", FACTURAE_NAMESPACE_DECLARATIONS, document, facturaeSignaturePolicy, cert, key, signingTime)
+	return signedDocument, err
+}
+
+// Signs the content of the root element with an enveloped XAdES-EPES signature.
+// The namespace declarations of the root element must include the "ds" and "etsi" prefixes, sorted by prefix as in the canonical form.
+// Returns the signed document and the signature value in base64.
+func signXAdES(rootElement string, namespaces string, document string, policy XAdESSignaturePolicy, cert *x509.Certificate, key *rsa.PrivateKey, signingTime time.Time) (string, string, error) {
+	id := uuid.New().String()
+	signatureId := "Signature-" + id
+	signedInfoId := "SignedInfo-" + id
+	signedPropertiesId := "SignedProperties-" + id
+	documentReferenceId := "Reference-" + id
+
+	// the enveloped signature transform removes the signature from the document, so the digest is calculated without the signature
+	documentDigest := sha256.Sum256([]byte("<" + rootElement + namespaces + ">" + document + "</" + rootElement + ">"))
+	certDigest := sha256.Sum256(cert.Raw)
+
+	var signerRole string
+	if len(policy.ClaimedRole) > 0 {
+		signerRole = `<etsi:SignerRole><etsi:ClaimedRoles><etsi:ClaimedRole>` + escapeFacturaeText(policy.ClaimedRole) + `</etsi:ClaimedRole></etsi:ClaimedRoles></etsi:SignerRole>`
+	}
+	signedProperties := func(namespaces string) string {
+		return `<etsi:SignedProperties` + namespaces + ` Id="` + signedPropertiesId + `">` +
+			`<etsi:SignedSignatureProperties>` +
+			`<etsi:SigningTime>` + signingTime.Format(time.RFC3339) + `</etsi:SigningTime>` +
+			`<etsi:SigningCertificate><etsi:Cert>` +
+			`<etsi:CertDigest><ds:DigestMethod Algorithm="` + XMLENC_SHA256 + `"></ds:DigestMethod><ds:DigestValue>` + base64.StdEncoding.EncodeToString(certDigest[:]) + `</ds:DigestValue></etsi:CertDigest>` +
+			`<etsi:IssuerSerial><ds:X509IssuerName>` + escapeFacturaeText(cert.Issuer.String()) + `</ds:X509IssuerName><ds:X509SerialNumber>` + cert.SerialNumber.String() + `</ds:X509SerialNumber></etsi:IssuerSerial>` +
+			`</etsi:Cert></etsi:SigningCertificate>` +
+			`<etsi:SignaturePolicyIdentifier><etsi:SignaturePolicyId>` +
+			`<etsi:SigPolicyId><etsi:Identifier>` + policy.Identifier + `</etsi:Identifier><etsi:Description>` + escapeFacturaeText(policy.Description) + `</etsi:Description></etsi:SigPolicyId>` +
+			`<etsi:SigPolicyHash><ds:DigestMethod Algorithm="` + policy.DigestAlgorithm + `"></ds:DigestMethod><ds:DigestValue>` + policy.DigestValue + `</ds:DigestValue></etsi:SigPolicyHash>` +
+			`</etsi:SignaturePolicyId></etsi:SignaturePolicyIdentifier>` +
+			signerRole +
+			`</etsi:SignedSignatureProperties>` +
+			`<etsi:SignedDataObjectProperties><etsi:DataObjectFormat ObjectReference="#` + documentReferenceId + `">` +
+			`<etsi:Description>Factura electrónica</etsi:Description><etsi:MimeType>text/xml</etsi:MimeType>` +
+			`</etsi:DataObjectFormat></etsi:SignedDataObjectProperties>` +
+			`</etsi:SignedProperties>`
+	}
+	signedPropertiesDigest := sha256.Sum256([]byte(signedProperties(namespaces)))
+
+	signedInfo := func(namespaces string) string {
+		return `<ds:SignedInfo` + namespaces + ` Id="` + signedInfoId + `">` +
+			`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/TR/2001/REC-xml-c14n-20010315"></ds:CanonicalizationMethod>` +
+			`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"></ds:SignatureMethod>` +
+			`<ds:Reference Id="` + documentReferenceId + `" URI="">` +
+			`<ds:Transforms><ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"></ds:Transform></ds:Transforms>` +
+			`<ds:DigestMethod Algorithm="` + XMLENC_SHA256 + `"></ds:DigestMethod><ds:DigestValue>` + base64.StdEncoding.EncodeToString(documentDigest[:]) + `</ds:DigestValue>` +
+			`</ds:Reference>` +
+			`<ds:Reference Type="http://uri.etsi.org/01903#SignedProperties" URI="#` + signedPropertiesId + `">` +
+			`<ds:DigestMethod Algorithm="` + XMLENC_SHA256 + `"></ds:DigestMethod><ds:DigestValue>` + base64.StdEncoding.EncodeToString(signedPropertiesDigest[:]) + `</ds:DigestValue>` +
+			`</ds:Reference>` +
+			`</ds:SignedInfo>`
+	}
+	signedInfoDigest := sha256.Sum256([]byte(signedInfo(namespaces)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, signedInfoDigest[:])
+	if err != nil {
+		return "", "", err
+	}
+	signatureValue := base64.StdEncoding.EncodeToString(signature)
+
+	signatureElement := `<ds:Signature Id="` + signatureId + `">` +
+		signedInfo("") +
+		`<ds:SignatureValue>` + signatureValue + `</ds:SignatureValue>` +
+		`<ds:KeyInfo><ds:X509Data><ds:X509Certificate>` + base64.StdEncoding.EncodeToString(cert.Raw) + `</ds:X509Certificate></ds:X509Data></ds:KeyInfo>` +
+		`<ds:Object><etsi:QualifyingProperties Target="#` + signatureId + `">` + signedProperties("") + `</etsi:QualifyingProperties></ds:Object>` +
+		`</ds:Signature>`
+
+	return "<" + rootElement + namespaces + ">" + document + signatureElement + "</" + rootElement + ">", signatureValue, nil
+}
+
+func reportSalesInvoiceFacturae(id int, enterpriseId int32) []byte {
+	document, result := generateSalesInvoiceFacturae(int64(id), enterpriseId)
+	if !result.Ok {
+		return nil
+	}
+	return document
+}
@@ -0,0 +1,417 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// THIS FILE CONTAINS THE FACTUR-X (ZUGFERD) INVOICES: A PDF/A-3 DOCUMENT OF THE SALES INVOICE WITH THE CII XML OF THE EN 16931 PROFILE EMBEDDED.
+
+const CII_RSM_NAMESPACE = "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+const CII_RAM_NAMESPACE = "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100"
+const CII_UDT_NAMESPACE = "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100"
+const CII_QDT_NAMESPACE = "urn:un:unece:uncefact:data:standard:QualifiedDataType:100"
+const FACTURX_EN16931_GUIDELINE = "urn:cen.eu:en16931:2017"
+const FACTURX_FILE_NAME = "factur-x.xml"
+
+// Factur-X extension schema of the XMP metadata of the PDF document
+const FACTURX_XMP_EXTENSION = `<rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+<pdfaExtension:schemas><rdf:Bag><rdf:li rdf:parseType="Resource">
+<pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>
+<pdfaSchema:namespaceURI>urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#</pdfaSchema:namespaceURI>
+<pdfaSchema:prefix>fx</pdfaSchema:prefix>
+<pdfaSchema:property><rdf:Seq>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>DocumentFileName</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>The name of the embedded XML document</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>DocumentType</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>The type of the hybrid document in capital letters, e.g. INVOICE or ORDER</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>Version</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>The actual version of the standard applying to the embedded XML document</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>ConformanceLevel</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>The conformance level of the embedded XML document</pdfaProperty:description></rdf:li>
+</rdf:Seq></pdfaSchema:property>
+</rdf:li></rdf:Bag></pdfaExtension:schemas>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#"><fx:DocumentType>INVOICE</fx:DocumentType><fx:DocumentFileName>` + FACTURX_FILE_NAME + `</fx:DocumentFileName><fx:Version>1.0</fx:Version><fx:ConformanceLevel>EN 16931</fx:ConformanceLevel></rdf:Description>
+`
+
+type CIIInvoice struct {
+	XMLName     xml.Name      `xml:"rsm:CrossIndustryInvoice"`
+	XmlnsRsm    string        `xml:"xmlns:rsm,attr"`
+	XmlnsRam    string        `xml:"xmlns:ram,attr"`
+	XmlnsUdt    string        `xml:"xmlns:udt,attr"`
+	XmlnsQdt    string        `xml:"xmlns:qdt,attr"`
+	GuidelineID string        `xml:"rsm:ExchangedDocumentContext>ram:GuidelineSpecifiedDocumentContextParameter>ram:ID"`
+	ID          string        `xml:"rsm:ExchangedDocument>ram:ID"`
+	TypeCode    string        `xml:"rsm:ExchangedDocument>ram:TypeCode"` // 380 = Commercial invoice, 381 = Credit note
+	IssueDate   CIIDate       `xml:"rsm:ExchangedDocument>ram:IssueDateTime>udt:DateTimeString"`
+	LineItems   []CIILineItem `xml:"rsm:SupplyChainTradeTransaction>ram:IncludedSupplyChainTradeLineItem"`
+	Agreement   CIIAgreement  `xml:"rsm:SupplyChainTradeTransaction>ram:ApplicableHeaderTradeAgreement"`
+	Delivery    string        `xml:"rsm:SupplyChainTradeTransaction>ram:ApplicableHeaderTradeDelivery"`
+	Settlement  CIISettlement `xml:"rsm:SupplyChainTradeTransaction>ram:ApplicableHeaderTradeSettlement"`
+}
+
+type CIIDate struct {
+	Format string `xml:"format,attr"` // 102 = YYYYMMDD
+	Value  string `xml:",chardata"`
+}
+
+type CIILineItem struct {
+	LineID          string         `xml:"ram:AssociatedDocumentLineDocument>ram:LineID"`
+	GlobalID        *CIIIdentifier `xml:"ram:SpecifiedTradeProduct>ram:GlobalID,omitempty"`
+	SellerAssigned  *string        `xml:"ram:SpecifiedTradeProduct>ram:SellerAssignedID,omitempty"`
+	Name            string         `xml:"ram:SpecifiedTradeProduct>ram:Name"`
+	NetPrice        string         `xml:"ram:SpecifiedLineTradeAgreement>ram:NetPriceProductTradePrice>ram:ChargeAmount"`
+	BilledQuantity  CIIQuantity    `xml:"ram:SpecifiedLineTradeDelivery>ram:BilledQuantity"`
+	TradeTax        CIITradeTax    `xml:"ram:SpecifiedLineTradeSettlement>ram:ApplicableTradeTax"`
+	LineTotalAmount string         `xml:"ram:SpecifiedLineTradeSettlement>ram:SpecifiedTradeSettlementLineMonetarySummation>ram:LineTotalAmount"`
+}
+
+type CIIIdentifier struct {
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type CIIQuantity struct {
+	UnitCode string `xml:"unitCode,attr"` // C62 = One (units)
+	Value    string `xml:",chardata"`
+}
+
+type CIITradeTax struct {
+	CalculatedAmount    string `xml:"ram:CalculatedAmount,omitempty"`
+	TypeCode            string `xml:"ram:TypeCode"`
+	BasisAmount         string `xml:"ram:BasisAmount,omitempty"`
+	CategoryCode        string `xml:"ram:CategoryCode"`
+	ExemptionReasonCode string `xml:"ram:ExemptionReasonCode,omitempty"`
+	RatePercent         string `xml:"ram:RateApplicablePercent"`
+}
+
+type CIIAgreement struct {
+	BuyerReference string   `xml:"ram:BuyerReference"`
+	Seller         CIIParty `xml:"ram:SellerTradeParty"`
+	Buyer          CIIParty `xml:"ram:BuyerTradeParty"`
+}
+
+type CIIParty struct {
+	Name            string         `xml:"ram:Name"`
+	Address         CIIAddress     `xml:"ram:PostalTradeAddress"`
+	URIID           *CIIIdentifier `xml:"ram:URIUniversalCommunication>ram:URIID,omitempty"`
+	TaxRegistration *CIIIdentifier `xml:"ram:SpecifiedTaxRegistration>ram:ID,omitempty"`
+}
+
+type CIIAddress struct {
+	PostcodeCode           string `xml:"ram:PostcodeCode,omitempty"`
+	LineOne                string `xml:"ram:LineOne,omitempty"`
+	LineTwo                string `xml:"ram:LineTwo,omitempty"`
+	CityName               string `xml:"ram:CityName,omitempty"`
+	CountryID              string `xml:"ram:CountryID"`
+	CountrySubDivisionName string `xml:"ram:CountrySubDivisionName,omitempty"`
+}
+
+type CIISettlement struct {
+	InvoiceCurrencyCode string                 `xml:"ram:InvoiceCurrencyCode"`
+	TradeTaxes          []CIITradeTax          `xml:"ram:ApplicableTradeTax"`
+	AllowanceCharges    []CIIAllowanceCharge   `xml:"ram:SpecifiedTradeAllowanceCharge"`
+	PaymentTerms        *CIIPaymentTerms       `xml:"ram:SpecifiedTradePaymentTerms,omitempty"`
+	Summation           CIIMonetarySummation   `xml:"ram:SpecifiedTradeSettlementHeaderMonetarySummation"`
+	ReferencedDocument  *CIIReferencedDocument `xml:"ram:InvoiceReferencedDocument,omitempty"`
+}
+
+type CIIAllowanceCharge struct {
+	ChargeIndicator bool        `xml:"ram:ChargeIndicator>udt:Indicator"`
+	ActualAmount    string      `xml:"ram:ActualAmount"`
+	Reason          string      `xml:"ram:Reason"`
+	TradeTax        CIITradeTax `xml:"ram:CategoryTradeTax"`
+}
+
+type CIIPaymentTerms struct {
+	Description string   `xml:"ram:Description,omitempty"`
+	DueDate     *CIIDate `xml:"ram:DueDateDateTime>udt:DateTimeString,omitempty"`
+}
+
+type CIIMonetarySummation struct {
+	LineTotalAmount      string    `xml:"ram:LineTotalAmount"`
+	ChargeTotalAmount    string    `xml:"ram:ChargeTotalAmount"`
+	AllowanceTotalAmount string    `xml:"ram:AllowanceTotalAmount"`
+	TaxBasisTotalAmount  string    `xml:"ram:TaxBasisTotalAmount"`
+	TaxTotalAmount       UBLAmount `xml:"ram:TaxTotalAmount"`
+	GrandTotalAmount     string    `xml:"ram:GrandTotalAmount"`
+	DuePayableAmount     string    `xml:"ram:DuePayableAmount"`
+}
+
+type CIIReferencedDocument struct {
+	IssuerAssignedID string  `xml:"ram:IssuerAssignedID"`
+	IssueDate        CIIDate `xml:"ram:FormattedIssueDateTime>qdt:DateTimeString"`
+}
+
+// Returns the CII XML of the sales invoice with the EN 16931 profile of Factur-X.
+// ERROR CODES:
+// 1. The enterprise has no tax ID or country in the settings
+// 2. The invoice has no details
+func generateSalesInvoiceCII(invoiceId int64, enterpriseId int32) ([]byte, OkAndErrorCodeReturn) {
+	e, result := getEN16931Invoice(invoiceId, enterpriseId)
+	if !result.Ok {
+		return nil, result
+	}
+	invoice := e.Invoice
+	settings := e.Settings
+	address := e.Address
+	currency := invoice.Currency.IsoCode
+
+	cii := CIIInvoice{
+		XmlnsRsm:    CII_RSM_NAMESPACE,
+		XmlnsRam:    CII_RAM_NAMESPACE,
+		XmlnsUdt:    CII_UDT_NAMESPACE,
+		XmlnsQdt:    CII_QDT_NAMESPACE,
+		GuidelineID: FACTURX_EN16931_GUIDELINE,
+		ID:          strings.TrimSpace(invoice.InvoiceName),
+		TypeCode:    "380",
+		IssueDate:   CIIDate{Format: "102", Value: invoice.DateCreated.Format("20060102")},
+	}
+
+	// lines
+	for i := 0; i < len(e.Lines); i++ {
+		l := e.Lines[i]
+		item := CIILineItem{
+			LineID:          strconv.Itoa(i + 1),
+			Name:            l.Name,
+			NetPrice:        strconv.FormatFloat(l.Price, 'f', -1, 64),
+			BilledQuantity:  CIIQuantity{UnitCode: "C62", Value: formatQuantity(l.Detail.Quantity)},
+			TradeTax:        ciiTradeTax(l.TaxCategory),
+			LineTotalAmount: fmt.Sprintf("%.2f", l.Amount),
+		}
+		if l.Detail.Product != nil {
+			if len(strings.TrimSpace(l.Detail.Product.BarCode)) > 0 {
+				item.GlobalID = &CIIIdentifier{SchemeID: "0160", Value: strings.TrimSpace(l.Detail.Product.BarCode)} // 0160 = GTIN
+			}
+			if len(l.Detail.Product.Reference) > 0 {
+				item.SellerAssigned = &l.Detail.Product.Reference
+			}
+		}
+		cii.LineItems = append(cii.LineItems, item)
+	}
+
+	// parties
+	cii.Agreement = CIIAgreement{
+		BuyerReference: e.BuyerReference,
+		Seller: CIIParty{
+			Name:            settings.EnterpriseName,
+			Address:         CIIAddress{PostcodeCode: settings.EnterpriseZipCode, LineOne: settings.EnterpriseAddress, CityName: settings.EnterpriseCity, CountryID: settings.EnterpriseCountry.Iso2, CountrySubDivisionName: settings.EnterpriseProvince},
+			TaxRegistration: &CIIIdentifier{SchemeID: "VA", Value: en16931VatNumber(settings.EnterpriseTaxId, settings.EnterpriseCountry.Iso2)},
+		},
+		Buyer: CIIParty{
+			Name:    e.CustomerName,
+			Address: CIIAddress{PostcodeCode: address.ZipCode, LineOne: address.Address, LineTwo: address.Address2, CityName: address.City, CountryID: address.Country.Iso2},
+		},
+	}
+	if address.State != nil {
+		cii.Agreement.Buyer.Address.CountrySubDivisionName = address.State.Name
+	}
+	if endpoint := ublEndpointId(settings.EnterpriseTaxId, settings.EnterpriseCountry.Iso2); endpoint != nil {
+		cii.Agreement.Seller.URIID = &CIIIdentifier{SchemeID: endpoint.SchemeID, Value: endpoint.Value}
+	}
+	if len(e.CustomerVatNumber) > 0 {
+		if endpoint := ublEndpointId(e.CustomerVatNumber, address.Country.Iso2); endpoint != nil {
+			cii.Agreement.Buyer.URIID = &CIIIdentifier{SchemeID: endpoint.SchemeID, Value: endpoint.Value}
+		}
+		cii.Agreement.Buyer.TaxRegistration = &CIIIdentifier{SchemeID: "VA", Value: en16931VatNumber(e.CustomerVatNumber, address.Country.Iso2)}
+	}
+
+	// settlement
+	cii.Settlement.InvoiceCurrencyCode = currency
+	for i := 0; i < len(e.TaxSubtotals); i++ {
+		t := e.TaxSubtotals[i]
+		tradeTax := ciiTradeTax(t.TaxCategory)
+		tradeTax.CalculatedAmount = fmt.Sprintf("%.2f", t.TaxAmount)
+		tradeTax.BasisAmount = fmt.Sprintf("%.2f", t.TaxableAmount)
+		cii.Settlement.TradeTaxes = append(cii.Settlement.TradeTaxes, tradeTax)
+	}
+	for i := 0; i < len(e.Allowances); i++ {
+		a := e.Allowances[i]
+		cii.Settlement.AllowanceCharges = append(cii.Settlement.AllowanceCharges, CIIAllowanceCharge{ChargeIndicator: a.Charge, ActualAmount: fmt.Sprintf("%.2f", a.Amount), Reason: a.Reason, TradeTax: ciiTradeTax(a.TaxCategory)})
+	}
+	if invoice.Amending {
+		cii.TypeCode = "381"
+		if e.AmendedInvoice != nil {
+			cii.Settlement.ReferencedDocument = &CIIReferencedDocument{IssuerAssignedID: strings.TrimSpace(e.AmendedInvoice.InvoiceName), IssueDate: CIIDate{Format: "102", Value: e.AmendedInvoice.DateCreated.Format("20060102")}}
+		}
+		if len(invoice.PaymentMethod.Name) > 0 {
+			cii.Settlement.PaymentTerms = &CIIPaymentTerms{Description: invoice.PaymentMethod.Name}
+		}
+	} else {
+		dueDate := CIIDate{Format: "102", Value: invoice.DateCreated.AddDate(0, 0, int(invoice.PaymentMethod.DaysExpiration)).Format("20060102")}
+		cii.Settlement.PaymentTerms = &CIIPaymentTerms{Description: invoice.PaymentMethod.Name, DueDate: &dueDate}
+	}
+	cii.Settlement.Summation = CIIMonetarySummation{
+		LineTotalAmount:      fmt.Sprintf("%.2f", e.LineTotalAmount),
+		ChargeTotalAmount:    fmt.Sprintf("%.2f", e.ChargeTotal),
+		AllowanceTotalAmount: fmt.Sprintf("%.2f", e.AllowanceTotal),
+		TaxBasisTotalAmount:  fmt.Sprintf("%.2f", e.TaxExclusiveAmount),
+		TaxTotalAmount:       ublAmount(e.TaxTotal, currency),
+		GrandTotalAmount:     fmt.Sprintf("%.2f", e.TaxInclusiveAmount),
+		DuePayableAmount:     fmt.Sprintf("%.2f", e.TaxInclusiveAmount),
+	}
+
+	data, err := xml.Marshal(cii)
+	if err != nil {
+		log("FACTURX", err.Error())
+		return nil, OkAndErrorCodeReturn{Ok: false}
+	}
+	return []byte(xml.Header + string(data)), OkAndErrorCodeReturn{Ok: true}
+}
+
+func ciiTradeTax(taxCategory EN16931TaxCategory) CIITradeTax {
+	return CIITradeTax{TypeCode: "VAT", CategoryCode: taxCategory.Code, ExemptionReasonCode: en16931TaxExemptionReasonCode(taxCategory.Code), RatePercent: formatEN16931Percent(taxCategory.Percent)}
+}
+
+// Returns the Factur-X PDF/A-3 document of the sales invoice, with the CII XML embedded.
+// ERROR CODES:
+// 1. The enterprise has no tax ID or country in the settings
+// 2. The invoice has no details
+// 3. There is no TrueType font to embed in the document ("pdfFontPath" in config.json), so it can't be a PDF/A-3 document
+func generateSalesInvoiceFacturX(invoiceId int64, enterpriseId int32) ([]byte, OkAndErrorCodeReturn) {
+	document, result := generateSalesInvoiceCII(invoiceId, enterpriseId)
+	if !result.Ok {
+		return nil, result
+	}
+	e, result := getEN16931Invoice(invoiceId, enterpriseId)
+	if !result.Ok {
+		return nil, result
+	}
+	invoice := e.Invoice
+	settings := e.Settings
+	currency := invoice.Currency.IsoCode
+
+	pdf := newPDFDocument(strings.TrimSpace(invoice.InvoiceName))
+	if !pdf.isFontEmbedded() {
+		return nil, OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+	pdf.XMPExtension = FACTURX_XMP_EXTENSION
+	pdf.attachFile(PDFAttachment{FileName: FACTURX_FILE_NAME, Description: "Factur-X invoice", MimeType: "text/xml", Relationship: "Data", Content: document, DateModified: pdf.DateCreated})
+
+	const left = 50
+	const right = PDF_PAGE_WIDTH - 50
+	page := pdf.addPage()
+
+	// header: the enterprise at the left, and the invoice at the right
+	title := "INVOICE"
+	if invoice.Amending {
+		title = "CREDIT NOTE"
+	}
+	var y float64 = PDF_PAGE_HEIGHT - 60
+	page.text(left, y, 14, settings.EnterpriseName)
+	page.textRight(right, y, 14, title)
+	enterpriseLines := []string{settings.EnterpriseAddress, strings.TrimSpace(settings.EnterpriseZipCode + " " + settings.EnterpriseCity), settings.EnterpriseProvince, settings.EnterpriseCountry.Name, en16931VatNumber(settings.EnterpriseTaxId, settings.EnterpriseCountry.Iso2)}
+	invoiceLines := []string{"Number: " + strings.TrimSpace(invoice.InvoiceName), "Date: " + invoice.DateCreated.Format("2006-01-02")}
+	if invoice.Amending && e.AmendedInvoice != nil {
+		invoiceLines = append(invoiceLines, "Amended invoice: "+strings.TrimSpace(e.AmendedInvoice.InvoiceName))
+	} else if !invoice.Amending {
+		invoiceLines = append(invoiceLines, "Due date: "+invoice.DateCreated.AddDate(0, 0, int(invoice.PaymentMethod.DaysExpiration)).Format("2006-01-02"))
+	}
+	invoiceLines = append(invoiceLines, "Payment method: "+invoice.PaymentMethod.Name)
+	y -= 18
+	for i := 0; i < len(enterpriseLines) || i < len(invoiceLines); i++ {
+		if i < len(enterpriseLines) {
+			page.text(left, y, 9, enterpriseLines[i])
+		}
+		if i < len(invoiceLines) {
+			page.textRight(right, y, 9, invoiceLines[i])
+		}
+		y -= 12
+	}
+
+	// customer
+	y -= 14
+	page.text(left, y, 11, e.CustomerName)
+	y -= 14
+	address := e.Address
+	stateName := ""
+	if address.State != nil {
+		stateName = address.State.Name
+	}
+	customerLines := []string{address.Address, address.Address2, strings.TrimSpace(address.ZipCode + " " + address.City), stateName, address.Country.Name}
+	if len(e.CustomerVatNumber) > 0 {
+		customerLines = append(customerLines, en16931VatNumber(e.CustomerVatNumber, address.Country.Iso2))
+	}
+	for i := 0; i < len(customerLines); i++ {
+		if len(customerLines[i]) > 0 {
+			page.text(left, y, 9, customerLines[i])
+			y -= 12
+		}
+	}
+
+	// lines
+	detailsHeader := func() {
+		y -= 16
+		page.text(left, y, 9, "Description")
+		page.textRight(340, y, 9, "Quantity")
+		page.textRight(410, y, 9, "Price")
+		page.textRight(460, y, 9, "VAT %")
+		page.textRight(right, y, 9, "Amount")
+		y -= 5
+		page.line(left, y, right, y)
+		y -= 12
+	}
+	detailsHeader()
+	for i := 0; i < len(e.Lines); i++ {
+		if y < 60 {
+			page = pdf.addPage()
+			y = PDF_PAGE_HEIGHT - 40
+			detailsHeader()
+		}
+		l := e.Lines[i]
+		page.textCut(left, y, 9, 240, l.Name)
+		page.textRight(340, y, 9, formatQuantity(l.Detail.Quantity))
+		page.textRight(410, y, 9, fmt.Sprintf("%.2f", l.Price))
+		page.textRight(460, y, 9, formatEN16931Percent(l.TaxCategory.Percent))
+		page.textRight(right, y, 9, fmt.Sprintf("%.2f", l.Amount))
+		y -= 12
+	}
+
+	// totals
+	totals := make([][2]string, 0)
+	totals = append(totals, [2]string{"Total products", fmt.Sprintf("%.2f", e.LineTotalAmount)})
+	for i := 0; i < len(e.Allowances); i++ {
+		amount := e.Allowances[i].Amount
+		if !e.Allowances[i].Charge {
+			amount = -amount
+		}
+		totals = append(totals, [2]string{e.Allowances[i].Reason, fmt.Sprintf("%.2f", amount)})
+	}
+	for i := 0; i < len(e.TaxSubtotals); i++ {
+		t := e.TaxSubtotals[i]
+		totals = append(totals, [2]string{"VAT " + formatEN16931Percent(t.TaxCategory.Percent) + "% of " + fmt.Sprintf("%.2f", t.TaxableAmount), fmt.Sprintf("%.2f", t.TaxAmount)})
+	}
+	if y-float64(len(totals)+2)*12 < 40 {
+		page = pdf.addPage()
+		y = PDF_PAGE_HEIGHT - 40
+	}
+	y -= 5
+	page.line(340, y, right, y)
+	y -= 12
+	for i := 0; i < len(totals); i++ {
+		page.text(340, y, 9, totals[i][0])
+		page.textRight(right, y, 9, totals[i][1])
+		y -= 12
+	}
+	page.text(340, y-2, 11, "Total "+currency)
+	page.textRight(right, y-2, 11, fmt.Sprintf("%.2f", e.TaxInclusiveAmount))
+
+	return pdf.output(), OkAndErrorCodeReturn{Ok: true}
+}
+
+func reportSalesInvoiceFacturX(id int, enterpriseId int32) []byte {
+	document, result := generateSalesInvoiceFacturX(int64(id), enterpriseId)
+	if !result.Ok {
+		return nil
+	}
+	return document
+}
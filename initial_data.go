@@ -400,6 +400,36 @@ func initialReportTemplate(enterpriseId int32) {
 		return
 	}
 	ReportTemplate{EnterpriseId: enterpriseId, Key: "SALES_ORDER_DIGITAL_PRODUCT_DATA", Html: string(content)}.insertReportTemplate()
+
+	content, err = ioutil.ReadFile("./reports/sales_quotation.html")
+	if err != nil {
+		return
+	}
+	ReportTemplate{EnterpriseId: enterpriseId, Key: "SALES_QUOTATION", Html: string(content)}.insertReportTemplate()
+
+	content, err = ioutil.ReadFile("./reports/sales_agent_settlement.html")
+	if err != nil {
+		return
+	}
+	ReportTemplate{EnterpriseId: enterpriseId, Key: "SALES_AGENT_SETTLEMENT", Html: string(content)}.insertReportTemplate()
+
+	content, err = ioutil.ReadFile("./reports/statement_of_account.html")
+	if err != nil {
+		return
+	}
+	ReportTemplate{EnterpriseId: enterpriseId, Key: "STATEMENT_OF_ACCOUNT", Html: string(content)}.insertReportTemplate()
+
+	content, err = ioutil.ReadFile("./reports/aging.html")
+	if err != nil {
+		return
+	}
+	ReportTemplate{EnterpriseId: enterpriseId, Key: "AGING", Html: string(content)}.insertReportTemplate()
+
+	content, err = ioutil.ReadFile("./reports/request_for_quotation.html")
+	if err != nil {
+		return
+	}
+	ReportTemplate{EnterpriseId: enterpriseId, Key: "REQUEST_FOR_QUOTATION", Html: string(content)}.insertReportTemplate()
 }
 
 // check every permission in the initial data file agains the ones in the database
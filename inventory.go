@@ -143,6 +143,12 @@ func (i *Inventory) finishInventory(userId int32, enterpriseId int32) bool {
 			trans.Rollback()
 			return false
 		}
+
+		// stock of the storage locations, only if the product has been counted by location
+		ok = regularizeInventoryLocations(inMemoyInventory, p.ProductId, *trans)
+		if !ok {
+			return false
+		}
 	}
 
 	result := trans.Model(&Inventory{}).Where("id = ?", inMemoyInventory.Id).Updates(map[string]interface{}{
@@ -168,7 +174,7 @@ type InventoryProducts struct {
 	Product             Product            `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
 	EnterpriseId        int32              `json:"-" gorm:"column:enterprise;not null:true"`
 	Enterprise          Settings           `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
-	Quantity            int32              `json:"quantity" gorm:"column:quantity;not null:true"`
+	Quantity            float64            `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
 	WarehouseMovementId *int64             `json:"warehouseMovementId" gorm:"column:warehouse_movement"`
 	WarehouseMovement   *WarehouseMovement `json:"warehouseMovement" gorm:"foreignKey:WarehouseMovementId,EnterpriseId;references:Id,EnterpriseId"`
 }
@@ -218,6 +224,7 @@ func (input *InputInventoryProducts) insertUpdateDeleteInventoryProducts(enterpr
 		if !ip.isValid() {
 			return false
 		}
+		input.InventoryProducts[i].Quantity = roundProductQuantity(ip.ProductId, ip.Quantity)
 	}
 
 	///
@@ -276,7 +283,14 @@ func (input *InputInventoryProducts) insertUpdateDeleteInventoryProducts(enterpr
 
 	// delete the remaining data in the map
 	for k := range existentInventoryProducts {
-		result := trans.Delete(&InventoryProducts{}, "inventory = ? AND product = ?", input.Inventory, k)
+		result := trans.Delete(&InventoryProductLocation{}, "inventory = ? AND product = ?", input.Inventory, k)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+
+		result = trans.Delete(&InventoryProducts{}, "inventory = ? AND product = ?", input.Inventory, k)
 		if result.Error != nil {
 			log("DB", result.Error.Error())
 			trans.Rollback()
@@ -392,7 +406,13 @@ func (input *InputInventoryProducts) deleteAllProductsInventoryProducts(enterpri
 		return false
 	}
 
-	result := dbOrm.Model(&InventoryProducts{}).Where("inventory = ? AND enterprise = ?", input.Inventory, enterpriseId).Delete(InventoryProducts{})
+	result := dbOrm.Model(&InventoryProductLocation{}).Where("inventory = ? AND enterprise = ?", input.Inventory, enterpriseId).Delete(InventoryProductLocation{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	result = dbOrm.Model(&InventoryProducts{}).Where("inventory = ? AND enterprise = ?", input.Inventory, enterpriseId).Delete(InventoryProducts{})
 	if result.Error != nil {
 		log("DB", result.Error.Error())
 		return false
@@ -401,15 +421,18 @@ func (input *InputInventoryProducts) deleteAllProductsInventoryProducts(enterpri
 }
 
 type BarCodeInputInventoryProducts struct {
-	Inventory int32  `json:"inventory"`
-	BarCode   string `json:"barCode"`
+	Inventory       int32  `json:"inventory"`
+	BarCode         string `json:"barCode"`
+	LocationBarCode string `json:"locationBarCode"` // Location where the product is being counted, optional
 }
 
 type BarCodeInputInventoryProductsResult struct {
-	Ok               bool   `json:"ok"`
-	ProductReference string `json:"productReference"`
-	ProductName      string `json:"productName"`
-	Quantity         int32  `json:"quantity"`
+	Ok               bool    `json:"ok"`
+	ProductReference string  `json:"productReference"`
+	ProductName      string  `json:"productName"`
+	Quantity         float64 `json:"quantity"`
+	LocationCode     string  `json:"locationCode"`
+	LocationQuantity float64 `json:"locationQuantity"` // Quantity counted in the location
 }
 
 func (input *BarCodeInputInventoryProducts) insertOrCountInventoryProductsByBarcode(enterpriseId int32) BarCodeInputInventoryProductsResult {
@@ -423,6 +446,14 @@ func (input *BarCodeInputInventoryProducts) insertOrCountInventoryProductsByBarc
 		return BarCodeInputInventoryProductsResult{}
 	}
 
+	var location WarehouseLocation
+	if len(input.LocationBarCode) > 0 {
+		location = getWarehouseLocationByBarCode(i.WarehouseId, input.LocationBarCode, enterpriseId)
+		if location.Id <= 0 {
+			return BarCodeInputInventoryProductsResult{}
+		}
+	}
+
 	var rowCount int64
 	result := dbOrm.Model(&InventoryProducts{}).Where("inventory = ? AND product = ?", input.Inventory, product.Id).Count(&rowCount)
 	if result.Error != nil {
@@ -445,7 +476,7 @@ func (input *BarCodeInputInventoryProducts) insertOrCountInventoryProductsByBarc
 			return BarCodeInputInventoryProductsResult{}
 		}
 	} else {
-		var quantity int32
+		var quantity float64
 		result := dbOrm.Model(&InventoryProducts{}).Where("inventory = ? AND product = ?", input.Inventory, product.Id).Select("quantity").Pluck("quantity", &quantity)
 		if result.Error != nil {
 			log("DB", result.Error.Error())
@@ -461,6 +492,39 @@ func (input *BarCodeInputInventoryProducts) insertOrCountInventoryProductsByBarc
 		}
 	}
 
+	var locationQuantity float64
+	if location.Id > 0 {
+		result := dbOrm.Model(&InventoryProductLocation{}).Where("inventory = ? AND product = ? AND location = ?", input.Inventory, product.Id, location.Id).Count(&rowCount)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			return BarCodeInputInventoryProductsResult{}
+		}
+
+		if rowCount == 0 {
+			locationQuantity = 1
+			result = dbOrm.Create(&InventoryProductLocation{
+				InventoryId:  input.Inventory,
+				ProductId:    product.Id,
+				LocationId:   location.Id,
+				Quantity:     locationQuantity,
+				EnterpriseId: enterpriseId,
+			})
+		} else {
+			result = dbOrm.Model(&InventoryProductLocation{}).Where("inventory = ? AND product = ? AND location = ?", input.Inventory, product.Id, location.Id).Pluck("quantity", &locationQuantity)
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				return BarCodeInputInventoryProductsResult{}
+			}
+
+			locationQuantity += 1
+			result = dbOrm.Model(&InventoryProductLocation{}).Where("inventory = ? AND product = ? AND location = ?", input.Inventory, product.Id, location.Id).Update("quantity", locationQuantity)
+		}
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			return BarCodeInputInventoryProductsResult{}
+		}
+	}
+
 	inventoryProduct := getInventoryProductsRow(input.Inventory, product.Id, enterpriseId)
-	return BarCodeInputInventoryProductsResult{Ok: true, ProductReference: product.Reference, ProductName: product.Name, Quantity: inventoryProduct.Quantity}
+	return BarCodeInputInventoryProductsResult{Ok: true, ProductReference: product.Reference, ProductName: product.Name, Quantity: inventoryProduct.Quantity, LocationCode: location.Code, LocationQuantity: locationQuantity}
 }
@@ -0,0 +1,1019 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// THIS FILE CONTAINS THE TAMPER-EVIDENT REGISTER OF THE ISSUED SALES INVOICES, AND THE EXPORT OF THE RECORDS TO THE SPANISH VERIFACTU AND TICKETBAI FORMATS.
+// Every record contains the hash of the previous record of the same billing series, so any deleted or modified record breaks the chain.
+// The TicketBAI files are signed when the invoice is registered, because every file is chained to the signature of the previous file.
+
+const VERIFACTU_SUMINISTRO_LR_NAMESPACE = "https://www2.agenciatributaria.gob.es/static_files/common/internet/dep/aplicaciones/es/aeat/tike/cont/ws/SuministroLR.xsd"
+const VERIFACTU_SUMINISTRO_INFORMACION_NAMESPACE = "https://www2.agenciatributaria.gob.es/static_files/common/internet/dep/aplicaciones/es/aeat/tike/cont/ws/SuministroInformacion.xsd"
+const VERIFACTU_QR_URL = "https://www2.agenciatributaria.gob.es/wlpl/TIKE-CONT/ValidarQR"
+const SOAP_ENVELOPE_NAMESPACE = "http://schemas.xmlsoap.org/soap/envelope/"
+const TICKETBAI_NAMESPACE = "urn:ticketbai:emision"
+const TICKETBAI_QR_URL = "https://batuz.eus/QRTBAI/"
+const TICKETBAI_SIGNATURE_POLICY = "https://www.batuz.eus/fitxategiak/batuz/ticketbai/sinadura_elektronikoaren_zehaztapenak_especificaciones_de_la_firma_electronica_v1_0.pdf"
+const TICKETBAI_SIGNATURE_POLICY_HASH = "Quzn98x3PMbSHwbUzaj5f5KOpiH0u8bvmwbbbNkO9Es=" // SHA-256 of the signature policy document
+const INVOICE_REGISTER_SOFTWARE_NAME = "MARKETNET"
+const INVOICE_REGISTER_SOFTWARE_VERSION = "1.0"
+
+// Namespace declarations of the root element of the TicketBAI files, sorted by prefix as they are rendered in the canonical form.
+const TICKETBAI_NAMESPACE_DECLARATIONS = ` xmlns:T="` + TICKETBAI_NAMESPACE + `" xmlns:ds="` + FACTURAE_XMLDSIG_NAMESPACE + `" xmlns:etsi="` + FACTURAE_XADES_NAMESPACE + `"`
+
+var ticketBaiSignaturePolicy XAdESSignaturePolicy = XAdESSignaturePolicy{
+	Identifier:      TICKETBAI_SIGNATURE_POLICY,
+	Description:     "Política de Firma TicketBAI 1.0",
+	DigestAlgorithm: XMLENC_SHA256,
+	DigestValue:     TICKETBAI_SIGNATURE_POLICY_HASH,
+}
+
+type SalesInvoiceRegister struct {
+	Id                 int64        `json:"id" gorm:"index:sales_invoice_register_id_enterprise,unique:true,priority:1"`
+	BillingSeriesId    string       `json:"billingSeriesId" gorm:"column:billing_series;type:character(3);not null:true;index:sales_invoice_register_sequence,unique:true,priority:2"`
+	BillingSeries      BillingSerie `json:"billingSeries" gorm:"foreignKey:BillingSeriesId,EnterpriseId;references:Id,EnterpriseId"`
+	Sequence           int64        `json:"sequence" gorm:"not null:true;index:sales_invoice_register_sequence,unique:true,priority:3"`
+	InvoiceId          int64        `json:"invoiceId" gorm:"column:invoice;not null:true;index:sales_invoice_register_invoice,unique:true,priority:2"` // There is no foreign key, so the verification can report the deleted invoices
+	IssuerTaxId        string       `json:"issuerTaxId" gorm:"type:character varying(25);not null:true"`
+	InvoiceName        string       `json:"invoiceName" gorm:"type:character varying(15);not null:true"`
+	InvoiceNumber      int32        `json:"invoiceNumber" gorm:"not null:true"`
+	InvoiceDate        time.Time    `json:"invoiceDate" gorm:"type:date;not null:true"`
+	InvoiceType        string       `json:"invoiceType" gorm:"type:character(2);not null:true"` // F1 = Invoice, F2 = Simplified invoice, R1 = Amending invoice, R5 = Amending simplified invoice
+	TotalAmount        float64      `json:"totalAmount" gorm:"type:numeric(14,6);not null:true"`
+	VatAmount          float64      `json:"vatAmount" gorm:"type:numeric(14,6);not null:true"`
+	VatBreakdown       string       `json:"vatBreakdown" gorm:"type:text;not null:true"` // JSON array of SalesInvoiceRegisterVat
+	PreviousHash       string       `json:"previousHash" gorm:"type:character varying(64);not null:true"`
+	Hash               string       `json:"hash" gorm:"type:character(64);not null:true"`
+	IntegrityHash      string       `json:"integrityHash" gorm:"type:character(64);not null:true;default:''"` // Hash of the record and the VAT breakdown, the VAT breakdown is not part of the VeriFactu hash
+	SignatureValue     string       `json:"signatureValue" gorm:"type:text;not null:true;default:''"`         // Only TicketBAI, value of the XAdES signature of the file
+	SignedDocument     string       `json:"-" gorm:"type:text;not null:true;default:''"`                      // Only TicketBAI, the signed file can't be generated again with the same signature
+	DateCreated        time.Time    `json:"dateCreated" gorm:"type:timestamp(0) with time zone;not null:true"`
+	SubmissionStatus   string       `json:"submissionStatus" gorm:"type:character(1);not null:true;default:'_'"` // "_" = Not submitted, "S" = Submitted, "E" = Error
+	SubmissionDate     *time.Time   `json:"submissionDate" gorm:"type:timestamp(3) with time zone"`
+	SubmissionResponse string       `json:"submissionResponse" gorm:"type:text;not null:true;default:''"`
+	EnterpriseId       int32        `json:"-" gorm:"column:enterprise;not null:true;index:sales_invoice_register_id_enterprise,unique:true,priority:2;index:sales_invoice_register_sequence,unique:true,priority:1;index:sales_invoice_register_invoice,unique:true,priority:1"`
+	Enterprise         Settings     `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (r *SalesInvoiceRegister) TableName() string {
+	return "sales_invoice_register"
+}
+
+type SalesInvoiceRegisterVat struct {
+	TaxCategory   string  `json:"taxCategory"` // EN 16931 tax category: S = Standard rate, Z = Zero rated, K = Intra-community supply, G = Export outside the EU
+	VatPercent    float64 `json:"vatPercent"`
+	TaxableAmount float64 `json:"taxableAmount"`
+	VatAmount     float64 `json:"vatAmount"`
+}
+
+func (r *SalesInvoiceRegister) BeforeCreate(tx *gorm.DB) (err error) {
+	var salesInvoiceRegister SalesInvoiceRegister
+	tx.Model(&SalesInvoiceRegister{}).Last(&salesInvoiceRegister)
+	r.Id = salesInvoiceRegister.Id + 1
+	return nil
+}
+
+func getSalesInvoiceRegisterByInvoice(invoiceId int64, enterpriseId int32) SalesInvoiceRegister {
+	r := SalesInvoiceRegister{}
+	result := dbOrm.Model(&SalesInvoiceRegister{}).Where("invoice = ? AND enterprise = ?", invoiceId, enterpriseId).Limit(1).Find(&r)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return r
+}
+
+// Returns the previous record in the chain of the billing series, or nil if this is the first record.
+func (r *SalesInvoiceRegister) getPreviousSalesInvoiceRegister() *SalesInvoiceRegister {
+	if r.Sequence <= 1 {
+		return nil
+	}
+	previous := SalesInvoiceRegister{}
+	result := dbOrm.Model(&SalesInvoiceRegister{}).Where("billing_series = ? AND sequence = ? AND enterprise = ?", r.BillingSeriesId, r.Sequence-1, r.EnterpriseId).Limit(1).Find(&previous)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	if previous.Id <= 0 {
+		return nil
+	}
+	return &previous
+}
+
+// Builds the record of the invoice with the data of the invoice as it is now, without the chain.
+// The same data is used to verify that the invoices were not modified after they were registered.
+// ERROR CODES:
+// 1. The enterprise has no tax ID or country in the settings
+// 2. The invoice has no details
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION
+func newSalesInvoiceRegister(invoiceId int64, enterpriseId int32, trans gorm.DB) (SalesInvoiceRegister, EN16931Invoice, OkAndErrorCodeReturn) {
+	e, result := getEN16931InvoiceTransaction(invoiceId, enterpriseId, trans)
+	if !result.Ok {
+		return SalesInvoiceRegister{}, e, result
+	}
+
+	r := SalesInvoiceRegister{
+		BillingSeriesId: e.Invoice.BillingSeriesId,
+		InvoiceId:       e.Invoice.Id,
+		IssuerTaxId:     strings.ToUpper(strings.TrimSpace(e.Settings.EnterpriseTaxId)),
+		InvoiceName:     strings.TrimSpace(e.Invoice.InvoiceName),
+		InvoiceNumber:   e.Invoice.InvoiceNumber,
+		InvoiceDate:     time.Date(e.Invoice.DateCreated.Year(), e.Invoice.DateCreated.Month(), e.Invoice.DateCreated.Day(), 0, 0, 0, 0, time.UTC),
+		InvoiceType:     "F1",
+		TotalAmount:     roundEN16931Amount(e.Invoice.TotalAmount),
+		VatAmount:       roundEN16931Amount(e.Invoice.VatAmount),
+		EnterpriseId:    enterpriseId,
+	}
+	if e.Invoice.Amending {
+		r.InvoiceType = "R1"
+		if e.Invoice.SimplifiedInvoice {
+			r.InvoiceType = "R5"
+		}
+	} else if e.Invoice.SimplifiedInvoice {
+		r.InvoiceType = "F2"
+	}
+
+	// the EN 16931 amounts of the amending invoices are positive, the register keeps the sign of the invoice
+	vatBreakdown := make([]SalesInvoiceRegisterVat, 0)
+	for i := 0; i < len(e.TaxSubtotals); i++ {
+		vatBreakdown = append(vatBreakdown, SalesInvoiceRegisterVat{
+			TaxCategory:   e.TaxSubtotals[i].TaxCategory.Code,
+			VatPercent:    e.TaxSubtotals[i].TaxCategory.Percent,
+			TaxableAmount: e.TaxSubtotals[i].TaxableAmount * e.Sign,
+			VatAmount:     e.TaxSubtotals[i].TaxAmount * e.Sign,
+		})
+	}
+	data, _ := json.Marshal(vatBreakdown)
+	r.VatBreakdown = string(data)
+
+	return r, e, OkAndErrorCodeReturn{Ok: true}
+}
+
+func (r *SalesInvoiceRegister) getVatBreakdown() []SalesInvoiceRegisterVat {
+	vatBreakdown := make([]SalesInvoiceRegisterVat, 0)
+	json.Unmarshal([]byte(r.VatBreakdown), &vatBreakdown)
+	return vatBreakdown
+}
+
+// The date of the invoice in the format of VeriFactu and TicketBAI
+func (r *SalesInvoiceRegister) formatInvoiceDate() string {
+	return r.InvoiceDate.Format("02-01-2006")
+}
+
+// The date and time when the record was generated in the format of VeriFactu
+func (r *SalesInvoiceRegister) formatDateCreated() string {
+	return r.DateCreated.UTC().Format("2006-01-02T15:04:05-07:00")
+}
+
+// The hash is the "huella" of the RegistroAlta of VeriFactu: SHA-256 in uppercase hexadecimal of the fields of the record joined as a query string,
+// in the order of the specification of the AEAT, including the hash of the previous record.
+func (r *SalesInvoiceRegister) calculateHash() string {
+	data := "IDEmisorFactura=" + r.IssuerTaxId +
+		"&NumSerieFactura=" + r.InvoiceName +
+		"&FechaExpedicionFactura=" + r.formatInvoiceDate() +
+		"&TipoFactura=" + r.InvoiceType +
+		"&CuotaTotal=" + fmt.Sprintf("%.2f", r.VatAmount) +
+		"&ImporteTotal=" + fmt.Sprintf("%.2f", r.TotalAmount) +
+		"&Huella=" + r.PreviousHash +
+		"&FechaHoraHusoGenRegistro=" + r.formatDateCreated()
+	hash := sha256.Sum256([]byte(data))
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+// The VAT breakdown is not part of the VeriFactu hash, this internal hash of the record and the VAT breakdown
+// detects the changes of the taxes in the register.
+func (r *SalesInvoiceRegister) calculateIntegrityHash() string {
+	hash := sha256.Sum256([]byte(r.Hash + "&Desglose=" + r.VatBreakdown))
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+// Adds the invoice at the end of the chain of its billing series. If the invoice is already registered, the record is kept as it is.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION
+func registerSalesInvoice(invoiceId int64, enterpriseId int32, trans *gorm.DB) bool {
+	var registered int64
+	result := trans.Model(&SalesInvoiceRegister{}).Where("invoice = ? AND enterprise = ?", invoiceId, enterpriseId).Count(&registered)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	if registered > 0 {
+		return true
+	}
+
+	r, e, ok := newSalesInvoiceRegister(invoiceId, enterpriseId, *trans)
+	if !ok.Ok {
+		return false
+	}
+
+	// the unique index on the sequence prevents two records from being chained to the same previous record
+	var previous SalesInvoiceRegister
+	result = trans.Model(&SalesInvoiceRegister{}).Where("billing_series = ? AND enterprise = ?", r.BillingSeriesId, enterpriseId).Order("sequence DESC").Limit(1).Find(&previous)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	r.Sequence = previous.Sequence + 1
+	r.PreviousHash = previous.Hash
+	r.DateCreated = time.Now().Truncate(time.Second)
+	r.SubmissionStatus = "_"
+	r.Hash = r.calculateHash()
+	r.IntegrityHash = r.calculateIntegrityHash()
+
+	if e.Settings.InvoiceRegister == "T" {
+		var previousRecord *SalesInvoiceRegister
+		if previous.Id > 0 {
+			previousRecord = &previous
+		}
+		document, signatureValue, err := signSalesInvoiceTicketBai(generateSalesInvoiceTicketBai(r, e, previousRecord), e.Settings)
+		if err != nil {
+			log("InvoiceRegister", err.Error())
+			return false
+		}
+		r.SignedDocument = document
+		r.SignatureValue = signatureValue
+	}
+
+	result = trans.Create(&r)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+// Registers an invoice when it's issued with all its details, in the same transaction, so it can't be modified or deleted without breaking the chain.
+// If the invoice can't be registered, the invoice must not be issued. The invoices that are created without details are registered when they are posted.
+// The records are submitted by calling submitSalesInvoiceRegister after the commit.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION
+func registerIssuedSalesInvoice(invoiceId int64, enterpriseId int32, trans *gorm.DB) bool {
+	settings := getSettingsRecordById(enterpriseId)
+	if settings.InvoiceRegister == "_" {
+		return true
+	}
+
+	if !registerSalesInvoice(invoiceId, enterpriseId, trans) {
+		log("InvoiceRegister", "The invoice "+strconv.Itoa(int(invoiceId))+" could not be registered when it was issued")
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION
+func isSalesInvoiceRegistered(invoiceId int64, enterpriseId int32, trans gorm.DB) bool {
+	var registered int64
+	result := trans.Model(&SalesInvoiceRegister{}).Where("invoice = ? AND enterprise = ?", invoiceId, enterpriseId).Count(&registered)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return registered > 0
+}
+
+type SalesInvoiceRegisterVerification struct {
+	Ok      bool                        `json:"ok"`
+	Records int                         `json:"records"`
+	Breaks  []SalesInvoiceRegisterBreak `json:"breaks"`
+}
+
+type SalesInvoiceRegisterBreak struct {
+	BillingSeriesId string `json:"billingSeriesId"`
+	Sequence        int64  `json:"sequence"`
+	InvoiceId       int64  `json:"invoiceId"`
+	InvoiceName     string `json:"invoiceName"`
+	Reason          uint8  `json:"reason"` // 1 = The hash doesn't match the content of the record, 2 = The previous hash doesn't match the previous record, 3 = There are missing records before this one, 4 = The invoice has been deleted, 5 = The invoice has been modified after it was registered
+}
+
+// Walks the chain of every billing series from the first record, and reports every record where the chain is broken.
+func verifySalesInvoiceRegister(enterpriseId int32) SalesInvoiceRegisterVerification {
+	verification := SalesInvoiceRegisterVerification{Breaks: make([]SalesInvoiceRegisterBreak, 0)}
+	records := make([]SalesInvoiceRegister, 0)
+	result := dbOrm.Model(&SalesInvoiceRegister{}).Where("enterprise = ?", enterpriseId).Order("billing_series ASC, sequence ASC").Find(&records)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return verification
+	}
+	verification.Records = len(records)
+
+	var previous *SalesInvoiceRegister
+	for i := 0; i < len(records); i++ {
+		r := records[i]
+		addBreak := func(reason uint8) {
+			verification.Breaks = append(verification.Breaks, SalesInvoiceRegisterBreak{BillingSeriesId: r.BillingSeriesId, Sequence: r.Sequence, InvoiceId: r.InvoiceId, InvoiceName: r.InvoiceName, Reason: reason})
+		}
+		if previous != nil && previous.BillingSeriesId != r.BillingSeriesId {
+			previous = nil
+		}
+
+		if r.calculateHash() != r.Hash || r.calculateIntegrityHash() != r.IntegrityHash {
+			addBreak(1)
+		}
+		if previous == nil {
+			if r.Sequence != 1 {
+				addBreak(3)
+			} else if r.PreviousHash != "" {
+				addBreak(2)
+			}
+		} else {
+			if r.Sequence != previous.Sequence+1 {
+				addBreak(3)
+			}
+			if r.PreviousHash != previous.Hash {
+				addBreak(2)
+			}
+		}
+
+		invoice := getSalesInvoiceRow(r.InvoiceId)
+		if invoice.Id <= 0 || invoice.EnterpriseId != enterpriseId {
+			addBreak(4)
+		} else {
+			current, _, ok := newSalesInvoiceRegister(r.InvoiceId, enterpriseId, *dbOrm)
+			if !ok.Ok || current.BillingSeriesId != r.BillingSeriesId || current.IssuerTaxId != r.IssuerTaxId || current.InvoiceName != r.InvoiceName || !current.InvoiceDate.Equal(r.InvoiceDate) || current.InvoiceType != r.InvoiceType || fmt.Sprintf("%.2f", current.TotalAmount) != fmt.Sprintf("%.2f", r.TotalAmount) || fmt.Sprintf("%.2f", current.VatAmount) != fmt.Sprintf("%.2f", r.VatAmount) || current.VatBreakdown != r.VatBreakdown {
+				addBreak(5)
+			}
+		}
+
+		previous = &records[i]
+	}
+
+	verification.Ok = len(verification.Breaks) == 0
+	return verification
+}
+
+// Returns the text of the QR code that is printed on the invoice, to let the customer check the invoice in the tax agency.
+func (r *SalesInvoiceRegister) getQrPayload(invoiceRegister string) string {
+	if invoiceRegister == "T" {
+		id := r.getTicketBaiId()
+		qr := TICKETBAI_QR_URL + "?id=" + url.QueryEscape(id) + "&s=" + url.QueryEscape(r.BillingSeriesId) + "&nf=" + strconv.Itoa(int(r.InvoiceNumber)) + "&i=" + fmt.Sprintf("%.2f", r.TotalAmount)
+		return qr + "&cr=" + fmt.Sprintf("%03d", crc8([]byte(qr)))
+	}
+	return VERIFACTU_QR_URL + "?nif=" + url.QueryEscape(r.IssuerTaxId) + "&numserie=" + url.QueryEscape(r.InvoiceName) + "&fecha=" + r.formatInvoiceDate() + "&importe=" + fmt.Sprintf("%.2f", r.TotalAmount)
+}
+
+// Returns the text of the QR code of the invoice, or an empty string if the invoice is not in the register.
+func getSalesInvoiceRegisterQrPayload(invoiceId int64, enterpriseId int32) string {
+	r := getSalesInvoiceRegisterByInvoice(invoiceId, enterpriseId)
+	if r.Id <= 0 {
+		return ""
+	}
+	s := getSettingsRecordById(enterpriseId)
+	return r.getQrPayload(s.InvoiceRegister)
+}
+
+// TBAI-<issuer tax id>-<date as DDMMYY>-<first 13 characters of the signature value>-<CRC-8 of the rest of the identifier>
+// Returns an empty string if the record was not signed as a TicketBAI file.
+func (r *SalesInvoiceRegister) getTicketBaiId() string {
+	if len(r.SignatureValue) < 13 {
+		return ""
+	}
+	id := "TBAI-" + r.IssuerTaxId + "-" + r.InvoiceDate.Format("020106") + "-" + r.SignatureValue[:13] + "-"
+	return id + fmt.Sprintf("%03d", crc8([]byte(id)))
+}
+
+// CRC-8 with the polynomial x^8 + x^2 + x + 1, as required in the TicketBAI identifiers and QR codes.
+func crc8(data []byte) uint8 {
+	var crc uint8 = 0
+	for i := 0; i < len(data); i++ {
+		crc ^= data[i]
+		for j := 0; j < 8; j++ {
+			if crc&0x80 != 0 {
+				crc = (crc << 1) ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Returns the registration file of the invoice in the format of the settings.
+// The TicketBAI files are returned as they were signed when the invoice was registered.
+// ERROR CODES:
+// 1. The invoice is not in the register
+// 2. The invoice of the record has been deleted
+// 3. The enterprise has no tax ID or country in the settings
+// 4. The record was not signed as a TicketBAI file when the invoice was registered
+func generateSalesInvoiceRegisterXML(invoiceId int64, enterpriseId int32) ([]byte, OkAndErrorCodeReturn) {
+	r := getSalesInvoiceRegisterByInvoice(invoiceId, enterpriseId)
+	if r.Id <= 0 {
+		return nil, OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+	e, result := getEN16931Invoice(invoiceId, enterpriseId)
+	if !result.Ok {
+		if e.Invoice.Id <= 0 {
+			return nil, OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+		}
+		return nil, OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+
+	if e.Settings.InvoiceRegister == "T" {
+		if len(r.SignedDocument) == 0 {
+			return nil, OkAndErrorCodeReturn{Ok: false, ErrorCode: 4}
+		}
+		return []byte(xml.Header + r.SignedDocument), OkAndErrorCodeReturn{Ok: true}
+	}
+
+	data, err := xml.Marshal(generateSalesInvoiceVeriFactu(r, e))
+	if err != nil {
+		log("InvoiceRegister", err.Error())
+		return nil, OkAndErrorCodeReturn{Ok: false}
+	}
+	return append([]byte(xml.Header), data...), OkAndErrorCodeReturn{Ok: true}
+}
+
+func reportSalesInvoiceRegister(id int, enterpriseId int32) []byte {
+	document, result := generateSalesInvoiceRegisterXML(int64(id), enterpriseId)
+	if !result.Ok {
+		return nil
+	}
+	return document
+}
+
+// VERIFACTU
+
+type VeriFactuRegFactu struct {
+	XMLName         xml.Name                 `xml:"sum:RegFactuSistemaFacturacion"`
+	XmlnsSum        string                   `xml:"xmlns:sum,attr"`
+	XmlnsSum1       string                   `xml:"xmlns:sum1,attr"`
+	Cabecera        VeriFactuCabecera        `xml:"sum:Cabecera"`
+	RegistroFactura VeriFactuRegistroFactura `xml:"sum:RegistroFactura"`
+}
+
+type VeriFactuCabecera struct {
+	ObligadoEmision VeriFactuPersona `xml:"sum1:ObligadoEmision"`
+}
+
+type VeriFactuPersona struct {
+	NombreRazon string           `xml:"sum1:NombreRazon"`
+	NIF         string           `xml:"sum1:NIF,omitempty"`
+	IDOtro      *VeriFactuIDOtro `xml:"sum1:IDOtro"`
+}
+
+type VeriFactuIDOtro struct {
+	CodigoPais string `xml:"sum1:CodigoPais"`
+	IDType     string `xml:"sum1:IDType"` // 02 = VAT number, 04 = Official document of the country of residence
+	ID         string `xml:"sum1:ID"`
+}
+
+type VeriFactuRegistroFactura struct {
+	RegistroAlta VeriFactuRegistroAlta `xml:"sum1:RegistroAlta"`
+}
+
+type VeriFactuRegistroAlta struct {
+	IDVersion                string                         `xml:"sum1:IDVersion"`
+	IDFactura                VeriFactuIDFactura             `xml:"sum1:IDFactura"`
+	NombreRazonEmisor        string                         `xml:"sum1:NombreRazonEmisor"`
+	TipoFactura              string                         `xml:"sum1:TipoFactura"`
+	TipoRectificativa        string                         `xml:"sum1:TipoRectificativa,omitempty"` // I = By differences
+	FacturasRectificadas     *VeriFactuFacturasRectificadas `xml:"sum1:FacturasRectificadas"`
+	DescripcionOperacion     string                         `xml:"sum1:DescripcionOperacion"`
+	Destinatarios            *VeriFactuDestinatarios        `xml:"sum1:Destinatarios"`
+	Desglose                 VeriFactuDesglose              `xml:"sum1:Desglose"`
+	CuotaTotal               string                         `xml:"sum1:CuotaTotal"`
+	ImporteTotal             string                         `xml:"sum1:ImporteTotal"`
+	Encadenamiento           VeriFactuEncadenamiento        `xml:"sum1:Encadenamiento"`
+	SistemaInformatico       VeriFactuSistemaInformatico    `xml:"sum1:SistemaInformatico"`
+	FechaHoraHusoGenRegistro string                         `xml:"sum1:FechaHoraHusoGenRegistro"`
+	TipoHuella               string                         `xml:"sum1:TipoHuella"` // 01 = SHA-256
+	Huella                   string                         `xml:"sum1:Huella"`
+}
+
+type VeriFactuIDFactura struct {
+	IDEmisorFactura        string `xml:"sum1:IDEmisorFactura"`
+	NumSerieFactura        string `xml:"sum1:NumSerieFactura"`
+	FechaExpedicionFactura string `xml:"sum1:FechaExpedicionFactura"`
+}
+
+type VeriFactuFacturasRectificadas struct {
+	IDFacturaRectificada []VeriFactuIDFactura `xml:"sum1:IDFacturaRectificada"`
+}
+
+type VeriFactuDestinatarios struct {
+	IDDestinatario []VeriFactuPersona `xml:"sum1:IDDestinatario"`
+}
+
+type VeriFactuDesglose struct {
+	DetalleDesglose []VeriFactuDetalleDesglose `xml:"sum1:DetalleDesglose"`
+}
+
+type VeriFactuDetalleDesglose struct {
+	Impuesto                      string `xml:"sum1:Impuesto"`                        // 01 = VAT
+	ClaveRegimen                  string `xml:"sum1:ClaveRegimen"`                    // 01 = General regime, 02 = Export
+	CalificacionOperacion         string `xml:"sum1:CalificacionOperacion,omitempty"` // S1 = Subject and not exempt
+	OperacionExenta               string `xml:"sum1:OperacionExenta,omitempty"`       // E2 = Export, E5 = Intra-community supply
+	TipoImpositivo                string `xml:"sum1:TipoImpositivo,omitempty"`
+	BaseImponibleOimporteNoSujeto string `xml:"sum1:BaseImponibleOimporteNoSujeto"`
+	CuotaRepercutida              string `xml:"sum1:CuotaRepercutida,omitempty"`
+}
+
+type VeriFactuEncadenamiento struct {
+	PrimerRegistro   string                     `xml:"sum1:PrimerRegistro,omitempty"`
+	RegistroAnterior *VeriFactuRegistroAnterior `xml:"sum1:RegistroAnterior"`
+}
+
+type VeriFactuRegistroAnterior struct {
+	IDEmisorFactura        string `xml:"sum1:IDEmisorFactura"`
+	NumSerieFactura        string `xml:"sum1:NumSerieFactura"`
+	FechaExpedicionFactura string `xml:"sum1:FechaExpedicionFactura"`
+	Huella                 string `xml:"sum1:Huella"`
+}
+
+type VeriFactuSistemaInformatico struct {
+	NombreRazon                 string `xml:"sum1:NombreRazon"`
+	NIF                         string `xml:"sum1:NIF"`
+	NombreSistemaInformatico    string `xml:"sum1:NombreSistemaInformatico"`
+	IdSistemaInformatico        string `xml:"sum1:IdSistemaInformatico"`
+	Version                     string `xml:"sum1:Version"`
+	NumeroInstalacion           string `xml:"sum1:NumeroInstalacion"`
+	TipoUsoPosibleSoloVerifactu string `xml:"sum1:TipoUsoPosibleSoloVerifactu"`
+	TipoUsoPosibleMultiOT       string `xml:"sum1:TipoUsoPosibleMultiOT"`
+	IndicadorMultiplesOT        string `xml:"sum1:IndicadorMultiplesOT"`
+}
+
+func generateSalesInvoiceVeriFactu(r SalesInvoiceRegister, e EN16931Invoice) VeriFactuRegFactu {
+	issuer := VeriFactuPersona{NombreRazon: e.Settings.EnterpriseName, NIF: r.IssuerTaxId}
+
+	alta := VeriFactuRegistroAlta{
+		IDVersion:            "1.0",
+		IDFactura:            VeriFactuIDFactura{IDEmisorFactura: r.IssuerTaxId, NumSerieFactura: r.InvoiceName, FechaExpedicionFactura: r.formatInvoiceDate()},
+		NombreRazonEmisor:    e.Settings.EnterpriseName,
+		TipoFactura:          r.InvoiceType,
+		DescripcionOperacion: "Sale " + r.InvoiceName,
+		CuotaTotal:           fmt.Sprintf("%.2f", r.VatAmount),
+		ImporteTotal:         fmt.Sprintf("%.2f", r.TotalAmount),
+		SistemaInformatico: VeriFactuSistemaInformatico{
+			NombreRazon:                 e.Settings.EnterpriseName,
+			NIF:                         r.IssuerTaxId,
+			NombreSistemaInformatico:    INVOICE_REGISTER_SOFTWARE_NAME,
+			IdSistemaInformatico:        "MN",
+			Version:                     INVOICE_REGISTER_SOFTWARE_VERSION,
+			NumeroInstalacion:           strconv.Itoa(int(r.EnterpriseId)),
+			TipoUsoPosibleSoloVerifactu: "N",
+			TipoUsoPosibleMultiOT:       "S",
+			IndicadorMultiplesOT:        "N",
+		},
+		FechaHoraHusoGenRegistro: r.DateCreated.UTC().Format("2006-01-02T15:04:05-07:00"),
+		TipoHuella:               "01",
+		Huella:                   r.Hash,
+	}
+	if e.Invoice.Amending {
+		alta.TipoRectificativa = "I"
+		if e.AmendedInvoice != nil {
+			alta.FacturasRectificadas = &VeriFactuFacturasRectificadas{IDFacturaRectificada: []VeriFactuIDFactura{{
+				IDEmisorFactura:        r.IssuerTaxId,
+				NumSerieFactura:        strings.TrimSpace(e.AmendedInvoice.InvoiceName),
+				FechaExpedicionFactura: e.AmendedInvoice.DateCreated.Format("02-01-2006"),
+			}}}
+		}
+	}
+
+	// the simplified invoices don't identify the customer
+	if !e.Invoice.SimplifiedInvoice {
+		recipient := VeriFactuPersona{NombreRazon: e.CustomerName}
+		if e.Address.Country.Zone == "N" {
+			recipient.NIF = strings.ToUpper(strings.TrimSpace(e.Invoice.Customer.TaxId))
+		} else {
+			recipient.IDOtro = &VeriFactuIDOtro{CodigoPais: e.Address.Country.Iso2, IDType: "04", ID: e.CustomerVatNumber}
+			if e.Address.Country.Zone == "U" {
+				recipient.IDOtro.IDType = "02"
+				recipient.IDOtro.ID = en16931VatNumber(e.CustomerVatNumber, e.Address.Country.Iso2)
+			}
+		}
+		alta.Destinatarios = &VeriFactuDestinatarios{IDDestinatario: []VeriFactuPersona{recipient}}
+	}
+
+	vatBreakdown := r.getVatBreakdown()
+	for i := 0; i < len(vatBreakdown); i++ {
+		detail := VeriFactuDetalleDesglose{Impuesto: "01", ClaveRegimen: "01", BaseImponibleOimporteNoSujeto: fmt.Sprintf("%.2f", vatBreakdown[i].TaxableAmount)}
+		switch vatBreakdown[i].TaxCategory {
+		case "K":
+			detail.OperacionExenta = "E5"
+		case "G":
+			detail.ClaveRegimen = "02"
+			detail.OperacionExenta = "E2"
+		default:
+			detail.CalificacionOperacion = "S1"
+			detail.TipoImpositivo = fmt.Sprintf("%.2f", vatBreakdown[i].VatPercent)
+			detail.CuotaRepercutida = fmt.Sprintf("%.2f", vatBreakdown[i].VatAmount)
+		}
+		alta.Desglose.DetalleDesglose = append(alta.Desglose.DetalleDesglose, detail)
+	}
+
+	previous := r.getPreviousSalesInvoiceRegister()
+	if previous == nil {
+		alta.Encadenamiento.PrimerRegistro = "S"
+	} else {
+		alta.Encadenamiento.RegistroAnterior = &VeriFactuRegistroAnterior{IDEmisorFactura: previous.IssuerTaxId, NumSerieFactura: previous.InvoiceName, FechaExpedicionFactura: previous.formatInvoiceDate(), Huella: previous.Hash}
+	}
+
+	return VeriFactuRegFactu{
+		XmlnsSum:        VERIFACTU_SUMINISTRO_LR_NAMESPACE,
+		XmlnsSum1:       VERIFACTU_SUMINISTRO_INFORMACION_NAMESPACE,
+		Cabecera:        VeriFactuCabecera{ObligadoEmision: issuer},
+		RegistroFactura: VeriFactuRegistroFactura{RegistroAlta: alta},
+	}
+}
+
+// TICKETBAI
+
+// The root element "T:TicketBai" is written when the content is signed
+type TicketBai struct {
+	Cabecera   TicketBaiCabecera   `xml:"Cabecera"`
+	Sujetos    TicketBaiSujetos    `xml:"Sujetos"`
+	Factura    TicketBaiFactura    `xml:"Factura"`
+	HuellaTBAI TicketBaiHuellaTBAI `xml:"HuellaTBAI"`
+}
+
+type TicketBaiCabecera struct {
+	XMLName       xml.Name `xml:"Cabecera"`
+	IDVersionTBAI string   `xml:"IDVersionTBAI"`
+}
+
+type TicketBaiSujetos struct {
+	XMLName       xml.Name                `xml:"Sujetos"`
+	Emisor        TicketBaiEmisor         `xml:"Emisor"`
+	Destinatarios *TicketBaiDestinatarios `xml:"Destinatarios"`
+}
+
+type TicketBaiEmisor struct {
+	NIF                        string `xml:"NIF"`
+	ApellidosNombreRazonSocial string `xml:"ApellidosNombreRazonSocial"`
+}
+
+type TicketBaiDestinatarios struct {
+	IDDestinatario []TicketBaiIDDestinatario `xml:"IDDestinatario"`
+}
+
+type TicketBaiIDDestinatario struct {
+	NIF                        string           `xml:"NIF,omitempty"`
+	IDOtro                     *TicketBaiIDOtro `xml:"IDOtro"`
+	ApellidosNombreRazonSocial string           `xml:"ApellidosNombreRazonSocial"`
+	CodigoPostal               string           `xml:"CodigoPostal,omitempty"`
+	Direccion                  string           `xml:"Direccion,omitempty"`
+}
+
+type TicketBaiIDOtro struct {
+	CodigoPais string `xml:"CodigoPais"`
+	IDType     string `xml:"IDType"` // 02 = VAT number, 04 = Official document of the country of residence
+	ID         string `xml:"ID"`
+}
+
+type TicketBaiFactura struct {
+	XMLName         xml.Name                 `xml:"Factura"`
+	CabeceraFactura TicketBaiCabeceraFactura `xml:"CabeceraFactura"`
+	DatosFactura    TicketBaiDatosFactura    `xml:"DatosFactura"`
+	TipoDesglose    TicketBaiTipoDesglose    `xml:"TipoDesglose"`
+}
+
+type TicketBaiCabeceraFactura struct {
+	SerieFactura                    string                         `xml:"SerieFactura"`
+	NumFactura                      string                         `xml:"NumFactura"`
+	FechaExpedicionFactura          string                         `xml:"FechaExpedicionFactura"`
+	HoraExpedicionFactura           string                         `xml:"HoraExpedicionFactura"`
+	FacturaSimplificada             string                         `xml:"FacturaSimplificada,omitempty"`
+	FacturaRectificativa            *TicketBaiFacturaRectificativa `xml:"FacturaRectificativa"`
+	FacturasRectificadasSustituidas *TicketBaiFacturasRectificadas `xml:"FacturasRectificadasSustituidas"`
+}
+
+type TicketBaiFacturaRectificativa struct {
+	Codigo string `xml:"Codigo"` // R1 = Amending invoice, R5 = Amending simplified invoice
+	Tipo   string `xml:"Tipo"`   // I = By differences
+}
+
+type TicketBaiFacturasRectificadas struct {
+	IDFacturaRectificadaSustituida []TicketBaiIDFactura `xml:"IDFacturaRectificadaSustituida"`
+}
+
+type TicketBaiIDFactura struct {
+	SerieFactura           string `xml:"SerieFactura"`
+	NumFactura             string `xml:"NumFactura"`
+	FechaExpedicionFactura string `xml:"FechaExpedicionFactura"`
+}
+
+type TicketBaiDatosFactura struct {
+	DescripcionFactura  string                   `xml:"DescripcionFactura"`
+	DetallesFactura     TicketBaiDetallesFactura `xml:"DetallesFactura"`
+	ImporteTotalFactura string                   `xml:"ImporteTotalFactura"`
+	Claves              TicketBaiClaves          `xml:"Claves"`
+}
+
+type TicketBaiDetallesFactura struct {
+	IDDetalleFactura []TicketBaiDetalleFactura `xml:"IDDetalleFactura"`
+}
+
+type TicketBaiDetalleFactura struct {
+	DescripcionDetalle string `xml:"DescripcionDetalle"`
+	Cantidad           string `xml:"Cantidad"`
+	ImporteUnitario    string `xml:"ImporteUnitario"`
+	Descuento          string `xml:"Descuento"`
+	ImporteTotal       string `xml:"ImporteTotal"`
+}
+
+type TicketBaiClaves struct {
+	IDClave []TicketBaiClave `xml:"IDClave"`
+}
+
+type TicketBaiClave struct {
+	ClaveRegimenIvaOpTrascendencia string `xml:"ClaveRegimenIvaOpTrascendencia"` // 01 = General regime, 02 = Export
+}
+
+type TicketBaiTipoDesglose struct {
+	DesgloseFactura TicketBaiDesgloseFactura `xml:"DesgloseFactura"`
+}
+
+type TicketBaiDesgloseFactura struct {
+	Sujeta TicketBaiSujeta `xml:"Sujeta"`
+}
+
+type TicketBaiSujeta struct {
+	Exenta   *TicketBaiExenta   `xml:"Exenta"`
+	NoExenta *TicketBaiNoExenta `xml:"NoExenta"`
+}
+
+type TicketBaiExenta struct {
+	DetalleExenta []TicketBaiDetalleExenta `xml:"DetalleExenta"`
+}
+
+type TicketBaiDetalleExenta struct {
+	CausaExencion string `xml:"CausaExencion"` // E2 = Export, E5 = Intra-community supply
+	BaseImponible string `xml:"BaseImponible"`
+}
+
+type TicketBaiNoExenta struct {
+	DetalleNoExenta []TicketBaiDetalleNoExenta `xml:"DetalleNoExenta"`
+}
+
+type TicketBaiDetalleNoExenta struct {
+	TipoNoExenta string               `xml:"TipoNoExenta"` // S1 = Not exempt without reverse charge
+	DesgloseIVA  TicketBaiDesgloseIVA `xml:"DesgloseIVA"`
+}
+
+type TicketBaiDesgloseIVA struct {
+	DetalleIVA []TicketBaiDetalleIVA `xml:"DetalleIVA"`
+}
+
+type TicketBaiDetalleIVA struct {
+	BaseImponible  string `xml:"BaseImponible"`
+	TipoImpositivo string `xml:"TipoImpositivo"`
+	CuotaImpuesto  string `xml:"CuotaImpuesto"`
+}
+
+type TicketBaiHuellaTBAI struct {
+	XMLName                       xml.Name                 `xml:"HuellaTBAI"`
+	EncadenamientoFacturaAnterior *TicketBaiEncadenamiento `xml:"EncadenamientoFacturaAnterior"`
+	Software                      TicketBaiSoftware        `xml:"Software"`
+}
+
+type TicketBaiEncadenamiento struct {
+	SerieFacturaAnterior               string `xml:"SerieFacturaAnterior"`
+	NumFacturaAnterior                 string `xml:"NumFacturaAnterior"`
+	FechaExpedicionFacturaAnterior     string `xml:"FechaExpedicionFacturaAnterior"`
+	SignatureValueFirmaFacturaAnterior string `xml:"SignatureValueFirmaFacturaAnterior"`
+}
+
+type TicketBaiSoftware struct {
+	LicenciaTBAI          string                         `xml:"LicenciaTBAI"`
+	EntidadDesarrolladora TicketBaiEntidadDesarrolladora `xml:"EntidadDesarrolladora"`
+	Nombre                string                         `xml:"Nombre"`
+	Version               string                         `xml:"Version"`
+}
+
+type TicketBaiEntidadDesarrolladora struct {
+	NIF string `xml:"NIF"`
+}
+
+// Returns the content of the TicketBAI file, chained to the previous record of the billing series (nil if it's the first record).
+func generateSalesInvoiceTicketBai(r SalesInvoiceRegister, e EN16931Invoice, previous *SalesInvoiceRegister) TicketBai {
+	tbai := TicketBai{
+		Cabecera: TicketBaiCabecera{IDVersionTBAI: "1.2"},
+		Sujetos:  TicketBaiSujetos{Emisor: TicketBaiEmisor{NIF: r.IssuerTaxId, ApellidosNombreRazonSocial: e.Settings.EnterpriseName}},
+		Factura: TicketBaiFactura{
+			CabeceraFactura: TicketBaiCabeceraFactura{
+				SerieFactura:           r.BillingSeriesId,
+				NumFactura:             strconv.Itoa(int(r.InvoiceNumber)),
+				FechaExpedicionFactura: r.formatInvoiceDate(),
+				HoraExpedicionFactura:  e.Invoice.DateCreated.Format("15:04:05"),
+			},
+			DatosFactura: TicketBaiDatosFactura{
+				DescripcionFactura:  "Sale " + r.InvoiceName,
+				ImporteTotalFactura: fmt.Sprintf("%.2f", r.TotalAmount),
+				Claves:              TicketBaiClaves{IDClave: []TicketBaiClave{{ClaveRegimenIvaOpTrascendencia: "01"}}},
+			},
+		},
+		HuellaTBAI: TicketBaiHuellaTBAI{Software: TicketBaiSoftware{
+			LicenciaTBAI:          e.Settings.TicketBaiLicense,
+			EntidadDesarrolladora: TicketBaiEntidadDesarrolladora{NIF: r.IssuerTaxId},
+			Nombre:                INVOICE_REGISTER_SOFTWARE_NAME,
+			Version:               INVOICE_REGISTER_SOFTWARE_VERSION,
+		}},
+	}
+	if e.Invoice.SimplifiedInvoice {
+		tbai.Factura.CabeceraFactura.FacturaSimplificada = "S"
+	} else {
+		recipient := TicketBaiIDDestinatario{ApellidosNombreRazonSocial: e.CustomerName, CodigoPostal: e.Address.ZipCode, Direccion: e.Address.Address}
+		if e.Address.Country.Zone == "N" {
+			recipient.NIF = strings.ToUpper(strings.TrimSpace(e.Invoice.Customer.TaxId))
+		} else {
+			recipient.IDOtro = &TicketBaiIDOtro{CodigoPais: e.Address.Country.Iso2, IDType: "04", ID: e.CustomerVatNumber}
+			if e.Address.Country.Zone == "U" {
+				recipient.IDOtro.IDType = "02"
+				recipient.IDOtro.ID = en16931VatNumber(e.CustomerVatNumber, e.Address.Country.Iso2)
+			}
+		}
+		tbai.Sujetos.Destinatarios = &TicketBaiDestinatarios{IDDestinatario: []TicketBaiIDDestinatario{recipient}}
+	}
+	if e.Invoice.Amending {
+		tbai.Factura.CabeceraFactura.FacturaRectificativa = &TicketBaiFacturaRectificativa{Codigo: r.InvoiceType, Tipo: "I"}
+		if e.AmendedInvoice != nil {
+			tbai.Factura.CabeceraFactura.FacturasRectificadasSustituidas = &TicketBaiFacturasRectificadas{IDFacturaRectificadaSustituida: []TicketBaiIDFactura{{
+				SerieFactura:           e.AmendedInvoice.BillingSeriesId,
+				NumFactura:             strconv.Itoa(int(e.AmendedInvoice.InvoiceNumber)),
+				FechaExpedicionFactura: e.AmendedInvoice.DateCreated.Format("02-01-2006"),
+			}}}
+		}
+	}
+
+	for i := 0; i < len(e.Lines); i++ {
+		d := e.Lines[i].Detail
+		tbai.Factura.DatosFactura.DetallesFactura.IDDetalleFactura = append(tbai.Factura.DatosFactura.DetallesFactura.IDDetalleFactura, TicketBaiDetalleFactura{
+			DescripcionDetalle: e.Lines[i].Name,
+			Cantidad:           formatQuantity(d.Quantity),
+			ImporteUnitario:    fmt.Sprintf("%.2f", d.Price),
+			Descuento:          "0.00",
+			ImporteTotal:       fmt.Sprintf("%.2f", d.TotalAmount),
+		})
+	}
+
+	vatBreakdown := r.getVatBreakdown()
+	for i := 0; i < len(vatBreakdown); i++ {
+		switch vatBreakdown[i].TaxCategory {
+		case "K", "G":
+			if tbai.Factura.TipoDesglose.DesgloseFactura.Sujeta.Exenta == nil {
+				tbai.Factura.TipoDesglose.DesgloseFactura.Sujeta.Exenta = &TicketBaiExenta{}
+			}
+			cause := "E5"
+			if vatBreakdown[i].TaxCategory == "G" {
+				cause = "E2"
+				tbai.Factura.DatosFactura.Claves.IDClave[0].ClaveRegimenIvaOpTrascendencia = "02"
+			}
+			exenta := tbai.Factura.TipoDesglose.DesgloseFactura.Sujeta.Exenta
+			exenta.DetalleExenta = append(exenta.DetalleExenta, TicketBaiDetalleExenta{CausaExencion: cause, BaseImponible: fmt.Sprintf("%.2f", vatBreakdown[i].TaxableAmount)})
+		default:
+			if tbai.Factura.TipoDesglose.DesgloseFactura.Sujeta.NoExenta == nil {
+				tbai.Factura.TipoDesglose.DesgloseFactura.Sujeta.NoExenta = &TicketBaiNoExenta{DetalleNoExenta: []TicketBaiDetalleNoExenta{{TipoNoExenta: "S1"}}}
+			}
+			desgloseIVA := &tbai.Factura.TipoDesglose.DesgloseFactura.Sujeta.NoExenta.DetalleNoExenta[0].DesgloseIVA
+			desgloseIVA.DetalleIVA = append(desgloseIVA.DetalleIVA, TicketBaiDetalleIVA{
+				BaseImponible:  fmt.Sprintf("%.2f", vatBreakdown[i].TaxableAmount),
+				TipoImpositivo: fmt.Sprintf("%.2f", vatBreakdown[i].VatPercent),
+				CuotaImpuesto:  fmt.Sprintf("%.2f", vatBreakdown[i].VatAmount),
+			})
+		}
+	}
+
+	// the chain contains the first 100 characters of the signature value of the previous file
+	if previous != nil {
+		signatureValue := previous.SignatureValue
+		if len(signatureValue) > 100 {
+			signatureValue = signatureValue[:100]
+		}
+		tbai.HuellaTBAI.EncadenamientoFacturaAnterior = &TicketBaiEncadenamiento{
+			SerieFacturaAnterior:               previous.BillingSeriesId,
+			NumFacturaAnterior:                 strconv.Itoa(int(previous.InvoiceNumber)),
+			FechaExpedicionFacturaAnterior:     previous.formatInvoiceDate(),
+			SignatureValueFirmaFacturaAnterior: signatureValue,
+		}
+	}
+
+	return tbai
+}
+
+// Signs the TicketBAI file with an enveloped XAdES-EPES signature, using the certificate of the settings and the TicketBAI signature policy.
+// Returns the signed file without the XML header, and the signature value in base64.
+func signSalesInvoiceTicketBai(tbai TicketBai, s Settings) (string, string, error) {
+	if len(s.FacturaeCertificate) == 0 {
+		return "", "", errors.New("the TicketBAI files can't be signed without a certificate in the settings")
+	}
+	cert, key, err := loadFacturaeCertificate(s.FacturaeCertificate, s.FacturaeCertificatePassword)
+	if err != nil {
+		return "", "", err
+	}
+
+	document, err := tbai.marshalContent()
+	if err != nil {
+		return "", "", err
+	}
+	return signXAdES("T:TicketBai", TICKETBAI_NAMESPACE_DECLARATIONS, document, ticketBaiSignaturePolicy, cert, key, time.Now())
+}
+
+// Returns the content of the file in the canonical form, without the root element.
+// The elements of the TicketBAI files are not qualified.
+func (tbai *TicketBai) marshalContent() (string, error) {
+	document := ""
+	for _, element := range []interface{}{tbai.Cabecera, tbai.Sujetos, tbai.Factura, tbai.HuellaTBAI} {
+		data, err := xml.Marshal(element)
+		if err != nil {
+			return "", err
+		}
+		document += string(data)
+	}
+	return canonicalFacturaeText(document), nil
+}
+
+// SUBMISSION
+
+// Sends the records that are not submitted yet to the URL in the settings, in the order of the chain.
+// The VeriFactu records are sent inside of a SOAP envelope, and the TicketBAI files are sent as they are.
+// If the settings have a certificate, it's used as the client certificate of the TLS connection.
+// The submission stops at the first record that is not accepted, so the tax agency always receives the chain in order.
+func submitSalesInvoiceRegister(enterpriseId int32) bool {
+	s := getSettingsRecordById(enterpriseId)
+	if s.InvoiceRegister == "_" || len(s.InvoiceRegisterUrl) == 0 {
+		return false
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	if len(s.FacturaeCertificate) > 0 {
+		cert, key, err := loadFacturaeCertificate(s.FacturaeCertificate, s.FacturaeCertificatePassword)
+		if err != nil {
+			log("InvoiceRegister", err.Error())
+			return false
+		}
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}}}}
+	}
+
+	records := make([]SalesInvoiceRegister, 0)
+	result := dbOrm.Model(&SalesInvoiceRegister{}).Where("enterprise = ? AND submission_status <> 'S'", enterpriseId).Order("billing_series ASC, sequence ASC").Find(&records)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	for i := 0; i < len(records); i++ {
+		document, ok := generateSalesInvoiceRegisterXML(records[i].InvoiceId, enterpriseId)
+		if !ok.Ok {
+			return false
+		}
+
+		contentType := "application/xml"
+		if s.InvoiceRegister == "V" {
+			contentType = "text/xml; charset=utf-8"
+			document = []byte(xml.Header + `<soapenv:Envelope xmlns:soapenv="` + SOAP_ENVELOPE_NAMESPACE + `"><soapenv:Header></soapenv:Header><soapenv:Body>` + strings.TrimPrefix(string(document), xml.Header) + `</soapenv:Body></soapenv:Envelope>`)
+		}
+
+		status := "S"
+		var response string
+		resp, err := client.Post(s.InvoiceRegisterUrl, contentType, bytes.NewReader(document))
+		if err != nil {
+			status = "E"
+			response = err.Error()
+		} else {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			response = string(body)
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				status = "E"
+			}
+		}
+
+		now := time.Now()
+		result := dbOrm.Model(&SalesInvoiceRegister{}).Where("id = ? AND enterprise = ?", records[i].Id, enterpriseId).Updates(map[string]interface{}{
+			"submission_status":   status,
+			"submission_date":     now,
+			"submission_response": response,
+		})
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			return false
+		}
+		if status != "S" {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,532 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// How the landed cost is split across the lines of the purchase delivery notes
+const (
+	LANDED_COST_ALLOCATION_VALUE    = "V" // Price * quantity of the line
+	LANDED_COST_ALLOCATION_WEIGHT   = "W" // Weight of the product * quantity of the line
+	LANDED_COST_ALLOCATION_VOLUME   = "M" // Width * height * depth of the product * quantity of the line
+	LANDED_COST_ALLOCATION_QUANTITY = "Q" // Quantity of the line
+)
+
+// An extra cost of a purchase (freight, customs duties, insurance...) that is added to the cost of the products received in one or more purchase delivery notes.
+// The amount is taken from a purchase invoice of the carrier, the customs agent, etc., or entered manually.
+type LandedCost struct {
+	Id                int64            `json:"id" gorm:"index:landed_cost_id_enterprise,unique:true,priority:1"`
+	DateCreated       time.Time        `json:"dateCreated" gorm:"type:timestamp(3) with time zone;not null:true;index:landed_cost_date_created,sort:desc"`
+	Description       string           `json:"description" gorm:"type:character varying(150);not null:true"`
+	Type              string           `json:"type" gorm:"type:character(1);not null:true"`             // F = Freight, D = Customs duties, I = Insurance, O = Other
+	AllocationMethod  string           `json:"allocationMethod" gorm:"type:character(1);not null:true"` // V = Value, W = Weight, M = Volume, Q = Quantity
+	PurchaseInvoiceId *int64           `json:"purchaseInvoiceId" gorm:"column:purchase_invoice"`
+	PurchaseInvoice   *PurchaseInvoice `json:"purchaseInvoice" gorm:"foreignKey:PurchaseInvoiceId,EnterpriseId;references:Id,EnterpriseId"`
+	Amount            float64          `json:"amount" gorm:"type:numeric(14,6);not null:true"` // Total without VAT of the purchase invoice, or the manual amount
+	Allocated         bool             `json:"allocated" gorm:"not null:true"`
+	DateAllocated     *time.Time       `json:"dateAllocated" gorm:"type:timestamp(3) with time zone"`
+	EnterpriseId      int32            `json:"-" gorm:"column:enterprise;not null:true;index:landed_cost_id_enterprise,unique:true,priority:2"`
+	Enterprise        Settings         `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (l *LandedCost) TableName() string {
+	return "landed_cost"
+}
+
+func getLandedCosts(enterpriseId int32) []LandedCost {
+	var landedCosts []LandedCost = make([]LandedCost, 0)
+	result := dbOrm.Model(&LandedCost{}).Where("enterprise = ?", enterpriseId).Order("date_created DESC").Preload(clause.Associations).Find(&landedCosts)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return landedCosts
+}
+
+func getLandedCostRow(landedCostId int64) LandedCost {
+	var landedCost LandedCost
+	result := dbOrm.Model(&LandedCost{}).Where("id = ?", landedCostId).Preload(clause.Associations).First(&landedCost)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return landedCost
+}
+
+func (l *LandedCost) isValid() bool {
+	return !(len(l.Description) == 0 || len(l.Description) > 150 || (l.Type != "F" && l.Type != "D" && l.Type != "I" && l.Type != "O") || (l.AllocationMethod != LANDED_COST_ALLOCATION_VALUE && l.AllocationMethod != LANDED_COST_ALLOCATION_WEIGHT && l.AllocationMethod != LANDED_COST_ALLOCATION_VOLUME && l.AllocationMethod != LANDED_COST_ALLOCATION_QUANTITY) || (l.PurchaseInvoiceId != nil && *l.PurchaseInvoiceId <= 0) || (l.PurchaseInvoiceId == nil && l.Amount <= 0))
+}
+
+func (l *LandedCost) BeforeCreate(tx *gorm.DB) (err error) {
+	var landedCost LandedCost
+	tx.Model(&LandedCost{}).Last(&landedCost)
+	l.Id = landedCost.Id + 1
+	return nil
+}
+
+// Copies the amount of the purchase invoice to the landed cost. Returns false if the invoice doesn't exist.
+func (l *LandedCost) setAmountFromPurchaseInvoice() bool {
+	if l.PurchaseInvoiceId == nil {
+		return true
+	}
+	invoice := getPurchaseInvoiceRow(*l.PurchaseInvoiceId)
+	if invoice.Id <= 0 || invoice.EnterpriseId != l.EnterpriseId || invoice.TotalWithDiscount <= 0 {
+		return false
+	}
+	l.Amount = invoice.TotalWithDiscount
+	return true
+}
+
+func (l *LandedCost) insertLandedCost() bool {
+	if !l.isValid() || !l.setAmountFromPurchaseInvoice() {
+		return false
+	}
+
+	l.DateCreated = time.Now()
+	l.Allocated = false
+	l.DateAllocated = nil
+
+	result := dbOrm.Create(&l)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (l *LandedCost) updateLandedCost() bool {
+	if l.Id <= 0 || !l.isValid() || !l.setAmountFromPurchaseInvoice() {
+		return false
+	}
+
+	var landedCost LandedCost
+	result := dbOrm.Where("id = ? AND enterprise = ?", l.Id, l.EnterpriseId).First(&landedCost)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	// undo the allocation before changing the landed cost
+	if landedCost.Allocated {
+		return false
+	}
+
+	landedCost.Description = l.Description
+	landedCost.Type = l.Type
+	landedCost.AllocationMethod = l.AllocationMethod
+	landedCost.PurchaseInvoiceId = l.PurchaseInvoiceId
+	landedCost.Amount = l.Amount
+
+	result = dbOrm.Save(&landedCost)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (l *LandedCost) deleteLandedCost() bool {
+	if l.Id <= 0 {
+		return false
+	}
+
+	var landedCost LandedCost
+	result := dbOrm.Where("id = ? AND enterprise = ?", l.Id, l.EnterpriseId).First(&landedCost)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	if landedCost.Allocated {
+		return false
+	}
+
+	///
+	trans := dbOrm.Begin()
+	///
+
+	result = trans.Where("landed_cost = ? AND enterprise = ?", l.Id, l.EnterpriseId).Delete(&LandedCostDeliveryNote{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("id = ? AND enterprise = ?", l.Id, l.EnterpriseId).Delete(&LandedCost{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	///
+	result = trans.Commit()
+	return result.Error == nil
+	///
+}
+
+// A purchase delivery note that receives a part of the landed cost.
+type LandedCostDeliveryNote struct {
+	EnterpriseId           int32                `json:"-" gorm:"primaryKey;column:enterprise;not null:true"`
+	Enterprise             Settings             `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+	LandedCostId           int64                `json:"landedCostId" gorm:"primaryKey;column:landed_cost;not null:true"`
+	LandedCost             LandedCost           `json:"-" gorm:"foreignKey:LandedCostId,EnterpriseId;references:Id,EnterpriseId"`
+	PurchaseDeliveryNoteId int64                `json:"purchaseDeliveryNoteId" gorm:"primaryKey;column:purchase_delivery_note;not null:true"`
+	PurchaseDeliveryNote   PurchaseDeliveryNote `json:"purchaseDeliveryNote" gorm:"foreignKey:PurchaseDeliveryNoteId,EnterpriseId;references:Id,EnterpriseId"`
+}
+
+func (n *LandedCostDeliveryNote) TableName() string {
+	return "landed_cost_delivery_note"
+}
+
+func getLandedCostDeliveryNotes(landedCostId int64, enterpriseId int32) []LandedCostDeliveryNote {
+	var deliveryNotes []LandedCostDeliveryNote = make([]LandedCostDeliveryNote, 0)
+	result := dbOrm.Model(&LandedCostDeliveryNote{}).Where("landed_cost = ? AND enterprise = ?", landedCostId, enterpriseId).Order("purchase_delivery_note ASC").Preload(clause.Associations).Find(&deliveryNotes)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return deliveryNotes
+}
+
+func (n *LandedCostDeliveryNote) insertLandedCostDeliveryNote() bool {
+	if n.LandedCostId <= 0 || n.PurchaseDeliveryNoteId <= 0 {
+		return false
+	}
+
+	landedCost := getLandedCostRow(n.LandedCostId)
+	if landedCost.Id <= 0 || landedCost.EnterpriseId != n.EnterpriseId || landedCost.Allocated {
+		return false
+	}
+	deliveryNote := getPurchaseDeliveryNoteRow(n.PurchaseDeliveryNoteId)
+	if deliveryNote.Id <= 0 || deliveryNote.EnterpriseId != n.EnterpriseId {
+		return false
+	}
+
+	result := dbOrm.Create(&n)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (n *LandedCostDeliveryNote) deleteLandedCostDeliveryNote() bool {
+	if n.LandedCostId <= 0 || n.PurchaseDeliveryNoteId <= 0 {
+		return false
+	}
+
+	landedCost := getLandedCostRow(n.LandedCostId)
+	if landedCost.Id <= 0 || landedCost.EnterpriseId != n.EnterpriseId || landedCost.Allocated {
+		return false
+	}
+
+	result := dbOrm.Where("enterprise = ? AND landed_cost = ? AND purchase_delivery_note = ?", n.EnterpriseId, n.LandedCostId, n.PurchaseDeliveryNoteId).Delete(&LandedCostDeliveryNote{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+// The part of the landed cost added to an inbound warehouse movement, kept to be able to undo the allocation.
+type LandedCostAllocation struct {
+	Id                  int64             `json:"id" gorm:"index:landed_cost_allocation_id_enterprise,unique:true,priority:1"`
+	LandedCostId        int64             `json:"landedCostId" gorm:"column:landed_cost;not null:true;index:landed_cost_allocation_landed_cost,priority:2"`
+	LandedCost          LandedCost        `json:"-" gorm:"foreignKey:LandedCostId,EnterpriseId;references:Id,EnterpriseId"`
+	WarehouseMovementId int64             `json:"warehouseMovementId" gorm:"column:warehouse_movement;not null:true"`
+	WarehouseMovement   WarehouseMovement `json:"warehouseMovement" gorm:"foreignKey:WarehouseMovementId,EnterpriseId;references:Id,EnterpriseId"`
+	ProductId           int32             `json:"productId" gorm:"column:product;not null:true"`
+	Product             Product           `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	Basis               float64           `json:"basis" gorm:"type:numeric(14,6);not null:true"` // Value, weight, volume or quantity of the line used to split the cost
+	Amount              float64           `json:"amount" gorm:"type:numeric(14,6);not null:true"`
+	PriceIncrease       float64           `json:"priceIncrease" gorm:"type:numeric(14,6);not null:true"`     // Added to the price of the warehouse movement
+	CostPriceIncrease   float64           `json:"costPriceIncrease" gorm:"type:numeric(14,6);not null:true"` // Added to the cost price of the product
+	EnterpriseId        int32             `json:"-" gorm:"column:enterprise;not null:true;index:landed_cost_allocation_id_enterprise,unique:true,priority:2;index:landed_cost_allocation_landed_cost,priority:1"`
+	Enterprise          Settings          `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (a *LandedCostAllocation) TableName() string {
+	return "landed_cost_allocation"
+}
+
+func (a *LandedCostAllocation) BeforeCreate(tx *gorm.DB) (err error) {
+	var allocation LandedCostAllocation
+	tx.Model(&LandedCostAllocation{}).Last(&allocation)
+	a.Id = allocation.Id + 1
+	return nil
+}
+
+func getLandedCostAllocations(landedCostId int64, enterpriseId int32) []LandedCostAllocation {
+	var allocations []LandedCostAllocation = make([]LandedCostAllocation, 0)
+	result := dbOrm.Model(&LandedCostAllocation{}).Where("landed_cost = ? AND enterprise = ?", landedCostId, enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&allocations)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return allocations
+}
+
+// Returns the value used to split the landed cost for a line of the delivery note.
+func getLandedCostAllocationBasis(method string, movement WarehouseMovement) float64 {
+	quantity := movement.Quantity
+	switch method {
+	case LANDED_COST_ALLOCATION_VALUE:
+		return movement.Price * quantity
+	case LANDED_COST_ALLOCATION_WEIGHT:
+		return movement.Product.Weight * quantity
+	case LANDED_COST_ALLOCATION_VOLUME:
+		return movement.Product.Width * movement.Product.Height * movement.Product.Depth * quantity
+	case LANDED_COST_ALLOCATION_QUANTITY:
+		return quantity
+	}
+	return 0
+}
+
+// Splits the amount proportionally to the bases. The last line gets the remainder, so the sum of the parts is exactly the amount.
+// Returns nil if the amount can't be split (the sum of the bases is zero).
+func splitLandedCost(amount float64, bases []float64) []float64 {
+	var total float64
+	for i := 0; i < len(bases); i++ {
+		total += bases[i]
+	}
+	if len(bases) == 0 || total <= 0 {
+		return nil
+	}
+
+	parts := make([]float64, len(bases))
+	var allocated float64
+	for i := 0; i < len(bases)-1; i++ {
+		parts[i] = toFixed(amount*bases[i]/total, 2)
+		allocated += parts[i]
+	}
+	parts[len(bases)-1] = toFixed(amount-allocated, 2)
+	return parts
+}
+
+// Adds the landed cost to the price of the inbound warehouse movements of the delivery notes, and to the cost price of the products.
+// ERROR CODES:
+// 1. The landed cost is already allocated
+// 2. There are no delivery notes or no products received in the delivery notes
+// 3. The value, weight, volume or quantity of the products received is zero, the cost can't be split
+func allocateLandedCost(landedCostId int64, enterpriseId int32, userId int32) OkAndErrorCodeReturn {
+	landedCost := getLandedCostRow(landedCostId)
+	if landedCost.Id <= 0 || landedCost.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if landedCost.Allocated {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	deliveryNotes := getLandedCostDeliveryNotes(landedCostId, enterpriseId)
+	deliveryNoteIds := make([]int64, 0)
+	for i := 0; i < len(deliveryNotes); i++ {
+		deliveryNoteIds = append(deliveryNoteIds, deliveryNotes[i].PurchaseDeliveryNoteId)
+	}
+	if len(deliveryNoteIds) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+
+	var movements []WarehouseMovement = make([]WarehouseMovement, 0)
+	result := dbOrm.Model(&WarehouseMovement{}).Where("purchase_delivery_note IN ? AND type = 'I' AND quantity > 0 AND enterprise = ?", deliveryNoteIds, enterpriseId).Order("id ASC").Preload("Product").Find(&movements)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if len(movements) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+
+	bases := make([]float64, len(movements))
+	for i := 0; i < len(movements); i++ {
+		bases[i] = getLandedCostAllocationBasis(landedCost.AllocationMethod, movements[i])
+	}
+	parts := splitLandedCost(landedCost.Amount, bases)
+	if parts == nil {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	///
+
+	// the cost is added to the average cost of the product, spread over all the units in stock
+	costPriceIncreases := make(map[int32]float64)
+	for i := 0; i < len(movements); i++ {
+		m := movements[i]
+		allocation := LandedCostAllocation{
+			LandedCostId:        landedCostId,
+			WarehouseMovementId: m.Id,
+			ProductId:           m.ProductId,
+			Basis:               bases[i],
+			Amount:              parts[i],
+			PriceIncrease:       parts[i] / m.Quantity,
+			EnterpriseId:        enterpriseId,
+		}
+		if m.Product.Stock > 0 {
+			allocation.CostPriceIncrease = parts[i] / float64(m.Product.Stock)
+		}
+		costPriceIncreases[m.ProductId] += allocation.CostPriceIncrease
+
+		if !addLandedCostWarehouseMovementPrice(m.Id, enterpriseId, allocation.PriceIncrease, *trans) {
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+
+		result = trans.Create(&allocation)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+	}
+
+	for productId, costPriceIncrease := range costPriceIncreases {
+		if !addLandedCostProductCostPrice(productId, enterpriseId, costPriceIncrease, *trans) {
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+	}
+
+	now := time.Now()
+	result = trans.Model(&LandedCost{}).Where("id = ? AND enterprise = ?", landedCostId, enterpriseId).Updates(map[string]interface{}{
+		"allocated":      true,
+		"date_allocated": now,
+	})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(enterpriseId, "landed_cost", int(landedCostId), userId, "U")
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+// Removes the landed cost from the price of the warehouse movements and the cost price of the products.
+func undoLandedCostAllocation(landedCostId int64, enterpriseId int32, userId int32) bool {
+	landedCost := getLandedCostRow(landedCostId)
+	if landedCost.Id <= 0 || landedCost.EnterpriseId != enterpriseId || !landedCost.Allocated {
+		return false
+	}
+
+	allocations := getLandedCostAllocations(landedCostId, enterpriseId)
+
+	///
+	trans := dbOrm.Begin()
+	///
+
+	costPriceIncreases := make(map[int32]float64)
+	for i := 0; i < len(allocations); i++ {
+		if !addLandedCostWarehouseMovementPrice(allocations[i].WarehouseMovementId, enterpriseId, -allocations[i].PriceIncrease, *trans) {
+			return false
+		}
+		costPriceIncreases[allocations[i].ProductId] += allocations[i].CostPriceIncrease
+	}
+
+	for productId, costPriceIncrease := range costPriceIncreases {
+		if !addLandedCostProductCostPrice(productId, enterpriseId, -costPriceIncrease, *trans) {
+			return false
+		}
+	}
+
+	result := trans.Where("landed_cost = ? AND enterprise = ?", landedCostId, enterpriseId).Delete(&LandedCostAllocation{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Model(&LandedCost{}).Where("id = ? AND enterprise = ?", landedCostId, enterpriseId).Updates(map[string]interface{}{
+		"allocated":      false,
+		"date_allocated": nil,
+	})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return false
+	}
+	///
+
+	insertTransactionalLog(enterpriseId, "landed_cost", int(landedCostId), userId, "U")
+	return true
+}
+
+// Adds the landed cost per unit to the price of the warehouse movement, and recalculates the total amount.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func addLandedCostWarehouseMovementPrice(movementId int64, enterpriseId int32, priceIncrease float64, trans gorm.DB) bool {
+	var movement WarehouseMovement
+	result := trans.Model(&WarehouseMovement{}).Where("id = ? AND enterprise = ?", movementId, enterpriseId).First(&movement)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	movement.Price += priceIncrease
+	if movement.Price < 0 {
+		movement.Price = 0
+	}
+	movement.TotalAmount = absf((movement.Price * movement.Quantity) * (1 + (movement.VatPercent / 100)))
+
+	result = trans.Model(&WarehouseMovement{}).Where("id = ? AND enterprise = ?", movementId, enterpriseId).Updates(map[string]interface{}{
+		"price":        movement.Price,
+		"total_amount": movement.TotalAmount,
+	})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return addWarehouseMovementCostAmount(movementId, enterpriseId, priceIncrease*absf(movement.Quantity), trans)
+}
+
+// Adds the landed cost per unit in stock to the cost price of the product.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func addLandedCostProductCostPrice(productId int32, enterpriseId int32, costPriceIncrease float64, trans gorm.DB) bool {
+	if costPriceIncrease == 0 {
+		return true
+	}
+
+	var product Product
+	result := trans.Model(&Product{}).Where("id = ? AND enterprise = ?", productId, enterpriseId).First(&product)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	product.CostPrice += costPriceIncrease
+	if product.CostPrice < 0 {
+		product.CostPrice = 0
+	}
+
+	result = trans.Model(&Product{}).Where("id = ? AND enterprise = ?", productId, enterpriseId).Update("cost_price", product.CostPrice)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
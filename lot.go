@@ -0,0 +1,616 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A batch of a product with lot tracking, used to trace the movements of the batch for recalls
+type ProductLot struct {
+	Id           int64      `json:"id" gorm:"index:product_lot_id_enterprise,unique:true,priority:1"`
+	ProductId    int32      `json:"productId" gorm:"column:product;not null:true;index:product_lot_number,unique:true,priority:2"`
+	Product      Product    `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	LotNumber    string     `json:"lotNumber" gorm:"column:lot_number;type:character varying(40);not null:true;index:product_lot_number,unique:true,priority:3"`
+	ExpiryDate   *time.Time `json:"expiryDate" gorm:"column:expiry_date;type:timestamp(3) with time zone"`
+	DateCreated  time.Time  `json:"dateCreated" gorm:"column:date_created;type:timestamp(3) with time zone;not null:true"`
+	EnterpriseId int32      `json:"-" gorm:"column:enterprise;not null:true;index:product_lot_id_enterprise,unique:true,priority:2;index:product_lot_number,unique:true,priority:1"`
+	Enterprise   Settings   `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (l *ProductLot) TableName() string {
+	return "product_lot"
+}
+
+func getProductLots(productId int32, enterpriseId int32) []ProductLot {
+	var lots []ProductLot = make([]ProductLot, 0)
+	result := dbOrm.Model(&ProductLot{}).Where("product = ? AND enterprise = ?", productId, enterpriseId).Order("expiry_date ASC NULLS LAST, id ASC").Find(&lots)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return lots
+}
+
+func getProductLotRow(lotId int64) ProductLot {
+	l := ProductLot{}
+	result := dbOrm.Model(&ProductLot{}).Where("id = ?", lotId).First(&l)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return l
+}
+
+func (l *ProductLot) BeforeCreate(tx *gorm.DB) (err error) {
+	var productLot ProductLot
+	tx.Model(&ProductLot{}).Last(&productLot)
+	l.Id = productLot.Id + 1
+	return nil
+}
+
+// Only the expiry date of the lot can be changed
+func (l *ProductLot) updateProductLot() bool {
+	if l.Id <= 0 {
+		return false
+	}
+
+	var productLot ProductLot
+	result := dbOrm.Model(&ProductLot{}).Where("id = ? AND enterprise = ?", l.Id, l.EnterpriseId).First(&productLot)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	productLot.ExpiryDate = l.ExpiryDate
+
+	result = dbOrm.Save(&productLot)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+// Returns the lot of the product with this lot number, creating it if it doesn't exist yet.
+// The expiry date is only set when the lot is created, or if the existing lot doesn't have one.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func getOrCreateProductLot(productId int32, lotNumber string, expiryDate *time.Time, enterpriseId int32, trans gorm.DB) (bool, ProductLot) {
+	var lots []ProductLot
+	result := trans.Model(&ProductLot{}).Where("product = ? AND lot_number = ? AND enterprise = ?", productId, lotNumber, enterpriseId).Limit(1).Find(&lots)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false, ProductLot{}
+	}
+
+	if len(lots) > 0 {
+		lot := lots[0]
+		if lot.ExpiryDate == nil && expiryDate != nil {
+			lot.ExpiryDate = expiryDate
+			result = trans.Model(&ProductLot{}).Where("id = ?", lot.Id).Update("expiry_date", expiryDate)
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				trans.Rollback()
+				return false, ProductLot{}
+			}
+		}
+		return true, lot
+	}
+
+	lot := ProductLot{
+		ProductId:    productId,
+		LotNumber:    lotNumber,
+		ExpiryDate:   expiryDate,
+		DateCreated:  time.Now(),
+		EnterpriseId: enterpriseId,
+	}
+	result = trans.Create(&lot)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false, ProductLot{}
+	}
+	return true, lot
+}
+
+// Stock of a lot of a product in a warehouse
+type StockLot struct {
+	ProductId    int32      `json:"productId" gorm:"primaryKey;column:product;not null:true"`
+	Product      Product    `json:"-" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	WarehouseId  string     `json:"warehouseId" gorm:"primaryKey;column:warehouse;not null:true;type:character(2)"`
+	Warehouse    Warehouse  `json:"-" gorm:"foreignKey:WarehouseId,EnterpriseId;references:Id,EnterpriseId"`
+	LotId        int64      `json:"lotId" gorm:"primaryKey;column:lot;not null:true"`
+	Lot          ProductLot `json:"lot" gorm:"foreignKey:LotId,EnterpriseId;references:Id,EnterpriseId"`
+	Quantity     float64    `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
+	EnterpriseId int32      `json:"-" gorm:"primaryKey;column:enterprise;not null:true"`
+	Enterprise   Settings   `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (s *StockLot) TableName() string {
+	return "stock_lot"
+}
+
+func getStockLot(productId int32, enterpriseId int32) []StockLot {
+	var stock []StockLot = make([]StockLot, 0)
+	result := dbOrm.Model(&StockLot{}).Where("stock_lot.product = ? AND stock_lot.enterprise = ? AND stock_lot.quantity <> 0", productId, enterpriseId).Joins("Lot").Order("stock_lot.warehouse ASC, \"Lot\".expiry_date ASC NULLS LAST, stock_lot.lot ASC").Find(&stock)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return stock
+}
+
+// Returns the lots with stock of the product in the warehouse, the lot that expires first goes first (First Expired, First Out).
+func getFefoStockLots(productId int32, warehouseId string, enterpriseId int32, trans *gorm.DB) []StockLot {
+	if trans == nil {
+		trans = dbOrm
+	}
+	var stock []StockLot = make([]StockLot, 0)
+	result := trans.Model(&StockLot{}).Where("stock_lot.product = ? AND stock_lot.warehouse = ? AND stock_lot.enterprise = ? AND stock_lot.quantity > 0", productId, warehouseId, enterpriseId).Joins("Lot").Order("\"Lot\".expiry_date ASC NULLS LAST, stock_lot.lot ASC").Find(&stock)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return stock
+}
+
+// Adds a quantity to the stock of the lot in the warehouse. This function will substract if the quantity is negative.
+// Creates the stock row if it doesn't exists.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func addQuantityStockLot(productId int32, warehouseId string, lotId int64, quantity float64, enterpriseId int32, trans gorm.DB) bool {
+	var stock []StockLot
+	result := trans.Model(&StockLot{}).Where("product = ? AND warehouse = ? AND lot = ? AND enterprise = ?", productId, warehouseId, lotId, enterpriseId).Limit(1).Find(&stock)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	if len(stock) == 0 {
+		result = trans.Create(&StockLot{
+			ProductId:    productId,
+			WarehouseId:  warehouseId,
+			LotId:        lotId,
+			Quantity:     quantity,
+			EnterpriseId: enterpriseId,
+		})
+	} else {
+		result = trans.Model(&StockLot{}).Where("product = ? AND warehouse = ? AND lot = ? AND enterprise = ?", productId, warehouseId, lotId, enterpriseId).Update("quantity", roundQuantity(stock[0].Quantity+quantity))
+	}
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
+// Quantity of a lot that has entered or left the warehouse in a warehouse movement.
+// The quantity is positive if the lot has entered, and negative if it has left.
+type WarehouseMovementLot struct {
+	WarehouseMovementId int64             `json:"warehouseMovementId" gorm:"primaryKey;column:warehouse_movement;not null:true"`
+	WarehouseMovement   WarehouseMovement `json:"-" gorm:"foreignKey:WarehouseMovementId,EnterpriseId;references:Id,EnterpriseId"`
+	LotId               int64             `json:"lotId" gorm:"primaryKey;column:lot;not null:true;index:warehouse_movement_lot_lot"`
+	Lot                 ProductLot        `json:"lot" gorm:"foreignKey:LotId,EnterpriseId;references:Id,EnterpriseId"`
+	Quantity            float64           `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
+	EnterpriseId        int32             `json:"-" gorm:"primaryKey;column:enterprise;not null:true"`
+	Enterprise          Settings          `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (w *WarehouseMovementLot) TableName() string {
+	return "warehouse_movement_lot"
+}
+
+func getWarehouseMovementLots(warehouseMovementId int64, enterpriseId int32) []WarehouseMovementLot {
+	var lots []WarehouseMovementLot = make([]WarehouseMovementLot, 0)
+	result := dbOrm.Model(&WarehouseMovementLot{}).Where("warehouse_movement_lot.warehouse_movement = ? AND warehouse_movement_lot.enterprise = ?", warehouseMovementId, enterpriseId).Joins("Lot").Order("warehouse_movement_lot.lot ASC").Find(&lots)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return lots
+}
+
+// Inbound movements add stock to the lot, outbound movements take the stock from the lot (if specified) and then from the lots that expire first.
+// Inventory regularizations don't change the stock of the lots.
+func isWarehouseMovementInbound(m *WarehouseMovement) bool {
+	return m.Type == "I"
+}
+
+// Distributes the quantity of a new warehouse movement of a product with lot tracking between its lots, and updates the stock of the lots.
+// If the lot stock is not enough for an outbound movement, the rest of the quantity is left without a lot.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func allocateWarehouseMovementLots(m *WarehouseMovement, trans gorm.DB) bool {
+	if m.Type == "R" {
+		return true
+	}
+
+	var trackLots bool
+	result := trans.Model(&Product{}).Where("id = ?", m.ProductId).Pluck("track_lots", &trackLots)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	if !trackLots {
+		return true
+	}
+
+	m.LotNumber = strings.TrimSpace(m.LotNumber)
+	if len(m.LotNumber) > 40 {
+		trans.Rollback()
+		return false
+	}
+
+	if isWarehouseMovementInbound(m) {
+		if len(m.LotNumber) == 0 {
+			return true
+		}
+		ok, lot := getOrCreateProductLot(m.ProductId, m.LotNumber, m.ExpiryDate, m.EnterpriseId, trans)
+		if !ok {
+			return false
+		}
+		return addWarehouseMovementLot(m, lot.Id, absf(m.Quantity), trans)
+	}
+
+	stock := getFefoStockLots(m.ProductId, m.WarehouseId, m.EnterpriseId, &trans)
+	if len(m.LotNumber) > 0 { // the lot that has been chosen goes first
+		for i := 0; i < len(stock); i++ {
+			if stock[i].Lot.LotNumber == m.LotNumber {
+				stock = append([]StockLot{stock[i]}, append(stock[:i:i], stock[i+1:]...)...)
+				break
+			}
+		}
+	}
+
+	fefo := allocateFefo(stock, absf(m.Quantity))
+	for i := 0; i < len(fefo); i++ {
+		if !addWarehouseMovementLot(m, fefo[i].LotId, -fefo[i].Quantity, trans) {
+			return false
+		}
+	}
+	return true
+}
+
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func addWarehouseMovementLot(m *WarehouseMovement, lotId int64, quantity float64, trans gorm.DB) bool {
+	result := trans.Create(&WarehouseMovementLot{
+		WarehouseMovementId: m.Id,
+		LotId:               lotId,
+		Quantity:            quantity,
+		EnterpriseId:        m.EnterpriseId,
+	})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return addQuantityStockLot(m.ProductId, m.WarehouseId, lotId, quantity, m.EnterpriseId, trans)
+}
+
+// Undoes the lot allocation of a warehouse movement, giving the quantity back to the stock of the lots.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func deallocateWarehouseMovementLots(m *WarehouseMovement, trans gorm.DB) bool {
+	var lots []WarehouseMovementLot
+	result := trans.Model(&WarehouseMovementLot{}).Where("warehouse_movement = ? AND enterprise = ?", m.Id, m.EnterpriseId).Find(&lots)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	for i := 0; i < len(lots); i++ {
+		if !addQuantityStockLot(m.ProductId, m.WarehouseId, lots[i].LotId, -lots[i].Quantity, m.EnterpriseId, trans) {
+			return false
+		}
+	}
+
+	result = trans.Where("warehouse_movement = ? AND enterprise = ?", m.Id, m.EnterpriseId).Delete(&WarehouseMovementLot{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
+// The lots that have left the origin warehouse enter the destination warehouse in a transfer between warehouses.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func transferWarehouseMovementLots(wmOut *WarehouseMovement, wmIn *WarehouseMovement, trans gorm.DB) bool {
+	var lots []WarehouseMovementLot
+	result := trans.Model(&WarehouseMovementLot{}).Where("warehouse_movement = ? AND enterprise = ?", wmOut.Id, wmOut.EnterpriseId).Find(&lots)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	for i := 0; i < len(lots); i++ {
+		if !addWarehouseMovementLot(wmIn, lots[i].LotId, -lots[i].Quantity, trans) {
+			return false
+		}
+	}
+	return true
+}
+
+type SetWarehouseMovementLot struct {
+	WarehouseMovementId int64      `json:"warehouseMovementId"`
+	LotNumber           string     `json:"lotNumber"`
+	ExpiryDate          *time.Time `json:"expiryDate"`
+}
+
+// Sets or changes the lot of an existing inbound warehouse movement, for example, when the lot was not known when the goods were received.
+// ERROR CODES:
+// 1. The product doesn't have lot tracking
+// 2. The warehouse movement is not an input
+// 3. The stock of the lot has already been used
+func (s *SetWarehouseMovementLot) setWarehouseMovementLot(enterpriseId int32) OkAndErrorCodeReturn {
+	s.LotNumber = strings.TrimSpace(s.LotNumber)
+	if s.WarehouseMovementId <= 0 || len(s.LotNumber) == 0 || len(s.LotNumber) > 40 {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	m := getWarehouseMovementRow(s.WarehouseMovementId)
+	if m.Id <= 0 || m.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	product := getProductRow(m.ProductId)
+	if !product.TrackLots {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+	if !isWarehouseMovementInbound(&m) {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+
+	// the previous lot can only be replaced if its stock has not left the warehouse yet
+	previousLots := getWarehouseMovementLots(m.Id, enterpriseId)
+	for i := 0; i < len(previousLots); i++ {
+		stock := getStockLotRow(m.ProductId, m.WarehouseId, previousLots[i].LotId, enterpriseId)
+		if stock.Quantity < previousLots[i].Quantity {
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+		}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	if !deallocateWarehouseMovementLots(&m, *trans) {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	m.LotNumber = s.LotNumber
+	m.ExpiryDate = s.ExpiryDate
+	if !allocateWarehouseMovementLots(&m, *trans) {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result := trans.Commit()
+	return OkAndErrorCodeReturn{Ok: result.Error == nil}
+	///
+}
+
+func getStockLotRow(productId int32, warehouseId string, lotId int64, enterpriseId int32) StockLot {
+	s := StockLot{}
+	result := dbOrm.Model(&StockLot{}).Where("product = ? AND warehouse = ? AND lot = ? AND enterprise = ?", productId, warehouseId, lotId, enterpriseId).Limit(1).Find(&s)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return s
+}
+
+// Lot number for the output of a manufacturing order when it's not specified: the date of manufacture and the order number.
+func generateManufacturingLotNumber(date time.Time, orderId int64) string {
+	return date.Format("20060102") + "-" + strconv.Itoa(int(orderId))
+}
+
+type FefoLot struct {
+	LotId      int64      `json:"lotId"`
+	LotNumber  string     `json:"lotNumber"`
+	ExpiryDate *time.Time `json:"expiryDate"`
+	Quantity   float64    `json:"quantity"`
+}
+
+// Takes the quantity from the lots in the order that they are given, until the quantity is completed or there are no more lots.
+func allocateFefo(stock []StockLot, quantity float64) []FefoLot {
+	lots := make([]FefoLot, 0)
+	for i := 0; i < len(stock) && quantity > 0; i++ {
+		if stock[i].Quantity <= 0 {
+			continue
+		}
+		q := stock[i].Quantity
+		if q > quantity {
+			q = quantity
+		}
+		lots = append(lots, FefoLot{LotId: stock[i].LotId, LotNumber: stock[i].Lot.LotNumber, ExpiryDate: stock[i].Lot.ExpiryDate, Quantity: q})
+		quantity = roundQuantity(quantity - q)
+	}
+	return lots
+}
+
+type SalesOrderFefoSuggestion struct {
+	SalesOrderDetailId int64     `json:"salesOrderDetailId"`
+	ProductId          int32     `json:"productId"`
+	ProductName        string    `json:"productName"`
+	WarehouseId        string    `json:"warehouseId"`
+	QuantityPending    float64   `json:"quantityPending"` // Quantity not in a delivery note yet
+	QuantityWithoutLot float64   `json:"quantityWithoutLot"`
+	Lots               []FefoLot `json:"lots"`
+}
+
+// Suggests the lots to prepare the pending lines of products with lot tracking of a sales order, the lot that expires first goes first.
+// The lots are suggested taking into account the lines before, so two lines of the same product don't get the same stock.
+func getSalesOrderFefoSuggestion(orderId int64, enterpriseId int32) []SalesOrderFefoSuggestion {
+	suggestions := make([]SalesOrderFefoSuggestion, 0)
+	order := getSalesOrderRow(orderId)
+	if order.Id <= 0 || order.EnterpriseId != enterpriseId {
+		return suggestions
+	}
+
+	details := getSalesOrderDetail(orderId, enterpriseId)
+	stocks := make(map[string][]StockLot) // Key: product ID and warehouse, Value: lots with stock not suggested yet
+	for i := 0; i < len(details); i++ {
+		d := details[i]
+		if !d.Product.TrackLots || d.QuantityDeliveryNote >= d.Quantity || d.Cancelled {
+			continue
+		}
+
+		key := strconv.Itoa(int(d.ProductId)) + "/" + d.WarehouseId
+		stock, ok := stocks[key]
+		if !ok {
+			stock = getFefoStockLots(d.ProductId, d.WarehouseId, enterpriseId, nil)
+		}
+
+		s := SalesOrderFefoSuggestion{
+			SalesOrderDetailId: d.Id,
+			ProductId:          d.ProductId,
+			ProductName:        d.Product.Name,
+			WarehouseId:        d.WarehouseId,
+			QuantityPending:    roundQuantity(d.Quantity - d.QuantityDeliveryNote),
+		}
+		s.Lots = allocateFefo(stock, s.QuantityPending)
+		s.QuantityWithoutLot = s.QuantityPending
+		for j := 0; j < len(s.Lots); j++ {
+			s.QuantityWithoutLot = roundQuantity(s.QuantityWithoutLot - s.Lots[j].Quantity)
+			for k := 0; k < len(stock); k++ {
+				if stock[k].LotId == s.Lots[j].LotId {
+					stock[k].Quantity = roundQuantity(stock[k].Quantity - s.Lots[j].Quantity)
+				}
+			}
+		}
+		stocks[key] = stock
+
+		suggestions = append(suggestions, s)
+	}
+	return suggestions
+}
+
+type LotRecall struct {
+	Lot        ProductLot          `json:"lot"`
+	Receipts   []LotRecallReceipt  `json:"receipts"`
+	Deliveries []LotRecallDelivery `json:"deliveries"`
+	Components []LotRecallLot      `json:"components"` // Lots of the components that this lot was made from, including the components of the components
+}
+
+// A purchase delivery note where the lot was received
+type LotRecallReceipt struct {
+	SupplierId             int32     `json:"supplierId"`
+	SupplierName           string    `json:"supplierName"`
+	PurchaseDeliveryNoteId int64     `json:"purchaseDeliveryNoteId"`
+	DeliveryNoteName       string    `json:"deliveryNoteName"`
+	Quantity               float64   `json:"quantity"`
+	DateCreated            time.Time `json:"dateCreated"`
+}
+
+// A sales delivery note where the lot was sent to a customer
+type LotRecallDelivery struct {
+	CustomerId          int32     `json:"customerId"`
+	CustomerName        string    `json:"customerName"`
+	SalesDeliveryNoteId int64     `json:"salesDeliveryNoteId"`
+	DeliveryNoteName    string    `json:"deliveryNoteName"`
+	SalesOrderId        *int64    `json:"salesOrderId"`
+	SalesOrderName      *string   `json:"salesOrderName"`
+	Quantity            float64   `json:"quantity"`
+	DateCreated         time.Time `json:"dateCreated"`
+}
+
+type LotRecallLot struct {
+	LotId       int64      `json:"lotId"`
+	LotNumber   string     `json:"lotNumber"`
+	ExpiryDate  *time.Time `json:"expiryDate"`
+	ProductId   int32      `json:"productId"`
+	ProductName string     `json:"productName"`
+	Quantity    float64    `json:"quantity"`
+	ParentLotId int64      `json:"parentLotId"` // Lot that was made using this component lot
+}
+
+// Returns every customer and delivery note the lot went to, where it was received from, and the component lots it was made from.
+func getLotRecall(lotId int64, enterpriseId int32) LotRecall {
+	recall := LotRecall{
+		Receipts:   make([]LotRecallReceipt, 0),
+		Deliveries: make([]LotRecallDelivery, 0),
+		Components: make([]LotRecallLot, 0),
+	}
+	recall.Lot = getProductLotRow(lotId)
+	if recall.Lot.Id <= 0 || recall.Lot.EnterpriseId != enterpriseId {
+		return LotRecall{}
+	}
+
+	sqlStatement := `SELECT suppliers.id,suppliers.name,purchase_delivery_note.id,purchase_delivery_note.delivery_note_name,SUM(warehouse_movement_lot.quantity),purchase_delivery_note.date_created FROM warehouse_movement_lot INNER JOIN warehouse_movement ON warehouse_movement.id=warehouse_movement_lot.warehouse_movement INNER JOIN purchase_delivery_note ON purchase_delivery_note.id=warehouse_movement.purchase_delivery_note INNER JOIN suppliers ON suppliers.id=purchase_delivery_note.supplier WHERE warehouse_movement_lot.lot=$1 AND warehouse_movement_lot.enterprise=$2 GROUP BY suppliers.id,suppliers.name,purchase_delivery_note.id,purchase_delivery_note.delivery_note_name,purchase_delivery_note.date_created ORDER BY purchase_delivery_note.date_created ASC`
+	rows, err := db.Query(sqlStatement, lotId, enterpriseId)
+	if err != nil {
+		log("DB", err.Error())
+		return recall
+	}
+	for rows.Next() {
+		r := LotRecallReceipt{}
+		rows.Scan(&r.SupplierId, &r.SupplierName, &r.PurchaseDeliveryNoteId, &r.DeliveryNoteName, &r.Quantity, &r.DateCreated)
+		recall.Receipts = append(recall.Receipts, r)
+	}
+	rows.Close()
+
+	sqlStatement = `SELECT customer.id,customer.name,sales_delivery_note.id,sales_delivery_note.delivery_note_name,sales_order.id,sales_order.order_name,SUM(-warehouse_movement_lot.quantity),sales_delivery_note.date_created FROM warehouse_movement_lot INNER JOIN warehouse_movement ON warehouse_movement.id=warehouse_movement_lot.warehouse_movement INNER JOIN sales_delivery_note ON sales_delivery_note.id=warehouse_movement.sales_delivery_note INNER JOIN customer ON customer.id=sales_delivery_note.customer LEFT JOIN sales_order ON sales_order.id=warehouse_movement.sales_order WHERE warehouse_movement_lot.lot=$1 AND warehouse_movement_lot.enterprise=$2 GROUP BY customer.id,customer.name,sales_delivery_note.id,sales_delivery_note.delivery_note_name,sales_order.id,sales_order.order_name,sales_delivery_note.date_created HAVING SUM(-warehouse_movement_lot.quantity)<>0 ORDER BY sales_delivery_note.date_created ASC`
+	rows, err = db.Query(sqlStatement, lotId, enterpriseId)
+	if err != nil {
+		log("DB", err.Error())
+		return recall
+	}
+	for rows.Next() {
+		d := LotRecallDelivery{}
+		rows.Scan(&d.CustomerId, &d.CustomerName, &d.SalesDeliveryNoteId, &d.DeliveryNoteName, &d.SalesOrderId, &d.SalesOrderName, &d.Quantity, &d.DateCreated)
+		recall.Deliveries = append(recall.Deliveries, d)
+	}
+	rows.Close()
+
+	// the component lots are the lots consumed by the complex manufacturing orders that made this lot
+	visited := map[int64]bool{lotId: true}
+	pending := []int64{lotId}
+	for len(pending) > 0 {
+		parentLotId := pending[0]
+		pending = pending[1:]
+
+		components := getLotComponents(parentLotId, enterpriseId)
+		for i := 0; i < len(components); i++ {
+			if visited[components[i].LotId] {
+				continue
+			}
+			visited[components[i].LotId] = true
+			pending = append(pending, components[i].LotId)
+			recall.Components = append(recall.Components, components[i])
+		}
+	}
+
+	return recall
+}
+
+// Returns the lots consumed by the complex manufacturing orders where this lot was an output.
+func getLotComponents(lotId int64, enterpriseId int32) []LotRecallLot {
+	components := make([]LotRecallLot, 0)
+	sqlStatement := `SELECT product_lot.id,product_lot.lot_number,product_lot.expiry_date,product.id,product.name,SUM(-warehouse_movement_lot.quantity) FROM complex_manufacturing_order_manufacturing_order component INNER JOIN warehouse_movement_lot ON warehouse_movement_lot.warehouse_movement=component.warehouse_movement INNER JOIN product_lot ON product_lot.id=warehouse_movement_lot.lot INNER JOIN product ON product.id=product_lot.product WHERE component.type='I' AND component.enterprise=$2 AND component.complex_manufacturing_order IN (SELECT output.complex_manufacturing_order FROM complex_manufacturing_order_manufacturing_order output INNER JOIN warehouse_movement_lot ON warehouse_movement_lot.warehouse_movement=output.warehouse_movement WHERE output.type='O' AND warehouse_movement_lot.lot=$1) GROUP BY product_lot.id,product_lot.lot_number,product_lot.expiry_date,product.id,product.name ORDER BY product.name ASC,product_lot.lot_number ASC`
+	rows, err := db.Query(sqlStatement, lotId, enterpriseId)
+	if err != nil {
+		log("DB", err.Error())
+		return components
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := LotRecallLot{ParentLotId: lotId}
+		rows.Scan(&c.LotId, &c.LotNumber, &c.ExpiryDate, &c.ProductId, &c.ProductName, &c.Quantity)
+		components = append(components, c)
+	}
+	return components
+}
@@ -12,42 +12,72 @@ package main
 
 import (
 	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"net"
 	"net/smtp"
 	"strings"
 
+	"github.com/google/uuid"
 	strip "github.com/grokify/html-strip-tags-go"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
+// File attached to an email, such as the PDF of a report.
+type EmailAttachment struct {
+	FileName    string
+	ContentType string
+	Content     []byte
+}
+
 func sendEmail(destinationAddress string, destinationAddressName string, subject string, innerText string, enterpriseId int32) bool {
+	return sendEmailWithAttachments(destinationAddress, destinationAddressName, subject, innerText, nil, enterpriseId)
+}
+
+func sendEmailWithAttachments(destinationAddress string, destinationAddressName string, subject string, innerText string, attachments []EmailAttachment, enterpriseId int32) bool {
+	ok, _ := sendEmailWithEmailLog(destinationAddress, destinationAddressName, subject, innerText, attachments, enterpriseId)
+	return ok
+}
+
+// Sends the email and returns the ID of the record in the email log, or nil if the email was not logged.
+func sendEmailWithEmailLog(destinationAddress string, destinationAddressName string, subject string, innerText string, attachments []EmailAttachment, enterpriseId int32) (bool, *int64) {
 	s := getSettingsRecordById(enterpriseId)
 
+	var emailLogId *int64
 	if s.SettingsEmail.Email != "_" {
 		el := EmailLog{EmailFrom: s.SettingsEmail.EmailFrom, NameFrom: s.SettingsEmail.NameFrom, DestinationEmail: destinationAddress, DestinationName: destinationAddressName, Subject: subject, Content: innerText, EnterpriseId: enterpriseId}
-		el.insertEmailLog()
+		if el.insertEmailLog() {
+			emailLogId = &el.Id
+		}
 	}
 
 	if s.SettingsEmail.Email == "_" {
-		return false
+		return false, emailLogId
 	} else if s.SettingsEmail.Email == "S" {
-		sendEmailSendgrid(s.SettingsEmail.SendGridKey, s.SettingsEmail.EmailFrom, s.SettingsEmail.NameFrom, destinationAddress, destinationAddressName, subject, innerText)
+		return sendEmailSendgrid(s.SettingsEmail.SendGridKey, s.SettingsEmail.EmailFrom, s.SettingsEmail.NameFrom, destinationAddress, destinationAddressName, subject, innerText, attachments), emailLogId
 	} else if s.SettingsEmail.Email == "T" {
 		if s.SettingsEmail.SMTPSTARTTLS {
-			sendEmailSMTPwithSTARTTLS(s.SettingsEmail.SMTPIdentity, s.SettingsEmail.SMTPUsername, s.SettingsEmail.SMTPPassword, s.SettingsEmail.SMTPHostname, destinationAddress, subject, innerText, s.SettingsEmail.SMTPReplyTo)
+			return sendEmailSMTPwithSTARTTLS(s.SettingsEmail.SMTPIdentity, s.SettingsEmail.SMTPUsername, s.SettingsEmail.SMTPPassword, s.SettingsEmail.SMTPHostname, destinationAddress, subject, innerText, s.SettingsEmail.SMTPReplyTo, attachments), emailLogId
 		} else {
-			sendEmailSMTPPlainAuth(s.SettingsEmail.SMTPIdentity, s.SettingsEmail.SMTPUsername, s.SettingsEmail.SMTPPassword, s.SettingsEmail.SMTPHostname, destinationAddress, subject, innerText, s.SettingsEmail.SMTPReplyTo)
+			return sendEmailSMTPPlainAuth(s.SettingsEmail.SMTPIdentity, s.SettingsEmail.SMTPUsername, s.SettingsEmail.SMTPPassword, s.SettingsEmail.SMTPHostname, destinationAddress, subject, innerText, s.SettingsEmail.SMTPReplyTo, attachments), emailLogId
 		}
 	}
-	return false
+	return false, emailLogId
 }
 
-func sendEmailSendgrid(key string, fromAddress string, fromAddressName string, destinationAddress string, destinationAddressName string, subject string, innerText string) bool {
+func sendEmailSendgrid(key string, fromAddress string, fromAddressName string, destinationAddress string, destinationAddressName string, subject string, innerText string, attachments []EmailAttachment) bool {
 	from := mail.NewEmail(fromAddressName, fromAddress)
 	to := mail.NewEmail(destinationAddressName, destinationAddress)
 	message := mail.NewSingleEmail(from, subject, to, strip.StripTags(innerText), innerText)
+	for i := 0; i < len(attachments); i++ {
+		attachment := mail.NewAttachment()
+		attachment.SetContent(base64.StdEncoding.EncodeToString(attachments[i].Content))
+		attachment.SetType(attachments[i].ContentType)
+		attachment.SetFilename(attachments[i].FileName)
+		attachment.SetDisposition("attachment")
+		message.AddAttachment(attachment)
+	}
 	client := sendgrid.NewSendClient(key)
 	_, err := client.Send(message)
 
@@ -58,7 +88,7 @@ func sendEmailSendgrid(key string, fromAddress string, fromAddressName string, d
 	return err == nil
 }
 
-func sendEmailSMTPPlainAuth(identiy, username, password, smtpServer, destinationAddress, subject, innerText, replyTo string) bool {
+func sendEmailSMTPPlainAuth(identiy, username, password, smtpServer, destinationAddress, subject, innerText, replyTo string, attachments []EmailAttachment) bool {
 	auth := smtp.PlainAuth(identiy, username, password, smtpServer[:strings.Index(smtpServer, ":")])
 
 	if len(replyTo) > 0 {
@@ -66,13 +96,7 @@ func sendEmailSMTPPlainAuth(identiy, username, password, smtpServer, destination
 	}
 
 	to := []string{destinationAddress}
-	msg := []byte("From: " + username + "\r\n" +
-		"To: " + destinationAddress + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		replyTo +
-		"MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n" +
-		"\r\n" +
-		innerText + "\r\n")
+	msg := smtpEmailMessage(username, destinationAddress, subject, replyTo, innerText, attachments)
 
 	err := smtp.SendMail(smtpServer, auth, username, to, msg)
 
@@ -83,6 +107,46 @@ func sendEmailSMTPPlainAuth(identiy, username, password, smtpServer, destination
 	return err == nil
 }
 
+// Returns the message to send by SMTP. The messages with attachments are sent as a multipart message.
+func smtpEmailMessage(username, destinationAddress, subject, replyTo, innerText string, attachments []EmailAttachment) []byte {
+	if len(attachments) == 0 {
+		return []byte("From: " + username + "\r\n" +
+			"To: " + destinationAddress + "\r\n" +
+			"Subject: " + subject + "\r\n" +
+			replyTo +
+			"MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n" +
+			"\r\n" +
+			innerText + "\r\n")
+	}
+
+	boundary := strings.Replace(uuid.New().String(), "-", "", -1)
+	var msg strings.Builder
+	msg.WriteString("From: " + username + "\r\n" +
+		"To: " + destinationAddress + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		replyTo +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=\"" + boundary + "\"\r\n" +
+		"\r\n" +
+		"--" + boundary + "\r\nContent-Type: text/html; charset=\"UTF-8\"\r\n\r\n" +
+		innerText + "\r\n")
+	for i := 0; i < len(attachments); i++ {
+		msg.WriteString("--" + boundary + "\r\n" +
+			"Content-Type: " + attachments[i].ContentType + "; name=\"" + attachments[i].FileName + "\"\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"Content-Disposition: attachment; filename=\"" + attachments[i].FileName + "\"\r\n" +
+			"\r\n")
+		// the lines of the base64 content can't be longer than 76 characters
+		content := base64.StdEncoding.EncodeToString(attachments[i].Content)
+		for len(content) > 76 {
+			msg.WriteString(content[:76] + "\r\n")
+			content = content[76:]
+		}
+		msg.WriteString(content + "\r\n")
+	}
+	msg.WriteString("--" + boundary + "--\r\n")
+	return []byte(msg.String())
+}
+
 /* SMTP EMAIL WITH START TLS */
 
 type loginAuth struct {
@@ -111,7 +175,7 @@ func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
 	return nil, nil
 }
 
-func sendEmailSMTPwithSTARTTLS(identiy, username, password, smtpServer, destinationAddress, subject, innerText, replyTo string) bool {
+func sendEmailSMTPwithSTARTTLS(identiy, username, password, smtpServer, destinationAddress, subject, innerText, replyTo string, attachments []EmailAttachment) bool {
 	conn, err := net.Dial("tcp", smtpServer)
 	if err != nil {
 		log("SMTP", err.Error())
@@ -141,13 +205,7 @@ func sendEmailSMTPwithSTARTTLS(identiy, username, password, smtpServer, destinat
 	}
 
 	to := []string{destinationAddress}
-	msg := []byte("From: " + username + "\r\n" +
-		"To: " + destinationAddress + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		replyTo +
-		"MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n" +
-		"\r\n" +
-		innerText + "\r\n")
+	msg := smtpEmailMessage(username, destinationAddress, subject, replyTo, innerText, attachments)
 
 	err = smtp.SendMail(smtpServer, auth, username, to, msg)
 	if err != nil {
@@ -167,10 +225,12 @@ type EmailInfo struct {
 	ReportId               string `json:"reportId"`
 	ReportDataId           int32  `json:"reportDataId"`
 	Language               int32  `json:"language"` // can be 0
+	// Report attached to the email, can be empty. SALES_INVOICE_FACTURX = PDF of the invoice with the Factur-X XML
+	Attachment string `json:"attachment"`
 }
 
 func (e *EmailInfo) isValid() bool {
-	return !(len(e.DestinationAddress) == 0 || len(e.DestinationAddressName) == 0 || len(e.Subject) == 0 || len(e.ReportId) == 0 || e.ReportDataId <= 0 || e.Language < 0)
+	return !(len(e.DestinationAddress) == 0 || len(e.DestinationAddressName) == 0 || len(e.Subject) == 0 || len(e.ReportId) == 0 || e.ReportDataId <= 0 || e.Language < 0 || (len(e.Attachment) > 0 && e.Attachment != "SALES_INVOICE_FACTURX"))
 }
 
 func (e *EmailInfo) sendEmail(enterpriseId int32) bool {
@@ -194,5 +254,19 @@ func (e *EmailInfo) sendEmail(enterpriseId int32) bool {
 		return false
 	}
 
-	return sendEmail(e.DestinationAddress, e.DestinationAddressName, e.Subject, string(report), enterpriseId)
+	attachments := make([]EmailAttachment, 0)
+	switch e.Attachment {
+	case "SALES_INVOICE_FACTURX":
+		if e.ReportId != "SALES_INVOICE" {
+			return false
+		}
+		document, result := generateSalesInvoiceFacturX(int64(e.ReportDataId), enterpriseId)
+		if !result.Ok {
+			return false
+		}
+		invoice := getSalesInvoiceRow(int64(e.ReportDataId))
+		attachments = append(attachments, EmailAttachment{FileName: strings.Replace(strings.TrimSpace(invoice.InvoiceName), "/", "-", -1) + ".pdf", ContentType: "application/pdf", Content: document})
+	}
+
+	return sendEmailWithAttachments(e.DestinationAddress, e.DestinationAddressName, e.Subject, string(report), attachments, enterpriseId)
 }
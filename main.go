@@ -105,6 +105,7 @@ func main() {
 	settingsRecords := getSettingsRecords()
 	for i := 0; i < len(settingsRecords); i++ {
 		initialPermissionDictionary(settingsRecords[i].Id)
+		initialReportTemplate(settingsRecords[i].Id)
 	}
 	if isParameterPresent("--install-only") {
 		fmt.Println("The parameter --install-only is set and the app will exit. All the operations were successfull.")
@@ -194,6 +195,30 @@ func main() {
 				enterpriseCronInfo.CronSendcloudTracking = &cronId
 			}
 		}
+		if settingsRecords[i].CronSalesSubscriptions != "" {
+			cronId, err := c.AddFunc(settingsRecords[i].CronSalesSubscriptions, func() {
+				runSalesSubscriptions(enterpriseId)
+			})
+			if err == nil {
+				enterpriseCronInfo.CronSalesSubscriptions = &cronId
+			}
+		}
+		if settingsRecords[i].CronDunning != "" {
+			cronId, err := c.AddFunc(settingsRecords[i].CronDunning, func() {
+				runDunning(enterpriseId)
+			})
+			if err == nil {
+				enterpriseCronInfo.CronDunning = &cronId
+			}
+		}
+		if settingsRecords[i].CronEdi != "" {
+			cronId, err := c.AddFunc(settingsRecords[i].CronEdi, func() {
+				processEdiInbound(enterpriseId)
+			})
+			if err == nil {
+				enterpriseCronInfo.CronEdi = &cronId
+			}
+		}
 		runningCrons[enterpriseId] = enterpriseCronInfo
 		// clean-up crons
 		c.AddFunc(settingsRecords[i].SettingsCleanUp.CronCleanTransactionalLog, func() {
@@ -209,6 +234,7 @@ func main() {
 	c.AddFunc(settings.Server.CronClearLogs, clearLogs)
 	c.AddFunc("@every 1m", resetMaxRequestsPerEnterprise)
 	c.AddFunc("@every 5m", attemptToSendQueuedWebHooks)
+	c.AddFunc("@daily", expireSalesQuotations)
 	c.Start()
 	c.Run()
 
@@ -429,8 +455,16 @@ func instructionGet(command string, message string, mt int, ws *websocket.Conn,
 			data, _ = json.Marshal(getColor(enterpriseId))
 		case "PACKAGES":
 			data, _ = json.Marshal(getPackages(enterpriseId))
+		case "UNITS_OF_MEASURE":
+			data, _ = json.Marshal(getUnitsOfMeasure(enterpriseId))
 		case "INCOTERMS":
 			data, _ = json.Marshal(getIncoterm(enterpriseId))
+		case "PRICE_LISTS":
+			data, _ = json.Marshal(getPriceLists(enterpriseId))
+		case "CUSTOMER_GROUPS":
+			data, _ = json.Marshal(getCustomerGroups(enterpriseId))
+		case "SALES_AGENTS":
+			data, _ = json.Marshal(getSalesAgents(enterpriseId))
 		case "CARRIERS":
 			data, _ = json.Marshal(getCariers(enterpriseId))
 		case "SUPPLIERS":
@@ -465,6 +499,25 @@ func instructionGet(command string, message string, mt int, ws *websocket.Conn,
 		var paginationQuery PaginationQuery
 		json.Unmarshal([]byte(message), &paginationQuery)
 		data, _ = json.Marshal(paginationQuery.getSalesOrder(enterpriseId))
+	case "SALES_QUOTATION":
+		if !permissions.Sales {
+			return
+		}
+		var paginationQuery PaginationQuery
+		json.Unmarshal([]byte(message), &paginationQuery)
+		data, _ = json.Marshal(paginationQuery.getSalesQuotations(enterpriseId))
+	case "SALES_RETURN":
+		if !permissions.Sales {
+			return
+		}
+		var paginationQuery PaginationQuery
+		json.Unmarshal([]byte(message), &paginationQuery)
+		data, _ = json.Marshal(paginationQuery.getSalesReturns(enterpriseId))
+	case "SALES_SUBSCRIPTION":
+		if !permissions.Sales {
+			return
+		}
+		data, _ = json.Marshal(getSalesSubscriptions(enterpriseId))
 	case "SALES_ORDER_PREPARATION":
 		if !permissions.Preparation {
 			return
@@ -480,6 +533,11 @@ func instructionGet(command string, message string, mt int, ws *websocket.Conn,
 			return
 		}
 		data, _ = json.Marshal(getWarehouses(enterpriseId))
+	case "WAREHOUSE_LOCATIONS":
+		if !permissions.Warehouse {
+			return
+		}
+		data, _ = json.Marshal(getWarehouseLocations(message, enterpriseId))
 	case "SALES_INVOICE":
 		if !permissions.Sales {
 			return
@@ -501,6 +559,14 @@ func instructionGet(command string, message string, mt int, ws *websocket.Conn,
 		json.Unmarshal([]byte(message), &paginationQuery)
 		paginationQuery.enterprise = enterpriseId
 		data, _ = json.Marshal(paginationQuery.getWarehouseMovement())
+	case "EDI_MESSAGES":
+		if !permissions.Sales {
+			return
+		}
+		var paginationQuery PaginationQuery
+		json.Unmarshal([]byte(message), &paginationQuery)
+		paginationQuery.enterprise = enterpriseId
+		data, _ = json.Marshal(paginationQuery.getEdiMessages())
 	case "WAREHOUSE_WAREHOUSE_MOVEMENTS":
 		if !permissions.Warehouse {
 			return
@@ -733,6 +799,21 @@ func instructionGet(command string, message string, mt int, ws *websocket.Conn,
 			return
 		}
 		data, _ = json.Marshal(getReportTemplateTranslations(enterpriseId))
+	case "DUNNING_LEVEL":
+		if !permissions.Accounting {
+			return
+		}
+		data, _ = json.Marshal(getDunningLevels(enterpriseId))
+	case "LANDED_COST":
+		if !permissions.Purchases {
+			return
+		}
+		data, _ = json.Marshal(getLandedCosts(enterpriseId))
+	case "REQUEST_FOR_QUOTATION":
+		if !permissions.Purchases {
+			return
+		}
+		data, _ = json.Marshal(getRequestsForQuotation(enterpriseId))
 	case "HS_CODES":
 		var query HSCodeQuery
 		json.Unmarshal([]byte(message), &query)
@@ -805,6 +886,25 @@ func instructionGet(command string, message string, mt int, ws *websocket.Conn,
 		var query PurchaseOrdersByMonthQuery
 		json.Unmarshal([]byte(message), &query)
 		data, _ = json.Marshal(query.purchaseOrdersByMonthAmount(enterpriseId))
+	case "SUPPLIER_SCORECARD":
+		if !permissions.Purchases {
+			return
+		}
+		var query SupplierScorecardQuery
+		json.Unmarshal([]byte(message), &query)
+		data, _ = json.Marshal(query.getSupplierScorecard(enterpriseId))
+	case "PRODUCT_SERIALS":
+		if !permissions.Warehouse {
+			return
+		}
+		var query ProductSerialQuery
+		json.Unmarshal([]byte(message), &query)
+		data, _ = json.Marshal(query.getProductSerials(enterpriseId))
+	case "SERIAL_NUMBER_HISTORY":
+		if !(permissions.Warehouse || permissions.Sales) {
+			return
+		}
+		data, _ = json.Marshal(getSerialNumberHistory(message, enterpriseId))
 	case "MANUFACTURING_ORDER_CREATED_MANUFACTURES_DAILY":
 		var query ManufacturingOrderCreatedManufacturedDailyQuery
 		json.Unmarshal([]byte(message), &query)
@@ -880,8 +980,124 @@ func instructionGet(command string, message string, mt int, ws *websocket.Conn,
 			return
 		}
 		data, _ = json.Marshal(getSalesOrderDetail(int64(id), enterpriseId))
+	case "SALES_QUOTATION_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		data, _ = json.Marshal(getSalesQuotationDetail(int64(id), enterpriseId))
+	case "SALES_RETURN_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		data, _ = json.Marshal(getSalesReturnDetail(int64(id), enterpriseId))
+	case "SALES_SUBSCRIPTION_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		data, _ = json.Marshal(getSalesSubscriptionDetail(int32(id), enterpriseId))
+	case "SALES_SUBSCRIPTION_LOG":
+		if !permissions.Sales {
+			return
+		}
+		data, _ = json.Marshal(getSalesSubscriptionLogs(int32(id), enterpriseId))
+	case "DUNNING_LEVEL_TRANSLATION":
+		if !permissions.Accounting {
+			return
+		}
+		data, _ = json.Marshal(getDunningLevelTranslations(int32(id), enterpriseId))
+	case "DUNNING_HISTORY":
+		if !permissions.Accounting {
+			return
+		}
+		data, _ = json.Marshal(getDunningHistory(int32(id), enterpriseId))
+	case "LANDED_COST_DELIVERY_NOTE":
+		if !permissions.Purchases {
+			return
+		}
+		data, _ = json.Marshal(getLandedCostDeliveryNotes(int64(id), enterpriseId))
+	case "LANDED_COST_ALLOCATION":
+		if !permissions.Purchases {
+			return
+		}
+		data, _ = json.Marshal(getLandedCostAllocations(int64(id), enterpriseId))
+	case "REQUEST_FOR_QUOTATION_DETAIL":
+		if !permissions.Purchases {
+			return
+		}
+		data, _ = json.Marshal(getRequestForQuotationDetails(int64(id), enterpriseId))
+	case "REQUEST_FOR_QUOTATION_SUPPLIER":
+		if !permissions.Purchases {
+			return
+		}
+		data, _ = json.Marshal(getRequestForQuotationSuppliers(int64(id), enterpriseId))
+	case "REQUEST_FOR_QUOTATION_COMPARISON":
+		if !permissions.Purchases {
+			return
+		}
+		data, _ = json.Marshal(getRequestForQuotationComparison(int64(id), enterpriseId))
 	case "STOCK":
 		data, _ = json.Marshal(getStock(int32(id), enterpriseId))
+	case "STOCK_LOT":
+		data, _ = json.Marshal(getStockLot(int32(id), enterpriseId))
+	case "PRODUCT_LOTS":
+		data, _ = json.Marshal(getProductLots(int32(id), enterpriseId))
+	case "WAREHOUSE_MOVEMENT_LOTS":
+		if !permissions.Warehouse {
+			return
+		}
+		data, _ = json.Marshal(getWarehouseMovementLots(int64(id), enterpriseId))
+	case "WAREHOUSE_MOVEMENT_SERIALS":
+		if !permissions.Warehouse {
+			return
+		}
+		data, _ = json.Marshal(getWarehouseMovementSerials(int64(id), enterpriseId))
+	case "LOT_RECALL":
+		if !permissions.Warehouse {
+			return
+		}
+		data, _ = json.Marshal(getLotRecall(int64(id), enterpriseId))
+	case "SALES_ORDER_FEFO":
+		if !(permissions.Sales || permissions.Preparation) {
+			return
+		}
+		data, _ = json.Marshal(getSalesOrderFefoSuggestion(int64(id), enterpriseId))
+	case "SALES_ORDER_PICKING_LOCATIONS":
+		if !(permissions.Sales || permissions.Preparation) {
+			return
+		}
+		data, _ = json.Marshal(getSalesOrderPickingLocations(int64(id), enterpriseId))
+	case "STOCK_LOCATION":
+		data, _ = json.Marshal(getStockLocation(int32(id), enterpriseId))
+	case "WAREHOUSE_LOCATION_STOCK":
+		if !permissions.Warehouse {
+			return
+		}
+		data, _ = json.Marshal(getWarehouseLocationStock(int32(id), enterpriseId))
+	case "WAREHOUSE_MOVEMENT_LOCATIONS":
+		if !permissions.Warehouse {
+			return
+		}
+		data, _ = json.Marshal(getWarehouseMovementLocations(int64(id), enterpriseId))
+	case "WAREHOUSE_MOVEMENT_COST_LAYERS":
+		if !permissions.Warehouse {
+			return
+		}
+		data, _ = json.Marshal(getWarehouseMovementCostLayers(int64(id), enterpriseId))
+	case "COST_LAYERS":
+		if !permissions.Warehouse {
+			return
+		}
+		data, _ = json.Marshal(getCostLayers(int32(id), enterpriseId))
+	case "PURCHASE_DELIVERY_NOTE_PUT_AWAY":
+		if !(permissions.Purchases || permissions.Warehouse) {
+			return
+		}
+		data, _ = json.Marshal(getPurchaseDeliveryNotePutAway(int64(id), enterpriseId))
+	case "INVENTORY_PRODUCT_LOCATIONS":
+		if !permissions.Warehouse {
+			return
+		}
+		data, _ = json.Marshal(getInventoryProductLocations(int32(id), enterpriseId))
 	case "SALES_ORDER_DISCOUNT":
 		if !permissions.Sales {
 			return
@@ -902,6 +1118,11 @@ func instructionGet(command string, message string, mt int, ws *websocket.Conn,
 			return
 		}
 		data, _ = json.Marshal(getWarehouseMovementBySalesDeliveryNote(int64(id), enterpriseId))
+	case "SALES_DELIVERY_NOTES_DROP_SHIPPING_DETAILS":
+		if !permissions.Sales {
+			return
+		}
+		data, _ = json.Marshal(getDropShippingDeliveryNoteDetails(int64(id), enterpriseId))
 	case "SHIPPING_PACKAGING":
 		data, _ = json.Marshal(getPackagingByShipping(int64(id), enterpriseId))
 	case "GET_USER_GROUPS":
@@ -938,6 +1159,16 @@ func instructionGet(command string, message string, mt int, ws *websocket.Conn,
 			return
 		}
 		data, _ = json.Marshal(getSalesOrderRow(int64(id)))
+	case "SALES_QUOTATION_ROW":
+		if !permissions.Sales {
+			return
+		}
+		data, _ = json.Marshal(getSalesQuotationRow(int64(id)))
+	case "SALES_RETURN_ROW":
+		if !permissions.Sales {
+			return
+		}
+		data, _ = json.Marshal(getSalesReturnRow(int64(id)))
 	case "SALES_INVOICE_ROW":
 		if !permissions.Sales {
 			return
@@ -955,6 +1186,21 @@ func instructionGet(command string, message string, mt int, ws *websocket.Conn,
 		data, _ = json.Marshal(getPurchaseInvoiceRow(int64(id)))
 	case "PRODUCT_IMAGE":
 		data, _ = json.Marshal(getProductImages(int32(id), enterpriseId))
+	case "PRICE_LIST_PRODUCT":
+		if !permissions.Masters {
+			return
+		}
+		data, _ = json.Marshal(getPriceListProducts(int32(id), enterpriseId))
+	case "SALES_AGENT_COMMISSION_RULE":
+		if !permissions.Masters {
+			return
+		}
+		data, _ = json.Marshal(getSalesAgentCommissionRules(int32(id), enterpriseId))
+	case "SALES_AGENT_SETTLEMENT":
+		if !permissions.Sales {
+			return
+		}
+		data, _ = json.Marshal(getSalesAgentSettlements(int32(id), enterpriseId))
 	case "CUSTOMER_ROW":
 		if !permissions.Sales {
 			return
@@ -980,6 +1226,11 @@ func instructionGet(command string, message string, mt int, ws *websocket.Conn,
 			return
 		}
 		data, _ = json.Marshal(getCustomerSaleOrders(int32(id), enterpriseId))
+	case "CUSTOMER_RISK":
+		if !permissions.Sales {
+			return
+		}
+		data, _ = json.Marshal(getCustomerRisk(int32(id), enterpriseId))
 	case "SALES_DELIVERY_NOTE_ROW":
 		if !permissions.Sales {
 			return
@@ -1158,6 +1409,13 @@ func instructionGet(command string, message string, mt int, ws *websocket.Conn,
 			return
 		}
 		data, _ = json.Marshal(getProductIncludedProduct(int32(id), enterpriseId))
+	case "PRODUCT_SUPPLIER":
+		if !permissions.Masters {
+			return
+		}
+		data, _ = json.Marshal(getProductSuppliers(int32(id), enterpriseId))
+	case "PRODUCT_UNITS_OF_MEASURE":
+		data, _ = json.Marshal(getProductUnitsOfMeasure(int32(id), enterpriseId))
 	case "PRODUCT_INCLUDED_PRODUCTS_SALES_ORDER_DETAIL":
 		if !permissions.Sales {
 			return
@@ -1253,11 +1511,41 @@ func instructionInsert(command string, message []byte, mt int, ws *websocket.Con
 			json.Unmarshal(message, &packages)
 			packages.EnterpriseId = enterpriseId
 			ok = packages.insertPackage()
+		case "UNIT_OF_MEASURE":
+			var unit UnitOfMeasure
+			json.Unmarshal(message, &unit)
+			unit.EnterpriseId = enterpriseId
+			ok = unit.insertUnitOfMeasure()
 		case "INCOTERM":
 			var incoterm Incoterm
 			json.Unmarshal(message, &incoterm)
 			incoterm.EnterpriseId = enterpriseId
 			ok = incoterm.insertIncoterm()
+		case "PRICE_LIST":
+			var priceList PriceList
+			json.Unmarshal(message, &priceList)
+			priceList.EnterpriseId = enterpriseId
+			ok = priceList.insertPriceList()
+		case "PRICE_LIST_PRODUCT":
+			var priceListProduct PriceListProduct
+			json.Unmarshal(message, &priceListProduct)
+			priceListProduct.EnterpriseId = enterpriseId
+			ok = priceListProduct.insertPriceListProduct()
+		case "CUSTOMER_GROUP":
+			var customerGroup CustomerGroup
+			json.Unmarshal(message, &customerGroup)
+			customerGroup.EnterpriseId = enterpriseId
+			ok = customerGroup.insertCustomerGroup()
+		case "SALES_AGENT":
+			var salesAgent SalesAgent
+			json.Unmarshal(message, &salesAgent)
+			salesAgent.EnterpriseId = enterpriseId
+			ok = salesAgent.insertSalesAgent()
+		case "SALES_AGENT_COMMISSION_RULE":
+			var salesAgentCommissionRule SalesAgentCommissionRule
+			json.Unmarshal(message, &salesAgentCommissionRule)
+			salesAgentCommissionRule.EnterpriseId = enterpriseId
+			ok = salesAgentCommissionRule.insertSalesAgentCommissionRule()
 		case "CARRIER":
 			var carrier Carrier
 			json.Unmarshal(message, &carrier)
@@ -1290,8 +1578,11 @@ func instructionInsert(command string, message []byte, mt int, ws *websocket.Con
 		var saleOrder SaleOrder
 		json.Unmarshal([]byte(message), &saleOrder)
 		saleOrder.EnterpriseId = enterpriseId
-		ok, orderId := saleOrder.insertSalesOrder(userId)
-		if !ok {
+		okAndErr, orderId := saleOrder.insertSalesOrder(userId, nil)
+		if !okAndErr.Ok && okAndErr.ErrorCode > 0 {
+			// the order was rejected because of the customer's risk
+			returnData, _ = json.Marshal(okAndErr)
+		} else if !okAndErr.Ok {
 			returnData, _ = json.Marshal(nil)
 		} else {
 			order := getSalesOrderRow(orderId)
@@ -1304,7 +1595,45 @@ func instructionInsert(command string, message []byte, mt int, ws *websocket.Con
 		var saleOrderDetail SalesOrderDetail
 		json.Unmarshal(message, &saleOrderDetail)
 		saleOrderDetail.EnterpriseId = enterpriseId
-		returnData, _ = json.Marshal(saleOrderDetail.insertSalesOrderDetail(userId))
+		returnData, _ = json.Marshal(saleOrderDetail.insertSalesOrderDetail(userId, nil))
+	case "SALES_QUOTATION":
+		if !permissions.Sales {
+			return
+		}
+		var salesQuotation SalesQuotation
+		json.Unmarshal(message, &salesQuotation)
+		salesQuotation.EnterpriseId = enterpriseId
+		ok, quotationId := salesQuotation.insertSalesQuotation(userId)
+		if !ok {
+			returnData, _ = json.Marshal(nil)
+		} else {
+			quotation := getSalesQuotationRow(quotationId)
+			returnData, _ = json.Marshal(quotation)
+		}
+	case "SALES_QUOTATION_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		var salesQuotationDetail SalesQuotationDetail
+		json.Unmarshal(message, &salesQuotationDetail)
+		salesQuotationDetail.EnterpriseId = enterpriseId
+		returnData, _ = json.Marshal(salesQuotationDetail.insertSalesQuotationDetail(userId))
+	case "SALES_RETURN_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		var salesReturnDetail SalesReturnDetail
+		json.Unmarshal(message, &salesReturnDetail)
+		salesReturnDetail.EnterpriseId = enterpriseId
+		returnData, _ = json.Marshal(salesReturnDetail.insertSalesReturnDetail(userId))
+	case "SALES_SUBSCRIPTION_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		var salesSubscriptionDetail SalesSubscriptionDetail
+		json.Unmarshal(message, &salesSubscriptionDetail)
+		salesSubscriptionDetail.EnterpriseId = enterpriseId
+		returnData, _ = json.Marshal(salesSubscriptionDetail.insertSalesSubscriptionDetail(userId))
 	case "SALES_INVOICE_DETAIL":
 		if !permissions.Sales {
 			return
@@ -1442,6 +1771,19 @@ func instructionInsert(command string, message []byte, mt int, ws *websocket.Con
 		manufacturingOrder.Order.UserCreatedId = userId
 		manufacturingOrder.Order.EnterpriseId = enterpriseId
 		returnData, _ = json.Marshal(manufacturingOrder.insertMultipleManufacturingOrders(userId))
+	case "REQUEST_FOR_QUOTATION":
+		if !permissions.Purchases {
+			return
+		}
+		var request RequestForQuotation
+		json.Unmarshal(message, &request)
+		request.EnterpriseId = enterpriseId
+		if !request.insertRequestForQuotation(userId, nil) {
+			returnData, _ = json.Marshal(nil)
+		} else {
+			request = getRequestForQuotationRow(request.Id)
+			returnData, _ = json.Marshal(request)
+		}
 	default:
 		found = false
 	}
@@ -1459,6 +1801,14 @@ func instructionInsert(command string, message []byte, mt int, ws *websocket.Con
 		json.Unmarshal(message, &warehouse)
 		warehouse.EnterpriseId = enterpriseId
 		ok = warehouse.insertWarehouse()
+	case "WAREHOUSE_LOCATION":
+		if !permissions.Warehouse {
+			return
+		}
+		var location WarehouseLocation
+		json.Unmarshal(message, &location)
+		location.EnterpriseId = enterpriseId
+		ok = location.insertWarehouseLocation()
 	case "SALES_ORDER_DISCOUNT":
 		if !permissions.Sales {
 			return
@@ -1467,6 +1817,14 @@ func instructionInsert(command string, message []byte, mt int, ws *websocket.Con
 		json.Unmarshal(message, &saleOrderDiscount)
 		saleOrderDiscount.EnterpriseId = enterpriseId
 		ok = saleOrderDiscount.insertSalesOrderDiscount(userId)
+	case "SALES_SUBSCRIPTION":
+		if !permissions.Sales {
+			return
+		}
+		var salesSubscription SalesSubscription
+		json.Unmarshal(message, &salesSubscription)
+		salesSubscription.EnterpriseId = enterpriseId
+		ok = salesSubscription.insertSalesSubscription(userId)
 	case "MANUFACTURING_ORDER_TYPE":
 		if !permissions.Manufacturing {
 			return
@@ -1602,6 +1960,62 @@ func instructionInsert(command string, message []byte, mt int, ws *websocket.Con
 		json.Unmarshal(message, &charges)
 		charges.EnterpriseId = enterpriseId
 		ok = charges.insertCharges(userId)
+	case "DUNNING_LEVEL":
+		if !permissions.Accounting {
+			return
+		}
+		var dunningLevel DunningLevel
+		json.Unmarshal(message, &dunningLevel)
+		dunningLevel.EnterpriseId = enterpriseId
+		ok = dunningLevel.insertDunningLevel()
+	case "LANDED_COST":
+		if !permissions.Purchases {
+			return
+		}
+		var landedCost LandedCost
+		json.Unmarshal(message, &landedCost)
+		landedCost.EnterpriseId = enterpriseId
+		ok = landedCost.insertLandedCost()
+	case "LANDED_COST_DELIVERY_NOTE":
+		if !permissions.Purchases {
+			return
+		}
+		var n LandedCostDeliveryNote
+		json.Unmarshal(message, &n)
+		n.EnterpriseId = enterpriseId
+		ok = n.insertLandedCostDeliveryNote()
+	case "REQUEST_FOR_QUOTATION_DETAIL":
+		if !permissions.Purchases {
+			return
+		}
+		var d RequestForQuotationDetail
+		json.Unmarshal(message, &d)
+		d.EnterpriseId = enterpriseId
+		ok = d.insertRequestForQuotationDetail(nil)
+	case "REQUEST_FOR_QUOTATION_SUPPLIER":
+		if !permissions.Purchases {
+			return
+		}
+		var rs RequestForQuotationSupplier
+		json.Unmarshal(message, &rs)
+		rs.EnterpriseId = enterpriseId
+		ok = rs.insertRequestForQuotationSupplier(nil)
+	case "REQUEST_FOR_QUOTATION_REPLY":
+		if !permissions.Purchases {
+			return
+		}
+		var reply RequestForQuotationReply
+		json.Unmarshal(message, &reply)
+		reply.EnterpriseId = enterpriseId
+		ok = reply.setRequestForQuotationReply()
+	case "DUNNING_LEVEL_TRANSLATION":
+		if !permissions.Accounting {
+			return
+		}
+		var t DunningLevelTranslation
+		json.Unmarshal(message, &t)
+		t.EnterpriseId = enterpriseId
+		ok = t.insertDunningLevelTranslation()
 	case "PAYMENT":
 		if !permissions.Accounting {
 			return
@@ -1728,6 +2142,22 @@ func instructionInsert(command string, message []byte, mt int, ws *websocket.Con
 		json.Unmarshal([]byte(message), &productIncludedProduct)
 		productIncludedProduct.EnterpriseId = enterpriseId
 		ok = productIncludedProduct.insertProductIncludedProduct()
+	case "PRODUCT_SUPPLIER":
+		if !permissions.Masters {
+			return
+		}
+		var productSupplier ProductSupplier
+		json.Unmarshal([]byte(message), &productSupplier)
+		productSupplier.EnterpriseId = enterpriseId
+		ok = productSupplier.insertProductSupplier()
+	case "PRODUCT_UNIT_OF_MEASURE":
+		if !permissions.Masters {
+			return
+		}
+		var productUnit ProductUnitOfMeasure
+		json.Unmarshal([]byte(message), &productUnit)
+		productUnit.EnterpriseId = enterpriseId
+		ok = productUnit.insertProductUnitOfMeasure()
 	case "DEPRECATED_PRODUCT":
 		if !(permissions.Masters && getUserPermission("PRODUCT_MANAGER", enterpriseId, userId)) {
 			return
@@ -1776,6 +2206,42 @@ func instructionUpdate(command string, message []byte, mt int, ws *websocket.Con
 		salesOrderDetail.EnterpriseId = enterpriseId
 		returnData, _ = json.Marshal(salesOrderDetail.updateSalesOrderDetail(userId))
 		ok = true
+	case "SALES_QUOTATION":
+		if !permissions.Sales {
+			return
+		}
+		var salesQuotation SalesQuotation
+		json.Unmarshal(message, &salesQuotation)
+		salesQuotation.EnterpriseId = enterpriseId
+		returnData, _ = json.Marshal(salesQuotation.updateSalesQuotation(userId))
+		ok = true
+	case "SALES_QUOTATION_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		var salesQuotationDetail SalesQuotationDetail
+		json.Unmarshal(message, &salesQuotationDetail)
+		salesQuotationDetail.EnterpriseId = enterpriseId
+		returnData, _ = json.Marshal(salesQuotationDetail.updateSalesQuotationDetail(userId))
+		ok = true
+	case "SALES_RETURN":
+		if !permissions.Sales {
+			return
+		}
+		var salesReturn SalesReturn
+		json.Unmarshal(message, &salesReturn)
+		salesReturn.EnterpriseId = enterpriseId
+		returnData, _ = json.Marshal(salesReturn.updateSalesReturn(userId))
+		ok = true
+	case "SALES_RETURN_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		var salesReturnDetail SalesReturnDetail
+		json.Unmarshal(message, &salesReturnDetail)
+		salesReturnDetail.EnterpriseId = enterpriseId
+		returnData, _ = json.Marshal(salesReturnDetail.updateSalesReturnDetail(userId))
+		ok = true
 	case "PURCHASE_ORDER_DETAIL":
 		if !permissions.Purchases {
 			return
@@ -1857,11 +2323,41 @@ func instructionUpdate(command string, message []byte, mt int, ws *websocket.Con
 			json.Unmarshal(message, &packages)
 			packages.EnterpriseId = enterpriseId
 			ok = packages.updatePackage()
+		case "UNIT_OF_MEASURE":
+			var unit UnitOfMeasure
+			json.Unmarshal(message, &unit)
+			unit.EnterpriseId = enterpriseId
+			ok = unit.updateUnitOfMeasure()
 		case "INCOTERM":
 			var incoterm Incoterm
 			json.Unmarshal(message, &incoterm)
 			incoterm.EnterpriseId = enterpriseId
 			ok = incoterm.updateIncoterm()
+		case "PRICE_LIST":
+			var priceList PriceList
+			json.Unmarshal(message, &priceList)
+			priceList.EnterpriseId = enterpriseId
+			ok = priceList.updatePriceList()
+		case "PRICE_LIST_PRODUCT":
+			var priceListProduct PriceListProduct
+			json.Unmarshal(message, &priceListProduct)
+			priceListProduct.EnterpriseId = enterpriseId
+			ok = priceListProduct.updatePriceListProduct()
+		case "CUSTOMER_GROUP":
+			var customerGroup CustomerGroup
+			json.Unmarshal(message, &customerGroup)
+			customerGroup.EnterpriseId = enterpriseId
+			ok = customerGroup.updateCustomerGroup()
+		case "SALES_AGENT":
+			var salesAgent SalesAgent
+			json.Unmarshal(message, &salesAgent)
+			salesAgent.EnterpriseId = enterpriseId
+			ok = salesAgent.updateSalesAgent()
+		case "SALES_AGENT_COMMISSION_RULE":
+			var salesAgentCommissionRule SalesAgentCommissionRule
+			json.Unmarshal(message, &salesAgentCommissionRule)
+			salesAgentCommissionRule.EnterpriseId = enterpriseId
+			ok = salesAgentCommissionRule.updateSalesAgentCommissionRule()
 		case "CARRIER":
 			var carrier Carrier
 			json.Unmarshal(message, &carrier)
@@ -1893,6 +2389,14 @@ func instructionUpdate(command string, message []byte, mt int, ws *websocket.Con
 		json.Unmarshal(message, &warehouse)
 		warehouse.EnterpriseId = enterpriseId
 		ok = warehouse.updateWarehouse()
+	case "WAREHOUSE_LOCATION":
+		if !permissions.Warehouse {
+			return
+		}
+		var location WarehouseLocation
+		json.Unmarshal(message, &location)
+		location.EnterpriseId = enterpriseId
+		ok = location.updateWarehouseLocation()
 	case "SALES_ORDER":
 		if !permissions.Sales {
 			return
@@ -1901,6 +2405,22 @@ func instructionUpdate(command string, message []byte, mt int, ws *websocket.Con
 		json.Unmarshal(message, &saleOrder)
 		saleOrder.EnterpriseId = enterpriseId
 		ok = saleOrder.updateSalesOrder(userId)
+	case "SALES_SUBSCRIPTION":
+		if !permissions.Sales {
+			return
+		}
+		var salesSubscription SalesSubscription
+		json.Unmarshal(message, &salesSubscription)
+		salesSubscription.EnterpriseId = enterpriseId
+		ok = salesSubscription.updateSalesSubscription(userId)
+	case "SALES_SUBSCRIPTION_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		var salesSubscriptionDetail SalesSubscriptionDetail
+		json.Unmarshal(message, &salesSubscriptionDetail)
+		salesSubscriptionDetail.EnterpriseId = enterpriseId
+		ok = salesSubscriptionDetail.updateSalesSubscriptionDetail(userId)
 	case "MANUFACTURING_ORDER_TYPE":
 		if !permissions.Manufacturing {
 			return
@@ -2034,6 +2554,62 @@ func instructionUpdate(command string, message []byte, mt int, ws *websocket.Con
 		json.Unmarshal(message, &t)
 		t.EnterpriseId = enterpriseId
 		ok = t.updateReportTemplateTranslation()
+	case "DUNNING_LEVEL":
+		if !permissions.Accounting {
+			return
+		}
+		var dunningLevel DunningLevel
+		json.Unmarshal(message, &dunningLevel)
+		dunningLevel.EnterpriseId = enterpriseId
+		ok = dunningLevel.updateDunningLevel()
+	case "LANDED_COST":
+		if !permissions.Purchases {
+			return
+		}
+		var landedCost LandedCost
+		json.Unmarshal(message, &landedCost)
+		landedCost.EnterpriseId = enterpriseId
+		ok = landedCost.updateLandedCost()
+	case "REQUEST_FOR_QUOTATION":
+		if !permissions.Purchases {
+			return
+		}
+		var request RequestForQuotation
+		json.Unmarshal(message, &request)
+		request.EnterpriseId = enterpriseId
+		ok = request.updateRequestForQuotation(userId)
+	case "REQUEST_FOR_QUOTATION_DETAIL":
+		if !permissions.Purchases {
+			return
+		}
+		var d RequestForQuotationDetail
+		json.Unmarshal(message, &d)
+		d.EnterpriseId = enterpriseId
+		ok = d.updateRequestForQuotationDetail()
+	case "REQUEST_FOR_QUOTATION_REPLY":
+		if !permissions.Purchases {
+			return
+		}
+		var reply RequestForQuotationReply
+		json.Unmarshal(message, &reply)
+		reply.EnterpriseId = enterpriseId
+		ok = reply.setRequestForQuotationReply()
+	case "PRODUCT_LOT":
+		if !permissions.Warehouse {
+			return
+		}
+		var lot ProductLot
+		json.Unmarshal(message, &lot)
+		lot.EnterpriseId = enterpriseId
+		ok = lot.updateProductLot()
+	case "DUNNING_LEVEL_TRANSLATION":
+		if !permissions.Accounting {
+			return
+		}
+		var dunningLevelTranslation DunningLevelTranslation
+		json.Unmarshal(message, &dunningLevelTranslation)
+		dunningLevelTranslation.EnterpriseId = enterpriseId
+		ok = dunningLevelTranslation.updateDunningLevelTranslation()
 	case "WEBHOOK_SETTINGS":
 		if !permissions.Admin {
 			return
@@ -2073,6 +2649,22 @@ func instructionUpdate(command string, message []byte, mt int, ws *websocket.Con
 		json.Unmarshal([]byte(message), &productIncludedProduct)
 		productIncludedProduct.EnterpriseId = enterpriseId
 		ok = productIncludedProduct.updateProductIncludedProduct()
+	case "PRODUCT_SUPPLIER":
+		if !permissions.Masters {
+			return
+		}
+		var productSupplier ProductSupplier
+		json.Unmarshal([]byte(message), &productSupplier)
+		productSupplier.EnterpriseId = enterpriseId
+		ok = productSupplier.updateProductSupplier()
+	case "PRODUCT_UNIT_OF_MEASURE":
+		if !permissions.Masters {
+			return
+		}
+		var productUnit ProductUnitOfMeasure
+		json.Unmarshal([]byte(message), &productUnit)
+		productUnit.EnterpriseId = enterpriseId
+		ok = productUnit.updateProductUnitOfMeasure()
 	}
 	data, _ := json.Marshal(ok)
 	ws.WriteMessage(mt, data)
@@ -2140,12 +2732,44 @@ func instructionDelete(command string, message string, mt int, ws *websocket.Con
 		json.Unmarshal([]byte(message), &t)
 		t.EnterpriseId = enterpriseId
 		ok = t.deleteReportTemplateTranslation()
-	case "POS_TERMINAL":
-		if !permissions.Admin {
+	case "DUNNING_LEVEL_TRANSLATION":
+		if !permissions.Accounting {
 			return
 		}
-		ok = deletePOSTerminal(message, enterpriseId)
-	default:
+		var t DunningLevelTranslation
+		json.Unmarshal([]byte(message), &t)
+		t.EnterpriseId = enterpriseId
+		ok = t.deleteDunningLevelTranslation()
+	case "LANDED_COST_DELIVERY_NOTE":
+		if !permissions.Purchases {
+			return
+		}
+		var n LandedCostDeliveryNote
+		json.Unmarshal([]byte(message), &n)
+		n.EnterpriseId = enterpriseId
+		ok = n.deleteLandedCostDeliveryNote()
+	case "REQUEST_FOR_QUOTATION_SUPPLIER":
+		if !permissions.Purchases {
+			return
+		}
+		var rs RequestForQuotationSupplier
+		json.Unmarshal([]byte(message), &rs)
+		rs.EnterpriseId = enterpriseId
+		ok = rs.deleteRequestForQuotationSupplier()
+	case "REQUEST_FOR_QUOTATION_REPLY":
+		if !permissions.Purchases {
+			return
+		}
+		var reply RequestForQuotationReply
+		json.Unmarshal([]byte(message), &reply)
+		reply.EnterpriseId = enterpriseId
+		ok = reply.deleteRequestForQuotationReply()
+	case "POS_TERMINAL":
+		if !permissions.Admin {
+			return
+		}
+		ok = deletePOSTerminal(message, enterpriseId)
+	default:
 		found = false
 	}
 
@@ -2213,11 +2837,41 @@ func instructionDelete(command string, message string, mt int, ws *websocket.Con
 			packages.Id = int32(id)
 			packages.EnterpriseId = enterpriseId
 			ok = packages.deletePackage()
+		case "UNIT_OF_MEASURE":
+			var unit UnitOfMeasure
+			unit.Id = int32(id)
+			unit.EnterpriseId = enterpriseId
+			ok = unit.deleteUnitOfMeasure()
 		case "INCOTERM":
 			var incoterm Incoterm
 			incoterm.Id = int32(id)
 			incoterm.EnterpriseId = enterpriseId
 			ok = incoterm.deleteIncoterm()
+		case "PRICE_LIST":
+			var priceList PriceList
+			priceList.Id = int32(id)
+			priceList.EnterpriseId = enterpriseId
+			ok = priceList.deletePriceList()
+		case "PRICE_LIST_PRODUCT":
+			var priceListProduct PriceListProduct
+			priceListProduct.Id = int64(id)
+			priceListProduct.EnterpriseId = enterpriseId
+			ok = priceListProduct.deletePriceListProduct()
+		case "CUSTOMER_GROUP":
+			var customerGroup CustomerGroup
+			customerGroup.Id = int32(id)
+			customerGroup.EnterpriseId = enterpriseId
+			ok = customerGroup.deleteCustomerGroup()
+		case "SALES_AGENT":
+			var salesAgent SalesAgent
+			salesAgent.Id = int32(id)
+			salesAgent.EnterpriseId = enterpriseId
+			ok = salesAgent.deleteSalesAgent()
+		case "SALES_AGENT_COMMISSION_RULE":
+			var salesAgentCommissionRule SalesAgentCommissionRule
+			salesAgentCommissionRule.Id = int32(id)
+			salesAgentCommissionRule.EnterpriseId = enterpriseId
+			ok = salesAgentCommissionRule.deleteSalesAgentCommissionRule()
 		case "CARRIER":
 			var carrier Carrier
 			carrier.Id = int32(id)
@@ -2265,6 +2919,42 @@ func instructionDelete(command string, message string, mt int, ws *websocket.Con
 		saleOrderDetail.EnterpriseId = enterpriseId
 		returnData, _ = json.Marshal(saleOrderDetail.deleteSalesOrderDetail(userId, nil))
 		found = true
+	case "SALES_QUOTATION":
+		if !permissions.Sales {
+			return
+		}
+		var salesQuotation SalesQuotation
+		salesQuotation.Id = int64(id)
+		salesQuotation.EnterpriseId = enterpriseId
+		returnData, _ = json.Marshal(salesQuotation.deleteSalesQuotation(userId))
+		found = true
+	case "SALES_QUOTATION_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		var salesQuotationDetail SalesQuotationDetail
+		salesQuotationDetail.Id = int64(id)
+		salesQuotationDetail.EnterpriseId = enterpriseId
+		returnData, _ = json.Marshal(salesQuotationDetail.deleteSalesQuotationDetail(userId))
+		found = true
+	case "SALES_RETURN":
+		if !permissions.Sales {
+			return
+		}
+		var salesReturn SalesReturn
+		salesReturn.Id = int64(id)
+		salesReturn.EnterpriseId = enterpriseId
+		returnData, _ = json.Marshal(salesReturn.deleteSalesReturn(userId))
+		found = true
+	case "SALES_RETURN_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		var salesReturnDetail SalesReturnDetail
+		salesReturnDetail.Id = int64(id)
+		salesReturnDetail.EnterpriseId = enterpriseId
+		returnData, _ = json.Marshal(salesReturnDetail.deleteSalesReturnDetail(userId))
+		found = true
 	case "SALES_INVOICE":
 		if !permissions.Sales {
 			return
@@ -2337,6 +3027,15 @@ func instructionDelete(command string, message string, mt int, ws *websocket.Con
 		i.EnterpriseId = enterpriseId
 		returnData, _ = json.Marshal(i.deleteInventory(enterpriseId))
 		found = true
+	case "WAREHOUSE_LOCATION":
+		if !permissions.Warehouse {
+			return
+		}
+		var location WarehouseLocation
+		location.Id = int32(id)
+		location.EnterpriseId = enterpriseId
+		returnData, _ = json.Marshal(location.deleteWarehouseLocation())
+		found = true
 	case "SALES_DELIVERY_NOTES":
 		if !permissions.Sales {
 			return
@@ -2361,6 +3060,22 @@ func instructionDelete(command string, message string, mt int, ws *websocket.Con
 		saleOrderDiscount.Id = int32(id)
 		saleOrderDiscount.EnterpriseId = enterpriseId
 		ok = saleOrderDiscount.deleteSalesOrderDiscount(userId)
+	case "SALES_SUBSCRIPTION":
+		if !permissions.Sales {
+			return
+		}
+		var salesSubscription SalesSubscription
+		salesSubscription.Id = int32(id)
+		salesSubscription.EnterpriseId = enterpriseId
+		ok = salesSubscription.deleteSalesSubscription(userId)
+	case "SALES_SUBSCRIPTION_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		var salesSubscriptionDetail SalesSubscriptionDetail
+		salesSubscriptionDetail.Id = int64(id)
+		salesSubscriptionDetail.EnterpriseId = enterpriseId
+		ok = salesSubscriptionDetail.deleteSalesSubscriptionDetail(userId)
 	case "MANUFACTURING_ORDER_TYPE":
 		if !permissions.Manufacturing {
 			return
@@ -2482,6 +3197,38 @@ func instructionDelete(command string, message string, mt int, ws *websocket.Con
 		charges.Id = int32(id)
 		charges.EnterpriseId = enterpriseId
 		ok = charges.deleteCharges(userId)
+	case "DUNNING_LEVEL":
+		if !permissions.Accounting {
+			return
+		}
+		var dunningLevel DunningLevel
+		dunningLevel.Id = int32(id)
+		dunningLevel.EnterpriseId = enterpriseId
+		ok = dunningLevel.deleteDunningLevel()
+	case "LANDED_COST":
+		if !permissions.Purchases {
+			return
+		}
+		var landedCost LandedCost
+		landedCost.Id = int64(id)
+		landedCost.EnterpriseId = enterpriseId
+		ok = landedCost.deleteLandedCost()
+	case "REQUEST_FOR_QUOTATION":
+		if !permissions.Purchases {
+			return
+		}
+		var request RequestForQuotation
+		request.Id = int64(id)
+		request.EnterpriseId = enterpriseId
+		ok = request.deleteRequestForQuotation(userId)
+	case "REQUEST_FOR_QUOTATION_DETAIL":
+		if !permissions.Purchases {
+			return
+		}
+		var d RequestForQuotationDetail
+		d.Id = int64(id)
+		d.EnterpriseId = enterpriseId
+		ok = d.deleteRequestForQuotationDetail()
 	case "PAYMENT":
 		if !permissions.Accounting {
 			return
@@ -2585,6 +3332,22 @@ func instructionDelete(command string, message string, mt int, ws *websocket.Con
 		productIncludedProduct.Id = int32(id)
 		productIncludedProduct.EnterpriseId = enterpriseId
 		ok = productIncludedProduct.deleteProductIncludedProduct()
+	case "PRODUCT_SUPPLIER":
+		if !permissions.Masters {
+			return
+		}
+		var productSupplier ProductSupplier
+		productSupplier.Id = int32(id)
+		productSupplier.EnterpriseId = enterpriseId
+		ok = productSupplier.deleteProductSupplier()
+	case "PRODUCT_UNIT_OF_MEASURE":
+		if !permissions.Masters {
+			return
+		}
+		var productUnit ProductUnitOfMeasure
+		productUnit.Id = int32(id)
+		productUnit.EnterpriseId = enterpriseId
+		ok = productUnit.deleteProductUnitOfMeasure()
 	case "DEPRECATED_PRODUCT":
 		if !(permissions.Masters && getUserPermission("PRODUCT_MANAGER", enterpriseId, userId)) {
 			return
@@ -2679,6 +3442,34 @@ func instructionDefaults(command string, message string, mt int, ws *websocket.C
 	var data []byte
 	// ALPHA
 	switch command {
+	case "SALES_ORDER_DETAIL_PRICE":
+		if !permissions.Sales {
+			return
+		}
+		var orderDetailDefaultsQuery OrderDetailDefaultsQuery
+		json.Unmarshal([]byte(message), &orderDetailDefaultsQuery)
+		data, _ = json.Marshal(getOrderDetailDefaults(orderDetailDefaultsQuery.ProductId, orderDetailDefaultsQuery.OrderId, orderDetailDefaultsQuery.Quantity, enterpriseId))
+	case "SALES_ORDER_DETAIL":
+		if !permissions.Sales {
+			return
+		}
+		// the order and the quantity are sent to resolve the price in the customer's price list, a bare product id is still accepted
+		var orderDetailDefaultsQuery OrderDetailDefaultsQuery
+		if json.Unmarshal([]byte(message), &orderDetailDefaultsQuery) != nil {
+			found = false
+			break
+		}
+		if orderDetailDefaultsQuery.Quantity <= 0 {
+			orderDetailDefaultsQuery.Quantity = 1
+		}
+		data, _ = json.Marshal(getOrderDetailDefaults(orderDetailDefaultsQuery.ProductId, orderDetailDefaultsQuery.OrderId, orderDetailDefaultsQuery.Quantity, enterpriseId))
+	case "PURCHASE_ORDER_DETAIL_PRICE":
+		if !permissions.Purchases {
+			return
+		}
+		var purchaseOrderDetailDefaultsQuery PurchaseOrderDetailDefaultsQuery
+		json.Unmarshal([]byte(message), &purchaseOrderDetailDefaultsQuery)
+		data, _ = json.Marshal(purchaseOrderDetailDefaultsQuery.getPurchaseOrderDetailDefaults(enterpriseId))
 	default:
 		found = false
 	}
@@ -2703,7 +3494,7 @@ func instructionDefaults(command string, message string, mt int, ws *websocket.C
 		if !permissions.Sales {
 			return
 		}
-		data, _ = json.Marshal(getOrderDetailDefaults(int32(id), enterpriseId))
+		data, _ = json.Marshal(getOrderDetailDefaults(int32(id), 0, 1, enterpriseId))
 	case "SUPPLIER":
 		if !permissions.Purchases {
 			return
@@ -2802,6 +3593,11 @@ func instructionLocate(command string, message string, mt int, ws *websocket.Con
 			return
 		}
 		data, _ = json.Marshal(locateColor(enterpriseId))
+	case "UNITS_OF_MEASURE":
+		if !permissions.Masters {
+			return
+		}
+		data, _ = json.Marshal(locateUnitsOfMeasure(enterpriseId))
 	case "PRODUCT_FAMILIES":
 		if !permissions.Masters {
 			return
@@ -2873,6 +3669,264 @@ func instructionAction(command string, message string, mt int, ws *websocket.Con
 			return
 		}
 		data, _ = json.Marshal(getSalesInvoiceRelations(int64(id), enterpriseId))
+	case "ACCEPT_SALES_QUOTATION":
+		if !permissions.Sales {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(acceptSalesQuotation(int64(id), enterpriseId, userId))
+	case "REJECT_SALES_QUOTATION":
+		if !permissions.Sales {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(rejectSalesQuotation(int64(id), enterpriseId, userId))
+	case "CREATE_SALES_RETURN_FROM_SALE_ORDER":
+		if !permissions.Sales {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(createSalesReturnFromSaleOrder(int64(id), enterpriseId, userId))
+	case "CREATE_SALES_RETURN_FROM_DELIVERY_NOTE":
+		if !permissions.Sales {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(createSalesReturnFromDeliveryNote(int64(id), enterpriseId, userId))
+	case "RECEIVE_SALES_RETURN":
+		if !permissions.Sales {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(receiveSalesReturn(int64(id), enterpriseId, userId))
+	case "CREDIT_SALES_RETURN":
+		if !permissions.Sales {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(creditSalesReturn(int64(id), enterpriseId, userId))
+	case "GET_SALES_RETURN_RELATIONS":
+		if !permissions.Sales {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(getSalesReturnRelations(int64(id), enterpriseId))
+	case "RUN_SALES_SUBSCRIPTION":
+		if !permissions.Sales {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(runSalesSubscriptionNow(int32(id), enterpriseId, userId))
+	case "RUN_DUNNING":
+		if !permissions.Accounting {
+			return
+		}
+		data, _ = json.Marshal(runDunning(enterpriseId))
+	case "RELEASE_CREDIT_HOLD_SALES_ORDER":
+		if !permissions.Admin {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(releaseCreditHoldSalesOrder(int64(id), enterpriseId, userId))
+	case "MATCH_PURCHASE_INVOICE":
+		if !(permissions.Purchases || permissions.Accounting) {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(checkPurchaseInvoiceMatch(int64(id), enterpriseId))
+	case "RELEASE_PURCHASE_INVOICE_MATCH":
+		if !permissions.Admin {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(releasePurchaseInvoiceMatch(int64(id), enterpriseId, userId))
+	case "ALLOCATE_LANDED_COST":
+		if !permissions.Purchases {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(allocateLandedCost(int64(id), enterpriseId, userId))
+	case "UNDO_LANDED_COST_ALLOCATION":
+		if !permissions.Purchases {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(undoLandedCostAllocation(int64(id), enterpriseId, userId))
+	case "PROCESS_EDI_INBOUND":
+		if !permissions.Sales {
+			return
+		}
+		data, _ = json.Marshal(processEdiInbound(enterpriseId))
+	case "GENERATE_EDI_DESADV":
+		if !(permissions.Sales || permissions.Preparation) {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(generateEdiDesadv(int64(id), enterpriseId))
+	case "GENERATE_EDI_INVOIC":
+		if !permissions.Sales {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(generateEdiInvoic(int64(id), enterpriseId))
+	case "REQUEST_FOR_QUOTATION_FROM_NEEDS":
+		if !permissions.Purchases {
+			return
+		}
+		var fromNeeds RequestForQuotationFromNeeds
+		json.Unmarshal([]byte(message), &fromNeeds)
+		data, _ = json.Marshal(fromNeeds.createRequestForQuotationFromNeeds(enterpriseId, userId))
+	case "SEND_REQUEST_FOR_QUOTATION":
+		if !permissions.Purchases {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(sendRequestForQuotation(int64(id), enterpriseId, userId))
+	case "AWARD_REQUEST_FOR_QUOTATION":
+		if !permissions.Purchases {
+			return
+		}
+		var award RequestForQuotationAward
+		json.Unmarshal([]byte(message), &award)
+		data, _ = json.Marshal(award.awardRequestForQuotation(enterpriseId, userId))
+	case "SET_WAREHOUSE_MOVEMENT_LOT":
+		if !permissions.Warehouse {
+			return
+		}
+		var setLot SetWarehouseMovementLot
+		json.Unmarshal([]byte(message), &setLot)
+		data, _ = json.Marshal(setLot.setWarehouseMovementLot(enterpriseId))
+	case "PUT_AWAY_SUGGESTIONS":
+		if !permissions.Warehouse {
+			return
+		}
+		var q PutAwayQuery
+		json.Unmarshal([]byte(message), &q)
+		data, _ = json.Marshal(q.getPutAwaySuggestions(enterpriseId))
+	case "MOVE_STOCK_LOCATION":
+		if !permissions.Warehouse {
+			return
+		}
+		var move StockLocationMove
+		json.Unmarshal([]byte(message), &move)
+		data, _ = json.Marshal(move.moveStockLocation(enterpriseId))
+	case "SET_MANUFACTURING_ORDER_SERIAL_NUMBERS":
+		if !permissions.Manufacturing {
+			return
+		}
+		var serialNumbers ManufacturingOrderSerialNumbers
+		json.Unmarshal([]byte(message), &serialNumbers)
+		data, _ = json.Marshal(serialNumbers.setManufacturingOrderSerialNumbers(enterpriseId))
+	case "SET_SALES_RETURN_DETAIL_SERIAL_NUMBERS":
+		if !permissions.Sales {
+			return
+		}
+		var serialNumbers SalesReturnDetailSerialNumbers
+		json.Unmarshal([]byte(message), &serialNumbers)
+		data, _ = json.Marshal(serialNumbers.setSalesReturnDetailSerialNumbers(enterpriseId))
+	case "GET_SALES_AGENT_COMMISSIONS":
+		if !permissions.Sales {
+			return
+		}
+		var salesAgentCommissionQuery SalesAgentCommissionQuery
+		json.Unmarshal([]byte(message), &salesAgentCommissionQuery)
+		data, _ = json.Marshal(salesAgentCommissionQuery.getSalesAgentCommissions(enterpriseId))
+	case "SETTLE_SALES_AGENT_COMMISSIONS":
+		if !permissions.Sales {
+			return
+		}
+		var salesAgentCommissionQuery SalesAgentCommissionQuery
+		json.Unmarshal([]byte(message), &salesAgentCommissionQuery)
+		data, _ = json.Marshal(salesAgentCommissionQuery.settleSalesAgentCommissions(enterpriseId, userId))
+	case "GET_SALES_AGENT_SETTLEMENT_COMMISSIONS":
+		if !permissions.Sales {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(getSalesAgentSettlementCommissions(int64(id), enterpriseId))
+	case "DELETE_SALES_AGENT_SETTLEMENT":
+		if !permissions.Sales {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(deleteSalesAgentSettlement(int64(id), enterpriseId, userId))
+	case "GENERATE_DROP_SHIPPING_PURCHASE_ORDERS":
+		if !permissions.Purchases {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(generateDropShippingPurchaseOrders(int64(id), enterpriseId, userId))
+	case "CONFIRM_DROP_SHIPPING_PURCHASE_ORDER":
+		if !permissions.Purchases {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(confirmDropShippingPurchaseOrder(int64(id), enterpriseId, userId))
+	case "IMPORT_PURCHASE_INVOICE_UBL":
+		if !permissions.Purchases {
+			return
+		}
+		data, _ = json.Marshal(importPurchaseInvoiceUBL([]byte(message), enterpriseId, userId))
 	case "TOGGLE_MANUFACTURING_ORDER":
 		if !permissions.Manufacturing {
 			return
@@ -3146,6 +4200,25 @@ func instructionAction(command string, message string, mt int, ws *websocket.Con
 		var invoiceIds []int64
 		json.Unmarshal([]byte(message), &invoiceIds)
 		data, _ = json.Marshal(purchasePostInvoices(invoiceIds, enterpriseId, userId))
+	case "VERIFY_SALES_INVOICE_REGISTER":
+		if !permissions.Accounting {
+			return
+		}
+		data, _ = json.Marshal(verifySalesInvoiceRegister(enterpriseId))
+	case "SUBMIT_SALES_INVOICE_REGISTER":
+		if !permissions.Accounting {
+			return
+		}
+		data, _ = json.Marshal(submitSalesInvoiceRegister(enterpriseId))
+	case "GET_SALES_INVOICE_REGISTER":
+		if !permissions.Accounting {
+			return
+		}
+		id, err := strconv.Atoi(message)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(getSalesInvoiceRegisterByInvoice(int64(id), enterpriseId))
 	case "MANUFACTURING_ORDER_TAG_PRINTED":
 		if !permissions.Manufacturing {
 			return
@@ -3401,6 +4474,20 @@ func instructionAction(command string, message string, mt int, ws *websocket.Con
 		query.enterpriseId = enterpriseId
 		json.Unmarshal([]byte(message), &query)
 		data, _ = json.Marshal(query.intrastatReport())
+	case "STATEMENT_OF_ACCOUNT":
+		if !permissions.Accounting {
+			return
+		}
+		var query StatementOfAccountQuery
+		json.Unmarshal([]byte(message), &query)
+		data, _ = json.Marshal(query.getStatementOfAccount(enterpriseId))
+	case "AGING_REPORT":
+		if !permissions.Accounting {
+			return
+		}
+		var query AgingReportQuery
+		json.Unmarshal([]byte(message), &query)
+		data, _ = json.Marshal(query.getAgingReport(enterpriseId))
 	case "TRANSFER_BETWEEN_WAREHOUSES_DETAIL_SENT_TO_PREPARATION":
 		if !permissions.Preparation {
 			return
@@ -3447,6 +4534,11 @@ func instructionAction(command string, message string, mt int, ws *websocket.Con
 			return
 		}
 		data, _ = json.Marshal(regenerateStockRecords(enterpriseId))
+	case "REGENERATE_COST_LAYERS":
+		if !permissions.Admin {
+			return
+		}
+		data, _ = json.Marshal(regenerateCostLayers(enterpriseId))
 	case "TOGGLE_DEPRECATED_PRODUCT_CHECK_LIST":
 		if !(permissions.Masters && getUserPermission("PRODUCT_MANAGER", enterpriseId, userId)) {
 			return
@@ -3535,6 +4627,14 @@ func instructionSearch(command string, message string, mt int, ws *websocket.Con
 		json.Unmarshal([]byte(message), &salesOrderSearch)
 		salesOrderSearch.enterprise = enterpriseId
 		data, _ = json.Marshal(salesOrderSearch.searchSalesOrder())
+	case "SALES_QUOTATION":
+		if !permissions.Sales {
+			return
+		}
+		var salesQuotationSearch SalesQuotationSearch
+		json.Unmarshal([]byte(message), &salesQuotationSearch)
+		salesQuotationSearch.enterprise = enterpriseId
+		data, _ = json.Marshal(salesQuotationSearch.searchSalesQuotations())
 	case "SALES_INVOICE":
 		if !permissions.Sales {
 			return
@@ -49,6 +49,8 @@ type ManufacturingOrder struct {
 	WarehouseMovement    *WarehouseMovement     `json:"warehouseMovement" gorm:"foreignKey:WarehouseMovementId,EnterpriseId;references:Id,EnterpriseId"`
 	QuantityManufactured int32                  `json:"quantityManufactured" gorm:"column:quantity_manufactured;not null:true"`
 	Complex              bool                   `json:"-" gorm:"column:complex;not null:true;index:manufacturing_order_for_stock_pending,priority:5,where:NOT manufactured AND order_detail IS NULL AND NOT complex"`
+	LotNumber            string                 `json:"lotNumber" gorm:"column:lot_number;type:character varying(40);not null:true;default:''"` // Lot of the output, only for products with lot tracking. It's generated when manufacturing if it's empty.
+	ExpiryDate           *time.Time             `json:"expiryDate" gorm:"column:expiry_date;type:timestamp(3) with time zone"`
 }
 
 func (mo *ManufacturingOrder) TableName() string {
@@ -431,7 +433,7 @@ func toggleManufactuedManufacturingOrder(orderId int64, userId int32, enterprise
 
 			orderDetail := getSalesOrderDetailRow(*inMemoryManufacturingOrder.OrderDetailId)
 
-			if int32(manufacturedOrders) >= orderDetail.Quantity {
+			if float64(manufacturedOrders) >= orderDetail.Quantity {
 				status = "E"
 			} else {
 				status = "D"
@@ -466,18 +468,45 @@ func toggleManufactuedManufacturingOrder(orderId int64, userId int32, enterprise
 
 	// Create / delete warehouse movement
 	if inMemoryManufacturingOrder.Manufactured {
+		if inMemoryManufacturingOrder.Product.TrackLots && len(inMemoryManufacturingOrder.LotNumber) == 0 {
+			inMemoryManufacturingOrder.LotNumber = generateManufacturingLotNumber(*inMemoryManufacturingOrder.DateManufactured, inMemoryManufacturingOrder.Id)
+			result = trans.Model(&ManufacturingOrder{}).Where("id = ?", inMemoryManufacturingOrder.Id).Update("lot_number", inMemoryManufacturingOrder.LotNumber)
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				trans.Rollback()
+				return false
+			}
+		}
+
 		movement := WarehouseMovement{
 			WarehouseId:  inMemoryManufacturingOrder.WarehouseId,
 			ProductId:    inMemoryManufacturingOrder.ProductId,
-			Quantity:     inMemoryManufacturingOrder.QuantityManufactured,
+			Quantity:     float64(inMemoryManufacturingOrder.QuantityManufactured),
 			Type:         "I", // Input
 			EnterpriseId: enterpriseId,
+			LotNumber:    inMemoryManufacturingOrder.LotNumber,
+			ExpiryDate:   inMemoryManufacturingOrder.ExpiryDate,
+		}
+		// the units get the serial numbers set in the order, or a serial number generated from the order
+		if inMemoryManufacturingOrder.Product.TrackSerials {
+			movement.SerialNumbers = getSerialNumbersAssigned("manufacturing_order", inMemoryManufacturingOrder.Id, enterpriseId, trans)
+			if len(movement.SerialNumbers) == 0 {
+				movement.SerialNumbers = generateManufacturingSerialNumbers(inMemoryManufacturingOrder.Id, inMemoryManufacturingOrder.QuantityManufactured)
+			}
 		}
 		ok := movement.insertWarehouseMovement(userId, trans)
 		if !ok {
 			trans.Rollback()
 			return false
 		}
+		if len(movement.SerialNumbers) > 0 {
+			result = trans.Model(&ProductSerial{}).Where("product = ? AND serial_number IN ? AND enterprise = ?", movement.ProductId, movement.SerialNumbers, enterpriseId).Update("manufacturing_order", inMemoryManufacturingOrder.Id)
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				trans.Rollback()
+				return false
+			}
+		}
 
 		result = trans.Model(&ManufacturingOrder{}).Where("id = ?", inMemoryManufacturingOrder.Id).Update("warehouse_movement", movement.Id)
 		if result.Error != nil {
@@ -558,7 +587,7 @@ func manufacturingOrderAllSaleOrder(saleOrderId int64, userId int32, enterpriseI
 				continue
 			}
 
-			for j := 0; j < int(orderDetail.Quantity); j += int(manufacturingOrderType.QuantityManufactured) {
+			for j := 0.0; j < orderDetail.Quantity; j += float64(manufacturingOrderType.QuantityManufactured) {
 				o := ManufacturingOrder{}
 				o.ProductId = orderDetail.ProductId
 				o.OrderDetailId = &orderDetail.Id
@@ -610,7 +639,7 @@ func (orderInfo *ManufacturingOrderGenerate) manufacturingOrderPartiallySaleOrde
 
 		// get the details
 		orderDetail := getSalesOrderDetailRow(orderInfoSelection.Id)
-		if orderDetail.Id <= 0 || orderDetail.OrderId != orderInfoSelection.OrderId || orderInfoSelection.Quantity == 0 || orderInfoSelection.Quantity > orderDetail.Quantity {
+		if orderDetail.Id <= 0 || orderDetail.OrderId != orderInfoSelection.OrderId || orderInfoSelection.Quantity == 0 || float64(orderInfoSelection.Quantity) > orderDetail.Quantity {
 			trans.Rollback()
 			return false
 		}
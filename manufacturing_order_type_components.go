@@ -21,7 +21,7 @@ type ManufacturingOrderTypeComponents struct {
 	Type                     string                 `json:"type" gorm:"type:character(1);not null:true;index:manufacturing_order_type_components_manufacturing_order_type_ty,unique:true,priority:2"` // I = Input, O = Output
 	ProductId                int32                  `json:"productId" gorm:"column:product;not null:true;index:manufacturing_order_type_components_component,unique:true,priority:2;index:manufacturing_order_type_components_manufacturing_order_type_ty,unique:true,priority:3"`
 	Product                  Product                `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
-	Quantity                 int32                  `json:"quantity" gorm:"not null:true"`
+	Quantity                 float64                `json:"quantity" gorm:"type:numeric(14,6);not null:true"`
 	EnterpriseId             int32                  `json:"-" gorm:"column:enterprise;not null:true;index:manufacturing_order_type_components_id_enterprise,unique:true,priority:2"`
 	Enterprise               Settings               `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 }
@@ -69,6 +69,7 @@ func (c *ManufacturingOrderTypeComponents) isValid() (bool, uint8) {
 	if product.Id <= 0 {
 		return false, 0
 	}
+	c.Quantity = roundQuantityDecimals(c.Quantity, product.QuantityDecimals)
 	if c.Type == "I" {
 		if product.ManufacturingOrderTypeId != nil && *product.ManufacturingOrderTypeId == c.ManufacturingOrderTypeId {
 			return false, 1
@@ -127,7 +127,7 @@ func TestManufacturingOrderAllSaleOrder(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 
 	d := SalesOrderDetail{
 		OrderId:      orderId,
@@ -138,7 +138,7 @@ func TestManufacturingOrderAllSaleOrder(t *testing.T) {
 		EnterpriseId: 1,
 	}
 
-	d.insertSalesOrderDetail(1)
+	d.insertSalesOrderDetail(1, nil)
 
 	invoiceAllSaleOrder(orderId, 1, 0)
 	ok := manufacturingOrderAllSaleOrder(orderId, 1, 1)
@@ -193,7 +193,7 @@ func TestManufacturingOrderPartiallySaleOrder(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 
 	d := SalesOrderDetail{
 		OrderId:      orderId,
@@ -204,7 +204,7 @@ func TestManufacturingOrderPartiallySaleOrder(t *testing.T) {
 		EnterpriseId: 1,
 	}
 
-	d.insertSalesOrderDetail(1)
+	d.insertSalesOrderDetail(1, nil)
 	invoiceAllSaleOrder(orderId, 1, 0)
 
 	details := getSalesOrderDetail(orderId, 1)
@@ -292,7 +292,7 @@ func TestManufacturingOrderQuantity(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	_, orderId := o.insertSalesOrder(0)
+	_, orderId := o.insertSalesOrder(0, nil)
 
 	d := SalesOrderDetail{
 		OrderId:      orderId,
@@ -303,7 +303,7 @@ func TestManufacturingOrderQuantity(t *testing.T) {
 		EnterpriseId: 1,
 	}
 
-	d.insertSalesOrderDetail(0)
+	d.insertSalesOrderDetail(0, nil)
 
 	invoiceAllSaleOrder(orderId, 1, 0)
 
@@ -475,7 +475,7 @@ func TestAsignSaleOrderToManufacturingOrderForStock(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	_, orderId := o.insertSalesOrder(0)
+	_, orderId := o.insertSalesOrder(0, nil)
 
 	d := SalesOrderDetail{
 		OrderId:      orderId,
@@ -486,7 +486,7 @@ func TestAsignSaleOrderToManufacturingOrderForStock(t *testing.T) {
 		EnterpriseId: 1,
 	}
 
-	d.insertSalesOrderDetail(0)
+	d.insertSalesOrderDetail(0, nil)
 
 	invoiceAllSaleOrder(orderId, 1, 0)
 
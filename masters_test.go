@@ -700,13 +700,98 @@ func TestGetOrderDetailDefaults(t *testing.T) {
 		ConnectTestWithDB(t)
 	}
 
-	detauls := getOrderDetailDefaults(1, 1)
+	detauls := getOrderDetailDefaults(1, 0, 1, 1)
 	if detauls.Price == 0 || detauls.VatPercent == 0 {
 		t.Error("Order details defaults lot loaded")
 		return
 	}
 }
 
+func TestProductSupplierInsertUpdateDelete(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	ps := ProductSupplier{
+		ProductId:         1,
+		SupplierId:        1,
+		SupplierReference: "TEST-REF-0001",
+		PurchasePrice:     3.5,
+		MinimumQuantity:   10,
+		PackMultiple:      6,
+		LeadTimeDays:      7,
+		Preferred:         true,
+		EnterpriseId:      1,
+	}
+	if !ps.insertProductSupplier() {
+		t.Error("Insert error, can't insert product supplier")
+		return
+	}
+
+	suppliers := getProductSuppliers(1, 1)
+	if len(suppliers) == 0 || suppliers[0].SupplierReference != "TEST-REF-0001" {
+		t.Error("Can't scan product suppliers")
+		return
+	}
+	ps = suppliers[0]
+
+	ps.PurchasePrice = 3
+	if !ps.updateProductSupplier() {
+		t.Error("Update error, can't update product supplier")
+		return
+	}
+
+	// the defaults of the purchase order details come from the product supplier
+	q := PurchaseOrderDetailDefaultsQuery{ProductId: 1, Quantity: 1}
+	product := getProductRow(1)
+	if product.SupplierId != nil && *product.SupplierId == 1 {
+		defaults := q.getPurchaseOrderDetailDefaults(1)
+		if defaults.Price != 3 || defaults.Quantity != 12 || defaults.SupplierReference != "TEST-REF-0001" {
+			t.Error("The purchase order detail defaults don't come from the product supplier", defaults)
+			return
+		}
+	}
+
+	supplierId, productSupplier := selectProductSupplier(product, PURCHASE_SUPPLIER_SELECTION_PREFERRED, nil, 1)
+	if supplierId == nil || *supplierId != 1 || productSupplier == nil || productSupplier.Id != ps.Id {
+		t.Error("The preferred supplier has not been selected")
+		return
+	}
+
+	if findUBLProduct("TEST-REF-0001", "", 1, 1) == nil {
+		t.Error("The product can't be found by the reference of the supplier")
+		return
+	}
+
+	if !ps.deleteProductSupplier() {
+		t.Error("Delete error, can't delete product supplier")
+		return
+	}
+}
+
+func TestProductSupplierSelection(t *testing.T) {
+	ps := ProductSupplier{MinimumQuantity: 10, PackMultiple: 6}
+	if ps.adjustQuantity(1) != 12 || ps.adjustQuantity(12) != 12 || ps.adjustQuantity(13) != 18 {
+		t.Error("The quantity has not been adjusted to the minimum quantity and the pack multiple")
+		return
+	}
+
+	suppliers := []ProductSupplier{
+		{SupplierId: 1, PurchasePrice: 10, LeadTimeDays: 5},
+		{SupplierId: 2, PurchasePrice: 8, LeadTimeDays: 20},
+		{SupplierId: 3, PurchasePrice: 8, LeadTimeDays: 10},
+		{SupplierId: 4, PurchasePrice: 12, LeadTimeDays: 1, Preferred: true},
+	}
+	if chooseProductSupplier(suppliers, PURCHASE_SUPPLIER_SELECTION_PREFERRED) != 3 {
+		t.Error("The preferred supplier has not been selected")
+		return
+	}
+	if chooseProductSupplier(suppliers, PURCHASE_SUPPLIER_SELECTION_CHEAPEST) != 2 {
+		t.Error("The cheapest supplier has not been selected")
+		return
+	}
+}
+
 func TestProductRelations(t *testing.T) {
 	if db == nil {
 		ConnectTestWithDB(t)
@@ -982,7 +1067,7 @@ func TestProductOffSaleOrderDetailInsert(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 
 	p := Product{
 		Name:              "Glass Office Desk",
@@ -1018,7 +1103,7 @@ func TestProductOffSaleOrderDetailInsert(t *testing.T) {
 	}
 
 	// test insert
-	ok = d.insertSalesOrderDetail(0).Ok
+	ok = d.insertSalesOrderDetail(0, nil).Ok
 	if ok {
 		t.Error("Insert error, sale order detail inserted with an off product")
 		return
@@ -1070,7 +1155,7 @@ func TestSaleOrderDetailNoStock(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 
 	p := Product{
 		Name:              "Glass Office Desk",
@@ -1106,7 +1191,7 @@ func TestSaleOrderDetailNoStock(t *testing.T) {
 	}
 
 	// test insert
-	ok = d.insertSalesOrderDetail(0).Ok
+	ok = d.insertSalesOrderDetail(0, nil).Ok
 	if !ok {
 		t.Error("Insert error, sale order detail not inserted")
 		return
@@ -2363,6 +2448,144 @@ func TestIncotermsInsertUpdateDelete(t *testing.T) {
 	}
 }
 
+// ===== PRICE LISTS
+
+func TestPriceListInsertUpdateDelete(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	p := PriceList{
+		Name:            "Test price list",
+		CurrencyId:      1,
+		DiscountPercent: 10,
+		EnterpriseId:    1,
+	}
+
+	ok := p.insertPriceList()
+	if !ok {
+		t.Error("Insert error, can't insert price list")
+		return
+	}
+
+	priceLists := getPriceLists(1)
+	p = priceLists[len(priceLists)-1]
+
+	p.Name = "Test test"
+	ok = p.updatePriceList()
+	if !ok {
+		t.Error("Update error, price list not updated")
+		return
+	}
+
+	priceLists = getPriceLists(1)
+	p = priceLists[len(priceLists)-1]
+
+	if p.Name != "Test test" {
+		t.Error("Update not successful")
+		return
+	}
+
+	ok = p.deletePriceList()
+	if !ok {
+		t.Error("Delete error, price list not deleted")
+		return
+	}
+}
+
+func TestGetProductPriceForCustomer(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	p := PriceList{
+		Name:         "Test price list",
+		CurrencyId:   1,
+		EnterpriseId: 1,
+	}
+	ok := p.insertPriceList()
+	if !ok {
+		t.Error("Insert error, can't insert price list")
+		return
+	}
+
+	product := getProductRow(1)
+	fixedPrice := PriceListProduct{
+		PriceListId:     p.Id,
+		ProductId:       1,
+		MinimumQuantity: 1,
+		Price:           product.Price + 1,
+		EnterpriseId:    1,
+	}
+	ok = fixedPrice.insertPriceListProduct()
+	if !ok {
+		t.Error("Insert error, can't insert price list product")
+		return
+	}
+	quantityBreak := PriceListProduct{
+		PriceListId:     p.Id,
+		ProductId:       1,
+		MinimumQuantity: 10,
+		DiscountPercent: 50,
+		EnterpriseId:    1,
+	}
+	ok = quantityBreak.insertPriceListProduct()
+	if !ok {
+		t.Error("Insert error, can't insert price list product")
+		return
+	}
+
+	// the price list is assigned to the customer group of the customer
+	g := CustomerGroup{
+		Name:         "Test group",
+		PriceListId:  &p.Id,
+		EnterpriseId: 1,
+	}
+	ok = g.insertCustomerGroup()
+	if !ok {
+		t.Error("Insert error, can't insert customer group")
+		return
+	}
+
+	c := getCustomerRow(1)
+	c.CustomerGroupId = &g.Id
+	c.updateCustomer(0)
+
+	price, ok := getProductPriceForCustomer(1, 1, 1, 1, 1)
+	if !ok || price != product.Price+1 {
+		t.Error("The fixed price of the price list has not been applied", price)
+		return
+	}
+
+	price, ok = getProductPriceForCustomer(1, 1, 1, 10, 1)
+	if !ok || price != product.Price*0.5 {
+		t.Error("The quantity break of the price list has not been applied", price)
+		return
+	}
+
+	// the price list is not in this currency
+	_, ok = getProductPriceForCustomer(1, 1, 2, 1, 1)
+	if ok {
+		t.Error("The price list has been applied in another currency")
+		return
+	}
+
+	c.CustomerGroupId = nil
+	c.updateCustomer(0)
+
+	ok = g.deleteCustomerGroup()
+	if !ok {
+		t.Error("Delete error, customer group not deleted")
+		return
+	}
+
+	ok = p.deletePriceList()
+	if !ok {
+		t.Error("Delete error, price list not deleted")
+		return
+	}
+}
+
 // ===== DOCUMENT CONTAINER
 
 /* GET */
@@ -2449,3 +2672,134 @@ func TestLocateDocumentContainer(t *testing.T) {
 		return
 	}
 }
+
+// ===== UNITS OF MEASURE
+
+/* INSERT - UPDATE - DELETE */
+
+func TestUnitOfMeasureInsertUpdateDelete(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	u := UnitOfMeasure{
+		Name:         "Test",
+		Symbol:       "TST",
+		EnterpriseId: 1,
+	}
+
+	ok := u.insertUnitOfMeasure()
+	if !ok {
+		t.Error("Insert error, can't insert unit of measure")
+		return
+	}
+
+	units := getUnitsOfMeasure(1)
+	u = units[len(units)-1]
+
+	u.Name = "Test test"
+	ok = u.updateUnitOfMeasure()
+	if !ok {
+		t.Error("Update error, unit of measure not updated")
+		return
+	}
+
+	units = getUnitsOfMeasure(1)
+	u = units[len(units)-1]
+
+	if u.Name != "Test test" {
+		t.Error("Update not successful")
+		return
+	}
+
+	ok = u.deleteUnitOfMeasure()
+	if !ok {
+		t.Error("Delete error, unit of measure not deleted")
+		return
+	}
+}
+
+/* FUNCTIONALITY */
+
+func TestProductUnitOfMeasureConversion(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	unit := UnitOfMeasure{Name: "Units", Symbol: "UN-T", EnterpriseId: 1}
+	box := UnitOfMeasure{Name: "Box of 12", Symbol: "BOX-T", EnterpriseId: 1}
+	if !unit.insertUnitOfMeasure() || !box.insertUnitOfMeasure() {
+		t.Error("Insert error, can't insert the units of measure")
+		return
+	}
+
+	p := Product{
+		Name:            "Product in boxes",
+		Reference:       "UOM-BOX",
+		ControlStock:    true,
+		VatPercent:      21,
+		Price:           1,
+		UnitOfMeasureId: &unit.Id,
+		EnterpriseId:    1,
+	}
+	okAndErr := p.insertProduct(0)
+	if !okAndErr.Ok {
+		t.Error("Insert error, could not insert product", okAndErr.ErrorCode)
+		return
+	}
+
+	pu := ProductUnitOfMeasure{ProductId: p.Id, UnitOfMeasureId: box.Id, Factor: 12, Purchase: true, EnterpriseId: 1}
+	if !pu.insertProductUnitOfMeasure() {
+		t.Error("Insert error, can't insert the conversion of the product")
+		return
+	}
+
+	quantity, factor, ok := convertLineQuantity(p.Id, &box.Id, 3, 0, false, 1)
+	if !ok || quantity != 36 || factor != 12 {
+		t.Error("The quantity has not been converted to units of stock", quantity, factor)
+		return
+	}
+	// the box is not allowed in the sales
+	_, _, ok = convertLineQuantity(p.Id, &box.Id, 3, 0, true, 1)
+	if ok {
+		t.Error("A unit of measure that can't be used in the sales has been converted")
+		return
+	}
+	quantity, factor, ok = convertLineQuantity(p.Id, &unit.Id, 5, 0, true, 1)
+	if !ok || quantity != 5 || factor != 1 {
+		t.Error("The unit of stock of the product has not been converted", quantity, factor)
+		return
+	}
+
+	// CLEAN UP
+	okAndErr = p.deleteProduct(0)
+	if !okAndErr.Ok {
+		t.Error("Delete error, could not delete product", okAndErr.ErrorCode, okAndErr.ExtraData)
+		return
+	}
+	unit.deleteUnitOfMeasure()
+	box.deleteUnitOfMeasure()
+}
+
+func TestFormatQuantityWithUnit(t *testing.T) {
+	if s := formatQuantityWithUnit(24, "UN", "BOX", 12); s != "2 BOX (24 UN)" {
+		t.Error("The quantity in an alternative unit is not correct", s)
+		return
+	}
+	if s := formatQuantityWithUnit(25, "UN", "BOX", 12); s != "25 UN" {
+		t.Error("A quantity that is not a whole number of boxes has been printed in boxes", s)
+		return
+	}
+	if s := formatQuantityWithUnit(7, "", "", 0); s != "7" {
+		t.Error("The quantity without units is not correct", s)
+		return
+	}
+	if s := formatQuantityWithUnit(12.5, "M", "", 0); s != "12.5 M" {
+		t.Error("The decimal quantity is not correct", s)
+		return
+	}
+	if s := formatQuantityWithUnit(2.4, "KG", "BAG", 2); s != "2.4 KG" {
+		t.Error("A decimal quantity that is not a whole number of bags has been printed in bags", s)
+		return
+	}
+}
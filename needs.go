@@ -12,18 +12,19 @@ package main
 
 import (
 	"sort"
+	"time"
 )
 
 type Need struct {
 	Product      int32   `json:"product"`
 	ProductName  string  `json:"productName"`
 	SupplierName *string `json:"supplierName"`
-	Quantity     int32   `json:"quantity"`
+	Quantity     float64 `json:"quantity"`
 }
 
 func getNeeds(enterpriseId int32) []Need {
 	var needs []Need = make([]Need, 0)
-	sqlStatement := `SELECT product,(SELECT name FROM product WHERE product.id=sales_order_detail.product),(SELECT name FROM suppliers WHERE suppliers.id=(SELECT supplier FROM product WHERE product.id=sales_order_detail.product)),SUM(quantity) FROM sales_order_detail WHERE status='A' AND enterprise=$1 GROUP BY product`
+	sqlStatement := `SELECT product,(SELECT name FROM product WHERE product.id=sales_order_detail.product),(SELECT name FROM suppliers WHERE suppliers.id=(SELECT supplier FROM product WHERE product.id=sales_order_detail.product)),SUM(quantity) FROM sales_order_detail WHERE status='A' AND NOT drop_shipping AND enterprise=$1 GROUP BY product`
 	rows, err := db.Query(sqlStatement, enterpriseId)
 	if err != nil {
 		log("DB", err.Error())
@@ -40,24 +41,26 @@ func getNeeds(enterpriseId int32) []Need {
 	return needs
 }
 
-func getNeedRow(productId int32) int32 {
-	sqlStatement := `SELECT SUM(quantity) FROM sales_order_detail WHERE status='A' AND product=$1 GROUP BY product`
+func getNeedRow(productId int32) float64 {
+	sqlStatement := `SELECT SUM(quantity) FROM sales_order_detail WHERE status='A' AND NOT drop_shipping AND product=$1 GROUP BY product`
 	row := db.QueryRow(sqlStatement, productId)
 	if row.Err() != nil {
 		log("DB", row.Err().Error())
 		return 0
 	}
 
-	var quantity int32
+	var quantity float64
 	row.Scan(&quantity)
 	return quantity
 }
 
 type PurchaseNeed struct {
-	ProductId int32 `json:"product"`
-	Quantity  int32 `json:"quantity"`
-	product   Product
-	supplier  Supplier
+	ProductId       int32   `json:"product"`
+	Quantity        float64 `json:"quantity"`
+	SupplierId      *int32  `json:"supplierId"` // Purchase from this supplier instead of the one chosen by the supplier selection
+	product         Product
+	supplier        Supplier
+	productSupplier *ProductSupplier
 }
 
 type PurchaseNeeds []PurchaseNeed
@@ -73,8 +76,9 @@ func (n PurchaseNeeds) Less(i, j int) bool {
 }
 
 type PurchaseNeedsData struct {
-	Needs     []PurchaseNeed `json:"needs"`
-	Warehouse string         `json:"warehouse"`
+	Needs             []PurchaseNeed `json:"needs"`
+	Warehouse         string         `json:"warehouse"`
+	SupplierSelection string         `json:"supplierSelection"` // P = Preferred supplier, C = Cheapest supplier. Empty = the supplier selection in the settings
 }
 
 // returns:
@@ -83,7 +87,7 @@ type PurchaseNeedsData struct {
 // 0 = internal error
 // 1 = no needs selected
 // 2 = the product selected is a manufacturing product
-// 3 = the product does not have a supplier
+// 3 = the product does not have a supplier, or the supplier selected does not exist
 // 4 = no quantity specified
 // 5 = the supplier does not have a main billing address
 // 6 = the supplier does not have a main shipping address
@@ -94,9 +98,14 @@ func (n *PurchaseNeedsData) generatePurchaseOrdersFromNeeds(enterpriseId int32,
 	if len(needs) == 0 {
 		return false, 1
 	}
-	if len(n.Warehouse) == 0 {
+	if len(n.Warehouse) == 0 || len(n.SupplierSelection) == 0 {
 		config := getSettingsRecordById(enterpriseId)
-		n.Warehouse = config.DefaultWarehouseId
+		if len(n.Warehouse) == 0 {
+			n.Warehouse = config.DefaultWarehouseId
+		}
+		if len(n.SupplierSelection) == 0 {
+			n.SupplierSelection = config.PurchaseSupplierSelection
+		}
 	}
 
 	///
@@ -116,7 +125,8 @@ func (n *PurchaseNeedsData) generatePurchaseOrdersFromNeeds(enterpriseId int32,
 			trans.Rollback()
 			return false, 2
 		}
-		if product.SupplierId == nil || *product.SupplierId <= 0 {
+		supplierId, productSupplier := selectProductSupplier(product, n.SupplierSelection, needs[i].SupplierId, enterpriseId)
+		if supplierId == nil || *supplierId <= 0 {
 			trans.Rollback()
 			return false, 3
 		}
@@ -125,9 +135,17 @@ func (n *PurchaseNeedsData) generatePurchaseOrdersFromNeeds(enterpriseId int32,
 			return false, 4
 		}
 
-		supplier := getSupplierRow(*product.SupplierId)
+		supplier := getSupplierRow(*supplierId)
+		if supplier.Id <= 0 || supplier.EnterpriseId != enterpriseId {
+			trans.Rollback()
+			return false, 3
+		}
 		needs[i].product = product
 		needs[i].supplier = supplier
+		needs[i].productSupplier = productSupplier
+		if productSupplier != nil {
+			needs[i].Quantity = productSupplier.adjustQuantity(needs[i].Quantity)
+		}
 	}
 
 	sort.Sort(PurchaseNeeds(needs))
@@ -180,6 +198,13 @@ func (n *PurchaseNeedsData) generatePurchaseOrdersFromNeeds(enterpriseId int32,
 				d.OrderId = orderId
 				d.ProductId = supplierNeeds[j].product.Id
 				d.Price = supplierNeeds[j].product.Price
+				if supplierNeeds[j].productSupplier != nil {
+					d.Price = supplierNeeds[j].productSupplier.getPriceInCurrency(&o.CurrencyId)
+					if supplierNeeds[j].productSupplier.LeadTimeDays > 0 {
+						datePromised := time.Now().AddDate(0, 0, int(supplierNeeds[j].productSupplier.LeadTimeDays))
+						d.DatePromised = &datePromised
+					}
+				}
 				d.Quantity = supplierNeeds[j].Quantity
 				d.VatPercent = supplierNeeds[j].product.VatPercent
 				d.WarehouseId = n.Warehouse
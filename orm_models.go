@@ -28,7 +28,15 @@ func addORMModels() bool {
 		&ShippingStatusHistory{}, &ShippingTag{}, &ProductImage{}, &PwdBlacklist{}, &PwdSHA1Blacklist{}, &PSAddress{}, &PSCarrier{}, &PSCountry{}, &PSCurrency{}, &PSCustomer{}, &PSLanguage{},
 		&PSOrder{}, &PSOrderDetail{}, &PSProduct{}, &PSProductCombination{}, &PSProductOptionValue{}, &PSState{}, &PSZone{}, &SYAddress{}, &SYCustomer{}, &SYDraftOrderLineItem{}, &SYDraftOrder{},
 		&SYOrderLineItem{}, &SYOrder{}, &SYProduct{}, &SYVariant{}, &WCCustomer{}, &WCOrderDetail{}, &WCOrder{}, &WCProductVariation{}, &WCProduct{}, &LabelPrinterProfile{},
-		&TransferBetweenWarehousesMinimumStock{}, &ProductIncludedProduct{}, &ProductIncludedProductSalesOrderDetail{}, &SettingsCleanUp{}, &DeprecatedProducts{}, &DeprecatedProductCheckList{}) // 117
+		&TransferBetweenWarehousesMinimumStock{}, &ProductIncludedProduct{}, &ProductIncludedProductSalesOrderDetail{}, &SettingsCleanUp{}, &DeprecatedProducts{}, &DeprecatedProductCheckList{},
+		&SalesQuotation{}, &SalesQuotationDetail{}, &PriceList{}, &PriceListProduct{}, &CustomerGroup{},
+		&SalesReturn{}, &SalesReturnDetail{}, &SalesSubscription{}, &SalesSubscriptionDetail{}, &SalesSubscriptionLog{},
+		&SalesAgent{}, &SalesAgentCommissionRule{}, &SalesAgentSettlement{}, &DropShippingDeliveryNoteDetail{}, &SalesInvoiceRegister{},
+		&DunningLevel{}, &DunningLevelTranslation{}, &DunningHistory{}, &ProductSupplier{},
+		&LandedCost{}, &LandedCostDeliveryNote{}, &LandedCostAllocation{},
+		&EdiMessage{}, &RequestForQuotation{}, &RequestForQuotationDetail{}, &RequestForQuotationSupplier{}, &RequestForQuotationReply{}, &ProductLot{}, &StockLot{}, &WarehouseMovementLot{}, &ProductSerial{}, &WarehouseMovementSerial{},
+		&WarehouseLocation{}, &StockLocation{}, &WarehouseMovementLocation{}, &InventoryProductLocation{},
+		&UnitOfMeasure{}, &ProductUnitOfMeasure{}, &CostLayer{}, &WarehouseMovementCostLayer{}) // 157
 	if err != nil {
 		fmt.Println("AutoMigrate", err)
 		log("AutoMigrate", err.Error())
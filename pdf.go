@@ -0,0 +1,473 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// THIS FILE CONTAINS A SMALL PDF WRITER FOR THE DOCUMENTS THAT ARE GENERATED IN THE SERVER, SUCH AS THE FACTUR-X INVOICES.
+// The documents are written as PDF/A-3b. The font is embedded from the TrueType file in the "pdfFontPath" setting of the config.json file.
+// If there is no font configured, the standard Helvetica font is used, but then the document is not a valid PDF/A document and it's not identified as PDF/A.
+
+const PDF_PAGE_WIDTH = 595 // A4 in points
+const PDF_PAGE_HEIGHT = 842
+
+// Widths of the characters 32 to 126 in the standard Helvetica font, in thousandths of the font size.
+var pdfHelveticaWidths []int = []int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, 556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, 667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, 556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// Unicode characters of the codes 128 to 159 in the WinAnsiEncoding.
+var pdfWinAnsiSpecialCharacters []rune = []rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+type PDFDocument struct {
+	Title        string
+	XMPExtension string // Additional rdf:Description elements for the XMP metadata
+	DateCreated  time.Time
+	font         PDFFont
+	pages        []*PDFPage
+	attachments  []PDFAttachment
+	objects      [][]byte
+}
+
+type PDFPage struct {
+	document *PDFDocument
+	content  bytes.Buffer
+}
+
+// File embedded in the PDF document, such as the XML of an electronic invoice.
+type PDFAttachment struct {
+	FileName     string
+	Description  string
+	MimeType     string
+	Relationship string // Data, Source, Alternative, Supplement or Unspecified
+	Content      []byte
+	DateModified time.Time
+}
+
+type PDFFont struct {
+	name        string
+	widths      [224]int // widths of the characters 32 to 255 in the WinAnsiEncoding
+	file        []byte   // TrueType file to embed, nil for the standard Helvetica font
+	bbox        [4]int
+	ascent      int
+	descent     int
+	capHeight   int
+	italicAngle float64
+}
+
+func newPDFDocument(title string) *PDFDocument {
+	d := PDFDocument{Title: title, DateCreated: time.Now()}
+	if len(settings.Server.PdfFontPath) > 0 {
+		font, err := loadPDFTrueTypeFont(settings.Server.PdfFontPath)
+		if err == nil {
+			d.font = font
+		} else {
+			log("PDF", err.Error())
+		}
+	}
+	if d.font.file == nil {
+		d.font = pdfHelveticaFont()
+	}
+	return &d
+}
+
+// The documents can only be PDF/A when the font is embedded in the file.
+func (d *PDFDocument) isFontEmbedded() bool {
+	return d.font.file != nil
+}
+
+func (d *PDFDocument) addPage() *PDFPage {
+	p := PDFPage{document: d}
+	d.pages = append(d.pages, &p)
+	return &p
+}
+
+func (d *PDFDocument) attachFile(a PDFAttachment) {
+	d.attachments = append(d.attachments, a)
+}
+
+// Returns the width of the text in points.
+func (d *PDFDocument) textWidth(text string, size float64) float64 {
+	var width int
+	for _, c := range pdfWinAnsiText(text) {
+		if c >= 32 {
+			width += d.font.widths[c-32]
+		}
+	}
+	return float64(width) * size / 1000
+}
+
+// Writes the text with the baseline starting at the position x, y. The origin is the bottom left corner of the page.
+func (p *PDFPage) text(x float64, y float64, size float64, text string) {
+	p.content.WriteString(fmt.Sprintf("BT /F1 %.1f Tf %.2f %.2f Td (%s) Tj ET\n", size, x, y, pdfEscapeString(pdfWinAnsiText(text))))
+}
+
+// Writes the text ending at the position x, y.
+func (p *PDFPage) textRight(x float64, y float64, size float64, text string) {
+	p.text(x-p.document.textWidth(text, size), y, size, text)
+}
+
+// Writes the text starting at the position x, y, cutting it at the given width.
+func (p *PDFPage) textCut(x float64, y float64, size float64, width float64, text string) {
+	for len(text) > 0 && p.document.textWidth(text, size) > width {
+		runes := []rune(text)
+		text = string(runes[:len(runes)-1])
+	}
+	p.text(x, y, size, text)
+}
+
+func (p *PDFPage) line(x1 float64, y1 float64, x2 float64, y2 float64) {
+	p.content.WriteString(fmt.Sprintf("0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2))
+}
+
+// Returns the PDF document.
+func (d *PDFDocument) output() []byte {
+	d.objects = make([][]byte, 0)
+
+	// the numbers of the objects that are referenced before being written are reserved
+	catalogNumber := d.reserveObject()
+	pagesNumber := d.reserveObject()
+	fontNumber := d.writeFont()
+
+	pageNumbers := make([]string, 0)
+	for i := 0; i < len(d.pages); i++ {
+		contentNumber := d.addStream("", d.pages[i].content.Bytes(), true)
+		pageNumber := d.addObject(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 %d 0 R >> /ColorSpace << /DefaultGray [/CalGray << /WhitePoint [0.9505 1 1.089] >>] >> >> /Contents %d 0 R >>",
+			pagesNumber, PDF_PAGE_WIDTH, PDF_PAGE_HEIGHT, fontNumber, contentNumber))
+		pageNumbers = append(pageNumbers, fmt.Sprintf("%d 0 R", pageNumber))
+	}
+	d.setObject(pagesNumber, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(pageNumbers, " "), len(pageNumbers)))
+
+	// attachments
+	fileSpecs := make([]string, 0)
+	names := make([]string, 0)
+	for i := 0; i < len(d.attachments); i++ {
+		a := d.attachments[i]
+		checksum := md5.Sum(a.Content)
+		fileNumber := d.addStream(fmt.Sprintf("/Type /EmbeddedFile /Subtype /%s /Params << /ModDate %s /Size %d /CheckSum <%s> >>",
+			strings.Replace(a.MimeType, "/", "#2F", -1), pdfDate(a.DateModified), len(a.Content), hex.EncodeToString(checksum[:])), a.Content, true)
+		fileName := pdfEscapeString(pdfWinAnsiText(a.FileName))
+		fileSpecNumber := d.addObject(fmt.Sprintf("<< /Type /Filespec /F (%s) /UF %s /Desc %s /AFRelationship /%s /EF << /F %d 0 R /UF %d 0 R >> >>",
+			fileName, pdfTextString(a.FileName), pdfTextString(a.Description), a.Relationship, fileNumber, fileNumber))
+		fileSpecs = append(fileSpecs, fmt.Sprintf("%d 0 R", fileSpecNumber))
+		names = append(names, fmt.Sprintf("(%s) %d 0 R", fileName, fileSpecNumber))
+	}
+
+	metadataNumber := d.addStream("/Type /Metadata /Subtype /XML", []byte(d.xmpMetadata()), false)
+	catalog := fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R /Metadata %d 0 R", pagesNumber, metadataNumber)
+	if len(fileSpecs) > 0 {
+		catalog += fmt.Sprintf(" /AF [%s] /Names << /EmbeddedFiles << /Names [%s] >> >>", strings.Join(fileSpecs, " "), strings.Join(names, " "))
+	}
+	d.setObject(catalogNumber, catalog+" >>")
+	infoNumber := d.addObject(fmt.Sprintf("<< /Title %s /Producer (MARKETNET) /Creator (MARKETNET) /CreationDate %s /ModDate %s >>",
+		pdfTextString(d.Title), pdfDate(d.DateCreated), pdfDate(d.DateCreated)))
+
+	// file
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(d.objects))
+	for i := 0; i < len(d.objects); i++ {
+		offsets[i] = pdf.Len()
+		pdf.WriteString(fmt.Sprintf("%d 0 obj\n", i+1))
+		pdf.Write(d.objects[i])
+		pdf.WriteString("\nendobj\n")
+	}
+	xrefOffset := pdf.Len()
+	pdf.WriteString(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1))
+	for i := 0; i < len(offsets); i++ {
+		pdf.WriteString(fmt.Sprintf("%010d 00000 n \n", offsets[i]))
+	}
+	id := md5.Sum([]byte(d.Title + d.DateCreated.String()))
+	pdf.WriteString(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R /ID [<%s> <%s>] >>\nstartxref\n%d\n%%%%EOF\n",
+		len(d.objects)+1, catalogNumber, infoNumber, hex.EncodeToString(id[:]), hex.EncodeToString(id[:]), xrefOffset))
+	return pdf.Bytes()
+}
+
+func (d *PDFDocument) reserveObject() int {
+	d.objects = append(d.objects, nil)
+	return len(d.objects)
+}
+
+func (d *PDFDocument) setObject(number int, object string) {
+	d.objects[number-1] = []byte(object)
+}
+
+func (d *PDFDocument) addObject(object string) int {
+	d.objects = append(d.objects, []byte(object))
+	return len(d.objects)
+}
+
+// Adds a stream object with the given dictionary entries, compressing it if required.
+func (d *PDFDocument) addStream(dictionary string, data []byte, compress bool) int {
+	if compress {
+		var buffer bytes.Buffer
+		w := zlib.NewWriter(&buffer)
+		w.Write(data)
+		w.Close()
+		data = buffer.Bytes()
+		dictionary = strings.TrimSpace(dictionary + " /Filter /FlateDecode")
+	}
+	var object bytes.Buffer
+	object.WriteString(fmt.Sprintf("<< %s /Length %d >>\nstream\n", dictionary, len(data)))
+	object.Write(data)
+	object.WriteString("\nendstream")
+	d.objects = append(d.objects, object.Bytes())
+	return len(d.objects)
+}
+
+func (d *PDFDocument) writeFont() int {
+	f := d.font
+	if f.file == nil {
+		return d.addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	}
+	fontFileNumber := d.addStream(fmt.Sprintf("/Length1 %d", len(f.file)), f.file, true)
+	descriptorNumber := d.addObject(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle %.2f /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		f.name, f.bbox[0], f.bbox[1], f.bbox[2], f.bbox[3], f.italicAngle, f.ascent, f.descent, f.capHeight, fontFileNumber))
+	widths := make([]string, len(f.widths))
+	for i := 0; i < len(f.widths); i++ {
+		widths[i] = fmt.Sprintf("%d", f.widths[i])
+	}
+	return d.addObject(fmt.Sprintf("<< /Type /Font /Subtype /TrueType /BaseFont /%s /FirstChar 32 /LastChar 255 /Widths [%s] /Encoding /WinAnsiEncoding /FontDescriptor %d 0 R >>",
+		f.name, strings.Join(widths, " "), descriptorNumber))
+}
+
+func (d *PDFDocument) xmpMetadata() string {
+	date := d.DateCreated.Format("2006-01-02T15:04:05-07:00")
+	var pdfaIdentification string
+	if d.isFontEmbedded() {
+		pdfaIdentification = `<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/"><pdfaid:part>3</pdfaid:part><pdfaid:conformance>B</pdfaid:conformance></rdf:Description>
+`
+	}
+	return `<?xpacket begin="` + "\xef\xbb\xbf" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+` + pdfaIdentification + `<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + escapeFacturaeText(d.Title) + `</rdf:li></rdf:Alt></dc:title></rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/"><pdf:Producer>MARKETNET</pdf:Producer></rdf:Description>
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/"><xmp:CreatorTool>MARKETNET</xmp:CreatorTool><xmp:CreateDate>` + date + `</xmp:CreateDate><xmp:ModifyDate>` + date + `</xmp:ModifyDate></rdf:Description>
+` + d.XMPExtension + `</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+}
+
+// Returns the date in the PDF format: (D:YYYYMMDDHHmmSSOHH'mm')
+func pdfDate(t time.Time) string {
+	zone := t.Format("-0700")
+	return "(D:" + t.Format("20060102150405") + zone[:3] + "'" + zone[3:] + "')"
+}
+
+// Returns the text string in UTF-16BE with the byte order mark, so the characters that are not in PDFDocEncoding are kept.
+func pdfTextString(text string) string {
+	var s strings.Builder
+	s.WriteString("<FEFF")
+	for _, c := range utf16.Encode([]rune(text)) {
+		s.WriteString(fmt.Sprintf("%04X", c))
+	}
+	s.WriteString(">")
+	return s.String()
+}
+
+// Converts the text to the WinAnsiEncoding used by the font. The characters that don't exist in the encoding are replaced by a question mark.
+func pdfWinAnsiText(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, c := range text {
+		if (c >= 32 && c < 127) || (c >= 160 && c <= 255) {
+			encoded = append(encoded, byte(c))
+			continue
+		}
+		found := false
+		for i := 0; i < len(pdfWinAnsiSpecialCharacters); i++ {
+			if pdfWinAnsiSpecialCharacters[i] == c && c != 0 {
+				encoded = append(encoded, byte(128+i))
+				found = true
+				break
+			}
+		}
+		if !found {
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+func pdfEscapeString(text []byte) string {
+	var s strings.Builder
+	for _, c := range text {
+		if c == '(' || c == ')' || c == '\\' {
+			s.WriteByte('\\')
+		}
+		s.WriteByte(c)
+	}
+	return s.String()
+}
+
+func pdfHelveticaFont() PDFFont {
+	f := PDFFont{name: "Helvetica"}
+	for i := 0; i < len(f.widths); i++ {
+		if i < len(pdfHelveticaWidths) {
+			f.widths[i] = pdfHelveticaWidths[i]
+		} else {
+			f.widths[i] = 556
+		}
+	}
+	return f
+}
+
+// Reads the TrueType font file to embed it in the documents, with the metrics of the characters of the WinAnsiEncoding.
+func loadPDFTrueTypeFont(path string) (PDFFont, error) {
+	f := PDFFont{}
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	if len(file) < 12 {
+		return f, errors.New("the font file is not a TrueType font")
+	}
+
+	// table directory
+	tables := make(map[string][]byte)
+	numTables := int(binary.BigEndian.Uint16(file[4:6]))
+	for i := 0; i < numTables; i++ {
+		entry := 12 + i*16
+		if entry+16 > len(file) {
+			return f, errors.New("the font file is not a TrueType font")
+		}
+		offset := int(binary.BigEndian.Uint32(file[entry+8 : entry+12]))
+		length := int(binary.BigEndian.Uint32(file[entry+12 : entry+16]))
+		if offset+length > len(file) {
+			return f, errors.New("the font file is not a TrueType font")
+		}
+		tables[string(file[entry:entry+4])] = file[offset : offset+length]
+	}
+	head, hhea, hmtx, cmap := tables["head"], tables["hhea"], tables["hmtx"], tables["cmap"]
+	if len(head) < 54 || len(hhea) < 36 || len(cmap) < 4 || tables["glyf"] == nil {
+		return f, errors.New("the font file is not a TrueType font with glyph outlines")
+	}
+
+	unitsPerEm := int(binary.BigEndian.Uint16(head[18:20]))
+	if unitsPerEm == 0 {
+		return f, errors.New("the font file is not a TrueType font")
+	}
+	scale := func(value int16) int {
+		return int(value) * 1000 / unitsPerEm
+	}
+	f.bbox = [4]int{scale(int16(binary.BigEndian.Uint16(head[36:38]))), scale(int16(binary.BigEndian.Uint16(head[38:40]))), scale(int16(binary.BigEndian.Uint16(head[40:42]))), scale(int16(binary.BigEndian.Uint16(head[42:44])))}
+	f.ascent = scale(int16(binary.BigEndian.Uint16(hhea[4:6])))
+	f.descent = scale(int16(binary.BigEndian.Uint16(hhea[6:8])))
+	f.capHeight = f.ascent
+	if os2 := tables["OS/2"]; len(os2) >= 90 && binary.BigEndian.Uint16(os2[0:2]) >= 2 {
+		f.capHeight = scale(int16(binary.BigEndian.Uint16(os2[88:90])))
+	}
+	if post := tables["post"]; len(post) >= 8 {
+		f.italicAngle = float64(int32(binary.BigEndian.Uint32(post[4:8]))) / 65536
+	}
+
+	// the glyphs are found in the unicode (3, 1) subtable in format 4
+	var subtable []byte
+	numSubtables := int(binary.BigEndian.Uint16(cmap[2:4]))
+	for i := 0; i < numSubtables && 4+i*8+8 <= len(cmap); i++ {
+		record := cmap[4+i*8:]
+		offset := int(binary.BigEndian.Uint32(record[4:8]))
+		if binary.BigEndian.Uint16(record[0:2]) == 3 && binary.BigEndian.Uint16(record[2:4]) == 1 && offset+14 <= len(cmap) && binary.BigEndian.Uint16(cmap[offset:offset+2]) == 4 {
+			subtable = cmap[offset:]
+			break
+		}
+	}
+	if subtable == nil {
+		return f, errors.New("the font has no unicode character map")
+	}
+
+	numberOfHMetrics := int(binary.BigEndian.Uint16(hhea[34:36]))
+	if numberOfHMetrics == 0 || len(hmtx) < numberOfHMetrics*4 {
+		return f, errors.New("the font has no horizontal metrics")
+	}
+	for i := 0; i < len(f.widths); i++ {
+		c := rune(32 + i)
+		if c >= 128 && c < 160 {
+			c = pdfWinAnsiSpecialCharacters[c-128]
+		}
+		glyph := trueTypeGlyphIndex(subtable, c)
+		if glyph >= numberOfHMetrics {
+			glyph = numberOfHMetrics - 1
+		}
+		f.widths[i] = int(binary.BigEndian.Uint16(hmtx[glyph*4:glyph*4+2])) * 1000 / unitsPerEm
+	}
+
+	// the name of the font can't have spaces or delimiters
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	f.name = strings.Map(func(c rune) rune {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' {
+			return c
+		}
+		return -1
+	}, name)
+	if len(f.name) == 0 {
+		f.name = "Font"
+	}
+	f.file = file
+	return f, nil
+}
+
+// Returns the glyph of the character in a format 4 character map subtable, or the glyph 0 (.notdef) if it's not found.
+func trueTypeGlyphIndex(subtable []byte, c rune) int {
+	if c <= 0 || c > 0xFFFF || len(subtable) < 14 {
+		return 0
+	}
+	segCount := int(binary.BigEndian.Uint16(subtable[6:8])) / 2
+	endCodes := 14
+	startCodes := endCodes + segCount*2 + 2
+	idDeltas := startCodes + segCount*2
+	idRangeOffsets := idDeltas + segCount*2
+	if idRangeOffsets+segCount*2 > len(subtable) {
+		return 0
+	}
+	for i := 0; i < segCount; i++ {
+		if int(c) > int(binary.BigEndian.Uint16(subtable[endCodes+i*2:])) {
+			continue
+		}
+		start := int(binary.BigEndian.Uint16(subtable[startCodes+i*2:]))
+		if int(c) < start {
+			return 0
+		}
+		delta := int(binary.BigEndian.Uint16(subtable[idDeltas+i*2:]))
+		rangeOffset := int(binary.BigEndian.Uint16(subtable[idRangeOffsets+i*2:]))
+		if rangeOffset == 0 {
+			return (int(c) + delta) & 0xFFFF
+		}
+		glyphOffset := idRangeOffsets + i*2 + rangeOffset + (int(c)-start)*2
+		if glyphOffset+2 > len(subtable) {
+			return 0
+		}
+		glyph := int(binary.BigEndian.Uint16(subtable[glyphOffset:]))
+		if glyph == 0 {
+			return 0
+		}
+		return (glyph + delta) & 0xFFFF
+	}
+	return 0
+}
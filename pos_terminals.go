@@ -158,10 +158,17 @@ func (t *POSTerminal) updatePOSTerminal() bool {
 	return true
 }
 
-func posInsertNewSaleOrder(terminal string, enterpriseId int32, userId int32) SaleOrder {
+// The new sale order of the point of sale, and the error code returned by insertSalesOrder if the customer's risk rejected the order or put it on hold.
+type POSNewSaleOrder struct {
+	SaleOrder
+	ErrorCode uint8    `json:"errorCode"`
+	ExtraData []string `json:"extraData"`
+}
+
+func posInsertNewSaleOrder(terminal string, enterpriseId int32, userId int32) POSNewSaleOrder {
 	posTerminal := getPOSTerminalByUUID(terminal, enterpriseId)
 	if !posTerminal.isReady() {
-		return SaleOrder{}
+		return POSNewSaleOrder{}
 	}
 
 	o := SaleOrder{
@@ -173,9 +180,9 @@ func posInsertNewSaleOrder(terminal string, enterpriseId int32, userId int32) Sa
 		ShippingAddressId: *posTerminal.OrdersDeliveryAddressId,
 		EnterpriseId:      enterpriseId,
 	}
-	_, orderId := o.insertSalesOrder(userId)
+	okAndErr, orderId := o.insertSalesOrder(userId, nil)
 	o.Id = orderId
-	return o
+	return POSNewSaleOrder{SaleOrder: o, ErrorCode: okAndErr.ErrorCode, ExtraData: okAndErr.ExtraData}
 }
 
 func deletePOSTerminal(terminal string, enterpriseId int32) bool {
@@ -190,10 +197,10 @@ func deletePOSTerminal(terminal string, enterpriseId int32) bool {
 }
 
 type InsertNewSaleOrderDetail struct {
-	Terminal string `json:"terminal"`
-	Order    int64  `json:"order"`
-	BarCode  string `json:"barCode"`
-	Quantity int32  `json:"quantity"`
+	Terminal string  `json:"terminal"`
+	Order    int64   `json:"order"`
+	BarCode  string  `json:"barCode"`
+	Quantity float64 `json:"quantity"`
 }
 
 func (i *InsertNewSaleOrderDetail) posInsertNewSaleOrderDetail(enterpriseId int32, userId int32) bool {
@@ -212,19 +219,29 @@ func (i *InsertNewSaleOrderDetail) posInsertNewSaleOrderDetail(enterpriseId int3
 	for i := 0; i < len(details); i++ {
 		if details[i].ProductId == product.Id {
 			details[i].Quantity++
+			// the new quantity can reach a quantity break in the price list of the customer
+			if price, ok := getProductPriceForSaleOrder(product.Id, details[i].OrderId, details[i].Quantity, enterpriseId); ok {
+				details[i].Price = price
+			}
 			return details[i].updateSalesOrderDetail(userId).Ok
 		}
 	}
 
+	// use the price list of the customer, if there is any
+	price, ok := getProductPriceForSaleOrder(product.Id, i.Order, i.Quantity, enterpriseId)
+	if !ok {
+		price = product.Price
+	}
+
 	d := SalesOrderDetail{
 		OrderId:      i.Order,
 		ProductId:    product.Id,
 		Quantity:     i.Quantity,
-		Price:        product.Price,
+		Price:        price,
 		VatPercent:   product.VatPercent,
 		EnterpriseId: enterpriseId,
 	}
-	return d.insertSalesOrderDetail(userId).Ok
+	return d.insertSalesOrderDetail(userId, nil).Ok
 }
 
 type POSServeSaleOrder struct {
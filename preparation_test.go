@@ -47,7 +47,7 @@ func TestPackaging(t *testing.T) {
 		CarrierId:         &carrierId,
 		EnterpriseId:      1,
 	}
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 	d := SalesOrderDetail{
 		OrderId:      orderId,
 		ProductId:    4,
@@ -56,7 +56,7 @@ func TestPackaging(t *testing.T) {
 		VatPercent:   21,
 		EnterpriseId: 1,
 	}
-	d.insertSalesOrderDetail(1)
+	d.insertSalesOrderDetail(1, nil)
 	d = SalesOrderDetail{
 		OrderId:      orderId,
 		ProductId:    1,
@@ -65,7 +65,7 @@ func TestPackaging(t *testing.T) {
 		VatPercent:   21,
 		EnterpriseId: 1,
 	}
-	d.insertSalesOrderDetail(1)
+	d.insertSalesOrderDetail(1, nil)
 	details := getSalesOrderDetail(orderId, 1)
 
 	// create a package
@@ -313,7 +313,7 @@ func TestPackagingWithPallets(t *testing.T) {
 		CarrierId:         &carrierId,
 		EnterpriseId:      1,
 	}
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 	d := SalesOrderDetail{
 		OrderId:      orderId,
 		ProductId:    4,
@@ -322,7 +322,7 @@ func TestPackagingWithPallets(t *testing.T) {
 		VatPercent:   21,
 		EnterpriseId: 1,
 	}
-	d.insertSalesOrderDetail(1)
+	d.insertSalesOrderDetail(1, nil)
 	d = SalesOrderDetail{
 		OrderId:      orderId,
 		ProductId:    1,
@@ -331,7 +331,7 @@ func TestPackagingWithPallets(t *testing.T) {
 		VatPercent:   21,
 		EnterpriseId: 1,
 	}
-	d.insertSalesOrderDetail(1)
+	d.insertSalesOrderDetail(1, nil)
 	details := getSalesOrderDetail(orderId, 1)
 
 	// create a pallet
@@ -590,7 +590,7 @@ func TestPackWithjEAN13(t *testing.T) {
 		Notes:             "",
 		EnterpriseId:      1,
 	}
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 	d := SalesOrderDetail{
 		OrderId:      orderId,
 		ProductId:    1,
@@ -599,7 +599,7 @@ func TestPackWithjEAN13(t *testing.T) {
 		VatPercent:   21,
 		EnterpriseId: 1,
 	}
-	d.insertSalesOrderDetail(1)
+	d.insertSalesOrderDetail(1, nil)
 	details := getSalesOrderDetail(orderId, 1)
 
 	// create a package
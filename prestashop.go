@@ -1852,8 +1852,8 @@ func copyPsOrders(enterpriseId int32) bool {
 		}
 
 		s.EnterpriseId = enterpriseId
-		if ok, _ := s.insertSalesOrder(0); !ok {
-			errors = append(errors, "Can't import order. Error creating the order in MARKETNET. Order reference "+reference+" order id "+strconv.Itoa(int(orderId)))
+		if okAndErr, _ := s.insertSalesOrder(0, nil); !okAndErr.Ok {
+			errors = append(errors, "Can't import order. Error creating the order in MARKETNET. Order reference "+reference+" order id "+strconv.Itoa(int(orderId))+getCustomerRiskErrorMessage(okAndErr))
 		}
 
 		// set the customer details if are empty
@@ -1943,8 +1943,12 @@ func copyPsOrderDetails(enterpriseId int32) bool {
 		d := SalesOrderDetail{}
 		d.OrderId = order
 		d.ProductId = product
-		d.Quantity = ProductQuantity
+		d.Quantity = float64(ProductQuantity)
 		d.Price = productPrice
+		// apply the price list of the customer, if there is any
+		if price, ok := getProductPriceForSaleOrder(product, order, d.Quantity, enterpriseId); ok {
+			d.Price = price
+		}
 
 		if !taxIncluded {
 			d.VatPercent = 0
@@ -1954,7 +1958,7 @@ func copyPsOrderDetails(enterpriseId int32) bool {
 
 		d.EnterpriseId = enterpriseId
 		d.PrestaShopId = detailId
-		ok := d.insertSalesOrderDetail(0).Ok
+		ok := d.insertSalesOrderDetail(0, nil).Ok
 
 		if ok {
 			found := false
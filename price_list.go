@@ -0,0 +1,305 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A price list can be assigned to a customer, or to a customer group.
+// The products in the list can have a fixed price or a discount over the base price of the product, and multiple quantity breaks.
+// The products that are not in the list get the general discount of the price list, if any.
+type PriceList struct {
+	Id              int32      `json:"id" gorm:"index:price_list_id_enterprise,unique:true,priority:1"`
+	Name            string     `json:"name" gorm:"type:character varying(100);not null:true"`
+	CurrencyId      int32      `json:"currencyId" gorm:"column:currency;type:integer;not null:true"`
+	Currency        Currency   `json:"currency" gorm:"foreignKey:CurrencyId,EnterpriseId;references:Id,EnterpriseId"`
+	DiscountPercent float64    `json:"discountPercent" gorm:"type:numeric(14,6);not null:true"`
+	DateStart       *time.Time `json:"dateStart" gorm:"type:timestamp(3) with time zone"`
+	DateEnd         *time.Time `json:"dateEnd" gorm:"type:timestamp(3) with time zone"`
+	Off             bool       `json:"off" gorm:"not null:true"`
+	EnterpriseId    int32      `json:"-" gorm:"column:enterprise;not null:true;index:price_list_id_enterprise,unique:true,priority:2"`
+	Enterprise      Settings   `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (p *PriceList) TableName() string {
+	return "price_list"
+}
+
+func getPriceLists(enterpriseId int32) []PriceList {
+	var lists []PriceList = make([]PriceList, 0)
+	result := dbOrm.Model(&PriceList{}).Where("enterprise = ?", enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&lists)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return lists
+}
+
+func getPriceListRow(priceListId int32) PriceList {
+	p := PriceList{}
+	result := dbOrm.Model(&PriceList{}).Where("id = ?", priceListId).First(&p)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return p
+}
+
+func (p *PriceList) isValid() bool {
+	return !(len(p.Name) == 0 || len(p.Name) > 100 || p.CurrencyId <= 0 || p.DiscountPercent < 0 || p.DiscountPercent > 100 || (p.DateStart != nil && p.DateEnd != nil && p.DateEnd.Before(*p.DateStart)))
+}
+
+func (p *PriceList) BeforeCreate(tx *gorm.DB) (err error) {
+	var priceList PriceList
+	tx.Model(&PriceList{}).Last(&priceList)
+	p.Id = priceList.Id + 1
+	return nil
+}
+
+func (p *PriceList) insertPriceList() bool {
+	if !p.isValid() {
+		return false
+	}
+
+	result := dbOrm.Create(&p)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (p *PriceList) updatePriceList() bool {
+	if p.Id <= 0 || !p.isValid() {
+		return false
+	}
+
+	var priceList PriceList
+	result := dbOrm.Where("id = ? AND enterprise = ?", p.Id, p.EnterpriseId).First(&priceList)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	priceList.Name = p.Name
+	priceList.CurrencyId = p.CurrencyId
+	priceList.DiscountPercent = p.DiscountPercent
+	priceList.DateStart = p.DateStart
+	priceList.DateEnd = p.DateEnd
+	priceList.Off = p.Off
+
+	result = dbOrm.Save(&priceList)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (p *PriceList) deletePriceList() bool {
+	if p.Id <= 0 {
+		return false
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return false
+	}
+	///
+
+	result := trans.Where("price_list = ? AND enterprise = ?", p.Id, p.EnterpriseId).Delete(&PriceListProduct{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("id = ? AND enterprise = ?", p.Id, p.EnterpriseId).Delete(&PriceList{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	///
+	result = trans.Commit()
+	return result.Error == nil
+	///
+}
+
+// Returns true if the price list is active and valid at the given date.
+func (p *PriceList) isActive(date time.Time) bool {
+	return !(p.Id <= 0 || p.Off || (p.DateStart != nil && date.Before(*p.DateStart)) || (p.DateEnd != nil && date.After(*p.DateEnd)))
+}
+
+// A product rule in a price list. There can be more than one rule for the same product with different minimum quantities to make quantity breaks.
+// If the price is 0, the discount percent is applied over the base price of the product.
+type PriceListProduct struct {
+	Id              int64     `json:"id" gorm:"index:price_list_product_id_enterprise,unique:true,priority:1"`
+	PriceListId     int32     `json:"priceListId" gorm:"column:price_list;not null:true;index:price_list_product_price_list_product,unique:true,priority:1"`
+	PriceList       PriceList `json:"-" gorm:"foreignKey:PriceListId,EnterpriseId;references:Id,EnterpriseId"`
+	ProductId       int32     `json:"productId" gorm:"column:product;not null:true;index:price_list_product_price_list_product,unique:true,priority:2"`
+	Product         Product   `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	MinimumQuantity float64   `json:"minimumQuantity" gorm:"type:numeric(14,6);not null:true;index:price_list_product_price_list_product,unique:true,priority:3"`
+	Price           float64   `json:"price" gorm:"type:numeric(14,6);not null:true"`
+	DiscountPercent float64   `json:"discountPercent" gorm:"type:numeric(14,6);not null:true"`
+	EnterpriseId    int32     `json:"-" gorm:"column:enterprise;not null:true;index:price_list_product_id_enterprise,unique:true,priority:2"`
+	Enterprise      Settings  `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (p *PriceListProduct) TableName() string {
+	return "price_list_product"
+}
+
+func getPriceListProducts(priceListId int32, enterpriseId int32) []PriceListProduct {
+	var products []PriceListProduct = make([]PriceListProduct, 0)
+	result := dbOrm.Model(&PriceListProduct{}).Where("price_list = ? AND enterprise = ?", priceListId, enterpriseId).Order("product ASC, minimum_quantity ASC").Preload(clause.Associations).Find(&products)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return products
+}
+
+func (p *PriceListProduct) isValid() bool {
+	return !(p.PriceListId <= 0 || p.ProductId <= 0 || p.MinimumQuantity <= 0 || p.Price < 0 || p.DiscountPercent < 0 || p.DiscountPercent > 100 || (p.Price == 0 && p.DiscountPercent == 0))
+}
+
+func (p *PriceListProduct) BeforeCreate(tx *gorm.DB) (err error) {
+	var priceListProduct PriceListProduct
+	tx.Model(&PriceListProduct{}).Last(&priceListProduct)
+	p.Id = priceListProduct.Id + 1
+	return nil
+}
+
+func (p *PriceListProduct) insertPriceListProduct() bool {
+	if !p.isValid() {
+		return false
+	}
+
+	result := dbOrm.Create(&p)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (p *PriceListProduct) updatePriceListProduct() bool {
+	if p.Id <= 0 || !p.isValid() {
+		return false
+	}
+
+	var priceListProduct PriceListProduct
+	result := dbOrm.Where("id = ? AND enterprise = ?", p.Id, p.EnterpriseId).First(&priceListProduct)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	priceListProduct.MinimumQuantity = p.MinimumQuantity
+	priceListProduct.Price = p.Price
+	priceListProduct.DiscountPercent = p.DiscountPercent
+
+	result = dbOrm.Save(&priceListProduct)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (p *PriceListProduct) deletePriceListProduct() bool {
+	if p.Id <= 0 {
+		return false
+	}
+
+	result := dbOrm.Where("id = ? AND enterprise = ?", p.Id, p.EnterpriseId).Delete(&PriceListProduct{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+// Returns the price list that applies to the customer: the price list of the customer, or if it has none, the price list of its customer group.
+// Returns nil if there is no price list for the customer.
+func getCustomerPriceList(customerId int32, enterpriseId int32) *PriceList {
+	customer := getCustomerRow(customerId)
+	if customer.Id <= 0 || customer.EnterpriseId != enterpriseId {
+		return nil
+	}
+
+	var priceListId *int32 = customer.PriceListId
+	if priceListId == nil && customer.CustomerGroupId != nil {
+		group := getCustomerGroupRow(*customer.CustomerGroupId)
+		priceListId = group.PriceListId
+	}
+	if priceListId == nil {
+		return nil
+	}
+
+	priceList := getPriceListRow(*priceListId)
+	if priceList.Id <= 0 || priceList.EnterpriseId != enterpriseId {
+		return nil
+	}
+	return &priceList
+}
+
+// Resolves the effective price of a product for a customer, in the given currency and for the given quantity.
+// The base price of the product is returned, and false, if there is not an active price list for the customer in that currency.
+func getProductPriceForCustomer(productId int32, customerId int32, currencyId int32, quantity float64, enterpriseId int32) (float64, bool) {
+	product := getProductRow(productId)
+	if product.Id <= 0 || product.EnterpriseId != enterpriseId {
+		return 0, false
+	}
+
+	priceList := getCustomerPriceList(customerId, enterpriseId)
+	if priceList == nil || !priceList.isActive(time.Now()) || (currencyId > 0 && priceList.CurrencyId != currencyId) {
+		return product.Price, false
+	}
+
+	// get the rule with the biggest quantity break that applies to this quantity
+	var rule PriceListProduct
+	result := dbOrm.Model(&PriceListProduct{}).Where("price_list = ? AND product = ? AND minimum_quantity <= ? AND enterprise = ?", priceList.Id, productId, quantity, enterpriseId).Order("minimum_quantity DESC").Limit(1).Find(&rule)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return product.Price, false
+	}
+
+	if rule.Id > 0 {
+		if rule.Price > 0 {
+			return rule.Price, true
+		}
+		return product.Price * (1 - (rule.DiscountPercent / 100)), true
+	}
+
+	if priceList.DiscountPercent > 0 {
+		return product.Price * (1 - (priceList.DiscountPercent / 100)), true
+	}
+	return product.Price, false
+}
+
+// Returns the effective price of a product for the customer and currency of a sale order.
+func getProductPriceForSaleOrder(productId int32, orderId int64, quantity float64, enterpriseId int32) (float64, bool) {
+	order := getSalesOrderRow(orderId)
+	if order.Id <= 0 || order.EnterpriseId != enterpriseId {
+		return 0, false
+	}
+	return getProductPriceForCustomer(productId, order.CustomerId, order.CurrencyId, quantity, enterpriseId)
+}
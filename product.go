@@ -34,7 +34,7 @@ type Product struct {
 	Height                   float64                 `json:"height" gorm:"type:numeric(14,6);not null:true"`
 	Depth                    float64                 `json:"depth" gorm:"type:numeric(14,6);not null:true"`
 	Off                      bool                    `json:"off" gorm:"not null:true"`
-	Stock                    int32                   `json:"stock" gorm:"not null:true"`
+	Stock                    float64                 `json:"stock" gorm:"type:numeric(14,6);not null:true"`
 	VatPercent               float64                 `json:"vatPercent" gorm:"type:numeric(14,6);not null:true"`
 	DateCreated              time.Time               `json:"dateCreated" gorm:"type:timestamp(3) with time zone;not null:true"`
 	Description              string                  `json:"description" gorm:"type:text;column:dsc"`
@@ -48,7 +48,7 @@ type Product struct {
 	Supplier                 *Supplier               `json:"supplier" gorm:"foreignKey:SupplierId,EnterpriseId;references:Id,EnterpriseId"`
 	PrestaShopId             int32                   `json:"-" gorm:"column:ps_id;not null:true;index:product_ps_id,unique:true,priority:2,where:ps_id <> 0"`
 	PrestaShopCombinationId  int32                   `json:"-" gorm:"column:ps_combination_id;not null:true;index:product_ps_id,unique:true,priority:3,where:ps_id <> 0"`
-	MinimumStock             int32                   `json:"minimumStock" gorm:"not null:true"`
+	MinimumStock             float64                 `json:"minimumStock" gorm:"type:numeric(14,6);not null:true"`
 	TrackMinimumStock        bool                    `json:"trackMinimumStock" gorm:"not null:true;index:product_track_minimum_stock,where:track_minimum_stock = true"`
 	WooCommerceId            int32                   `json:"-" gorm:"column:wc_id;not null:true;index:products_wc_id,unique:true,priority:2,where:wc_id <> 0"`
 	WooCommerceVariationId   int32                   `json:"-" gorm:"column:wc_variation_id;not null:true;index:products_wc_id,unique:true,priority:3,where:wc_id <> 0"`
@@ -58,11 +58,17 @@ type Product struct {
 	Enterprise               Settings                `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 	DigitalProduct           bool                    `json:"digitalProduct" gorm:"not null:true"`
 	PurchasePrice            float64                 `json:"purchasePrice" gorm:"type:numeric(14,6);not null:true"`
-	MinimumPurchaseQuantity  int32                   `json:"minimumPurchaseQuantity" gorm:"not null:true"`
+	MinimumPurchaseQuantity  float64                 `json:"minimumPurchaseQuantity" gorm:"type:numeric(14,6);not null:true"`
 	OriginCountry            string                  `json:"originCountry" gorm:"type:character varying(2);not null:true"`
 	HSCodeId                 *string                 `json:"HSCodeId" gorm:"column:hs_code;type:character varying(8)"`
 	HSCode                   *HSCode                 `json:"HSCode" gorm:"foreignKey:HSCodeId;references:Id"`
 	CostPrice                float64                 `json:"costPrice" gorm:"type:numeric(14,6);not null:true"`
+	DropShipping             bool                    `json:"dropShipping" gorm:"not null:true;default:false"` // The supplier ships the product directly to the customer
+	TrackLots                bool                    `json:"trackLots" gorm:"not null:true;default:false"`    // The warehouse movements of the product have lot number and expiry date
+	TrackSerials             bool                    `json:"trackSerials" gorm:"not null:true;default:false"` // Each unit of the product has a serial number
+	UnitOfMeasureId          *int32                  `json:"unitOfMeasureId" gorm:"column:unit_of_measure"`   // Unit in which the stock is counted, if it's not set the stock is counted in units
+	UnitOfMeasure            *UnitOfMeasure          `json:"unitOfMeasure" gorm:"foreignKey:UnitOfMeasureId,EnterpriseId;references:Id,EnterpriseId"`
+	QuantityDecimals         int16                   `json:"quantityDecimals" gorm:"not null:true;default:0"` // Decimal places allowed in the quantities of the product, 0 if it's sold by units
 }
 
 func (p *Product) TableName() string {
@@ -122,6 +128,16 @@ func getProductRow(productId int32) Product {
 	return p
 }
 
+// Rounds a quantity of a product to the decimal places set in the product.
+func roundProductQuantity(productId int32, quantity float64) float64 {
+	var decimals int16
+	result := dbOrm.Model(&Product{}).Where("id = ?", productId).Pluck("quantity_decimals", &decimals)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return roundQuantityDecimals(quantity, decimals)
+}
+
 func getProductByBarcode(ean13 string, enterpriseId int32) Product {
 	p := Product{}
 	dbOrm.Model(&Product{}).Where("enterprise = ? AND barcode = ?", enterpriseId, ean13).First(&p)
@@ -129,7 +145,7 @@ func getProductByBarcode(ean13 string, enterpriseId int32) Product {
 }
 
 func (p *Product) isValid() bool {
-	return !(len(p.Name) == 0 || len(p.Name) > 150 || len(p.Reference) > 40 || (len(p.BarCode) != 0 && len(p.BarCode) != 13) || p.VatPercent < 0 || p.Price < 0 || p.Weight < 0 || p.Width < 0 || p.Height < 0 || p.Depth < 0 || p.MinimumPurchaseQuantity < 0 || p.CostPrice < 0 || len(p.Description) > 3000)
+	return !(len(p.Name) == 0 || len(p.Name) > 150 || len(p.Reference) > 40 || (len(p.BarCode) != 0 && len(p.BarCode) != 13) || p.VatPercent < 0 || p.Price < 0 || p.Weight < 0 || p.Width < 0 || p.Height < 0 || p.Depth < 0 || p.MinimumPurchaseQuantity < 0 || p.CostPrice < 0 || len(p.Description) > 3000 || p.QuantityDecimals < 0 || p.QuantityDecimals > QUANTITY_MAX_DECIMALS || (p.TrackSerials && p.QuantityDecimals > 0))
 }
 
 func (p *Product) BeforeCreate(tx *gorm.DB) (err error) {
@@ -229,6 +245,11 @@ func (p *Product) updateProduct(userId int32) OkAndErrorCodeReturn {
 	product.OriginCountry = p.OriginCountry
 	product.HSCodeId = p.HSCodeId
 	product.CostPrice = p.CostPrice
+	product.DropShipping = p.DropShipping
+	product.TrackLots = p.TrackLots
+	product.TrackSerials = p.TrackSerials
+	product.UnitOfMeasureId = p.UnitOfMeasureId
+	product.QuantityDecimals = p.QuantityDecimals
 
 	result = dbOrm.Save(&product)
 	if result.Error != nil {
@@ -372,6 +393,20 @@ func (p *Product) deleteProduct(userId int32) OkAndErrorCodeReturn {
 		return OkAndErrorCodeReturn{Ok: false}
 	}
 
+	result = trans.Where("product = ? AND enterprise = ?", p.Id, p.EnterpriseId).Delete(&ProductSupplier{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	result = trans.Where("product = ? AND enterprise = ?", p.Id, p.EnterpriseId).Delete(&ProductUnitOfMeasure{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
 	insertTransactionalLog(p.EnterpriseId, "product", int(p.Id), userId, "D")
 	json, _ := json.Marshal(p)
 	go fireWebHook(p.EnterpriseId, "product", "DELETE", string(json))
@@ -403,14 +438,32 @@ type OrderDetailDefaults struct {
 	Price                   float64 `json:"price" gorm:"type:numeric(14,6);not null:true"`
 	PurchasePrice           float64 `json:"purchasePrice" gorm:"type:numeric(14,6);not null:true"`
 	VatPercent              float64 `json:"vatPercent" gorm:"type:numeric(14,6);not null:true"`
-	MinimumPurchaseQuantity int32   `json:"minimumPurchaseQuantity" gorm:"not null:true"`
+	MinimumPurchaseQuantity float64 `json:"minimumPurchaseQuantity" gorm:"type:numeric(14,6);not null:true"`
 }
 
-func getOrderDetailDefaults(productId int32, enterpriseId int32) OrderDetailDefaults {
+type OrderDetailDefaultsQuery struct {
+	ProductId int32   `json:"productId"`
+	OrderId   int64   `json:"orderId"`
+	Quantity  float64 `json:"quantity"`
+}
+
+// If a sale order is specified, the price is resolved through the price list of the customer of the order for the given quantity.
+func getOrderDetailDefaults(productId int32, orderId int64, quantity float64, enterpriseId int32) OrderDetailDefaults {
 	s := OrderDetailDefaults{}
 	result := dbOrm.Model(&Product{}).Where("id = ? AND enterprise = ?", productId, enterpriseId).First(&s)
 	if result.Error != nil {
 		log("DB", result.Error.Error())
+		return s
+	}
+
+	if orderId > 0 {
+		if quantity <= 0 {
+			quantity = 1
+		}
+		price, ok := getProductPriceForSaleOrder(productId, orderId, quantity, enterpriseId)
+		if ok {
+			s.Price = price
+		}
 	}
 	return s
 }
@@ -742,14 +795,14 @@ func calculateMinimumStock(enterpriseId int32, userId int32) bool {
 	for i := 0; i < len(products); i++ {
 		product := products[i]
 
-		var quantitySold int32
+		var quantitySold float64
 		result := dbOrm.Model(&Product{}).Joins("INNER JOIN sales_order ON sales_order.id=sales_order_detail.order").Where("sales_order_detail.product = ? AND sales_order.date_created >= ?", product.Id, t).Select("SUM(sales_order_detail.quantity) AS quantity").Pluck("quantity", &quantitySold)
 		if result.Error != nil {
 			log("DB", result.Error.Error())
 			return false
 		}
 
-		product.MinimumStock = quantitySold / int32(s.MinimumStockSalesPeriods)
+		product.MinimumStock = roundQuantityDecimals(quantitySold/float64(s.MinimumStockSalesPeriods), product.QuantityDecimals)
 
 		result = dbOrm.Save(&product)
 		if result.Error != nil {
@@ -769,17 +822,23 @@ func calculateMinimumStock(enterpriseId int32, userId int32) bool {
 }
 
 type GenerateManufacturingOrPurchaseOrdersMinimumStock struct {
-	Warehouse string `json:"warehouse"`
+	Warehouse         string `json:"warehouse"`
+	SupplierSelection string `json:"supplierSelection"` // P = Preferred supplier, C = Cheapest supplier. Empty = the supplier selection in the settings
 }
 
 func (g *GenerateManufacturingOrPurchaseOrdersMinimumStock) generateManufacturingOrPurchaseOrdersMinimumStock(userId int32, enterpriseId int32) bool {
-	if len(g.Warehouse) == 0 {
+	if len(g.Warehouse) == 0 || len(g.SupplierSelection) == 0 {
 		s := getSettingsRecordById(enterpriseId)
-		g.Warehouse = s.DefaultWarehouseId
+		if len(g.Warehouse) == 0 {
+			g.Warehouse = s.DefaultWarehouseId
+		}
+		if len(g.SupplierSelection) == 0 {
+			g.SupplierSelection = s.PurchaseSupplierSelection
+		}
 	}
 	var generadedPurchaseOrders map[int32]PurchaseOrder = make(map[int32]PurchaseOrder) // Key: supplier ID, Value: generated purchase order
 
-	rows, err := dbOrm.Model(&Product{}).Joins("INNER JOIN stock ON stock.product=product.id").Where("product.track_minimum_stock = true AND stock.quantity_available < (product.minimum_stock * 2) AND product.enterprise = ? AND product.off = false", enterpriseId).Select("product.id, stock.quantity_available ,product.minimum_stock ,product.manufacturing ,product.manufacturing_order_type ,product.supplier").Rows()
+	rows, err := dbOrm.Model(&Product{}).Joins("INNER JOIN stock ON stock.product=product.id").Where("product.track_minimum_stock = true AND stock.quantity_available < (product.minimum_stock * 2) AND product.enterprise = ? AND product.off = false", enterpriseId).Select("product.id, stock.quantity_available ,product.minimum_stock ,product.manufacturing ,product.manufacturing_order_type").Rows()
 	if err != nil {
 		log("DB", err.Error())
 		return false
@@ -796,12 +855,11 @@ func (g *GenerateManufacturingOrPurchaseOrdersMinimumStock) generateManufacturin
 	// iterate over the list of product that don't have covered the minimum stock
 	for rows.Next() {
 		var productId int32
-		var quantityAvailable int32
-		var minimumStock int32
+		var quantityAvailable float64
+		var minimumStock float64
 		var manufacturing bool
 		var manufacturingOrderType *int32
-		var supplier *int32
-		rows.Scan(&productId, &quantityAvailable, &minimumStock, &manufacturing, &manufacturingOrderType, &supplier)
+		rows.Scan(&productId, &quantityAvailable, &minimumStock, &manufacturing, &manufacturingOrderType)
 
 		if manufacturing { // if the product is from manufacture, generate the manufacturing orders
 			// generate manufacturing order or purchase orders until the available quantity is equal to the minimum stock * 2
@@ -818,6 +876,12 @@ func (g *GenerateManufacturingOrPurchaseOrdersMinimumStock) generateManufacturin
 				}
 			}
 		} else { // if the product is not from manufacture, generate the purchase order to the supplier
+			product := getProductRow(productId)
+			supplier, productSupplier := selectProductSupplier(product, g.SupplierSelection, nil, enterpriseId)
+			if supplier == nil {
+				continue
+			}
+
 			o, ok := generadedPurchaseOrders[*supplier]
 			if !ok { // there is no purchase order generated for this supplier, create it and add to the map
 				d := getSupplierDefaults(*supplier, enterpriseId)
@@ -840,40 +904,27 @@ func (g *GenerateManufacturingOrPurchaseOrdersMinimumStock) generateManufacturin
 				}
 				p.Id = purchaseOrderId
 				generadedPurchaseOrders[*supplier] = p
+				o = p
+			}
 
-				// generate the needs as a detail
-				product := getProductRow(productId)
-				det := PurchaseOrderDetail{
-					OrderId:      p.Id,
-					ProductId:    productId,
-					Quantity:     (minimumStock * 2) - quantityAvailable,
-					Price:        product.Price,
-					VatPercent:   product.VatPercent,
-					EnterpriseId: enterpriseId,
-					WarehouseId:  g.Warehouse,
-				}
-				okAndErr, _ := det.insertPurchaseOrderDetail(userId, trans)
-				if !okAndErr.Ok {
-					trans.Rollback()
-					return false
-				}
-			} else { // it already exists a purchase order for this supplier, add the needs as details
-				// generate the needs as a detail
-				product := getProductRow(productId)
-				det := PurchaseOrderDetail{
-					OrderId:      o.Id,
-					ProductId:    productId,
-					Quantity:     (minimumStock * 2) - quantityAvailable,
-					Price:        product.Price,
-					VatPercent:   product.VatPercent,
-					EnterpriseId: enterpriseId,
-					WarehouseId:  g.Warehouse,
-				}
-				okAndErr, _ := det.insertPurchaseOrderDetail(userId, trans)
-				if !okAndErr.Ok {
-					trans.Rollback()
-					return false
-				}
+			// generate the needs as a detail
+			det := PurchaseOrderDetail{
+				OrderId:      o.Id,
+				ProductId:    productId,
+				Quantity:     roundQuantity((minimumStock * 2) - quantityAvailable),
+				Price:        product.Price,
+				VatPercent:   product.VatPercent,
+				EnterpriseId: enterpriseId,
+				WarehouseId:  g.Warehouse,
+			}
+			if productSupplier != nil {
+				det.Quantity = productSupplier.adjustQuantity(det.Quantity)
+				det.Price = productSupplier.getPriceInCurrency(&o.CurrencyId)
+			}
+			okAndErr, _ := det.insertPurchaseOrderDetail(userId, trans)
+			if !okAndErr.Ok {
+				trans.Rollback()
+				return false
 			}
 		}
 	}
@@ -944,7 +995,7 @@ type ProductGenerate struct {
 	Depth           float64 `json:"depth"`
 	Price           float64 `json:"price"`
 	Manufacturing   bool    `json:"manufacturing"`
-	InitialStock    int32   `json:"initialStock"`
+	InitialStock    float64 `json:"initialStock"`
 }
 
 func (g *ProductGenerator) productGenerator(enterpriseId int32, userId int32) bool {
@@ -21,7 +21,7 @@ type ProductIncludedProduct struct {
 	ProductBase       Product  `json:"productBase" gorm:"foreignKey:ProductBaseId,EnterpriseId;references:Id,EnterpriseId"`
 	ProductIncludedId int32    `json:"productIncludedId" gorm:"column:product_included;type:integer;not null:true;index:product_included_products_product_base_product_included,unique:true,priority:2"`
 	ProductIncluded   Product  `json:"productIncluded" gorm:"foreignKey:ProductIncludedId,EnterpriseId;references:Id,EnterpriseId"`
-	Quantity          int32    `json:"quantity" gorm:"column:quantity;type:integer;not null:true"`
+	Quantity          float64  `json:"quantity" gorm:"column:quantity;type:numeric(14,6);not null:true"`
 	EnterpriseId      int32    `json:"-" gorm:"column:enterprise;not null:true;index:product_included_products_id_enterprise,unique:true,priority:2"`
 	Enterprise        Settings `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 }
@@ -106,7 +106,7 @@ type ProductIncludedProductSalesOrderDetail struct {
 	SalesOrderDetail          SalesOrderDetail       `json:"-" gorm:"foreignKey:SalesOrderDetailId,EnterpriseId;references:Id,EnterpriseId"`
 	SalesOrderId              int64                  `json:"-" gorm:"column:sales_order;type:bigint;not null:true;index:product_included_products_sales_order_details_product_ipso,unique:true,priority:2"`
 	SalesOrder                SaleOrder              `json:"-" gorm:"foreignKey:SalesOrderId,EnterpriseId;references:Id,EnterpriseId"`
-	QuantityUnit              int32                  `json:"quantityUnit" gorm:"column:quantity_unit;type:integer;not null:true"`
+	QuantityUnit              float64                `json:"quantityUnit" gorm:"column:quantity_unit;type:numeric(14,6);not null:true"`
 	EnterpriseId              int32                  `json:"-" gorm:"column:enterprise;not null:true"`
 	Enterprise                Settings               `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 }
@@ -159,12 +159,12 @@ func (s *SalesOrderDetail) processProductIncludedProductOnNewInsertedLine(enterp
 				EnterpriseId:     enterpriseId,
 				IncludedProducts: true,
 			}
-			newDetail.insertSalesOrderDetail(userId)
+			newDetail.insertSalesOrderDetail(userId, nil)
 			productIncludedSalesOrderDetailId = newDetail.Id
 		} else {
 			// The included product is already in the sales order, update the quantity of the detail
 			oldDetail := getSalesOrderDetailRow(productIncludedProductSalesOrderDetail.Id)
-			oldDetail.Quantity += productIncluded.Quantity * s.Quantity
+			oldDetail.Quantity = roundQuantity(oldDetail.Quantity + productIncluded.Quantity*s.Quantity)
 			oldDetail.updateSalesOrderDetail(userId)
 			productIncludedSalesOrderDetailId = oldDetail.Id
 		}
@@ -181,7 +181,7 @@ func (s *SalesOrderDetail) processProductIncludedProductOnNewInsertedLine(enterp
 }
 
 // An existing line is updated, check if the product of the line has included products. If it has, handle the included products on the order lines.
-func (s *SalesOrderDetail) processProductIncludedProductOnUpdatedLine(enterpriseId int32, userId int32, oldQuantity int32) {
+func (s *SalesOrderDetail) processProductIncludedProductOnUpdatedLine(enterpriseId int32, userId int32, oldQuantity float64) {
 	productIncludedProduct := getProductIncludedProduct(s.ProductId, enterpriseId)
 	if len(productIncludedProduct) == 0 { // The product does not have included products, skip this process
 		return
@@ -196,8 +196,7 @@ func (s *SalesOrderDetail) processProductIncludedProductOnUpdatedLine(enterprise
 		oldDetail := getSalesOrderDetailRow(productIncludedProductSalesOrderDetail.SalesOrderDetailId)
 		// To change the quantity, the quantity in the included product will not be used,
 		// insted it is going to use the quantity that was prevously saved in the Product Included - Sales Order Detail to keep track of the included products
-		oldDetail.Quantity -= productIncludedProductSalesOrderDetail.QuantityUnit * oldQuantity
-		oldDetail.Quantity += productIncludedProductSalesOrderDetail.QuantityUnit * s.Quantity
+		oldDetail.Quantity = roundQuantity(oldDetail.Quantity - productIncludedProductSalesOrderDetail.QuantityUnit*oldQuantity + productIncludedProductSalesOrderDetail.QuantityUnit*s.Quantity)
 		oldDetail.updateSalesOrderDetail(userId)
 	}
 }
@@ -217,7 +216,7 @@ func (s *SalesOrderDetail) processProductIncludedProductOnDeletedLine(enterprise
 		oldDetail := getSalesOrderDetailRow(productIncludedProductSalesOrderDetail.SalesOrderDetailId)
 		// To change the quantity, the quantity in the included product will not be used,
 		// insted it is going to use the quantity that was prevously saved in the Product Included - Sales Order Detail to keep track of the included products
-		oldDetail.Quantity -= productIncludedProductSalesOrderDetail.QuantityUnit * s.Quantity
+		oldDetail.Quantity = roundQuantity(oldDetail.Quantity - productIncludedProductSalesOrderDetail.QuantityUnit*s.Quantity)
 		if oldDetail.Quantity <= 0 {
 			// The quantity is 0 or less, delete the detail for the included product, as it's no longer needed
 			productIncludedProductSalesOrderDetail.deleteProductIncludedProductSalesOrderDetail()
@@ -0,0 +1,296 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"math"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// How the supplier of a product is chosen when the purchase orders are generated automatically
+const (
+	PURCHASE_SUPPLIER_SELECTION_PREFERRED = "P" // The preferred supplier of the product, or the cheapest one if there is no preferred supplier
+	PURCHASE_SUPPLIER_SELECTION_CHEAPEST  = "C" // The supplier with the lowest purchase price, the one with the shortest lead time if the price is the same
+)
+
+// A supplier that sells a product, with its own conditions.
+// The products that don't have any supplier in this table are purchased from the supplier of the product.
+type ProductSupplier struct {
+	Id                int32     `json:"id" gorm:"index:product_supplier_id_enterprise,unique:true,priority:1"`
+	ProductId         int32     `json:"productId" gorm:"column:product;not null:true;index:product_supplier_product_supplier,unique:true,priority:2"`
+	Product           Product   `json:"-" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	SupplierId        int32     `json:"supplierId" gorm:"column:supplier;not null:true;index:product_supplier_product_supplier,unique:true,priority:3;index:product_supplier_supplier_reference,priority:2"`
+	Supplier          Supplier  `json:"supplier" gorm:"foreignKey:SupplierId,EnterpriseId;references:Id,EnterpriseId"`
+	SupplierReference string    `json:"supplierReference" gorm:"type:character varying(40);not null:true;index:product_supplier_supplier_reference,priority:3"`
+	PurchasePrice     float64   `json:"purchasePrice" gorm:"type:numeric(14,6);not null:true"`
+	CurrencyId        *int32    `json:"currencyId" gorm:"column:currency"` // Currency of the purchase price, if it's not set the price is in the currency of the purchase order
+	Currency          *Currency `json:"currency" gorm:"foreignKey:CurrencyId,EnterpriseId;references:Id,EnterpriseId"`
+	MinimumQuantity   float64   `json:"minimumQuantity" gorm:"type:numeric(14,6);not null:true"`
+	PackMultiple      int32     `json:"packMultiple" gorm:"not null:true"` // The quantity is rounded up to a multiple of this value, 0 or 1 = any quantity
+	LeadTimeDays      int16     `json:"leadTimeDays" gorm:"not null:true"`
+	Preferred         bool      `json:"preferred" gorm:"not null:true"`
+	EnterpriseId      int32     `json:"-" gorm:"column:enterprise;not null:true;index:product_supplier_id_enterprise,unique:true,priority:2;index:product_supplier_product_supplier,unique:true,priority:1;index:product_supplier_supplier_reference,priority:1"`
+	Enterprise        Settings  `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (ps *ProductSupplier) TableName() string {
+	return "product_supplier"
+}
+
+func getProductSuppliers(productId int32, enterpriseId int32) []ProductSupplier {
+	var suppliers []ProductSupplier = make([]ProductSupplier, 0)
+	result := dbOrm.Model(&ProductSupplier{}).Where("product = ? AND enterprise = ?", productId, enterpriseId).Order("preferred DESC, purchase_price ASC, id ASC").Preload(clause.Associations).Find(&suppliers)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return suppliers
+}
+
+// Returns the conditions of the supplier for the product, and false if the supplier is not in the table for this product.
+func getProductSupplierRow(productId int32, supplierId int32, enterpriseId int32) (ProductSupplier, bool) {
+	var productSupplier ProductSupplier
+	result := dbOrm.Model(&ProductSupplier{}).Where("product = ? AND supplier = ? AND enterprise = ?", productId, supplierId, enterpriseId).Limit(1).Find(&productSupplier)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return ProductSupplier{}, false
+	}
+	return productSupplier, result.RowsAffected > 0
+}
+
+func (ps *ProductSupplier) isValid() bool {
+	return !(ps.ProductId <= 0 || ps.SupplierId <= 0 || len(ps.SupplierReference) > 40 || ps.PurchasePrice < 0 || (ps.CurrencyId != nil && *ps.CurrencyId <= 0) || ps.MinimumQuantity < 0 || ps.PackMultiple < 0 || ps.LeadTimeDays < 0)
+}
+
+func (ps *ProductSupplier) BeforeCreate(tx *gorm.DB) (err error) {
+	var productSupplier ProductSupplier
+	tx.Model(&ProductSupplier{}).Last(&productSupplier)
+	ps.Id = productSupplier.Id + 1
+	return nil
+}
+
+func (ps *ProductSupplier) insertProductSupplier() bool {
+	if !ps.isValid() {
+		return false
+	}
+
+	///
+	trans := dbOrm.Begin()
+	///
+
+	// there is only one preferred supplier for each product
+	if ps.Preferred {
+		result := trans.Model(&ProductSupplier{}).Where("product = ? AND enterprise = ?", ps.ProductId, ps.EnterpriseId).Update("preferred", false)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+	}
+
+	result := trans.Create(&ps)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	///
+	result = trans.Commit()
+	return result.Error == nil
+	///
+}
+
+func (ps *ProductSupplier) updateProductSupplier() bool {
+	if ps.Id <= 0 || !ps.isValid() {
+		return false
+	}
+
+	var productSupplier ProductSupplier
+	result := dbOrm.Where("id = ? AND enterprise = ?", ps.Id, ps.EnterpriseId).First(&productSupplier)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	///
+	trans := dbOrm.Begin()
+	///
+
+	if ps.Preferred && !productSupplier.Preferred {
+		result = trans.Model(&ProductSupplier{}).Where("product = ? AND enterprise = ?", productSupplier.ProductId, ps.EnterpriseId).Update("preferred", false)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+	}
+
+	productSupplier.SupplierId = ps.SupplierId
+	productSupplier.SupplierReference = ps.SupplierReference
+	productSupplier.PurchasePrice = ps.PurchasePrice
+	productSupplier.CurrencyId = ps.CurrencyId
+	productSupplier.MinimumQuantity = ps.MinimumQuantity
+	productSupplier.PackMultiple = ps.PackMultiple
+	productSupplier.LeadTimeDays = ps.LeadTimeDays
+	productSupplier.Preferred = ps.Preferred
+
+	result = trans.Save(&productSupplier)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	///
+	result = trans.Commit()
+	return result.Error == nil
+	///
+}
+
+func (ps *ProductSupplier) deleteProductSupplier() bool {
+	if ps.Id <= 0 {
+		return false
+	}
+
+	result := dbOrm.Where("id = ? AND enterprise = ?", ps.Id, ps.EnterpriseId).Delete(&ProductSupplier{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+// Raises the quantity to the minimum quantity of the supplier, and rounds it up to a multiple of the pack.
+func (ps *ProductSupplier) adjustQuantity(quantity float64) float64 {
+	if quantity < ps.MinimumQuantity {
+		quantity = ps.MinimumQuantity
+	}
+	if ps.PackMultiple > 1 {
+		quantity = math.Ceil(roundQuantity(quantity/float64(ps.PackMultiple))) * float64(ps.PackMultiple)
+	}
+	return quantity
+}
+
+// Returns the purchase price converted to the currency given, using the exchange rates of the currencies.
+// The price is not converted if the currency of the supplier or the currency given is not set.
+func (ps *ProductSupplier) getPriceInCurrency(currencyId *int32) float64 {
+	if ps.CurrencyId == nil || currencyId == nil || *ps.CurrencyId == *currencyId {
+		return ps.PurchasePrice
+	}
+	supplierExchange := getCurrencyExchange(*ps.CurrencyId)
+	exchange := getCurrencyExchange(*currencyId)
+	if supplierExchange <= 0 || exchange <= 0 {
+		return ps.PurchasePrice
+	}
+	return ps.PurchasePrice / supplierExchange * exchange
+}
+
+// Returns the supplier to purchase the product from, and the conditions of the supplier for the product if it's in the product-supplier table.
+// If the product has no suppliers in the table, the supplier of the product is returned.
+// If "supplierId" is set, the product is purchased from that supplier, overriding the selection.
+func selectProductSupplier(product Product, selection string, supplierId *int32, enterpriseId int32) (*int32, *ProductSupplier) {
+	if supplierId != nil && *supplierId > 0 {
+		productSupplier, ok := getProductSupplierRow(product.Id, *supplierId, enterpriseId)
+		if ok {
+			return supplierId, &productSupplier
+		}
+		return supplierId, nil
+	}
+
+	suppliers := getProductSuppliers(product.Id, enterpriseId)
+	if len(suppliers) == 0 {
+		return product.SupplierId, nil
+	}
+	index := chooseProductSupplier(suppliers, selection)
+	return &suppliers[index].SupplierId, &suppliers[index]
+}
+
+// Returns the index of the supplier to purchase from. The prices are compared in euros, using the exchange rates of the currencies.
+func chooseProductSupplier(suppliers []ProductSupplier, selection string) int {
+	if selection != PURCHASE_SUPPLIER_SELECTION_CHEAPEST {
+		for i := 0; i < len(suppliers); i++ {
+			if suppliers[i].Preferred {
+				return i
+			}
+		}
+	}
+
+	var index int
+	var lowestPrice float64
+	for i := 0; i < len(suppliers); i++ {
+		price := suppliers[i].PurchasePrice
+		if suppliers[i].Currency != nil && suppliers[i].Currency.Change > 0 {
+			price = price / suppliers[i].Currency.Change
+		}
+		if i == 0 || price < lowestPrice || (price == lowestPrice && suppliers[i].LeadTimeDays < suppliers[index].LeadTimeDays) {
+			index = i
+			lowestPrice = price
+		}
+	}
+	return index
+}
+
+type PurchaseOrderDetailDefaults struct {
+	Price             float64 `json:"price"`
+	VatPercent        float64 `json:"vatPercent"`
+	Quantity          float64 `json:"quantity"`
+	SupplierReference string  `json:"supplierReference"`
+	LeadTimeDays      int16   `json:"leadTimeDays"`
+}
+
+type PurchaseOrderDetailDefaultsQuery struct {
+	ProductId int32   `json:"productId"`
+	OrderId   int64   `json:"orderId"`
+	Quantity  float64 `json:"quantity"`
+}
+
+// The price, the quantity and the reference come from the conditions of the supplier of the purchase order for the product.
+// If the supplier is not in the product-supplier table, the purchase price of the product is used.
+func (q *PurchaseOrderDetailDefaultsQuery) getPurchaseOrderDetailDefaults(enterpriseId int32) PurchaseOrderDetailDefaults {
+	defaults := PurchaseOrderDetailDefaults{Quantity: q.Quantity}
+	if defaults.Quantity <= 0 {
+		defaults.Quantity = 1
+	}
+
+	product := getProductRow(q.ProductId)
+	if product.Id <= 0 || product.EnterpriseId != enterpriseId {
+		return defaults
+	}
+	defaults.Price = product.PurchasePrice
+	defaults.VatPercent = product.VatPercent
+
+	var supplierId *int32 = product.SupplierId
+	var currencyId *int32
+	if q.OrderId > 0 {
+		order := getPurchaseOrderRow(q.OrderId)
+		if order.Id <= 0 || order.EnterpriseId != enterpriseId {
+			return defaults
+		}
+		supplierId = &order.SupplierId
+		currencyId = &order.CurrencyId
+	}
+	if supplierId == nil {
+		return defaults
+	}
+
+	productSupplier, ok := getProductSupplierRow(product.Id, *supplierId, enterpriseId)
+	if !ok {
+		return defaults
+	}
+	defaults.Price = productSupplier.getPriceInCurrency(currencyId)
+	defaults.Quantity = productSupplier.adjustQuantity(defaults.Quantity)
+	defaults.SupplierReference = productSupplier.SupplierReference
+	defaults.LeadTimeDays = productSupplier.LeadTimeDays
+	return defaults
+}
@@ -231,6 +231,20 @@ func (n *PurchaseDeliveryNote) deletePurchaseDeliveryNotes(userId int32, trans *
 		return false
 	}
 
+	// the landed costs allocated to the delivery note have to be undone first
+	var allocatedLandedCosts int64
+	result := trans.Model(&LandedCostDeliveryNote{}).Joins("INNER JOIN landed_cost ON landed_cost.id = landed_cost_delivery_note.landed_cost AND landed_cost.enterprise = landed_cost_delivery_note.enterprise").Where("landed_cost_delivery_note.purchase_delivery_note = ? AND landed_cost_delivery_note.enterprise = ? AND landed_cost.allocated = ?", n.Id, n.EnterpriseId, true).Count(&allocatedLandedCosts)
+	if result.Error != nil || allocatedLandedCosts > 0 {
+		trans.Rollback()
+		return false
+	}
+	result = trans.Where("purchase_delivery_note = ? AND enterprise = ?", n.Id, n.EnterpriseId).Delete(&LandedCostDeliveryNote{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
 	d := getWarehouseMovementByPurchaseDeliveryNote(n.Id, n.EnterpriseId)
 	for i := 0; i < len(d); i++ {
 		ok := d[i].deleteWarehouseMovement(userId, trans)
@@ -244,7 +258,7 @@ func (n *PurchaseDeliveryNote) deletePurchaseDeliveryNotes(userId int32, trans *
 	json, _ := json.Marshal(n)
 	go fireWebHook(n.EnterpriseId, "purchase_delivery_note", "DELETE", string(json))
 
-	result := trans.Delete(&PurchaseDeliveryNote{}, "id = ? AND enterprise = ?", n.Id, n.EnterpriseId)
+	result = trans.Delete(&PurchaseDeliveryNote{}, "id = ? AND enterprise = ?", n.Id, n.EnterpriseId)
 	if result.Error != nil {
 		log("DB", result.Error.Error())
 		return false
@@ -359,7 +373,7 @@ func (noteInfo *OrderDetailGenerate) deliveryNotePartiallyPurchaseOrder(enterpri
 			product := getProductRow(orderDetail.ProductId)
 			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3, ExtraData: []string{product.Name}}
 		}
-		if (noteInfo.Selection[i].Quantity + orderDetail.QuantityDeliveryNote) > orderDetail.Quantity {
+		if roundQuantity(noteInfo.Selection[i].Quantity+orderDetail.QuantityDeliveryNote) > orderDetail.Quantity {
 			product := getProductRow(orderDetail.ProductId)
 			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4, ExtraData: []string{product.Name}}
 		}
@@ -394,6 +408,10 @@ func (noteInfo *OrderDetailGenerate) deliveryNotePartiallyPurchaseOrder(enterpri
 		movement.WarehouseId = orderDetail.WarehouseId
 		movement.ProductId = orderDetail.ProductId
 		movement.Quantity = noteInfo.Selection[i].Quantity
+		movement.LotNumber = noteInfo.Selection[i].LotNumber
+		movement.ExpiryDate = noteInfo.Selection[i].ExpiryDate
+		movement.SerialNumbers = noteInfo.Selection[i].SerialNumbers
+		movement.LocationId = noteInfo.Selection[i].LocationId
 		movement.PurchaseDeliveryNoteId = &deliveryNoteId
 		movement.PurchaseOrderDetailId = &orderDetail.Id
 		movement.PurchaseOrderId = &purchaseOrder.Id
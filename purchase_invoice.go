@@ -61,6 +61,11 @@ type PurchaseInvoice struct {
 	RentBase             float64             `json:"rentBase" gorm:"column:rent_base;not null:true;type:real"`
 	RentPercentage       float64             `json:"rentPercentage" gorm:"column:rent_percentage;not null:true;type:real"`
 	RentValue            float64             `json:"rentValue" gorm:"column:rent_value;not null:true;type:real"`
+	SupplierReference    string              `json:"supplierReference" gorm:"type:character varying(50);not null:true;default:''"` // Number of the invoice given by the supplier
+	MatchStatus          string              `json:"matchStatus" gorm:"type:character(1);not null:true;default:'_'"`               // "_" = Not matched, "M" = Matched, "B" = Blocked, "R" = Released
+	MatchReleasedById    *int32              `json:"matchReleasedById" gorm:"column:match_released_by"`
+	MatchReleasedBy      *User               `json:"matchReleasedBy" gorm:"foreignKey:MatchReleasedById,EnterpriseId;references:Id,EnterpriseId"`
+	MatchReleaseDate     *time.Time          `json:"matchReleaseDate" gorm:"type:timestamp(3) with time zone"`
 }
 
 func (pi *PurchaseInvoice) TableName() string {
@@ -215,7 +220,7 @@ func getPurchaseInvoiceRowTransaction(invoiceId int64, trans gorm.DB) PurchaseIn
 }
 
 func (i *PurchaseInvoice) isValid() bool {
-	return !(i.SupplierId <= 0 || i.PaymentMethodId <= 0 || len(i.BillingSeriesId) == 0 || i.CurrencyId <= 0 || i.BillingAddressId <= 0 || i.IncomeTaxBase < 0 || i.IncomeTaxPercentage < 0 || i.RentBase < 0 || i.RentPercentage < 0)
+	return !(i.SupplierId <= 0 || i.PaymentMethodId <= 0 || len(i.BillingSeriesId) == 0 || i.CurrencyId <= 0 || i.BillingAddressId <= 0 || i.IncomeTaxBase < 0 || i.IncomeTaxPercentage < 0 || i.RentBase < 0 || i.RentPercentage < 0 || len(i.SupplierReference) > 50)
 }
 
 func (i *PurchaseInvoice) BeforeCreate(tx *gorm.DB) (err error) {
@@ -465,6 +470,10 @@ func addTotalProductsPurchaseInvoice(invoiceId int64, totalAmount float64, vatPe
 
 	purchaseInvoice.TotalProducts += totalAmount
 	purchaseInvoice.VatAmount += (totalAmount / 100) * vatPercent
+	// the lines have changed, the invoice has to be matched again
+	purchaseInvoice.MatchStatus = "_"
+	purchaseInvoice.MatchReleasedById = nil
+	purchaseInvoice.MatchReleaseDate = nil
 
 	result = trans.Save(&purchaseInvoice)
 	if result.Error != nil {
@@ -661,7 +670,7 @@ func (invoiceInfo *OrderDetailGenerate) invoicePartiallyPurchaseOrder(enterprise
 			product := getProductRow(orderDetail.ProductId)
 			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3, ExtraData: []string{product.Name}}
 		}
-		if (invoiceInfo.Selection[i].Quantity + orderDetail.QuantityInvoiced) > orderDetail.Quantity {
+		if roundQuantity(invoiceInfo.Selection[i].Quantity+orderDetail.QuantityInvoiced) > orderDetail.Quantity {
 			product := getProductRow(orderDetail.ProductId)
 			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4, ExtraData: []string{product.Name}}
 		}
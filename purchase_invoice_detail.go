@@ -24,7 +24,7 @@ type PurchaseInvoiceDetail struct {
 	ProductId     *int32               `json:"productId" gorm:"column:product"`
 	Product       *Product             `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
 	Price         float64              `json:"price" gorm:"column:price;not null:true;type:numeric(14,6)"`
-	Quantity      int32                `json:"quantity" gorm:"column:quantity;not null:true"`
+	Quantity      float64              `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
 	VatPercent    float64              `json:"vatPercent" gorm:"column:vat_percent;not null:true;type:numeric(14,6)"`
 	TotalAmount   float64              `json:"totalAmount" gorm:"column:total_amount;not null:true;type:numeric(14,6)"`
 	OrderDetailId *int64               `json:"orderDetailId" gorm:"column:order_detail"`
@@ -88,7 +88,7 @@ func (s *PurchaseInvoiceDetail) insertPurchaseInvoiceDetail(userId int32, trans
 		}
 	}
 
-	s.TotalAmount = (s.Price * float64(s.Quantity)) * (1 + (s.VatPercent / 100))
+	s.TotalAmount = (s.Price * s.Quantity) * (1 + (s.VatPercent / 100))
 
 	var beginTransaction bool = (trans == nil)
 	if trans == nil {
@@ -136,7 +136,7 @@ func (s *PurchaseInvoiceDetail) insertPurchaseInvoiceDetail(userId int32, trans
 	json, _ := json.Marshal(s)
 	go fireWebHook(s.EnterpriseId, "purchase_invoice_details", "POST", string(json))
 
-	ok := addTotalProductsPurchaseInvoice(s.InvoiceId, s.Price*float64(s.Quantity), s.VatPercent, s.EnterpriseId, userId, *trans)
+	ok := addTotalProductsPurchaseInvoice(s.InvoiceId, s.Price*s.Quantity, s.VatPercent, s.EnterpriseId, userId, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
@@ -149,14 +149,14 @@ func (s *PurchaseInvoiceDetail) insertPurchaseInvoiceDetail(userId int32, trans
 		}
 	}
 	if s.IncomeTax {
-		ok = addIncomeTaxBasePurchaseInvoice(s.InvoiceId, s.Price*float64(s.Quantity), s.EnterpriseId, userId, *trans)
+		ok = addIncomeTaxBasePurchaseInvoice(s.InvoiceId, s.Price*s.Quantity, s.EnterpriseId, userId, *trans)
 		if !ok {
 			trans.Rollback()
 			return OkAndErrorCodeReturn{Ok: false}
 		}
 	}
 	if s.Rent {
-		ok = addRentBaseProductsPurchaseInvoice(s.InvoiceId, s.Price*float64(s.Quantity), s.EnterpriseId, userId, *trans)
+		ok = addRentBaseProductsPurchaseInvoice(s.InvoiceId, s.Price*s.Quantity, s.EnterpriseId, userId, *trans)
 		if !ok {
 			trans.Rollback()
 			return OkAndErrorCodeReturn{Ok: false}
@@ -229,7 +229,7 @@ func (d *PurchaseInvoiceDetail) deletePurchaseInvoiceDetail(userId int32, trans
 		return OkAndErrorCodeReturn{Ok: false}
 	}
 
-	ok := addTotalProductsPurchaseInvoice(detailInMemory.InvoiceId, -(detailInMemory.Price * float64(detailInMemory.Quantity)), detailInMemory.VatPercent, d.EnterpriseId, userId, *trans)
+	ok := addTotalProductsPurchaseInvoice(detailInMemory.InvoiceId, -(detailInMemory.Price * detailInMemory.Quantity), detailInMemory.VatPercent, d.EnterpriseId, userId, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
@@ -242,14 +242,14 @@ func (d *PurchaseInvoiceDetail) deletePurchaseInvoiceDetail(userId int32, trans
 		}
 	}
 	if detailInMemory.IncomeTax {
-		ok = addIncomeTaxBasePurchaseInvoice(detailInMemory.InvoiceId, -(detailInMemory.Price * float64(detailInMemory.Quantity)), d.EnterpriseId, userId, *trans)
+		ok = addIncomeTaxBasePurchaseInvoice(detailInMemory.InvoiceId, -(detailInMemory.Price * detailInMemory.Quantity), d.EnterpriseId, userId, *trans)
 		if !ok {
 			trans.Rollback()
 			return OkAndErrorCodeReturn{Ok: false}
 		}
 	}
 	if detailInMemory.Rent {
-		ok = addRentBaseProductsPurchaseInvoice(detailInMemory.InvoiceId, -(detailInMemory.Price * float64(detailInMemory.Quantity)), d.EnterpriseId, userId, *trans)
+		ok = addRentBaseProductsPurchaseInvoice(detailInMemory.InvoiceId, -(detailInMemory.Price * detailInMemory.Quantity), d.EnterpriseId, userId, *trans)
 		if !ok {
 			trans.Rollback()
 			return OkAndErrorCodeReturn{Ok: false}
@@ -0,0 +1,172 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Result of comparing the lines of a purchase invoice against the purchase order lines and the quantities received in the delivery notes.
+type PurchaseInvoiceMatch struct {
+	InvoiceId int64                      `json:"invoiceId"`
+	Status    string                     `json:"status"` // "M" = Matched, "B" = Blocked
+	Lines     []PurchaseInvoiceMatchLine `json:"lines"`
+}
+
+type PurchaseInvoiceMatchLine struct {
+	DetailId         int64   `json:"detailId"`
+	ProductId        *int32  `json:"productId"`
+	Description      string  `json:"description"`
+	OrderDetailId    *int64  `json:"orderDetailId"`
+	Price            float64 `json:"price"`            // Price in the invoice
+	OrderPrice       float64 `json:"orderPrice"`       // Price in the purchase order
+	Quantity         float64 `json:"quantity"`         // Quantity in the invoice line
+	QuantityOrdered  float64 `json:"quantityOrdered"`  // Quantity in the purchase order
+	QuantityInvoiced float64 `json:"quantityInvoiced"` // Quantity invoiced in all the invoices of the purchase order line
+	QuantityReceived float64 `json:"quantityReceived"` // Quantity received in the delivery notes of the purchase order line
+	Matched          bool    `json:"matched"`          // The line is linked to a purchase order line
+	PriceOk          bool    `json:"priceOk"`
+	QuantityOk       bool    `json:"quantityOk"`
+}
+
+// Checks the line against the tolerances (percentages). The invoice can't charge a price greater than the ordered one, nor invoice more than what has been received.
+// The product lines that are not linked to a purchase order line block the invoice, nothing has been ordered nor received for them.
+// The lines without a product (services, shipping costs...) are not checked.
+func (l *PurchaseInvoiceMatchLine) check(priceTolerance float64, quantityTolerance float64) {
+	if !l.Matched {
+		l.PriceOk = l.ProductId == nil
+		l.QuantityOk = l.ProductId == nil
+		return
+	}
+	l.PriceOk = l.Price <= l.OrderPrice*(1+priceTolerance/100)+0.000001
+	l.QuantityOk = l.QuantityInvoiced <= l.QuantityReceived*(1+quantityTolerance/100)
+}
+
+// Compares the lines of the purchase invoice against the purchase order lines and the delivery notes using the tolerances in the settings.
+// This function does not save the result, see setPurchaseInvoiceMatchStatus.
+func matchPurchaseInvoice(invoiceId int64, enterpriseId int32) PurchaseInvoiceMatch {
+	match := PurchaseInvoiceMatch{InvoiceId: invoiceId, Status: "M", Lines: make([]PurchaseInvoiceMatchLine, 0)}
+	invoice := getPurchaseInvoiceRow(invoiceId)
+	if invoice.Id <= 0 || invoice.EnterpriseId != enterpriseId {
+		return match
+	}
+	// amending invoices return money to the enterprise, there is nothing to block
+	if invoice.Amending {
+		return match
+	}
+	settings := getSettingsRecordById(enterpriseId)
+
+	details := getPurchaseInvoiceDetail(invoiceId, enterpriseId)
+	for i := 0; i < len(details); i++ {
+		d := details[i]
+		line := PurchaseInvoiceMatchLine{
+			DetailId:      d.Id,
+			ProductId:     d.ProductId,
+			Description:   d.Description,
+			OrderDetailId: d.OrderDetailId,
+			Price:         d.Price,
+			Quantity:      d.Quantity,
+		}
+		if d.OrderDetail != nil {
+			line.Matched = true
+			line.OrderPrice = d.OrderDetail.Price
+			line.QuantityOrdered = d.OrderDetail.Quantity
+			line.QuantityInvoiced = d.OrderDetail.QuantityInvoiced
+			line.QuantityReceived = d.OrderDetail.QuantityDeliveryNote
+		}
+		line.check(settings.ThreeWayMatchPriceTolerance, settings.ThreeWayMatchQuantityTolerance)
+		if !line.PriceOk || !line.QuantityOk {
+			match.Status = "B"
+		}
+		match.Lines = append(match.Lines, line)
+	}
+	return match
+}
+
+// Saves the result of the match in the purchase invoice.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func (m *PurchaseInvoiceMatch) setPurchaseInvoiceMatchStatus(enterpriseId int32, trans gorm.DB) bool {
+	result := trans.Model(&PurchaseInvoice{}).Where("id = ? AND enterprise = ?", m.InvoiceId, enterpriseId).Updates(map[string]interface{}{
+		"match_status":       m.Status,
+		"match_released_by":  nil,
+		"match_release_date": nil,
+	})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
+// Runs the three-way match of the purchase invoice and saves the result.
+func checkPurchaseInvoiceMatch(invoiceId int64, enterpriseId int32) PurchaseInvoiceMatch {
+	match := matchPurchaseInvoice(invoiceId, enterpriseId)
+	invoice := getPurchaseInvoiceRow(invoiceId)
+	if invoice.Id <= 0 || invoice.EnterpriseId != enterpriseId {
+		return match
+	}
+	// don't undo the release of an administrator, or change posted invoices
+	if invoice.MatchStatus == "R" || invoice.AccountingMovementId != nil {
+		return match
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return match
+	}
+	///
+
+	if !match.setPurchaseInvoiceMatchStatus(enterpriseId, *trans) {
+		return match
+	}
+
+	///
+	result := trans.Commit()
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	///
+
+	return match
+}
+
+// Allows a purchase invoice blocked by the three-way match to be posted. Only administrators can release the invoices.
+func releasePurchaseInvoiceMatch(invoiceId int64, enterpriseId int32, userId int32) bool {
+	invoice := getPurchaseInvoiceRow(invoiceId)
+	if invoice.Id <= 0 || invoice.EnterpriseId != enterpriseId || invoice.MatchStatus != "B" {
+		return false
+	}
+
+	now := time.Now()
+	result := dbOrm.Model(&PurchaseInvoice{}).Where("id = ? AND enterprise = ?", invoiceId, enterpriseId).Updates(map[string]interface{}{
+		"match_status":       "R",
+		"match_released_by":  userId,
+		"match_release_date": now,
+	})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	invoice.MatchStatus = "R"
+	invoice.MatchReleasedById = &userId
+	invoice.MatchReleaseDate = &now
+
+	insertTransactionalLog(enterpriseId, "purchase_invoice", int(invoiceId), userId, "U")
+	json, _ := json.Marshal(invoice)
+	go fireWebHook(enterpriseId, "purchase_invoice", "PUT", string(json))
+
+	return true
+}
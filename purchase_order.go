@@ -55,6 +55,10 @@ type PurchaseOrder struct {
 	Cancelled         bool          `json:"cancelled" gorm:"column:cancelled;type:boolean;not null:true"`
 	OrderNumber       int32         `json:"orderNumber" gorm:"column:order_number;type:integer;not null:true;index:purchase_order_order_number,unique:true,priority:3"`
 	OrderName         string        `json:"orderName" gorm:"column:order_name;type:character(15);not null:true"`
+	DropShipping      bool          `json:"dropShipping" gorm:"column:drop_shipping;type:boolean;not null:true;default:false"` // The supplier ships the goods to the customer's shipping address
+	SalesOrderId      *int64        `json:"salesOrderId" gorm:"column:sales_order"`                                            // The sale order of the customer in the drop shipping purchase orders
+	SalesOrder        *SaleOrder    `json:"salesOrder" gorm:"foreignKey:SalesOrderId,EnterpriseId;references:Id,EnterpriseId"`
+	DatePromised      *time.Time    `json:"datePromised" gorm:"column:date_promised;type:timestamp(3) with time zone"` // The date the supplier promised to deliver the goods
 	EnterpriseId      int32         `json:"-" gorm:"column:enterprise;not null:true;index:purchase_order_id_enterprise,unique:true,priority:2;index:purchase_order_order_number,unique:true,priority:1"`
 	Enterprise        Settings      `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 }
@@ -292,6 +296,7 @@ func (p *PurchaseOrder) updatePurchaseOrder(userId int32) bool {
 		inMemoryOrder.Description = p.Description
 		inMemoryOrder.Notes = p.Notes
 		inMemoryOrder.SupplierReference = p.SupplierReference
+		inMemoryOrder.DatePromised = p.DatePromised
 
 		result := trans.Save(&inMemoryOrder)
 		if result.Error != nil {
@@ -314,6 +319,7 @@ func (p *PurchaseOrder) updatePurchaseOrder(userId int32) bool {
 		inMemoryOrder.Description = p.Description
 		inMemoryOrder.Notes = p.Notes
 		inMemoryOrder.SupplierReference = p.SupplierReference
+		inMemoryOrder.DatePromised = p.DatePromised
 
 		result := trans.Save(&inMemoryOrder)
 		if result.Error != nil {
@@ -19,23 +19,28 @@ import (
 )
 
 type PurchaseOrderDetail struct {
-	Id                   int64         `json:"id" gorm:"index:purchase_order_detail_id_enterprise,unique:true,priority:1"`
-	OrderId              int64         `json:"orderId" gorm:"column:order;not null:true;index:purchase_order_detail_purchase_order_product,unique:true,priority:1"`
-	Order                PurchaseOrder `json:"-" gorm:"foreignKey:OrderId,EnterpriseId;references:Id,EnterpriseId"`
-	WarehouseId          string        `json:"warehouseId" gorm:"column:warehouse;type:character(2)"`
-	Warehouse            Warehouse     `json:"warehouse" gorm:"foreignKey:WarehouseId,EnterpriseId;references:Id,EnterpriseId"`
-	ProductId            int32         `json:"productId" gorm:"column:product;not null:true;index:purchase_order_detail_purchase_order_product,unique:true,priority:2"`
-	Product              Product       `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
-	Price                float64       `json:"price" gorm:"column:price;not null:true;type:numeric(14,6)"`
-	Quantity             int32         `json:"quantity" gorm:"column:quantity;not null:true"`
-	VatPercent           float64       `json:"vatPercent" gorm:"column:vat_percent;not null:true;type:numeric(14,6)"`
-	TotalAmount          float64       `json:"totalAmount" gorm:"column:total_amount;not null:true;type:numeric(14,6)"`
-	QuantityInvoiced     int32         `json:"quantityInvoiced" gorm:"column:quantity_invoiced;not null:true"`
-	QuantityDeliveryNote int32         `json:"quantityDeliveryNote" gorm:"column:quantity_delivery_note;not null:true"`
-	QuantityAssignedSale int32         `json:"quantityAssignedSale" gorm:"column:quantity_assigned_sale;not null:true"`
-	EnterpriseId         int32         `json:"-" gorm:"column:enterprise;not null:true;index:purchase_order_detail_id_enterprise,unique:true,priority:2"`
-	Enterprise           Settings      `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
-	Cancelled            bool          `json:"cancelled" gorm:"column:cancelled;not null:true"`
+	Id                   int64          `json:"id" gorm:"index:purchase_order_detail_id_enterprise,unique:true,priority:1"`
+	OrderId              int64          `json:"orderId" gorm:"column:order;not null:true;index:purchase_order_detail_purchase_order_product,unique:true,priority:1"`
+	Order                PurchaseOrder  `json:"-" gorm:"foreignKey:OrderId,EnterpriseId;references:Id,EnterpriseId"`
+	WarehouseId          string         `json:"warehouseId" gorm:"column:warehouse;type:character(2)"`
+	Warehouse            Warehouse      `json:"warehouse" gorm:"foreignKey:WarehouseId,EnterpriseId;references:Id,EnterpriseId"`
+	ProductId            int32          `json:"productId" gorm:"column:product;not null:true;index:purchase_order_detail_purchase_order_product,unique:true,priority:2"`
+	Product              Product        `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	Price                float64        `json:"price" gorm:"column:price;not null:true;type:numeric(14,6)"`
+	Quantity             float64        `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
+	VatPercent           float64        `json:"vatPercent" gorm:"column:vat_percent;not null:true;type:numeric(14,6)"`
+	TotalAmount          float64        `json:"totalAmount" gorm:"column:total_amount;not null:true;type:numeric(14,6)"`
+	QuantityInvoiced     float64        `json:"quantityInvoiced" gorm:"type:numeric(14,6);column:quantity_invoiced;not null:true"`
+	QuantityDeliveryNote float64        `json:"quantityDeliveryNote" gorm:"type:numeric(14,6);column:quantity_delivery_note;not null:true"`
+	QuantityAssignedSale float64        `json:"quantityAssignedSale" gorm:"type:numeric(14,6);column:quantity_assigned_sale;not null:true"`
+	EnterpriseId         int32          `json:"-" gorm:"column:enterprise;not null:true;index:purchase_order_detail_id_enterprise,unique:true,priority:2"`
+	Enterprise           Settings       `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+	Cancelled            bool           `json:"cancelled" gorm:"column:cancelled;not null:true"`
+	DatePromised         *time.Time     `json:"datePromised" gorm:"column:date_promised;type:timestamp(3) with time zone"` // If it's not set, the promised date of the order applies
+	UnitOfMeasureId      *int32         `json:"unitOfMeasureId" gorm:"column:unit_of_measure"`                             // Unit in which the quantity has been entered, if it's not set the quantity is in units of stock
+	UnitOfMeasure        *UnitOfMeasure `json:"unitOfMeasure" gorm:"foreignKey:UnitOfMeasureId,EnterpriseId;references:Id,EnterpriseId"`
+	UnitQuantity         float64        `json:"unitQuantity" gorm:"type:numeric(14,6);column:unit_quantity;not null:true;default:0"` // Quantity in the unit of measure of the line
+	UnitFactor           int32          `json:"unitFactor" gorm:"column:unit_factor;not null:true;default:0"`                        // Units of stock in one unit of measure of the line, when the line was saved
 }
 
 func (pod *PurchaseOrderDetail) TableName() string {
@@ -76,6 +81,21 @@ func (d *PurchaseOrderDetail) isValid() bool {
 	return !(d.OrderId <= 0 || d.ProductId <= 0 || len(d.WarehouseId) == 0 || d.Quantity <= 0 || d.VatPercent < 0)
 }
 
+// Computes the quantity in units of stock when the quantity of the line has been entered in an alternative unit of measure.
+// The quantity is rounded to the decimal places of the product.
+func (d *PurchaseOrderDetail) setQuantityFromUnitOfMeasure() bool {
+	quantity, factor, ok := convertLineQuantity(d.ProductId, d.UnitOfMeasureId, d.UnitQuantity, d.Quantity, false, d.EnterpriseId)
+	if !ok {
+		return false
+	}
+	if d.UnitOfMeasureId == nil {
+		d.UnitQuantity = 0
+	}
+	d.Quantity = roundProductQuantity(d.ProductId, quantity)
+	d.UnitFactor = factor
+	return true
+}
+
 func (d *PurchaseOrderDetail) BeforeCreate(tx *gorm.DB) (err error) {
 	var purchaseOrderDetail PurchaseOrderDetail
 	tx.Model(&PurchaseOrderDetail{}).Last(&purchaseOrderDetail)
@@ -85,7 +105,11 @@ func (d *PurchaseOrderDetail) BeforeCreate(tx *gorm.DB) (err error) {
 
 // 1. the product is deactivated
 // 2. there is aleady a detail with this product
+// 3. the unit of measure can't be used to purchase the product
 func (s *PurchaseOrderDetail) insertPurchaseOrderDetail(userId int32, trans *gorm.DB) (OkAndErrorCodeReturn, int64) {
+	if !s.setQuantityFromUnitOfMeasure() {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}, 0
+	}
 	if !s.isValid() {
 		return OkAndErrorCodeReturn{Ok: false}, 0
 	}
@@ -97,10 +121,21 @@ func (s *PurchaseOrderDetail) insertPurchaseOrderDetail(userId int32, trans *gor
 	if product.Off {
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}, 0
 	}
+	// the order can be created in the same transaction, and it's not visible outside of the transaction yet
+	var order PurchaseOrder
+	var orderQuery *gorm.DB = dbOrm
+	if trans != nil {
+		orderQuery = trans
+	}
+	result := orderQuery.Model(&PurchaseOrder{}).Where("id = ? AND enterprise = ?", s.OrderId, s.EnterpriseId).First(&order)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return OkAndErrorCodeReturn{Ok: false}, 0
+	}
 
 	// the product and sale order are unique, there can't exist another detail for the same product in the same order
 	var countProductInSaleOrder int64
-	result := dbOrm.Model(&PurchaseOrderDetail{}).Where("\"order\" = ? AND product = ?", s.OrderId, s.ProductId).Count(&countProductInSaleOrder)
+	result = dbOrm.Model(&PurchaseOrderDetail{}).Where("\"order\" = ? AND product = ?", s.OrderId, s.ProductId).Count(&countProductInSaleOrder)
 	if result.Error != nil {
 		log("DB", result.Error.Error())
 		return OkAndErrorCodeReturn{Ok: false}, 0
@@ -109,7 +144,7 @@ func (s *PurchaseOrderDetail) insertPurchaseOrderDetail(userId int32, trans *gor
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}, 0
 	}
 
-	s.TotalAmount = (s.Price * float64(s.Quantity)) * (1 + (s.VatPercent / 100))
+	s.TotalAmount = (s.Price * s.Quantity) * (1 + (s.VatPercent / 100))
 
 	///
 	var beginTrans bool = (trans == nil)
@@ -137,7 +172,7 @@ func (s *PurchaseOrderDetail) insertPurchaseOrderDetail(userId int32, trans *gor
 	jsn, _ := json.Marshal(s)
 	go fireWebHook(s.EnterpriseId, "purchase_order_detail", "POST", string(jsn))
 
-	ok := addTotalProductsPurchaseOrder(s.OrderId, s.Price*float64(s.Quantity), s.VatPercent, s.EnterpriseId, userId, *trans)
+	ok := addTotalProductsPurchaseOrder(s.OrderId, s.Price*s.Quantity, s.VatPercent, s.EnterpriseId, userId, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}, 0
@@ -148,10 +183,14 @@ func (s *PurchaseOrderDetail) insertPurchaseOrderDetail(userId int32, trans *gor
 		return OkAndErrorCodeReturn{Ok: false}, 0
 	}
 
-	quantityAssignedSale := associatePurchaseOrderWithPendingSalesOrders(s.Id, s.ProductId, s.Quantity, s.EnterpriseId, userId, *trans)
-	if quantityAssignedSale < 0 {
-		trans.Rollback()
-		return OkAndErrorCodeReturn{Ok: false}, 0
+	// the drop shipping purchase orders are associated with the details of their sale order when they are generated
+	var quantityAssignedSale float64
+	if !order.DropShipping {
+		quantityAssignedSale = associatePurchaseOrderWithPendingSalesOrders(s.Id, s.ProductId, s.Quantity, s.EnterpriseId, userId, *trans)
+		if quantityAssignedSale < 0 {
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}, 0
+		}
 	}
 
 	result = trans.Model(&PurchaseOrderDetail{}).Where("id = ?", s.Id).Update("quantity_assigned_sale", quantityAssignedSale)
@@ -165,8 +204,8 @@ func (s *PurchaseOrderDetail) insertPurchaseOrderDetail(userId int32, trans *gor
 	jsn, _ = json.Marshal(s)
 	go fireWebHook(s.EnterpriseId, "purchase_order_detail", "POST", string(jsn))
 
-	// add quantity pending receiving
-	ok = addQuantityPendingReveiving(s.ProductId, s.WarehouseId, s.Quantity, s.EnterpriseId, *trans)
+	// add quantity pending receiving, the drop shipping purchase orders are not received in our warehouses
+	ok = order.DropShipping || addQuantityPendingReveiving(s.ProductId, s.WarehouseId, s.Quantity, s.EnterpriseId, *trans)
 	if !ok {
 		if beginTrans {
 			trans.Rollback()
@@ -200,15 +239,15 @@ func deassociatePurchaseOrderWithPendingSalesOrders(purchaseDetailId int64, ente
 
 type AssociatePurchaseOrderWithPendingSalesOrders struct {
 	SalesDetailId int64
-	SalesQuantity int32
+	SalesQuantity float64
 	OrderId       int64
 }
 
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION
-func associatePurchaseOrderWithPendingSalesOrders(purchaseDetailId int64, productId int32, quantity int32, enterpriseId int32, userId int32, trans gorm.DB) int32 {
+func associatePurchaseOrderWithPendingSalesOrders(purchaseDetailId int64, productId int32, quantity float64, enterpriseId int32, userId int32, trans gorm.DB) float64 {
 	// associate pending sales order detail until there are no more quantity pending to be assigned, or there are no more pending sales order details
 	var salesOrderDetails []SalesOrderDetail = make([]SalesOrderDetail, 0)
-	result := trans.Model(&SalesOrderDetail{}).Where("product = ? AND status = 'A'", productId).Order("(SELECT date_created FROM sales_order WHERE sales_order.id=sales_order_detail.\"order\") ASC").Find(&salesOrderDetails)
+	result := trans.Model(&SalesOrderDetail{}).Where("product = ? AND status = 'A' AND NOT drop_shipping", productId).Order("(SELECT date_created FROM sales_order WHERE sales_order.id=sales_order_detail.\"order\") ASC").Find(&salesOrderDetails)
 	if result.Error != nil {
 		log("DB", result.Error.Error())
 		trans.Rollback()
@@ -217,17 +256,17 @@ func associatePurchaseOrderWithPendingSalesOrders(purchaseDetailId int64, produc
 	var associations []AssociatePurchaseOrderWithPendingSalesOrders = make([]AssociatePurchaseOrderWithPendingSalesOrders, 0)
 
 	var i int
-	var quantityAssignedSale int32
+	var quantityAssignedSale float64
 	for quantityAssignedSale < quantity {
 		if i < len(salesOrderDetails) {
 			saleDetail := salesOrderDetails[i]
 			i++
 
-			if quantityAssignedSale+saleDetail.Quantity > quantity { // no more rows to proecss
+			if roundQuantity(quantityAssignedSale+saleDetail.Quantity) > quantity { // no more rows to proecss
 				break
 			}
 
-			quantityAssignedSale += saleDetail.Quantity
+			quantityAssignedSale = roundQuantity(quantityAssignedSale + saleDetail.Quantity)
 			associations = append(associations, AssociatePurchaseOrderWithPendingSalesOrders{
 				SalesDetailId: saleDetail.Id,
 				SalesQuantity: saleDetail.Quantity,
@@ -258,10 +297,15 @@ func associatePurchaseOrderWithPendingSalesOrders(purchaseDetailId int64, produc
 // ERROR CODES:
 // 1. the detail is already invoiced
 // 2. the detail has a delivery note generated
+// 3. the quantity can't be changed in a drop shipping purchase order
+// 4. the unit of measure can't be used to purchase the product
 func (s *PurchaseOrderDetail) updatePurchaseOrderDetail(userId int32) OkAndErrorCodeReturn {
 	if s.Id <= 0 {
 		return OkAndErrorCodeReturn{Ok: false}
 	}
+	if !s.setQuantityFromUnitOfMeasure() {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4}
+	}
 
 	///
 	trans := dbOrm.Begin()
@@ -283,6 +327,10 @@ func (s *PurchaseOrderDetail) updatePurchaseOrderDetail(userId int32) OkAndError
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
 	}
+	if detailInMemory.Order.DropShipping && detailInMemory.Quantity != s.Quantity {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
 
 	if detailInMemory.Quantity != s.Quantity {
 		if !deassociatePurchaseOrderWithPendingSalesOrders(s.Id, s.EnterpriseId, userId, *trans) {
@@ -297,15 +345,15 @@ func (s *PurchaseOrderDetail) updatePurchaseOrderDetail(userId int32) OkAndError
 		s.QuantityAssignedSale = detailInMemory.QuantityAssignedSale
 	}
 
-	s.TotalAmount = (s.Price * float64(s.Quantity)) * (1 + (s.VatPercent / 100))
+	s.TotalAmount = (s.Price * s.Quantity) * (1 + (s.VatPercent / 100))
 
-	ok := addTotalProductsPurchaseOrder(s.OrderId, -detailInMemory.Price*float64(detailInMemory.Quantity), detailInMemory.VatPercent, s.EnterpriseId, userId, *trans)
+	ok := addTotalProductsPurchaseOrder(s.OrderId, -detailInMemory.Price*detailInMemory.Quantity, detailInMemory.VatPercent, s.EnterpriseId, userId, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
 	}
 
-	ok = addTotalProductsPurchaseOrder(s.OrderId, s.Price*float64(s.Quantity), s.VatPercent, s.EnterpriseId, userId, *trans)
+	ok = addTotalProductsPurchaseOrder(s.OrderId, s.Price*s.Quantity, s.VatPercent, s.EnterpriseId, userId, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
@@ -316,6 +364,10 @@ func (s *PurchaseOrderDetail) updatePurchaseOrderDetail(userId int32) OkAndError
 	detailInMemory.VatPercent = s.VatPercent
 	detailInMemory.TotalAmount = s.TotalAmount
 	detailInMemory.QuantityAssignedSale = s.QuantityAssignedSale
+	detailInMemory.DatePromised = s.DatePromised
+	detailInMemory.UnitOfMeasureId = s.UnitOfMeasureId
+	detailInMemory.UnitQuantity = s.UnitQuantity
+	detailInMemory.UnitFactor = s.UnitFactor
 
 	result := trans.Model(&PurchaseOrderDetail{}).Where("id = ?", s.Id).Updates(map[string]interface{}{
 		"price":                  detailInMemory.Price,
@@ -323,6 +375,10 @@ func (s *PurchaseOrderDetail) updatePurchaseOrderDetail(userId int32) OkAndError
 		"vat_percent":            detailInMemory.VatPercent,
 		"total_amount":           detailInMemory.TotalAmount,
 		"quantity_assigned_sale": detailInMemory.QuantityAssignedSale,
+		"date_promised":          detailInMemory.DatePromised,
+		"unit_of_measure":        detailInMemory.UnitOfMeasureId,
+		"unit_quantity":          detailInMemory.UnitQuantity,
+		"unit_factor":            detailInMemory.UnitFactor,
 	})
 	if result.Error != nil {
 		log("DB", result.Error.Error())
@@ -405,7 +461,7 @@ func (s *PurchaseOrderDetail) deletePurchaseOrderDetail(userId int32, trans *gor
 		return OkAndErrorCodeReturn{Ok: false}
 	}
 
-	ok := addTotalProductsPurchaseOrder(detailInMemory.OrderId, -(detailInMemory.Price * float64(detailInMemory.Quantity)), detailInMemory.VatPercent, detailInMemory.EnterpriseId, userId, *trans)
+	ok := addTotalProductsPurchaseOrder(detailInMemory.OrderId, -(detailInMemory.Price * detailInMemory.Quantity), detailInMemory.VatPercent, detailInMemory.EnterpriseId, userId, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
@@ -417,7 +473,7 @@ func (s *PurchaseOrderDetail) deletePurchaseOrderDetail(userId int32, trans *gor
 	}
 
 	// substract quantity pending receiving
-	ok = addQuantityPendingReveiving(detailInMemory.ProductId, detailInMemory.WarehouseId, -detailInMemory.Quantity, s.EnterpriseId, *trans)
+	ok = detailInMemory.Order.DropShipping || addQuantityPendingReveiving(detailInMemory.ProductId, detailInMemory.WarehouseId, -detailInMemory.Quantity, s.EnterpriseId, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
@@ -434,7 +490,7 @@ func (s *PurchaseOrderDetail) deletePurchaseOrderDetail(userId int32, trans *gor
 // Adds quantity to the field to prevent from other sale orders to use the quantity that is already reserved for order that are already waiting a purchase order.
 // This function will substract if a negative quantity is given.
 // THIS FUNCION DOES NOT OPEN A TRANSACTION
-func addQuantityAssignedSalePurchaseOrder(detailId int64, quantity int32, enterpriseId int32, userId int32, trans gorm.DB) bool {
+func addQuantityAssignedSalePurchaseOrder(detailId int64, quantity float64, enterpriseId int32, userId int32, trans gorm.DB) bool {
 	var purchaseOrderDetail PurchaseOrderDetail
 	result := trans.Model(&PurchaseOrderDetail{}).Where("id = ?", detailId).First(&purchaseOrderDetail)
 	if result.Error != nil {
@@ -443,7 +499,7 @@ func addQuantityAssignedSalePurchaseOrder(detailId int64, quantity int32, enterp
 		return false
 	}
 
-	purchaseOrderDetail.QuantityAssignedSale += quantity
+	purchaseOrderDetail.QuantityAssignedSale = roundQuantity(purchaseOrderDetail.QuantityAssignedSale + quantity)
 
 	result = trans.Save(&purchaseOrderDetail)
 	if result.Error != nil {
@@ -461,7 +517,7 @@ func addQuantityAssignedSalePurchaseOrder(detailId int64, quantity int32, enterp
 
 // Adds an invoiced quantity to the purchase order detail. This function will subsctract from the quantity if the amount is negative.
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION.
-func addQuantityInvoicedPurchaseOrderDetail(detailId int64, quantity int32, enterpriseId int32, userId int32, trans gorm.DB) bool {
+func addQuantityInvoicedPurchaseOrderDetail(detailId int64, quantity float64, enterpriseId int32, userId int32, trans gorm.DB) bool {
 	detailBefore := getPurchaseOrderDetailRow(detailId)
 	if detailBefore.Id <= 0 {
 		return false
@@ -475,7 +531,7 @@ func addQuantityInvoicedPurchaseOrderDetail(detailId int64, quantity int32, ente
 		return false
 	}
 
-	detailAfter.QuantityInvoiced += quantity
+	detailAfter.QuantityInvoiced = roundQuantity(detailAfter.QuantityInvoiced + quantity)
 
 	result = trans.Save(&detailAfter)
 	if result.Error != nil {
@@ -504,7 +560,7 @@ func addQuantityInvoicedPurchaseOrderDetail(detailId int64, quantity int32, ente
 }
 
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION.
-func addQuantityDeliveryNotePurchaseOrderDetail(detailId int64, quantity int32, enterpriseId int32, userId int32, trans gorm.DB) bool {
+func addQuantityDeliveryNotePurchaseOrderDetail(detailId int64, quantity float64, enterpriseId int32, userId int32, trans gorm.DB) bool {
 	detailBefore := getPurchaseOrderDetailRow(detailId)
 	if detailBefore.Id <= 0 {
 		return false
@@ -518,7 +574,7 @@ func addQuantityDeliveryNotePurchaseOrderDetail(detailId int64, quantity int32,
 		return false
 	}
 
-	detailAfter.QuantityDeliveryNote += quantity
+	detailAfter.QuantityDeliveryNote = roundQuantity(detailAfter.QuantityDeliveryNote + quantity)
 
 	result = trans.Save(&detailAfter)
 	if result.Error != nil {
@@ -636,7 +692,7 @@ func setSalesOrderDetailStateAllPendingPurchaseOrder(detailId int64, enterpriseI
 	purchaseOrderDetail := getPurchaseOrderDetailRowTransaction(detailId, trans)
 
 	// Get the quantity that the orders are currently using
-	var quantityUsedDeliveryNote *int32
+	var quantityUsedDeliveryNote *float64
 	result := dbOrm.Model(&SalesOrderDetail{}).Where("purchase_order_detail = ? AND status != 'B'", detailId).Select("SUM(quantity) AS quantity").Scan(&quantityUsedDeliveryNote)
 	if result.Error != nil {
 		log("DB", result.Error.Error())
@@ -645,12 +701,12 @@ func setSalesOrderDetailStateAllPendingPurchaseOrder(detailId int64, enterpriseI
 	}
 
 	if quantityUsedDeliveryNote == nil {
-		zero := int32(0)
+		zero := float64(0)
 		quantityUsedDeliveryNote = &zero
 	}
 
 	// Get the quantity that the orders are not currently using + the added quantity
-	quantityAddedToDeliveryNote := purchaseOrderDetail.QuantityDeliveryNote - *quantityUsedDeliveryNote
+	quantityAddedToDeliveryNote := roundQuantity(purchaseOrderDetail.QuantityDeliveryNote - *quantityUsedDeliveryNote)
 	rows, err := dbOrm.Model(&SalesOrderDetail{}).Where("purchase_order_detail = ? AND status = 'B'", detailId).Select(`id,"order",quantity`).Order("quantity ASC").Rows()
 	if err != nil {
 		log("DB", err.Error())
@@ -659,19 +715,19 @@ func setSalesOrderDetailStateAllPendingPurchaseOrder(detailId int64, enterpriseI
 	}
 	defer rows.Close()
 
-	var quantityUsed int32
+	var quantityUsed float64
 
 	var salesOrderDetailId int64
 	var saleOrderId int64
-	var quantity int32
+	var quantity float64
 	for rows.Next() {
 		rows.Scan(&salesOrderDetailId, &saleOrderId, &quantity)
 
-		if quantityUsed+quantity > quantityAddedToDeliveryNote {
+		if roundQuantity(quantityUsed+quantity) > quantityAddedToDeliveryNote {
 			return true
 		}
 
-		quantityUsed += quantity
+		quantityUsed = roundQuantity(quantityUsed + quantity)
 
 		result := trans.Model(&SalesOrderDetail{}).Where("id = ?", salesOrderDetailId).Update("status", "E")
 		if result.Error != nil {
@@ -702,7 +758,7 @@ func setSalesOrderDetailStateAllPendingPurchaseOrder(detailId int64, enterpriseI
 func undoSalesOrderDetailStatueFromPendingPurchaseOrder(detailId int64, enterpriseId int32, userId int32, trans gorm.DB) bool {
 	purchaseOrderDetail := getPurchaseOrderDetailRowTransaction(detailId, trans)
 
-	var quantityUsedDeliveryNote *int32
+	var quantityUsedDeliveryNote *float64
 	result := dbOrm.Model(&SalesOrderDetail{}).Where("purchase_order_detail = ? AND status = 'E'", detailId).Select("SUM(quantity) AS quantity").Scan(&quantityUsedDeliveryNote)
 	if result.Error != nil {
 		log("DB", result.Error.Error())
@@ -710,17 +766,17 @@ func undoSalesOrderDetailStatueFromPendingPurchaseOrder(detailId int64, enterpri
 	}
 
 	if quantityUsedDeliveryNote == nil {
-		zero := int32(0)
+		zero := float64(0)
 		quantityUsedDeliveryNote = &zero
 	}
 
-	quantityToRemoveFromDeliveryNote := *quantityUsedDeliveryNote - purchaseOrderDetail.QuantityDeliveryNote
+	quantityToRemoveFromDeliveryNote := roundQuantity(*quantityUsedDeliveryNote - purchaseOrderDetail.QuantityDeliveryNote)
 	// The sale orders are using less quantity that the one remaining in the purchase delivery note, do nothing.
 	if quantityToRemoveFromDeliveryNote <= 0 {
 		return true
 	}
 
-	var quantityDeleted int32
+	var quantityDeleted float64
 
 	rows, err := dbOrm.Model(&SalesOrderDetail{}).Where("purchase_order_detail = ? AND status = 'E'", detailId).Select(`id,"order",quantity`).Order("quantity DESC").Rows()
 	if err != nil {
@@ -732,7 +788,7 @@ func undoSalesOrderDetailStatueFromPendingPurchaseOrder(detailId int64, enterpri
 
 	var salesOrderDetailId int64
 	var saleOrderId int64
-	var quantity int32
+	var quantity float64
 	for rows.Next() {
 		rows.Scan(&salesOrderDetailId, &saleOrderId, &quantity)
 
@@ -749,7 +805,7 @@ func undoSalesOrderDetailStatueFromPendingPurchaseOrder(detailId int64, enterpri
 		json, _ := json.Marshal(s)
 		go fireWebHook(s.EnterpriseId, "sales_order_detail", "PUT", string(json))
 
-		quantityDeleted += quantity
+		quantityDeleted = roundQuantity(quantityDeleted + quantity)
 
 		if quantityDeleted >= quantityToRemoveFromDeliveryNote {
 			return true
@@ -825,7 +881,7 @@ type PurchaseSalesOrderDetail struct {
 	DateCreated  time.Time `json:"dateCreated"`
 	Customer     int32     `json:"customer"`
 	CustomerName string    `json:"customerName"`
-	Quantity     int32     `json:"quantity"`
+	Quantity     float64   `json:"quantity"`
 	TotalAmount  float64   `json:"totalAmount"`
 }
 
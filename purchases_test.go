@@ -11,6 +11,7 @@ You should have received a copy of the GNU Affero General Public License along w
 package main
 
 import (
+	"strconv"
 	"testing"
 	"time"
 )
@@ -374,7 +375,8 @@ func TestServePurchaseOrderDetailsWithMultipleDeliveryNotes(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	ok, saleOrderId1 := saleOrder1.insertSalesOrder(1)
+	okAndErr, saleOrderId1 := saleOrder1.insertSalesOrder(1, nil)
+	ok = okAndErr.Ok
 	if !ok || purchaseOrderId <= 0 {
 		t.Error("Insert error, sale order not inserted.")
 		return
@@ -391,7 +393,7 @@ func TestServePurchaseOrderDetailsWithMultipleDeliveryNotes(t *testing.T) {
 		EnterpriseId: 1,
 	}
 
-	ok = salesOrderDetail1.insertSalesOrderDetail(0).Ok
+	ok = salesOrderDetail1.insertSalesOrderDetail(0, nil).Ok
 	if !ok {
 		t.Error("Insert error, sale order detail not inserted")
 		return
@@ -409,7 +411,8 @@ func TestServePurchaseOrderDetailsWithMultipleDeliveryNotes(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	ok, saleOrderId2 := saleOrder2.insertSalesOrder(1)
+	okAndErr, saleOrderId2 := saleOrder2.insertSalesOrder(1, nil)
+	ok = okAndErr.Ok
 	if !ok || purchaseOrderId <= 0 {
 		t.Error("Insert error, sale order not inserted.")
 		return
@@ -426,7 +429,7 @@ func TestServePurchaseOrderDetailsWithMultipleDeliveryNotes(t *testing.T) {
 		EnterpriseId: 1,
 	}
 
-	ok = salesOrderDetail2.insertSalesOrderDetail(0).Ok
+	ok = salesOrderDetail2.insertSalesOrderDetail(0, nil).Ok
 	if !ok {
 		t.Error("Insert error, sale order detail not inserted")
 		return
@@ -833,7 +836,8 @@ func TestChangePurchaseOrderDetailQuantityWithSaleOrders(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	ok, saleOrderId1 := saleOrder1.insertSalesOrder(1)
+	okAndErr, saleOrderId1 := saleOrder1.insertSalesOrder(1, nil)
+	ok = okAndErr.Ok
 	if !ok || purchaseOrderId <= 0 {
 		t.Error("Insert error, sale order not inserted.")
 		return
@@ -850,7 +854,7 @@ func TestChangePurchaseOrderDetailQuantityWithSaleOrders(t *testing.T) {
 		EnterpriseId: 1,
 	}
 
-	ok = salesOrderDetail1.insertSalesOrderDetail(0).Ok
+	ok = salesOrderDetail1.insertSalesOrderDetail(0, nil).Ok
 	if !ok {
 		t.Error("Insert error, sale order detail not inserted")
 		return
@@ -966,6 +970,209 @@ func TestChangePurchaseOrderDetailQuantityWithSaleOrders(t *testing.T) {
 	}
 }
 
+func TestDropShippingPurchaseOrder(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	// NEW PRODUCT
+
+	family := int32(1)
+	supplier := int32(1)
+
+	p := Product{
+		Name:          "Standing Office Desk",
+		Reference:     "OF-STD",
+		BarCode:       "",
+		ControlStock:  true,
+		Weight:        35,
+		FamilyId:      &family,
+		Width:         160,
+		Height:        120,
+		Depth:         80,
+		VatPercent:    21,
+		Price:         250,
+		PurchasePrice: 180,
+		Manufacturing: false,
+		SupplierId:    &supplier,
+		DropShipping:  true,
+		EnterpriseId:  1,
+	}
+
+	ok := p.insertProduct(0).Ok
+	if !ok {
+		t.Error("Insert error, could not insert product")
+		return
+	}
+
+	products := getProduct(1)
+	p = products[len(products)-1]
+	stockBefore := getStockRowAvailable(p.Id, 1)
+
+	// NEW SALE ORDER
+
+	saleOrder := SaleOrder{
+		CustomerId:        1,
+		PaymentMethodId:   3,
+		BillingSeriesId:   "EXP",
+		CurrencyId:        1,
+		BillingAddressId:  1,
+		ShippingAddressId: 1,
+		EnterpriseId:      1,
+	}
+
+	okAndErr, saleOrderId := saleOrder.insertSalesOrder(1, nil)
+	if !okAndErr.Ok || saleOrderId <= 0 {
+		t.Error("Insert error, sale order not inserted.")
+		return
+	}
+
+	salesOrderDetail := SalesOrderDetail{
+		OrderId:      saleOrderId,
+		ProductId:    p.Id,
+		Price:        250,
+		Quantity:     2,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+
+	ok = salesOrderDetail.insertSalesOrderDetail(0, nil).Ok
+	if !ok {
+		t.Error("Insert error, sale order detail not inserted")
+		return
+	}
+
+	okAndErr = invoiceAllSaleOrder(saleOrderId, 1, 0)
+	if !okAndErr.Ok {
+		t.Error("Can't invoice the sale order", okAndErr.ErrorCode, okAndErr.ExtraData)
+		return
+	}
+
+	// the detail waits for its own purchase order
+	salesOrderDetail = getSalesOrderDetailRow(salesOrderDetail.Id)
+	if !salesOrderDetail.DropShipping || salesOrderDetail.Status != "A" {
+		t.Error("The drop shipping detail is not waiting for a purchase order", salesOrderDetail.Status)
+		return
+	}
+
+	// the drop shipping details can't be served from the warehouse
+	okAndErr, _ = deliveryNoteAllSaleOrder(saleOrderId, 1, 0, nil)
+	if okAndErr.Ok || okAndErr.ErrorCode != 2 {
+		t.Error("A delivery note has been generated for a drop shipping detail")
+		return
+	}
+
+	// GENERATE THE PURCHASE ORDER
+
+	okAndErr = generateDropShippingPurchaseOrders(saleOrderId, 1, 0)
+	if !okAndErr.Ok || len(okAndErr.ExtraData) != 1 {
+		t.Error("Can't generate the drop shipping purchase orders", okAndErr.ErrorCode, okAndErr.ExtraData)
+		return
+	}
+	purchaseOrderId, _ := strconv.Atoi(okAndErr.ExtraData[0])
+
+	purchaseOrder := getPurchaseOrderRow(int64(purchaseOrderId))
+	if !purchaseOrder.DropShipping || purchaseOrder.ShippingAddressId != saleOrder.ShippingAddressId || purchaseOrder.SalesOrderId == nil || *purchaseOrder.SalesOrderId != saleOrderId {
+		t.Error("The purchase order is not shipped to the customer")
+		return
+	}
+
+	salesOrderDetail = getSalesOrderDetailRow(salesOrderDetail.Id)
+	if salesOrderDetail.Status != "B" || salesOrderDetail.PurchaseOrderDetailId == nil {
+		t.Error("The sale order detail is not associated with the purchase order", salesOrderDetail.Status)
+		return
+	}
+
+	// CONFIRM THE DISPATCH
+
+	okAndErr = confirmDropShippingPurchaseOrder(int64(purchaseOrderId), 1, 0)
+	if !okAndErr.Ok {
+		t.Error("Can't confirm the dispatch of the purchase order", okAndErr.ErrorCode, okAndErr.ExtraData)
+		return
+	}
+	deliveryNoteId, _ := strconv.Atoi(okAndErr.ExtraData[0])
+
+	salesOrderDetail = getSalesOrderDetailRow(salesOrderDetail.Id)
+	if salesOrderDetail.Status != "G" || salesOrderDetail.QuantityDeliveryNote != salesOrderDetail.Quantity {
+		t.Error("The sale order detail has not been closed", salesOrderDetail.Status)
+		return
+	}
+	if len(getWarehouseMovementBySalesDeliveryNote(int64(deliveryNoteId), 1)) != 0 || len(getDropShippingDeliveryNoteDetails(int64(deliveryNoteId), 1)) != 1 {
+		t.Error("The delivery note has not been generated without warehouse movements")
+		return
+	}
+	stockAfter := getStockRowAvailable(p.Id, 1)
+	if stockAfter.Quantity != stockBefore.Quantity {
+		t.Error("The stock has changed with a drop shipping purchase order")
+		return
+	}
+
+	okAndErr = confirmDropShippingPurchaseOrder(int64(purchaseOrderId), 1, 0)
+	if okAndErr.Ok || okAndErr.ErrorCode != 2 {
+		t.Error("The dispatch of the purchase order has been confirmed twice")
+		return
+	}
+
+	// CLEAN UP
+
+	n := getSalesDeliveryNoteRow(int64(deliveryNoteId))
+	okAndErr = n.deleteSalesDeliveryNotes(0, nil)
+	if !okAndErr.Ok {
+		t.Error("Can't delete the sales delivery note", okAndErr.ErrorCode)
+		return
+	}
+
+	salesOrderDetail = getSalesOrderDetailRow(salesOrderDetail.Id)
+	if salesOrderDetail.Status != "B" || salesOrderDetail.QuantityDeliveryNote != 0 {
+		t.Error("The sale order detail has not been reopened", salesOrderDetail.Status)
+		return
+	}
+
+	purchaseDetails := getPurchaseOrderDetail(int64(purchaseOrderId), 1)
+	purchaseDetails[0].EnterpriseId = 1
+	ok = purchaseDetails[0].deletePurchaseOrderDetail(0, nil).Ok
+	if !ok {
+		t.Error("Delete error, purchase order detail not deleted")
+		return
+	}
+
+	purchaseOrder.EnterpriseId = 1
+	ok = purchaseOrder.deletePurchaseOrder(0).Ok
+	if !ok {
+		t.Error("Delete error, purchase order not deleted")
+		return
+	}
+
+	saleRelations := getSalesOrderRelations(saleOrderId, 1)
+	for i := 0; i < len(saleRelations.Invoices); i++ {
+		okAndErr = saleRelations.Invoices[i].deleteSalesInvoice(0)
+		if !okAndErr.Ok {
+			t.Error("Can't delete sale invoice", okAndErr.ErrorCode, okAndErr.ExtraData)
+			return
+		}
+	}
+
+	salesOrderDetail.EnterpriseId = 1
+	ok = salesOrderDetail.deleteSalesOrderDetail(1, nil).Ok
+	if !ok {
+		t.Error("Delete error, sale order detail not deleted")
+		return
+	}
+
+	saleOrder.Id = saleOrderId
+	ok = saleOrder.deleteSalesOrder(1).Ok
+	if !ok {
+		t.Error("Delete error, sale order not deleted.")
+		return
+	}
+
+	ok = p.deleteProduct(0).Ok
+	if !ok {
+		t.Error("Delete error, could not delete product")
+		return
+	}
+}
+
 // ===== PURCHASE INVOICE
 
 /* GET */
@@ -1242,6 +1449,131 @@ func TestIInvoicePartiallyPurchaseOrder(t *testing.T) {
 	o.deletePurchaseOrder(0)
 }
 
+func TestPurchaseInvoiceMatch(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	o := PurchaseOrder{
+		SupplierId:        1,
+		PaymentMethodId:   1,
+		BillingSeriesId:   "INT",
+		CurrencyId:        1,
+		BillingAddressId:  3,
+		ShippingAddressId: 3,
+		EnterpriseId:      1,
+	}
+
+	_, orderId := o.insertPurchaseOrder(0, nil)
+
+	d := PurchaseOrderDetail{
+		OrderId:      orderId,
+		ProductId:    1,
+		Price:        15,
+		Quantity:     15,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+
+	d.insertPurchaseOrderDetail(0, nil)
+
+	ok := invoiceAllPurchaseOrder(orderId, 1, 0).Ok
+	if !ok {
+		t.Error("Could not invoice all purchase order")
+		return
+	}
+
+	r := getPurchaseOrderRelations(orderId, 1)
+	if len(r.Invoices) == 0 {
+		t.Error("The invoice has not loaded from the purchase order relations")
+		return
+	}
+	invoiceId := r.Invoices[0].Id
+
+	// nothing has been received yet, the invoice must be blocked
+	match := checkPurchaseInvoiceMatch(invoiceId, 1)
+	if match.Status != "B" || len(match.Lines) != 1 || match.Lines[0].QuantityOk || !match.Lines[0].PriceOk {
+		t.Error("The invoice has not been blocked by the three-way match", match)
+		return
+	}
+	invoice := getPurchaseInvoiceRow(invoiceId)
+	if invoice.MatchStatus != "B" {
+		t.Error("The match status has not been saved in the invoice")
+		return
+	}
+
+	// release the invoice
+	ok = releasePurchaseInvoiceMatch(invoiceId, 1, 1)
+	if !ok {
+		t.Error("Could not release the purchase invoice")
+		return
+	}
+	invoice = getPurchaseInvoiceRow(invoiceId)
+	if invoice.MatchStatus != "R" || invoice.MatchReleasedById == nil || invoice.MatchReleaseDate == nil {
+		t.Error("The purchase invoice has not been released")
+		return
+	}
+
+	// the invoice can't be released twice
+	ok = releasePurchaseInvoiceMatch(invoiceId, 1, 1)
+	if ok {
+		t.Error("A released invoice has been released again")
+		return
+	}
+
+	// delete created invoice
+	ok = invoice.deletePurchaseInvoice(0, nil).Ok
+	if !ok {
+		t.Error("The invoice creted could not be deleted")
+		return
+	}
+
+	// delete created order
+	details := getPurchaseOrderDetail(orderId, 1)
+	details[0].deletePurchaseOrderDetail(0, nil)
+	o.Id = orderId
+	o.deletePurchaseOrder(0)
+}
+
+func TestPurchaseInvoiceMatchLineTolerances(t *testing.T) {
+	l := PurchaseInvoiceMatchLine{Matched: true, Price: 10.5, OrderPrice: 10, QuantityInvoiced: 11, QuantityReceived: 10}
+
+	l.check(0, 0)
+	if l.PriceOk || l.QuantityOk {
+		t.Error("The line is outside the tolerances", l)
+		return
+	}
+
+	l.check(5, 10)
+	if !l.PriceOk || !l.QuantityOk {
+		t.Error("The line is inside the tolerances", l)
+		return
+	}
+
+	l.check(4, 9)
+	if l.PriceOk || l.QuantityOk {
+		t.Error("The line is outside the tolerances", l)
+		return
+	}
+
+	// the lines without product are not checked
+	l = PurchaseInvoiceMatchLine{Price: 100, QuantityInvoiced: 5}
+	l.check(0, 0)
+	if !l.PriceOk || !l.QuantityOk {
+		t.Error("The lines without product can't block the invoice", l)
+		return
+	}
+
+	// the products that are not in a purchase order have not been ordered nor received
+	var productId int32 = 1
+	l = PurchaseInvoiceMatchLine{ProductId: &productId, Price: 100, Quantity: 5}
+	l.check(0, 0)
+	if l.PriceOk || l.QuantityOk {
+		t.Error("The product lines without purchase order must block the invoice", l)
+		return
+	}
+}
+
 func TestGetPurchaseInvoiceRelations(t *testing.T) {
 	if db == nil {
 		ConnectTestWithDB(t)
@@ -1281,6 +1613,97 @@ func TestGetPurchaseInvoiceRelations(t *testing.T) {
 	}
 }
 
+func TestImportPurchaseInvoiceUBL(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	// the supplier is found by the VAT number
+	supplier := getSupplierRow(1)
+	vatNumberInDisk := supplier.VatNumber
+	dbOrm.Model(&Supplier{}).Where("id = ?", 1).Update("vat_number", "B12345674")
+	defer dbOrm.Model(&Supplier{}).Where("id = ?", 1).Update("vat_number", vatNumberInDisk)
+
+	var currency Currency
+	dbOrm.Model(&Currency{}).Where("id = ?", 1).First(&currency)
+	product := getProductRow(1)
+	document := `<?xml version="1.0" encoding="UTF-8"?>
+<Invoice xmlns="urn:oasis:names:specification:ubl:schema:xsd:Invoice-2" xmlns:cac="urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2" xmlns:cbc="urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2">
+	<cbc:ID>UBL-TEST-1</cbc:ID>
+	<cbc:DocumentCurrencyCode>` + currency.IsoCode + `</cbc:DocumentCurrencyCode>
+	<cac:AccountingSupplierParty><cac:Party><cac:PartyTaxScheme><cbc:CompanyID>ESB12345674</cbc:CompanyID></cac:PartyTaxScheme></cac:Party></cac:AccountingSupplierParty>
+	<cac:InvoiceLine>
+		<cbc:ID>1</cbc:ID>
+		<cbc:InvoicedQuantity unitCode="C62">2</cbc:InvoicedQuantity>
+		<cbc:LineExtensionAmount currencyID="EUR">20.00</cbc:LineExtensionAmount>
+		<cac:Item><cbc:Name>Known product</cbc:Name><cac:StandardItemIdentification><cbc:ID schemeID="0160">` + product.BarCode + `</cbc:ID></cac:StandardItemIdentification><cac:ClassifiedTaxCategory><cbc:Percent>21</cbc:Percent></cac:ClassifiedTaxCategory></cac:Item>
+	</cac:InvoiceLine>
+	<cac:InvoiceLine>
+		<cbc:ID>2</cbc:ID>
+		<cbc:InvoicedQuantity unitCode="C62">1</cbc:InvoicedQuantity>
+		<cbc:LineExtensionAmount currencyID="EUR">5.00</cbc:LineExtensionAmount>
+		<cac:Item><cbc:Name>Unknown product</cbc:Name><cac:SellersItemIdentification><cbc:ID>NOT-A-REFERENCE</cbc:ID></cac:SellersItemIdentification><cac:ClassifiedTaxCategory><cbc:Percent>21</cbc:Percent></cac:ClassifiedTaxCategory></cac:Item>
+	</cac:InvoiceLine>
+	<cac:InvoiceLine>
+		<cbc:ID>3</cbc:ID>
+		<cbc:InvoicedQuantity unitCode="KGM">1.5</cbc:InvoicedQuantity>
+		<cbc:LineExtensionAmount currencyID="EUR">3.00</cbc:LineExtensionAmount>
+		<cac:Item><cbc:Name>Decimal quantity</cbc:Name></cac:Item>
+	</cac:InvoiceLine>
+</Invoice>`
+
+	result := importPurchaseInvoiceUBL([]byte("<Order></Order>"), 1, 0)
+	if result.Ok || result.ErrorCode != 1 {
+		t.Error("A document that is not an invoice has been imported")
+		return
+	}
+
+	result = importPurchaseInvoiceUBL([]byte(document), 1, 0)
+	if !result.Ok && result.ErrorCode == 3 {
+		return // the supplier has no billing data
+	}
+	if !result.Ok {
+		t.Error("Can't import the UBL invoice", result.ErrorCode)
+		return
+	}
+	invoice := getPurchaseInvoiceRow(result.InvoiceId)
+	if invoice.SupplierId != 1 || invoice.SupplierReference != "UBL-TEST-1" {
+		t.Error("The supplier of the imported invoice is not correct")
+		return
+	}
+
+	if len(result.Lines) != 3 {
+		t.Error("The import result doesn't have all the lines")
+		return
+	}
+	if len(product.BarCode) == 13 && (!result.Lines[0].Ok || result.Lines[0].ProductId == nil || *result.Lines[0].ProductId != product.Id) {
+		t.Error("The product has not been found by the EAN code")
+		return
+	}
+	if !result.Lines[1].Ok || result.Lines[1].ErrorCode != 1 || result.Lines[1].ProductId != nil {
+		t.Error("The line with an unknown product has not been imported as a text line")
+		return
+	}
+	if result.Lines[2].Ok || result.Lines[2].ErrorCode != 2 {
+		t.Error("A line with a decimal quantity has been imported")
+		return
+	}
+
+	details := getPurchaseInvoiceDetail(result.InvoiceId, 1)
+	var importedLines int
+	for i := 0; i < len(result.Lines); i++ {
+		if result.Lines[i].Ok {
+			importedLines++
+		}
+	}
+	if len(details) != importedLines {
+		t.Error("The details of the imported invoice are not correct")
+		return
+	}
+
+	invoice.deletePurchaseInvoice(0, nil)
+}
+
 // ===== PURCHASE INVOICE DETAILS
 
 /* GET */
@@ -1641,3 +2064,328 @@ func TestDeliveryNotePartiallyPurchaseOrder(t *testing.T) {
 	o.Id = orderId
 	o.deletePurchaseOrder(0)
 }
+
+// ===== LANDED COST
+
+/* FUNCTIONALITY */
+
+func TestLandedCostAllocation(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	settingsInDisk := getSettingsRecordById(1)
+	dbOrm.Model(&Settings{}).Where("id = ?", 1).Update("costing_method", COSTING_METHOD_FIFO)
+	defer dbOrm.Model(&Settings{}).Where("id = ?", 1).Update("costing_method", settingsInDisk.CostingMethod)
+
+	o := PurchaseOrder{
+		SupplierId:        1,
+		PaymentMethodId:   1,
+		BillingSeriesId:   "INT",
+		CurrencyId:        1,
+		BillingAddressId:  3,
+		ShippingAddressId: 3,
+		EnterpriseId:      1,
+	}
+
+	_, orderId := o.insertPurchaseOrder(0, nil)
+
+	d := PurchaseOrderDetail{
+		OrderId:      orderId,
+		ProductId:    1,
+		Price:        15,
+		Quantity:     15,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+
+	d.insertPurchaseOrderDetail(0, nil)
+
+	okAndErr, noteId := deliveryNoteAllPurchaseOrder(orderId, 1, 0)
+	if !okAndErr.Ok || noteId <= 0 {
+		t.Error("Could not delivery note all purchase order")
+		return
+	}
+
+	l := LandedCost{
+		Description:      "Freight",
+		Type:             "F",
+		AllocationMethod: LANDED_COST_ALLOCATION_QUANTITY,
+		Amount:           30,
+		EnterpriseId:     1,
+	}
+	ok := l.insertLandedCost()
+	if !ok || l.Id <= 0 {
+		t.Error("Insert error, could not insert the landed cost")
+		return
+	}
+
+	n := LandedCostDeliveryNote{
+		LandedCostId:           l.Id,
+		PurchaseDeliveryNoteId: noteId,
+		EnterpriseId:           1,
+	}
+	ok = n.insertLandedCostDeliveryNote()
+	if !ok {
+		t.Error("Insert error, could not add the delivery note to the landed cost")
+		return
+	}
+
+	// 10 of the 15 units received have already left the warehouse
+	movements := getWarehouseMovementByPurchaseDeliveryNote(noteId, 1)
+	movementLayers := getWarehouseMovementCostLayers(movements[0].Id, 1)
+	if len(movementLayers) != 1 {
+		t.Error("The delivery note has not created a cost layer", movementLayers)
+		return
+	}
+	dbOrm.Model(&CostLayer{}).Where("id = ?", movementLayers[0].CostLayerId).Update("quantity_remaining", 5)
+
+	productBefore := getProductRow(1)
+	okAndErr = allocateLandedCost(l.Id, 1, 0)
+	if !okAndErr.Ok {
+		t.Error("Could not allocate the landed cost", okAndErr)
+		return
+	}
+
+	// the units in stock get the landed cost per unit received, 30 / 15 = 2
+	movementLayers = getWarehouseMovementCostLayers(movements[0].Id, 1)
+	if absf(movementLayers[0].CostLayer.UnitCost-17) > 0.0001 || absf(movementLayers[0].UnitCost-17) > 0.0001 {
+		t.Error("The landed cost of the units in stock is not correct", movementLayers[0])
+		return
+	}
+
+	movements = getWarehouseMovementByPurchaseDeliveryNote(noteId, 1)
+	if len(movements) != 1 || movements[0].Price != 17 {
+		t.Error("The price of the warehouse movement has not been updated with the landed cost", movements)
+		return
+	}
+	allocations := getLandedCostAllocations(l.Id, 1)
+	if len(allocations) != 1 || allocations[0].Amount != 30 {
+		t.Error("The landed cost has not been allocated", allocations)
+		return
+	}
+	productAfter := getProductRow(1)
+	if productBefore.Stock > 0 && productAfter.CostPrice <= productBefore.CostPrice {
+		t.Error("The cost price of the product has not been updated")
+		return
+	}
+
+	// can't allocate twice
+	okAndErr = allocateLandedCost(l.Id, 1, 0)
+	if okAndErr.Ok || okAndErr.ErrorCode != 1 {
+		t.Error("The landed cost has been allocated twice")
+		return
+	}
+
+	// the delivery note can't be deleted while the landed cost is allocated
+	note := getPurchaseDeliveryNoteRow(noteId)
+	ok = note.deletePurchaseDeliveryNotes(0, nil)
+	if ok {
+		t.Error("A delivery note with an allocated landed cost has been deleted")
+		return
+	}
+
+	ok = undoLandedCostAllocation(l.Id, 1, 0)
+	if !ok {
+		t.Error("Could not undo the landed cost allocation")
+		return
+	}
+	movements = getWarehouseMovementByPurchaseDeliveryNote(noteId, 1)
+	if len(movements) != 1 || movements[0].Price != 15 {
+		t.Error("The price of the warehouse movement has not been restored", movements)
+		return
+	}
+	productAfter = getProductRow(1)
+	if absf(productAfter.CostPrice-productBefore.CostPrice) > 0.0001 {
+		t.Error("The cost price of the product has not been restored")
+		return
+	}
+	movementLayers = getWarehouseMovementCostLayers(movements[0].Id, 1)
+	if absf(movementLayers[0].CostLayer.UnitCost-15) > 0.0001 {
+		t.Error("The cost of the units in stock has not been restored", movementLayers[0])
+		return
+	}
+	dbOrm.Model(&CostLayer{}).Where("id = ?", movementLayers[0].CostLayerId).Update("quantity_remaining", 15)
+
+	ok = l.deleteLandedCost()
+	if !ok {
+		t.Error("Delete error, could not delete the landed cost")
+		return
+	}
+
+	// delete created delivery note
+	ok = note.deletePurchaseDeliveryNotes(0, nil)
+	if !ok {
+		t.Error("The delivery note creted could not be deleted")
+		return
+	}
+
+	// delete created order
+	details := getPurchaseOrderDetail(orderId, 1)
+	details[0].deletePurchaseOrderDetail(0, nil)
+	o.Id = orderId
+	o.deletePurchaseOrder(0)
+}
+
+func TestSplitLandedCost(t *testing.T) {
+	parts := splitLandedCost(100, []float64{1, 1, 1})
+	if len(parts) != 3 || parts[0] != 33.33 || parts[1] != 33.33 || parts[2] != 33.34 {
+		t.Error("The landed cost has not been split correctly", parts)
+		return
+	}
+
+	parts = splitLandedCost(50, []float64{30, 0, 10})
+	if len(parts) != 3 || parts[0] != 37.5 || parts[1] != 0 || parts[2] != 12.5 {
+		t.Error("The landed cost has not been split correctly", parts)
+		return
+	}
+
+	if splitLandedCost(50, []float64{0, 0}) != nil || splitLandedCost(50, []float64{}) != nil {
+		t.Error("A landed cost without basis can't be split")
+		return
+	}
+}
+
+// ===== REQUEST FOR QUOTATION
+
+/* FUNCTIONALITY */
+
+func TestRequestForQuotationAward(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	r := RequestForQuotation{
+		Description:  "Test",
+		WarehouseId:  "W1",
+		EnterpriseId: 1,
+	}
+	ok := r.insertRequestForQuotation(0, nil)
+	if !ok || r.Id <= 0 {
+		t.Error("Insert error, could not insert the request for quotation")
+		return
+	}
+
+	d := RequestForQuotationDetail{
+		RequestForQuotationId: r.Id,
+		ProductId:             1,
+		Quantity:              10,
+		EnterpriseId:          1,
+	}
+	ok = d.insertRequestForQuotationDetail(nil)
+	if !ok || d.Id <= 0 {
+		t.Error("Insert error, could not insert the request for quotation detail")
+		return
+	}
+
+	s := RequestForQuotationSupplier{
+		RequestForQuotationId: r.Id,
+		SupplierId:            1,
+		EnterpriseId:          1,
+	}
+	ok = s.insertRequestForQuotationSupplier(nil)
+	if !ok {
+		t.Error("Insert error, could not add the supplier to the request for quotation")
+		return
+	}
+
+	// can't award a line without a reply
+	award := RequestForQuotationAward{RequestForQuotationId: r.Id, Lines: []RequestForQuotationAwardLine{{RequestForQuotationDetailId: d.Id, SupplierId: 1}}}
+	okAndErr := award.awardRequestForQuotation(1, 0)
+	if okAndErr.Ok || okAndErr.ErrorCode != 3 {
+		t.Error("A line without a reply has been awarded", okAndErr)
+		return
+	}
+
+	reply := RequestForQuotationReply{
+		RequestForQuotationDetailId: d.Id,
+		SupplierId:                  1,
+		Price:                       12.5,
+		LeadTimeDays:                5,
+		EnterpriseId:                1,
+	}
+	ok = reply.setRequestForQuotationReply()
+	if !ok {
+		t.Error("Could not enter the reply of the supplier")
+		return
+	}
+
+	comparison := getRequestForQuotationComparison(r.Id, 1)
+	if len(comparison.Lines) != 1 || comparison.Lines[0].CheapestSupplierId == nil || *comparison.Lines[0].CheapestSupplierId != 1 {
+		t.Error("The comparison of the replies is not correct", comparison)
+		return
+	}
+
+	award = RequestForQuotationAward{RequestForQuotationId: r.Id, Lines: []RequestForQuotationAwardLine{{RequestForQuotationDetailId: d.Id, SupplierId: 1}}}
+	okAndErr = award.awardRequestForQuotation(1, 0)
+	if !okAndErr.Ok || len(okAndErr.PurchaseOrders) != 1 {
+		t.Error("Could not award the request for quotation", okAndErr)
+		return
+	}
+
+	details := getPurchaseOrderDetail(okAndErr.PurchaseOrders[0], 1)
+	if len(details) != 1 || details[0].Price != 12.5 || details[0].Quantity != 10 {
+		t.Error("The purchase order has not been created with the price of the reply", details)
+		return
+	}
+	r = getRequestForQuotationRow(r.Id)
+	if r.Status != REQUEST_FOR_QUOTATION_AWARDED {
+		t.Error("The request for quotation has not been set as awarded")
+		return
+	}
+
+	// can't delete a request with awarded lines
+	ok = r.deleteRequestForQuotation(0)
+	if ok {
+		t.Error("A request for quotation with awarded lines has been deleted")
+		return
+	}
+
+	// delete created order
+	details[0].deletePurchaseOrderDetail(0, nil)
+	o := getPurchaseOrderRow(okAndErr.PurchaseOrders[0])
+	o.deletePurchaseOrder(0)
+
+	ok = r.deleteRequestForQuotation(0)
+	if !ok {
+		t.Error("Delete error, could not delete the request for quotation")
+		return
+	}
+}
+
+func TestCompareRequestForQuotationReplies(t *testing.T) {
+	suppliers := []RequestForQuotationSupplier{{SupplierId: 1}, {SupplierId: 2}, {SupplierId: 3}}
+	details := []RequestForQuotationDetail{{Id: 1, Quantity: 10}, {Id: 2, Quantity: 4}}
+	replies := []RequestForQuotationReply{
+		{RequestForQuotationDetailId: 1, SupplierId: 1, Price: 10, LeadTimeDays: 2},
+		// the prices of the supplier 2 are in a currency with an exchange rate of 2, 16 = 8 in euros
+		{RequestForQuotationDetailId: 1, SupplierId: 2, Price: 16, LeadTimeDays: 10},
+		{RequestForQuotationDetailId: 1, SupplierId: 3, Price: 8, LeadTimeDays: 7},
+		{RequestForQuotationDetailId: 2, SupplierId: 1, Price: 20, LeadTimeDays: 3},
+		{RequestForQuotationDetailId: 2, SupplierId: 2, Price: 30, LeadTimeDays: 3},
+	}
+
+	comparison := compareRequestForQuotationReplies(suppliers, []float64{1, 2, 1}, details, replies)
+	if len(comparison.Lines) != 2 {
+		t.Error("The comparison must have a line for each detail", comparison)
+		return
+	}
+
+	line := comparison.Lines[0]
+	if *line.CheapestSupplierId != 3 || *line.ShortestLeadTimeSupplierId != 1 || line.TotalAmount[1] != 160 {
+		t.Error("The first line has not been compared correctly", line)
+		return
+	}
+
+	line = comparison.Lines[1]
+	if line.Replies[2] != nil || *line.CheapestSupplierId != 2 || *line.ShortestLeadTimeSupplierId != 2 {
+		t.Error("The second line has not been compared correctly", line)
+		return
+	}
+
+	comparison = compareRequestForQuotationReplies(suppliers, []float64{1, 1, 1}, details, nil)
+	if comparison.Lines[0].CheapestSupplierId != nil {
+		t.Error("A line without replies can't have a cheapest supplier")
+		return
+	}
+}
@@ -10,6 +10,8 @@ You should have received a copy of the GNU Affero General Public License along w
 
 package main
 
+import "gorm.io/gorm/clause"
+
 type ReportTemplate struct {
 	EnterpriseId int32    `json:"-" gorm:"primaryKey;column:enterprise;not null:true"`
 	Enterprise   Settings `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
@@ -42,9 +44,10 @@ func getReportTemplate(enterpriseId int32, key string) ReportTemplate {
 }
 
 // Must NOT be callable from the web client!
+// If the template already exists for the enterprise, it is not overwritten, so the templates can be added to the existing enterprises when upgrading.
 func (r ReportTemplate) insertReportTemplate() {
 	// insert the report template using dbOrm
-	result := dbOrm.Create(&r)
+	result := dbOrm.Clauses(clause.OnConflict{DoNothing: true}).Create(&r)
 	if result.Error != nil {
 		log("DB", result.Error.Error())
 	}
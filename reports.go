@@ -16,6 +16,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func generateReport(w http.ResponseWriter, r *http.Request) {
@@ -58,14 +59,40 @@ func generateReport(w http.ResponseWriter, r *http.Request) {
 	switch report[0] {
 	case "SALES_ORDER":
 		w.Write(reportSalesOrder(id, forcePrint, enterpriseId, int32(idLang)))
+	case "SALES_QUOTATION":
+		w.Write(reportSalesQuotation(id, forcePrint, enterpriseId, int32(idLang)))
+	case "SALES_AGENT_SETTLEMENT":
+		w.Write(reportSalesAgentSettlement(id, forcePrint, enterpriseId))
+	case "STATEMENT_OF_ACCOUNT_CUSTOMER":
+		w.Write(reportStatementOfAccount(id, forcePrint, false, getReportDateParameter(r, "date_start"), getReportDateParameter(r, "date_end"), enterpriseId))
+	case "STATEMENT_OF_ACCOUNT_SUPPLIER":
+		w.Write(reportStatementOfAccount(id, forcePrint, true, getReportDateParameter(r, "date_start"), getReportDateParameter(r, "date_end"), enterpriseId))
+	case "AGING_CUSTOMERS":
+		w.Write(reportAging(forcePrint, false, getReportDateParameter(r, "date"), enterpriseId))
+	case "AGING_SUPPLIERS":
+		w.Write(reportAging(forcePrint, true, getReportDateParameter(r, "date"), enterpriseId))
 	case "SALES_INVOICE":
 		w.Write(reportSalesInvoice(id, forcePrint, enterpriseId))
+	case "SALES_INVOICE_FACTURAE":
+		w.Header().Add("Content-Type", "application/xml")
+		w.Write(reportSalesInvoiceFacturae(id, enterpriseId))
+	case "SALES_INVOICE_UBL":
+		w.Header().Add("Content-Type", "application/xml")
+		w.Write(reportSalesInvoiceUBL(id, enterpriseId))
+	case "SALES_INVOICE_FACTURX":
+		w.Header().Add("Content-Type", "application/pdf")
+		w.Write(reportSalesInvoiceFacturX(id, enterpriseId))
+	case "SALES_INVOICE_REGISTER":
+		w.Header().Add("Content-Type", "application/xml")
+		w.Write(reportSalesInvoiceRegister(id, enterpriseId))
 	case "SALES_INVOICE_TICKET":
 		w.Write(reportSalesInvoiceTicket(id, forcePrint, enterpriseId))
 	case "SALES_DELIVERY_NOTE":
 		w.Write(reportSalesDeliveryNote(id, forcePrint, enterpriseId))
 	case "PURCHASE_ORDER":
 		w.Write(reportPurchaseOrder(id, forcePrint, enterpriseId))
+	case "REQUEST_FOR_QUOTATION":
+		w.Write(reportRequestForQuotation(id, forcePrint, 0, enterpriseId))
 	case "BOX_CONTENT":
 		w.Write(reportBoxContent(id, forcePrint, enterpriseId))
 	case "PALLET_CONTENT":
@@ -76,6 +103,19 @@ func generateReport(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// Returns the optional date (YYYY-MM-DD) in the query string of a report, or nil if it's not set or not valid
+func getReportDateParameter(r *http.Request, name string) *time.Time {
+	value, ok := r.URL.Query()[name]
+	if !ok {
+		return nil
+	}
+	date, err := time.Parse("2006-01-02", value[0])
+	if err != nil {
+		return nil
+	}
+	return &date
+}
+
 func getEnterpriseLogoBase64(enterpriseId int32) string {
 	logo, mimeType := getEnterpriseLogo(enterpriseId)
 	return "data:" + mimeType + ";base64," + chunkSplit(base64.StdEncoding.EncodeToString(logo), 76, "\n")
@@ -124,12 +164,82 @@ func reportSalesOrder(id int, forcePrint bool, enterpriseId int32, idLang int32)
 
 	detailHtmlTemplate := html[strings.Index(html, "&&detail&&")+len("&&detail&&") : strings.Index(html, "&&--detail--&&")]
 	detailsHtml := ""
+	unitSymbols := getUnitOfMeasureSymbols(enterpriseId)
 
 	for i := 0; i < len(details); i++ {
 		detailHtml := detailHtmlTemplate
 
 		detailHtml = strings.Replace(detailHtml, "$$detail_product$$", details[i].Product.Name, 1)
-		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", strconv.Itoa(int(details[i].Quantity)), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", formatReportQuantity(details[i].Quantity, &details[i].Product, details[i].UnitOfMeasureId, details[i].UnitFactor, unitSymbols), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_unit_price$$", fmt.Sprintf("%.2f", details[i].Price), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_vat$$", fmt.Sprintf("%.2f", details[i].VatPercent), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_total$$", fmt.Sprintf("%.2f", details[i].TotalAmount), 1)
+
+		detailsHtml += detailHtml
+	}
+
+	html = html[:strings.Index(html, "&&detail&&")] + detailsHtml + html[strings.Index(html, "&&--detail--&&")+len("&&--detail--&&"):]
+
+	if idLang != 0 {
+		html = translateReport(html, idLang, enterpriseId)
+	}
+
+	return []byte(html)
+}
+
+func reportSalesQuotation(id int, forcePrint bool, enterpriseId int32, idLang int32) []byte {
+	q := getSalesQuotationRow(int64(id))
+	if q.EnterpriseId != enterpriseId {
+		return nil
+	}
+
+	address := getAddressRow(q.BillingAddressId)
+	stateName := ""
+	if address.StateId != nil {
+		stateName = address.State.Name
+	}
+	details := getSalesQuotationDetail(q.Id, enterpriseId)
+
+	template := getReportTemplate(enterpriseId, "SALES_QUOTATION")
+
+	html := template.Html
+
+	html = strings.Replace(html, "$$img_base64$$", getEnterpriseLogoBase64(enterpriseId), 1)
+	html = strings.Replace(html, "$$quotation_number$$", q.QuotationName, 1)
+	html = strings.Replace(html, "$$quotation_date$$", q.DateCreated.Format("2006-01-02 15:04:05"), 1)
+	html = strings.Replace(html, "$$quotation_valid_until$$", q.ValidUntil.Format("2006-01-02"), 1)
+	html = strings.Replace(html, "$$quotation_reference$$", q.Reference, 1)
+	html = strings.Replace(html, "$$quotation_payment_method_name$$", q.PaymentMethod.Name, 1)
+	html = strings.Replace(html, "$$quotation_customer_name$$", q.Customer.Name, 1)
+	html = strings.Replace(html, "$$address_address$$", address.Address, 1)
+	html = strings.Replace(html, "$$address_address2$$", address.Address2, 1)
+	html = strings.Replace(html, "$$address_city$$", address.City, 1)
+	html = strings.Replace(html, "$$address_postcode$$", address.ZipCode, 1)
+	html = strings.Replace(html, "$$address_state$$", stateName, 1)
+	html = strings.Replace(html, "$$address_country$$", address.Country.Name, 1)
+	html = strings.Replace(html, "$$quotation_notes$$", q.Notes, 1)
+	html = strings.Replace(html, "$$quotation_total_products$$", fmt.Sprintf("%.2f", q.TotalProducts), 1)
+	html = strings.Replace(html, "$$quotation_vat_amount$$", fmt.Sprintf("%.2f", q.VatAmount), 1)
+	html = strings.Replace(html, "$$quotation_discount_percent$$", fmt.Sprintf("%.2f", q.DiscountPercent), 1)
+	html = strings.Replace(html, "$$quotation_fix_discount$$", fmt.Sprintf("%.2f", q.FixDiscount), 1)
+	html = strings.Replace(html, "$$quotation_shipping_price$$", fmt.Sprintf("%.2f", q.ShippingPrice), 1)
+	html = strings.Replace(html, "$$quotation_shipping_discount$$", fmt.Sprintf("%.2f", q.ShippingDiscount), 1)
+	html = strings.Replace(html, "$$quotation_total_with_discount$$", fmt.Sprintf("%.2f", q.TotalWithDiscount), 1)
+	html = strings.Replace(html, "$$quotation_total_amount$$", fmt.Sprintf("%.2f", q.TotalAmount), 1)
+	if forcePrint {
+		html = strings.Replace(html, "$$script$$", "window.print()", 1)
+	} else {
+		html = strings.Replace(html, "$$script$$", "", 1)
+	}
+
+	detailHtmlTemplate := html[strings.Index(html, "&&detail&&")+len("&&detail&&") : strings.Index(html, "&&--detail--&&")]
+	detailsHtml := ""
+
+	for i := 0; i < len(details); i++ {
+		detailHtml := detailHtmlTemplate
+
+		detailHtml = strings.Replace(detailHtml, "$$detail_product$$", details[i].Product.Name, 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", formatQuantity(details[i].Quantity), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_unit_price$$", fmt.Sprintf("%.2f", details[i].Price), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_vat$$", fmt.Sprintf("%.2f", details[i].VatPercent), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_total$$", fmt.Sprintf("%.2f", details[i].TotalAmount), 1)
@@ -179,6 +289,7 @@ func reportSalesInvoice(id int, forcePrint bool, enterpriseId int32) []byte {
 	html = strings.Replace(html, "$$invoice_shipping_discount$$", fmt.Sprintf("%.2f", i.ShippingDiscount), 1)
 	html = strings.Replace(html, "$$invoice_total_with_discount$$", fmt.Sprintf("%.2f", i.TotalWithDiscount), 1)
 	html = strings.Replace(html, "$$invoice_total_amount$$", fmt.Sprintf("%.2f", i.TotalAmount), 1)
+	html = strings.Replace(html, "$$invoice_register_qr$$", getSalesInvoiceRegisterQrPayload(i.Id, enterpriseId), 1)
 	if forcePrint {
 		html = strings.Replace(html, "$$script$$", "window.print()", 1)
 	} else {
@@ -187,12 +298,19 @@ func reportSalesInvoice(id int, forcePrint bool, enterpriseId int32) []byte {
 
 	detailHtmlTemplate := html[strings.Index(html, "&&detail&&")+len("&&detail&&") : strings.Index(html, "&&--detail--&&")]
 	detailsHtml := ""
+	unitSymbols := getUnitOfMeasureSymbols(enterpriseId)
 
 	for i := 0; i < len(details); i++ {
 		detailHtml := detailHtmlTemplate
 
 		detailHtml = strings.Replace(detailHtml, "$$detail_product$$", details[i].Product.Name, 1)
-		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", strconv.Itoa(int(details[i].Quantity)), 1)
+		var lineUnitOfMeasureId *int32
+		var lineUnitFactor int32
+		if details[i].OrderDetail != nil {
+			lineUnitOfMeasureId = details[i].OrderDetail.UnitOfMeasureId
+			lineUnitFactor = details[i].OrderDetail.UnitFactor
+		}
+		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", formatReportQuantity(details[i].Quantity, details[i].Product, lineUnitOfMeasureId, lineUnitFactor, unitSymbols), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_unit_price$$", fmt.Sprintf("%.2f", details[i].Price), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_vat$$", fmt.Sprintf("%.2f", details[i].VatPercent), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_total$$", fmt.Sprintf("%.2f", details[i].TotalAmount), 1)
@@ -238,6 +356,7 @@ func reportSalesInvoiceTicket(id int, forcePrint bool, enterpriseId int32) []byt
 	html = strings.Replace(html, "$$invoice_shipping_discount$$", fmt.Sprintf("%.2f", i.ShippingDiscount), 1)
 	html = strings.Replace(html, "$$invoice_total_with_discount$$", fmt.Sprintf("%.2f", i.TotalWithDiscount), 1)
 	html = strings.Replace(html, "$$invoice_total_amount$$", fmt.Sprintf("%.2f", i.TotalAmount), 1)
+	html = strings.Replace(html, "$$invoice_register_qr$$", getSalesInvoiceRegisterQrPayload(i.Id, enterpriseId), 1)
 	if forcePrint {
 		html = strings.Replace(html, "$$script$$", "window.print()", 1)
 	} else {
@@ -246,12 +365,19 @@ func reportSalesInvoiceTicket(id int, forcePrint bool, enterpriseId int32) []byt
 
 	detailHtmlTemplate := html[strings.Index(html, "&&detail&&")+len("&&detail&&") : strings.Index(html, "&&--detail--&&")]
 	detailsHtml := ""
+	unitSymbols := getUnitOfMeasureSymbols(enterpriseId)
 
 	for i := 0; i < len(details); i++ {
 		detailHtml := detailHtmlTemplate
 
 		detailHtml = strings.Replace(detailHtml, "$$detail_product$$", details[i].Product.Name, 1)
-		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", strconv.Itoa(int(details[i].Quantity)), 1)
+		var lineUnitOfMeasureId *int32
+		var lineUnitFactor int32
+		if details[i].OrderDetail != nil {
+			lineUnitOfMeasureId = details[i].OrderDetail.UnitOfMeasureId
+			lineUnitFactor = details[i].OrderDetail.UnitFactor
+		}
+		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", formatReportQuantity(details[i].Quantity, details[i].Product, lineUnitOfMeasureId, lineUnitFactor, unitSymbols), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_unit_price$$", fmt.Sprintf("%.2f", details[i].Price), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_vat$$", fmt.Sprintf("%.2f", details[i].VatPercent), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_total$$", fmt.Sprintf("%.2f", details[i].TotalAmount), 1)
@@ -305,12 +431,33 @@ func reportSalesDeliveryNote(id int, forcePrint bool, enterpriseId int32) []byte
 
 	detailHtmlTemplate := html[strings.Index(html, "&&detail&&")+len("&&detail&&") : strings.Index(html, "&&--detail--&&")]
 	detailsHtml := ""
+	unitSymbols := getUnitOfMeasureSymbols(enterpriseId)
 
 	for i := 0; i < len(details); i++ {
 		detailHtml := detailHtmlTemplate
 
+		// units sent in this line
+		serialNumbersHtml := ""
+		if details[i].Product.TrackSerials {
+			serials := getWarehouseMovementSerials(details[i].Id, enterpriseId)
+			serialNumbers := make([]string, 0)
+			for j := 0; j < len(serials); j++ {
+				serialNumbers = append(serialNumbers, serials[j].SerialNumber)
+			}
+			if len(serialNumbers) > 0 {
+				serialNumbersHtml = "<br/><small>S/N: " + strings.Join(serialNumbers, ", ") + "</small>"
+			}
+		}
+
 		detailHtml = strings.Replace(detailHtml, "$$detail_product$$", details[i].Product.Name, 1)
-		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", strconv.Itoa(int(details[i].Quantity)), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_serial_numbers$$", serialNumbersHtml, 1)
+		var lineUnitOfMeasureId *int32
+		var lineUnitFactor int32
+		if details[i].SalesOrderDetail != nil {
+			lineUnitOfMeasureId = details[i].SalesOrderDetail.UnitOfMeasureId
+			lineUnitFactor = details[i].SalesOrderDetail.UnitFactor
+		}
+		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", formatReportQuantity(details[i].Quantity, &details[i].Product, lineUnitOfMeasureId, lineUnitFactor, unitSymbols), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_unit_price$$", fmt.Sprintf("%.2f", details[i].Price), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_vat$$", fmt.Sprintf("%.2f", details[i].VatPercent), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_total$$", fmt.Sprintf("%.2f", details[i].TotalAmount), 1)
@@ -318,6 +465,21 @@ func reportSalesDeliveryNote(id int, forcePrint bool, enterpriseId int32) []byte
 		detailsHtml += detailHtml
 	}
 
+	// details shipped by the supplier
+	dropShippingDetails := getDropShippingDeliveryNoteDetails(n.Id, enterpriseId)
+	for i := 0; i < len(dropShippingDetails); i++ {
+		detailHtml := detailHtmlTemplate
+
+		detailHtml = strings.Replace(detailHtml, "$$detail_product$$", dropShippingDetails[i].Product.Name, 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_serial_numbers$$", "", 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", formatReportQuantity(dropShippingDetails[i].Quantity, &dropShippingDetails[i].Product, dropShippingDetails[i].SalesOrderDetail.UnitOfMeasureId, dropShippingDetails[i].SalesOrderDetail.UnitFactor, unitSymbols), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_unit_price$$", fmt.Sprintf("%.2f", dropShippingDetails[i].Price), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_vat$$", fmt.Sprintf("%.2f", dropShippingDetails[i].VatPercent), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_total$$", fmt.Sprintf("%.2f", dropShippingDetails[i].TotalAmount), 1)
+
+		detailsHtml += detailHtml
+	}
+
 	html = html[:strings.Index(html, "&&detail&&")] + detailsHtml + html[strings.Index(html, "&&--detail--&&")+len("&&--detail--&&"):]
 
 	return []byte(html)
@@ -366,12 +528,13 @@ func reportPurchaseOrder(id int, forcePrint bool, enterpriseId int32) []byte {
 
 	detailHtmlTemplate := html[strings.Index(html, "&&detail&&")+len("&&detail&&") : strings.Index(html, "&&--detail--&&")]
 	detailsHtml := ""
+	unitSymbols := getUnitOfMeasureSymbols(enterpriseId)
 
 	for i := 0; i < len(details); i++ {
 		detailHtml := detailHtmlTemplate
 
 		detailHtml = strings.Replace(detailHtml, "$$detail_product$$", details[i].Product.Name, 1)
-		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", strconv.Itoa(int(details[i].Quantity)), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", formatReportQuantity(details[i].Quantity, &details[i].Product, details[i].UnitOfMeasureId, details[i].UnitFactor, unitSymbols), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_unit_price$$", fmt.Sprintf("%.2f", details[i].Price), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_vat$$", fmt.Sprintf("%.2f", details[i].VatPercent), 1)
 		detailHtml = strings.Replace(detailHtml, "$$detail_total$$", fmt.Sprintf("%.2f", details[i].TotalAmount), 1)
@@ -384,6 +547,68 @@ func reportPurchaseOrder(id int, forcePrint bool, enterpriseId int32) []byte {
 	return []byte(html)
 }
 
+func reportRequestForQuotation(id int, forcePrint bool, supplierId int32, enterpriseId int32) []byte {
+	request := getRequestForQuotationRow(int64(id))
+	if request.Id <= 0 || request.EnterpriseId != enterpriseId {
+		return nil
+	}
+	details := getRequestForQuotationDetails(request.Id, enterpriseId)
+
+	supplierName := ""
+	if supplierId > 0 {
+		supplier := getSupplierRow(supplierId)
+		if supplier.EnterpriseId == enterpriseId {
+			supplierName = supplier.Name
+		}
+	}
+	deadlineDate := ""
+	if request.DeadlineDate != nil {
+		deadlineDate = request.DeadlineDate.Format("2006-01-02")
+	}
+
+	template := getReportTemplate(enterpriseId, "REQUEST_FOR_QUOTATION")
+
+	html := template.Html
+
+	html = strings.Replace(html, "$$img_base64$$", getEnterpriseLogoBase64(enterpriseId), 1)
+	html = strings.Replace(html, "$$request_number$$", fmt.Sprintf("%06d", request.Id), 1)
+	html = strings.Replace(html, "$$request_date$$", request.DateCreated.Format("2006-01-02"), 1)
+	html = strings.Replace(html, "$$request_description$$", request.Description, 1)
+	html = strings.Replace(html, "$$request_deadline_date$$", deadlineDate, 1)
+	html = strings.Replace(html, "$$request_supplier_name$$", supplierName, 1)
+	html = strings.Replace(html, "$$request_notes$$", request.Notes, 1)
+	if forcePrint {
+		html = strings.Replace(html, "$$script$$", "window.print()", 1)
+	} else {
+		html = strings.Replace(html, "$$script$$", "", 1)
+	}
+
+	detailHtmlTemplate := html[strings.Index(html, "&&detail&&")+len("&&detail&&") : strings.Index(html, "&&--detail--&&")]
+	detailsHtml := ""
+
+	for i := 0; i < len(details); i++ {
+		detailHtml := detailHtmlTemplate
+
+		reference := details[i].Product.Reference
+		if supplierId > 0 {
+			productSupplier, ok := getProductSupplierRow(details[i].ProductId, supplierId, enterpriseId)
+			if ok && len(productSupplier.SupplierReference) > 0 {
+				reference = productSupplier.SupplierReference
+			}
+		}
+
+		detailHtml = strings.Replace(detailHtml, "$$detail_reference$$", reference, 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_product$$", details[i].Product.Name, 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", formatQuantity(details[i].Quantity), 1)
+
+		detailsHtml += detailHtml
+	}
+
+	html = html[:strings.Index(html, "&&detail&&")] + detailsHtml + html[strings.Index(html, "&&--detail--&&")+len("&&--detail--&&"):]
+
+	return []byte(html)
+}
+
 func reportBoxContent(id int, forcePrint bool, enterpriseId int32) []byte {
 	p := getPackagingRow(int64(id))
 	_package := getPackagesRow(p.PackageId)
@@ -411,7 +636,7 @@ func reportBoxContent(id int, forcePrint bool, enterpriseId int32) []byte {
 		p := getProductRow(getSalesOrderDetailRow(details[i].OrderDetailId).ProductId)
 
 		detailHtml = strings.Replace(detailHtml, "$$product_name$$", p.Name, 1)
-		detailHtml = strings.Replace(detailHtml, "$$product_quantity$$", strconv.Itoa(int(details[i].Quantity)), 1)
+		detailHtml = strings.Replace(detailHtml, "$$product_quantity$$", formatQuantity(details[i].Quantity), 1)
 
 		detailsHtml += detailHtml
 	}
@@ -456,7 +681,7 @@ func reportPalletContent(id int, forcePrint bool, enterpriseId int32) []byte {
 			p := getProductRow(getSalesOrderDetailRow(details[i].OrderDetailId).ProductId)
 
 			dPackagedHtml = strings.Replace(dPackagedHtml, "$$product_name$$", p.Name, 1)
-			dPackagedHtml = strings.Replace(dPackagedHtml, "$$product_quantity$$", strconv.Itoa(int(details[i].Quantity)), 1)
+			dPackagedHtml = strings.Replace(dPackagedHtml, "$$product_quantity$$", formatQuantity(details[i].Quantity), 1)
 
 			boxDetailsHtml += dPackagedHtml
 		}
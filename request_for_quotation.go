@@ -0,0 +1,977 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Status of the request for quotation
+const (
+	REQUEST_FOR_QUOTATION_DRAFT   = "D" // The lines and the suppliers can be changed
+	REQUEST_FOR_QUOTATION_SENT    = "S" // Sent to the suppliers, waiting for the replies
+	REQUEST_FOR_QUOTATION_AWARDED = "A" // Every line has been awarded to a supplier
+)
+
+// A request of prices and lead times for a list of products, sent to several suppliers before purchasing.
+// The replies of the suppliers are compared side by side, and each line is awarded to one supplier, creating the purchase orders.
+type RequestForQuotation struct {
+	Id           int64      `json:"id" gorm:"index:request_for_quotation_id_enterprise,unique:true,priority:1"`
+	DateCreated  time.Time  `json:"dateCreated" gorm:"type:timestamp(3) with time zone;not null:true;index:request_for_quotation_date_created,sort:desc"`
+	Description  string     `json:"description" gorm:"type:character varying(150);not null:true"`
+	Status       string     `json:"status" gorm:"type:character(1);not null:true"` // D = Draft, S = Sent, A = Awarded
+	WarehouseId  string     `json:"warehouseId" gorm:"column:warehouse;type:character(2);not null:true"`
+	Warehouse    Warehouse  `json:"warehouse" gorm:"foreignKey:WarehouseId,EnterpriseId;references:Id,EnterpriseId"`
+	DeadlineDate *time.Time `json:"deadlineDate" gorm:"type:timestamp(3) with time zone"` // The suppliers should reply before this date
+	DateSent     *time.Time `json:"dateSent" gorm:"type:timestamp(3) with time zone"`
+	Notes        string     `json:"notes" gorm:"type:character varying(250);not null:true"`
+	EnterpriseId int32      `json:"-" gorm:"column:enterprise;not null:true;index:request_for_quotation_id_enterprise,unique:true,priority:2"`
+	Enterprise   Settings   `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (r *RequestForQuotation) TableName() string {
+	return "request_for_quotation"
+}
+
+func getRequestsForQuotation(enterpriseId int32) []RequestForQuotation {
+	var requests []RequestForQuotation = make([]RequestForQuotation, 0)
+	result := dbOrm.Model(&RequestForQuotation{}).Where("enterprise = ?", enterpriseId).Order("date_created DESC").Preload(clause.Associations).Find(&requests)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return requests
+}
+
+func getRequestForQuotationRow(requestId int64) RequestForQuotation {
+	var request RequestForQuotation
+	result := dbOrm.Model(&RequestForQuotation{}).Where("id = ?", requestId).Preload(clause.Associations).First(&request)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return request
+}
+
+func (r *RequestForQuotation) isValid() bool {
+	return !(len(r.Description) == 0 || len(r.Description) > 150 || len(r.WarehouseId) == 0 || len(r.WarehouseId) > 2 || len(r.Notes) > 250)
+}
+
+func (r *RequestForQuotation) BeforeCreate(tx *gorm.DB) (err error) {
+	var request RequestForQuotation
+	tx.Model(&RequestForQuotation{}).Last(&request)
+	r.Id = request.Id + 1
+	return nil
+}
+
+func (r *RequestForQuotation) insertRequestForQuotation(userId int32, trans *gorm.DB) bool {
+	if len(r.WarehouseId) == 0 {
+		r.WarehouseId = getSettingsRecordById(r.EnterpriseId).DefaultWarehouseId
+	}
+	if !r.isValid() {
+		return false
+	}
+
+	r.DateCreated = time.Now()
+	r.Status = REQUEST_FOR_QUOTATION_DRAFT
+	r.DateSent = nil
+
+	if trans == nil {
+		trans = dbOrm
+	}
+	result := trans.Create(&r)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	insertTransactionalLog(r.EnterpriseId, "request_for_quotation", int(r.Id), userId, "I")
+	return true
+}
+
+func (r *RequestForQuotation) updateRequestForQuotation(userId int32) bool {
+	if r.Id <= 0 || !r.isValid() {
+		return false
+	}
+
+	var request RequestForQuotation
+	result := dbOrm.Where("id = ? AND enterprise = ?", r.Id, r.EnterpriseId).First(&request)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	if request.Status == REQUEST_FOR_QUOTATION_AWARDED {
+		return false
+	}
+
+	request.Description = r.Description
+	request.WarehouseId = r.WarehouseId
+	request.DeadlineDate = r.DeadlineDate
+	request.Notes = r.Notes
+
+	result = dbOrm.Save(&request)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	insertTransactionalLog(r.EnterpriseId, "request_for_quotation", int(r.Id), userId, "U")
+	return true
+}
+
+// The request can't be deleted once a line has been awarded, the purchase orders are already created.
+func (r *RequestForQuotation) deleteRequestForQuotation(userId int32) bool {
+	if r.Id <= 0 {
+		return false
+	}
+
+	var request RequestForQuotation
+	result := dbOrm.Where("id = ? AND enterprise = ?", r.Id, r.EnterpriseId).First(&request)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	var awardedLines int64
+	result = dbOrm.Model(&RequestForQuotationDetail{}).Where("request_for_quotation = ? AND enterprise = ? AND purchase_order_detail IS NOT NULL", r.Id, r.EnterpriseId).Count(&awardedLines)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	if awardedLines > 0 {
+		return false
+	}
+
+	///
+	trans := dbOrm.Begin()
+	///
+
+	result = trans.Where("request_for_quotation = ? AND enterprise = ?", r.Id, r.EnterpriseId).Delete(&RequestForQuotationReply{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("request_for_quotation = ? AND enterprise = ?", r.Id, r.EnterpriseId).Delete(&RequestForQuotationSupplier{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("request_for_quotation = ? AND enterprise = ?", r.Id, r.EnterpriseId).Delete(&RequestForQuotationDetail{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("id = ? AND enterprise = ?", r.Id, r.EnterpriseId).Delete(&RequestForQuotation{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return false
+	}
+	///
+
+	insertTransactionalLog(r.EnterpriseId, "request_for_quotation", int(r.Id), userId, "D")
+	return true
+}
+
+// A product and quantity to quote.
+type RequestForQuotationDetail struct {
+	Id                    int64                `json:"id" gorm:"index:request_for_quotation_detail_id_enterprise,unique:true,priority:1"`
+	RequestForQuotationId int64                `json:"requestForQuotationId" gorm:"column:request_for_quotation;not null:true;index:request_for_quotation_detail_request_product,unique:true,priority:2"`
+	RequestForQuotation   RequestForQuotation  `json:"-" gorm:"foreignKey:RequestForQuotationId,EnterpriseId;references:Id,EnterpriseId"`
+	ProductId             int32                `json:"productId" gorm:"column:product;not null:true;index:request_for_quotation_detail_request_product,unique:true,priority:3"`
+	Product               Product              `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	Quantity              float64              `json:"quantity" gorm:"type:numeric(14,6);not null:true"`
+	FromNeeds             bool                 `json:"fromNeeds" gorm:"not null:true"`                            // The pending sales order details of the product are linked to the purchase order when the line is awarded
+	PurchaseOrderDetailId *int64               `json:"purchaseOrderDetailId" gorm:"column:purchase_order_detail"` // Set when the line is awarded
+	PurchaseOrderDetail   *PurchaseOrderDetail `json:"-" gorm:"foreignKey:PurchaseOrderDetailId,EnterpriseId;references:Id,EnterpriseId"`
+	EnterpriseId          int32                `json:"-" gorm:"column:enterprise;not null:true;index:request_for_quotation_detail_id_enterprise,unique:true,priority:2;index:request_for_quotation_detail_request_product,unique:true,priority:1"`
+	Enterprise            Settings             `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (d *RequestForQuotationDetail) TableName() string {
+	return "request_for_quotation_detail"
+}
+
+func getRequestForQuotationDetails(requestId int64, enterpriseId int32) []RequestForQuotationDetail {
+	var details []RequestForQuotationDetail = make([]RequestForQuotationDetail, 0)
+	result := dbOrm.Model(&RequestForQuotationDetail{}).Where("request_for_quotation = ? AND enterprise = ?", requestId, enterpriseId).Order("id ASC").Preload("Product").Find(&details)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return details
+}
+
+func getRequestForQuotationDetailRow(detailId int64) RequestForQuotationDetail {
+	var detail RequestForQuotationDetail
+	result := dbOrm.Model(&RequestForQuotationDetail{}).Where("id = ?", detailId).Preload("Product").First(&detail)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return detail
+}
+
+func (d *RequestForQuotationDetail) isValid() bool {
+	return !(d.RequestForQuotationId <= 0 || d.ProductId <= 0 || d.Quantity <= 0)
+}
+
+func (d *RequestForQuotationDetail) BeforeCreate(tx *gorm.DB) (err error) {
+	var detail RequestForQuotationDetail
+	tx.Model(&RequestForQuotationDetail{}).Last(&detail)
+	d.Id = detail.Id + 1
+	return nil
+}
+
+// The lines can only be changed while the request is a draft.
+func (d *RequestForQuotationDetail) insertRequestForQuotationDetail(trans *gorm.DB) bool {
+	if !d.isValid() {
+		return false
+	}
+
+	if trans == nil {
+		trans = dbOrm
+	}
+	var request RequestForQuotation
+	result := trans.Where("id = ? AND enterprise = ?", d.RequestForQuotationId, d.EnterpriseId).First(&request)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	if request.Status != REQUEST_FOR_QUOTATION_DRAFT {
+		return false
+	}
+	product := getProductRow(d.ProductId)
+	if product.Id <= 0 || product.EnterpriseId != d.EnterpriseId || product.Manufacturing {
+		return false
+	}
+
+	d.PurchaseOrderDetailId = nil
+	result = trans.Create(&d)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+func (d *RequestForQuotationDetail) updateRequestForQuotationDetail() bool {
+	if d.Id <= 0 || d.Quantity <= 0 {
+		return false
+	}
+
+	detail := getRequestForQuotationDetailRow(d.Id)
+	if detail.Id <= 0 || detail.EnterpriseId != d.EnterpriseId {
+		return false
+	}
+	request := getRequestForQuotationRow(detail.RequestForQuotationId)
+	if request.Status != REQUEST_FOR_QUOTATION_DRAFT {
+		return false
+	}
+
+	result := dbOrm.Model(&RequestForQuotationDetail{}).Where("id = ? AND enterprise = ?", d.Id, d.EnterpriseId).Update("quantity", d.Quantity)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+func (d *RequestForQuotationDetail) deleteRequestForQuotationDetail() bool {
+	if d.Id <= 0 {
+		return false
+	}
+
+	detail := getRequestForQuotationDetailRow(d.Id)
+	if detail.Id <= 0 || detail.EnterpriseId != d.EnterpriseId {
+		return false
+	}
+	request := getRequestForQuotationRow(detail.RequestForQuotationId)
+	if request.Status != REQUEST_FOR_QUOTATION_DRAFT {
+		return false
+	}
+
+	///
+	trans := dbOrm.Begin()
+	///
+
+	result := trans.Where("request_for_quotation_detail = ? AND enterprise = ?", d.Id, d.EnterpriseId).Delete(&RequestForQuotationReply{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("id = ? AND enterprise = ?", d.Id, d.EnterpriseId).Delete(&RequestForQuotationDetail{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	///
+	result = trans.Commit()
+	return result.Error == nil
+	///
+}
+
+// A supplier the request for quotation is sent to.
+type RequestForQuotationSupplier struct {
+	EnterpriseId          int32               `json:"-" gorm:"primaryKey;column:enterprise;not null:true"`
+	Enterprise            Settings            `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+	RequestForQuotationId int64               `json:"requestForQuotationId" gorm:"primaryKey;column:request_for_quotation;not null:true"`
+	RequestForQuotation   RequestForQuotation `json:"-" gorm:"foreignKey:RequestForQuotationId,EnterpriseId;references:Id,EnterpriseId"`
+	SupplierId            int32               `json:"supplierId" gorm:"primaryKey;column:supplier;not null:true"`
+	Supplier              Supplier            `json:"supplier" gorm:"foreignKey:SupplierId,EnterpriseId;references:Id,EnterpriseId"`
+	EmailSent             bool                `json:"emailSent" gorm:"not null:true"`
+	DateSent              *time.Time          `json:"dateSent" gorm:"type:timestamp(3) with time zone"`
+}
+
+func (s *RequestForQuotationSupplier) TableName() string {
+	return "request_for_quotation_supplier"
+}
+
+func getRequestForQuotationSuppliers(requestId int64, enterpriseId int32) []RequestForQuotationSupplier {
+	var suppliers []RequestForQuotationSupplier = make([]RequestForQuotationSupplier, 0)
+	result := dbOrm.Model(&RequestForQuotationSupplier{}).Where("request_for_quotation = ? AND enterprise = ?", requestId, enterpriseId).Order("supplier ASC").Preload(clause.Associations).Find(&suppliers)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return suppliers
+}
+
+// Suppliers can be added after the request has been sent, they will receive the email the next time the request is sent.
+func (s *RequestForQuotationSupplier) insertRequestForQuotationSupplier(trans *gorm.DB) bool {
+	if s.RequestForQuotationId <= 0 || s.SupplierId <= 0 {
+		return false
+	}
+
+	if trans == nil {
+		trans = dbOrm
+	}
+	var request RequestForQuotation
+	result := trans.Where("id = ? AND enterprise = ?", s.RequestForQuotationId, s.EnterpriseId).First(&request)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	if request.Status == REQUEST_FOR_QUOTATION_AWARDED {
+		return false
+	}
+	supplier := getSupplierRow(s.SupplierId)
+	if supplier.Id <= 0 || supplier.EnterpriseId != s.EnterpriseId {
+		return false
+	}
+
+	s.EmailSent = false
+	s.DateSent = nil
+	result = trans.Create(&s)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+func (s *RequestForQuotationSupplier) deleteRequestForQuotationSupplier() bool {
+	if s.RequestForQuotationId <= 0 || s.SupplierId <= 0 {
+		return false
+	}
+
+	request := getRequestForQuotationRow(s.RequestForQuotationId)
+	if request.Id <= 0 || request.EnterpriseId != s.EnterpriseId || request.Status == REQUEST_FOR_QUOTATION_AWARDED {
+		return false
+	}
+
+	var awardedReplies int64
+	result := dbOrm.Model(&RequestForQuotationReply{}).Where("request_for_quotation = ? AND supplier = ? AND enterprise = ? AND awarded", s.RequestForQuotationId, s.SupplierId, s.EnterpriseId).Count(&awardedReplies)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	if awardedReplies > 0 {
+		return false
+	}
+
+	///
+	trans := dbOrm.Begin()
+	///
+
+	result = trans.Where("request_for_quotation = ? AND supplier = ? AND enterprise = ?", s.RequestForQuotationId, s.SupplierId, s.EnterpriseId).Delete(&RequestForQuotationReply{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("request_for_quotation = ? AND supplier = ? AND enterprise = ?", s.RequestForQuotationId, s.SupplierId, s.EnterpriseId).Delete(&RequestForQuotationSupplier{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	///
+	result = trans.Commit()
+	return result.Error == nil
+	///
+}
+
+// The price and lead time quoted by a supplier for a line of the request.
+// The price is in the currency of the supplier, the same used in the purchase orders of the supplier.
+type RequestForQuotationReply struct {
+	EnterpriseId                int32                     `json:"-" gorm:"primaryKey;column:enterprise;not null:true"`
+	Enterprise                  Settings                  `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+	RequestForQuotationDetailId int64                     `json:"requestForQuotationDetailId" gorm:"primaryKey;column:request_for_quotation_detail;not null:true"`
+	RequestForQuotationDetail   RequestForQuotationDetail `json:"-" gorm:"foreignKey:RequestForQuotationDetailId,EnterpriseId;references:Id,EnterpriseId"`
+	SupplierId                  int32                     `json:"supplierId" gorm:"primaryKey;column:supplier;not null:true"`
+	Supplier                    Supplier                  `json:"-" gorm:"foreignKey:SupplierId,EnterpriseId;references:Id,EnterpriseId"`
+	RequestForQuotationId       int64                     `json:"requestForQuotationId" gorm:"column:request_for_quotation;not null:true;index:request_for_quotation_reply_request_for_quotation"`
+	RequestForQuotation         RequestForQuotation       `json:"-" gorm:"foreignKey:RequestForQuotationId,EnterpriseId;references:Id,EnterpriseId"`
+	Price                       float64                   `json:"price" gorm:"type:numeric(14,6);not null:true"`
+	LeadTimeDays                int16                     `json:"leadTimeDays" gorm:"not null:true"`
+	DateReply                   time.Time                 `json:"dateReply" gorm:"type:timestamp(3) with time zone;not null:true"`
+	Awarded                     bool                      `json:"awarded" gorm:"not null:true"`
+}
+
+func (r *RequestForQuotationReply) TableName() string {
+	return "request_for_quotation_reply"
+}
+
+func getRequestForQuotationReplies(requestId int64, enterpriseId int32) []RequestForQuotationReply {
+	var replies []RequestForQuotationReply = make([]RequestForQuotationReply, 0)
+	result := dbOrm.Model(&RequestForQuotationReply{}).Where("request_for_quotation = ? AND enterprise = ?", requestId, enterpriseId).Order("request_for_quotation_detail ASC, supplier ASC").Find(&replies)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return replies
+}
+
+func (r *RequestForQuotationReply) isValid() bool {
+	return !(r.RequestForQuotationDetailId <= 0 || r.SupplierId <= 0 || r.Price < 0 || r.LeadTimeDays < 0)
+}
+
+// Enters the reply of a supplier for a line, or replaces the previous one if the line has not been awarded.
+func (r *RequestForQuotationReply) setRequestForQuotationReply() bool {
+	if !r.isValid() {
+		return false
+	}
+
+	detail := getRequestForQuotationDetailRow(r.RequestForQuotationDetailId)
+	if detail.Id <= 0 || detail.EnterpriseId != r.EnterpriseId || detail.PurchaseOrderDetailId != nil {
+		return false
+	}
+	var invitedSuppliers int64
+	result := dbOrm.Model(&RequestForQuotationSupplier{}).Where("request_for_quotation = ? AND supplier = ? AND enterprise = ?", detail.RequestForQuotationId, r.SupplierId, r.EnterpriseId).Count(&invitedSuppliers)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	if invitedSuppliers == 0 {
+		return false
+	}
+
+	r.RequestForQuotationId = detail.RequestForQuotationId
+	r.DateReply = time.Now()
+	r.Awarded = false
+
+	result = dbOrm.Save(&r)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+func (r *RequestForQuotationReply) deleteRequestForQuotationReply() bool {
+	if r.RequestForQuotationDetailId <= 0 || r.SupplierId <= 0 {
+		return false
+	}
+
+	result := dbOrm.Where("request_for_quotation_detail = ? AND supplier = ? AND enterprise = ? AND NOT awarded", r.RequestForQuotationDetailId, r.SupplierId, r.EnterpriseId).Delete(&RequestForQuotationReply{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+type RequestForQuotationFromNeeds struct {
+	Description string         `json:"description"`
+	WarehouseId string         `json:"warehouseId"`
+	Needs       []PurchaseNeed `json:"needs"`     // Empty = every product in the needs
+	Suppliers   []int32        `json:"suppliers"` // Empty = the suppliers of the products
+}
+
+type OkAndErrorRequestForQuotationFromNeeds struct {
+	OkAndErrorCodeReturn
+	RequestForQuotation *RequestForQuotation `json:"requestForQuotation"`
+}
+
+// Creates a request for quotation with the products pending of purchase.
+// If no suppliers are specified, the request is sent to the supplier of each product and to the suppliers in the product-supplier table.
+// ERROR CODES:
+// 1. There are no needs to quote
+// 2. A product is a manufacturing product, or the quantity is not valid
+// 3. There are no suppliers to send the request to
+func (n *RequestForQuotationFromNeeds) createRequestForQuotationFromNeeds(enterpriseId int32, userId int32) OkAndErrorRequestForQuotationFromNeeds {
+	needs := n.Needs
+	if len(needs) == 0 {
+		pendingNeeds := getNeeds(enterpriseId)
+		for i := 0; i < len(pendingNeeds); i++ {
+			needs = append(needs, PurchaseNeed{ProductId: pendingNeeds[i].Product, Quantity: pendingNeeds[i].Quantity})
+		}
+	}
+	if len(needs) == 0 {
+		return OkAndErrorRequestForQuotationFromNeeds{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}}
+	}
+
+	suppliers := n.Suppliers
+	for i := 0; i < len(needs); i++ {
+		product := getProductRow(needs[i].ProductId)
+		if product.Id <= 0 || product.EnterpriseId != enterpriseId {
+			return OkAndErrorRequestForQuotationFromNeeds{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+		}
+		if product.Manufacturing || needs[i].Quantity <= 0 {
+			return OkAndErrorRequestForQuotationFromNeeds{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}}
+		}
+		needs[i].product = product
+
+		if len(n.Suppliers) == 0 {
+			if product.SupplierId != nil {
+				suppliers = appendRequestForQuotationSupplier(suppliers, *product.SupplierId)
+			}
+			productSuppliers := getProductSuppliers(product.Id, enterpriseId)
+			for j := 0; j < len(productSuppliers); j++ {
+				suppliers = appendRequestForQuotationSupplier(suppliers, productSuppliers[j].SupplierId)
+			}
+		}
+	}
+	if len(suppliers) == 0 {
+		return OkAndErrorRequestForQuotationFromNeeds{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}}
+	}
+
+	description := n.Description
+	if len(description) == 0 {
+		description = "Needs " + time.Now().Format("2006-01-02")
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorRequestForQuotationFromNeeds{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+	}
+	///
+
+	r := RequestForQuotation{Description: description, WarehouseId: n.WarehouseId, EnterpriseId: enterpriseId}
+	if !r.insertRequestForQuotation(userId, trans) {
+		trans.Rollback()
+		return OkAndErrorRequestForQuotationFromNeeds{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+	}
+
+	for i := 0; i < len(needs); i++ {
+		d := RequestForQuotationDetail{RequestForQuotationId: r.Id, ProductId: needs[i].ProductId, Quantity: needs[i].Quantity, FromNeeds: true, EnterpriseId: enterpriseId}
+		if !d.insertRequestForQuotationDetail(trans) {
+			trans.Rollback()
+			return OkAndErrorRequestForQuotationFromNeeds{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+		}
+	}
+
+	for i := 0; i < len(suppliers); i++ {
+		s := RequestForQuotationSupplier{RequestForQuotationId: r.Id, SupplierId: suppliers[i], EnterpriseId: enterpriseId}
+		if !s.insertRequestForQuotationSupplier(trans) {
+			trans.Rollback()
+			return OkAndErrorRequestForQuotationFromNeeds{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+		}
+	}
+
+	///
+	result := trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorRequestForQuotationFromNeeds{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+	}
+	///
+
+	request := getRequestForQuotationRow(r.Id)
+	return OkAndErrorRequestForQuotationFromNeeds{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: true}, RequestForQuotation: &request}
+}
+
+func appendRequestForQuotationSupplier(suppliers []int32, supplierId int32) []int32 {
+	for i := 0; i < len(suppliers); i++ {
+		if suppliers[i] == supplierId {
+			return suppliers
+		}
+	}
+	return append(suppliers, supplierId)
+}
+
+// Sends the request by email to the suppliers that have not received it yet.
+// ERROR CODES:
+// 1. The request has no lines
+// 2. The request has no suppliers
+// 3. The request has already been awarded
+// 4. The email could not be sent to some suppliers (the names of the suppliers are in the extra data)
+func sendRequestForQuotation(requestId int64, enterpriseId int32, userId int32) OkAndErrorCodeReturn {
+	request := getRequestForQuotationRow(requestId)
+	if request.Id <= 0 || request.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if request.Status == REQUEST_FOR_QUOTATION_AWARDED {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+	if len(getRequestForQuotationDetails(requestId, enterpriseId)) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+	suppliers := getRequestForQuotationSuppliers(requestId, enterpriseId)
+	if len(suppliers) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+
+	notSent := make([]string, 0)
+	for i := 0; i < len(suppliers); i++ {
+		if suppliers[i].EmailSent {
+			continue
+		}
+		if len(suppliers[i].Supplier.Email) == 0 {
+			notSent = append(notSent, suppliers[i].Supplier.Name)
+			continue
+		}
+
+		report := reportRequestForQuotation(int(requestId), false, suppliers[i].SupplierId, enterpriseId)
+		if !sendEmail(suppliers[i].Supplier.Email, suppliers[i].Supplier.Name, "Request for quotation: "+request.Description, string(report), enterpriseId) {
+			notSent = append(notSent, suppliers[i].Supplier.Name)
+			continue
+		}
+
+		now := time.Now()
+		result := dbOrm.Model(&RequestForQuotationSupplier{}).Where("request_for_quotation = ? AND supplier = ? AND enterprise = ?", requestId, suppliers[i].SupplierId, enterpriseId).Updates(map[string]interface{}{
+			"email_sent": true,
+			"date_sent":  now,
+		})
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+	}
+
+	if request.Status == REQUEST_FOR_QUOTATION_DRAFT && len(notSent) < len(suppliers) {
+		now := time.Now()
+		result := dbOrm.Model(&RequestForQuotation{}).Where("id = ? AND enterprise = ?", requestId, enterpriseId).Updates(map[string]interface{}{
+			"status":    REQUEST_FOR_QUOTATION_SENT,
+			"date_sent": now,
+		})
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		insertTransactionalLog(enterpriseId, "request_for_quotation", int(requestId), userId, "U")
+	}
+
+	if len(notSent) > 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4, ExtraData: notSent}
+	}
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+type RequestForQuotationComparison struct {
+	Suppliers []RequestForQuotationSupplier       `json:"suppliers"`
+	Lines     []RequestForQuotationComparisonLine `json:"lines"`
+}
+
+// A line of the request with the replies of the suppliers, in the same order as the suppliers of the comparison.
+// The supplier that has not replied has a nil reply.
+type RequestForQuotationComparisonLine struct {
+	Detail                     RequestForQuotationDetail   `json:"detail"`
+	Replies                    []*RequestForQuotationReply `json:"replies"`
+	CheapestSupplierId         *int32                      `json:"cheapestSupplierId"`
+	ShortestLeadTimeSupplierId *int32                      `json:"shortestLeadTimeSupplierId"`
+	TotalAmount                []float64                   `json:"totalAmount"` // Price * quantity of each reply, in the same order as the replies
+}
+
+// Returns the replies of the suppliers to each line of the request side by side.
+func getRequestForQuotationComparison(requestId int64, enterpriseId int32) RequestForQuotationComparison {
+	suppliers := getRequestForQuotationSuppliers(requestId, enterpriseId)
+	details := getRequestForQuotationDetails(requestId, enterpriseId)
+	replies := getRequestForQuotationReplies(requestId, enterpriseId)
+
+	exchange := make([]float64, len(suppliers))
+	for i := 0; i < len(suppliers); i++ {
+		exchange[i] = 1
+		currencyId := getSupplierDefaults(suppliers[i].SupplierId, enterpriseId).Currency
+		if currencyId != nil {
+			exchange[i] = getCurrencyExchange(*currencyId)
+		}
+	}
+	return compareRequestForQuotationReplies(suppliers, exchange, details, replies)
+}
+
+// The prices are compared in euros, using the exchange rate of the currency of each supplier.
+// When two suppliers quote the same price, the one with the shortest lead time is the cheapest, and the other way around.
+func compareRequestForQuotationReplies(suppliers []RequestForQuotationSupplier, exchange []float64, details []RequestForQuotationDetail, replies []RequestForQuotationReply) RequestForQuotationComparison {
+	comparison := RequestForQuotationComparison{Suppliers: suppliers, Lines: make([]RequestForQuotationComparisonLine, 0)}
+
+	for i := 0; i < len(details); i++ {
+		line := RequestForQuotationComparisonLine{Detail: details[i], Replies: make([]*RequestForQuotationReply, len(suppliers)), TotalAmount: make([]float64, len(suppliers))}
+		prices := make([]float64, len(suppliers)) // price in euros of each reply
+		var cheapest, fastest int = -1, -1
+		for j := 0; j < len(suppliers); j++ {
+			for k := 0; k < len(replies); k++ {
+				if replies[k].RequestForQuotationDetailId == details[i].Id && replies[k].SupplierId == suppliers[j].SupplierId {
+					line.Replies[j] = &replies[k]
+					break
+				}
+			}
+			reply := line.Replies[j]
+			if reply == nil {
+				continue
+			}
+			line.TotalAmount[j] = toFixed(reply.Price*float64(details[i].Quantity), 2)
+			prices[j] = reply.Price
+			if exchange[j] > 0 {
+				prices[j] = reply.Price / exchange[j]
+			}
+
+			if cheapest < 0 {
+				cheapest = j
+				fastest = j
+				continue
+			}
+			if prices[j] < prices[cheapest] || (prices[j] == prices[cheapest] && reply.LeadTimeDays < line.Replies[cheapest].LeadTimeDays) {
+				cheapest = j
+			}
+			if reply.LeadTimeDays < line.Replies[fastest].LeadTimeDays || (reply.LeadTimeDays == line.Replies[fastest].LeadTimeDays && prices[j] < prices[fastest]) {
+				fastest = j
+			}
+		}
+		if cheapest >= 0 {
+			line.CheapestSupplierId = &suppliers[cheapest].SupplierId
+			line.ShortestLeadTimeSupplierId = &suppliers[fastest].SupplierId
+		}
+		comparison.Lines = append(comparison.Lines, line)
+	}
+
+	return comparison
+}
+
+type RequestForQuotationAward struct {
+	RequestForQuotationId int64                          `json:"requestForQuotationId"`
+	Lines                 []RequestForQuotationAwardLine `json:"lines"`
+}
+
+type RequestForQuotationAwardLine struct {
+	RequestForQuotationDetailId int64 `json:"requestForQuotationDetailId"`
+	SupplierId                  int32 `json:"supplierId"`
+	reply                       RequestForQuotationReply
+	detail                      RequestForQuotationDetail
+}
+
+type RequestForQuotationAwardLines []RequestForQuotationAwardLine
+
+func (l RequestForQuotationAwardLines) Len() int {
+	return len(l)
+}
+func (l RequestForQuotationAwardLines) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+func (l RequestForQuotationAwardLines) Less(i, j int) bool {
+	return l[i].SupplierId < l[j].SupplierId
+}
+
+type OkAndErrorAwardRequestForQuotation struct {
+	OkAndErrorCodeReturn
+	PurchaseOrders []int64 `json:"purchaseOrders"` // IDs of the purchase orders created
+}
+
+// Awards the lines to the suppliers, creating one purchase order for each winning supplier with the price quoted in the reply.
+// ERROR CODES:
+// 1. No lines selected
+// 2. The line is already awarded
+// 3. The supplier has not replied to the line
+// 5. The supplier does not have a main billing address
+// 6. The supplier does not have a main shipping address
+// 7. The supplier does not have a payment method
+// 8. The supplier does not have a billing series
+// 9. The purchase order detail could not be created (the product is deactivated)
+func (a *RequestForQuotationAward) awardRequestForQuotation(enterpriseId int32, userId int32) OkAndErrorAwardRequestForQuotation {
+	lines := a.Lines
+	if len(lines) == 0 {
+		return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}}
+	}
+	request := getRequestForQuotationRow(a.RequestForQuotationId)
+	if request.Id <= 0 || request.EnterpriseId != enterpriseId {
+		return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		detail := getRequestForQuotationDetailRow(lines[i].RequestForQuotationDetailId)
+		if detail.Id <= 0 || detail.EnterpriseId != enterpriseId || detail.RequestForQuotationId != request.Id {
+			return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+		}
+		if detail.PurchaseOrderDetailId != nil {
+			return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false, ErrorCode: 2, ExtraData: []string{detail.Product.Name}}}
+		}
+		var reply RequestForQuotationReply
+		result := dbOrm.Model(&RequestForQuotationReply{}).Where("request_for_quotation_detail = ? AND supplier = ? AND enterprise = ?", detail.Id, lines[i].SupplierId, enterpriseId).Limit(1).Find(&reply)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+		}
+		if result.RowsAffected == 0 {
+			return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false, ErrorCode: 3, ExtraData: []string{detail.Product.Name}}}
+		}
+		lines[i].detail = detail
+		lines[i].reply = reply
+	}
+
+	sort.Sort(RequestForQuotationAwardLines(lines))
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+	}
+	///
+
+	orders := make([]int64, 0)
+	var order PurchaseOrder
+	for i := 0; i < len(lines); i++ {
+		// create a purchase order each time the supplier changes
+		if i == 0 || lines[i].SupplierId != lines[i-1].SupplierId {
+			supplier := getSupplierRow(lines[i].SupplierId)
+			if supplier.Id <= 0 || supplier.EnterpriseId != enterpriseId {
+				trans.Rollback()
+				return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+			}
+			if supplier.MainBillingAddressId == nil {
+				trans.Rollback()
+				return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false, ErrorCode: 5, ExtraData: []string{supplier.Name}}}
+			}
+			if supplier.MainShippingAddressId == nil {
+				trans.Rollback()
+				return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false, ErrorCode: 6, ExtraData: []string{supplier.Name}}}
+			}
+			if supplier.PaymentMethodId == nil {
+				trans.Rollback()
+				return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false, ErrorCode: 7, ExtraData: []string{supplier.Name}}}
+			}
+			if supplier.BillingSeriesId == nil {
+				trans.Rollback()
+				return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false, ErrorCode: 8, ExtraData: []string{supplier.Name}}}
+			}
+
+			order = PurchaseOrder{}
+			order.SupplierId = supplier.Id
+			order.BillingAddressId = *supplier.MainBillingAddressId
+			order.ShippingAddressId = *supplier.MainShippingAddressId
+			order.PaymentMethodId = *supplier.PaymentMethodId
+			order.BillingSeriesId = *supplier.BillingSeriesId
+			order.CurrencyId = *getSupplierDefaults(supplier.Id, enterpriseId).Currency
+			order.Notes = request.Description
+			order.EnterpriseId = enterpriseId
+			ok, orderId := order.insertPurchaseOrder(userId, trans)
+			if !ok || orderId <= 0 {
+				trans.Rollback()
+				return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+			}
+			orders = append(orders, orderId)
+		}
+
+		d := PurchaseOrderDetail{}
+		d.OrderId = order.Id
+		d.ProductId = lines[i].detail.ProductId
+		d.Price = lines[i].reply.Price
+		d.Quantity = lines[i].detail.Quantity
+		d.VatPercent = lines[i].detail.Product.VatPercent
+		d.WarehouseId = request.WarehouseId
+		if lines[i].reply.LeadTimeDays > 0 {
+			datePromised := time.Now().AddDate(0, 0, int(lines[i].reply.LeadTimeDays))
+			d.DatePromised = &datePromised
+		}
+		d.EnterpriseId = enterpriseId
+		ok, detailId := d.insertPurchaseOrderDetail(userId, trans)
+		if !ok.Ok {
+			trans.Rollback()
+			return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false, ErrorCode: 9, ExtraData: []string{lines[i].detail.Product.Name}}}
+		}
+
+		result := trans.Model(&RequestForQuotationDetail{}).Where("id = ? AND enterprise = ?", lines[i].detail.Id, enterpriseId).Update("purchase_order_detail", detailId)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+		}
+		result = trans.Model(&RequestForQuotationReply{}).Where("request_for_quotation_detail = ? AND supplier = ? AND enterprise = ?", lines[i].detail.Id, lines[i].SupplierId, enterpriseId).Update("awarded", true)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+		}
+
+		if !lines[i].detail.FromNeeds {
+			continue
+		}
+		// advance the status to "Purchase order pending" of the pending sales order details
+		details := getSalesOrderDetailWaitingForPurchaseOrder(lines[i].detail.ProductId)
+		for k := 0; k < len(details); k++ {
+			sqlStatement := `UPDATE sales_order_detail SET status='B',purchase_order_detail=$2 WHERE id=$1`
+			_, err := db.Exec(sqlStatement, details[k].Id, detailId)
+			if err != nil {
+				log("DB", err.Error())
+				trans.Rollback()
+				return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+			}
+			ok := setSalesOrderState(enterpriseId, details[k].OrderId, userId, *trans)
+			if !ok {
+				trans.Rollback()
+				return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+			}
+		}
+	}
+
+	// the request is awarded when every line has a purchase order
+	var pendingLines int64
+	result := trans.Model(&RequestForQuotationDetail{}).Where("request_for_quotation = ? AND enterprise = ? AND purchase_order_detail IS NULL", request.Id, enterpriseId).Count(&pendingLines)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+	}
+	if pendingLines == 0 {
+		result = trans.Model(&RequestForQuotation{}).Where("id = ? AND enterprise = ?", request.Id, enterpriseId).Update("status", REQUEST_FOR_QUOTATION_AWARDED)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+		}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: false}}
+	}
+	///
+
+	insertTransactionalLog(enterpriseId, "request_for_quotation", int(request.Id), userId, "U")
+	return OkAndErrorAwardRequestForQuotation{OkAndErrorCodeReturn: OkAndErrorCodeReturn{Ok: true}, PurchaseOrders: orders}
+}
@@ -0,0 +1,261 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SalesAgent struct {
+	Id                int32     `json:"id" gorm:"index:sales_agent_id_enterprise,unique:true,priority:1"`
+	Name              string    `json:"name" gorm:"type:character varying(150);not null:true"`
+	Email             string    `json:"email" gorm:"type:character varying(100);not null:true"`
+	Phone             string    `json:"phone" gorm:"type:character varying(25);not null:true"`
+	CommissionPercent float64   `json:"commissionPercent" gorm:"type:numeric(14,6);not null:true"` // Commission over the invoiced amount when there is no rule for the customer or the product family
+	SupplierId        *int32    `json:"supplierId" gorm:"column:supplier"`                         // The agent invoices us as this supplier
+	Supplier          *Supplier `json:"supplier" gorm:"foreignKey:SupplierId,EnterpriseId;references:Id,EnterpriseId"`
+	Off               bool      `json:"off" gorm:"not null:true"`
+	EnterpriseId      int32     `json:"-" gorm:"column:enterprise;not null:true;index:sales_agent_id_enterprise,unique:true,priority:2"`
+	Enterprise        Settings  `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (a *SalesAgent) TableName() string {
+	return "sales_agent"
+}
+
+func getSalesAgents(enterpriseId int32) []SalesAgent {
+	var agents []SalesAgent = make([]SalesAgent, 0)
+	result := dbOrm.Model(&SalesAgent{}).Where("enterprise = ?", enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&agents)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return agents
+}
+
+func getSalesAgentRow(salesAgentId int32) SalesAgent {
+	a := SalesAgent{}
+	result := dbOrm.Model(&SalesAgent{}).Where("id = ?", salesAgentId).Preload(clause.Associations).First(&a)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return a
+}
+
+func (a *SalesAgent) isValid() bool {
+	return !(len(a.Name) == 0 || len(a.Name) > 150 || len(a.Email) > 100 || (len(a.Email) > 0 && !emailIsValid(a.Email)) || len(a.Phone) > 25 || (len(a.Phone) > 0 && !phoneIsValid(a.Phone)) || a.CommissionPercent < 0 || a.CommissionPercent > 100)
+}
+
+func (a *SalesAgent) BeforeCreate(tx *gorm.DB) (err error) {
+	var salesAgent SalesAgent
+	tx.Model(&SalesAgent{}).Last(&salesAgent)
+	a.Id = salesAgent.Id + 1
+	return nil
+}
+
+func (a *SalesAgent) insertSalesAgent() bool {
+	if !a.isValid() {
+		return false
+	}
+
+	result := dbOrm.Create(&a)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (a *SalesAgent) updateSalesAgent() bool {
+	if a.Id <= 0 || !a.isValid() {
+		return false
+	}
+
+	var salesAgent SalesAgent
+	result := dbOrm.Where("id = ? AND enterprise = ?", a.Id, a.EnterpriseId).First(&salesAgent)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	salesAgent.Name = a.Name
+	salesAgent.Email = a.Email
+	salesAgent.Phone = a.Phone
+	salesAgent.CommissionPercent = a.CommissionPercent
+	salesAgent.SupplierId = a.SupplierId
+	salesAgent.Off = a.Off
+
+	result = dbOrm.Save(&salesAgent)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (a *SalesAgent) deleteSalesAgent() bool {
+	if a.Id <= 0 {
+		return false
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return false
+	}
+	///
+
+	result := trans.Where("sales_agent = ? AND enterprise = ?", a.Id, a.EnterpriseId).Delete(&SalesAgentCommissionRule{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("id = ? AND enterprise = ?", a.Id, a.EnterpriseId).Delete(&SalesAgent{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return false
+	}
+	///
+
+	return true
+}
+
+// A commission rule overrides the default commission of the agent for a customer, a product family, or both.
+// The most specific rule is applied: customer and product family, then customer, then product family.
+type SalesAgentCommissionRule struct {
+	Id                int32          `json:"id" gorm:"index:sales_agent_commission_rule_id_enterprise,unique:true,priority:1"`
+	SalesAgentId      int32          `json:"salesAgentId" gorm:"column:sales_agent;not null:true;index:sales_agent_commission_rule_sales_agent"`
+	SalesAgent        SalesAgent     `json:"-" gorm:"foreignKey:SalesAgentId,EnterpriseId;references:Id,EnterpriseId"`
+	CustomerId        *int32         `json:"customerId" gorm:"column:customer"`
+	Customer          *Customer      `json:"customer" gorm:"foreignKey:CustomerId,EnterpriseId;references:Id,EnterpriseId"`
+	ProductFamilyId   *int32         `json:"productFamilyId" gorm:"column:product_family"`
+	ProductFamily     *ProductFamily `json:"productFamily" gorm:"foreignKey:ProductFamilyId,EnterpriseId;references:Id,EnterpriseId"`
+	Base              string         `json:"base" gorm:"type:character(1);not null:true"` // S = Percentage of the invoiced amount, M = Percentage of the margin
+	CommissionPercent float64        `json:"commissionPercent" gorm:"type:numeric(14,6);not null:true"`
+	EnterpriseId      int32          `json:"-" gorm:"column:enterprise;not null:true;index:sales_agent_commission_rule_id_enterprise,unique:true,priority:2"`
+	Enterprise        Settings       `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (r *SalesAgentCommissionRule) TableName() string {
+	return "sales_agent_commission_rule"
+}
+
+func getSalesAgentCommissionRules(salesAgentId int32, enterpriseId int32) []SalesAgentCommissionRule {
+	var rules []SalesAgentCommissionRule = make([]SalesAgentCommissionRule, 0)
+	result := dbOrm.Model(&SalesAgentCommissionRule{}).Where("sales_agent = ? AND enterprise = ?", salesAgentId, enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&rules)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return rules
+}
+
+func (r *SalesAgentCommissionRule) isValid() bool {
+	return !(r.SalesAgentId <= 0 || (r.Base != "S" && r.Base != "M") || r.CommissionPercent < 0 || r.CommissionPercent > 100 || (r.CustomerId == nil && r.ProductFamilyId == nil))
+}
+
+func (r *SalesAgentCommissionRule) BeforeCreate(tx *gorm.DB) (err error) {
+	var salesAgentCommissionRule SalesAgentCommissionRule
+	tx.Model(&SalesAgentCommissionRule{}).Last(&salesAgentCommissionRule)
+	r.Id = salesAgentCommissionRule.Id + 1
+	return nil
+}
+
+func (r *SalesAgentCommissionRule) insertSalesAgentCommissionRule() bool {
+	if !r.isValid() {
+		return false
+	}
+
+	result := dbOrm.Create(&r)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (r *SalesAgentCommissionRule) updateSalesAgentCommissionRule() bool {
+	if r.Id <= 0 || !r.isValid() {
+		return false
+	}
+
+	var rule SalesAgentCommissionRule
+	result := dbOrm.Where("id = ? AND enterprise = ?", r.Id, r.EnterpriseId).First(&rule)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	rule.CustomerId = r.CustomerId
+	rule.ProductFamilyId = r.ProductFamilyId
+	rule.Base = r.Base
+	rule.CommissionPercent = r.CommissionPercent
+
+	result = dbOrm.Save(&rule)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (r *SalesAgentCommissionRule) deleteSalesAgentCommissionRule() bool {
+	if r.Id <= 0 {
+		return false
+	}
+
+	result := dbOrm.Where("id = ? AND enterprise = ?", r.Id, r.EnterpriseId).Delete(&SalesAgentCommissionRule{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+// Returns the base (S = invoiced amount, M = margin) and the percentage of the commission of the agent for a customer and a product family.
+func getSalesAgentCommission(agent SalesAgent, rules []SalesAgentCommissionRule, customerId int32, productFamilyId *int32) (string, float64) {
+	var customerRule *SalesAgentCommissionRule
+	var familyRule *SalesAgentCommissionRule
+	for i := 0; i < len(rules); i++ {
+		rule := rules[i]
+		customerMatches := rule.CustomerId != nil && *rule.CustomerId == customerId
+		familyMatches := rule.ProductFamilyId != nil && productFamilyId != nil && *rule.ProductFamilyId == *productFamilyId
+
+		if customerMatches && familyMatches {
+			return rule.Base, rule.CommissionPercent
+		} else if customerMatches && rule.ProductFamilyId == nil && customerRule == nil {
+			customerRule = &rules[i]
+		} else if familyMatches && rule.CustomerId == nil && familyRule == nil {
+			familyRule = &rules[i]
+		}
+	}
+
+	if customerRule != nil {
+		return customerRule.Base, customerRule.CommissionPercent
+	}
+	if familyRule != nil {
+		return familyRule.Base, familyRule.CommissionPercent
+	}
+	return "S", agent.CommissionPercent
+}
@@ -0,0 +1,436 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A settlement groups the invoices of a sales agent in a period, so the commissions of the invoices are paid only once.
+type SalesAgentSettlement struct {
+	Id                int64            `json:"id" gorm:"index:sales_agent_settlement_id_enterprise,unique:true,priority:1"`
+	SalesAgentId      int32            `json:"salesAgentId" gorm:"column:sales_agent;not null:true;index:sales_agent_settlement_sales_agent"`
+	SalesAgent        SalesAgent       `json:"salesAgent" gorm:"foreignKey:SalesAgentId,EnterpriseId;references:Id,EnterpriseId"`
+	DateStart         time.Time        `json:"dateStart" gorm:"type:timestamp(3) with time zone;not null:true"`
+	DateEnd           time.Time        `json:"dateEnd" gorm:"type:timestamp(3) with time zone;not null:true"`
+	DateCreated       time.Time        `json:"dateCreated" gorm:"type:timestamp(3) with time zone;not null:true"`
+	InvoicedAmount    float64          `json:"invoicedAmount" gorm:"type:numeric(14,6);not null:true"`
+	Commission        float64          `json:"commission" gorm:"type:numeric(14,6);not null:true"`
+	PurchaseInvoiceId *int64           `json:"purchaseInvoiceId" gorm:"column:purchase_invoice"`
+	PurchaseInvoice   *PurchaseInvoice `json:"purchaseInvoice" gorm:"foreignKey:PurchaseInvoiceId,EnterpriseId;references:Id,EnterpriseId"`
+	EnterpriseId      int32            `json:"-" gorm:"column:enterprise;not null:true;index:sales_agent_settlement_id_enterprise,unique:true,priority:2"`
+	Enterprise        Settings         `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (s *SalesAgentSettlement) TableName() string {
+	return "sales_agent_settlement"
+}
+
+func (s *SalesAgentSettlement) BeforeCreate(tx *gorm.DB) (err error) {
+	var salesAgentSettlement SalesAgentSettlement
+	tx.Model(&SalesAgentSettlement{}).Last(&salesAgentSettlement)
+	s.Id = salesAgentSettlement.Id + 1
+	return nil
+}
+
+func getSalesAgentSettlements(salesAgentId int32, enterpriseId int32) []SalesAgentSettlement {
+	var settlements []SalesAgentSettlement = make([]SalesAgentSettlement, 0)
+	result := dbOrm.Model(&SalesAgentSettlement{}).Where("sales_agent = ? AND enterprise = ?", salesAgentId, enterpriseId).Order("date_created DESC").Preload(clause.Associations).Find(&settlements)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return settlements
+}
+
+func getSalesAgentSettlementRow(settlementId int64) SalesAgentSettlement {
+	s := SalesAgentSettlement{}
+	result := dbOrm.Model(&SalesAgentSettlement{}).Where("id = ?", settlementId).Preload(clause.Associations).First(&s)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return s
+}
+
+// The commission of a sales invoice detail
+type SalesAgentCommissionLine struct {
+	InvoiceId         int64     `json:"invoiceId"`
+	InvoiceName       string    `json:"invoiceName"`
+	DateCreated       time.Time `json:"dateCreated"`
+	CustomerName      string    `json:"customerName"`
+	Amending          bool      `json:"amending"`
+	Product           string    `json:"product"`
+	Quantity          float64   `json:"quantity"`
+	Amount            float64   `json:"amount"` // Amount of the detail without taxes, negative in the amending invoices
+	Margin            float64   `json:"margin"`
+	Base              string    `json:"base"` // S = Percentage of the invoiced amount, M = Percentage of the margin
+	CommissionPercent float64   `json:"commissionPercent"`
+	Commission        float64   `json:"commission"`
+}
+
+type SalesAgentCommissions struct {
+	Lines          []SalesAgentCommissionLine `json:"lines"`
+	InvoicedAmount float64                    `json:"invoicedAmount"`
+	Commission     float64                    `json:"commission"`
+}
+
+type SalesAgentCommissionQuery struct {
+	SalesAgentId          int32     `json:"salesAgentId"`
+	DateStart             time.Time `json:"dateStart"`
+	DateEnd               time.Time `json:"dateEnd"`
+	CreatePurchaseInvoice bool      `json:"createPurchaseInvoice"`
+}
+
+func (q *SalesAgentCommissionQuery) isValid() bool {
+	return !(q.SalesAgentId <= 0 || q.DateStart.IsZero() || q.DateEnd.IsZero() || q.DateEnd.Before(q.DateStart))
+}
+
+// Returns the invoices of the agent in the period that are not settled yet, the amending invoices included.
+func (q *SalesAgentCommissionQuery) getSalesAgentPendingInvoices(enterpriseId int32) []SalesInvoice {
+	var invoices []SalesInvoice = make([]SalesInvoice, 0)
+	result := dbOrm.Model(&SalesInvoice{}).Where("sales_agent = ? AND enterprise = ? AND sales_agent_settlement IS NULL AND date_created >= ? AND date_created <= ?", q.SalesAgentId, enterpriseId, q.DateStart, q.DateEnd).Order("date_created ASC").Preload(clause.Associations).Find(&invoices)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return invoices
+}
+
+// Calculates the commissions of the invoices of the agent in the period that are not settled yet.
+func (q *SalesAgentCommissionQuery) getSalesAgentCommissions(enterpriseId int32) SalesAgentCommissions {
+	if !q.isValid() {
+		return SalesAgentCommissions{Lines: make([]SalesAgentCommissionLine, 0)}
+	}
+	agent := getSalesAgentRow(q.SalesAgentId)
+	if agent.Id <= 0 || agent.EnterpriseId != enterpriseId {
+		return SalesAgentCommissions{Lines: make([]SalesAgentCommissionLine, 0)}
+	}
+	return calcSalesAgentCommissions(agent, q.getSalesAgentPendingInvoices(enterpriseId), enterpriseId)
+}
+
+// Returns the commissions of the invoices in a settlement.
+func getSalesAgentSettlementCommissions(settlementId int64, enterpriseId int32) SalesAgentCommissions {
+	settlement := getSalesAgentSettlementRow(settlementId)
+	if settlement.Id <= 0 || settlement.EnterpriseId != enterpriseId {
+		return SalesAgentCommissions{Lines: make([]SalesAgentCommissionLine, 0)}
+	}
+
+	var invoices []SalesInvoice = make([]SalesInvoice, 0)
+	result := dbOrm.Model(&SalesInvoice{}).Where("sales_agent_settlement = ? AND enterprise = ?", settlementId, enterpriseId).Order("date_created ASC").Preload(clause.Associations).Find(&invoices)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return calcSalesAgentCommissions(settlement.SalesAgent, invoices, enterpriseId)
+}
+
+// The commission is calculated for each detail of the invoices, using the rules of the agent for the customer and the family of the product.
+// The details of the amending invoices have a negative amount, so their commission is subtracted.
+// The discounts of the invoice are spread over the details in proportion to their amount.
+func calcSalesAgentCommissions(agent SalesAgent, invoices []SalesInvoice, enterpriseId int32) SalesAgentCommissions {
+	commissions := SalesAgentCommissions{Lines: make([]SalesAgentCommissionLine, 0)}
+	rules := getSalesAgentCommissionRules(agent.Id, enterpriseId)
+
+	for i := 0; i < len(invoices); i++ {
+		invoice := invoices[i]
+		discount := getSalesInvoiceProductsDiscountFactor(invoice)
+		details := getSalesInvoiceDetail(invoice.Id, enterpriseId)
+		for j := 0; j < len(details); j++ {
+			detail := details[j]
+
+			line := SalesAgentCommissionLine{
+				InvoiceId:    invoice.Id,
+				InvoiceName:  invoice.InvoiceName,
+				DateCreated:  invoice.DateCreated,
+				CustomerName: invoice.Customer.Name,
+				Amending:     invoice.Amending,
+				Product:      detail.Description,
+				Quantity:     detail.Quantity,
+				Amount:       detail.Price * detail.Quantity * discount,
+			}
+			line.Margin = line.Amount
+
+			var productFamilyId *int32
+			if detail.Product != nil {
+				line.Product = detail.Product.Name
+				productFamilyId = detail.Product.FamilyId
+				// the cost is returned in the amending invoices
+				if line.Amount >= 0 {
+					line.Margin = line.Amount - (detail.Product.CostPrice * detail.Quantity)
+				} else {
+					line.Margin = line.Amount + (detail.Product.CostPrice * detail.Quantity)
+				}
+			}
+
+			line.Base, line.CommissionPercent = getSalesAgentCommission(agent, rules, invoice.CustomerId, productFamilyId)
+			if line.Base == "M" {
+				line.Commission = line.Margin * (line.CommissionPercent / 100)
+			} else {
+				line.Commission = line.Amount * (line.CommissionPercent / 100)
+			}
+
+			commissions.Lines = append(commissions.Lines, line)
+			commissions.InvoicedAmount += line.Amount
+			commissions.Commission += line.Commission
+		}
+	}
+
+	return commissions
+}
+
+// Returns the part of the amount of the products that remains after applying the discounts of the invoice.
+// The shipping is not a product, it's not included.
+func getSalesInvoiceProductsDiscountFactor(invoice SalesInvoice) float64 {
+	if invoice.TotalProducts == 0 {
+		return 1
+	}
+	totalProductsWithDiscount := (invoice.TotalProducts - invoice.TotalProducts*(invoice.DiscountPercent/100)) - invoice.FixDiscount
+	return totalProductsWithDiscount / invoice.TotalProducts
+}
+
+// Settles the commissions of the invoices of the agent in the period that are not settled yet.
+// If the agent invoices us, a purchase invoice can be created for the supplier of the agent with the amount of the commission.
+// Returns the ID of the new settlement in the extra data.
+//
+// ERROR CODES:
+// 1. There are no invoices pending of settlement in the period
+// 2. The agent has no supplier, the purchase invoice can't be created
+// 3. The supplier has no billing address, payment method or billing series
+// 4. Error creating the purchase invoice detail: <error>
+func (q *SalesAgentCommissionQuery) settleSalesAgentCommissions(enterpriseId int32, userId int32) OkAndErrorCodeReturn {
+	if !q.isValid() {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	agent := getSalesAgentRow(q.SalesAgentId)
+	if agent.Id <= 0 || agent.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	invoices := q.getSalesAgentPendingInvoices(enterpriseId)
+	if len(invoices) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+	commissions := calcSalesAgentCommissions(agent, invoices, enterpriseId)
+
+	var supplier Supplier
+	if q.CreatePurchaseInvoice {
+		if agent.SupplierId == nil {
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+		}
+		supplier = getSupplierRow(*agent.SupplierId)
+		if supplier.MainBillingAddressId == nil || supplier.PaymentMethodId == nil || supplier.BillingSeriesId == nil {
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+		}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	settlement := SalesAgentSettlement{
+		SalesAgentId:   agent.Id,
+		DateStart:      q.DateStart,
+		DateEnd:        q.DateEnd,
+		DateCreated:    time.Now(),
+		InvoicedAmount: commissions.InvoicedAmount,
+		Commission:     commissions.Commission,
+		EnterpriseId:   enterpriseId,
+	}
+
+	result := trans.Create(&settlement)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	var invoiceIds []int64 = make([]int64, 0)
+	for i := 0; i < len(invoices); i++ {
+		invoiceIds = append(invoiceIds, invoices[i].Id)
+	}
+	result = trans.Model(&SalesInvoice{}).Where("id IN ? AND enterprise = ?", invoiceIds, enterpriseId).Update("sales_agent_settlement", settlement.Id)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	// there is nothing to pay if the amending invoices are greater than the invoices
+	if q.CreatePurchaseInvoice && commissions.Commission > 0 {
+		purchaseInvoice := PurchaseInvoice{
+			SupplierId:       supplier.Id,
+			PaymentMethodId:  *supplier.PaymentMethodId,
+			BillingSeriesId:  *supplier.BillingSeriesId,
+			CurrencyId:       invoices[0].CurrencyId,
+			BillingAddressId: *supplier.MainBillingAddressId,
+			EnterpriseId:     enterpriseId,
+		}
+		ok, purchaseInvoiceId := purchaseInvoice.insertPurchaseInvoice(userId, trans)
+		if !ok {
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+
+		settings := getSettingsRecordById(enterpriseId)
+		detail := PurchaseInvoiceDetail{
+			InvoiceId:    purchaseInvoiceId,
+			Description:  "Commissions " + q.DateStart.Format("2006-01-02") + " - " + q.DateEnd.Format("2006-01-02"),
+			Price:        commissions.Commission,
+			Quantity:     1,
+			VatPercent:   settings.DefaultVatPercent,
+			EnterpriseId: enterpriseId,
+		}
+		okAndErr := detail.insertPurchaseInvoiceDetail(userId, trans)
+		if !okAndErr.Ok {
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4, ExtraData: []string{strconv.Itoa(int(okAndErr.ErrorCode))}}
+		}
+
+		result = trans.Model(&SalesAgentSettlement{}).Where("id = ?", settlement.Id).Update("purchase_invoice", purchaseInvoiceId)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		settlement.PurchaseInvoiceId = &purchaseInvoiceId
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(enterpriseId, "sales_agent_settlement", int(settlement.Id), userId, "I")
+	json, _ := json.Marshal(settlement)
+	go fireWebHook(enterpriseId, "sales_agent_settlement", "POST", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true, ExtraData: []string{strconv.Itoa(int(settlement.Id))}}
+}
+
+// Deletes the settlement and its purchase invoice, the invoices can be settled again.
+//
+// ERROR CODES:
+// 1. The purchase invoice could not be deleted: <error>
+func deleteSalesAgentSettlement(settlementId int64, enterpriseId int32, userId int32) OkAndErrorCodeReturn {
+	settlement := getSalesAgentSettlementRow(settlementId)
+	if settlement.Id <= 0 || settlement.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	result := trans.Model(&SalesInvoice{}).Where("sales_agent_settlement = ? AND enterprise = ?", settlementId, enterpriseId).Update("sales_agent_settlement", nil)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	result = trans.Where("id = ? AND enterprise = ?", settlementId, enterpriseId).Delete(&SalesAgentSettlement{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	if settlement.PurchaseInvoiceId != nil {
+		purchaseInvoice := PurchaseInvoice{Id: *settlement.PurchaseInvoiceId, EnterpriseId: enterpriseId}
+		okAndErr := purchaseInvoice.deletePurchaseInvoice(userId, trans)
+		if !okAndErr.Ok {
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1, ExtraData: []string{strconv.Itoa(int(okAndErr.ErrorCode))}}
+		}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(enterpriseId, "sales_agent_settlement", int(settlementId), userId, "D")
+	json, _ := json.Marshal(settlement)
+	go fireWebHook(enterpriseId, "sales_agent_settlement", "DELETE", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+func reportSalesAgentSettlement(id int, forcePrint bool, enterpriseId int32) []byte {
+	s := getSalesAgentSettlementRow(int64(id))
+	if s.Id <= 0 || s.EnterpriseId != enterpriseId {
+		return nil
+	}
+	commissions := getSalesAgentSettlementCommissions(s.Id, enterpriseId)
+
+	purchaseInvoiceName := ""
+	if s.PurchaseInvoice != nil {
+		purchaseInvoiceName = s.PurchaseInvoice.InvoiceName
+	}
+
+	template := getReportTemplate(enterpriseId, "SALES_AGENT_SETTLEMENT")
+
+	html := template.Html
+
+	html = strings.Replace(html, "$$img_base64$$", getEnterpriseLogoBase64(enterpriseId), 1)
+	html = strings.Replace(html, "$$settlement_date$$", s.DateCreated.Format("2006-01-02 15:04:05"), 1)
+	html = strings.Replace(html, "$$settlement_date_start$$", s.DateStart.Format("2006-01-02"), 1)
+	html = strings.Replace(html, "$$settlement_date_end$$", s.DateEnd.Format("2006-01-02"), 1)
+	html = strings.Replace(html, "$$settlement_purchase_invoice$$", purchaseInvoiceName, 1)
+	html = strings.Replace(html, "$$agent_name$$", s.SalesAgent.Name, 1)
+	html = strings.Replace(html, "$$agent_email$$", s.SalesAgent.Email, 1)
+	html = strings.Replace(html, "$$agent_phone$$", s.SalesAgent.Phone, 1)
+	html = strings.Replace(html, "$$settlement_invoiced_amount$$", fmt.Sprintf("%.2f", s.InvoicedAmount), 1)
+	html = strings.Replace(html, "$$settlement_commission$$", fmt.Sprintf("%.2f", s.Commission), 1)
+	if forcePrint {
+		html = strings.Replace(html, "$$script$$", "window.print()", 1)
+	} else {
+		html = strings.Replace(html, "$$script$$", "", 1)
+	}
+
+	detailHtmlTemplate := html[strings.Index(html, "&&detail&&")+len("&&detail&&") : strings.Index(html, "&&--detail--&&")]
+	detailsHtml := ""
+
+	for i := 0; i < len(commissions.Lines); i++ {
+		detailHtml := detailHtmlTemplate
+		line := commissions.Lines[i]
+
+		detailHtml = strings.Replace(detailHtml, "$$detail_invoice$$", line.InvoiceName, 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_date$$", line.DateCreated.Format("2006-01-02"), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_customer$$", line.CustomerName, 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_product$$", line.Product, 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_quantity$$", formatQuantity(line.Quantity), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_amount$$", fmt.Sprintf("%.2f", line.Amount), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_margin$$", fmt.Sprintf("%.2f", line.Margin), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_commission_percent$$", fmt.Sprintf("%.2f", line.CommissionPercent), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_commission$$", fmt.Sprintf("%.2f", line.Commission), 1)
+
+		detailsHtml += detailHtml
+	}
+
+	html = html[:strings.Index(html, "&&detail&&")] + detailsHtml + html[strings.Index(html, "&&--detail--&&")+len("&&--detail--&&"):]
+
+	return []byte(html)
+}
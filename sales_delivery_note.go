@@ -46,6 +46,7 @@ type SalesDeliveryNote struct {
 	CurrencyId         int32         `json:"currencyId" gorm:"column:currency;not null"`
 	Currency           Currency      `json:"currency" gorm:"foreignKey:CurrencyId,EnterpriseId;references:Id,EnterpriseId"`
 	CurrencyChange     float64       `json:"currencyChange" gorm:"column:currency_change;not null;type:numeric(14,6)"`
+	CostOfGoodsSold    float64       `json:"costOfGoodsSold" gorm:"column:cost_of_goods_sold;not null:true;type:numeric(14,6);default:0"` // Cost of the stock that has left the warehouse in the delivery note
 	EnterpriseId       int32         `json:"-" gorm:"column:enterprise;not null:true;index:sales_delivery_note_id_enterprise,unique:true,priority:2;;index:sales_delivery_note_delivery_note_number,unique:true,priority:1"`
 	Enterprise         Settings      `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 }
@@ -256,6 +257,9 @@ func (n *SalesDeliveryNote) deleteSalesDeliveryNotes(userId int32, trans *gorm.D
 			return OkAndErrorCodeReturn{Ok: false}
 		}
 	}
+	if !deleteDropShippingDeliveryNoteDetails(n.Id, n.EnterpriseId, userId, *trans) {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
 
 	insertTransactionalLog(n.EnterpriseId, "sales_delivery_note", int(n.Id), userId, "D")
 	json, _ := json.Marshal(n)
@@ -283,6 +287,7 @@ func (n *SalesDeliveryNote) deleteSalesDeliveryNotes(userId int32, trans *gorm.D
 // ERROR CODES:
 // 1. The order already has a delivery note generated
 // 2. There are no details to generate the delivery note
+// 3. The order is on hold because of the customer's risk
 func deliveryNoteAllSaleOrder(saleOrderId int64, enterpriseId int32, userId int32, trans *gorm.DB) (OkAndErrorCodeReturn, int64) {
 	// get the sale order and it's details
 	saleOrder := getSalesOrderRow(saleOrderId)
@@ -295,8 +300,12 @@ func deliveryNoteAllSaleOrder(saleOrderId int64, enterpriseId int32, userId int3
 	if saleOrder.DeliveryNoteLines >= saleOrder.LinesNumber {
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}, 0
 	}
+	if saleOrder.CreditHold {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}, 0
+	}
 	orderDetails := getSalesOrderDetail(saleOrderId, saleOrder.EnterpriseId)
-	filterSalesOrderDetails(orderDetails, func(sod SalesOrderDetail) bool { return sod.QuantityDeliveryNote < sod.Quantity })
+	// the drop shipping details get their delivery note when the supplier confirms the dispatch
+	orderDetails = filterSalesOrderDetails(orderDetails, func(sod SalesOrderDetail) bool { return sod.QuantityDeliveryNote < sod.Quantity && !sod.DropShipping })
 	if len(orderDetails) == 0 {
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}, 0
 	}
@@ -331,7 +340,7 @@ func deliveryNoteAllSaleOrder(saleOrderId int64, enterpriseId int32, userId int3
 		movement.Type = "O"
 		movement.WarehouseId = orderDetail.WarehouseId
 		movement.ProductId = orderDetail.ProductId
-		movement.Quantity = -(orderDetail.Quantity - orderDetail.QuantityDeliveryNote)
+		movement.Quantity = -roundQuantity(orderDetail.Quantity - orderDetail.QuantityDeliveryNote)
 		movement.SalesDeliveryNoteId = &deliveryNoteId
 		movement.SalesOrderDetailId = &orderDetail.Id
 		movement.SalesOrderId = &saleOrder.Id
@@ -361,6 +370,8 @@ func deliveryNoteAllSaleOrder(saleOrderId int64, enterpriseId int32, userId int3
 // 2. The selected quantity is greater than the quantity in the detail
 // 3. The detail has a delivery note generated
 // 4. The selected quantity is greater than the quantity pending of delivery note generation in the detail
+// 5. The order is on hold because of the customer's risk
+// 6. The detail is shipped by the supplier (drop shipping)
 func (noteInfo *OrderDetailGenerate) deliveryNotePartiallySaleOrder(enterpriseId int32, userId int32) OkAndErrorCodeReturn {
 	// get the sale order and it's details
 	saleOrder := getSalesOrderRow(noteInfo.OrderId)
@@ -370,6 +381,9 @@ func (noteInfo *OrderDetailGenerate) deliveryNotePartiallySaleOrder(enterpriseId
 	if saleOrder.DeliveryNoteLines >= saleOrder.LinesNumber {
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
 	}
+	if saleOrder.CreditHold {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 5}
+	}
 
 	var saleOrderDetails []SalesOrderDetail = make([]SalesOrderDetail, 0)
 	for i := 0; i < len(noteInfo.Selection); i++ {
@@ -385,10 +399,14 @@ func (noteInfo *OrderDetailGenerate) deliveryNotePartiallySaleOrder(enterpriseId
 			product := getProductRow(orderDetail.ProductId)
 			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3, ExtraData: []string{product.Name}}
 		}
-		if (noteInfo.Selection[i].Quantity + orderDetail.QuantityDeliveryNote) > orderDetail.Quantity {
+		if roundQuantity(noteInfo.Selection[i].Quantity+orderDetail.QuantityDeliveryNote) > orderDetail.Quantity {
 			product := getProductRow(orderDetail.ProductId)
 			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4, ExtraData: []string{product.Name}}
 		}
+		if orderDetail.DropShipping {
+			product := getProductRow(orderDetail.ProductId)
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 6, ExtraData: []string{product.Name}}
+		}
 		saleOrderDetails = append(saleOrderDetails, orderDetail)
 	}
 
@@ -420,6 +438,9 @@ func (noteInfo *OrderDetailGenerate) deliveryNotePartiallySaleOrder(enterpriseId
 		movement.WarehouseId = orderDetail.WarehouseId
 		movement.ProductId = orderDetail.ProductId
 		movement.Quantity = -noteInfo.Selection[i].Quantity
+		movement.LotNumber = noteInfo.Selection[i].LotNumber
+		movement.SerialNumbers = noteInfo.Selection[i].SerialNumbers
+		movement.LocationId = noteInfo.Selection[i].LocationId
 		movement.SalesDeliveryNoteId = &deliveryNoteId
 		movement.SalesOrderDetailId = &orderDetail.Id
 		movement.SalesOrderId = &saleOrder.Id
@@ -463,14 +484,16 @@ func locateSalesDeliveryNotesBySalesOrder(orderId int64, enterpriseId int32) []S
 }
 
 type SalesDeliveryNoteRelation struct {
-	Orders    []SaleOrder `json:"orders"`
-	Shippings []Shipping  `json:"shippings"`
+	Orders    []SaleOrder   `json:"orders"`
+	Shippings []Shipping    `json:"shippings"`
+	Returns   []SalesReturn `json:"returns"`
 }
 
 func getSalesDeliveryNoteRelations(noteId int64, enterpriseId int32) SalesDeliveryNoteRelation {
 	return SalesDeliveryNoteRelation{
 		Orders:    getSalesDeliveryNoteOrders(noteId, enterpriseId),
 		Shippings: getSalesDeliveryNoteShippings(noteId),
+		Returns:   getSalesDeliveryNoteReturns(noteId, enterpriseId),
 	}
 }
 
@@ -488,6 +511,14 @@ func getSalesDeliveryNoteOrders(noteId int64, enterpriseId int32) []SaleOrder {
 			sales = append(sales, order)
 		}
 	}
+	// the drop shipping delivery notes don't have warehouse movements
+	if len(details) == 0 {
+		var dropShippingDetails []DropShippingDeliveryNoteDetail = make([]DropShippingDeliveryNoteDetail, 0)
+		dbOrm.Model(&DropShippingDeliveryNoteDetail{}).Where("sales_delivery_note = ?", noteId).Distinct("sales_order").Find(&dropShippingDetails)
+		for i := 0; i < len(dropShippingDetails); i++ {
+			sales = append(sales, getSalesOrderRow(dropShippingDetails[i].SalesOrderId))
+		}
+	}
 	return sales
 }
 
@@ -525,6 +556,22 @@ func addTotalProductsSalesDeliveryNote(noteId int64, totalAmount float64, vatPer
 	return calcTotalsSaleDeliveryNote(noteId, enterpriseId, userId, trans)
 }
 
+// Adds the cost of the goods that have left the warehouse to the delivery note. This function will subsctract from the cost if the amount is negative.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func addCostOfGoodsSoldSalesDeliveryNote(noteId int64, costAmount float64, enterpriseId int32, trans gorm.DB) bool {
+	if costAmount == 0 {
+		return true
+	}
+
+	result := trans.Model(&SalesDeliveryNote{}).Where("id = ? AND enterprise = ?", noteId, enterpriseId).Update("cost_of_goods_sold", gorm.Expr("cost_of_goods_sold + ?", costAmount))
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
 // Applies the logic to calculate the totals of the sales delivery note.
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION.
 func calcTotalsSaleDeliveryNote(noteId int64, enterpriseId int32, userId int32, trans gorm.DB) bool {
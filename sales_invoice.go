@@ -22,38 +22,41 @@ import (
 )
 
 type SalesInvoice struct {
-	Id                   int64               `json:"id" gorm:"index:sales_invoice_id_enterprise,unique:true,priority:1"`
-	CustomerId           int32               `json:"customerId" gorm:"column:customer;not null:true"`
-	Customer             Customer            `json:"customer" gorm:"foreignKey:CustomerId,EnterpriseId;references:Id,EnterpriseId"`
-	DateCreated          time.Time           `json:"dateCreated" gorm:"column:date_created;not null:true;type:timestamp(3) with time zone;index:sales_invoice_date_created,sort:desc"`
-	PaymentMethodId      int32               `json:"paymentMethodId" gorm:"column:payment_method;not null:true"`
-	PaymentMethod        PaymentMethod       `json:"paymentMethod" gorm:"foreignKey:PaymentMethodId,EnterpriseId;references:Id,EnterpriseId"`
-	BillingSeriesId      string              `json:"billingSeriesId" gorm:"column:billing_series;not null:true;type:character(3);index:sales_invoice_invoice_number,unique:true,priority:2"`
-	BillingSeries        BillingSerie        `json:"billingSeries" gorm:"foreignKey:BillingSeriesId,EnterpriseId;references:Id,EnterpriseId"`
-	CurrencyId           int32               `json:"currencyId" gorm:"column:currency;not null:true"`
-	Currency             Currency            `json:"currency" gorm:"foreignKey:CurrencyId,EnterpriseId;references:Id,EnterpriseId"`
-	CurrencyChange       float64             `json:"currencyChange" gorm:"type:numeric(14,6);not null:true"`
-	BillingAddressId     int32               `json:"billingAddressId" gorm:"column:billing_address;not null:true"`
-	BillingAddress       Address             `json:"billingAddress" gorm:"foreignKey:BillingAddressId,EnterpriseId;references:Id,EnterpriseId"`
-	TotalProducts        float64             `json:"totalProducts" gorm:"type:numeric(14,6);not null:true"`
-	DiscountPercent      float64             `json:"discountPercent" gorm:"type:numeric(14,6);not null:true"`
-	FixDiscount          float64             `json:"fixDiscount" gorm:"type:numeric(14,6);not null:true"`
-	ShippingPrice        float64             `json:"shippingPrice" gorm:"type:numeric(14,6);not null:true"`
-	ShippingDiscount     float64             `json:"shippingDiscount" gorm:"type:numeric(14,6);not null:true"`
-	TotalWithDiscount    float64             `json:"totalWithDiscount" gorm:"type:numeric(14,6);not null:true"`
-	VatAmount            float64             `json:"vatAmount" gorm:"type:numeric(14,6);not null:true"`
-	TotalAmount          float64             `json:"totalAmount" gorm:"type:numeric(14,6);not null:true"`
-	LinesNumber          int16               `json:"linesNumber" gorm:"column:lines_number;not null:true"`
-	InvoiceNumber        int32               `json:"invoiceNumber" gorm:"column:invoice_number;not null:true;index:sales_invoice_invoice_number,unique:true,priority:3,sort:desc"`
-	InvoiceName          string              `json:"invoiceName" gorm:"column:invoice_name;not null:true;type:character(15)"`
-	AccountingMovementId *int64              `json:"accountingMovementId" gorm:"column:accounting_movement"`
-	AccountingMovement   *AccountingMovement `json:"accountingMovement" gorm:"foreignKey:AccountingMovementId,EnterpriseId;references:Id,EnterpriseId"`
-	EnterpriseId         int32               `json:"-" gorm:"column:enterprise;not null:true;index:sales_invoice_id_enterprise,unique:true,priority:2;index:sales_invoice_invoice_number,unique:true,priority:1"`
-	Enterprise           Settings            `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
-	SimplifiedInvoice    bool                `json:"simplifiedInvoice" gorm:"not null:true"`
-	Amending             bool                `json:"amending" gorm:"not null:true"`
-	AmendedInvoiceId     *int64              `json:"amendedInvoiceId" gorm:"column:amended_invoice"`
-	AmendedInvoice       *SalesInvoice       `json:"amendedInvoice" gorm:"foreignKey:AmendedInvoiceId;references:Id"`
+	Id                     int64               `json:"id" gorm:"index:sales_invoice_id_enterprise,unique:true,priority:1"`
+	CustomerId             int32               `json:"customerId" gorm:"column:customer;not null:true"`
+	Customer               Customer            `json:"customer" gorm:"foreignKey:CustomerId,EnterpriseId;references:Id,EnterpriseId"`
+	DateCreated            time.Time           `json:"dateCreated" gorm:"column:date_created;not null:true;type:timestamp(3) with time zone;index:sales_invoice_date_created,sort:desc"`
+	PaymentMethodId        int32               `json:"paymentMethodId" gorm:"column:payment_method;not null:true"`
+	PaymentMethod          PaymentMethod       `json:"paymentMethod" gorm:"foreignKey:PaymentMethodId,EnterpriseId;references:Id,EnterpriseId"`
+	BillingSeriesId        string              `json:"billingSeriesId" gorm:"column:billing_series;not null:true;type:character(3);index:sales_invoice_invoice_number,unique:true,priority:2"`
+	BillingSeries          BillingSerie        `json:"billingSeries" gorm:"foreignKey:BillingSeriesId,EnterpriseId;references:Id,EnterpriseId"`
+	CurrencyId             int32               `json:"currencyId" gorm:"column:currency;not null:true"`
+	Currency               Currency            `json:"currency" gorm:"foreignKey:CurrencyId,EnterpriseId;references:Id,EnterpriseId"`
+	CurrencyChange         float64             `json:"currencyChange" gorm:"type:numeric(14,6);not null:true"`
+	BillingAddressId       int32               `json:"billingAddressId" gorm:"column:billing_address;not null:true"`
+	BillingAddress         Address             `json:"billingAddress" gorm:"foreignKey:BillingAddressId,EnterpriseId;references:Id,EnterpriseId"`
+	TotalProducts          float64             `json:"totalProducts" gorm:"type:numeric(14,6);not null:true"`
+	DiscountPercent        float64             `json:"discountPercent" gorm:"type:numeric(14,6);not null:true"`
+	FixDiscount            float64             `json:"fixDiscount" gorm:"type:numeric(14,6);not null:true"`
+	ShippingPrice          float64             `json:"shippingPrice" gorm:"type:numeric(14,6);not null:true"`
+	ShippingDiscount       float64             `json:"shippingDiscount" gorm:"type:numeric(14,6);not null:true"`
+	TotalWithDiscount      float64             `json:"totalWithDiscount" gorm:"type:numeric(14,6);not null:true"`
+	VatAmount              float64             `json:"vatAmount" gorm:"type:numeric(14,6);not null:true"`
+	TotalAmount            float64             `json:"totalAmount" gorm:"type:numeric(14,6);not null:true"`
+	LinesNumber            int16               `json:"linesNumber" gorm:"column:lines_number;not null:true"`
+	InvoiceNumber          int32               `json:"invoiceNumber" gorm:"column:invoice_number;not null:true;index:sales_invoice_invoice_number,unique:true,priority:3,sort:desc"`
+	InvoiceName            string              `json:"invoiceName" gorm:"column:invoice_name;not null:true;type:character(15)"`
+	AccountingMovementId   *int64              `json:"accountingMovementId" gorm:"column:accounting_movement"`
+	AccountingMovement     *AccountingMovement `json:"accountingMovement" gorm:"foreignKey:AccountingMovementId,EnterpriseId;references:Id,EnterpriseId"`
+	EnterpriseId           int32               `json:"-" gorm:"column:enterprise;not null:true;index:sales_invoice_id_enterprise,unique:true,priority:2;index:sales_invoice_invoice_number,unique:true,priority:1"`
+	Enterprise             Settings            `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+	SimplifiedInvoice      bool                `json:"simplifiedInvoice" gorm:"not null:true"`
+	Amending               bool                `json:"amending" gorm:"not null:true"`
+	AmendedInvoiceId       *int64              `json:"amendedInvoiceId" gorm:"column:amended_invoice"`
+	AmendedInvoice         *SalesInvoice       `json:"amendedInvoice" gorm:"foreignKey:AmendedInvoiceId;references:Id"`
+	SalesAgentId           *int32              `json:"salesAgentId" gorm:"column:sales_agent;index:sales_invoice_sales_agent,priority:1"`
+	SalesAgent             *SalesAgent         `json:"salesAgent" gorm:"foreignKey:SalesAgentId,EnterpriseId;references:Id,EnterpriseId"`
+	SalesAgentSettlementId *int64              `json:"salesAgentSettlementId" gorm:"column:sales_agent_settlement"`
 }
 
 func (s SalesInvoice) TableName() string {
@@ -288,6 +291,11 @@ func (i *SalesInvoice) insertSalesInvoice(userId int32, trans *gorm.DB) (bool, i
 	i.AccountingMovementId = nil
 	i.Amending = false
 	i.AmendedInvoiceId = nil
+	i.SalesAgentSettlementId = nil
+	if i.SalesAgentId == nil {
+		customer := getCustomerRow(i.CustomerId)
+		i.SalesAgentId = customer.SalesAgentId
+	}
 
 	result := trans.Create(&i)
 	if result.Error != nil {
@@ -315,15 +323,23 @@ func (i *SalesInvoice) insertSalesInvoice(userId int32, trans *gorm.DB) (bool, i
 // 1. can't delete details in posted invoices
 // 2. the invoice deletion is completely disallowed by policy
 // 3. it is only allowed to delete the latest invoice of the billing series
+// 4. the commissions of the invoice are settled with the sales agent
+// 5. the invoice is in the invoice register
 func (i *SalesInvoice) deleteSalesInvoice(userId int32) OkAndErrorCodeReturn {
 	if i.Id <= 0 {
 		return OkAndErrorCodeReturn{Ok: false}
 	}
 
 	invoice := getSalesInvoiceRow(i.Id)
+	if getSalesInvoiceRegisterByInvoice(invoice.Id, invoice.EnterpriseId).Id > 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 5}
+	}
 	if invoice.AccountingMovementId != nil {
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
 	}
+	if invoice.SalesAgentSettlementId != nil {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4}
+	}
 
 	// INVOICE DELETION POLICY
 	s := getSettingsRecordById(i.EnterpriseId)
@@ -353,11 +369,19 @@ func (i *SalesInvoice) deleteSalesInvoice(userId int32) OkAndErrorCodeReturn {
 		}
 	}
 
+	// keep the subscription log, without the deleted invoice
+	result := trans.Model(&SalesSubscriptionLog{}).Where("sales_invoice = ? AND enterprise = ?", i.Id, i.EnterpriseId).Update("sales_invoice", nil)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
 	insertTransactionalLog(i.EnterpriseId, "sales_invoice", int(i.Id), userId, "D")
 	json, _ := json.Marshal(i)
 	go fireWebHook(i.EnterpriseId, "sales_invoice", "DELETE", string(json))
 
-	result := trans.Delete(&SalesInvoice{}, "id = ? AND enterprise = ?", i.Id, i.EnterpriseId)
+	result = trans.Delete(&SalesInvoice{}, "id = ? AND enterprise = ?", i.Id, i.EnterpriseId)
 	if result.Error != nil {
 		log("DB", result.Error.Error())
 		trans.Rollback()
@@ -417,13 +441,6 @@ func makeAmendingSaleInvoice(invoiceId int64, enterpriseId int32, quantity float
 
 	settings := getSettingsRecordById(enterpriseId)
 
-	// get invoice name
-	invoiceNumber := getNextSaleInvoiceNumber(i.BillingSeriesId, i.EnterpriseId)
-	if i.InvoiceNumber <= 0 {
-		return false
-	}
-	invoiceName := i.BillingSeriesId + "/" + strconv.Itoa(now.Year()) + "/" + fmt.Sprintf("%06d", i.InvoiceNumber)
-
 	var detailAmount float64
 	var vatPercent float64
 	// VAT excluded invoice, when amending the invoice, we are not returning any tax money
@@ -434,63 +451,111 @@ func makeAmendingSaleInvoice(invoiceId int64, enterpriseId int32, quantity float
 		detailAmount = quantity / (1 + (settings.DefaultVatPercent / 100))
 		vatPercent = settings.DefaultVatPercent
 	}
-	var vatAmount float64 = (quantity / 100) * vatPercent
-
-	var amendingInvoice SalesInvoice = SalesInvoice{}
-
-	amendingInvoice.CustomerId = i.CustomerId
-	amendingInvoice.DateCreated = time.Now()
-	amendingInvoice.PaymentMethodId = i.PaymentMethodId
-	amendingInvoice.BillingSeriesId = i.BillingSeriesId
-	amendingInvoice.CurrencyId = i.CurrencyId
-	amendingInvoice.CurrencyChange = i.CurrencyChange
-	amendingInvoice.BillingAddressId = i.BillingAddressId
-	amendingInvoice.SimplifiedInvoice = i.SimplifiedInvoice
-	amendingInvoice.Amending = true
-	amendingInvoice.AmendedInvoiceId = &i.Id
-	amendingInvoice.InvoiceNumber = invoiceNumber
-	amendingInvoice.InvoiceName = invoiceName
-	amendingInvoice.TotalProducts = -detailAmount
-	amendingInvoice.TotalWithDiscount = -detailAmount
-	amendingInvoice.VatAmount = -vatAmount
-	amendingInvoice.TotalAmount = -quantity
-	amendingInvoice.DiscountPercent = 0
-	amendingInvoice.FixDiscount = 0
-	amendingInvoice.ShippingPrice = 0
-	amendingInvoice.ShippingDiscount = 0
-	amendingInvoice.EnterpriseId = enterpriseId
-
-	result := dbOrm.Create(&amendingInvoice)
+
+	details := []SalesInvoiceDetail{
+		{
+			Description:  description,
+			Price:        -detailAmount,
+			Quantity:     1,
+			VatPercent:   vatPercent,
+			TotalAmount:  -quantity,
+			EnterpriseId: enterpriseId,
+		},
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return false
+	}
+	///
+
+	amendingInvoice, ok := insertAmendingSaleInvoice(i, details, userId, *trans)
+	if !ok {
+		return false
+	}
+
+	if !registerIssuedSalesInvoice(amendingInvoice.Id, enterpriseId, trans) {
+		return false
+	}
+
+	///
+	result := trans.Commit()
 	if result.Error != nil {
-		log("DB", result.Error.Error())
 		return false
 	}
+	///
 
-	detail := SalesInvoiceDetail{}
+	go submitSalesInvoiceRegister(enterpriseId)
+	return true
+}
 
-	detail.InvoiceId = amendingInvoice.Id
-	detail.Description = description
-	detail.Price = -detailAmount
-	detail.Quantity = 1
-	detail.VatPercent = vatPercent
-	detail.TotalAmount = -quantity
-	detail.EnterpriseId = enterpriseId
+// Creates an amending invoice for the invoice with the given details, and adds the details to the totals.
+// The invoice number is counted in the transaction, so several amending invoices can be created in the same transaction.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func insertAmendingSaleInvoice(i SalesInvoice, details []SalesInvoiceDetail, userId int32, trans gorm.DB) (SalesInvoice, bool) {
+	var invoiceNumber int32
+	result := trans.Model(&SalesInvoice{}).Where("billing_series = ? AND enterprise = ?", i.BillingSeriesId, i.EnterpriseId).Select("COALESCE(MAX(invoice_number), 0)").Scan(&invoiceNumber)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return SalesInvoice{}, false
+	}
+	invoiceNumber++
+	now := time.Now()
 
-	result = dbOrm.Create(&detail)
+	amendingInvoice := SalesInvoice{
+		CustomerId:        i.CustomerId,
+		DateCreated:       now,
+		PaymentMethodId:   i.PaymentMethodId,
+		BillingSeriesId:   i.BillingSeriesId,
+		CurrencyId:        i.CurrencyId,
+		CurrencyChange:    i.CurrencyChange,
+		BillingAddressId:  i.BillingAddressId,
+		SimplifiedInvoice: i.SimplifiedInvoice,
+		Amending:          true,
+		AmendedInvoiceId:  &i.Id,
+		SalesAgentId:      i.SalesAgentId,
+		InvoiceNumber:     invoiceNumber,
+		InvoiceName:       i.BillingSeriesId + "/" + strconv.Itoa(now.Year()) + "/" + fmt.Sprintf("%06d", invoiceNumber),
+		EnterpriseId:      i.EnterpriseId,
+	}
+
+	result = trans.Create(&amendingInvoice)
 	if result.Error != nil {
 		log("DB", result.Error.Error())
-		return false
+		trans.Rollback()
+		return amendingInvoice, false
 	}
 
-	insertTransactionalLog(enterpriseId, "sales_invoice", int(invoiceId), userId, "I")
+	insertTransactionalLog(amendingInvoice.EnterpriseId, "sales_invoice", int(amendingInvoice.Id), userId, "I")
 	jsn, _ := json.Marshal(amendingInvoice)
-	go fireWebHook(amendingInvoice.EnterpriseId, "sales_invoice", "PUT", string(jsn))
+	go fireWebHook(amendingInvoice.EnterpriseId, "sales_invoice", "POST", string(jsn))
 
-	insertTransactionalLog(enterpriseId, "sales_invoice_detail", int(detail.Id), userId, "I")
-	jsn, _ = json.Marshal(detail)
-	go fireWebHook(detail.EnterpriseId, "sales_invoice_detail", "PUT", string(jsn))
+	for j := 0; j < len(details); j++ {
+		details[j].InvoiceId = amendingInvoice.Id
+		if len(details[j].Description) > 150 {
+			details[j].Description = details[j].Description[:150]
+		}
 
-	return true
+		result = trans.Create(&details[j])
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return amendingInvoice, false
+		}
+
+		insertTransactionalLog(details[j].EnterpriseId, "sales_invoice_detail", int(details[j].Id), userId, "I")
+		jsn, _ = json.Marshal(details[j])
+		go fireWebHook(details[j].EnterpriseId, "sales_invoice_detail", "POST", string(jsn))
+
+		ok := addTotalProductsSalesInvoice(amendingInvoice.Id, details[j].Price*details[j].Quantity, details[j].VatPercent, amendingInvoice.EnterpriseId, userId, trans)
+		if !ok {
+			return amendingInvoice, false
+		}
+	}
+
+	return amendingInvoice, true
 }
 
 // Adds a total amount to the invoice total. This function will subsctract from the total if the totalAmount is negative.
@@ -548,6 +613,8 @@ func calcTotalsSaleInvoice(enterpriseId int32, invoiceId int64, userId int32, tr
 // ERROR CODES:
 // 1. The order is already invoiced
 // 2. There are no details to invoice
+// 3. The order is on hold because of the customer's risk
+// 4. The invoice can't be added to the invoice register
 func invoiceAllSaleOrder(saleOrderId int64, enterpriseId int32, userId int32) OkAndErrorCodeReturn {
 	// get the sale order and it's details
 	saleOrder := getSalesOrderRow(saleOrderId)
@@ -560,6 +627,9 @@ func invoiceAllSaleOrder(saleOrderId int64, enterpriseId int32, userId int32) Ok
 	if saleOrder.InvoicedLines >= saleOrder.LinesNumber {
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
 	}
+	if saleOrder.CreditHold {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
 	orderDetails := getSalesOrderDetail(saleOrderId, saleOrder.EnterpriseId)
 	filterSalesOrderDetails(orderDetails, func(sod SalesOrderDetail) bool { return sod.QuantityInvoiced < sod.Quantity })
 	if len(orderDetails) == 0 {
@@ -573,6 +643,7 @@ func invoiceAllSaleOrder(saleOrderId int64, enterpriseId int32, userId int32) Ok
 	invoice.BillingSeriesId = saleOrder.BillingSeriesId
 	invoice.CurrencyId = saleOrder.CurrencyId
 	invoice.PaymentMethodId = saleOrder.PaymentMethodId
+	invoice.SalesAgentId = saleOrder.SalesAgentId
 
 	///
 	trans := dbOrm.Begin()
@@ -600,7 +671,7 @@ func invoiceAllSaleOrder(saleOrderId int64, enterpriseId int32, userId int32) Ok
 		invoiceDetal.OrderDetailId = &orderDetail.Id
 		invoiceDetal.Price = orderDetail.Price
 		invoiceDetal.ProductId = &orderDetail.ProductId
-		invoiceDetal.Quantity = (orderDetail.Quantity - orderDetail.QuantityInvoiced)
+		invoiceDetal.Quantity = roundQuantity(orderDetail.Quantity - orderDetail.QuantityInvoiced)
 		invoiceDetal.TotalAmount = orderDetail.TotalAmount
 		invoiceDetal.VatPercent = orderDetail.VatPercent
 		invoiceDetal.EnterpriseId = invoice.EnterpriseId
@@ -613,6 +684,10 @@ func invoiceAllSaleOrder(saleOrderId int64, enterpriseId int32, userId int32) Ok
 
 	invoiceSalesOrderDiscounts(saleOrderId, invoiceId, enterpriseId, userId, *trans)
 
+	if !registerIssuedSalesInvoice(invoiceId, enterpriseId, trans) {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4}
+	}
+
 	go ecommerceControllerupdateStatusPaymentAccepted(saleOrderId, invoice.EnterpriseId)
 
 	///
@@ -620,8 +695,10 @@ func invoiceAllSaleOrder(saleOrderId int64, enterpriseId int32, userId int32) Ok
 	if result.Error != nil {
 		return OkAndErrorCodeReturn{Ok: false}
 	}
-	return OkAndErrorCodeReturn{Ok: true}
 	///
+
+	go submitSalesInvoiceRegister(enterpriseId)
+	return OkAndErrorCodeReturn{Ok: true}
 }
 
 type OrderDetailGenerate struct {
@@ -630,8 +707,12 @@ type OrderDetailGenerate struct {
 }
 
 type OrderDetailGenerateSelection struct {
-	Id       int64 `json:"id"`
-	Quantity int32 `json:"quantity"`
+	Id            int64      `json:"id"`
+	Quantity      float64    `json:"quantity"`
+	LotNumber     string     `json:"lotNumber"`     // Only for delivery notes of products with lot tracking
+	ExpiryDate    *time.Time `json:"expiryDate"`    // Only for purchase delivery notes
+	SerialNumbers []string   `json:"serialNumbers"` // Only for delivery notes of products with serial number tracking
+	LocationId    *int32     `json:"locationId"`    // Only for delivery notes, location in the warehouse where the product is put away or picked from
 }
 
 // ERROR CODES:
@@ -639,6 +720,8 @@ type OrderDetailGenerateSelection struct {
 // 2. The selected quantity is greater than the quantity in the detail
 // 3. The detail is already invoiced
 // 4. The selected quantity is greater than the quantity pending of invoicing in the detail
+// 5. The order is on hold because of the customer's risk
+// 6. The invoice can't be added to the invoice register
 func (invoiceInfo *OrderDetailGenerate) invoicePartiallySaleOrder(enterpriseId int32, userId int32) OkAndErrorCodeReturn {
 	// get the sale order and it's details
 	saleOrder := getSalesOrderRow(invoiceInfo.OrderId)
@@ -648,6 +731,9 @@ func (invoiceInfo *OrderDetailGenerate) invoicePartiallySaleOrder(enterpriseId i
 	if saleOrder.InvoicedLines >= saleOrder.LinesNumber {
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
 	}
+	if saleOrder.CreditHold {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 5}
+	}
 
 	var saleOrderDetails []SalesOrderDetail = make([]SalesOrderDetail, 0)
 	for i := 0; i < len(invoiceInfo.Selection); i++ {
@@ -663,7 +749,7 @@ func (invoiceInfo *OrderDetailGenerate) invoicePartiallySaleOrder(enterpriseId i
 			product := getProductRow(orderDetail.ProductId)
 			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3, ExtraData: []string{product.Name}}
 		}
-		if (invoiceInfo.Selection[i].Quantity + orderDetail.QuantityInvoiced) > orderDetail.Quantity {
+		if roundQuantity(invoiceInfo.Selection[i].Quantity+orderDetail.QuantityInvoiced) > orderDetail.Quantity {
 			product := getProductRow(orderDetail.ProductId)
 			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4, ExtraData: []string{product.Name}}
 		}
@@ -677,6 +763,7 @@ func (invoiceInfo *OrderDetailGenerate) invoicePartiallySaleOrder(enterpriseId i
 	invoice.BillingSeriesId = saleOrder.BillingSeriesId
 	invoice.CurrencyId = saleOrder.CurrencyId
 	invoice.PaymentMethodId = saleOrder.PaymentMethodId
+	invoice.SalesAgentId = saleOrder.SalesAgentId
 
 	///
 	trans := dbOrm.Begin()
@@ -717,6 +804,10 @@ func (invoiceInfo *OrderDetailGenerate) invoicePartiallySaleOrder(enterpriseId i
 
 	invoiceSalesOrderDiscounts(saleOrder.Id, invoiceId, enterpriseId, userId, *trans)
 
+	if !registerIssuedSalesInvoice(invoiceId, enterpriseId, trans) {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 6}
+	}
+
 	go ecommerceControllerupdateStatusPaymentAccepted(invoiceInfo.OrderId, invoice.EnterpriseId)
 
 	///
@@ -724,8 +815,10 @@ func (invoiceInfo *OrderDetailGenerate) invoicePartiallySaleOrder(enterpriseId i
 	if result.Error != nil {
 		return OkAndErrorCodeReturn{Ok: false}
 	}
-	return OkAndErrorCodeReturn{Ok: true}
 	///
+
+	go submitSalesInvoiceRegister(enterpriseId)
+	return OkAndErrorCodeReturn{Ok: true}
 }
 
 type SalesInvoiceRelations struct {
@@ -24,7 +24,7 @@ type SalesInvoiceDetail struct {
 	ProductId     *int32            `json:"productId" gorm:"column:product;index:sales_invoice_detail_invoice_product,unique:true,priority:2"`
 	Product       *Product          `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
 	Price         float64           `json:"price" gorm:"column:price;not null:true;type:numeric(14,6)"`
-	Quantity      int32             `json:"quantity" gorm:"column:quantity;not null:true"`
+	Quantity      float64           `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
 	VatPercent    float64           `json:"vatPercent" gorm:"column:vat_percent;not null:true;type:numeric(14,6)"`
 	TotalAmount   float64           `json:"totalAmount" gorm:"column:total_amount;not null:true;type:numeric(14,6)"`
 	OrderDetailId *int64            `json:"orderDetailId" gorm:"column:order_detail"`
@@ -73,6 +73,7 @@ func (s *SalesInvoiceDetail) BeforeCreate(tx *gorm.DB) (err error) {
 // 1. the product is deactivated
 // 2. there is aleady a detail with this product
 // 3. can't add details to a posted invoice
+// 4. can't add details to an invoice in the invoice register
 func (s *SalesInvoiceDetail) insertSalesInvoiceDetail(trans *gorm.DB, userId int32) OkAndErrorCodeReturn {
 	if !s.isValid() {
 		return OkAndErrorCodeReturn{Ok: false}
@@ -92,7 +93,7 @@ func (s *SalesInvoiceDetail) insertSalesInvoiceDetail(trans *gorm.DB, userId int
 		}
 	}
 
-	s.TotalAmount = (s.Price * float64(s.Quantity)) * (1 + (s.VatPercent / 100))
+	s.TotalAmount = (s.Price * s.Quantity) * (1 + (s.VatPercent / 100))
 
 	var beginTransaction bool = (trans == nil)
 	if beginTransaction {
@@ -129,6 +130,10 @@ func (s *SalesInvoiceDetail) insertSalesInvoiceDetail(trans *gorm.DB, userId int
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
 	}
+	if isSalesInvoiceRegistered(invoice.Id, invoice.EnterpriseId, *trans) {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4}
+	}
 
 	result = trans.Create(&s)
 	if result.Error != nil {
@@ -137,7 +142,7 @@ func (s *SalesInvoiceDetail) insertSalesInvoiceDetail(trans *gorm.DB, userId int
 		return OkAndErrorCodeReturn{Ok: false}
 	}
 
-	ok := addTotalProductsSalesInvoice(s.InvoiceId, s.Price*float64(s.Quantity), s.VatPercent, s.EnterpriseId, userId, *trans)
+	ok := addTotalProductsSalesInvoice(s.InvoiceId, s.Price*s.Quantity, s.VatPercent, s.EnterpriseId, userId, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
@@ -170,6 +175,7 @@ func (s *SalesInvoiceDetail) insertSalesInvoiceDetail(trans *gorm.DB, userId int
 // 1. can't delete posted invoices
 // 2. the invoice deletion is completely disallowed by policy
 // 3. it is only allowed to delete the latest invoice of the billing series
+// 4. can't delete details of an invoice in the invoice register
 func (d *SalesInvoiceDetail) deleteSalesInvoiceDetail(userId int32, trans *gorm.DB) OkAndErrorCodeReturn {
 	if d.Id <= 0 {
 		return OkAndErrorCodeReturn{Ok: false}
@@ -196,6 +202,10 @@ func (d *SalesInvoiceDetail) deleteSalesInvoiceDetail(userId int32, trans *gorm.
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
 	}
+	if isSalesInvoiceRegistered(i.Id, i.EnterpriseId, *trans) {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4}
+	}
 
 	// INVOICE DELETION POLICY
 	s := getSettingsRecordById(d.EnterpriseId)
@@ -228,7 +238,7 @@ func (d *SalesInvoiceDetail) deleteSalesInvoiceDetail(userId int32, trans *gorm.
 		return OkAndErrorCodeReturn{Ok: false}
 	}
 
-	ok := addTotalProductsSalesInvoice(detailInMemory.InvoiceId, -(detailInMemory.Price * float64(detailInMemory.Quantity)), detailInMemory.VatPercent, d.EnterpriseId, userId, *trans)
+	ok := addTotalProductsSalesInvoice(detailInMemory.InvoiceId, -(detailInMemory.Price * detailInMemory.Quantity), detailInMemory.VatPercent, d.EnterpriseId, userId, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
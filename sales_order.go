@@ -62,6 +62,9 @@ type SaleOrder struct {
 	WooCommerceId       int32         `json:"-" gorm:"column:wc_id;not null:true;index:sales_order_wc_id,unique:true,priority:2,where:wc_id <> 0"`
 	ShopifyId           int64         `json:"-" gorm:"column:sy_id;not null:true;index:sales_order_sy_id,unique:true,priority:2,where:sy_id <> 0"`
 	ShopifyDraftId      int64         `json:"-" gorm:"column:sy_draft_id;not null:true;index:sales_order_sy_draft_id,unique:true,priority:2,where:sy_draft_id <> 0"`
+	CreditHold          bool          `json:"creditHold" gorm:"not null:true;default:false"` // The order exceeded the customer's risk, it can't be delivered or invoiced until it's released
+	SalesAgentId        *int32        `json:"salesAgentId" gorm:"column:sales_agent"`
+	SalesAgent          *SalesAgent   `json:"salesAgent" gorm:"foreignKey:SalesAgentId,EnterpriseId;references:Id,EnterpriseId"`
 	EnterpriseId        int32         `json:"-" gorm:"column:enterprise;not null:true;index:sales_order_id_enterprise,unique:true,priority:2;index:sales_order_order_number,unique:true,priority:1;index:sales_order_ps_id,unique:true,priority:1,where:ps_id <> 0;index:sales_order_sy_draft_id,unique:true,priority:1,where:sy_draft_id <> 0;index:sales_order_sy_id,unique:true,priority:1,where:sy_id <> 0;index:sales_order_wc_id,unique:true,priority:1,where:wc_id <> 0"`
 	Enterprise          Settings      `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 }
@@ -247,15 +250,37 @@ func (s *SaleOrder) BeforeCreate(tx *gorm.DB) (err error) {
 	return nil
 }
 
-func (s *SaleOrder) insertSalesOrder(userId int32) (bool, int64) {
+// ERROR CODES:
+// 1. The customer has exceeded the credit limit
+// 2. The customer has overdue payments
+// If the customer's orders have to be put on hold instead of being rejected, the order is created on hold, and the error code is returned with Ok = true.
+func (s *SaleOrder) insertSalesOrder(userId int32, trans *gorm.DB) (OkAndErrorCodeReturn, int64) {
 	if !s.isValid() {
-		return false, 0
+		return OkAndErrorCodeReturn{Ok: false}, 0
 	}
 
 	s.OrderNumber = getNextSaleOrderNumber(s.BillingSeriesId, s.EnterpriseId)
 	if s.OrderNumber <= 0 {
-		return false, 0
+		return OkAndErrorCodeReturn{Ok: false}, 0
 	}
+
+	// check the customer's risk before accepting the order, the lines are checked when they are added
+	risk := checkCustomerRisk(s.CustomerId, s.EnterpriseId, s.ShippingPrice-s.ShippingDiscount-s.FixDiscount)
+	s.CreditHold = false
+	if !risk.Ok {
+		customer := getCustomerRow(s.CustomerId)
+		if customer.CreditRiskAction != "H" {
+			return risk, 0
+		}
+		s.CreditHold = true
+	}
+
+	// the commissions of the order go to the customer's sales agent
+	if s.SalesAgentId == nil {
+		customer := getCustomerRow(s.CustomerId)
+		s.SalesAgentId = customer.SalesAgentId
+	}
+
 	s.CurrencyChange = getCurrencyExchange(s.CurrencyId)
 	now := time.Now()
 	s.OrderName = s.BillingSeriesId + "/" + strconv.Itoa(now.Year()) + "/" + fmt.Sprintf("%06d", s.OrderNumber)
@@ -272,17 +297,22 @@ func (s *SaleOrder) insertSalesOrder(userId int32) (bool, int64) {
 	s.DeliveryNoteLines = 0
 	s.TotalProducts = 0
 
-	result := dbOrm.Create(&s)
+	var result *gorm.DB
+	if trans == nil {
+		result = dbOrm.Create(&s)
+	} else {
+		result = trans.Create(&s)
+	}
 	if result.Error != nil {
 		log("DB", result.Error.Error())
-		return false, 0
+		return OkAndErrorCodeReturn{Ok: false}, 0
 	}
 
 	insertTransactionalLog(s.EnterpriseId, "sales_order", int(s.Id), userId, "I")
 	json, _ := json.Marshal(s)
 	go fireWebHook(s.EnterpriseId, "sales_order", "POST", string(json))
 
-	return true, s.Id
+	return OkAndErrorCodeReturn{Ok: true, ErrorCode: risk.ErrorCode, ExtraData: risk.ExtraData}, s.Id
 }
 
 func (s *SaleOrder) updateSalesOrder(userId int32) bool {
@@ -328,6 +358,7 @@ func (s *SaleOrder) updateSalesOrder(userId int32) bool {
 		inMemoryOrder.Reference = s.Reference
 		inMemoryOrder.CarrierId = s.CarrierId
 		inMemoryOrder.ShopifyId = s.ShopifyId
+		inMemoryOrder.SalesAgentId = s.SalesAgentId
 
 	} else {
 		inMemoryOrder.CustomerId = s.CustomerId
@@ -337,6 +368,7 @@ func (s *SaleOrder) updateSalesOrder(userId int32) bool {
 		inMemoryOrder.Notes = s.Notes
 		inMemoryOrder.Reference = s.Reference
 		inMemoryOrder.CarrierId = s.CarrierId
+		inMemoryOrder.SalesAgentId = s.SalesAgentId
 	}
 
 	result = trans.Save(&inMemoryOrder)
@@ -450,6 +482,22 @@ func (s *SaleOrder) deleteSalesOrder(userId int32) OkAndErrorCodeReturn {
 		}
 	}
 
+	// the quotations that generated this order can be accepted again
+	result = trans.Model(&SalesQuotation{}).Where("sales_order = ? AND enterprise = ?", s.Id, s.EnterpriseId).Updates(map[string]interface{}{"sales_order": nil, "status": "_", "date_answered": nil})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	// keep the subscription log, without the deleted order
+	result = trans.Model(&SalesSubscriptionLog{}).Where("sales_order = ? AND enterprise = ?", s.Id, s.EnterpriseId).Update("sales_order", nil)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
 	insertTransactionalLog(s.EnterpriseId, "sales_order", int(s.Id), userId, "D")
 	inMemoryOrder := getSalesOrderRow(s.Id)
 	json, _ := json.Marshal(inMemoryOrder)
@@ -593,6 +641,8 @@ type SalesOrderRelations struct {
 	ComplexManufacturingOrders []ComplexManufacturingOrder `json:"complexManufacturingOrders"`
 	DeliveryNotes              []SalesDeliveryNote         `json:"deliveryNotes"`
 	Shippings                  []Shipping                  `json:"shippings"`
+	Quotations                 []SalesQuotation            `json:"quotations"`
+	Returns                    []SalesReturn               `json:"returns"`
 }
 
 func getSalesOrderRelations(orderId int64, enterpriseId int32) SalesOrderRelations {
@@ -602,6 +652,8 @@ func getSalesOrderRelations(orderId int64, enterpriseId int32) SalesOrderRelatio
 		DeliveryNotes:              getSalesOrderDeliveryNotes(orderId, enterpriseId),
 		Shippings:                  getSalesOrderShippings(orderId, enterpriseId),
 		ComplexManufacturingOrders: getSalesOrderComplexManufacturingOrders(orderId, enterpriseId),
+		Quotations:                 getSalesOrderQuotations(orderId, enterpriseId),
+		Returns:                    getSalesOrderReturns(orderId, enterpriseId),
 	}
 }
 
@@ -697,6 +749,22 @@ func getSalesOrderDeliveryNotes(orderId int64, enterpriseId int32) []SalesDelive
 				notes = append(notes, note)
 			}
 		}
+		if salesOrderDetails[i].DropShipping {
+			var dropShippingDetails []DropShippingDeliveryNoteDetail
+			dbOrm.Model(&DropShippingDeliveryNoteDetail{}).Where("sales_order_detail = ?", salesOrderDetails[i].Id).Find(&dropShippingDetails)
+			for j := 0; j < len(dropShippingDetails); j++ {
+				var ok bool = true
+				for k := 0; k < len(notes); k++ {
+					if notes[k].Id == dropShippingDetails[j].DeliveryNoteId {
+						ok = false
+						break
+					}
+				}
+				if ok {
+					notes = append(notes, getSalesDeliveryNoteRow(dropShippingDetails[j].DeliveryNoteId))
+				}
+			}
+		}
 	}
 	return notes
 }
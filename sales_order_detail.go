@@ -27,13 +27,13 @@ type SalesOrderDetail struct {
 	ProductId                int32                `json:"productId" gorm:"column:product;not null:true;index:sales_order_detail_sales_order_product,unique:true,priority:2"`
 	Product                  Product              `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
 	Price                    float64              `json:"price" gorm:"column:price;not null:true;type:numeric(14,6)"`
-	Quantity                 int32                `json:"quantity" gorm:"column:quantity;not null:true"`
+	Quantity                 float64              `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
 	VatPercent               float64              `json:"vatPercent" gorm:"column:vat_percent;not null:true;type:numeric(14,6)"`
 	TotalAmount              float64              `json:"totalAmount" gorm:"column:total_amount;not null:true;type:numeric(14,6)"`
-	QuantityInvoiced         int32                `json:"quantityInvoiced" gorm:"column:quantity_invoiced;not null:true"`
-	QuantityDeliveryNote     int32                `json:"quantityDeliveryNote" gorm:"column:quantity_delivery_note;not null:true"`
+	QuantityInvoiced         float64              `json:"quantityInvoiced" gorm:"type:numeric(14,6);column:quantity_invoiced;not null:true"`
+	QuantityDeliveryNote     float64              `json:"quantityDeliveryNote" gorm:"type:numeric(14,6);column:quantity_delivery_note;not null:true"`
 	Status                   string               `json:"status" gorm:"type:character(1);not null:true"` // _ = Waiting for payment, A = Waiting for purchase order, B = Purchase order pending, C = Waiting for manufacturing orders, D = Manufacturing orders pending, E = Sent to preparation, F = Awaiting for shipping, G = Shipped, H = Receiced by the customer, Z = Cancelled
-	QuantityPendingPackaging int32                `json:"quantityPendingPackaging" gorm:"column:quantity_pending_packaging;not null:true"`
+	QuantityPendingPackaging float64              `json:"quantityPendingPackaging" gorm:"type:numeric(14,6);column:quantity_pending_packaging;not null:true"`
 	PurchaseOrderDetailId    *int64               `json:"purchaseOrderDetailId" gorm:"column:purchase_order_detail"`
 	PurchaseOrderDetail      *PurchaseOrderDetail `json:"-" gorm:"foreignKey:PurchaseOrderDetailId,EnterpriseId;references:Id,EnterpriseId"`
 	PrestaShopId             int32                `json:"-" gorm:"column:ps_id;not null:true;index:sales_order_detail_ps_id,unique:true,priority:2,where:ps_id <> 0"`
@@ -42,6 +42,11 @@ type SalesOrderDetail struct {
 	ShopifyId                int64                `json:"-" gorm:"column:sy_id;not null:true;index:sales_order_detail_sy_id,unique:true,priority:2,where:sy_id <> 0"`
 	ShopifyDraftId           int64                `json:"-" gorm:"column:sy_draft_id;not null:true;index:sales_order_detail_sy_draft_id,unique:true,priority:2,where:sy_draft_id <> 0"`
 	IncludedProducts         bool                 `json:"includedProducts" gorm:"column:included_products;type:boolean;not null:true;default:false"`
+	DropShipping             bool                 `json:"dropShipping" gorm:"column:drop_shipping;type:boolean;not null:true;default:false"` // The detail is purchased and shipped by the supplier to the customer, without going through our warehouses
+	UnitOfMeasureId          *int32               `json:"unitOfMeasureId" gorm:"column:unit_of_measure"`                                     // Unit in which the quantity has been entered, if it's not set the quantity is in units of stock
+	UnitOfMeasure            *UnitOfMeasure       `json:"unitOfMeasure" gorm:"foreignKey:UnitOfMeasureId,EnterpriseId;references:Id,EnterpriseId"`
+	UnitQuantity             float64              `json:"unitQuantity" gorm:"type:numeric(14,6);column:unit_quantity;not null:true;default:0"` // Quantity in the unit of measure of the line
+	UnitFactor               int32                `json:"unitFactor" gorm:"column:unit_factor;not null:true;default:0"`                        // Units of stock in one unit of measure of the line, when the line was saved
 	EnterpriseId             int32                `json:"-" gorm:"column:enterprise;not null:true;index:sales_order_detail_id_enterprise,unique:true,priority:2;index:sales_order_detail_ps_id,unique:true,priority:1,where:ps_id <> 0;index:sales_order_detail_sy_draft_id,unique:true,priority:1,where:sy_draft_id <> 0;;index:sales_order_detail_sy_id,unique:true,priority:1,where:sy_id <> 0;index:sales_order_detail_wc_id,unique:true,priority:1,where:wc_id <> 0"`
 	Enterprise               Settings             `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 }
@@ -126,7 +131,7 @@ func getSalesOrderDetailRowByOrderAndProduct(orderId int64, productId int32) *Sa
 func getSalesOrderDetailWaitingForPurchaseOrder(productId int32) []SalesOrderDetail {
 	var details []SalesOrderDetail = make([]SalesOrderDetail, 0)
 	// get all the sale order details from the database where the order id is the same as the one passed and the enterprise id is the same as the one passed order by id using dbOrm
-	result := dbOrm.Where("product = ? AND status = 'A'", productId).Order("id ASC").Preload(clause.Associations).Find(&details)
+	result := dbOrm.Where("product = ? AND status = 'A' AND NOT drop_shipping", productId).Order("id ASC").Preload(clause.Associations).Find(&details)
 	if result.Error != nil {
 		log("DB", result.Error.Error())
 		return details
@@ -152,6 +157,21 @@ func (s *SalesOrderDetail) isValid() bool {
 	return !(s.OrderId <= 0 || s.ProductId <= 0 || s.Quantity <= 0 || s.VatPercent < 0)
 }
 
+// Computes the quantity in units of stock when the quantity of the line has been entered in an alternative unit of measure.
+// The quantity is rounded to the decimal places of the product.
+func (s *SalesOrderDetail) setQuantityFromUnitOfMeasure() bool {
+	quantity, factor, ok := convertLineQuantity(s.ProductId, s.UnitOfMeasureId, s.UnitQuantity, s.Quantity, true, s.EnterpriseId)
+	if !ok {
+		return false
+	}
+	if s.UnitOfMeasureId == nil {
+		s.UnitQuantity = 0
+	}
+	s.Quantity = roundProductQuantity(s.ProductId, quantity)
+	s.UnitFactor = factor
+	return true
+}
+
 func (s *SalesOrderDetail) BeforeCreate(tx *gorm.DB) (err error) {
 	var salesOrderDetail SalesOrderDetail
 	tx.Model(&SalesOrderDetail{}).Last(&salesOrderDetail)
@@ -161,7 +181,14 @@ func (s *SalesOrderDetail) BeforeCreate(tx *gorm.DB) (err error) {
 
 // 1. the product is deactivated
 // 2. there is aleady a detail with this product
-func (s *SalesOrderDetail) insertSalesOrderDetail(userId int32) OkAndErrorCodeReturn {
+// 3. the customer has exceeded the credit limit, the line is rejected, or the order is put on hold (Ok = true) if the customer's orders are put on hold
+// 4. the customer has overdue payments, the line is rejected, or the order is put on hold (Ok = true) if the customer's orders are put on hold
+// 5. the unit of measure can't be used to sell the product
+// If a transaction is given, the included products of the product are not added, the caller has to call processProductIncludedProductOnNewInsertedLine after the commit.
+func (s *SalesOrderDetail) insertSalesOrderDetail(userId int32, trans *gorm.DB) OkAndErrorCodeReturn {
+	if !s.setQuantityFromUnitOfMeasure() {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 5}
+	}
 	if !s.isValid() {
 		return OkAndErrorCodeReturn{Ok: false}
 	}
@@ -175,12 +202,19 @@ func (s *SalesOrderDetail) insertSalesOrderDetail(userId int32) OkAndErrorCodeRe
 	}
 	config := getSettingsRecordById(s.EnterpriseId)
 
-	s.TotalAmount = (s.Price * float64(s.Quantity)) * (1 + (s.VatPercent / 100))
+	s.TotalAmount = (s.Price * s.Quantity) * (1 + (s.VatPercent / 100))
 	s.Status = "_"
+	s.DropShipping = s.DropShipping || p.DropShipping
+
+	// the order can be created in the same transaction, and it's not visible outside of the transaction yet
+	var orderQuery *gorm.DB = dbOrm
+	if trans != nil {
+		orderQuery = trans
+	}
 
 	// the product and sale order are unique, there can't exist another detail for the same product in the same order
 	var countProductInSaleOrder int64
-	result := dbOrm.Model(&SalesOrderDetail{}).Where("product = ? AND \"order\" = ?", s.ProductId, s.OrderId).Count(&countProductInSaleOrder)
+	result := orderQuery.Model(&SalesOrderDetail{}).Where("product = ? AND \"order\" = ?", s.ProductId, s.OrderId).Count(&countProductInSaleOrder)
 	if result.Error != nil {
 		log("DB", result.Error.Error())
 		return OkAndErrorCodeReturn{Ok: false}
@@ -189,10 +223,20 @@ func (s *SalesOrderDetail) insertSalesOrderDetail(userId int32) OkAndErrorCodeRe
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
 	}
 
+	// the order was accepted, but if the new line exceeds the customer's risk the line is rejected,
+	// or the order can't be delivered or invoiced until it's released
+	risk, hold := checkSalesOrderDetailCustomerRisk(getSalesOrderRowTransaction(s.OrderId, *orderQuery), s.TotalAmount)
+	if !risk.Ok && !hold {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: risk.ErrorCode + 2, ExtraData: risk.ExtraData}
+	}
+
 	///
-	trans := dbOrm.Begin()
-	if trans.Error != nil {
-		return OkAndErrorCodeReturn{Ok: false}
+	var beginTrans bool = (trans == nil)
+	if beginTrans {
+		trans = dbOrm.Begin()
+		if trans.Error != nil {
+			return OkAndErrorCodeReturn{Ok: false}
+		}
 	}
 	///
 
@@ -210,7 +254,7 @@ func (s *SalesOrderDetail) insertSalesOrderDetail(userId int32) OkAndErrorCodeRe
 		return OkAndErrorCodeReturn{Ok: false}
 	}
 
-	ok := addTotalProductsSalesOrder(s.EnterpriseId, s.OrderId, userId, s.Price*float64(s.Quantity), s.VatPercent, *trans)
+	ok := addTotalProductsSalesOrder(s.EnterpriseId, s.OrderId, userId, s.Price*s.Quantity, s.VatPercent, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
@@ -225,28 +269,45 @@ func (s *SalesOrderDetail) insertSalesOrderDetail(userId int32) OkAndErrorCodeRe
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
 	}
-
-	///
-	result = trans.Commit()
-	if result.Error != nil {
+	if !risk.Ok && !putSalesOrderOnCreditHold(s.OrderId, s.EnterpriseId, *trans) {
 		return OkAndErrorCodeReturn{Ok: false}
 	}
-	///
 
-	s.processProductIncludedProductOnNewInsertedLine(s.EnterpriseId, userId)
+	if beginTrans {
+		///
+		result = trans.Commit()
+		if result.Error != nil {
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		///
+
+		s.processProductIncludedProductOnNewInsertedLine(s.EnterpriseId, userId)
+	}
 
 	insertTransactionalLog(s.EnterpriseId, "sales_order_detail", int(s.Id), userId, "I")
 	json, _ := json.Marshal(s)
 	go fireWebHook(s.EnterpriseId, "sales_order_detail", "POST", string(json))
 
+	if !risk.Ok {
+		return OkAndErrorCodeReturn{Ok: true, ErrorCode: risk.ErrorCode + 2, ExtraData: risk.ExtraData}
+	}
 	return OkAndErrorCodeReturn{Ok: true}
 }
 
 // 1. the product is deactivated
 // 2. there is aleady a detail with this product
 // 3. can't update an invoiced sale order detail
+// 4. the unit of measure can't be used to sell the product
+// 5. the customer has exceeded the credit limit, the change is rejected, or the order is put on hold (Ok = true) if the customer's orders are put on hold
+// 6. the customer has overdue payments, the change is rejected, or the order is put on hold (Ok = true) if the customer's orders are put on hold
 func (s *SalesOrderDetail) updateSalesOrderDetail(userId int32) OkAndErrorCodeReturn {
-	if s.Id <= 0 || !s.isValid() {
+	if s.Id <= 0 {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if !s.setQuantityFromUnitOfMeasure() {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4}
+	}
+	if !s.isValid() {
 		return OkAndErrorCodeReturn{Ok: false}
 	}
 
@@ -292,11 +353,25 @@ func (s *SalesOrderDetail) updateSalesOrderDetail(userId int32) OkAndErrorCodeRe
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
 	}
 
-	s.TotalAmount = (s.Price * float64(s.Quantity)) * (1 + (s.VatPercent / 100))
+	s.TotalAmount = (s.Price * s.Quantity) * (1 + (s.VatPercent / 100))
 	oldQuantity := inMemoryDetail.Quantity
 
+	// an increase of the amount of the line is checked against the customer's risk as a new line
+	risk := OkAndErrorCodeReturn{Ok: true}
+	if s.TotalAmount > inMemoryDetail.TotalAmount {
+		var hold bool
+		risk, hold = checkSalesOrderDetailCustomerRisk(getSalesOrderRowTransaction(inMemoryDetail.OrderId, *trans), s.TotalAmount-inMemoryDetail.TotalAmount)
+		if !risk.Ok && !hold {
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: risk.ErrorCode + 4, ExtraData: risk.ExtraData}
+		}
+		if !risk.Ok && !putSalesOrderOnCreditHold(inMemoryDetail.OrderId, s.EnterpriseId, *trans) {
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+	}
+
 	// take out the old value
-	ok := addTotalProductsSalesOrder(s.EnterpriseId, inMemoryDetail.OrderId, userId, -(inMemoryDetail.Price * float64(inMemoryDetail.Quantity)), inMemoryDetail.VatPercent, *trans)
+	ok := addTotalProductsSalesOrder(s.EnterpriseId, inMemoryDetail.OrderId, userId, -(inMemoryDetail.Price * inMemoryDetail.Quantity), inMemoryDetail.VatPercent, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
@@ -308,6 +383,9 @@ func (s *SalesOrderDetail) updateSalesOrderDetail(userId int32) OkAndErrorCodeRe
 	inMemoryDetail.VatPercent = s.VatPercent
 	inMemoryDetail.TotalAmount = s.TotalAmount
 	inMemoryDetail.ShopifyId = s.ShopifyId
+	inMemoryDetail.UnitOfMeasureId = s.UnitOfMeasureId
+	inMemoryDetail.UnitQuantity = s.UnitQuantity
+	inMemoryDetail.UnitFactor = s.UnitFactor
 
 	// save the detail in the database using dbOrm
 	result = dbOrm.Save(&inMemoryDetail)
@@ -318,7 +396,7 @@ func (s *SalesOrderDetail) updateSalesOrderDetail(userId int32) OkAndErrorCodeRe
 	}
 
 	// add the new value
-	ok = addTotalProductsSalesOrder(s.EnterpriseId, s.OrderId, userId, s.Price*float64(s.Quantity), s.VatPercent, *trans)
+	ok = addTotalProductsSalesOrder(s.EnterpriseId, s.OrderId, userId, s.Price*s.Quantity, s.VatPercent, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
@@ -337,6 +415,9 @@ func (s *SalesOrderDetail) updateSalesOrderDetail(userId int32) OkAndErrorCodeRe
 	json, _ := json.Marshal(s)
 	go fireWebHook(s.EnterpriseId, "sales_order_detail", "PUT", string(json))
 
+	if !risk.Ok {
+		return OkAndErrorCodeReturn{Ok: true, ErrorCode: risk.ErrorCode + 4, ExtraData: risk.ExtraData}
+	}
 	return OkAndErrorCodeReturn{Ok: true}
 }
 
@@ -445,6 +526,14 @@ func (s *SalesOrderDetail) deleteSalesOrderDetail(userId int32, trans *gorm.DB)
 		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 7}
 	}
 
+	// unlink the quotation detail that generated this detail
+	result = trans.Model(&SalesQuotationDetail{}).Where("sales_order_detail = ?", s.Id).Update("sales_order_detail", nil)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
 	insertTransactionalLog(s.EnterpriseId, "sales_order_detail", int(s.Id), userId, "D")
 	json, _ := json.Marshal(s)
 	go fireWebHook(s.EnterpriseId, "sales_order_detail", "DELETE", string(json))
@@ -456,7 +545,7 @@ func (s *SalesOrderDetail) deleteSalesOrderDetail(userId int32, trans *gorm.DB)
 		return OkAndErrorCodeReturn{Ok: false}
 	}
 
-	ok := addTotalProductsSalesOrder(s.EnterpriseId, detailInMemory.OrderId, userId, -(detailInMemory.Price * float64(detailInMemory.Quantity)), detailInMemory.VatPercent, *trans)
+	ok := addTotalProductsSalesOrder(s.EnterpriseId, detailInMemory.OrderId, userId, -(detailInMemory.Price * detailInMemory.Quantity), detailInMemory.VatPercent, *trans)
 	if !ok {
 		trans.Rollback()
 		return OkAndErrorCodeReturn{Ok: false}
@@ -488,7 +577,7 @@ func (s *SalesOrderDetail) deleteSalesOrderDetail(userId int32, trans *gorm.DB)
 
 // Adds an invoiced quantity to the sale order detail. This function will subsctract from the quantity if the amount is negative.
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION.
-func addQuantityInvociedSalesOrderDetail(detailId int64, quantity int32, userId int32, trans gorm.DB) bool {
+func addQuantityInvociedSalesOrderDetail(detailId int64, quantity float64, userId int32, trans gorm.DB) bool {
 	detailBefore := getSalesOrderDetailRowTransaction(detailId, trans)
 	if detailBefore.Id <= 0 {
 		return false
@@ -503,7 +592,7 @@ func addQuantityInvociedSalesOrderDetail(detailId int64, quantity int32, userId
 		return false
 	}
 
-	detailAfter.QuantityInvoiced += quantity
+	detailAfter.QuantityInvoiced = roundQuantity(detailAfter.QuantityInvoiced + quantity)
 
 	result := trans.Model(&SalesOrderDetail{}).Where("id = ?", detailId).Update("quantity_invoiced", detailAfter.QuantityInvoiced)
 	if result.Error != nil {
@@ -514,7 +603,8 @@ func addQuantityInvociedSalesOrderDetail(detailId int64, quantity int32, userId
 
 	var ok bool
 	if detailBefore.QuantityInvoiced != detailBefore.Quantity && detailAfter.QuantityInvoiced == detailAfter.Quantity { // set as invoced
-		ok = addQuantityPendingServing(detailBefore.ProductId, detailBefore.WarehouseId, detailBefore.Quantity, detailBefore.EnterpriseId, trans)
+		// the drop shipping details are not served from our warehouses
+		ok = detailBefore.DropShipping || addQuantityPendingServing(detailBefore.ProductId, detailBefore.WarehouseId, detailBefore.Quantity, detailBefore.EnterpriseId, trans)
 		// set the order detail state applying the workflow logic
 		if ok {
 			status, purchaseOrderDetail, warehouseId := detailBefore.computeStatus(userId, trans)
@@ -543,7 +633,7 @@ func addQuantityInvociedSalesOrderDetail(detailId int64, quantity int32, userId
 			return false
 		}
 	} else if detailBefore.QuantityInvoiced == detailBefore.Quantity && detailAfter.QuantityInvoiced != detailAfter.Quantity { // undo invoiced
-		ok = addQuantityPendingServing(detailBefore.ProductId, detailBefore.WarehouseId, -detailBefore.Quantity, detailBefore.EnterpriseId, trans)
+		ok = detailBefore.DropShipping || addQuantityPendingServing(detailBefore.ProductId, detailBefore.WarehouseId, -detailBefore.Quantity, detailBefore.EnterpriseId, trans)
 		// reset order detail state to "Waiting for Payment"
 		if ok {
 			detailAfter.Status = "_"
@@ -615,7 +705,9 @@ func (s *SalesOrderDetail) computeStatus(userId int32, trans gorm.DB) (string, *
 
 	order := getSalesOrderRow(s.OrderId)
 	stock := getStockRowAvailable(s.ProductId, s.EnterpriseId)
-	if !product.ControlStock {
+	if s.DropShipping { // the detail waits for its own purchase order, it can't use the stock or the pending purchases
+		return "A", nil, ""
+	} else if !product.ControlStock {
 		return "E", nil, ""
 	} else if stock.QuantityAvaiable > 0 { // the product is in stock, send to preparation
 		return "E", nil, stock.WarehouseId
@@ -633,8 +725,8 @@ func (s *SalesOrderDetail) computeStatus(userId int32, trans gorm.DB) (string, *
 				defer rows.Close()
 
 				var orders []int64 = make([]int64, 0)
-				var quantities []int32 = make([]int32, 0)
-				var totalQuantityManufactured int32 = 0
+				var quantities []float64 = make([]float64, 0)
+				var totalQuantityManufactured float64 = 0
 				var warehouseId string
 
 				for rows.Next() {
@@ -645,11 +737,11 @@ func (s *SalesOrderDetail) computeStatus(userId int32, trans gorm.DB) (string, *
 
 					com := getManufacturingOrderTypeComponentRow(manufacturingOrderTypeComponentId)
 					quantities = append(quantities, com.Quantity)
-					totalQuantityManufactured += com.Quantity
+					totalQuantityManufactured = roundQuantity(totalQuantityManufactured + com.Quantity)
 				}
 
 				if totalQuantityManufactured >= s.Quantity {
-					var quantityAssigned int32 = 0
+					var quantityAssigned float64 = 0
 					for i := 0; i < len(orders); i++ {
 						result := trans.Model(&ComplexManufacturingOrderManufacturingOrder{}).Where("sale_order_detail = ?", orders[i]).Update("sale_order_detail", s.Id)
 						if result.Error != nil {
@@ -658,7 +750,7 @@ func (s *SalesOrderDetail) computeStatus(userId int32, trans gorm.DB) (string, *
 							return "C", nil, ""
 						}
 
-						quantityAssigned += quantities[i]
+						quantityAssigned = roundQuantity(quantityAssigned + quantities[i])
 						if quantityAssigned >= s.Quantity {
 							break
 						}
@@ -690,7 +782,7 @@ func (s *SalesOrderDetail) computeStatus(userId int32, trans gorm.DB) (string, *
 					quantities = append(quantities, quantityManufactured)
 				}
 
-				if totalQuantityManufactured < s.Quantity {
+				if float64(totalQuantityManufactured) < s.Quantity {
 					return "C", nil, ""
 				} else {
 					var quantityAssigned int32 = 0
@@ -706,7 +798,7 @@ func (s *SalesOrderDetail) computeStatus(userId int32, trans gorm.DB) (string, *
 						}
 
 						quantityAssigned += quantities[i]
-						if quantityAssigned >= s.Quantity {
+						if float64(quantityAssigned) >= s.Quantity {
 							break
 						}
 					}
@@ -716,7 +808,7 @@ func (s *SalesOrderDetail) computeStatus(userId int32, trans gorm.DB) (string, *
 		} else {
 			// search for pending purchases using dbOrm
 			var purchaseDetail PurchaseOrderDetail
-			result := dbOrm.Model(&PurchaseOrderDetail{}).Where("product = ? AND quantity_delivery_note = 0 AND quantity - quantity_assigned_sale >= ?", s.ProductId, s.Quantity).Order(`(SELECT date_created FROM purchase_order WHERE purchase_order.id=purchase_order_detail."order") ASC`).Limit(1).First(&purchaseDetail)
+			result := dbOrm.Model(&PurchaseOrderDetail{}).Where("product = ? AND quantity_delivery_note = 0 AND quantity - quantity_assigned_sale >= ? AND NOT (SELECT drop_shipping FROM purchase_order WHERE purchase_order.id=purchase_order_detail.\"order\")", s.ProductId, s.Quantity).Order(`(SELECT date_created FROM purchase_order WHERE purchase_order.id=purchase_order_detail."order") ASC`).Limit(1).First(&purchaseDetail)
 			if result.Error != nil {
 				log("DB", result.Error.Error())
 				// fallback
@@ -740,13 +832,13 @@ func (s *SalesOrderDetail) computeStatus(userId int32, trans gorm.DB) (string, *
 }
 
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION.
-func addQuantityPendingPackagingSaleOrderDetail(detailId int64, quantity int32, userId int32, trans gorm.DB) bool {
+func addQuantityPendingPackagingSaleOrderDetail(detailId int64, quantity float64, userId int32, trans gorm.DB) bool {
 	detail := getSalesOrderDetailRow(detailId)
 	if detail.Id <= 0 {
 		trans.Rollback()
 		return false
 	}
-	detail.QuantityPendingPackaging += quantity
+	detail.QuantityPendingPackaging = roundQuantity(detail.QuantityPendingPackaging + quantity)
 
 	if detail.QuantityPendingPackaging <= 0 {
 		detail.Status = "F"
@@ -775,7 +867,7 @@ func addQuantityPendingPackagingSaleOrderDetail(detailId int64, quantity int32,
 }
 
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION.
-func addQuantityDeliveryNoteSalesOrderDetail(detailId int64, quantity int32, userId int32, trans gorm.DB) bool {
+func addQuantityDeliveryNoteSalesOrderDetail(detailId int64, quantity float64, userId int32, trans gorm.DB) bool {
 	detailBefore := getSalesOrderDetailRowTransaction(detailId, trans)
 	if detailBefore.Id <= 0 {
 		return false
@@ -786,7 +878,7 @@ func addQuantityDeliveryNoteSalesOrderDetail(detailId int64, quantity int32, use
 		return false
 	}
 
-	detailAfter.QuantityDeliveryNote += quantity
+	detailAfter.QuantityDeliveryNote = roundQuantity(detailAfter.QuantityDeliveryNote + quantity)
 
 	result := trans.Model(&SalesOrderDetail{}).Where("id = ?", detailId).Update("quantity_delivery_note", detailAfter.QuantityDeliveryNote)
 	if result.Error != nil {
@@ -833,8 +925,8 @@ func cancelSalesOrderDetail(detailId int64, enterpriseId int32, userId int32) bo
 			return false
 		}
 
-		detail.QuantityInvoiced += detail.Quantity
-		detail.QuantityDeliveryNote += detail.Quantity
+		detail.QuantityInvoiced = roundQuantity(detail.QuantityInvoiced + detail.Quantity)
+		detail.QuantityDeliveryNote = roundQuantity(detail.QuantityDeliveryNote + detail.Quantity)
 		detail.Status = "Z"
 		detail.Cancelled = true
 
@@ -929,7 +1021,7 @@ type SalePurchasesOrderDetail struct {
 	Id          int32     `json:"id"`
 	OrderId     int64     `json:"orderId" gorm:"column:order;not null:true;index:sales_order_detail_sales_order_product,unique:true,priority:1"`
 	Order       SaleOrder `json:"-" gorm:"foreignKey:OrderId,EnterpriseId;references:Id,EnterpriseId"`
-	Quantity    int32     `json:"quantity"`
+	Quantity    float64   `json:"quantity"`
 	TotalAmount float64   `json:"totalAmount"`
 }
 
@@ -20,9 +20,10 @@ type SalesOrderDetailPackaged struct {
 	OrderDetail   SalesOrderDetail `json:"orderDetail" gorm:"foreignKey:OrderDetailId,EnterpriseId;references:Id,EnterpriseId"`
 	PackagingId   int64            `json:"packagingId" gorm:"primaryKey;column:packaging;not null:true"`
 	Packaging     Packaging        `json:"packaging" gorm:"foreignKey:PackagingId,EnterpriseId;references:Id,EnterpriseId"`
-	Quantity      int32            `json:"quantity" gorm:"column:quantity;not null:true"`
+	Quantity      float64          `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
 	EnterpriseId  int32            `json:"-" gorm:"column:enterprise;not null"`
 	Enterprise    Settings         `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+	SerialNumbers []string         `json:"serialNumbers" gorm:"-"` // Units packaged, only for products with serial number tracking
 }
 
 func (s *SalesOrderDetailPackaged) TableName() string {
@@ -51,7 +52,7 @@ func getSalesOrderDetailPackagedRow(orderDetailId int64, packagingId int64) Sale
 }
 
 func (p *SalesOrderDetailPackaged) isValid() bool {
-	return !(p.OrderDetailId <= 0 || p.PackagingId <= 0 || p.Quantity <= 0)
+	return !(p.OrderDetailId <= 0 || p.PackagingId <= 0 || p.Quantity <= 0 || len(p.SerialNumbers) > int(p.Quantity))
 }
 
 func (p *SalesOrderDetailPackaged) insertSalesOrderDetailPackaged(userId int32) bool {
@@ -94,7 +95,7 @@ func (p *SalesOrderDetailPackaged) insertSalesOrderDetailPackaged(userId int32)
 			return false
 		}
 
-		detailPackaged.Quantity += p.Quantity
+		detailPackaged.Quantity = roundQuantity(detailPackaged.Quantity + p.Quantity)
 
 		result = trans.Updates(&detailPackaged)
 		if result.Error != nil {
@@ -111,12 +112,25 @@ func (p *SalesOrderDetailPackaged) insertSalesOrderDetailPackaged(userId int32)
 	}
 
 	product := getProductRow(detail.ProductId)
-	ok = addWeightPackaging(p.PackagingId, product.Weight*float64(p.Quantity), *trans)
+	ok = addWeightPackaging(p.PackagingId, product.Weight*p.Quantity, *trans)
 	if !ok {
 		trans.Rollback()
 		return false
 	}
 
+	// assign the units to the sales order detail, they leave the warehouse in the delivery note
+	p.SerialNumbers = cleanSerialNumbers(p.SerialNumbers)
+	if len(p.SerialNumbers) > 0 {
+		if !product.TrackSerials {
+			trans.Rollback()
+			return false
+		}
+		ok = assignSerialNumbers(detail.ProductId, detail.WarehouseId, p.SerialNumbers, map[string]interface{}{"sales_order_detail": p.OrderDetailId, "packaging": p.PackagingId}, "sales_order_detail", detail.EnterpriseId, *trans)
+		if !ok {
+			return false
+		}
+	}
+
 	///
 	result = trans.Commit()
 	return result.Error == nil
@@ -156,9 +170,17 @@ func (p *SalesOrderDetailPackaged) deleteSalesOrderDetailPackaged(userId int32,
 		return false
 	}
 
+	// the units that have not left the warehouse yet are no longer assigned
+	result = trans.Model(&ProductSerial{}).Where("sales_order_detail = ? AND packaging = ? AND in_stock AND enterprise = ?", p.OrderDetailId, p.PackagingId, p.EnterpriseId).Updates(map[string]interface{}{"sales_order_detail": nil, "packaging": nil})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
 	detail := getSalesOrderDetailRow(p.OrderDetailId)
 	product := getProductRow(detail.ProductId)
-	ok = addWeightPackaging(p.PackagingId, -product.Weight*float64(inMemoryPackage.Quantity), *trans)
+	ok = addWeightPackaging(p.PackagingId, -product.Weight*inMemoryPackage.Quantity, *trans)
 	if !ok {
 		trans.Rollback()
 		return false
@@ -176,14 +198,15 @@ func (p *SalesOrderDetailPackaged) deleteSalesOrderDetailPackaged(userId int32,
 }
 
 type SalesOrderDetailPackagedEAN13 struct {
-	SalesOrder int64  `json:"salesOrder"`
-	EAN13      string `json:"ean13"`
-	Packaging  int64  `json:"packaging"`
-	Quantity   int32  `json:"quantity"`
+	SalesOrder   int64   `json:"salesOrder"`
+	EAN13        string  `json:"ean13"`
+	Packaging    int64   `json:"packaging"`
+	Quantity     float64 `json:"quantity"`
+	SerialNumber string  `json:"serialNumber"` // Unit scanned in preparation, the quantity must be 1
 }
 
 func (d *SalesOrderDetailPackagedEAN13) isValid() bool {
-	return !(d.SalesOrder <= 0 || len(d.EAN13) != 13 || d.Packaging <= 0 || d.Quantity <= 0)
+	return !(d.SalesOrder <= 0 || len(d.EAN13) != 13 || d.Packaging <= 0 || d.Quantity <= 0 || (len(d.SerialNumber) > 0 && d.Quantity != 1))
 }
 
 func (d *SalesOrderDetailPackagedEAN13) insertSalesOrderDetailPackagedEAN13(enterpriseId int32, userId int32) bool {
@@ -208,6 +231,9 @@ func (d *SalesOrderDetailPackagedEAN13) insertSalesOrderDetailPackagedEAN13(ente
 	p.PackagingId = d.Packaging
 	p.Quantity = d.Quantity
 	p.EnterpriseId = enterpriseId
+	if len(d.SerialNumber) > 0 {
+		p.SerialNumbers = []string{d.SerialNumber}
+	}
 
 	return p.insertSalesOrderDetailPackaged(userId)
 }
@@ -0,0 +1,566 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SalesQuotation struct {
+	Id                int64         `json:"id" gorm:"index:sales_quotation_id_enterprise,unique:true,priority:1"`
+	Reference         string        `json:"reference" gorm:"type:character varying(15);not null:true"`
+	CustomerId        int32         `json:"customerId" gorm:"type:integer;not null:true;column:customer"`
+	Customer          Customer      `json:"customer" gorm:"foreignKey:CustomerId,EnterpriseId;references:Id,EnterpriseId"`
+	DateCreated       time.Time     `json:"dateCreated" gorm:"type:timestamp(3) with time zone;not null:true;index:sales_quotation_date_created,sort:desc"`
+	ValidUntil        time.Time     `json:"validUntil" gorm:"type:timestamp(3) with time zone;not null:true"`
+	DateAnswered      *time.Time    `json:"dateAnswered" gorm:"type:timestamp(3) with time zone"`
+	PaymentMethodId   int32         `json:"paymentMethodId" gorm:"column:payment_method;type:integer;not null:true"`
+	PaymentMethod     PaymentMethod `json:"paymentMethod" gorm:"foreignKey:PaymentMethodId,EnterpriseId;references:Id,EnterpriseId"`
+	BillingSeriesId   string        `json:"billingSeriesId" gorm:"type:character(3);not null:true;column:billing_series;index:sales_quotation_quotation_number,unique:true,priority:2"`
+	BillingSeries     BillingSerie  `json:"billingSeries" gorm:"foreignKey:BillingSeriesId,EnterpriseId;references:Id,EnterpriseId"`
+	CurrencyId        int32         `json:"currencyId" gorm:"column:currency;type:integer;not null:true"`
+	Currency          Currency      `json:"currency" gorm:"foreignKey:CurrencyId,EnterpriseId;references:Id,EnterpriseId"`
+	CurrencyChange    float64       `json:"currencyChange" gorm:"type:numeric(14,6);not null:true"`
+	BillingAddressId  int32         `json:"billingAddressId" gorm:"type:integer;not null:true;column:billing_address"`
+	BillingAddress    Address       `json:"billingAddress" gorm:"foreignKey:BillingAddressId,EnterpriseId;references:Id,EnterpriseId"`
+	ShippingAddressId int32         `json:"shippingAddressId" gorm:"type:integer;not null:true;column:shipping_address"`
+	ShippingAddress   Address       `json:"shippingAddress" gorm:"foreignKey:ShippingAddressId,EnterpriseId;references:Id,EnterpriseId"`
+	LinesNumber       int16         `json:"linesNumber" gorm:"not null:true"`
+	TotalProducts     float64       `json:"totalProducts" gorm:"not null:true;type:numeric(14,6)"`
+	DiscountPercent   float64       `json:"discountPercent" gorm:"not null:true;type:numeric(14,6)"`
+	FixDiscount       float64       `json:"fixDiscount" gorm:"not null:true;type:numeric(14,6)"`
+	ShippingPrice     float64       `json:"shippingPrice" gorm:"not null:true;type:numeric(14,6)"`
+	ShippingDiscount  float64       `json:"shippingDiscount" gorm:"not null:true;type:numeric(14,6)"`
+	TotalWithDiscount float64       `json:"totalWithDiscount" gorm:"not null:true;type:numeric(14,6)"`
+	VatAmount         float64       `json:"vatAmount" gorm:"not null:true;type:numeric(14,6)"`
+	TotalAmount       float64       `json:"totalAmount" gorm:"not null:true;type:numeric(14,6)"`
+	Description       string        `json:"description" gorm:"type:text;not null:true;column:dsc"`
+	Notes             string        `json:"notes" gorm:"type:character varying(250);not null:true;column:notes"`
+	Status            string        `json:"status" gorm:"type:character(1);not null:true;column:status"` // _ = Pending, A = Accepted, R = Rejected, E = Expired
+	QuotationNumber   int32         `json:"quotationNumber" gorm:"not null:true;column:quotation_number;index:sales_quotation_quotation_number,unique:true,priority:3,sort:desc"`
+	QuotationName     string        `json:"quotationName" gorm:"type:character(15);not null:true"`
+	CarrierId         *int32        `json:"carrierId" gorm:"column:carrier"`
+	Carrier           *Carrier      `json:"carrier" gorm:"foreignKey:CarrierId,EnterpriseId;references:Id,EnterpriseId"`
+	SaleOrderId       *int64        `json:"saleOrderId" gorm:"column:sales_order;index:sales_quotation_sales_order"`
+	SaleOrder         *SaleOrder    `json:"-" gorm:"foreignKey:SaleOrderId,EnterpriseId;references:Id,EnterpriseId"`
+	EnterpriseId      int32         `json:"-" gorm:"column:enterprise;not null:true;index:sales_quotation_id_enterprise,unique:true,priority:2;index:sales_quotation_quotation_number,unique:true,priority:1"`
+	Enterprise        Settings      `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (q *SalesQuotation) TableName() string {
+	return "sales_quotation"
+}
+
+type SalesQuotations struct {
+	Rows       int64                `json:"rows"`
+	Quotations []SalesQuotation     `json:"quotations"`
+	Footer     SalesQuotationFooter `json:"footer"`
+}
+
+type SalesQuotationFooter struct {
+	TotalProducts float64 `json:"totalProducts"`
+	TotalAmount   float64 `json:"totalAmount"`
+}
+
+func (q *PaginationQuery) getSalesQuotations(enterpriseId int32) SalesQuotations {
+	sq := SalesQuotations{}
+	if !q.isValid() {
+		return sq
+	}
+
+	sq.Quotations = make([]SalesQuotation, 0)
+	result := dbOrm.Where("enterprise = ?", enterpriseId).Order("date_created DESC").Limit(int(q.Limit)).Offset(int(q.Offset)).Preload(clause.Associations).Find(&sq.Quotations)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return sq
+	}
+	dbOrm.Model(&SalesQuotation{}).Where("enterprise = ?", enterpriseId).Count(&sq.Rows)
+	dbOrm.Model(&SalesQuotation{}).Where("enterprise = ?", enterpriseId).Select("SUM(total_products) as total_products, SUM(total_amount) as total_amount").Scan(&sq.Footer)
+
+	return sq
+}
+
+type SalesQuotationSearch struct {
+	PaginatedSearch
+	DateStart *time.Time `json:"dateStart"`
+	DateEnd   *time.Time `json:"dateEnd"`
+	Status    string     `json:"status"`
+}
+
+func (s *SalesQuotationSearch) searchSalesQuotations() SalesQuotations {
+	sq := SalesQuotations{}
+	if !s.isValid() {
+		return sq
+	}
+
+	sq.Quotations = make([]SalesQuotation, 0)
+	cursor := dbOrm.Where("sales_quotation.enterprise = ?", s.enterprise)
+	quotationNumber, err := strconv.Atoi(s.Search)
+	if err == nil {
+		cursor = cursor.Where("sales_quotation.quotation_number = ?", quotationNumber)
+	} else {
+		cursor = cursor.Joins("INNER JOIN customer ON customer.id=sales_quotation.customer").Where("sales_quotation.quotation_name LIKE @search OR sales_quotation.reference ILIKE @search OR customer.name ILIKE @search", sql.Named("search", "%"+s.Search+"%"))
+		if s.DateStart != nil {
+			cursor = cursor.Where("sales_quotation.date_created >= ?", s.DateStart)
+		}
+		if s.DateEnd != nil {
+			cursor = cursor.Where("sales_quotation.date_created <= ?", s.DateEnd)
+		}
+		if s.Status != "" {
+			cursor = cursor.Where("sales_quotation.status = ?", s.Status)
+		}
+	}
+	result := cursor.Order("sales_quotation.date_created DESC").Limit(int(s.Limit)).Offset(int(s.Offset)).Preload(clause.Associations).Find(&sq.Quotations)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return sq
+	}
+
+	cursor = dbOrm.Model(&SalesQuotation{}).Where("sales_quotation.enterprise = ?", s.enterprise)
+	if err == nil {
+		cursor = cursor.Where("sales_quotation.quotation_number = ?", quotationNumber)
+	} else {
+		cursor = cursor.Joins("INNER JOIN customer ON customer.id=sales_quotation.customer").Where("sales_quotation.quotation_name LIKE @search OR sales_quotation.reference ILIKE @search OR customer.name ILIKE @search", sql.Named("search", "%"+s.Search+"%"))
+		if s.DateStart != nil {
+			cursor = cursor.Where("sales_quotation.date_created >= ?", s.DateStart)
+		}
+		if s.DateEnd != nil {
+			cursor = cursor.Where("sales_quotation.date_created <= ?", s.DateEnd)
+		}
+		if s.Status != "" {
+			cursor = cursor.Where("sales_quotation.status = ?", s.Status)
+		}
+	}
+	result = cursor.Count(&sq.Rows).Select("SUM(total_products) as total_products, SUM(total_amount) as total_amount").Scan(&sq.Footer)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return sq
+	}
+
+	return sq
+}
+
+func getSalesQuotationRow(id int64) SalesQuotation {
+	var q SalesQuotation = SalesQuotation{}
+	result := dbOrm.Where("id = ?", id).Preload(clause.Associations).First(&q)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return q
+	}
+
+	return q
+}
+
+func (q *SalesQuotation) isValid() bool {
+	return !(len(q.Reference) > 15 || q.CustomerId <= 0 || q.PaymentMethodId <= 0 || len(q.BillingSeriesId) == 0 || q.CurrencyId <= 0 || q.BillingAddressId <= 0 || q.ShippingAddressId <= 0 || len(q.Notes) > 250 || len(q.Description) > 3000 || q.ValidUntil.IsZero())
+}
+
+func (q *SalesQuotation) BeforeCreate(tx *gorm.DB) (err error) {
+	var salesQuotation SalesQuotation
+	tx.Model(&SalesQuotation{}).Last(&salesQuotation)
+	q.Id = salesQuotation.Id + 1
+	return nil
+}
+
+func (q *SalesQuotation) insertSalesQuotation(userId int32) (bool, int64) {
+	if !q.isValid() {
+		return false, 0
+	}
+
+	q.QuotationNumber = getNextSalesQuotationNumber(q.BillingSeriesId, q.EnterpriseId)
+	if q.QuotationNumber <= 0 {
+		return false, 0
+	}
+	q.CurrencyChange = getCurrencyExchange(q.CurrencyId)
+	now := time.Now()
+	q.QuotationName = q.BillingSeriesId + "/" + strconv.Itoa(now.Year()) + "/" + fmt.Sprintf("%06d", q.QuotationNumber)
+
+	q.DateCreated = time.Now()
+	q.DateAnswered = nil
+	q.TotalWithDiscount = q.ShippingPrice - q.ShippingDiscount - q.FixDiscount
+	q.VatAmount = 0
+	q.TotalAmount = q.TotalWithDiscount + q.VatAmount
+	q.Status = "_"
+	q.LinesNumber = 0
+	q.TotalProducts = 0
+	q.SaleOrderId = nil
+
+	result := dbOrm.Create(&q)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false, 0
+	}
+
+	insertTransactionalLog(q.EnterpriseId, "sales_quotation", int(q.Id), userId, "I")
+	json, _ := json.Marshal(q)
+	go fireWebHook(q.EnterpriseId, "sales_quotation", "POST", string(json))
+
+	return true, q.Id
+}
+
+// ERROR CODES:
+// 1. The quotation is not pending, it can't be modified
+func (q *SalesQuotation) updateSalesQuotation(userId int32) OkAndErrorCodeReturn {
+	if q.Id <= 0 || !q.isValid() {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	var inMemoryQuotation SalesQuotation
+	result := trans.Model(&SalesQuotation{}).Where("id = ? AND enterprise = ?", q.Id, q.EnterpriseId).First(&inMemoryQuotation)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	if inMemoryQuotation.Status != "_" {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	if q.CurrencyId != inMemoryQuotation.CurrencyId {
+		inMemoryQuotation.CurrencyChange = getCurrencyExchange(q.CurrencyId)
+	}
+
+	inMemoryQuotation.CustomerId = q.CustomerId
+	inMemoryQuotation.PaymentMethodId = q.PaymentMethodId
+	inMemoryQuotation.CurrencyId = q.CurrencyId
+	inMemoryQuotation.BillingAddressId = q.BillingAddressId
+	inMemoryQuotation.ShippingAddressId = q.ShippingAddressId
+	inMemoryQuotation.DiscountPercent = q.DiscountPercent
+	inMemoryQuotation.FixDiscount = q.FixDiscount
+	inMemoryQuotation.ShippingPrice = q.ShippingPrice
+	inMemoryQuotation.ShippingDiscount = q.ShippingDiscount
+	inMemoryQuotation.Description = q.Description
+	inMemoryQuotation.Notes = q.Notes
+	inMemoryQuotation.Reference = q.Reference
+	inMemoryQuotation.CarrierId = q.CarrierId
+	inMemoryQuotation.ValidUntil = q.ValidUntil
+
+	result = trans.Save(&inMemoryQuotation)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	ok := calcTotalsSalesQuotation(q.EnterpriseId, q.Id, userId, *trans)
+	if !ok {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(q.EnterpriseId, "sales_quotation", int(q.Id), userId, "U")
+	json, _ := json.Marshal(q)
+	go fireWebHook(q.EnterpriseId, "sales_quotation", "PUT", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+// ERROR CODES:
+// 1. The quotation has already been accepted and converted into a sale order
+func (q *SalesQuotation) deleteSalesQuotation(userId int32) OkAndErrorCodeReturn {
+	if q.Id <= 0 {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	inMemoryQuotation := getSalesQuotationRow(q.Id)
+	if inMemoryQuotation.Id <= 0 || inMemoryQuotation.EnterpriseId != q.EnterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if inMemoryQuotation.Status == "A" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	result := trans.Where("quotation = ? AND enterprise = ?", q.Id, q.EnterpriseId).Delete(&SalesQuotationDetail{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	result = trans.Where("id = ? AND enterprise = ?", q.Id, q.EnterpriseId).Delete(&SalesQuotation{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(q.EnterpriseId, "sales_quotation", int(q.Id), userId, "D")
+	json, _ := json.Marshal(inMemoryQuotation)
+	go fireWebHook(q.EnterpriseId, "sales_quotation", "DELETE", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+// Adds a total amount to the quotation total. This function will subsctract from the total if the totalAmount is negative.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func addTotalProductsSalesQuotation(enterpriseId int32, quotationId int64, userId int32, totalAmount float64, vatPercent float64, lines int16, trans gorm.DB) bool {
+	var quotation SalesQuotation
+	result := trans.Model(&SalesQuotation{}).Where("id = ?", quotationId).First(&quotation)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	quotation.TotalProducts += totalAmount
+	quotation.VatAmount += (totalAmount / 100) * vatPercent
+	quotation.LinesNumber += lines
+
+	result = trans.Save(&quotation)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	return calcTotalsSalesQuotation(enterpriseId, quotationId, userId, trans)
+}
+
+// Applies the logic to calculate the totals of the sales quotation and the discounts.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func calcTotalsSalesQuotation(enterpriseId int32, quotationId int64, userId int32, trans gorm.DB) bool {
+	var quotation SalesQuotation
+	result := trans.Model(&SalesQuotation{}).Where("id = ?", quotationId).First(&quotation)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	quotation.TotalWithDiscount = (quotation.TotalProducts - quotation.TotalProducts*(quotation.DiscountPercent/100)) - quotation.FixDiscount + quotation.ShippingPrice - quotation.ShippingDiscount
+	quotation.TotalAmount = quotation.TotalWithDiscount + quotation.VatAmount
+
+	result = trans.Save(&quotation)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	insertTransactionalLog(enterpriseId, "sales_quotation", int(quotationId), userId, "U")
+	json, _ := json.Marshal(quotation)
+	go fireWebHook(enterpriseId, "sales_quotation", "PUT", string(json))
+
+	return true
+}
+
+// Converts a pending quotation into a sale order, copying the header and all the details.
+// The new sale order is created using the same insert path as the manually created sale orders, in the same transaction that accepts the quotation.
+// ERROR CODES:
+// 1. The quotation is not pending
+// 2. The quotation has expired
+// 3. The quotation has no details
+// 4. Error creating the detail <product>: <error>
+// 5. The customer has exceeded the credit limit
+// 6. The customer has overdue payments
+func acceptSalesQuotation(quotationId int64, enterpriseId int32, userId int32) OkAndErrorCodeReturn {
+	quotation := getSalesQuotationRow(quotationId)
+	if quotation.Id <= 0 || quotation.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if quotation.Status != "_" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+	if quotation.ValidUntil.Before(time.Now()) {
+		setSalesQuotationStatus(quotation.Id, enterpriseId, "E", userId)
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+	details := getSalesQuotationDetail(quotation.Id, enterpriseId)
+	if len(details) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+
+	// the lines of the order are not visible outside of the transaction until it's committed, check the whole quotation at once
+	risk := checkCustomerRisk(quotation.CustomerId, enterpriseId, quotation.TotalAmount)
+	if !risk.Ok && getCustomerRow(quotation.CustomerId).CreditRiskAction != "H" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: risk.ErrorCode + 4, ExtraData: risk.ExtraData}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	// the quotation can only be accepted once, the status is checked again while locking the row
+	now := time.Now()
+	result := trans.Model(&SalesQuotation{}).Where("id = ? AND enterprise = ? AND status = '_'", quotation.Id, enterpriseId).Updates(map[string]interface{}{"status": "A", "date_answered": now})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if result.RowsAffected == 0 {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	saleOrder := SaleOrder{
+		Reference:         quotation.Reference,
+		CustomerId:        quotation.CustomerId,
+		PaymentMethodId:   quotation.PaymentMethodId,
+		BillingSeriesId:   quotation.BillingSeriesId,
+		CurrencyId:        quotation.CurrencyId,
+		BillingAddressId:  quotation.BillingAddressId,
+		ShippingAddressId: quotation.ShippingAddressId,
+		DiscountPercent:   quotation.DiscountPercent,
+		FixDiscount:       quotation.FixDiscount,
+		ShippingPrice:     quotation.ShippingPrice,
+		ShippingDiscount:  quotation.ShippingDiscount,
+		Description:       quotation.Description,
+		Notes:             quotation.Notes,
+		CarrierId:         quotation.CarrierId,
+		EnterpriseId:      enterpriseId,
+	}
+	okAndErr, orderId := saleOrder.insertSalesOrder(userId, trans)
+	if !okAndErr.Ok {
+		trans.Rollback()
+		if okAndErr.ErrorCode > 0 {
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: okAndErr.ErrorCode + 4, ExtraData: okAndErr.ExtraData}
+		}
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	orderDetails := make([]SalesOrderDetail, 0)
+	for i := 0; i < len(details); i++ {
+		orderDetail := SalesOrderDetail{
+			OrderId:      orderId,
+			ProductId:    details[i].ProductId,
+			Price:        details[i].Price,
+			Quantity:     details[i].Quantity,
+			VatPercent:   details[i].VatPercent,
+			EnterpriseId: enterpriseId,
+		}
+		res := orderDetail.insertSalesOrderDetail(userId, trans)
+		if !res.Ok {
+			// undo the sale order, the quotation stays pending
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4, ExtraData: []string{strconv.Itoa(int(res.ErrorCode)), details[i].Product.Name}}
+		}
+		orderDetails = append(orderDetails, orderDetail)
+
+		result = trans.Model(&SalesQuotationDetail{}).Where("id = ?", details[i].Id).Update("sales_order_detail", orderDetail.Id)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+	}
+
+	if !risk.Ok && !putSalesOrderOnCreditHold(orderId, enterpriseId, *trans) {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	result = trans.Model(&SalesQuotation{}).Where("id = ?", quotation.Id).Update("sales_order", orderId)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	for i := 0; i < len(orderDetails); i++ {
+		orderDetails[i].processProductIncludedProductOnNewInsertedLine(enterpriseId, userId)
+	}
+
+	insertTransactionalLog(enterpriseId, "sales_quotation", int(quotation.Id), userId, "U")
+	quotation = getSalesQuotationRow(quotation.Id)
+	json, _ := json.Marshal(quotation)
+	go fireWebHook(enterpriseId, "sales_quotation", "PUT", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true, ExtraData: []string{strconv.Itoa(int(orderId))}}
+}
+
+func rejectSalesQuotation(quotationId int64, enterpriseId int32, userId int32) bool {
+	quotation := getSalesQuotationRow(quotationId)
+	if quotation.Id <= 0 || quotation.EnterpriseId != enterpriseId || quotation.Status != "_" {
+		return false
+	}
+	return setSalesQuotationStatus(quotation.Id, enterpriseId, "R", userId)
+}
+
+func setSalesQuotationStatus(quotationId int64, enterpriseId int32, status string, userId int32) bool {
+	now := time.Now()
+	result := dbOrm.Model(&SalesQuotation{}).Where("id = ? AND enterprise = ?", quotationId, enterpriseId).Updates(map[string]interface{}{"status": status, "date_answered": now})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	insertTransactionalLog(enterpriseId, "sales_quotation", int(quotationId), userId, "U")
+	quotation := getSalesQuotationRow(quotationId)
+	json, _ := json.Marshal(quotation)
+	go fireWebHook(enterpriseId, "sales_quotation", "PUT", string(json))
+
+	return true
+}
+
+// Marks as expired all the pending quotations that are past their validity date. Called from a cron.
+func expireSalesQuotations() {
+	result := dbOrm.Model(&SalesQuotation{}).Where("status = '_' AND valid_until < ?", time.Now()).Updates(map[string]interface{}{"status": "E", "date_answered": time.Now()})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+}
+
+func getSalesOrderQuotations(orderId int64, enterpriseId int32) []SalesQuotation {
+	var quotations []SalesQuotation = make([]SalesQuotation, 0)
+	result := dbOrm.Model(&SalesQuotation{}).Where("sales_order = ? AND enterprise = ?", orderId, enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&quotations)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return quotations
+	}
+	return quotations
+}
@@ -0,0 +1,279 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SalesQuotationDetail struct {
+	Id                 int64             `json:"id" gorm:"index:sales_quotation_detail_id_enterprise,unique:true,priority:1"`
+	QuotationId        int64             `json:"quotationId" gorm:"column:quotation;not null:true;index:sales_quotation_detail_quotation_product,unique:true,priority:1"`
+	Quotation          SalesQuotation    `json:"-" gorm:"foreignKey:QuotationId,EnterpriseId;references:Id,EnterpriseId"`
+	ProductId          int32             `json:"productId" gorm:"column:product;not null:true;index:sales_quotation_detail_quotation_product,unique:true,priority:2"`
+	Product            Product           `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	Price              float64           `json:"price" gorm:"column:price;not null:true;type:numeric(14,6)"`
+	Quantity           float64           `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
+	VatPercent         float64           `json:"vatPercent" gorm:"column:vat_percent;not null:true;type:numeric(14,6)"`
+	TotalAmount        float64           `json:"totalAmount" gorm:"column:total_amount;not null:true;type:numeric(14,6)"`
+	SalesOrderDetailId *int64            `json:"salesOrderDetailId" gorm:"column:sales_order_detail"`
+	SalesOrderDetail   *SalesOrderDetail `json:"-" gorm:"foreignKey:SalesOrderDetailId,EnterpriseId;references:Id,EnterpriseId"`
+	EnterpriseId       int32             `json:"-" gorm:"column:enterprise;not null:true;index:sales_quotation_detail_id_enterprise,unique:true,priority:2"`
+	Enterprise         Settings          `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (d *SalesQuotationDetail) TableName() string {
+	return "sales_quotation_detail"
+}
+
+func getSalesQuotationDetail(quotationId int64, enterpriseId int32) []SalesQuotationDetail {
+	var details []SalesQuotationDetail = make([]SalesQuotationDetail, 0)
+	result := dbOrm.Where("quotation = ? AND enterprise = ?", quotationId, enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&details)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return details
+	}
+
+	return details
+}
+
+func getSalesQuotationDetailRow(detailId int64) SalesQuotationDetail {
+	var detail SalesQuotationDetail = SalesQuotationDetail{}
+	result := dbOrm.Where("id = ?", detailId).Preload(clause.Associations).First(&detail)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return detail
+	}
+
+	return detail
+}
+
+func (d *SalesQuotationDetail) isValid() bool {
+	return !(d.QuotationId <= 0 || d.ProductId <= 0 || d.Quantity <= 0 || d.VatPercent < 0)
+}
+
+func (d *SalesQuotationDetail) BeforeCreate(tx *gorm.DB) (err error) {
+	var salesQuotationDetail SalesQuotationDetail
+	tx.Model(&SalesQuotationDetail{}).Last(&salesQuotationDetail)
+	d.Id = salesQuotationDetail.Id + 1
+	return nil
+}
+
+// ERROR CODES:
+// 1. the product is deactivated
+// 2. there is aleady a detail with this product
+// 3. the quotation is not pending, it can't be modified
+func (d *SalesQuotationDetail) insertSalesQuotationDetail(userId int32) OkAndErrorCodeReturn {
+	if !d.isValid() {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	p := getProductRow(d.ProductId)
+	if p.Id <= 0 || p.EnterpriseId != d.EnterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if p.Off {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	quotation := getSalesQuotationRow(d.QuotationId)
+	if quotation.Id <= 0 || quotation.EnterpriseId != d.EnterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if quotation.Status != "_" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+
+	// the product and quotation are unique, there can't exist another detail for the same product in the same quotation
+	var countProductInQuotation int64
+	result := dbOrm.Model(&SalesQuotationDetail{}).Where("product = ? AND quotation = ?", d.ProductId, d.QuotationId).Count(&countProductInQuotation)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if countProductInQuotation > 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+
+	d.TotalAmount = (d.Price * d.Quantity) * (1 + (d.VatPercent / 100))
+	d.SalesOrderDetailId = nil
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	result = trans.Create(&d)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	ok := addTotalProductsSalesQuotation(d.EnterpriseId, d.QuotationId, userId, d.Price*d.Quantity, d.VatPercent, 1, *trans)
+	if !ok {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(d.EnterpriseId, "sales_quotation_detail", int(d.Id), userId, "I")
+	json, _ := json.Marshal(d)
+	go fireWebHook(d.EnterpriseId, "sales_quotation_detail", "POST", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+// ERROR CODES:
+// 1. the product is deactivated
+// 2. there is aleady a detail with this product
+// 3. the quotation is not pending, it can't be modified
+func (d *SalesQuotationDetail) updateSalesQuotationDetail(userId int32) OkAndErrorCodeReturn {
+	if d.Id <= 0 || !d.isValid() {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	inMemoryDetail := getSalesQuotationDetailRow(d.Id)
+	if inMemoryDetail.Id <= 0 || inMemoryDetail.EnterpriseId != d.EnterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	quotation := getSalesQuotationRow(inMemoryDetail.QuotationId)
+	if quotation.Status != "_" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+
+	if d.ProductId != inMemoryDetail.ProductId {
+		p := getProductRow(d.ProductId)
+		if p.Id <= 0 || p.EnterpriseId != d.EnterpriseId {
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		if p.Off {
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+		}
+
+		var countProductInQuotation int64
+		result := dbOrm.Model(&SalesQuotationDetail{}).Where("product = ? AND quotation = ? AND id != ?", d.ProductId, inMemoryDetail.QuotationId, d.Id).Count(&countProductInQuotation)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		if countProductInQuotation > 0 {
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+		}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	// take out the old amounts and add the new ones
+	ok := addTotalProductsSalesQuotation(d.EnterpriseId, inMemoryDetail.QuotationId, userId, -(inMemoryDetail.Price * inMemoryDetail.Quantity), inMemoryDetail.VatPercent, 0, *trans)
+	if !ok {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	inMemoryDetail.ProductId = d.ProductId
+	inMemoryDetail.Price = d.Price
+	inMemoryDetail.Quantity = d.Quantity
+	inMemoryDetail.VatPercent = d.VatPercent
+	inMemoryDetail.TotalAmount = (d.Price * d.Quantity) * (1 + (d.VatPercent / 100))
+
+	result := trans.Save(&inMemoryDetail)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	ok = addTotalProductsSalesQuotation(d.EnterpriseId, inMemoryDetail.QuotationId, userId, inMemoryDetail.Price*inMemoryDetail.Quantity, inMemoryDetail.VatPercent, 0, *trans)
+	if !ok {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(d.EnterpriseId, "sales_quotation_detail", int(d.Id), userId, "U")
+	json, _ := json.Marshal(inMemoryDetail)
+	go fireWebHook(d.EnterpriseId, "sales_quotation_detail", "PUT", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+// ERROR CODES:
+// 1. the quotation is not pending, it can't be modified
+func (d *SalesQuotationDetail) deleteSalesQuotationDetail(userId int32) OkAndErrorCodeReturn {
+	if d.Id <= 0 {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	inMemoryDetail := getSalesQuotationDetailRow(d.Id)
+	if inMemoryDetail.Id <= 0 || inMemoryDetail.EnterpriseId != d.EnterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	quotation := getSalesQuotationRow(inMemoryDetail.QuotationId)
+	if quotation.Status != "_" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	result := trans.Where("id = ? AND enterprise = ?", d.Id, d.EnterpriseId).Delete(&SalesQuotationDetail{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	ok := addTotalProductsSalesQuotation(d.EnterpriseId, inMemoryDetail.QuotationId, userId, -(inMemoryDetail.Price * inMemoryDetail.Quantity), inMemoryDetail.VatPercent, -1, *trans)
+	if !ok {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(d.EnterpriseId, "sales_quotation_detail", int(d.Id), userId, "D")
+	json, _ := json.Marshal(inMemoryDetail)
+	go fireWebHook(d.EnterpriseId, "sales_quotation_detail", "DELETE", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
@@ -0,0 +1,623 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Return merchandise authorization. The goods that come back from the customer are received in a warehouse, and then credited with an amending invoice.
+type SalesReturn struct {
+	Id                  int64              `json:"id" gorm:"index:sales_return_id_enterprise,unique:true,priority:1"`
+	CustomerId          int32              `json:"customerId" gorm:"column:customer;not null:true"`
+	Customer            Customer           `json:"customer" gorm:"foreignKey:CustomerId,EnterpriseId;references:Id,EnterpriseId"`
+	SalesOrderId        *int64             `json:"salesOrderId" gorm:"column:sales_order"`
+	SalesOrder          *SaleOrder         `json:"salesOrder" gorm:"foreignKey:SalesOrderId,EnterpriseId;references:Id,EnterpriseId"`
+	SalesDeliveryNoteId *int64             `json:"salesDeliveryNoteId" gorm:"column:sales_delivery_note"`
+	SalesDeliveryNote   *SalesDeliveryNote `json:"salesDeliveryNote" gorm:"foreignKey:SalesDeliveryNoteId,EnterpriseId;references:Id,EnterpriseId"`
+	WarehouseId         string             `json:"warehouseId" gorm:"column:warehouse;type:character(2);not null:true"`
+	Warehouse           Warehouse          `json:"warehouse" gorm:"foreignKey:WarehouseId,EnterpriseId;references:Id,EnterpriseId"`
+	DateCreated         time.Time          `json:"dateCreated" gorm:"type:timestamp(3) with time zone;not null:true;index:sales_return_date_created,sort:desc"`
+	DateReceived        *time.Time         `json:"dateReceived" gorm:"type:timestamp(3) with time zone"`
+	DateCredited        *time.Time         `json:"dateCredited" gorm:"type:timestamp(3) with time zone"`
+	Status              string             `json:"status" gorm:"type:character(1);not null:true"` // _ = Pending, R = Received, C = Credited
+	Description         string             `json:"description" gorm:"column:dsc;type:text;not null:true"`
+	LinesNumber         int16              `json:"linesNumber" gorm:"not null:true"`
+	TotalProducts       float64            `json:"totalProducts" gorm:"type:numeric(14,6);not null:true"`
+	VatAmount           float64            `json:"vatAmount" gorm:"type:numeric(14,6);not null:true"`
+	TotalAmount         float64            `json:"totalAmount" gorm:"type:numeric(14,6);not null:true"`
+	EnterpriseId        int32              `json:"-" gorm:"column:enterprise;not null:true;index:sales_return_id_enterprise,unique:true,priority:2"`
+	Enterprise          Settings           `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (r *SalesReturn) TableName() string {
+	return "sales_return"
+}
+
+type SalesReturns struct {
+	Rows    int64         `json:"rows"`
+	Returns []SalesReturn `json:"returns"`
+}
+
+func (q *PaginationQuery) getSalesReturns(enterpriseId int32) SalesReturns {
+	sr := SalesReturns{}
+	if !q.isValid() {
+		return sr
+	}
+
+	sr.Returns = make([]SalesReturn, 0)
+	result := dbOrm.Where("enterprise = ?", enterpriseId).Order("date_created DESC").Limit(int(q.Limit)).Offset(int(q.Offset)).Preload(clause.Associations).Find(&sr.Returns)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return sr
+	}
+	dbOrm.Model(&SalesReturn{}).Where("enterprise = ?", enterpriseId).Count(&sr.Rows)
+
+	return sr
+}
+
+func getSalesReturnRow(id int64) SalesReturn {
+	var r SalesReturn = SalesReturn{}
+	result := dbOrm.Where("id = ?", id).Preload(clause.Associations).First(&r)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return r
+	}
+
+	return r
+}
+
+func (r *SalesReturn) isValid() bool {
+	return !(r.CustomerId <= 0 || len(r.WarehouseId) != 2 || len(r.Description) > 3000)
+}
+
+func (r *SalesReturn) BeforeCreate(tx *gorm.DB) (err error) {
+	var salesReturn SalesReturn
+	tx.Model(&SalesReturn{}).Last(&salesReturn)
+	r.Id = salesReturn.Id + 1
+	return nil
+}
+
+// Creates the return header. The details are created from the sale order or the delivery note.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func (r *SalesReturn) insertSalesReturn(userId int32, trans gorm.DB) bool {
+	if !r.isValid() {
+		return false
+	}
+
+	r.DateCreated = time.Now()
+	r.DateReceived = nil
+	r.DateCredited = nil
+	r.Status = "_"
+	r.LinesNumber = 0
+	r.TotalProducts = 0
+	r.VatAmount = 0
+	r.TotalAmount = 0
+
+	result := trans.Create(&r)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	insertTransactionalLog(r.EnterpriseId, "sales_return", int(r.Id), userId, "I")
+	json, _ := json.Marshal(r)
+	go fireWebHook(r.EnterpriseId, "sales_return", "POST", string(json))
+
+	return true
+}
+
+// ERROR CODES:
+// 1. The return is not pending, it can't be modified
+func (r *SalesReturn) updateSalesReturn(userId int32) OkAndErrorCodeReturn {
+	if r.Id <= 0 || len(r.WarehouseId) != 2 || len(r.Description) > 3000 {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	var inMemoryReturn SalesReturn
+	result := dbOrm.Model(&SalesReturn{}).Where("id = ? AND enterprise = ?", r.Id, r.EnterpriseId).First(&inMemoryReturn)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	if inMemoryReturn.Status != "_" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	inMemoryReturn.WarehouseId = r.WarehouseId
+	inMemoryReturn.Description = r.Description
+
+	result = dbOrm.Save(&inMemoryReturn)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	insertTransactionalLog(r.EnterpriseId, "sales_return", int(r.Id), userId, "U")
+	json, _ := json.Marshal(inMemoryReturn)
+	go fireWebHook(r.EnterpriseId, "sales_return", "PUT", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+// ERROR CODES:
+// 1. The return has already been received, it can't be deleted
+func (r *SalesReturn) deleteSalesReturn(userId int32) OkAndErrorCodeReturn {
+	if r.Id <= 0 {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	inMemoryReturn := getSalesReturnRow(r.Id)
+	if inMemoryReturn.Id <= 0 || inMemoryReturn.EnterpriseId != r.EnterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if inMemoryReturn.Status != "_" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	result := trans.Where("sales_return = ? AND enterprise = ?", r.Id, r.EnterpriseId).Delete(&SalesReturnDetail{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	result = trans.Where("id = ? AND enterprise = ?", r.Id, r.EnterpriseId).Delete(&SalesReturn{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(r.EnterpriseId, "sales_return", int(r.Id), userId, "D")
+	json, _ := json.Marshal(inMemoryReturn)
+	go fireWebHook(r.EnterpriseId, "sales_return", "DELETE", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+// Adds a total amount to the return total. This function will subsctract from the total if the totalAmount is negative.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func addTotalProductsSalesReturn(enterpriseId int32, returnId int64, userId int32, totalAmount float64, vatPercent float64, lines int16, trans gorm.DB) bool {
+	var salesReturn SalesReturn
+	result := trans.Model(&SalesReturn{}).Where("id = ? AND enterprise = ?", returnId, enterpriseId).First(&salesReturn)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	salesReturn.TotalProducts += totalAmount
+	salesReturn.VatAmount += (totalAmount / 100) * vatPercent
+	salesReturn.TotalAmount = salesReturn.TotalProducts + salesReturn.VatAmount
+	salesReturn.LinesNumber += lines
+
+	result = trans.Save(&salesReturn)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	insertTransactionalLog(enterpriseId, "sales_return", int(returnId), userId, "U")
+
+	return true
+}
+
+// Returns the quantity of a sale order detail that has been delivered and has not been returned yet.
+// The return detail specified in excludeDetailId is not counted as returned.
+func getSalesOrderDetailQuantityReturnable(orderDetailId int64, excludeDetailId int64, enterpriseId int32) float64 {
+	orderDetail := getSalesOrderDetailRow(orderDetailId)
+	if orderDetail.Id <= 0 || orderDetail.EnterpriseId != enterpriseId {
+		return 0
+	}
+
+	var quantityReturned float64
+	result := dbOrm.Model(&SalesReturnDetail{}).Where("order_detail = ? AND id != ? AND enterprise = ?", orderDetailId, excludeDetailId, enterpriseId).Select("COALESCE(SUM(quantity), 0)").Scan(&quantityReturned)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return 0
+	}
+
+	return roundQuantity(orderDetail.QuantityDeliveryNote - quantityReturned)
+}
+
+// Creates a return from a sale order, with all the delivered quantities that have not been returned yet.
+// ERROR CODES:
+// 1. There are no delivered quantities pending to be returned in the sale order
+func createSalesReturnFromSaleOrder(orderId int64, enterpriseId int32, userId int32) OkAndErrorCodeReturn {
+	saleOrder := getSalesOrderRow(orderId)
+	if saleOrder.Id <= 0 || saleOrder.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	var details []SalesReturnDetail = make([]SalesReturnDetail, 0)
+	orderDetails := getSalesOrderDetail(orderId, enterpriseId)
+	for i := 0; i < len(orderDetails); i++ {
+		quantity := getSalesOrderDetailQuantityReturnable(orderDetails[i].Id, 0, enterpriseId)
+		if quantity <= 0 {
+			continue
+		}
+		details = append(details, SalesReturnDetail{
+			OrderDetailId: orderDetails[i].Id,
+			ProductId:     orderDetails[i].ProductId,
+			Quantity:      quantity,
+			Price:         orderDetails[i].Price,
+			VatPercent:    orderDetails[i].VatPercent,
+		})
+	}
+	if len(details) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	r := SalesReturn{
+		CustomerId:   saleOrder.CustomerId,
+		SalesOrderId: &saleOrder.Id,
+		WarehouseId:  getSettingsRecordById(enterpriseId).DefaultWarehouseId,
+		EnterpriseId: enterpriseId,
+	}
+	return r.insertSalesReturnWithDetails(details, userId)
+}
+
+// Creates a return from a sales delivery note, with the quantities of the delivery note that have not been returned yet.
+// ERROR CODES:
+// 1. There are no delivered quantities pending to be returned in the delivery note
+func createSalesReturnFromDeliveryNote(noteId int64, enterpriseId int32, userId int32) OkAndErrorCodeReturn {
+	note := getSalesDeliveryNoteRow(noteId)
+	if note.Id <= 0 || note.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	var details []SalesReturnDetail = make([]SalesReturnDetail, 0)
+	movements := getWarehouseMovementBySalesDeliveryNote(noteId, enterpriseId)
+	for i := 0; i < len(movements); i++ {
+		if movements[i].SalesOrderDetailId == nil {
+			continue
+		}
+		quantity := getSalesOrderDetailQuantityReturnable(*movements[i].SalesOrderDetailId, 0, enterpriseId)
+		if quantity > absf(movements[i].Quantity) {
+			quantity = absf(movements[i].Quantity)
+		}
+		if quantity <= 0 {
+			continue
+		}
+		details = append(details, SalesReturnDetail{
+			OrderDetailId: *movements[i].SalesOrderDetailId,
+			ProductId:     movements[i].ProductId,
+			Quantity:      quantity,
+			Price:         movements[i].Price,
+			VatPercent:    movements[i].VatPercent,
+		})
+	}
+	if len(details) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	r := SalesReturn{
+		CustomerId:          note.CustomerId,
+		SalesDeliveryNoteId: &note.Id,
+		WarehouseId:         getSettingsRecordById(enterpriseId).DefaultWarehouseId,
+		EnterpriseId:        enterpriseId,
+	}
+	return r.insertSalesReturnWithDetails(details, userId)
+}
+
+func (r *SalesReturn) insertSalesReturnWithDetails(details []SalesReturnDetail, userId int32) OkAndErrorCodeReturn {
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	ok := r.insertSalesReturn(userId, *trans)
+	if !ok {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	for i := 0; i < len(details); i++ {
+		d := details[i]
+		d.ReturnId = r.Id
+		d.Reason = "_"
+		d.Inspection = "_"
+		d.TotalAmount = (d.Price * d.Quantity) * (1 + (d.VatPercent / 100))
+		d.EnterpriseId = r.EnterpriseId
+
+		result := trans.Create(&d)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+
+		ok = addTotalProductsSalesReturn(r.EnterpriseId, r.Id, userId, d.Price*d.Quantity, d.VatPercent, 1, *trans)
+		if !ok {
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+
+		insertTransactionalLog(r.EnterpriseId, "sales_return_detail", int(d.Id), userId, "I")
+	}
+
+	///
+	result := trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	return OkAndErrorCodeReturn{Ok: true, ExtraData: []string{strconv.Itoa(int(r.Id))}}
+}
+
+// Receives the goods of the return in the warehouse of the return.
+// The lines that are restocked create an inbound warehouse movement. The scrapped lines and the lines sent to repair don't enter the stock.
+// ERROR CODES:
+// 1. The return is not pending
+// 2. The return has no details
+// 3. There are lines without an inspection outcome (ExtraData: product name)
+func receiveSalesReturn(returnId int64, enterpriseId int32, userId int32) OkAndErrorCodeReturn {
+	r := getSalesReturnRow(returnId)
+	if r.Id <= 0 || r.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if r.Status != "_" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	details := getSalesReturnDetail(returnId, enterpriseId)
+	if len(details) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+	for i := 0; i < len(details); i++ {
+		if details[i].Inspection == "_" {
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3, ExtraData: []string{details[i].Product.Name}}
+		}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	for i := 0; i < len(details); i++ {
+		d := details[i]
+		if d.Inspection != "R" {
+			continue
+		}
+
+		m := WarehouseMovement{
+			WarehouseId:  r.WarehouseId,
+			ProductId:    d.ProductId,
+			Quantity:     d.Quantity,
+			Type:         "I",
+			SalesOrderId: &d.OrderDetail.OrderId,
+			Price:        d.Price,
+			VatPercent:   d.VatPercent,
+			Description:  "Return #" + strconv.Itoa(int(r.Id)),
+			EnterpriseId: enterpriseId,
+		}
+		m.SerialNumbers = getSerialNumbersAssigned("sales_return_detail", d.Id, enterpriseId, trans)
+		ok := m.insertWarehouseMovement(userId, trans)
+		if !ok {
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+
+		result := trans.Model(&SalesReturnDetail{}).Where("id = ?", d.Id).Update("warehouse_movement", m.Id)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+	}
+
+	now := time.Now()
+	r.Status = "R"
+	r.DateReceived = &now
+	result := trans.Model(&SalesReturn{}).Where("id = ?", r.Id).Updates(map[string]interface{}{"status": r.Status, "date_received": r.DateReceived})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(enterpriseId, "sales_return", int(r.Id), userId, "U")
+	json, _ := json.Marshal(r)
+	go fireWebHook(enterpriseId, "sales_return", "PUT", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+// Credits the return to the customer. An amending invoice is created for every invoice that has lines in the return.
+// The restocked and scrapped lines are credited, the lines sent to repair are not, the goods will be sent back to the customer.
+// ERROR CODES:
+// 1. The return has not been received yet, or it's already credited
+// 2. There are no invoiced lines to credit in the return
+// 3. The amending invoice can't be added to the invoice register
+func creditSalesReturn(returnId int64, enterpriseId int32, userId int32) OkAndErrorCodeReturn {
+	r := getSalesReturnRow(returnId)
+	if r.Id <= 0 || r.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if r.Status != "R" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	// group the lines to credit by the invoice they were invoiced in
+	var invoiceIds []int64 = make([]int64, 0)
+	var invoiceDetails map[int64][]SalesReturnDetail = make(map[int64][]SalesReturnDetail)
+	details := getSalesReturnDetail(returnId, enterpriseId)
+	for i := 0; i < len(details); i++ {
+		if details[i].Inspection != "R" && details[i].Inspection != "S" {
+			continue
+		}
+
+		var invoiceDetail SalesInvoiceDetail
+		result := dbOrm.Model(&SalesInvoiceDetail{}).Where("order_detail = ? AND enterprise = ? AND invoice IN (SELECT id FROM sales_invoice WHERE NOT amending)", details[i].OrderDetailId, enterpriseId).Order("id ASC").Limit(1).Find(&invoiceDetail)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		if invoiceDetail.Id <= 0 {
+			continue
+		}
+
+		if _, ok := invoiceDetails[invoiceDetail.InvoiceId]; !ok {
+			invoiceIds = append(invoiceIds, invoiceDetail.InvoiceId)
+		}
+		invoiceDetails[invoiceDetail.InvoiceId] = append(invoiceDetails[invoiceDetail.InvoiceId], details[i])
+	}
+	if len(invoiceIds) == 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	var amendingInvoiceIds []string = make([]string, 0)
+	for i := 0; i < len(invoiceIds); i++ {
+		invoice := getSalesInvoiceRow(invoiceIds[i])
+
+		returnDetails := invoiceDetails[invoiceIds[i]]
+		amendingDetails := make([]SalesInvoiceDetail, 0, len(returnDetails))
+		for j := 0; j < len(returnDetails); j++ {
+			d := returnDetails[j]
+			amendingDetails = append(amendingDetails, SalesInvoiceDetail{
+				ProductId:     &d.ProductId,
+				Price:         -d.Price,
+				Quantity:      d.Quantity,
+				VatPercent:    d.VatPercent,
+				TotalAmount:   -(d.Price * d.Quantity) * (1 + (d.VatPercent / 100)),
+				OrderDetailId: &d.OrderDetailId,
+				Description:   d.Product.Name,
+				EnterpriseId:  enterpriseId,
+			})
+		}
+
+		amendingInvoice, ok := insertAmendingSaleInvoice(invoice, amendingDetails, userId, *trans)
+		if !ok {
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+
+		for j := 0; j < len(returnDetails); j++ {
+			result := trans.Model(&SalesReturnDetail{}).Where("id = ?", returnDetails[j].Id).Update("amending_invoice", amendingInvoice.Id)
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				trans.Rollback()
+				return OkAndErrorCodeReturn{Ok: false}
+			}
+		}
+
+		if !registerIssuedSalesInvoice(amendingInvoice.Id, enterpriseId, trans) {
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+		}
+
+		amendingInvoiceIds = append(amendingInvoiceIds, strconv.Itoa(int(amendingInvoice.Id)))
+	}
+
+	now := time.Now()
+	r.Status = "C"
+	r.DateCredited = &now
+	result := trans.Model(&SalesReturn{}).Where("id = ?", r.Id).Updates(map[string]interface{}{"status": r.Status, "date_credited": r.DateCredited})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	go submitSalesInvoiceRegister(enterpriseId)
+
+	insertTransactionalLog(enterpriseId, "sales_return", int(r.Id), userId, "U")
+	json, _ := json.Marshal(r)
+	go fireWebHook(enterpriseId, "sales_return", "PUT", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true, ExtraData: amendingInvoiceIds}
+}
+
+type SalesReturnRelations struct {
+	WarehouseMovements []WarehouseMovement `json:"warehouseMovements"`
+	AmendingInvoices   []SalesInvoice      `json:"amendingInvoices"`
+}
+
+func getSalesReturnRelations(returnId int64, enterpriseId int32) SalesReturnRelations {
+	relations := SalesReturnRelations{
+		WarehouseMovements: make([]WarehouseMovement, 0),
+		AmendingInvoices:   make([]SalesInvoice, 0),
+	}
+
+	result := dbOrm.Model(&WarehouseMovement{}).Where("id IN (SELECT warehouse_movement FROM sales_return_detail WHERE sales_return = ? AND enterprise = ?)", returnId, enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&relations.WarehouseMovements)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	result = dbOrm.Model(&SalesInvoice{}).Where("id IN (SELECT amending_invoice FROM sales_return_detail WHERE sales_return = ? AND enterprise = ?)", returnId, enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&relations.AmendingInvoices)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+
+	return relations
+}
+
+func getSalesOrderReturns(orderId int64, enterpriseId int32) []SalesReturn {
+	var returns []SalesReturn = make([]SalesReturn, 0)
+	result := dbOrm.Model(&SalesReturn{}).Where("enterprise = ? AND id IN (SELECT sales_return FROM sales_return_detail WHERE order_detail IN (SELECT id FROM sales_order_detail WHERE \"order\" = ?))", enterpriseId, orderId).Order("id ASC").Preload(clause.Associations).Find(&returns)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return returns
+}
+
+func getSalesDeliveryNoteReturns(noteId int64, enterpriseId int32) []SalesReturn {
+	var returns []SalesReturn = make([]SalesReturn, 0)
+	result := dbOrm.Model(&SalesReturn{}).Where("sales_delivery_note = ? AND enterprise = ?", noteId, enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&returns)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return returns
+}
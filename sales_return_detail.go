@@ -0,0 +1,290 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SalesReturnDetail struct {
+	Id                  int64              `json:"id" gorm:"index:sales_return_detail_id_enterprise,unique:true,priority:1"`
+	ReturnId            int64              `json:"returnId" gorm:"column:sales_return;not null:true;index:sales_return_detail_return_order_detail,unique:true,priority:1"`
+	Return              SalesReturn        `json:"-" gorm:"foreignKey:ReturnId,EnterpriseId;references:Id,EnterpriseId"`
+	OrderDetailId       int64              `json:"orderDetailId" gorm:"column:order_detail;not null:true;index:sales_return_detail_return_order_detail,unique:true,priority:2"`
+	OrderDetail         SalesOrderDetail   `json:"-" gorm:"foreignKey:OrderDetailId,EnterpriseId;references:Id,EnterpriseId"`
+	ProductId           int32              `json:"productId" gorm:"column:product;not null:true"`
+	Product             Product            `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	Quantity            float64            `json:"quantity" gorm:"type:numeric(14,6);not null:true"`
+	Price               float64            `json:"price" gorm:"type:numeric(14,6);not null:true"`
+	VatPercent          float64            `json:"vatPercent" gorm:"type:numeric(14,6);not null:true"`
+	TotalAmount         float64            `json:"totalAmount" gorm:"type:numeric(14,6);not null:true"`
+	Reason              string             `json:"reason" gorm:"type:character(1);not null:true"` // _ = Not specified, D = Defective, W = Wrong product, N = Not wanted, O = Other
+	ReasonDescription   string             `json:"reasonDescription" gorm:"type:character varying(250);not null:true"`
+	Inspection          string             `json:"inspection" gorm:"type:character(1);not null:true"` // _ = Pending, R = Restock, S = Scrap, P = Repair
+	WarehouseMovementId *int64             `json:"warehouseMovementId" gorm:"column:warehouse_movement"`
+	WarehouseMovement   *WarehouseMovement `json:"-" gorm:"foreignKey:WarehouseMovementId,EnterpriseId;references:Id,EnterpriseId"`
+	AmendingInvoiceId   *int64             `json:"amendingInvoiceId" gorm:"column:amending_invoice"`
+	AmendingInvoice     *SalesInvoice      `json:"-" gorm:"foreignKey:AmendingInvoiceId,EnterpriseId;references:Id,EnterpriseId"`
+	EnterpriseId        int32              `json:"-" gorm:"column:enterprise;not null:true;index:sales_return_detail_id_enterprise,unique:true,priority:2"`
+	Enterprise          Settings           `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (d *SalesReturnDetail) TableName() string {
+	return "sales_return_detail"
+}
+
+func getSalesReturnDetail(returnId int64, enterpriseId int32) []SalesReturnDetail {
+	var details []SalesReturnDetail = make([]SalesReturnDetail, 0)
+	result := dbOrm.Where("sales_return = ? AND enterprise = ?", returnId, enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&details)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return details
+	}
+
+	return details
+}
+
+func getSalesReturnDetailRow(detailId int64) SalesReturnDetail {
+	var detail SalesReturnDetail = SalesReturnDetail{}
+	result := dbOrm.Where("id = ?", detailId).Preload(clause.Associations).First(&detail)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return detail
+	}
+
+	return detail
+}
+
+func (d *SalesReturnDetail) isValid() bool {
+	return !(d.ReturnId <= 0 || d.OrderDetailId <= 0 || d.Quantity <= 0 || len(d.ReasonDescription) > 250 || (d.Reason != "_" && d.Reason != "D" && d.Reason != "W" && d.Reason != "N" && d.Reason != "O") || (d.Inspection != "_" && d.Inspection != "R" && d.Inspection != "S" && d.Inspection != "P"))
+}
+
+func (d *SalesReturnDetail) BeforeCreate(tx *gorm.DB) (err error) {
+	var salesReturnDetail SalesReturnDetail
+	tx.Model(&SalesReturnDetail{}).Last(&salesReturnDetail)
+	d.Id = salesReturnDetail.Id + 1
+	return nil
+}
+
+// Adds a line from a sale order detail of the customer of the return. The product, price and VAT are copied from the sale order detail.
+// ERROR CODES:
+// 1. The return is not pending, it can't be modified
+// 2. The quantity is greater than the delivered quantity pending to be returned
+// 3. There is already a line for this sale order detail in the return
+func (d *SalesReturnDetail) insertSalesReturnDetail(userId int32) OkAndErrorCodeReturn {
+	if len(d.Reason) == 0 {
+		d.Reason = "_"
+	}
+	if len(d.Inspection) == 0 {
+		d.Inspection = "_"
+	}
+	if !d.isValid() {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	r := getSalesReturnRow(d.ReturnId)
+	if r.Id <= 0 || r.EnterpriseId != d.EnterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if r.Status != "_" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	orderDetail := getSalesOrderDetailRow(d.OrderDetailId)
+	if orderDetail.Id <= 0 || orderDetail.EnterpriseId != d.EnterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	saleOrder := getSalesOrderRow(orderDetail.OrderId)
+	if saleOrder.CustomerId != r.CustomerId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	var countOrderDetailInReturn int64
+	result := dbOrm.Model(&SalesReturnDetail{}).Where("sales_return = ? AND order_detail = ?", d.ReturnId, d.OrderDetailId).Count(&countOrderDetailInReturn)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if countOrderDetailInReturn > 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+
+	if d.Quantity > getSalesOrderDetailQuantityReturnable(d.OrderDetailId, 0, d.EnterpriseId) {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+
+	d.ProductId = orderDetail.ProductId
+	d.Price = orderDetail.Price
+	d.VatPercent = orderDetail.VatPercent
+	d.TotalAmount = (d.Price * d.Quantity) * (1 + (d.VatPercent / 100))
+	d.WarehouseMovementId = nil
+	d.AmendingInvoiceId = nil
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	result = trans.Create(&d)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	ok := addTotalProductsSalesReturn(d.EnterpriseId, d.ReturnId, userId, d.Price*d.Quantity, d.VatPercent, 1, *trans)
+	if !ok {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(d.EnterpriseId, "sales_return_detail", int(d.Id), userId, "I")
+	json, _ := json.Marshal(d)
+	go fireWebHook(d.EnterpriseId, "sales_return_detail", "POST", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+// Only the quantity, the reason and the inspection outcome can be modified.
+// ERROR CODES:
+// 1. The return is not pending, it can't be modified
+// 2. The quantity is greater than the delivered quantity pending to be returned
+func (d *SalesReturnDetail) updateSalesReturnDetail(userId int32) OkAndErrorCodeReturn {
+	if d.Id <= 0 {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	inMemoryDetail := getSalesReturnDetailRow(d.Id)
+	if inMemoryDetail.Id <= 0 || inMemoryDetail.EnterpriseId != d.EnterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	r := getSalesReturnRow(inMemoryDetail.ReturnId)
+	if r.Status != "_" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	d.ReturnId = inMemoryDetail.ReturnId
+	d.OrderDetailId = inMemoryDetail.OrderDetailId
+	if !d.isValid() {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if d.Quantity > getSalesOrderDetailQuantityReturnable(d.OrderDetailId, d.Id, d.EnterpriseId) {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	// take out the old amounts and add the new ones
+	ok := addTotalProductsSalesReturn(d.EnterpriseId, inMemoryDetail.ReturnId, userId, -(inMemoryDetail.Price * inMemoryDetail.Quantity), inMemoryDetail.VatPercent, 0, *trans)
+	if !ok {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	inMemoryDetail.Quantity = d.Quantity
+	inMemoryDetail.Reason = d.Reason
+	inMemoryDetail.ReasonDescription = d.ReasonDescription
+	inMemoryDetail.Inspection = d.Inspection
+	inMemoryDetail.TotalAmount = (inMemoryDetail.Price * inMemoryDetail.Quantity) * (1 + (inMemoryDetail.VatPercent / 100))
+
+	result := trans.Save(&inMemoryDetail)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	ok = addTotalProductsSalesReturn(d.EnterpriseId, inMemoryDetail.ReturnId, userId, inMemoryDetail.Price*inMemoryDetail.Quantity, inMemoryDetail.VatPercent, 0, *trans)
+	if !ok {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(d.EnterpriseId, "sales_return_detail", int(d.Id), userId, "U")
+	json, _ := json.Marshal(inMemoryDetail)
+	go fireWebHook(d.EnterpriseId, "sales_return_detail", "PUT", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+// ERROR CODES:
+// 1. The return is not pending, it can't be modified
+func (d *SalesReturnDetail) deleteSalesReturnDetail(userId int32) OkAndErrorCodeReturn {
+	if d.Id <= 0 {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	inMemoryDetail := getSalesReturnDetailRow(d.Id)
+	if inMemoryDetail.Id <= 0 || inMemoryDetail.EnterpriseId != d.EnterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	r := getSalesReturnRow(inMemoryDetail.ReturnId)
+	if r.Status != "_" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	result := trans.Where("id = ? AND enterprise = ?", d.Id, d.EnterpriseId).Delete(&SalesReturnDetail{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	ok := addTotalProductsSalesReturn(d.EnterpriseId, inMemoryDetail.ReturnId, userId, -(inMemoryDetail.Price * inMemoryDetail.Quantity), inMemoryDetail.VatPercent, -1, *trans)
+	if !ok {
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(d.EnterpriseId, "sales_return_detail", int(d.Id), userId, "D")
+	json, _ := json.Marshal(inMemoryDetail)
+	go fireWebHook(d.EnterpriseId, "sales_return_detail", "DELETE", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
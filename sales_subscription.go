@@ -0,0 +1,402 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A template to generate the same sale order periodically for a customer.
+type SalesSubscription struct {
+	Id                int32         `json:"id" gorm:"index:sales_subscription_id_enterprise,unique:true,priority:1"`
+	Name              string        `json:"name" gorm:"type:character varying(100);not null:true"`
+	CustomerId        int32         `json:"customerId" gorm:"column:customer;not null:true"`
+	Customer          Customer      `json:"customer" gorm:"foreignKey:CustomerId,EnterpriseId;references:Id,EnterpriseId"`
+	PaymentMethodId   int32         `json:"paymentMethodId" gorm:"column:payment_method;not null:true"`
+	PaymentMethod     PaymentMethod `json:"paymentMethod" gorm:"foreignKey:PaymentMethodId,EnterpriseId;references:Id,EnterpriseId"`
+	BillingSeriesId   string        `json:"billingSeriesId" gorm:"column:billing_series;type:character(3);not null:true"`
+	BillingSeries     BillingSerie  `json:"billingSeries" gorm:"foreignKey:BillingSeriesId,EnterpriseId;references:Id,EnterpriseId"`
+	CurrencyId        int32         `json:"currencyId" gorm:"column:currency;not null:true"`
+	Currency          Currency      `json:"currency" gorm:"foreignKey:CurrencyId,EnterpriseId;references:Id,EnterpriseId"`
+	BillingAddressId  int32         `json:"billingAddressId" gorm:"column:billing_address;not null:true"`
+	BillingAddress    Address       `json:"billingAddress" gorm:"foreignKey:BillingAddressId,EnterpriseId;references:Id,EnterpriseId"`
+	ShippingAddressId int32         `json:"shippingAddressId" gorm:"column:shipping_address;not null:true"`
+	ShippingAddress   Address       `json:"shippingAddress" gorm:"foreignKey:ShippingAddressId,EnterpriseId;references:Id,EnterpriseId"`
+	Interval          string        `json:"interval" gorm:"type:character(1);not null:true"` // D = Days, W = Weeks, M = Months, Y = Years
+	IntervalCount     int16         `json:"intervalCount" gorm:"not null:true"`
+	DateStart         time.Time     `json:"dateStart" gorm:"type:timestamp(3) with time zone;not null:true"`
+	DateEnd           *time.Time    `json:"dateEnd" gorm:"type:timestamp(3) with time zone"`
+	NextRunDate       time.Time     `json:"nextRunDate" gorm:"type:timestamp(3) with time zone;not null:true"`
+	AutoInvoice       bool          `json:"autoInvoice" gorm:"not null:true"`
+	SendInvoiceEmail  bool          `json:"sendInvoiceEmail" gorm:"not null:true"`
+	Off               bool          `json:"off" gorm:"not null:true"`
+	Notes             string        `json:"notes" gorm:"type:character varying(250);not null:true"`
+	LinesNumber       int16         `json:"linesNumber" gorm:"not null:true"`
+	EnterpriseId      int32         `json:"-" gorm:"column:enterprise;not null:true;index:sales_subscription_id_enterprise,unique:true,priority:2"`
+	Enterprise        Settings      `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (s *SalesSubscription) TableName() string {
+	return "sales_subscription"
+}
+
+func getSalesSubscriptions(enterpriseId int32) []SalesSubscription {
+	var subscriptions []SalesSubscription = make([]SalesSubscription, 0)
+	result := dbOrm.Model(&SalesSubscription{}).Where("enterprise = ?", enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&subscriptions)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return subscriptions
+}
+
+func getSalesSubscriptionRow(subscriptionId int32) SalesSubscription {
+	s := SalesSubscription{}
+	result := dbOrm.Model(&SalesSubscription{}).Where("id = ?", subscriptionId).Preload(clause.Associations).First(&s)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return s
+}
+
+func (s *SalesSubscription) isValid() bool {
+	return !(len(s.Name) == 0 || len(s.Name) > 100 || s.CustomerId <= 0 || s.PaymentMethodId <= 0 || len(s.BillingSeriesId) == 0 || s.CurrencyId <= 0 || s.BillingAddressId <= 0 || s.ShippingAddressId <= 0 || (s.Interval != "D" && s.Interval != "W" && s.Interval != "M" && s.Interval != "Y") || s.IntervalCount <= 0 || s.DateStart.IsZero() || (s.DateEnd != nil && s.DateEnd.Before(s.DateStart)) || len(s.Notes) > 250 || (s.SendInvoiceEmail && !s.AutoInvoice))
+}
+
+func (s *SalesSubscription) BeforeCreate(tx *gorm.DB) (err error) {
+	var salesSubscription SalesSubscription
+	tx.Model(&SalesSubscription{}).Last(&salesSubscription)
+	s.Id = salesSubscription.Id + 1
+	return nil
+}
+
+func (s *SalesSubscription) insertSalesSubscription(userId int32) bool {
+	if !s.isValid() {
+		return false
+	}
+
+	// the first order is generated at the start date
+	s.NextRunDate = s.DateStart
+	s.LinesNumber = 0
+
+	result := dbOrm.Create(&s)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	insertTransactionalLog(s.EnterpriseId, "sales_subscription", int(s.Id), userId, "I")
+	json, _ := json.Marshal(s)
+	go fireWebHook(s.EnterpriseId, "sales_subscription", "POST", string(json))
+
+	return true
+}
+
+func (s *SalesSubscription) updateSalesSubscription(userId int32) bool {
+	if s.Id <= 0 || !s.isValid() {
+		return false
+	}
+
+	var subscription SalesSubscription
+	result := dbOrm.Where("id = ? AND enterprise = ?", s.Id, s.EnterpriseId).First(&subscription)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	// if the subscription has not run yet, the next run is moved with the start date
+	if subscription.NextRunDate.Equal(subscription.DateStart) {
+		subscription.NextRunDate = s.DateStart
+	}
+
+	subscription.Name = s.Name
+	subscription.CustomerId = s.CustomerId
+	subscription.PaymentMethodId = s.PaymentMethodId
+	subscription.BillingSeriesId = s.BillingSeriesId
+	subscription.CurrencyId = s.CurrencyId
+	subscription.BillingAddressId = s.BillingAddressId
+	subscription.ShippingAddressId = s.ShippingAddressId
+	subscription.Interval = s.Interval
+	subscription.IntervalCount = s.IntervalCount
+	subscription.DateStart = s.DateStart
+	subscription.DateEnd = s.DateEnd
+	subscription.AutoInvoice = s.AutoInvoice
+	subscription.SendInvoiceEmail = s.SendInvoiceEmail
+	subscription.Off = s.Off
+	subscription.Notes = s.Notes
+
+	result = dbOrm.Save(&subscription)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	insertTransactionalLog(s.EnterpriseId, "sales_subscription", int(s.Id), userId, "U")
+	json, _ := json.Marshal(subscription)
+	go fireWebHook(s.EnterpriseId, "sales_subscription", "PUT", string(json))
+
+	return true
+}
+
+func (s *SalesSubscription) deleteSalesSubscription(userId int32) bool {
+	if s.Id <= 0 {
+		return false
+	}
+
+	inMemorySubscription := getSalesSubscriptionRow(s.Id)
+	if inMemorySubscription.Id <= 0 || inMemorySubscription.EnterpriseId != s.EnterpriseId {
+		return false
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return false
+	}
+	///
+
+	result := trans.Where("subscription = ? AND enterprise = ?", s.Id, s.EnterpriseId).Delete(&SalesSubscriptionLog{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("subscription = ? AND enterprise = ?", s.Id, s.EnterpriseId).Delete(&SalesSubscriptionDetail{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	result = trans.Where("id = ? AND enterprise = ?", s.Id, s.EnterpriseId).Delete(&SalesSubscription{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return false
+	}
+	///
+
+	insertTransactionalLog(s.EnterpriseId, "sales_subscription", int(s.Id), userId, "D")
+	json, _ := json.Marshal(inMemorySubscription)
+	go fireWebHook(s.EnterpriseId, "sales_subscription", "DELETE", string(json))
+
+	return true
+}
+
+// Returns the next date after the given date, adding the interval of the subscription.
+func (s *SalesSubscription) nextDate(date time.Time) time.Time {
+	switch s.Interval {
+	case "D":
+		return date.AddDate(0, 0, int(s.IntervalCount))
+	case "W":
+		return date.AddDate(0, 0, int(s.IntervalCount)*7)
+	case "M":
+		return date.AddDate(0, int(s.IntervalCount), 0)
+	case "Y":
+		return date.AddDate(int(s.IntervalCount), 0, 0)
+	}
+	return date
+}
+
+// A record of every order generated by a subscription, or of the error that prevented the order from being generated.
+type SalesSubscriptionLog struct {
+	Id             int64             `json:"id" gorm:"index:sales_subscription_log_id_enterprise,unique:true,priority:1"`
+	SubscriptionId int32             `json:"subscriptionId" gorm:"column:subscription;not null:true;index:sales_subscription_log_subscription,priority:1"`
+	Subscription   SalesSubscription `json:"-" gorm:"foreignKey:SubscriptionId,EnterpriseId;references:Id,EnterpriseId"`
+	DateCreated    time.Time         `json:"dateCreated" gorm:"type:timestamp(3) with time zone;not null:true;index:sales_subscription_log_subscription,priority:2,sort:desc"`
+	SalesOrderId   *int64            `json:"salesOrderId" gorm:"column:sales_order"`
+	SalesOrder     *SaleOrder        `json:"salesOrder" gorm:"foreignKey:SalesOrderId,EnterpriseId;references:Id,EnterpriseId"`
+	SalesInvoiceId *int64            `json:"salesInvoiceId" gorm:"column:sales_invoice"`
+	SalesInvoice   *SalesInvoice     `json:"salesInvoice" gorm:"foreignKey:SalesInvoiceId,EnterpriseId;references:Id,EnterpriseId"`
+	EmailSent      bool              `json:"emailSent" gorm:"not null:true"`
+	Ok             bool              `json:"ok" gorm:"not null:true"`
+	ErrorMessage   string            `json:"errorMessage" gorm:"type:character varying(250);not null:true"`
+	EnterpriseId   int32             `json:"-" gorm:"column:enterprise;not null:true;index:sales_subscription_log_id_enterprise,unique:true,priority:2"`
+	Enterprise     Settings          `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (l *SalesSubscriptionLog) TableName() string {
+	return "sales_subscription_log"
+}
+
+func (l *SalesSubscriptionLog) BeforeCreate(tx *gorm.DB) (err error) {
+	var salesSubscriptionLog SalesSubscriptionLog
+	tx.Model(&SalesSubscriptionLog{}).Last(&salesSubscriptionLog)
+	l.Id = salesSubscriptionLog.Id + 1
+	return nil
+}
+
+func getSalesSubscriptionLogs(subscriptionId int32, enterpriseId int32) []SalesSubscriptionLog {
+	var logs []SalesSubscriptionLog = make([]SalesSubscriptionLog, 0)
+	result := dbOrm.Model(&SalesSubscriptionLog{}).Where("subscription = ? AND enterprise = ?", subscriptionId, enterpriseId).Order("date_created DESC").Preload(clause.Associations).Find(&logs)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return logs
+}
+
+func (l *SalesSubscriptionLog) insertSalesSubscriptionLog() bool {
+	l.DateCreated = time.Now()
+	if len(l.ErrorMessage) > 250 {
+		l.ErrorMessage = l.ErrorMessage[:250]
+	}
+
+	result := dbOrm.Create(&l)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+	return true
+}
+
+// Generates the orders of all the subscriptions of the enterprise that are due. Called by the cron.
+func runSalesSubscriptions(enterpriseId int32) {
+	var subscriptions []SalesSubscription = make([]SalesSubscription, 0)
+	now := time.Now()
+	result := dbOrm.Model(&SalesSubscription{}).Where("enterprise = ? AND NOT off AND next_run_date <= ? AND (date_end IS NULL OR next_run_date <= date_end)", enterpriseId, now).Order("id ASC").Find(&subscriptions)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return
+	}
+
+	for i := 0; i < len(subscriptions); i++ {
+		subscriptions[i].runSalesSubscription(0)
+	}
+}
+
+// Generates the sale order of the subscription, invoices the order and sends the invoice by email, if it's configured in the subscription.
+// The next run date is moved after the current date, the periods that were not generated are not generated again.
+// The result of the run is saved in the subscription log.
+func (s *SalesSubscription) runSalesSubscription(userId int32) SalesSubscriptionLog {
+	subscriptionLog := SalesSubscriptionLog{
+		SubscriptionId: s.Id,
+		EnterpriseId:   s.EnterpriseId,
+	}
+
+	// move the next run date, so the subscription is not generated again if there is an error
+	nextRunDate := s.NextRunDate
+	now := time.Now()
+	for !nextRunDate.After(now) {
+		nextRunDate = s.nextDate(nextRunDate)
+	}
+	result := dbOrm.Model(&SalesSubscription{}).Where("id = ? AND enterprise = ?", s.Id, s.EnterpriseId).Update("next_run_date", nextRunDate)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return subscriptionLog
+	}
+	s.NextRunDate = nextRunDate
+
+	details := getSalesSubscriptionDetail(s.Id, s.EnterpriseId)
+	if len(details) == 0 {
+		subscriptionLog.ErrorMessage = "The subscription has no details"
+		subscriptionLog.insertSalesSubscriptionLog()
+		return subscriptionLog
+	}
+
+	o := SaleOrder{
+		CustomerId:        s.CustomerId,
+		PaymentMethodId:   s.PaymentMethodId,
+		BillingSeriesId:   s.BillingSeriesId,
+		CurrencyId:        s.CurrencyId,
+		BillingAddressId:  s.BillingAddressId,
+		ShippingAddressId: s.ShippingAddressId,
+		Reference:         "SUB" + strconv.Itoa(int(s.Id)),
+		Description:       s.Name,
+		Notes:             s.Notes,
+		EnterpriseId:      s.EnterpriseId,
+	}
+	okAndErr, orderId := o.insertSalesOrder(userId, nil)
+	if !okAndErr.Ok {
+		subscriptionLog.ErrorMessage = "The sale order could not be created" + getCustomerRiskErrorMessage(okAndErr)
+		subscriptionLog.insertSalesSubscriptionLog()
+		return subscriptionLog
+	}
+	subscriptionLog.SalesOrderId = &orderId
+
+	for i := 0; i < len(details); i++ {
+		d := SalesOrderDetail{
+			OrderId:      orderId,
+			ProductId:    details[i].ProductId,
+			Price:        details[i].Price,
+			Quantity:     details[i].Quantity,
+			VatPercent:   details[i].VatPercent,
+			EnterpriseId: s.EnterpriseId,
+		}
+		okAndErr := d.insertSalesOrderDetail(userId, nil)
+		if !okAndErr.Ok {
+			// undo the sale order
+			o := SaleOrder{Id: orderId, EnterpriseId: s.EnterpriseId}
+			o.deleteSalesOrder(userId)
+			subscriptionLog.SalesOrderId = nil
+			subscriptionLog.ErrorMessage = "The sale order detail could not be created. Product: " + details[i].Product.Name
+			subscriptionLog.insertSalesSubscriptionLog()
+			return subscriptionLog
+		}
+	}
+
+	if s.AutoInvoice {
+		okAndErr := invoiceAllSaleOrder(orderId, s.EnterpriseId, userId)
+		if !okAndErr.Ok {
+			subscriptionLog.ErrorMessage = "The sale order could not be invoiced"
+			subscriptionLog.insertSalesSubscriptionLog()
+			return subscriptionLog
+		}
+
+		invoices := getSalesOrderInvoices(orderId, s.EnterpriseId)
+		if len(invoices) > 0 {
+			subscriptionLog.SalesInvoiceId = &invoices[0].Id
+
+			if s.SendInvoiceEmail {
+				customer := getCustomerRow(s.CustomerId)
+				var languageId int32
+				if customer.LanguageId != nil {
+					languageId = *customer.LanguageId
+				}
+				e := EmailInfo{
+					DestinationAddress:     customer.Email,
+					DestinationAddressName: customer.Name,
+					Subject:                "Invoice " + invoices[0].InvoiceName,
+					ReportId:               "SALES_INVOICE",
+					ReportDataId:           int32(invoices[0].Id),
+					Language:               languageId,
+				}
+				subscriptionLog.EmailSent = e.sendEmail(s.EnterpriseId)
+				if !subscriptionLog.EmailSent {
+					subscriptionLog.ErrorMessage = "The invoice could not be sent by email"
+				}
+			}
+		}
+	}
+
+	subscriptionLog.Ok = true
+	subscriptionLog.insertSalesSubscriptionLog()
+	return subscriptionLog
+}
+
+// Generates the order of a subscription now, without waiting for the cron.
+func runSalesSubscriptionNow(subscriptionId int32, enterpriseId int32, userId int32) SalesSubscriptionLog {
+	s := getSalesSubscriptionRow(subscriptionId)
+	if s.Id <= 0 || s.EnterpriseId != enterpriseId {
+		return SalesSubscriptionLog{}
+	}
+	return s.runSalesSubscription(userId)
+}
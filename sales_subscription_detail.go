@@ -0,0 +1,211 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SalesSubscriptionDetail struct {
+	Id             int64             `json:"id" gorm:"index:sales_subscription_detail_id_enterprise,unique:true,priority:1"`
+	SubscriptionId int32             `json:"subscriptionId" gorm:"column:subscription;not null:true;index:sales_subscription_detail_subscription_product,unique:true,priority:1"`
+	Subscription   SalesSubscription `json:"-" gorm:"foreignKey:SubscriptionId,EnterpriseId;references:Id,EnterpriseId"`
+	ProductId      int32             `json:"productId" gorm:"column:product;not null:true;index:sales_subscription_detail_subscription_product,unique:true,priority:2"`
+	Product        Product           `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	Price          float64           `json:"price" gorm:"type:numeric(14,6);not null:true"`
+	Quantity       float64           `json:"quantity" gorm:"type:numeric(14,6);not null:true"`
+	VatPercent     float64           `json:"vatPercent" gorm:"type:numeric(14,6);not null:true"`
+	EnterpriseId   int32             `json:"-" gorm:"column:enterprise;not null:true;index:sales_subscription_detail_id_enterprise,unique:true,priority:2"`
+	Enterprise     Settings          `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (d *SalesSubscriptionDetail) TableName() string {
+	return "sales_subscription_detail"
+}
+
+func getSalesSubscriptionDetail(subscriptionId int32, enterpriseId int32) []SalesSubscriptionDetail {
+	var details []SalesSubscriptionDetail = make([]SalesSubscriptionDetail, 0)
+	result := dbOrm.Where("subscription = ? AND enterprise = ?", subscriptionId, enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&details)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return details
+}
+
+func (d *SalesSubscriptionDetail) isValid() bool {
+	return !(d.SubscriptionId <= 0 || d.ProductId <= 0 || d.Quantity <= 0 || d.Price < 0 || d.VatPercent < 0)
+}
+
+func (d *SalesSubscriptionDetail) BeforeCreate(tx *gorm.DB) (err error) {
+	var salesSubscriptionDetail SalesSubscriptionDetail
+	tx.Model(&SalesSubscriptionDetail{}).Last(&salesSubscriptionDetail)
+	d.Id = salesSubscriptionDetail.Id + 1
+	return nil
+}
+
+// ERROR CODES:
+// 1. the product is deactivated
+// 2. there is aleady a detail with this product
+func (d *SalesSubscriptionDetail) insertSalesSubscriptionDetail(userId int32) OkAndErrorCodeReturn {
+	if !d.isValid() {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	p := getProductRow(d.ProductId)
+	if p.Id <= 0 || p.EnterpriseId != d.EnterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if p.Off {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	s := getSalesSubscriptionRow(d.SubscriptionId)
+	if s.Id <= 0 || s.EnterpriseId != d.EnterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	var countProductInSubscription int64
+	result := dbOrm.Model(&SalesSubscriptionDetail{}).Where("product = ? AND subscription = ?", d.ProductId, d.SubscriptionId).Count(&countProductInSubscription)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if countProductInSubscription > 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	result = trans.Create(&d)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	var linesNumber int64
+	result = trans.Model(&SalesSubscriptionDetail{}).Where("subscription = ?", d.SubscriptionId).Count(&linesNumber)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	result = trans.Model(&SalesSubscription{}).Where("id = ?", d.SubscriptionId).Update("lines_number", linesNumber)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	insertTransactionalLog(d.EnterpriseId, "sales_subscription_detail", int(d.Id), userId, "I")
+	json, _ := json.Marshal(d)
+	go fireWebHook(d.EnterpriseId, "sales_subscription_detail", "POST", string(json))
+
+	return OkAndErrorCodeReturn{Ok: true}
+}
+
+func (d *SalesSubscriptionDetail) updateSalesSubscriptionDetail(userId int32) bool {
+	if d.Id <= 0 || d.Quantity <= 0 || d.Price < 0 || d.VatPercent < 0 {
+		return false
+	}
+
+	var detail SalesSubscriptionDetail
+	result := dbOrm.Where("id = ? AND enterprise = ?", d.Id, d.EnterpriseId).First(&detail)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	detail.Price = d.Price
+	detail.Quantity = d.Quantity
+	detail.VatPercent = d.VatPercent
+
+	result = dbOrm.Save(&detail)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	insertTransactionalLog(d.EnterpriseId, "sales_subscription_detail", int(d.Id), userId, "U")
+	json, _ := json.Marshal(detail)
+	go fireWebHook(d.EnterpriseId, "sales_subscription_detail", "PUT", string(json))
+
+	return true
+}
+
+func (d *SalesSubscriptionDetail) deleteSalesSubscriptionDetail(userId int32) bool {
+	if d.Id <= 0 {
+		return false
+	}
+
+	var detail SalesSubscriptionDetail
+	result := dbOrm.Where("id = ? AND enterprise = ?", d.Id, d.EnterpriseId).First(&detail)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return false
+	}
+	///
+
+	result = trans.Where("id = ? AND enterprise = ?", d.Id, d.EnterpriseId).Delete(&SalesSubscriptionDetail{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	var linesNumber int64
+	result = trans.Model(&SalesSubscriptionDetail{}).Where("subscription = ?", detail.SubscriptionId).Count(&linesNumber)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	result = trans.Model(&SalesSubscription{}).Where("id = ?", detail.SubscriptionId).Update("lines_number", linesNumber)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	///
+	result = trans.Commit()
+	if result.Error != nil {
+		return false
+	}
+	///
+
+	insertTransactionalLog(d.EnterpriseId, "sales_subscription_detail", int(d.Id), userId, "D")
+	json, _ := json.Marshal(detail)
+	go fireWebHook(d.EnterpriseId, "sales_subscription_detail", "DELETE", string(json))
+
+	return true
+}
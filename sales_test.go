@@ -11,11 +11,22 @@ You should have received a copy of the GNU Affero General Public License along w
 package main
 
 import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"database/sql"
+	"encoding/base64"
+	"encoding/xml"
 	"fmt"
 	gorm_log "log"
 	"math"
+	"math/big"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -234,7 +245,8 @@ func TestSalesOrderInsertUpdateDelete(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	ok, orderId := o.insertSalesOrder(1)
+	okAndErr, orderId := o.insertSalesOrder(1, nil)
+	ok := okAndErr.Ok
 	if !ok || orderId <= 0 {
 		t.Error("Insert error, sale order not inserted.")
 		return
@@ -439,7 +451,7 @@ func TestSaleOrderDetailInsertUpdateDelete(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 
 	d := SalesOrderDetail{
 		OrderId:      orderId,
@@ -451,7 +463,7 @@ func TestSaleOrderDetailInsertUpdateDelete(t *testing.T) {
 	}
 
 	// test insert
-	ok := d.insertSalesOrderDetail(0).Ok
+	ok := d.insertSalesOrderDetail(0, nil).Ok
 	if !ok {
 		t.Error("Insert error, sale order detail not inserted")
 		return
@@ -703,7 +715,7 @@ func TestInvoiceAllSaleOrder(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 
 	d := SalesOrderDetail{
 		OrderId:      orderId,
@@ -714,7 +726,7 @@ func TestInvoiceAllSaleOrder(t *testing.T) {
 		EnterpriseId: 1,
 	}
 
-	d.insertSalesOrderDetail(0)
+	d.insertSalesOrderDetail(0, nil)
 
 	ok := invoiceAllSaleOrder(orderId, 1, 0).Ok
 	if !ok {
@@ -782,7 +794,7 @@ func TestIInvoicePartiallySaleOrder(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 
 	d := SalesOrderDetail{
 		OrderId:      orderId,
@@ -793,7 +805,7 @@ func TestIInvoicePartiallySaleOrder(t *testing.T) {
 		EnterpriseId: 1,
 	}
 
-	d.insertSalesOrderDetail(0)
+	d.insertSalesOrderDetail(0, nil)
 	details := getSalesOrderDetail(orderId, 1)
 
 	invoiceInfo := OrderDetailGenerate{
@@ -1695,7 +1707,7 @@ func TestDeliveryNoteAllSaleOrder(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 
 	d := SalesOrderDetail{
 		OrderId:      orderId,
@@ -1706,7 +1718,7 @@ func TestDeliveryNoteAllSaleOrder(t *testing.T) {
 		EnterpriseId: 1,
 	}
 
-	d.insertSalesOrderDetail(0)
+	d.insertSalesOrderDetail(0, nil)
 
 	okAndErr, noteId := deliveryNoteAllSaleOrder(orderId, 1, 0, nil)
 	if !okAndErr.Ok {
@@ -1774,7 +1786,7 @@ func TestDeliveryNotePartiallySaleOrder(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 
 	d := SalesOrderDetail{
 		OrderId:      orderId,
@@ -1785,7 +1797,7 @@ func TestDeliveryNotePartiallySaleOrder(t *testing.T) {
 		EnterpriseId: 1,
 	}
 
-	d.insertSalesOrderDetail(0)
+	d.insertSalesOrderDetail(0, nil)
 	details := getSalesOrderDetail(orderId, 1)
 
 	invoiceInfo := OrderDetailGenerate{
@@ -1905,7 +1917,7 @@ func TestSaleOrderDiscount(t *testing.T) {
 		EnterpriseId:      1,
 	}
 
-	_, orderId := o.insertSalesOrder(1)
+	_, orderId := o.insertSalesOrder(1, nil)
 
 	d := SalesOrderDetail{
 		OrderId:      orderId,
@@ -1917,7 +1929,7 @@ func TestSaleOrderDiscount(t *testing.T) {
 	}
 
 	// test insert
-	ok := d.insertSalesOrderDetail(0).Ok
+	ok := d.insertSalesOrderDetail(0, nil).Ok
 	if !ok {
 		t.Error("Insert error, sale order detail not inserted")
 		return
@@ -1980,3 +1992,1210 @@ func TestSaleOrderDiscount(t *testing.T) {
 	o.EnterpriseId = 1
 	o.deleteSalesOrder(1)
 }
+
+// ===== SALES QUOTATIONS
+
+func TestGetSalesQuotations(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	q := PaginationQuery{Offset: 0, Limit: MAX_INT32}
+	o := q.getSalesQuotations(1)
+
+	for i := 0; i < len(o.Quotations); i++ {
+		if o.Quotations[i].Id <= 0 {
+			t.Error("Scan error, sales quotations with ID 0.")
+			return
+		}
+	}
+}
+
+func TestSalesQuotationInsertUpdateDelete(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	q := SalesQuotation{
+		CustomerId:        1,
+		PaymentMethodId:   3,
+		BillingSeriesId:   "EXP",
+		CurrencyId:        1,
+		BillingAddressId:  1,
+		ShippingAddressId: 1,
+		ValidUntil:        time.Now().AddDate(0, 0, 30),
+		EnterpriseId:      1,
+	}
+
+	ok, quotationId := q.insertSalesQuotation(1)
+	if !ok || quotationId <= 0 {
+		t.Error("Insert error, sales quotation not inserted.")
+		return
+	}
+
+	d := SalesQuotationDetail{
+		QuotationId:  quotationId,
+		ProductId:    4,
+		Price:        9.99,
+		Quantity:     2,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+	if !d.insertSalesQuotationDetail(1).Ok {
+		t.Error("Insert error, sales quotation detail not inserted.")
+		return
+	}
+
+	quotationInMemory := getSalesQuotationRow(quotationId)
+	if quotationInMemory.LinesNumber != 1 || math.Round(quotationInMemory.TotalAmount*100)/100 != math.Round(d.TotalAmount*100)/100 {
+		t.Error("Incorrect totals after inserting the sales quotation detail.")
+		return
+	}
+
+	q.Id = quotationId
+	q.Notes = "Test"
+	if !q.updateSalesQuotation(1).Ok {
+		t.Error("Update error, sales quotation not updated.")
+		return
+	}
+
+	quotationInMemory = getSalesQuotationRow(quotationId)
+	if quotationInMemory.Notes != "Test" {
+		t.Error("Update not successful, sales quotation not updated.")
+		return
+	}
+
+	details := getSalesQuotationDetail(quotationId, 1)
+	if len(details) == 0 || !details[0].deleteSalesQuotationDetail(1).Ok {
+		t.Error("Delete error, sales quotation detail not deleted.")
+		return
+	}
+
+	if !q.deleteSalesQuotation(1).Ok {
+		t.Error("Delete error, sales quotation not deleted.")
+		return
+	}
+}
+
+func TestAcceptSalesQuotation(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	q := SalesQuotation{
+		CustomerId:        1,
+		PaymentMethodId:   3,
+		BillingSeriesId:   "EXP",
+		CurrencyId:        1,
+		BillingAddressId:  1,
+		ShippingAddressId: 1,
+		ValidUntil:        time.Now().AddDate(0, 0, 30),
+		EnterpriseId:      1,
+	}
+
+	_, quotationId := q.insertSalesQuotation(1)
+
+	d := SalesQuotationDetail{
+		QuotationId:  quotationId,
+		ProductId:    4,
+		Price:        9.99,
+		Quantity:     2,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+	d.insertSalesQuotationDetail(1)
+
+	orderNumber := getNextSaleOrderNumber("EXP", 1)
+	result := acceptSalesQuotation(quotationId, 1, 1)
+	if !result.Ok {
+		t.Error("Could not accept the sales quotation", result.ErrorCode)
+		return
+	}
+
+	quotation := getSalesQuotationRow(quotationId)
+	if quotation.Status != "A" || quotation.SaleOrderId == nil {
+		t.Error("The sales quotation has not been marked as accepted")
+		return
+	}
+
+	o := getSalesOrderRow(*quotation.SaleOrderId)
+	if o.OrderNumber != orderNumber || o.LinesNumber != 1 {
+		t.Error("The sale order has not been generated correctly")
+		return
+	}
+
+	relations := getSalesOrderRelations(o.Id, 1)
+	if len(relations.Quotations) == 0 || relations.Quotations[0].Id != quotationId {
+		t.Error("The sales quotation is not in the sale order relations")
+		return
+	}
+
+	// a quotation can't be accepted twice
+	if acceptSalesQuotation(quotationId, 1, 1).ErrorCode != 1 {
+		t.Error("A sales quotation can be accepted twice")
+		return
+	}
+
+	// deleting the sale order sets the quotation back to pending
+	if !o.deleteSalesOrder(1).Ok {
+		t.Error("Could not delete the generated sale order")
+		return
+	}
+	quotation = getSalesQuotationRow(quotationId)
+	if quotation.Status != "_" || quotation.SaleOrderId != nil {
+		t.Error("The sales quotation has not been unlinked from the deleted sale order")
+		return
+	}
+
+	quotation.deleteSalesQuotation(1)
+}
+
+// ===== SALES RETURNS
+
+func TestGetSalesReturns(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	q := PaginationQuery{Offset: 0, Limit: MAX_INT32}
+	r := q.getSalesReturns(1)
+	for i := 0; i < len(r.Returns); i++ {
+		if r.Returns[i].Id <= 0 {
+			t.Error("Scan error, sales returns with ID 0.")
+			return
+		}
+	}
+}
+
+func TestCreateSalesReturnFromSaleOrder(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	o := SaleOrder{
+		CustomerId:        1,
+		PaymentMethodId:   3,
+		BillingSeriesId:   "EXP",
+		CurrencyId:        1,
+		BillingAddressId:  1,
+		ShippingAddressId: 1,
+		Description:       "",
+		Notes:             "",
+		EnterpriseId:      1,
+	}
+
+	_, orderId := o.insertSalesOrder(1, nil)
+
+	d := SalesOrderDetail{
+		OrderId:      orderId,
+		ProductId:    4,
+		Price:        9.99,
+		Quantity:     2,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+
+	d.insertSalesOrderDetail(0, nil)
+
+	// nothing has been delivered yet
+	okAndErr := createSalesReturnFromSaleOrder(orderId, 1, 0)
+	if okAndErr.Ok || okAndErr.ErrorCode != 1 {
+		t.Error("A return has been created from an order that is not delivered")
+		return
+	}
+
+	okAndErr, noteId := deliveryNoteAllSaleOrder(orderId, 1, 0, nil)
+	if !okAndErr.Ok {
+		t.Error("Could not delivery note all sale order")
+		return
+	}
+
+	okAndErr = createSalesReturnFromSaleOrder(orderId, 1, 0)
+	if !okAndErr.Ok {
+		t.Error("Could not create the return from the sale order")
+		return
+	}
+	returnId, _ := strconv.Atoi(okAndErr.ExtraData[0])
+
+	details := getSalesReturnDetail(int64(returnId), 1)
+	if len(details) != 1 || details[0].Quantity != 2 {
+		t.Error("The details of the return have not been created from the sale order")
+		return
+	}
+
+	// the quantity can't be greater than the delivered quantity
+	details[0].Quantity = 3
+	details[0].EnterpriseId = 1
+	okAndErr = details[0].updateSalesReturnDetail(0)
+	if okAndErr.Ok || okAndErr.ErrorCode != 2 {
+		t.Error("The return detail has been updated with a quantity greater than the delivered quantity")
+		return
+	}
+
+	// the lines must be inspected before receiving the return
+	okAndErr = receiveSalesReturn(int64(returnId), 1, 0)
+	if okAndErr.Ok || okAndErr.ErrorCode != 3 {
+		t.Error("The return has been received without inspecting the lines")
+		return
+	}
+
+	r := getSalesOrderRelations(orderId, 1)
+	if len(r.Returns) == 0 {
+		t.Error("The return has not loaded from the sale order relations")
+		return
+	}
+
+	salesReturn := SalesReturn{Id: int64(returnId), EnterpriseId: 1}
+	ok := salesReturn.deleteSalesReturn(0).Ok
+	if !ok {
+		t.Error("The return could not be deleted")
+		return
+	}
+
+	// delete created delivery note
+	note := getSalesDeliveryNoteRow(noteId)
+	note.deleteSalesDeliveryNotes(0, nil)
+
+	// delete created order
+	orderDetails := getSalesOrderDetail(orderId, 1)
+	orderDetails[0].EnterpriseId = 1
+	orderDetails[0].deleteSalesOrderDetail(1, nil)
+	o.Id = orderId
+	o.EnterpriseId = 1
+	o.deleteSalesOrder(1)
+}
+
+// ===== SALES SUBSCRIPTIONS
+
+func TestSalesSubscriptionInsertUpdateDelete(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	s := SalesSubscription{
+		Name:              "Test subscription",
+		CustomerId:        1,
+		PaymentMethodId:   3,
+		BillingSeriesId:   "EXP",
+		CurrencyId:        1,
+		BillingAddressId:  1,
+		ShippingAddressId: 1,
+		Interval:          "M",
+		IntervalCount:     1,
+		DateStart:         time.Now(),
+		EnterpriseId:      1,
+	}
+
+	ok := s.insertSalesSubscription(0)
+	if !ok {
+		t.Error("Insert error, sales subscription not inserted")
+		return
+	}
+
+	subscriptions := getSalesSubscriptions(1)
+	s = subscriptions[len(subscriptions)-1]
+
+	d := SalesSubscriptionDetail{
+		SubscriptionId: s.Id,
+		ProductId:      4,
+		Price:          9.99,
+		Quantity:       2,
+		VatPercent:     21,
+		EnterpriseId:   1,
+	}
+
+	okAndErr := d.insertSalesSubscriptionDetail(0)
+	if !okAndErr.Ok {
+		t.Error("Insert error, sales subscription detail not inserted", okAndErr.ErrorCode)
+		return
+	}
+
+	// the same product can't be added twice
+	okAndErr = d.insertSalesSubscriptionDetail(0)
+	if okAndErr.Ok || okAndErr.ErrorCode != 2 {
+		t.Error("A duplicated product has been inserted in the subscription")
+		return
+	}
+
+	s = getSalesSubscriptionRow(s.Id)
+	if s.LinesNumber != 1 {
+		t.Error("The lines number of the subscription has not been updated")
+		return
+	}
+
+	s.Interval = "W"
+	s.IntervalCount = 2
+	s.EnterpriseId = 1
+	ok = s.updateSalesSubscription(0)
+	if !ok {
+		t.Error("Update error, sales subscription not updated")
+		return
+	}
+
+	details := getSalesSubscriptionDetail(s.Id, 1)
+	if len(details) != 1 {
+		t.Error("The sales subscription details can't be loaded")
+		return
+	}
+	details[0].Quantity = 3
+	details[0].EnterpriseId = 1
+	ok = details[0].updateSalesSubscriptionDetail(0)
+	if !ok {
+		t.Error("Update error, sales subscription detail not updated")
+		return
+	}
+
+	ok = details[0].deleteSalesSubscriptionDetail(0)
+	if !ok {
+		t.Error("Delete error, sales subscription detail not deleted")
+		return
+	}
+
+	ok = s.deleteSalesSubscription(0)
+	if !ok {
+		t.Error("Delete error, sales subscription not deleted")
+		return
+	}
+}
+
+func TestRunSalesSubscription(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	s := SalesSubscription{
+		Name:              "Test subscription",
+		CustomerId:        1,
+		PaymentMethodId:   3,
+		BillingSeriesId:   "EXP",
+		CurrencyId:        1,
+		BillingAddressId:  1,
+		ShippingAddressId: 1,
+		Interval:          "M",
+		IntervalCount:     1,
+		DateStart:         time.Now(),
+		EnterpriseId:      1,
+	}
+
+	s.insertSalesSubscription(0)
+	subscriptions := getSalesSubscriptions(1)
+	s = subscriptions[len(subscriptions)-1]
+
+	d := SalesSubscriptionDetail{
+		SubscriptionId: s.Id,
+		ProductId:      4,
+		Price:          9.99,
+		Quantity:       2,
+		VatPercent:     21,
+		EnterpriseId:   1,
+	}
+	d.insertSalesSubscriptionDetail(0)
+
+	l := runSalesSubscriptionNow(s.Id, 1, 0)
+	if !l.Ok || l.SalesOrderId == nil {
+		t.Error("The sale order of the subscription has not been generated", l.ErrorMessage)
+		return
+	}
+
+	s = getSalesSubscriptionRow(s.Id)
+	if !s.NextRunDate.After(time.Now()) {
+		t.Error("The next run date of the subscription has not been moved")
+		return
+	}
+
+	logs := getSalesSubscriptionLogs(s.Id, 1)
+	if len(logs) != 1 {
+		t.Error("The run of the subscription has not been logged")
+		return
+	}
+
+	orderDetails := getSalesOrderDetail(*l.SalesOrderId, 1)
+	if len(orderDetails) != 1 || orderDetails[0].Quantity != 2 {
+		t.Error("The details of the sale order have not been generated from the subscription")
+		return
+	}
+
+	// delete created order
+	orderDetails[0].EnterpriseId = 1
+	orderDetails[0].deleteSalesOrderDetail(0, nil)
+	o := SaleOrder{Id: *l.SalesOrderId, EnterpriseId: 1}
+	o.deleteSalesOrder(0)
+
+	s.EnterpriseId = 1
+	s.deleteSalesSubscription(0)
+}
+
+// ===== CUSTOMER RISK
+
+func TestGetCustomerRisk(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	r := getCustomerRisk(1, 1)
+	if r.Exposure != r.OpenOrders+r.UnpaidInvoices+r.PendingCollectionOperations {
+		t.Error("The exposure of the customer is not the sum of the open orders, the unpaid invoices and the pending collection operations")
+		return
+	}
+}
+
+func TestSalesOrderCustomerCreditLimit(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	c := getCustomerRow(1)
+	creditLimit := c.CreditLimit
+	creditRiskAction := c.CreditRiskAction
+	c.EnterpriseId = 1
+
+	// set a credit limit lower than the current exposure
+	r := getCustomerRisk(1, 1)
+	c.CreditLimit = r.Exposure + 0.01
+	c.CreditRiskAction = "R"
+	if !c.updateCustomer(0) {
+		t.Error("Could not update the customer's credit limit")
+		return
+	}
+
+	o := SaleOrder{
+		CustomerId:        1,
+		PaymentMethodId:   3,
+		BillingSeriesId:   "EXP",
+		CurrencyId:        1,
+		BillingAddressId:  1,
+		ShippingAddressId: 1,
+		EnterpriseId:      1,
+	}
+
+	okAndErr, orderId := o.insertSalesOrder(1, nil)
+	if !okAndErr.Ok || okAndErr.ErrorCode != 0 || orderId <= 0 {
+		t.Error("The sale order has been rejected while the customer is under the credit limit")
+		return
+	}
+
+	// the new line exceeds the credit limit, the line is rejected
+	d := SalesOrderDetail{
+		OrderId:      orderId,
+		ProductId:    4,
+		Price:        9.99,
+		Quantity:     2,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+	okAndErr = d.insertSalesOrderDetail(0, nil)
+	if okAndErr.Ok || okAndErr.ErrorCode != 3 || len(getSalesOrderDetail(orderId, 1)) != 0 {
+		t.Error("The sale order line has not been rejected when exceeding the credit limit")
+		return
+	}
+
+	// the order is put on hold instead
+	c.CreditRiskAction = "H"
+	c.updateCustomer(0)
+	d.Id = 0
+	okAndErr = d.insertSalesOrderDetail(0, nil)
+	if !okAndErr.Ok || okAndErr.ErrorCode != 3 || !getSalesOrderRow(orderId).CreditHold {
+		t.Error("The sale order has not been put on hold when exceeding the credit limit")
+		return
+	}
+
+	okAndErr = invoiceAllSaleOrder(orderId, 1, 0)
+	if okAndErr.Ok || okAndErr.ErrorCode != 3 {
+		t.Error("A sale order on hold has been invoiced")
+		return
+	}
+
+	// the customer is over the limit, new orders are rejected
+	c.CreditRiskAction = "R"
+	c.updateCustomer(0)
+	o2 := o
+	o2.Id = 0
+	okAndErr, _ = o2.insertSalesOrder(1, nil)
+	if okAndErr.Ok || okAndErr.ErrorCode != 1 {
+		t.Error("The sale order has not been rejected when the customer exceeded the credit limit")
+		return
+	}
+
+	// the new orders are put on hold instead
+	c.CreditRiskAction = "H"
+	c.updateCustomer(0)
+	o2.Id = 0
+	okAndErr, orderId2 := o2.insertSalesOrder(1, nil)
+	if !okAndErr.Ok || okAndErr.ErrorCode != 1 || !getSalesOrderRow(orderId2).CreditHold {
+		t.Error("The sale order has not been put on hold when the customer exceeded the credit limit")
+		return
+	}
+
+	if !releaseCreditHoldSalesOrder(orderId, 1, 0) || getSalesOrderRow(orderId).CreditHold {
+		t.Error("Could not release the credit hold of the sale order")
+		return
+	}
+
+	// increasing the quantity of a line is checked as a new line
+	c.CreditRiskAction = "R"
+	c.updateCustomer(0)
+	orderDetails := getSalesOrderDetail(orderId, 1)
+	orderDetails[0].EnterpriseId = 1
+	orderDetails[0].Quantity++
+	okAndErr = orderDetails[0].updateSalesOrderDetail(0)
+	if okAndErr.Ok || okAndErr.ErrorCode != 5 || getSalesOrderDetailRow(orderDetails[0].Id).Quantity != 2 {
+		t.Error("The quantity of the sale order line has been increased when exceeding the credit limit")
+		return
+	}
+
+	// restore the customer
+	c.CreditLimit = creditLimit
+	c.CreditRiskAction = creditRiskAction
+	c.updateCustomer(0)
+
+	// delete created orders
+	orderDetails[0].deleteSalesOrderDetail(0, nil)
+	o.Id = orderId
+	o.deleteSalesOrder(0)
+	o2.Id = orderId2
+	o2.deleteSalesOrder(0)
+}
+
+// ===== SALES AGENTS
+
+func TestSalesAgentInsertUpdateDelete(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	a := SalesAgent{
+		Name:              "Test agent",
+		Email:             "agent@marketnet.com",
+		CommissionPercent: 5,
+		EnterpriseId:      1,
+	}
+
+	ok := a.insertSalesAgent()
+	if !ok || a.Id <= 0 {
+		t.Error("Insert error, sales agent not inserted")
+		return
+	}
+
+	a.CommissionPercent = 7.5
+	ok = a.updateSalesAgent()
+	if !ok || getSalesAgentRow(a.Id).CommissionPercent != 7.5 {
+		t.Error("Update error, sales agent not updated")
+		return
+	}
+
+	var customerId int32 = 1
+	r := SalesAgentCommissionRule{
+		SalesAgentId:      a.Id,
+		CustomerId:        &customerId,
+		Base:              "M",
+		CommissionPercent: 10,
+		EnterpriseId:      1,
+	}
+	ok = r.insertSalesAgentCommissionRule()
+	if !ok {
+		t.Error("Insert error, sales agent commission rule not inserted")
+		return
+	}
+
+	rules := getSalesAgentCommissionRules(a.Id, 1)
+	if len(rules) != 1 || rules[0].Base != "M" {
+		t.Error("Can't scan the sales agent commission rules")
+		return
+	}
+
+	// the rules are deleted with the agent
+	ok = a.deleteSalesAgent()
+	if !ok || len(getSalesAgentCommissionRules(a.Id, 1)) != 0 {
+		t.Error("Delete error, sales agent not deleted")
+		return
+	}
+}
+
+func TestGetSalesAgentCommission(t *testing.T) {
+	var customerId int32 = 1
+	var otherCustomerId int32 = 2
+	var familyId int32 = 1
+
+	a := SalesAgent{Id: 1, CommissionPercent: 5}
+	rules := []SalesAgentCommissionRule{
+		{Id: 1, ProductFamilyId: &familyId, Base: "S", CommissionPercent: 6},
+		{Id: 2, CustomerId: &customerId, Base: "S", CommissionPercent: 7},
+		{Id: 3, CustomerId: &customerId, ProductFamilyId: &familyId, Base: "M", CommissionPercent: 8},
+	}
+
+	base, percent := getSalesAgentCommission(a, rules, customerId, &familyId)
+	if base != "M" || percent != 8 {
+		t.Error("The rule for the customer and the product family has not been applied")
+		return
+	}
+	base, percent = getSalesAgentCommission(a, rules, customerId, nil)
+	if base != "S" || percent != 7 {
+		t.Error("The rule for the customer has not been applied")
+		return
+	}
+	base, percent = getSalesAgentCommission(a, rules, otherCustomerId, &familyId)
+	if base != "S" || percent != 6 {
+		t.Error("The rule for the product family has not been applied")
+		return
+	}
+	base, percent = getSalesAgentCommission(a, rules, otherCustomerId, nil)
+	if base != "S" || percent != 5 {
+		t.Error("The default commission of the agent has not been applied")
+		return
+	}
+}
+
+func TestSettleSalesAgentCommissions(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	a := SalesAgent{
+		Name:              "Test agent",
+		CommissionPercent: 10,
+		EnterpriseId:      1,
+	}
+	if !a.insertSalesAgent() {
+		t.Error("Insert error, sales agent not inserted")
+		return
+	}
+
+	var product int32 = 4
+	i := SalesInvoice{
+		CustomerId:       1,
+		PaymentMethodId:  1,
+		BillingSeriesId:  "INT",
+		CurrencyId:       1,
+		BillingAddressId: 1,
+		SalesAgentId:     &a.Id,
+		EnterpriseId:     1,
+	}
+	_, invoiceId := i.insertSalesInvoice(0, nil)
+
+	d := SalesInvoiceDetail{
+		InvoiceId:    invoiceId,
+		ProductId:    &product,
+		Price:        10,
+		Quantity:     2,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+	d.insertSalesInvoiceDetail(nil, 0)
+
+	q := SalesAgentCommissionQuery{
+		SalesAgentId: a.Id,
+		DateStart:    time.Now().AddDate(0, 0, -1),
+		DateEnd:      time.Now().AddDate(0, 0, 1),
+	}
+	commissions := q.getSalesAgentCommissions(1)
+	if len(commissions.Lines) != 1 || commissions.InvoicedAmount != 20 || commissions.Commission != 2 {
+		t.Error("The commissions of the sales agent are not calculated correctly")
+		return
+	}
+
+	okAndErr := q.settleSalesAgentCommissions(1, 0)
+	if !okAndErr.Ok {
+		t.Error("Could not settle the commissions of the sales agent")
+		return
+	}
+	settlementId, _ := strconv.Atoi(okAndErr.ExtraData[0])
+
+	// the invoice can't be settled twice
+	if len(q.getSalesAgentCommissions(1).Lines) != 0 {
+		t.Error("The settled invoices are pending of settlement")
+		return
+	}
+	okAndErr = q.settleSalesAgentCommissions(1, 0)
+	if okAndErr.Ok || okAndErr.ErrorCode != 1 {
+		t.Error("The invoices have been settled twice")
+		return
+	}
+	if getSalesAgentSettlementCommissions(int64(settlementId), 1).Commission != 2 {
+		t.Error("The commissions of the settlement are not correct")
+		return
+	}
+
+	okAndErr = deleteSalesAgentSettlement(int64(settlementId), 1, 0)
+	if !okAndErr.Ok || getSalesInvoiceRow(invoiceId).SalesAgentSettlementId != nil {
+		t.Error("Delete error, sales agent settlement not deleted")
+		return
+	}
+
+	// delete created invoice and agent
+	details := getSalesInvoiceDetail(invoiceId, 1)
+	details[0].deleteSalesInvoiceDetail(0, nil)
+	i.Id = invoiceId
+	i.deleteSalesInvoice(0)
+	a.deleteSalesAgent()
+}
+
+func TestSalesAgentCommissionsDiscountedInvoice(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	a := SalesAgent{
+		Name:              "Test agent",
+		CommissionPercent: 10,
+		EnterpriseId:      1,
+	}
+	if !a.insertSalesAgent() {
+		t.Error("Insert error, sales agent not inserted")
+		return
+	}
+
+	var product int32 = 4
+	i := SalesInvoice{
+		CustomerId:       1,
+		PaymentMethodId:  1,
+		BillingSeriesId:  "INT",
+		CurrencyId:       1,
+		BillingAddressId: 1,
+		DiscountPercent:  10,
+		FixDiscount:      2,
+		ShippingPrice:    5,
+		SalesAgentId:     &a.Id,
+		EnterpriseId:     1,
+	}
+	_, invoiceId := i.insertSalesInvoice(0, nil)
+
+	d := SalesInvoiceDetail{
+		InvoiceId:    invoiceId,
+		ProductId:    &product,
+		Price:        10,
+		Quantity:     2,
+		VatPercent:   21,
+		EnterpriseId: 1,
+	}
+	d.insertSalesInvoiceDetail(nil, 0)
+
+	// 20 - 10% - 2, the shipping has no commission
+	commissions := calcSalesAgentCommissions(a, []SalesInvoice{getSalesInvoiceRow(invoiceId)}, 1)
+	if len(commissions.Lines) != 1 || math.Abs(commissions.InvoicedAmount-16) > 0.000001 || math.Abs(commissions.Commission-1.6) > 0.000001 {
+		t.Error("The discounts of the invoice are not applied to the commissions of the sales agent")
+		return
+	}
+
+	// delete created invoice and agent
+	details := getSalesInvoiceDetail(invoiceId, 1)
+	details[0].deleteSalesInvoiceDetail(0, nil)
+	i.Id = invoiceId
+	i.deleteSalesInvoice(0)
+	a.deleteSalesAgent()
+}
+
+func TestGetSalesInvoiceProductsDiscountFactor(t *testing.T) {
+	i := SalesInvoice{TotalProducts: 200, DiscountPercent: 10, FixDiscount: 20, ShippingPrice: 5, ShippingDiscount: 5}
+	if getSalesInvoiceProductsDiscountFactor(i) != 0.8 {
+		t.Error("The discounts of the invoice are not spread correctly")
+		return
+	}
+	if getSalesInvoiceProductsDiscountFactor(SalesInvoice{}) != 1 {
+		t.Error("An invoice without products has a discount")
+		return
+	}
+}
+
+// ===== FACTURAE
+
+func TestSalesInvoiceFacturae(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	q := PaginationQuery{Offset: 0, Limit: 1, enterprise: 1}
+	invoices := q.getSalesInvoices()
+	if len(invoices.Invoices) == 0 {
+		return
+	}
+	invoice := invoices.Invoices[0]
+
+	// the enterprise needs the tax data to issue the invoices
+	settingsInDisk := getSettingsRecordById(1)
+	dbOrm.Model(&Settings{}).Where("id = ?", 1).Updates(map[string]interface{}{
+		"enterprise_tax_id":    "",
+		"facturae_certificate": "",
+	})
+	_, result := generateSalesInvoiceFacturae(invoice.Id, 1)
+	if result.Ok || result.ErrorCode != 1 {
+		t.Error("A Facturae invoice has been generated without the tax data of the enterprise")
+		return
+	}
+
+	address := getAddressRow(invoice.BillingAddressId)
+	dbOrm.Model(&Settings{}).Where("id = ?", 1).Updates(map[string]interface{}{
+		"enterprise_tax_id":  "B12345674",
+		"enterprise_country": address.CountryId,
+	})
+	document, result := generateSalesInvoiceFacturae(invoice.Id, 1)
+	dbOrm.Model(&Settings{}).Where("id = ?", 1).Updates(map[string]interface{}{
+		"enterprise_tax_id":    settingsInDisk.EnterpriseTaxId,
+		"enterprise_country":   settingsInDisk.EnterpriseCountryId,
+		"facturae_certificate": settingsInDisk.FacturaeCertificate,
+	})
+	if !result.Ok && result.ErrorCode == 2 {
+		return // the customer of the invoice has no tax ID
+	}
+	if !result.Ok {
+		t.Error("Can't generate the Facturae invoice", result.ErrorCode)
+		return
+	}
+
+	var facturae struct {
+		FileHeader FacturaeFileHeader `xml:"FileHeader"`
+		Invoices   FacturaeInvoices   `xml:"Invoices"`
+	}
+	err := xml.Unmarshal(document, &facturae)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if facturae.FileHeader.SchemaVersion != "3.2.2" || len(facturae.Invoices.Invoice) != 1 || facturae.Invoices.Invoice[0].InvoiceHeader.InvoiceNumber != strings.TrimSpace(invoice.InvoiceName) {
+		t.Error("The Facturae invoice is not correct")
+		return
+	}
+	if (facturae.Invoices.Invoice[0].InvoiceHeader.InvoiceClass == "OR") != invoice.Amending {
+		t.Error("The class of the Facturae invoice is not correct")
+		return
+	}
+}
+
+func TestSignFacturae(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "MARKETNET & Co"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+	}
+	certData, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	cert, _ := x509.ParseCertificate(certData)
+
+	document := canonicalFacturaeText(`<FileHeader><SchemaVersion>3.2.2</SchemaVersion></FileHeader><Parties><SellerParty><LegalEntity><CorporateName>"O'Brien" &amp; Co</CorporateName></LegalEntity></SellerParty></Parties>`)
+	signedDocument, err := signFacturae(document, cert, key, time.Now())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the document is well formed
+	var facturae struct {
+		Parties FacturaeParties `xml:"Parties"`
+	}
+	err = xml.Unmarshal([]byte(signedDocument), &facturae)
+	if err != nil || facturae.Parties.SellerParty.LegalEntity.CorporateName != `"O'Brien" & Co` {
+		t.Error("The signed document is not correct", err)
+		return
+	}
+
+	// the digest of the document is calculated without the signature
+	signature := signedDocument[strings.Index(signedDocument, "<ds:Signature ") : strings.Index(signedDocument, "</ds:Signature>")+len("</ds:Signature>")]
+	documentDigest := sha256.Sum256([]byte(strings.Replace(signedDocument, signature, "", 1)))
+	if !strings.Contains(signature, "<ds:DigestValue>"+base64.StdEncoding.EncodeToString(documentDigest[:])+"</ds:DigestValue>") {
+		t.Error("The digest of the document is not correct")
+		return
+	}
+
+	// the signature value is calculated over the canonical form of the SignedInfo element
+	signedInfo := signature[strings.Index(signature, "<ds:SignedInfo") : strings.Index(signature, "</ds:SignedInfo>")+len("</ds:SignedInfo>")]
+	signedInfo = strings.Replace(signedInfo, "<ds:SignedInfo", "<ds:SignedInfo"+FACTURAE_NAMESPACE_DECLARATIONS, 1)
+	signedInfoDigest := sha256.Sum256([]byte(signedInfo))
+	signatureValue := signature[strings.Index(signature, "<ds:SignatureValue>")+len("<ds:SignatureValue>") : strings.Index(signature, "</ds:SignatureValue>")]
+	signatureData, _ := base64.StdEncoding.DecodeString(signatureValue)
+	err = rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, signedInfoDigest[:], signatureData)
+	if err != nil {
+		t.Error("The signature is not valid", err)
+		return
+	}
+}
+
+// ===== UBL
+
+func TestSalesInvoiceUBL(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	q := PaginationQuery{Offset: 0, Limit: 1, enterprise: 1}
+	invoices := q.getSalesInvoices()
+	if len(invoices.Invoices) == 0 {
+		return
+	}
+	invoice := invoices.Invoices[0]
+
+	settingsInDisk := getSettingsRecordById(1)
+	address := getAddressRow(invoice.BillingAddressId)
+	dbOrm.Model(&Settings{}).Where("id = ?", 1).Updates(map[string]interface{}{
+		"enterprise_tax_id":  "B12345674",
+		"enterprise_country": address.CountryId,
+	})
+	document, result := generateSalesInvoiceUBL(invoice.Id, 1)
+	dbOrm.Model(&Settings{}).Where("id = ?", 1).Updates(map[string]interface{}{
+		"enterprise_tax_id":  settingsInDisk.EnterpriseTaxId,
+		"enterprise_country": settingsInDisk.EnterpriseCountryId,
+	})
+	if !result.Ok && result.ErrorCode == 2 {
+		return // the invoice has no details
+	}
+	if !result.Ok {
+		t.Error("Can't generate the UBL invoice", result.ErrorCode)
+		return
+	}
+
+	var ubl UBLImportDocument
+	err := xml.Unmarshal(document, &ubl)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if ubl.ID != strings.TrimSpace(invoice.InvoiceName) || (ubl.XMLName.Local == "CreditNote") != invoice.Amending {
+		t.Error("The UBL invoice is not correct")
+		return
+	}
+	details := getSalesInvoiceDetail(invoice.Id, 1)
+	if len(ubl.InvoiceLine)+len(ubl.CreditNoteLine) != len(details) {
+		t.Error("The lines of the UBL invoice are not correct")
+		return
+	}
+	if math.Abs(math.Abs(ubl.PayableAmount)-math.Abs(invoice.TotalAmount)) > 0.05 {
+		t.Error("The total of the UBL invoice doesn't match the invoice", ubl.PayableAmount, invoice.TotalAmount)
+		return
+	}
+}
+
+func TestEN16931TaxCategory(t *testing.T) {
+	if en16931TaxCategory(21, "N").Code != "S" || en16931TaxCategory(0, "N").Code != "Z" || en16931TaxCategory(0, "U").Code != "K" || en16931TaxCategory(0, "E").Code != "G" {
+		t.Error("The tax categories are not correct")
+		return
+	}
+	if en16931VatNumber("b 12345674", "ES") != "ESB12345674" || en16931VatNumber("ESB12345674", "ES") != "ESB12345674" || en16931VatNumber("123456789", "GR") != "EL123456789" {
+		t.Error("The VAT numbers are not correct")
+		return
+	}
+}
+
+// ===== FACTUR-X
+
+func TestSalesInvoiceFacturX(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	q := PaginationQuery{Offset: 0, Limit: 1, enterprise: 1}
+	invoices := q.getSalesInvoices()
+	if len(invoices.Invoices) == 0 {
+		return
+	}
+	invoice := invoices.Invoices[0]
+
+	settingsInDisk := getSettingsRecordById(1)
+	address := getAddressRow(invoice.BillingAddressId)
+	dbOrm.Model(&Settings{}).Where("id = ?", 1).Updates(map[string]interface{}{
+		"enterprise_tax_id":  "B12345674",
+		"enterprise_country": address.CountryId,
+	})
+	document, result := generateSalesInvoiceCII(invoice.Id, 1)
+	pdf, pdfResult := generateSalesInvoiceFacturX(invoice.Id, 1)
+	dbOrm.Model(&Settings{}).Where("id = ?", 1).Updates(map[string]interface{}{
+		"enterprise_tax_id":  settingsInDisk.EnterpriseTaxId,
+		"enterprise_country": settingsInDisk.EnterpriseCountryId,
+	})
+	if !result.Ok && result.ErrorCode == 2 {
+		return // the invoice has no details
+	}
+	if !result.Ok || (!pdfResult.Ok && pdfResult.ErrorCode != 3) {
+		t.Error("Can't generate the Factur-X invoice", result.ErrorCode, pdfResult.ErrorCode)
+		return
+	}
+
+	var cii struct {
+		ID        string `xml:"ExchangedDocument>ID"`
+		TypeCode  string `xml:"ExchangedDocument>TypeCode"`
+		LineItems []struct {
+			LineID string `xml:"AssociatedDocumentLineDocument>LineID"`
+		} `xml:"SupplyChainTradeTransaction>IncludedSupplyChainTradeLineItem"`
+		GrandTotalAmount float64 `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeSettlement>SpecifiedTradeSettlementHeaderMonetarySummation>GrandTotalAmount"`
+	}
+	err := xml.Unmarshal(document, &cii)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if cii.ID != strings.TrimSpace(invoice.InvoiceName) || (cii.TypeCode == "381") != invoice.Amending || len(cii.LineItems) != len(getSalesInvoiceDetail(invoice.Id, 1)) {
+		t.Error("The CII invoice is not correct")
+		return
+	}
+	if math.Abs(math.Abs(cii.GrandTotalAmount)-math.Abs(invoice.TotalAmount)) > 0.05 {
+		t.Error("The total of the CII invoice doesn't match the invoice", cii.GrandTotalAmount, invoice.TotalAmount)
+		return
+	}
+
+	// without a font to embed, the document can't be PDF/A-3
+	if !pdfResult.Ok {
+		if newPDFDocument("").isFontEmbedded() || pdf != nil {
+			t.Error("The Factur-X PDF has not been generated with an embedded font")
+		}
+		return
+	}
+	if !strings.HasPrefix(string(pdf), "%PDF-") || !strings.Contains(string(pdf), "/AFRelationship /Data") || !strings.Contains(string(pdf), "<fx:DocumentFileName>factur-x.xml</fx:DocumentFileName>") {
+		t.Error("The Factur-X PDF is not correct")
+		return
+	}
+}
+
+func TestPDFDocument(t *testing.T) {
+	pdf := newPDFDocument("Test (1) ñ")
+	page := pdf.addPage()
+	page.text(50, 800, 10, "Left (text) \\ €")
+	page.textRight(545, 800, 10, "Right")
+	page.line(50, 790, 545, 790)
+	pdf.addPage().textCut(50, 800, 10, 20, "This text is cut")
+	pdf.attachFile(PDFAttachment{FileName: "test.xml", Description: "Test", MimeType: "text/xml", Relationship: "Data", Content: []byte("<test/>"), DateModified: pdf.DateCreated})
+	document := string(pdf.output())
+
+	if pdf.textWidth("ab", 10) != pdf.textWidth("a", 10)+pdf.textWidth("b", 10) || pdf.textWidth("a", 20) != pdf.textWidth("a", 10)*2 {
+		t.Error("The width of the text is not correct")
+		return
+	}
+
+	// the cross-reference table must point to the objects
+	startxref := strings.LastIndex(document, "startxref\n")
+	if startxref < 0 {
+		t.Error("The PDF document has no cross-reference table")
+		return
+	}
+	xrefOffset, err := strconv.Atoi(strings.Split(document[startxref+len("startxref\n"):], "\n")[0])
+	if err != nil || !strings.HasPrefix(document[xrefOffset:], "xref\n") {
+		t.Error("The offset of the cross-reference table is not correct")
+		return
+	}
+	xref := strings.Split(document[xrefOffset:], "\n")
+	objects, _ := strconv.Atoi(strings.Split(xref[1], " ")[1])
+	if objects < 2 {
+		t.Error("The cross-reference table has no objects")
+		return
+	}
+	for i := 1; i < objects; i++ {
+		offset, err := strconv.Atoi(xref[2+i][:10])
+		if err != nil || !strings.HasPrefix(document[offset:], strconv.Itoa(i)+" 0 obj\n") {
+			t.Error("The offset of the object is not correct", i)
+			return
+		}
+	}
+
+	if !strings.Contains(document, "/Count 2") || !strings.Contains(document, "/EmbeddedFiles") {
+		t.Error("The PDF document is not correct")
+		return
+	}
+	// the document is only identified as PDF/A when the font is embedded
+	if strings.Contains(document, "<pdfaid:part>3</pdfaid:part>") != pdf.isFontEmbedded() {
+		t.Error("The PDF/A identification doesn't match the font of the document")
+		return
+	}
+	if string(pdfWinAnsiText("a€ñ✓")) != "a\x80\xf1?" || pdfEscapeString([]byte("(a)\\")) != "\\(a\\)\\\\" {
+		t.Error("The text is not encoded correctly")
+		return
+	}
+}
+
+// ===== EDI
+
+/* FUNCTIONALITY */
+
+func TestParseEdifact(t *testing.T) {
+	content := "UNA:+.? 'UNB+UNOC:3+5412345000013:14+5498765000019:14+240115:1030+77'\r\n" +
+		"UNH+1+ORDERS:D:96A:UN:EAN008'BGM+220+PO?+123+9'DTM+137:20240115:102'DTM+2:20240120:102'" +
+		"NAD+BY+5412345000013::9'NAD+DP+5412345000020::9'CUX+2:EUR:9'" +
+		"LIN+1++8412345678905:EN'QTY+21:24'PRI+AAA:12.5'" +
+		"LIN+2++8412345678912:EN'QTY+21:6'" +
+		"UNS+S'UNT+13+1'UNZ+1+77'"
+
+	segments, err := parseEdifact(content)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(segments) != 16 || segments[0].Tag != "UNB" || segments[0].value(4, 0) != "77" {
+		t.Error("The interchange has not been parsed correctly", segments)
+		return
+	}
+	if segments[2].value(1, 0) != "PO+123" {
+		t.Error("The release character has not been applied", segments[2])
+		return
+	}
+
+	messages := splitEdifactMessages(segments)
+	if len(messages) != 1 || len(messages[0]) != 14 {
+		t.Error("The messages have not been split correctly", messages)
+		return
+	}
+
+	order, err := parseEdiOrder(messages[0])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if order.DocumentNumber != "PO+123" || order.BuyerGln != "5412345000013" || order.DeliveryGln != "5412345000020" || order.Currency != "EUR" || order.DeliveryDate == nil || order.DeliveryDate.Day() != 20 {
+		t.Error("The order header has not been read correctly", order)
+		return
+	}
+	if len(order.Lines) != 2 || order.Lines[0].Ean != "8412345678905" || order.Lines[0].Quantity != 24 || order.Lines[0].Price == nil || *order.Lines[0].Price != 12.5 || order.Lines[1].Quantity != 6 || order.Lines[1].Price != nil {
+		t.Error("The order lines have not been read correctly", order.Lines)
+		return
+	}
+
+	// errors
+	if _, err := parseEdifact("UNH+1+ORDERS:D:96A:UN'BGM+220+1"); err == nil {
+		t.Error("A segment without terminator has been accepted")
+		return
+	}
+	segments, _ = parseEdifact("UNH+1+ORDERS:D:96A:UN'BGM+220+1+9'NAD+BY+5412345000013::9'LIN+1++8412345678905:EN'QTY+21:1.5'UNT+6+1'")
+	if _, err := parseEdiOrder(segments); err == nil {
+		t.Error("A decimal quantity has been accepted")
+		return
+	}
+	segments, _ = parseEdifact("UNH+1+ORDERS:D:01B:UN'BGM+220+1+9'UNT+3+1'")
+	if _, err := parseEdiOrder(segments); err == nil {
+		t.Error("An unsupported version has been accepted")
+		return
+	}
+}
+
+func TestEdifactWriter(t *testing.T) {
+	date := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	w := newEdifactInterchange("5498765000019", "5412345000013", "5", date)
+	w.beginMessage("5", EDI_MESSAGE_INVOIC, "EAN008")
+	w.add("BGM", "380", edifactElement("INT/2024/000001"), "9")
+	w.add("IMD", "F", "", edifactElement("", "", "", "Screws 3:1 + nuts"))
+	w.add("NAD", "SU", edifactElement("5498765000019", "", "9"))
+	w.endMessage("5")
+
+	expected := "UNA:+.? 'UNB+UNOC:3+5498765000019:14+5412345000013:14+240115:1030+5'UNH+5+INVOIC:D:96A:UN:EAN008'BGM+380+INT/2024/000001+9'" +
+		"IMD+F++:::Screws 3?:1 ?+ nuts'NAD+SU+5498765000019::9'UNT+5+5'UNZ+1+5'"
+	if w.String("5") != expected {
+		t.Error("The interchange is not correct", w.String("5"))
+		return
+	}
+
+	// the output can be read back
+	segments, err := parseEdifact(w.String("5"))
+	if err != nil || len(segments) != 7 || segments[3].value(2, 3) != "Screws 3:1 + nuts" {
+		t.Error("The interchange generated can't be parsed", err, segments)
+		return
+	}
+}
+
+func TestGlnIsValid(t *testing.T) {
+	if !glnIsValid("") || !glnIsValid("5412345000013") || glnIsValid("5412345000014") || glnIsValid("541234500001") {
+		t.Error("The GLN is not validated correctly")
+		return
+	}
+}
@@ -152,7 +152,7 @@ func (s *Shipping) generateSendCloudParcel(enterpriseId int32) (bool, *Parcel) {
 
 		pi := ParcelItem{}
 		pi.Description = details[i].Product.Name
-		pi.Quantity = details[i].Quantity
+		pi.Quantity = int32(math.Ceil(details[i].Quantity))
 		pi.Weight = toFixed(math.Max(product.Weight*float64(details[i].Quantity), SENDCLOUD_MIN_WEIGHT_PARCEL_ITEMS), 3)
 		weight += pi.Weight
 		pi.Value = toFixed(details[i].TotalAmount, 2)
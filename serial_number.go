@@ -0,0 +1,541 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A unit of a product with serial number tracking.
+// The warehouse movements of the serial are stored in WarehouseMovementSerial, which is the history of the unit.
+type ProductSerial struct {
+	Id                                int64                            `json:"id" gorm:"index:product_serial_id_enterprise,unique:true,priority:1"`
+	ProductId                         int32                            `json:"productId" gorm:"column:product;not null:true;index:product_serial_number,unique:true,priority:2"`
+	Product                           Product                          `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	SerialNumber                      string                           `json:"serialNumber" gorm:"column:serial_number;type:character varying(100);not null:true;index:product_serial_number,unique:true,priority:3;index:product_serial_serial_number"`
+	InStock                           bool                             `json:"inStock" gorm:"column:in_stock;not null:true"`
+	WarehouseId                       *string                          `json:"warehouseId" gorm:"column:warehouse;type:character(2)"` // Warehouse where the unit is, if it's in stock
+	Warehouse                         *Warehouse                       `json:"-" gorm:"foreignKey:WarehouseId,EnterpriseId;references:Id,EnterpriseId"`
+	DateCreated                       time.Time                        `json:"dateCreated" gorm:"column:date_created;type:timestamp(3) with time zone;not null:true"`
+	ManufacturingOrderId              *int64                           `json:"manufacturingOrderId" gorm:"column:manufacturing_order"` // Manufacturing order that makes the unit
+	ManufacturingOrder                *ManufacturingOrder              `json:"-" gorm:"foreignKey:ManufacturingOrderId,EnterpriseId;references:Id,EnterpriseId"`
+	SalesOrderDetailId                *int64                           `json:"salesOrderDetailId" gorm:"column:sales_order_detail"` // Assigned in packaging, the unit leaves the warehouse in the delivery note of this detail
+	SalesOrderDetail                  *SalesOrderDetail                `json:"-" gorm:"foreignKey:SalesOrderDetailId,EnterpriseId;references:Id,EnterpriseId"`
+	PackagingId                       *int64                           `json:"packagingId" gorm:"column:packaging"`
+	Packaging                         *Packaging                       `json:"-" gorm:"foreignKey:PackagingId,EnterpriseId;references:Id,EnterpriseId"`
+	TransferBetweenWarehousesDetailId *int64                           `json:"transferBetweenWarehousesDetailId" gorm:"column:transfer_between_warehouses_detail"` // Assigned when scanning a transfer between warehouses
+	TransferBetweenWarehousesDetail   *TransferBetweenWarehousesDetail `json:"-" gorm:"foreignKey:TransferBetweenWarehousesDetailId,EnterpriseId;references:Id,EnterpriseId"`
+	SalesReturnDetailId               *int64                           `json:"salesReturnDetailId" gorm:"column:sales_return_detail"` // Assigned in a sales return, the unit enters the warehouse when the return is received
+	SalesReturnDetail                 *SalesReturnDetail               `json:"-" gorm:"foreignKey:SalesReturnDetailId,EnterpriseId;references:Id,EnterpriseId"`
+	EnterpriseId                      int32                            `json:"-" gorm:"column:enterprise;not null:true;index:product_serial_id_enterprise,unique:true,priority:2;index:product_serial_number,unique:true,priority:1"`
+	Enterprise                        Settings                         `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (s *ProductSerial) TableName() string {
+	return "product_serial"
+}
+
+func (s *ProductSerial) BeforeCreate(tx *gorm.DB) (err error) {
+	var productSerial ProductSerial
+	tx.Model(&ProductSerial{}).Last(&productSerial)
+	s.Id = productSerial.Id + 1
+	return nil
+}
+
+type ProductSerialQuery struct {
+	ProductId int32 `json:"productId"`
+	InStock   bool  `json:"inStock"` // Only the units in stock
+}
+
+func (q *ProductSerialQuery) getProductSerials(enterpriseId int32) []ProductSerial {
+	var serials []ProductSerial = make([]ProductSerial, 0)
+	cursor := dbOrm.Model(&ProductSerial{}).Where("product = ? AND enterprise = ?", q.ProductId, enterpriseId)
+	if q.InStock {
+		cursor = cursor.Where("in_stock")
+	}
+	result := cursor.Order("serial_number ASC").Find(&serials)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return serials
+}
+
+// Returns the serial numbers that are not empty, without spaces at the start and the end, and without repetitions.
+func cleanSerialNumbers(serialNumbers []string) []string {
+	clean := make([]string, 0)
+	found := make(map[string]bool)
+	for i := 0; i < len(serialNumbers); i++ {
+		serialNumber := strings.TrimSpace(serialNumbers[i])
+		if len(serialNumber) == 0 || found[serialNumber] {
+			continue
+		}
+		found[serialNumber] = true
+		clean = append(clean, serialNumber)
+	}
+	return clean
+}
+
+// Serial numbers for the output of a manufacturing order when they are not specified: the order number and the number of the unit.
+func generateManufacturingSerialNumbers(orderId int64, quantity int32) []string {
+	serialNumbers := make([]string, 0)
+	for i := int32(1); i <= quantity; i++ {
+		serialNumbers = append(serialNumbers, strconv.Itoa(int(orderId))+"-"+strconv.Itoa(int(i)))
+	}
+	return serialNumbers
+}
+
+// Which units of a product were in a warehouse movement
+type WarehouseMovementSerial struct {
+	WarehouseMovementId int64             `json:"warehouseMovementId" gorm:"primaryKey;column:warehouse_movement;not null:true"`
+	WarehouseMovement   WarehouseMovement `json:"-" gorm:"foreignKey:WarehouseMovementId,EnterpriseId;references:Id,EnterpriseId"`
+	SerialId            int64             `json:"serialId" gorm:"primaryKey;column:serial;not null:true;index:warehouse_movement_serial_serial"`
+	Serial              ProductSerial     `json:"serial" gorm:"foreignKey:SerialId,EnterpriseId;references:Id,EnterpriseId"`
+	EnterpriseId        int32             `json:"-" gorm:"primaryKey;column:enterprise;not null:true"`
+	Enterprise          Settings          `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (w *WarehouseMovementSerial) TableName() string {
+	return "warehouse_movement_serial"
+}
+
+func getWarehouseMovementSerials(warehouseMovementId int64, enterpriseId int32) []ProductSerial {
+	var serials []ProductSerial = make([]ProductSerial, 0)
+	result := dbOrm.Model(&ProductSerial{}).Where("id IN (SELECT serial FROM warehouse_movement_serial WHERE warehouse_movement = ? AND enterprise = ?)", warehouseMovementId, enterpriseId).Order("serial_number ASC").Find(&serials)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return serials
+}
+
+// Records the units of a new warehouse movement of a product with serial number tracking, and updates where the units are.
+// The inputs create the serials that don't exist yet, the outputs can only take units in stock in the warehouse of the movement.
+// If the serials of an output are not specified, the units assigned to the sales order detail in packaging leave the warehouse.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func allocateWarehouseMovementSerials(m *WarehouseMovement, trans gorm.DB) bool {
+	if m.Type == "R" {
+		return true
+	}
+
+	var trackSerials bool
+	result := trans.Model(&Product{}).Where("id = ?", m.ProductId).Pluck("track_serials", &trackSerials)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	if !trackSerials {
+		return true
+	}
+
+	m.SerialNumbers = cleanSerialNumbers(m.SerialNumbers)
+	inbound := m.Type == "I"
+	if !inbound && len(m.SerialNumbers) == 0 && m.SalesOrderDetailId != nil {
+		result = trans.Model(&ProductSerial{}).Where("sales_order_detail = ? AND in_stock AND warehouse = ? AND enterprise = ?", m.SalesOrderDetailId, m.WarehouseId, m.EnterpriseId).Order("serial_number ASC").Limit(int(absf(m.Quantity))).Pluck("serial_number", &m.SerialNumbers)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+	}
+	if len(m.SerialNumbers) > int(absf(m.Quantity)) {
+		trans.Rollback()
+		return false
+	}
+	for i := 0; i < len(m.SerialNumbers); i++ {
+		if len(m.SerialNumbers[i]) > 100 {
+			trans.Rollback()
+			return false
+		}
+	}
+
+	for i := 0; i < len(m.SerialNumbers); i++ {
+		var serials []ProductSerial
+		result = trans.Model(&ProductSerial{}).Where("product = ? AND serial_number = ? AND enterprise = ?", m.ProductId, m.SerialNumbers[i], m.EnterpriseId).Limit(1).Find(&serials)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+
+		var serial ProductSerial
+		if len(serials) > 0 {
+			serial = serials[0]
+		} else if inbound {
+			serial = ProductSerial{
+				ProductId:    m.ProductId,
+				SerialNumber: m.SerialNumbers[i],
+				DateCreated:  time.Now(),
+				EnterpriseId: m.EnterpriseId,
+			}
+			result = trans.Create(&serial)
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				trans.Rollback()
+				return false
+			}
+		} else { // a unit that has never entered the warehouse can't leave
+			trans.Rollback()
+			return false
+		}
+
+		var updates map[string]interface{}
+		if inbound {
+			if serial.InStock { // the unit is already in stock
+				trans.Rollback()
+				return false
+			}
+			updates = map[string]interface{}{
+				"in_stock":                           true,
+				"warehouse":                          m.WarehouseId,
+				"sales_order_detail":                 nil,
+				"packaging":                          nil,
+				"transfer_between_warehouses_detail": nil,
+			}
+		} else {
+			if !serial.InStock || serial.WarehouseId == nil || *serial.WarehouseId != m.WarehouseId {
+				trans.Rollback()
+				return false
+			}
+			updates = map[string]interface{}{
+				"in_stock":                           false,
+				"warehouse":                          nil,
+				"transfer_between_warehouses_detail": nil,
+				"sales_return_detail":                nil,
+			}
+		}
+		result = trans.Model(&ProductSerial{}).Where("id = ?", serial.Id).Updates(updates)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+
+		result = trans.Create(&WarehouseMovementSerial{
+			WarehouseMovementId: m.Id,
+			SerialId:            serial.Id,
+			EnterpriseId:        m.EnterpriseId,
+		})
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+	}
+	return true
+}
+
+// Undoes the serials of a warehouse movement that is being deleted, the units go back to where they were before the movement.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func deallocateWarehouseMovementSerials(m *WarehouseMovement, trans gorm.DB) bool {
+	var serialIds []int64
+	result := trans.Model(&WarehouseMovementSerial{}).Where("warehouse_movement = ? AND enterprise = ?", m.Id, m.EnterpriseId).Pluck("serial", &serialIds)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	if len(serialIds) == 0 {
+		return true
+	}
+
+	result = trans.Where("warehouse_movement = ? AND enterprise = ?", m.Id, m.EnterpriseId).Delete(&WarehouseMovementSerial{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	var updates map[string]interface{}
+	if m.Type == "I" {
+		updates = map[string]interface{}{"in_stock": false, "warehouse": nil}
+	} else {
+		updates = map[string]interface{}{"in_stock": true, "warehouse": m.WarehouseId}
+	}
+	result = trans.Model(&ProductSerial{}).Where("id IN ?", serialIds).Updates(updates)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
+// Assigns units in stock in the warehouse to a document that will make them leave the warehouse.
+// The column is the document that the units are assigned to (sales_order_detail or transfer_between_warehouses_detail).
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func assignSerialNumbers(productId int32, warehouseId string, serialNumbers []string, updates map[string]interface{}, column string, enterpriseId int32, trans gorm.DB) bool {
+	for i := 0; i < len(serialNumbers); i++ {
+		var serials []ProductSerial
+		result := trans.Model(&ProductSerial{}).Where("product = ? AND serial_number = ? AND enterprise = ?", productId, serialNumbers[i], enterpriseId).Limit(1).Find(&serials)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+		// the unit must be in stock in this warehouse, and not assigned to another document
+		if len(serials) == 0 || !serials[0].InStock || serials[0].WarehouseId == nil || *serials[0].WarehouseId != warehouseId || (column == "sales_order_detail" && serials[0].SalesOrderDetailId != nil) || (column == "transfer_between_warehouses_detail" && serials[0].TransferBetweenWarehousesDetailId != nil) {
+			trans.Rollback()
+			return false
+		}
+
+		result = trans.Model(&ProductSerial{}).Where("id = ?", serials[0].Id).Updates(updates)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return false
+		}
+	}
+	return true
+}
+
+func getSerialNumbersAssigned(column string, id int64, enterpriseId int32, trans *gorm.DB) []string {
+	if trans == nil {
+		trans = dbOrm
+	}
+	var serialNumbers []string = make([]string, 0)
+	result := trans.Model(&ProductSerial{}).Where(column+" = ? AND enterprise = ?", id, enterpriseId).Order("serial_number ASC").Pluck("serial_number", &serialNumbers)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return serialNumbers
+}
+
+type ManufacturingOrderSerialNumbers struct {
+	ManufacturingOrderId int64    `json:"manufacturingOrderId"`
+	SerialNumbers        []string `json:"serialNumbers"`
+}
+
+// Sets the serial numbers of the units that a manufacturing order will make, replacing the previous ones.
+// The units enter the warehouse when the order is manufactured.
+// ERROR CODES:
+// 1. The product doesn't have serial number tracking
+// 2. The order is already manufactured
+// 3. There are more serial numbers than the quantity to manufacture
+// 4. A serial number already exists
+func (s *ManufacturingOrderSerialNumbers) setManufacturingOrderSerialNumbers(enterpriseId int32) OkAndErrorCodeReturn {
+	s.SerialNumbers = cleanSerialNumbers(s.SerialNumbers)
+	if s.ManufacturingOrderId <= 0 {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	order := getManufacturingOrderRow(s.ManufacturingOrderId)
+	if order.Id <= 0 || order.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if !order.Product.TrackSerials {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+	if order.Manufactured {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+	if len(s.SerialNumbers) > int(order.QuantityManufactured) {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	// the units of the order that have never been in stock are replaced
+	result := trans.Where("manufacturing_order = ? AND enterprise = ? AND NOT in_stock AND id NOT IN (SELECT serial FROM warehouse_movement_serial WHERE enterprise = ?)", order.Id, enterpriseId, enterpriseId).Delete(&ProductSerial{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	for i := 0; i < len(s.SerialNumbers); i++ {
+		if len(s.SerialNumbers[i]) > 100 {
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+
+		var count int64
+		result = trans.Model(&ProductSerial{}).Where("product = ? AND serial_number = ? AND enterprise = ?", order.ProductId, s.SerialNumbers[i], enterpriseId).Count(&count)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		if count > 0 {
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4, ExtraData: []string{s.SerialNumbers[i]}}
+		}
+
+		result = trans.Create(&ProductSerial{
+			ProductId:            order.ProductId,
+			SerialNumber:         s.SerialNumbers[i],
+			DateCreated:          time.Now(),
+			ManufacturingOrderId: &order.Id,
+			EnterpriseId:         enterpriseId,
+		})
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+	}
+
+	///
+	result = trans.Commit()
+	return OkAndErrorCodeReturn{Ok: result.Error == nil}
+	///
+}
+
+type SalesReturnDetailSerialNumbers struct {
+	SalesReturnDetailId int64    `json:"salesReturnDetailId"`
+	SerialNumbers       []string `json:"serialNumbers"`
+}
+
+// Sets which units the customer is returning, replacing the previous ones. The units enter the warehouse when the return is received.
+// ERROR CODES:
+// 1. The product doesn't have serial number tracking
+// 2. The return is not pending
+// 3. There are more serial numbers than the quantity returned
+// 4. The unit was not sent in the sales order detail of the return
+func (s *SalesReturnDetailSerialNumbers) setSalesReturnDetailSerialNumbers(enterpriseId int32) OkAndErrorCodeReturn {
+	s.SerialNumbers = cleanSerialNumbers(s.SerialNumbers)
+	if s.SalesReturnDetailId <= 0 {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	detail := getSalesReturnDetailRow(s.SalesReturnDetailId)
+	if detail.Id <= 0 || detail.EnterpriseId != enterpriseId {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	product := getProductRow(detail.ProductId)
+	if !product.TrackSerials {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+	salesReturn := getSalesReturnRow(detail.ReturnId)
+	if salesReturn.Status != "_" {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+	if len(s.SerialNumbers) > int(detail.Quantity) {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	result := trans.Model(&ProductSerial{}).Where("sales_return_detail = ? AND enterprise = ?", detail.Id, enterpriseId).Update("sales_return_detail", nil)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	for i := 0; i < len(s.SerialNumbers); i++ {
+		// the unit must have left the warehouse in a delivery note of the sales order detail, and not be back yet
+		result = trans.Model(&ProductSerial{}).Where("product = ? AND serial_number = ? AND enterprise = ? AND NOT in_stock AND id IN (SELECT warehouse_movement_serial.serial FROM warehouse_movement_serial INNER JOIN warehouse_movement ON warehouse_movement.id=warehouse_movement_serial.warehouse_movement WHERE warehouse_movement.sales_order_detail = ? AND warehouse_movement.type = 'O')", detail.ProductId, s.SerialNumbers[i], enterpriseId, detail.OrderDetailId).Update("sales_return_detail", detail.Id)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		if result.RowsAffected == 0 {
+			trans.Rollback()
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 4, ExtraData: []string{s.SerialNumbers[i]}}
+		}
+	}
+
+	///
+	result = trans.Commit()
+	return OkAndErrorCodeReturn{Ok: result.Error == nil}
+	///
+}
+
+type SerialNumberHistory struct {
+	Serial    ProductSerial               `json:"serial"`
+	Movements []SerialNumberHistoryRecord `json:"movements"`
+}
+
+// A warehouse movement of the unit, with the documents that made the movement
+type SerialNumberHistoryRecord struct {
+	WarehouseMovementId         int64     `json:"warehouseMovementId"`
+	Type                        string    `json:"type"` // I = In, O = Out
+	WarehouseId                 string    `json:"warehouseId"`
+	DateCreated                 time.Time `json:"dateCreated"`
+	SupplierId                  *int32    `json:"supplierId"`
+	SupplierName                *string   `json:"supplierName"`
+	PurchaseDeliveryNoteId      *int64    `json:"purchaseDeliveryNoteId"`
+	PurchaseDeliveryNoteName    *string   `json:"purchaseDeliveryNoteName"`
+	ManufacturingOrderId        *int64    `json:"manufacturingOrderId"`
+	TransferBetweenWarehousesId *int64    `json:"transferBetweenWarehousesId"`
+	CustomerId                  *int32    `json:"customerId"`
+	CustomerName                *string   `json:"customerName"`
+	SalesDeliveryNoteId         *int64    `json:"salesDeliveryNoteId"`
+	SalesDeliveryNoteName       *string   `json:"salesDeliveryNoteName"`
+	SalesOrderId                *int64    `json:"salesOrderId"`
+	SalesOrderName              *string   `json:"salesOrderName"`
+	SalesInvoiceId              *int64    `json:"salesInvoiceId"` // Invoice of the sales order detail that the unit was sent in
+	SalesInvoiceName            *string   `json:"salesInvoiceName"`
+	SalesReturnId               *int64    `json:"salesReturnId"`
+}
+
+// Returns the full history of every unit with this serial number (the same serial number can exist for different products).
+func getSerialNumberHistory(serialNumber string, enterpriseId int32) []SerialNumberHistory {
+	history := make([]SerialNumberHistory, 0)
+	serialNumber = strings.TrimSpace(serialNumber)
+	if len(serialNumber) == 0 || len(serialNumber) > 100 {
+		return history
+	}
+
+	var serials []ProductSerial
+	result := dbOrm.Model(&ProductSerial{}).Where("serial_number = ? AND enterprise = ?", serialNumber, enterpriseId).Preload("Product").Order("product ASC").Find(&serials)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return history
+	}
+
+	sqlStatement := `SELECT warehouse_movement.id,warehouse_movement.type,warehouse_movement.warehouse,warehouse_movement.date_created,
+	suppliers.id,suppliers.name,purchase_delivery_note.id,purchase_delivery_note.delivery_note_name,
+	(SELECT manufacturing_order.id FROM manufacturing_order WHERE manufacturing_order.warehouse_movement=warehouse_movement.id LIMIT 1),
+	(SELECT transfer_between_warehouses_detail.transfer_between_warehouses FROM transfer_between_warehouses_detail WHERE transfer_between_warehouses_detail.warehouse_movement_out=warehouse_movement.id OR transfer_between_warehouses_detail.warehouse_movement_in=warehouse_movement.id LIMIT 1),
+	customer.id,customer.name,sales_delivery_note.id,sales_delivery_note.delivery_note_name,sales_order.id,sales_order.order_name,
+	(SELECT sales_invoice.id FROM sales_invoice_detail INNER JOIN sales_invoice ON sales_invoice.id=sales_invoice_detail.invoice WHERE sales_invoice_detail.order_detail=warehouse_movement.sales_order_detail AND warehouse_movement.sales_delivery_note IS NOT NULL ORDER BY sales_invoice.id ASC LIMIT 1),
+	(SELECT sales_invoice.invoice_name FROM sales_invoice_detail INNER JOIN sales_invoice ON sales_invoice.id=sales_invoice_detail.invoice WHERE sales_invoice_detail.order_detail=warehouse_movement.sales_order_detail AND warehouse_movement.sales_delivery_note IS NOT NULL ORDER BY sales_invoice.id ASC LIMIT 1),
+	(SELECT sales_return_detail.sales_return FROM sales_return_detail WHERE sales_return_detail.warehouse_movement=warehouse_movement.id LIMIT 1)
+	FROM warehouse_movement_serial INNER JOIN warehouse_movement ON warehouse_movement.id=warehouse_movement_serial.warehouse_movement
+	LEFT JOIN purchase_delivery_note ON purchase_delivery_note.id=warehouse_movement.purchase_delivery_note LEFT JOIN suppliers ON suppliers.id=purchase_delivery_note.supplier
+	LEFT JOIN sales_delivery_note ON sales_delivery_note.id=warehouse_movement.sales_delivery_note LEFT JOIN customer ON customer.id=sales_delivery_note.customer
+	LEFT JOIN sales_order ON sales_order.id=warehouse_movement.sales_order
+	WHERE warehouse_movement_serial.serial=$1 AND warehouse_movement_serial.enterprise=$2 ORDER BY warehouse_movement.date_created ASC,warehouse_movement.id ASC`
+	for i := 0; i < len(serials); i++ {
+		h := SerialNumberHistory{Serial: serials[i], Movements: make([]SerialNumberHistoryRecord, 0)}
+
+		rows, err := db.Query(sqlStatement, serials[i].Id, enterpriseId)
+		if err != nil {
+			log("DB", err.Error())
+			return history
+		}
+		for rows.Next() {
+			r := SerialNumberHistoryRecord{}
+			rows.Scan(&r.WarehouseMovementId, &r.Type, &r.WarehouseId, &r.DateCreated, &r.SupplierId, &r.SupplierName, &r.PurchaseDeliveryNoteId, &r.PurchaseDeliveryNoteName, &r.ManufacturingOrderId, &r.TransferBetweenWarehousesId, &r.CustomerId, &r.CustomerName, &r.SalesDeliveryNoteId, &r.SalesDeliveryNoteName, &r.SalesOrderId, &r.SalesOrderName, &r.SalesInvoiceId, &r.SalesInvoiceName, &r.SalesReturnId)
+			h.Movements = append(h.Movements, r)
+		}
+		rows.Close()
+
+		history = append(history, h)
+	}
+	return history
+}
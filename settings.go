@@ -57,6 +57,7 @@ type ServerSettings struct {
 	MaxQueueSizePerWebHook         int32                     `json:"maxQueueSizePerWebHook"`
 	WebSecurity                    ServerSettingsWebSecurity `json:"webSecurity"`
 	TLS                            ServerSettingsTLS         `json:"tls"`
+	PdfFontPath                    string                    `json:"pdfFontPath"` // TrueType font embedded in the PDF documents
 }
 
 type ServerSettingsWebSecurity struct {
@@ -148,51 +149,74 @@ func (s *BackendSettings) upgradeConfig() bool {
 
 // Advanced settings stored in the database. Configurable by final users.
 type Settings struct {
-	Id                            int32              `json:"id" gorm:"primaryKey"`
-	DefaultVatPercent             float64            `json:"defaultVatPercent" gorm:"type:numeric(14,6);not null:true"`
-	DefaultWarehouseId            string             `json:"defaultWarehouseId" gorm:"column:default_warehouse;type:character(2)"`
-	DefaultWarehouse              *Warehouse         `json:"defaultWarehouse" gorm:"foreignKey:DefaultWarehouseId,Id;references:Id,EnterpriseId"`
-	DateFormat                    string             `json:"dateFormat" gorm:"type:character varying(25);not null:true"`
-	EnterpriseName                string             `json:"enterpriseName" gorm:"type:character varying(50);not null:true"`
-	EnterpriseDescription         string             `json:"enterpriseDescription" gorm:"type:character varying(250);not null:true"`
-	Currency                      string             `json:"currency" gorm:"type:character(1);not null:true"` // "_" = None, "E" = European Central Bank
-	CurrencyECBurl                string             `json:"currencyECBurl" gorm:"column:currency_ecb_url;type:character varying(100);not null:true"`
-	BarcodePrefix                 string             `json:"barcodePrefix" gorm:"type:character varying(4);not null:true"`
-	SettingsEcommerce             *SettingsEcommerce `json:"settingsEcommerce" gorm:"foreignKey:Id;references:EnterpriseId"`
-	CronCurrency                  string             `json:"cronCurrency" gorm:"type:character varying(25);not null:true"`
-	CronPrestaShop                string             `json:"cronPrestaShop" gorm:"column:cron_prestashop;type:character varying(25);not null:true"`
-	PalletWeight                  float64            `json:"palletWeight" gorm:"type:numeric(14,6);not null:true"`
-	PalletWidth                   float64            `json:"palletWidth" gorm:"type:numeric(14,6);not null:true"`
-	PalletHeight                  float64            `json:"palletHeight" gorm:"type:numeric(14,6);not null:true"`
-	PalletDepth                   float64            `json:"palletDepth" gorm:"type:numeric(14,6);not null:true"`
-	MinimumStockSalesPeriods      int16              `json:"minimumStockSalesPeriods" gorm:"not null:true"`
-	MinimumStockSalesDays         int16              `json:"minimumStockSalesDays" gorm:"not null:true"`
-	CustomerJournalId             *int32             `json:"customerJournalId" gorm:"column:customer_journal"`
-	CustomerJournal               *Journal           `json:"customerJournal" gorm:"foreignKey:CustomerJournalId,Id;references:Id,EnterpriseId"`
-	SalesJournalId                *int32             `json:"salesJournalId" gorm:"column:sales_journal"`
-	SalesJournal                  *Journal           `json:"salesJournal" gorm:"foreignKey:SalesJournalId,Id;references:Id,EnterpriseId"`
-	SalesAccountId                *int32             `json:"salesAccountId" gorm:"column:sales_account"`
-	SalesAccount                  *Account           `json:"salesAccount" gorm:"foreignKey:SalesAccountId,Id;references:Id,EnterpriseId"`
-	SupplierJournalId             *int32             `json:"supplierJournalId" gorm:"column:supplier_journal"`
-	SupplierJournal               *Journal           `json:"supplierJournal" gorm:"foreignKey:SupplierJournalId,Id;references:Id,EnterpriseId"`
-	PurchaseJournalId             *int32             `json:"purchaseJournalId" gorm:"column:purchase_journal"`
-	PurchaseJournal               *Journal           `json:"purchaseJournal" gorm:"foreignKey:PurchaseJournalId,Id;references:Id,EnterpriseId"`
-	PurchaseAccountId             *int32             `json:"purchaseAccountId" gorm:"column:purchase_account"`
-	PurchaseAccount               *Account           `json:"purchaseAccount" gorm:"foreignKey:PurchaseAccountId,Id;references:Id,EnterpriseId"`
-	EnableApiKey                  bool               `json:"enableApiKey" gorm:"not null:true"`
-	CronClearLabels               string             `json:"cronClearLabels" gorm:"type:character varying(25);not null:true"`
-	LimitAccountingDate           *time.Time         `json:"limitAccountingDate" gorm:"type:timestamp(0) with time zone"`
-	ConnectionLog                 bool               `json:"connectionLog" gorm:"not null:true"`
-	FilterConnections             bool               `json:"filterConnections" gorm:"not null:true"`
-	EnterpriseKey                 string             `json:"enterpriseKey" gorm:"type:character varying(25);not null:true;index:config_enterprise_key,unique:true,priority:1"`
-	PasswordMinimumLength         int16              `json:"passwordMinimumLength" gorm:"not null:true"`
-	PasswordMinumumComplexity     string             `json:"passwordMinumumComplexity" gorm:"type:character(1);not null:true"` // "A": Alphabetical, "B": Alphabetical + numbers, "C": Uppercase + lowercase + numbers, "D": Uppercase + lowercase + numbers + symbols
-	InvoiceDeletePolicy           int16              `json:"invoiceDeletePolicy" gorm:"not null:true"`                         // 0 = Allow invoice deletion, 1 = Only allow the deletion of the latest invoice in the billing serie, 2 = Never allow invoice deletion
-	TransactionLog                bool               `json:"transactionLog" gorm:"not null:true"`
-	UndoManufacturingOrderSeconds int16              `json:"undoManufacturingOrderSeconds" gorm:"not null:true"`
-	CronSendCloudTracking         string             `json:"cronSendCloudTracking" gorm:"column:cron_sendcloud_tracking;type:character varying(25);not null:true"`
-	SettingsEmail                 *SettingsEmail     `json:"settingsEmail" gorm:"foreignKey:Id;references:EnterpriseId"`
-	SettingsCleanUp               *SettingsCleanUp   `json:"settingsCleanUp" gorm:"foreignKey:Id;references:EnterpriseId"`
+	Id                             int32              `json:"id" gorm:"primaryKey"`
+	DefaultVatPercent              float64            `json:"defaultVatPercent" gorm:"type:numeric(14,6);not null:true"`
+	DefaultWarehouseId             string             `json:"defaultWarehouseId" gorm:"column:default_warehouse;type:character(2)"`
+	DefaultWarehouse               *Warehouse         `json:"defaultWarehouse" gorm:"foreignKey:DefaultWarehouseId,Id;references:Id,EnterpriseId"`
+	DateFormat                     string             `json:"dateFormat" gorm:"type:character varying(25);not null:true"`
+	EnterpriseName                 string             `json:"enterpriseName" gorm:"type:character varying(50);not null:true"`
+	EnterpriseDescription          string             `json:"enterpriseDescription" gorm:"type:character varying(250);not null:true"`
+	Currency                       string             `json:"currency" gorm:"type:character(1);not null:true"` // "_" = None, "E" = European Central Bank
+	CurrencyECBurl                 string             `json:"currencyECBurl" gorm:"column:currency_ecb_url;type:character varying(100);not null:true"`
+	BarcodePrefix                  string             `json:"barcodePrefix" gorm:"type:character varying(4);not null:true"`
+	SettingsEcommerce              *SettingsEcommerce `json:"settingsEcommerce" gorm:"foreignKey:Id;references:EnterpriseId"`
+	CronCurrency                   string             `json:"cronCurrency" gorm:"type:character varying(25);not null:true"`
+	CronPrestaShop                 string             `json:"cronPrestaShop" gorm:"column:cron_prestashop;type:character varying(25);not null:true"`
+	PalletWeight                   float64            `json:"palletWeight" gorm:"type:numeric(14,6);not null:true"`
+	PalletWidth                    float64            `json:"palletWidth" gorm:"type:numeric(14,6);not null:true"`
+	PalletHeight                   float64            `json:"palletHeight" gorm:"type:numeric(14,6);not null:true"`
+	PalletDepth                    float64            `json:"palletDepth" gorm:"type:numeric(14,6);not null:true"`
+	MinimumStockSalesPeriods       int16              `json:"minimumStockSalesPeriods" gorm:"not null:true"`
+	MinimumStockSalesDays          int16              `json:"minimumStockSalesDays" gorm:"not null:true"`
+	CustomerJournalId              *int32             `json:"customerJournalId" gorm:"column:customer_journal"`
+	CustomerJournal                *Journal           `json:"customerJournal" gorm:"foreignKey:CustomerJournalId,Id;references:Id,EnterpriseId"`
+	SalesJournalId                 *int32             `json:"salesJournalId" gorm:"column:sales_journal"`
+	SalesJournal                   *Journal           `json:"salesJournal" gorm:"foreignKey:SalesJournalId,Id;references:Id,EnterpriseId"`
+	SalesAccountId                 *int32             `json:"salesAccountId" gorm:"column:sales_account"`
+	SalesAccount                   *Account           `json:"salesAccount" gorm:"foreignKey:SalesAccountId,Id;references:Id,EnterpriseId"`
+	SupplierJournalId              *int32             `json:"supplierJournalId" gorm:"column:supplier_journal"`
+	SupplierJournal                *Journal           `json:"supplierJournal" gorm:"foreignKey:SupplierJournalId,Id;references:Id,EnterpriseId"`
+	PurchaseJournalId              *int32             `json:"purchaseJournalId" gorm:"column:purchase_journal"`
+	PurchaseJournal                *Journal           `json:"purchaseJournal" gorm:"foreignKey:PurchaseJournalId,Id;references:Id,EnterpriseId"`
+	PurchaseAccountId              *int32             `json:"purchaseAccountId" gorm:"column:purchase_account"`
+	PurchaseAccount                *Account           `json:"purchaseAccount" gorm:"foreignKey:PurchaseAccountId,Id;references:Id,EnterpriseId"`
+	EnableApiKey                   bool               `json:"enableApiKey" gorm:"not null:true"`
+	CronClearLabels                string             `json:"cronClearLabels" gorm:"type:character varying(25);not null:true"`
+	LimitAccountingDate            *time.Time         `json:"limitAccountingDate" gorm:"type:timestamp(0) with time zone"`
+	ConnectionLog                  bool               `json:"connectionLog" gorm:"not null:true"`
+	FilterConnections              bool               `json:"filterConnections" gorm:"not null:true"`
+	EnterpriseKey                  string             `json:"enterpriseKey" gorm:"type:character varying(25);not null:true;index:config_enterprise_key,unique:true,priority:1"`
+	PasswordMinimumLength          int16              `json:"passwordMinimumLength" gorm:"not null:true"`
+	PasswordMinumumComplexity      string             `json:"passwordMinumumComplexity" gorm:"type:character(1);not null:true"` // "A": Alphabetical, "B": Alphabetical + numbers, "C": Uppercase + lowercase + numbers, "D": Uppercase + lowercase + numbers + symbols
+	InvoiceDeletePolicy            int16              `json:"invoiceDeletePolicy" gorm:"not null:true"`                         // 0 = Allow invoice deletion, 1 = Only allow the deletion of the latest invoice in the billing serie, 2 = Never allow invoice deletion
+	TransactionLog                 bool               `json:"transactionLog" gorm:"not null:true"`
+	UndoManufacturingOrderSeconds  int16              `json:"undoManufacturingOrderSeconds" gorm:"not null:true"`
+	CronSendCloudTracking          string             `json:"cronSendCloudTracking" gorm:"column:cron_sendcloud_tracking;type:character varying(25);not null:true"`
+	CronSalesSubscriptions         string             `json:"cronSalesSubscriptions" gorm:"type:character varying(25);not null:true;default:'@daily'"`
+	EnterpriseTaxId                string             `json:"enterpriseTaxId" gorm:"type:character varying(25);not null:true;default:''"`
+	EnterpriseAddress              string             `json:"enterpriseAddress" gorm:"type:character varying(200);not null:true;default:''"`
+	EnterpriseCity                 string             `json:"enterpriseCity" gorm:"type:character varying(100);not null:true;default:''"`
+	EnterpriseZipCode              string             `json:"enterpriseZipCode" gorm:"type:character varying(12);not null:true;default:''"`
+	EnterpriseProvince             string             `json:"enterpriseProvince" gorm:"type:character varying(100);not null:true;default:''"`
+	EnterpriseCountryId            *int32             `json:"enterpriseCountryId" gorm:"column:enterprise_country"`
+	EnterpriseCountry              *Country           `json:"enterpriseCountry" gorm:"foreignKey:EnterpriseCountryId,Id;references:Id,EnterpriseId"`
+	FacturaeCertificate            string             `json:"facturaeCertificate" gorm:"type:text;not null:true;default:''"` // PKCS#12 file encoded in base64, used to sign the Facturae invoices and the TicketBAI files
+	FacturaeCertificatePassword    string             `json:"facturaeCertificatePassword" gorm:"type:character varying(100);not null:true;default:''"`
+	InvoiceRegister                string             `json:"invoiceRegister" gorm:"type:character(1);not null:true;default:'_'"` // "_" = None, "V" = VeriFactu, "T" = TicketBAI
+	InvoiceRegisterUrl             string             `json:"invoiceRegisterUrl" gorm:"type:character varying(255);not null:true;default:''"`
+	TicketBaiLicense               string             `json:"ticketBaiLicense" gorm:"column:ticketbai_license;type:character varying(20);not null:true;default:''"`
+	CronDunning                    string             `json:"cronDunning" gorm:"type:character varying(25);not null:true;default:'@daily'"`
+	PurchaseSupplierSelection      string             `json:"purchaseSupplierSelection" gorm:"type:character(1);not null:true;default:'P'"`     // P = Preferred supplier, C = Cheapest supplier
+	ThreeWayMatch                  bool               `json:"threeWayMatch" gorm:"not null:true;default:false"`                                 // Check the purchase invoices against the purchase orders and the delivery notes before posting
+	ThreeWayMatchPriceTolerance    float64            `json:"threeWayMatchPriceTolerance" gorm:"type:numeric(14,6);not null:true;default:0"`    // Percentage
+	ThreeWayMatchQuantityTolerance float64            `json:"threeWayMatchQuantityTolerance" gorm:"type:numeric(14,6);not null:true;default:0"` // Percentage
+	EnterpriseGln                  string             `json:"enterpriseGln" gorm:"type:character varying(13);not null:true;default:''"`         // Global Location Number of the enterprise, sender of the EDI messages
+	EdiInboundDirectory            string             `json:"ediInboundDirectory" gorm:"type:character varying(255);not null:true;default:''"`  // The EDI files received are read from this directory
+	EdiOutboundDirectory           string             `json:"ediOutboundDirectory" gorm:"type:character varying(255);not null:true;default:''"` // The EDI files generated are written to this directory
+	CronEdi                        string             `json:"cronEdi" gorm:"type:character varying(25);not null:true;default:'@hourly'"`
+	CostingMethod                  string             `json:"costingMethod" gorm:"type:character(1);not null:true;default:'W'"` // W = Weighted average, F = FIFO
+	SettingsEmail                  *SettingsEmail     `json:"settingsEmail" gorm:"foreignKey:Id;references:EnterpriseId"`
+	SettingsCleanUp                *SettingsCleanUp   `json:"settingsCleanUp" gorm:"foreignKey:Id;references:EnterpriseId"`
 }
 
 func (s *Settings) TableName() string {
@@ -227,7 +251,7 @@ func getSettingsRecordByEnterprise(enterpriseKey string) Settings {
 }
 
 func (s *Settings) isValid() bool {
-	return !(s.DefaultVatPercent < 0 || len(s.DefaultWarehouseId) != 2 || len(s.DateFormat) == 0 || len(s.DateFormat) > 25 || len(s.EnterpriseName) == 0 || len(s.EnterpriseName) > 50 || len(s.EnterpriseDescription) > 250 || (s.Currency != "_" && s.Currency != "E") || len(s.CurrencyECBurl) > 100 || (s.Currency == "E" && len(s.CurrencyECBurl) == 0) || len(s.BarcodePrefix) > 4 || len(s.CronCurrency) > 25 || len(s.CronPrestaShop) > 25 || s.PalletWeight < 0 || s.PalletWidth < 0 || s.PalletHeight < 0 || s.PalletDepth < 0 || s.MinimumStockSalesPeriods < 0 || s.MinimumStockSalesDays < 0 || s.PasswordMinimumLength < 6 || (s.PasswordMinumumComplexity != "A" && s.PasswordMinumumComplexity != "B" && s.PasswordMinumumComplexity != "C" && s.PasswordMinumumComplexity != "D") || s.InvoiceDeletePolicy < 0 || s.InvoiceDeletePolicy > 2 || s.UndoManufacturingOrderSeconds < 0 || len(s.CronSendCloudTracking) > 25)
+	return !(s.DefaultVatPercent < 0 || len(s.DefaultWarehouseId) != 2 || len(s.DateFormat) == 0 || len(s.DateFormat) > 25 || len(s.EnterpriseName) == 0 || len(s.EnterpriseName) > 50 || len(s.EnterpriseDescription) > 250 || (s.Currency != "_" && s.Currency != "E") || len(s.CurrencyECBurl) > 100 || (s.Currency == "E" && len(s.CurrencyECBurl) == 0) || len(s.BarcodePrefix) > 4 || len(s.CronCurrency) > 25 || len(s.CronPrestaShop) > 25 || s.PalletWeight < 0 || s.PalletWidth < 0 || s.PalletHeight < 0 || s.PalletDepth < 0 || s.MinimumStockSalesPeriods < 0 || s.MinimumStockSalesDays < 0 || s.PasswordMinimumLength < 6 || (s.PasswordMinumumComplexity != "A" && s.PasswordMinumumComplexity != "B" && s.PasswordMinumumComplexity != "C" && s.PasswordMinumumComplexity != "D") || s.InvoiceDeletePolicy < 0 || s.InvoiceDeletePolicy > 2 || s.UndoManufacturingOrderSeconds < 0 || len(s.CronSendCloudTracking) > 25 || len(s.CronSalesSubscriptions) > 25 || len(s.EnterpriseTaxId) > 25 || len(s.EnterpriseAddress) > 200 || len(s.EnterpriseCity) > 100 || len(s.EnterpriseZipCode) > 12 || len(s.EnterpriseProvince) > 100 || len(s.FacturaeCertificatePassword) > 100 || (s.InvoiceRegister != "_" && s.InvoiceRegister != "V" && s.InvoiceRegister != "T") || (s.InvoiceRegister == "T" && len(s.FacturaeCertificate) == 0) || len(s.InvoiceRegisterUrl) > 255 || len(s.TicketBaiLicense) > 20 || len(s.CronDunning) > 25 || (s.PurchaseSupplierSelection != PURCHASE_SUPPLIER_SELECTION_PREFERRED && s.PurchaseSupplierSelection != PURCHASE_SUPPLIER_SELECTION_CHEAPEST) || s.ThreeWayMatchPriceTolerance < 0 || s.ThreeWayMatchQuantityTolerance < 0 || !glnIsValid(s.EnterpriseGln) || len(s.EdiInboundDirectory) > 255 || len(s.EdiOutboundDirectory) > 255 || len(s.CronEdi) > 25 || (s.CostingMethod != COSTING_METHOD_WEIGHTED_AVERAGE && s.CostingMethod != COSTING_METHOD_FIFO))
 }
 
 func (s *Settings) updateSettingsRecord() bool {
@@ -277,10 +301,36 @@ func (s *Settings) updateSettingsRecord() bool {
 	if err != nil {
 		return false
 	}
+	if s.CronSalesSubscriptions != "" {
+		_, err := cron.ParseStandard(s.CronSalesSubscriptions)
+		if err != nil {
+			return false
+		}
+	}
+	if s.CronDunning != "" {
+		_, err := cron.ParseStandard(s.CronDunning)
+		if err != nil {
+			return false
+		}
+	}
+	if s.CronEdi != "" {
+		_, err := cron.ParseStandard(s.CronEdi)
+		if err != nil {
+			return false
+		}
+	}
+
+	// the certificate must be readable to sign the invoices
+	if len(s.FacturaeCertificate) > 0 {
+		_, _, err := loadFacturaeCertificate(s.FacturaeCertificate, s.FacturaeCertificatePassword)
+		if err != nil {
+			return false
+		}
+	}
 
 	// ¿has the cron changed?
 	settingsInMemory := getSettingsRecordById(s.Id)
-	if settingsInMemory.CronClearLabels != s.CronClearLabels || settingsInMemory.Currency != s.Currency || settingsInMemory.CronCurrency != s.CronCurrency || settingsInMemory.SettingsEcommerce.Ecommerce != s.SettingsEcommerce.Ecommerce || settingsInMemory.CronPrestaShop != s.CronPrestaShop {
+	if settingsInMemory.CronClearLabels != s.CronClearLabels || settingsInMemory.Currency != s.Currency || settingsInMemory.CronCurrency != s.CronCurrency || settingsInMemory.SettingsEcommerce.Ecommerce != s.SettingsEcommerce.Ecommerce || settingsInMemory.CronPrestaShop != s.CronPrestaShop || settingsInMemory.CronSalesSubscriptions != s.CronSalesSubscriptions || settingsInMemory.CronDunning != s.CronDunning || settingsInMemory.CronEdi != s.CronEdi {
 		refreshRunningCrons(settingsInMemory, *s)
 	}
 
@@ -321,6 +371,28 @@ func (s *Settings) updateSettingsRecord() bool {
 	settingsInDisk.TransactionLog = s.TransactionLog
 	settingsInDisk.UndoManufacturingOrderSeconds = s.UndoManufacturingOrderSeconds
 	settingsInDisk.CronSendCloudTracking = s.CronSendCloudTracking
+	settingsInDisk.CronSalesSubscriptions = s.CronSalesSubscriptions
+	settingsInDisk.EnterpriseTaxId = s.EnterpriseTaxId
+	settingsInDisk.EnterpriseAddress = s.EnterpriseAddress
+	settingsInDisk.EnterpriseCity = s.EnterpriseCity
+	settingsInDisk.EnterpriseZipCode = s.EnterpriseZipCode
+	settingsInDisk.EnterpriseProvince = s.EnterpriseProvince
+	settingsInDisk.EnterpriseCountryId = s.EnterpriseCountryId
+	settingsInDisk.FacturaeCertificate = s.FacturaeCertificate
+	settingsInDisk.FacturaeCertificatePassword = s.FacturaeCertificatePassword
+	settingsInDisk.InvoiceRegister = s.InvoiceRegister
+	settingsInDisk.InvoiceRegisterUrl = s.InvoiceRegisterUrl
+	settingsInDisk.TicketBaiLicense = s.TicketBaiLicense
+	settingsInDisk.CronDunning = s.CronDunning
+	settingsInDisk.PurchaseSupplierSelection = s.PurchaseSupplierSelection
+	settingsInDisk.ThreeWayMatch = s.ThreeWayMatch
+	settingsInDisk.ThreeWayMatchPriceTolerance = s.ThreeWayMatchPriceTolerance
+	settingsInDisk.ThreeWayMatchQuantityTolerance = s.ThreeWayMatchQuantityTolerance
+	settingsInDisk.EnterpriseGln = s.EnterpriseGln
+	settingsInDisk.EdiInboundDirectory = s.EdiInboundDirectory
+	settingsInDisk.EdiOutboundDirectory = s.EdiOutboundDirectory
+	settingsInDisk.CronEdi = s.CronEdi
+	settingsInDisk.CostingMethod = s.CostingMethod
 
 	trans := dbOrm.Begin()
 
@@ -593,10 +665,13 @@ func (s Settings) censorSettings() ClientSettings {
 }
 
 type EnterpriseCronInfo struct {
-	CronClearLabels       cron.EntryID
-	CronCurrency          *cron.EntryID
-	CronPrestaShop        *cron.EntryID
-	CronSendcloudTracking *cron.EntryID
+	CronClearLabels        cron.EntryID
+	CronCurrency           *cron.EntryID
+	CronPrestaShop         *cron.EntryID
+	CronSendcloudTracking  *cron.EntryID
+	CronSalesSubscriptions *cron.EntryID
+	CronDunning            *cron.EntryID
+	CronEdi                *cron.EntryID
 }
 
 func refreshRunningCrons(oldSettings Settings, newSettings Settings) {
@@ -651,6 +726,51 @@ func refreshRunningCrons(oldSettings Settings, newSettings Settings) {
 		}
 	}
 
+	if oldSettings.CronSalesSubscriptions != newSettings.CronSalesSubscriptions {
+		if enterpriseCronInfo.CronSalesSubscriptions != nil {
+			c.Remove(*enterpriseCronInfo.CronSalesSubscriptions)
+			enterpriseCronInfo.CronSalesSubscriptions = nil
+		}
+		if newSettings.CronSalesSubscriptions != "" {
+			cronId, err := c.AddFunc(newSettings.CronSalesSubscriptions, func() {
+				runSalesSubscriptions(oldSettings.Id)
+			})
+			if err == nil {
+				enterpriseCronInfo.CronSalesSubscriptions = &cronId
+			}
+		}
+	}
+
+	if oldSettings.CronDunning != newSettings.CronDunning {
+		if enterpriseCronInfo.CronDunning != nil {
+			c.Remove(*enterpriseCronInfo.CronDunning)
+			enterpriseCronInfo.CronDunning = nil
+		}
+		if newSettings.CronDunning != "" {
+			cronId, err := c.AddFunc(newSettings.CronDunning, func() {
+				runDunning(oldSettings.Id)
+			})
+			if err == nil {
+				enterpriseCronInfo.CronDunning = &cronId
+			}
+		}
+	}
+
+	if oldSettings.CronEdi != newSettings.CronEdi {
+		if enterpriseCronInfo.CronEdi != nil {
+			c.Remove(*enterpriseCronInfo.CronEdi)
+			enterpriseCronInfo.CronEdi = nil
+		}
+		if newSettings.CronEdi != "" {
+			cronId, err := c.AddFunc(newSettings.CronEdi, func() {
+				processEdiInbound(oldSettings.Id)
+			})
+			if err == nil {
+				enterpriseCronInfo.CronEdi = &cronId
+			}
+		}
+	}
+
 	runningCrons[oldSettings.Id] = enterpriseCronInfo
 	runningCronsMutex.Unlock()
 }
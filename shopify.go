@@ -1262,9 +1262,9 @@ func copySyDraftOrders(enterpriseId int32) bool {
 
 			o.ShopifyDraftId = id
 			o.EnterpriseId = enterpriseId
-			ok, orderId := o.insertSalesOrder(0)
-			if !ok {
-				errors = append(errors, "Can't import draft order. The order could not be created in MARKETNET. Order id + "+strconv.Itoa(int(id))+" name "+name)
+			okAndErr, orderId := o.insertSalesOrder(0, nil)
+			if !okAndErr.Ok {
+				errors = append(errors, "Can't import draft order. The order could not be created in MARKETNET. Order id + "+strconv.Itoa(int(id))+" name "+name+getCustomerRiskErrorMessage(okAndErr))
 				continue
 			}
 
@@ -1311,8 +1311,12 @@ func copySyDraftOrders(enterpriseId int32) bool {
 
 				d := SalesOrderDetail{}
 				d.OrderId = orderId
-				d.Quantity = quantity
+				d.Quantity = float64(quantity)
 				d.Price = price
+				// apply the price list of the customer, if there is any
+				if listPrice, ok := getProductPriceForSaleOrder(productIdErp, d.OrderId, d.Quantity, enterpriseId); ok {
+					d.Price = listPrice
+				}
 				if taxable && !taxExempt {
 					d.VatPercent = s.DefaultVatPercent
 				} else {
@@ -1321,7 +1325,7 @@ func copySyDraftOrders(enterpriseId int32) bool {
 				d.ProductId = productIdErp
 				d.ShopifyDraftId = id
 				d.EnterpriseId = enterpriseId
-				d.insertSalesOrderDetail(0)
+				d.insertSalesOrderDetail(0, nil)
 			} // for rows.Next()
 		} else { // if rows == 0
 			var orderIdErp int64
@@ -1417,8 +1421,12 @@ func copySyDraftOrders(enterpriseId int32) bool {
 				if salesOrderDetailId <= 0 {
 					d := SalesOrderDetail{}
 					d.OrderId = o.Id
-					d.Quantity = quantity
+					d.Quantity = float64(quantity)
 					d.Price = price
+					// apply the price list of the customer, if there is any
+					if listPrice, ok := getProductPriceForSaleOrder(productIdErp, d.OrderId, d.Quantity, enterpriseId); ok {
+						d.Price = listPrice
+					}
 					if taxable && !taxExempt {
 						d.VatPercent = s.DefaultVatPercent
 					} else {
@@ -1427,12 +1435,16 @@ func copySyDraftOrders(enterpriseId int32) bool {
 					d.ProductId = productIdErp
 					d.ShopifyDraftId = id
 					d.EnterpriseId = enterpriseId
-					d.insertSalesOrderDetail(0)
+					d.insertSalesOrderDetail(0, nil)
 				} else { // if salesOrderDetailId <= 0
 					d := getSalesOrderDetailRow(salesOrderDetailId)
 					d.OrderId = o.Id
-					d.Quantity = quantity
+					d.Quantity = float64(quantity)
 					d.Price = price
+					// apply the price list of the customer, if there is any
+					if listPrice, ok := getProductPriceForSaleOrder(productIdErp, d.OrderId, d.Quantity, enterpriseId); ok {
+						d.Price = listPrice
+					}
 					if taxable && !taxExempt {
 						d.VatPercent = s.DefaultVatPercent
 					} else {
@@ -1708,8 +1720,12 @@ func copySyOrders(enterpriseId int32) bool {
 				if salesOrderDetailId > 0 {
 					d := getSalesOrderDetailRow(salesOrderDetailId)
 					d.OrderId = o.Id
-					d.Quantity = quantity
+					d.Quantity = float64(quantity)
 					d.Price = price
+					// apply the price list of the customer, if there is any
+					if listPrice, ok := getProductPriceForSaleOrder(productIdErp, d.OrderId, d.Quantity, enterpriseId); ok {
+						d.Price = listPrice
+					}
 					if taxable && !taxExempt {
 						d.VatPercent = s.DefaultVatPercent
 					} else {
@@ -0,0 +1,385 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type StatementOfAccountQuery struct {
+	CustomerId *int32     `json:"customerId"`
+	SupplierId *int32     `json:"supplierId"`
+	DateStart  *time.Time `json:"dateStart"`
+	DateEnd    *time.Time `json:"dateEnd"`
+}
+
+func (q *StatementOfAccountQuery) isValid() bool {
+	return !((q.CustomerId == nil) == (q.SupplierId == nil) || (q.DateStart != nil && q.DateEnd != nil && q.DateEnd.Before(*q.DateStart)))
+}
+
+type StatementOfAccount struct {
+	Name           string                    `json:"name"`
+	OpeningBalance float64                   `json:"openingBalance"` // Balance of the entries before the start date
+	Entries        []StatementOfAccountEntry `json:"entries"`
+	Debit          float64                   `json:"debit"`
+	Credit         float64                   `json:"credit"`
+	ClosingBalance float64                   `json:"closingBalance"`
+}
+
+type StatementOfAccountEntry struct {
+	Date         time.Time `json:"date"`
+	Type         string    `json:"type"` // I = Invoice, A = Amending invoice, C = Charge, P = Payment
+	DocumentName string    `json:"documentName"`
+	Concept      string    `json:"concept"`
+	Debit        float64   `json:"debit"`
+	Credit       float64   `json:"credit"`
+	Balance      float64   `json:"balance"` // Amount owed by the customer, or owed to the supplier, after this entry
+	InvoiceId    *int64    `json:"invoiceId"`
+}
+
+// Returns the invoices, the amending invoices and the charges of a customer, or the invoices, the amending invoices and the payments of a supplier,
+// in date order, with the running balance of the amount owed.
+// The customer's invoices are in the debit and the charges are in the credit. The supplier's invoices are in the credit and the payments are in the debit.
+func (q *StatementOfAccountQuery) getStatementOfAccount(enterpriseId int32) StatementOfAccount {
+	statement := StatementOfAccount{Entries: make([]StatementOfAccountEntry, 0)}
+	if !q.isValid() {
+		return statement
+	}
+
+	entries := make([]StatementOfAccountEntry, 0)
+	addInvoice := func(invoiceId int64, date time.Time, invoiceName string, amending bool, totalAmount float64, customer bool) {
+		id := invoiceId
+		entry := StatementOfAccountEntry{Date: date, Type: "I", DocumentName: strings.TrimSpace(invoiceName), InvoiceId: &id}
+		if amending {
+			entry.Type = "A"
+		}
+		// the amending invoices have a negative total
+		if customer == (totalAmount >= 0) {
+			entry.Debit = absf(totalAmount)
+		} else {
+			entry.Credit = absf(totalAmount)
+		}
+		entries = append(entries, entry)
+	}
+
+	var accountId *int32
+	if q.CustomerId != nil {
+		customer := getCustomerRow(*q.CustomerId)
+		if customer.Id <= 0 || customer.EnterpriseId != enterpriseId {
+			return statement
+		}
+		statement.Name = customer.Name
+		accountId = customer.AccountId
+
+		invoices := make([]SalesInvoice, 0)
+		result := dbOrm.Model(&SalesInvoice{}).Where("customer = ? AND enterprise = ?", customer.Id, enterpriseId).Order("date_created ASC").Find(&invoices)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			return statement
+		}
+		for i := 0; i < len(invoices); i++ {
+			addInvoice(invoices[i].Id, invoices[i].DateCreated, invoices[i].InvoiceName, invoices[i].Amending, invoices[i].TotalAmount, true)
+		}
+
+		if accountId != nil {
+			charges := make([]Charges, 0)
+			result = dbOrm.Model(&Charges{}).Where("account = ? AND enterprise = ?", *accountId, enterpriseId).Preload("CollectionOperation").Order("date_created ASC").Find(&charges)
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				return statement
+			}
+			for i := 0; i < len(charges); i++ {
+				entries = append(entries, StatementOfAccountEntry{Date: charges[i].DateCreated, Type: "C", DocumentName: strings.TrimSpace(charges[i].CollectionOperation.DocumentName), Concept: charges[i].Concept, Credit: charges[i].Amount})
+			}
+		}
+	} else {
+		supplier := getSupplierRow(*q.SupplierId)
+		if supplier.Id <= 0 || supplier.EnterpriseId != enterpriseId {
+			return statement
+		}
+		statement.Name = supplier.Name
+		accountId = supplier.AccountId
+
+		invoices := make([]PurchaseInvoice, 0)
+		result := dbOrm.Model(&PurchaseInvoice{}).Where("supplier = ? AND enterprise = ?", supplier.Id, enterpriseId).Order("date_created ASC").Find(&invoices)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			return statement
+		}
+		for i := 0; i < len(invoices); i++ {
+			addInvoice(invoices[i].Id, invoices[i].DateCreated, invoices[i].InvoiceName, invoices[i].Amending, invoices[i].TotalAmount, false)
+		}
+
+		if accountId != nil {
+			payments := make([]Payment, 0)
+			result = dbOrm.Model(&Payment{}).Where("account = ? AND enterprise = ?", *accountId, enterpriseId).Preload("PaymentTransaction").Order("date_created ASC").Find(&payments)
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+				return statement
+			}
+			for i := 0; i < len(payments); i++ {
+				entries = append(entries, StatementOfAccountEntry{Date: payments[i].DateCreated, Type: "P", DocumentName: strings.TrimSpace(payments[i].PaymentTransaction.DocumentName), Concept: payments[i].Concept, Debit: payments[i].Amount})
+			}
+		}
+	}
+
+	// the invoices go before the charges and payments of the same date
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+
+	var balance float64
+	for i := 0; i < len(entries); i++ {
+		if q.CustomerId != nil {
+			balance += entries[i].Debit - entries[i].Credit
+		} else {
+			balance += entries[i].Credit - entries[i].Debit
+		}
+		entries[i].Balance = balance
+
+		if q.DateStart != nil && entries[i].Date.Before(*q.DateStart) {
+			statement.OpeningBalance = balance
+			continue
+		}
+		if q.DateEnd != nil && entries[i].Date.After(*q.DateEnd) {
+			break
+		}
+		statement.Debit += entries[i].Debit
+		statement.Credit += entries[i].Credit
+		statement.ClosingBalance = balance
+		statement.Entries = append(statement.Entries, entries[i])
+	}
+	if len(statement.Entries) == 0 {
+		statement.ClosingBalance = statement.OpeningBalance
+	}
+
+	return statement
+}
+
+type AgingReportQuery struct {
+	Type string     `json:"type"` // C = Customers, S = Suppliers
+	Date *time.Time `json:"date"` // The pending amounts are aged at this date, or at the current date if it's not set
+}
+
+type AgingReport struct {
+	Rows  []AgingReportRow `json:"rows"`
+	Total AgingReportRow   `json:"total"`
+}
+
+type AgingReportRow struct {
+	Id         int32   `json:"id"`
+	Name       string  `json:"name"`
+	Days0To30  float64 `json:"days0To30"`
+	Days31To60 float64 `json:"days31To60"`
+	Days61To90 float64 `json:"days61To90"`
+	DaysOver90 float64 `json:"daysOver90"`
+	Total      float64 `json:"total"`
+}
+
+func (r *AgingReportRow) add(days int, amount float64) {
+	if days <= 30 {
+		r.Days0To30 += amount
+	} else if days <= 60 {
+		r.Days31To60 += amount
+	} else if days <= 90 {
+		r.Days61To90 += amount
+	} else {
+		r.DaysOver90 += amount
+	}
+	r.Total += amount
+}
+
+// Groups the amounts pending of collection (or payment) of every customer (or supplier) by the age of the document.
+// The pending amounts are the collection operations (or payment transactions) that are not paid yet,
+// and the invoices that are not posted in the accounting yet.
+func (q *AgingReportQuery) getAgingReport(enterpriseId int32) AgingReport {
+	report := AgingReport{Rows: make([]AgingReportRow, 0)}
+	if q.Type != "C" && q.Type != "S" {
+		return report
+	}
+	date := time.Now()
+	if q.Date != nil {
+		date = *q.Date
+	}
+
+	var sqlStatement string
+	if q.Type == "C" {
+		sqlStatement = `SELECT customer.id, customer.name, collection_operation.date_created, collection_operation.pending FROM collection_operation INNER JOIN customer ON customer.account = collection_operation.account AND customer.enterprise = collection_operation.enterprise WHERE collection_operation.enterprise = $1 AND collection_operation.status <> 'C' AND collection_operation.pending <> 0 AND collection_operation.date_created <= $2
+		UNION ALL
+		SELECT customer.id, customer.name, sales_invoice.date_created, sales_invoice.total_amount FROM sales_invoice INNER JOIN customer ON customer.id = sales_invoice.customer AND customer.enterprise = sales_invoice.enterprise WHERE sales_invoice.enterprise = $1 AND sales_invoice.accounting_movement IS NULL AND sales_invoice.total_amount <> 0 AND sales_invoice.date_created <= $2`
+	} else {
+		sqlStatement = `SELECT suppliers.id, suppliers.name, payment_transaction.date_created, payment_transaction.pending FROM payment_transaction INNER JOIN suppliers ON suppliers.account = payment_transaction.account AND suppliers.enterprise = payment_transaction.enterprise WHERE payment_transaction.enterprise = $1 AND payment_transaction.status <> 'C' AND payment_transaction.pending <> 0 AND payment_transaction.date_created <= $2
+		UNION ALL
+		SELECT suppliers.id, suppliers.name, purchase_invoice.date_created, purchase_invoice.total_amount FROM purchase_invoice INNER JOIN suppliers ON suppliers.id = purchase_invoice.supplier AND suppliers.enterprise = purchase_invoice.enterprise WHERE purchase_invoice.enterprise = $1 AND purchase_invoice.accounting_movement IS NULL AND purchase_invoice.total_amount <> 0 AND purchase_invoice.date_created <= $2`
+	}
+	rows, err := db.Query(sqlStatement, enterpriseId, date)
+	if err != nil {
+		log("DB", err.Error())
+		return report
+	}
+	defer rows.Close()
+
+	indexes := make(map[int32]int)
+	for rows.Next() {
+		var id int32
+		var name string
+		var dateCreated time.Time
+		var amount float64
+		rows.Scan(&id, &name, &dateCreated, &amount)
+
+		index, ok := indexes[id]
+		if !ok {
+			index = len(report.Rows)
+			indexes[id] = index
+			report.Rows = append(report.Rows, AgingReportRow{Id: id, Name: name})
+		}
+		days := int(date.Sub(dateCreated).Hours() / 24)
+		report.Rows[index].add(days, amount)
+		report.Total.add(days, amount)
+	}
+
+	sort.Slice(report.Rows, func(i, j int) bool {
+		return report.Rows[i].Name < report.Rows[j].Name
+	})
+	return report
+}
+
+func reportStatementOfAccount(id int, forcePrint bool, supplier bool, dateStart *time.Time, dateEnd *time.Time, enterpriseId int32) []byte {
+	partnerId := int32(id)
+	q := StatementOfAccountQuery{DateStart: dateStart, DateEnd: dateEnd}
+	if supplier {
+		q.SupplierId = &partnerId
+	} else {
+		q.CustomerId = &partnerId
+	}
+	s := q.getStatementOfAccount(enterpriseId)
+	if len(s.Name) == 0 {
+		return nil
+	}
+
+	period := ""
+	if dateStart != nil {
+		period += dateStart.Format("2006-01-02")
+	}
+	period += " - "
+	if dateEnd != nil {
+		period += dateEnd.Format("2006-01-02")
+	}
+
+	template := getReportTemplate(enterpriseId, "STATEMENT_OF_ACCOUNT")
+
+	html := template.Html
+
+	html = strings.Replace(html, "$$img_base64$$", getEnterpriseLogoBase64(enterpriseId), 1)
+	html = strings.Replace(html, "$$statement_name$$", s.Name, 1)
+	html = strings.Replace(html, "$$statement_date$$", time.Now().Format("2006-01-02"), 1)
+	html = strings.Replace(html, "$$statement_period$$", period, 1)
+	html = strings.Replace(html, "$$statement_opening_balance$$", fmt.Sprintf("%.2f", s.OpeningBalance), 1)
+	html = strings.Replace(html, "$$statement_debit$$", fmt.Sprintf("%.2f", s.Debit), 1)
+	html = strings.Replace(html, "$$statement_credit$$", fmt.Sprintf("%.2f", s.Credit), 1)
+	html = strings.Replace(html, "$$statement_closing_balance$$", fmt.Sprintf("%.2f", s.ClosingBalance), 1)
+	if forcePrint {
+		html = strings.Replace(html, "$$script$$", "window.print()", 1)
+	} else {
+		html = strings.Replace(html, "$$script$$", "", 1)
+	}
+
+	detailHtmlTemplate := html[strings.Index(html, "&&detail&&")+len("&&detail&&") : strings.Index(html, "&&--detail--&&")]
+	detailsHtml := ""
+
+	for i := 0; i < len(s.Entries); i++ {
+		detailHtml := detailHtmlTemplate
+		entry := s.Entries[i]
+
+		var entryType string
+		switch entry.Type {
+		case "I":
+			entryType = "Invoice"
+		case "A":
+			entryType = "Amending invoice"
+		case "C":
+			entryType = "Charge"
+		case "P":
+			entryType = "Payment"
+		}
+
+		detailHtml = strings.Replace(detailHtml, "$$detail_date$$", entry.Date.Format("2006-01-02"), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_type$$", entryType, 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_document$$", entry.DocumentName, 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_concept$$", entry.Concept, 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_debit$$", fmt.Sprintf("%.2f", entry.Debit), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_credit$$", fmt.Sprintf("%.2f", entry.Credit), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_balance$$", fmt.Sprintf("%.2f", entry.Balance), 1)
+
+		detailsHtml += detailHtml
+	}
+
+	html = html[:strings.Index(html, "&&detail&&")] + detailsHtml + html[strings.Index(html, "&&--detail--&&")+len("&&--detail--&&"):]
+
+	return []byte(html)
+}
+
+func reportAging(forcePrint bool, supplier bool, date *time.Time, enterpriseId int32) []byte {
+	q := AgingReportQuery{Type: "C", Date: date}
+	title := "Customer aging"
+	if supplier {
+		q.Type = "S"
+		title = "Supplier aging"
+	}
+	report := q.getAgingReport(enterpriseId)
+
+	agingDate := time.Now()
+	if date != nil {
+		agingDate = *date
+	}
+
+	template := getReportTemplate(enterpriseId, "AGING")
+
+	html := template.Html
+
+	html = strings.Replace(html, "$$img_base64$$", getEnterpriseLogoBase64(enterpriseId), 1)
+	html = strings.Replace(html, "$$aging_title$$", title, 1)
+	html = strings.Replace(html, "$$aging_date$$", agingDate.Format("2006-01-02"), 1)
+	html = strings.Replace(html, "$$aging_0_30$$", fmt.Sprintf("%.2f", report.Total.Days0To30), 1)
+	html = strings.Replace(html, "$$aging_31_60$$", fmt.Sprintf("%.2f", report.Total.Days31To60), 1)
+	html = strings.Replace(html, "$$aging_61_90$$", fmt.Sprintf("%.2f", report.Total.Days61To90), 1)
+	html = strings.Replace(html, "$$aging_over_90$$", fmt.Sprintf("%.2f", report.Total.DaysOver90), 1)
+	html = strings.Replace(html, "$$aging_total$$", fmt.Sprintf("%.2f", report.Total.Total), 1)
+	if forcePrint {
+		html = strings.Replace(html, "$$script$$", "window.print()", 1)
+	} else {
+		html = strings.Replace(html, "$$script$$", "", 1)
+	}
+
+	detailHtmlTemplate := html[strings.Index(html, "&&detail&&")+len("&&detail&&") : strings.Index(html, "&&--detail--&&")]
+	detailsHtml := ""
+
+	for i := 0; i < len(report.Rows); i++ {
+		detailHtml := detailHtmlTemplate
+		row := report.Rows[i]
+
+		detailHtml = strings.Replace(detailHtml, "$$detail_name$$", row.Name, 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_0_30$$", fmt.Sprintf("%.2f", row.Days0To30), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_31_60$$", fmt.Sprintf("%.2f", row.Days31To60), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_61_90$$", fmt.Sprintf("%.2f", row.Days61To90), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_over_90$$", fmt.Sprintf("%.2f", row.DaysOver90), 1)
+		detailHtml = strings.Replace(detailHtml, "$$detail_total$$", fmt.Sprintf("%.2f", row.Total), 1)
+
+		detailsHtml += detailHtml
+	}
+
+	html = html[:strings.Index(html, "&&detail&&")] + detailsHtml + html[strings.Index(html, "&&--detail--&&")+len("&&--detail--&&"):]
+
+	return []byte(html)
+}
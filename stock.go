@@ -19,11 +19,11 @@ type Stock struct {
 	Product                    Product   `json:"-" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
 	WarehouseId                string    `json:"warehouseId" gorm:"primaryKey;column:warehouse;not null:true;type:character(2)"`
 	Warehouse                  Warehouse `json:"warehouse" gorm:"foreignKey:WarehouseId,EnterpriseId;references:Id,EnterpriseId"`
-	Quantity                   int32     `json:"quantity" gorm:"column:quantity;not null:true"`
-	QuantityPendingReceived    int32     `json:"quantityPendingReceived" gorm:"column:quantity_pending_received;not null:true"`
-	QuantityPendingServed      int32     `json:"quantityPendingServed" gorm:"column:quantity_pending_served;not null:true"`
-	QuantityAvaiable           int32     `json:"quantityAvaiable" gorm:"column:quantity_available;not null:true"`
-	QuantityPendingManufacture int32     `json:"quantityPendingManufacture" gorm:"column:quantity_pending_manufacture;not null:true"`
+	Quantity                   float64   `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
+	QuantityPendingReceived    float64   `json:"quantityPendingReceived" gorm:"type:numeric(14,6);column:quantity_pending_received;not null:true"`
+	QuantityPendingServed      float64   `json:"quantityPendingServed" gorm:"type:numeric(14,6);column:quantity_pending_served;not null:true"`
+	QuantityAvaiable           float64   `json:"quantityAvaiable" gorm:"type:numeric(14,6);column:quantity_available;not null:true"`
+	QuantityPendingManufacture float64   `json:"quantityPendingManufacture" gorm:"type:numeric(14,6);column:quantity_pending_manufacture;not null:true"`
 	EnterpriseId               int32     `json:"-" gorm:"primaryKey;column:enterprise;not null:true"`
 	Enterprise                 Settings  `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 }
@@ -83,7 +83,7 @@ func createStockRow(productId int32, warehouseId string, enterpriseId int32, tra
 // This function will do this operation inversely if the parameter quantity is a negative number.
 // Creates the stock row if it doesn't exists.
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION
-func addQuantityPendingServing(productId int32, warehouseId string, quantity int32, enterpriseId int32, trans gorm.DB) bool {
+func addQuantityPendingServing(productId int32, warehouseId string, quantity float64, enterpriseId int32, trans gorm.DB) bool {
 	var stockRowCount int64
 	var stock Stock
 	result := trans.Model(&Stock{}).Where("product = ? AND warehouse = ? AND enterprise = ?", productId, warehouseId, enterpriseId).Count(&stockRowCount).First(&stock)
@@ -100,8 +100,8 @@ func addQuantityPendingServing(productId int32, warehouseId string, quantity int
 		return false
 	}
 
-	stock.QuantityPendingServed += quantity
-	stock.QuantityAvaiable = stock.Quantity + stock.QuantityPendingReceived - stock.QuantityPendingServed + stock.QuantityPendingManufacture
+	stock.QuantityPendingServed = roundQuantity(stock.QuantityPendingServed + quantity)
+	stock.QuantityAvaiable = roundQuantity(stock.Quantity + stock.QuantityPendingReceived - stock.QuantityPendingServed + stock.QuantityPendingManufacture)
 
 	result = trans.Save(&stock)
 	if result.Error != nil {
@@ -118,7 +118,7 @@ func addQuantityPendingServing(productId int32, warehouseId string, quantity int
 // This function will do this operation inversely if the parameter quantity is a negative number.
 // Creates the stock row if it doesn't exists.
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION
-func addQuantityPendingReveiving(productId int32, warehouseId string, quantity int32, enterpriseId int32, trans gorm.DB) bool {
+func addQuantityPendingReveiving(productId int32, warehouseId string, quantity float64, enterpriseId int32, trans gorm.DB) bool {
 	var stockRowCount int64
 	var stock Stock
 	result := trans.Model(&Stock{}).Where("product = ? AND warehouse = ? AND enterprise = ?", productId, warehouseId, enterpriseId).Count(&stockRowCount).First(&stock)
@@ -135,8 +135,8 @@ func addQuantityPendingReveiving(productId int32, warehouseId string, quantity i
 		return false
 	}
 
-	stock.QuantityPendingReceived += quantity
-	stock.QuantityAvaiable = stock.Quantity + stock.QuantityPendingReceived - stock.QuantityPendingServed + stock.QuantityPendingManufacture
+	stock.QuantityPendingReceived = roundQuantity(stock.QuantityPendingReceived + quantity)
+	stock.QuantityAvaiable = roundQuantity(stock.Quantity + stock.QuantityPendingReceived - stock.QuantityPendingServed + stock.QuantityPendingManufacture)
 
 	result = trans.Save(&stock)
 	if result.Error != nil {
@@ -153,7 +153,7 @@ func addQuantityPendingReveiving(productId int32, warehouseId string, quantity i
 // This function will do this operation inversely if the parameter quantity is a negative number.
 // Creates the stock row if it doesn't exists.
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION
-func addQuantityPendingManufacture(productId int32, warehouseId string, quantity int32, enterpriseId int32, trans gorm.DB) bool {
+func addQuantityPendingManufacture(productId int32, warehouseId string, quantity float64, enterpriseId int32, trans gorm.DB) bool {
 	var stockRowCount int64
 	var stock Stock
 	result := trans.Model(&Stock{}).Where("product = ? AND warehouse = ? AND enterprise = ?", productId, warehouseId, enterpriseId).Count(&stockRowCount).First(&stock)
@@ -170,8 +170,8 @@ func addQuantityPendingManufacture(productId int32, warehouseId string, quantity
 		return false
 	}
 
-	stock.QuantityPendingManufacture += quantity
-	stock.QuantityAvaiable = stock.Quantity + stock.QuantityPendingReceived - stock.QuantityPendingServed + stock.QuantityPendingManufacture
+	stock.QuantityPendingManufacture = roundQuantity(stock.QuantityPendingManufacture + quantity)
+	stock.QuantityAvaiable = roundQuantity(stock.Quantity + stock.QuantityPendingReceived - stock.QuantityPendingServed + stock.QuantityPendingManufacture)
 
 	result = trans.Save(&stock)
 	if result.Error != nil {
@@ -187,7 +187,7 @@ func addQuantityPendingManufacture(productId int32, warehouseId string, quantity
 // This function will do this operation inversely if the parameter quantity is a negative number.
 // Creates the stock row if it doesn't exists.
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION
-func addQuantityStock(productId int32, warehouseId string, quantity int32, enterpriseId int32, trans gorm.DB) bool {
+func addQuantityStock(productId int32, warehouseId string, quantity float64, enterpriseId int32, trans gorm.DB) bool {
 	productRow := getProductRow(productId)
 	if productRow.EnterpriseId != enterpriseId {
 		return false
@@ -212,8 +212,8 @@ func addQuantityStock(productId int32, warehouseId string, quantity int32, enter
 		return false
 	}
 
-	stock.Quantity += quantity
-	stock.QuantityAvaiable = stock.Quantity + stock.QuantityPendingReceived - stock.QuantityPendingServed + stock.QuantityPendingManufacture
+	stock.Quantity = roundQuantity(stock.Quantity + quantity)
+	stock.QuantityAvaiable = roundQuantity(stock.Quantity + stock.QuantityPendingReceived - stock.QuantityPendingServed + stock.QuantityPendingManufacture)
 
 	result = trans.Save(&stock)
 	if result.Error != nil {
@@ -228,7 +228,7 @@ func addQuantityStock(productId int32, warehouseId string, quantity int32, enter
 // Sets an amount to the stock column on the stock row for this product.
 // Creates the stock row if it doesn't exists.
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION
-func setQuantityStock(productId int32, warehouseId string, quantity int32, enterpriseId int32, trans gorm.DB) bool {
+func setQuantityStock(productId int32, warehouseId string, quantity float64, enterpriseId int32, trans gorm.DB) bool {
 	productRow := getProductRow(productId)
 	if productRow.EnterpriseId != enterpriseId {
 		return false
@@ -253,8 +253,8 @@ func setQuantityStock(productId int32, warehouseId string, quantity int32, enter
 		return false
 	}
 
-	stock.Quantity = quantity
-	stock.QuantityAvaiable = stock.Quantity + stock.QuantityPendingReceived - stock.QuantityPendingServed + stock.QuantityPendingManufacture
+	stock.Quantity = roundQuantity(quantity)
+	stock.QuantityAvaiable = roundQuantity(stock.Quantity + stock.QuantityPendingReceived - stock.QuantityPendingServed + stock.QuantityPendingManufacture)
 
 	result = trans.Save(&stock)
 	if result.Error != nil {
@@ -277,7 +277,7 @@ func setQuantityAvailable(productId int32, warehouseId string, enterpriseId int3
 		return false
 	}
 
-	stock.QuantityAvaiable = stock.Quantity + stock.QuantityPendingReceived - stock.QuantityPendingServed + stock.QuantityPendingManufacture
+	stock.QuantityAvaiable = roundQuantity(stock.Quantity + stock.QuantityPendingReceived - stock.QuantityPendingServed + stock.QuantityPendingManufacture)
 
 	result = trans.Save(&stock)
 	if result.Error != nil {
@@ -292,8 +292,8 @@ func setQuantityAvailable(productId int32, warehouseId string, enterpriseId int3
 // Sets the "stock" field on the product row, sum of the stocks in all the warehouses.
 // THIS FUNCTION DOES NOT OPEN A TRANSACTION
 func setProductStockAllWarehouses(productId int32, trans gorm.DB) bool {
-	var quantity int32
-	result := trans.Model(&Stock{}).Where("product = ?", productId).Select("SUM(quantity) as quantity").Scan(&quantity)
+	var quantity float64
+	result := trans.Model(&Stock{}).Where("product = ?", productId).Select("COALESCE(SUM(quantity),0) as quantity").Scan(&quantity)
 	if result.Error != nil {
 		log("DB", result.Error.Error())
 		trans.Rollback()
@@ -331,20 +331,20 @@ func regenerateStockRecords(enterpriseId int32) bool {
 			}
 
 			if warehouseMovement.Type != "R" {
-				stock.Quantity = warehouseMovement.DraggedStock + warehouseMovement.Quantity
+				stock.Quantity = roundQuantity(warehouseMovement.DraggedStock + warehouseMovement.Quantity)
 			} else { // Inventory regularization
 				stock.Quantity = warehouseMovement.DraggedStock
 			}
 
 			// set the quantity pending serving
-			result = dbOrm.Model(&SalesOrderDetail{}).Where("product = ? AND warehouse = ? AND enterprise = ? AND quantity != quantity_delivery_note", product.Id, warehouse.Id, enterpriseId).Select("SUM(quantity) as quantity").Scan(&stock.QuantityPendingServed)
+			result = dbOrm.Model(&SalesOrderDetail{}).Where("product = ? AND warehouse = ? AND enterprise = ? AND quantity != quantity_delivery_note AND NOT drop_shipping", product.Id, warehouse.Id, enterpriseId).Select("SUM(quantity) as quantity").Scan(&stock.QuantityPendingServed)
 			if result.Error != nil {
 				log("DB", result.Error.Error())
 				return false
 			}
 
 			// set the quantity pending receiving
-			result = dbOrm.Model(&PurchaseOrderDetail{}).Where("product = ? AND warehouse = ? AND enterprise = ? AND quantity != quantity_delivery_note", product.Id, warehouse.Id, enterpriseId).Select("SUM(quantity) as quantity").Scan(&stock.QuantityPendingReceived)
+			result = dbOrm.Model(&PurchaseOrderDetail{}).Where("product = ? AND warehouse = ? AND enterprise = ? AND quantity != quantity_delivery_note AND NOT (SELECT drop_shipping FROM purchase_order WHERE purchase_order.id=purchase_order_detail.\"order\")", product.Id, warehouse.Id, enterpriseId).Select("SUM(quantity) as quantity").Scan(&stock.QuantityPendingReceived)
 			if result.Error != nil {
 				log("DB", result.Error.Error())
 				return false
@@ -357,7 +357,7 @@ func regenerateStockRecords(enterpriseId int32) bool {
 				log("DB", result.Error.Error())
 				return false
 			}
-			stock.QuantityPendingManufacture = int32(quantityPendingManufacture)
+			stock.QuantityPendingManufacture = float64(quantityPendingManufacture)
 
 			// set the quantity available
 			trans := dbOrm.Begin()
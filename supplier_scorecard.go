@@ -0,0 +1,150 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+type SupplierScorecardQuery struct {
+	DateStart *time.Time `json:"dateStart"` // Date of the purchase orders
+	DateEnd   *time.Time `json:"dateEnd"`
+	FamilyId  *int32     `json:"familyId"` // Only the lines of the products of this family
+}
+
+// Performance of a supplier in the purchase orders of the period.
+// The rates are percentages, and are zero if there are no lines to measure them.
+type SupplierScorecard struct {
+	SupplierId       int32   `json:"supplierId"`
+	SupplierName     string  `json:"supplierName"`
+	Lines            int32   `json:"lines"`            // Purchase order lines in the period
+	LinesPromised    int32   `json:"linesPromised"`    // Lines with a promised delivery date that have been received
+	LinesOnTime      int32   `json:"linesOnTime"`      // Lines received completely on or before the promised date
+	OnTimeRate       float64 `json:"onTimeRate"`       // Lines on time / lines promised
+	LinesReceived    int32   `json:"linesReceived"`    // Lines with at least one receipt
+	LinesExact       int32   `json:"linesExact"`       // Lines where the quantity received is the quantity ordered
+	QuantityAccuracy float64 `json:"quantityAccuracy"` // Lines exact / lines received
+	QuantityOrdered  float64 `json:"quantityOrdered"`
+	QuantityReceived float64 `json:"quantityReceived"`
+	AmountOrdered    float64 `json:"amountOrdered"`  // Quantity invoiced * price of the purchase order
+	AmountInvoiced   float64 `json:"amountInvoiced"` // Quantity invoiced * price of the purchase invoice
+	PriceVariance    float64 `json:"priceVariance"`  // (Amount invoiced - amount ordered) / amount ordered, positive if the supplier invoiced more than ordered
+	QuantityReturned float64 `json:"quantityReturned"`
+	RejectionRate    float64 `json:"rejectionRate"` // Quantity returned / quantity received
+}
+
+// A purchase order line with its receipts, invoices and returns, used to compute the scorecard.
+type SupplierScorecardLine struct {
+	SupplierId       int32
+	SupplierName     string
+	Quantity         float64
+	Price            float64
+	DatePromised     *time.Time
+	QuantityReceived float64
+	DateLastReceived *time.Time
+	QuantityInvoiced float64
+	AmountInvoiced   float64
+	QuantityReturned float64
+}
+
+// Returns the scorecard of every supplier with purchase orders in the period, sorted by supplier name.
+// The returns are the outbound warehouse movements of the product in the purchase delivery notes where the line was received.
+func (q *SupplierScorecardQuery) getSupplierScorecard(enterpriseId int32) []SupplierScorecard {
+	sqlStatement := `SELECT purchase_order.supplier,suppliers.name,purchase_order_detail.quantity,purchase_order_detail.price,COALESCE(purchase_order_detail.date_promised,purchase_order.date_promised),
+	(SELECT COALESCE(SUM(warehouse_movement.quantity),0) FROM warehouse_movement WHERE warehouse_movement.purchase_order_detail=purchase_order_detail.id AND warehouse_movement.type='I'),
+	(SELECT MAX(purchase_delivery_note.date_created) FROM warehouse_movement INNER JOIN purchase_delivery_note ON purchase_delivery_note.id=warehouse_movement.purchase_delivery_note WHERE warehouse_movement.purchase_order_detail=purchase_order_detail.id AND warehouse_movement.type='I'),
+	(SELECT COALESCE(SUM(purchase_invoice_details.quantity),0) FROM purchase_invoice_details WHERE purchase_invoice_details.order_detail=purchase_order_detail.id),
+	(SELECT COALESCE(SUM(purchase_invoice_details.price*purchase_invoice_details.quantity),0) FROM purchase_invoice_details WHERE purchase_invoice_details.order_detail=purchase_order_detail.id),
+	(SELECT COALESCE(SUM(ABS(returned.quantity)),0) FROM warehouse_movement returned WHERE returned.type='O' AND returned.product=purchase_order_detail.product AND returned.purchase_delivery_note IN (SELECT warehouse_movement.purchase_delivery_note FROM warehouse_movement WHERE warehouse_movement.purchase_order_detail=purchase_order_detail.id))
+	FROM purchase_order_detail INNER JOIN purchase_order ON purchase_order.id=purchase_order_detail.order INNER JOIN suppliers ON suppliers.id=purchase_order.supplier INNER JOIN product ON product.id=purchase_order_detail.product
+	WHERE purchase_order_detail.enterprise=$1 AND NOT purchase_order_detail.cancelled AND NOT purchase_order.cancelled AND ($2::timestamp with time zone IS NULL OR purchase_order.date_created>=$2) AND ($3::timestamp with time zone IS NULL OR purchase_order.date_created<=$3) AND ($4::integer IS NULL OR product.family=$4)`
+	rows, err := db.Query(sqlStatement, enterpriseId, q.DateStart, q.DateEnd, q.FamilyId)
+	if err != nil {
+		log("DB", err.Error())
+		return make([]SupplierScorecard, 0)
+	}
+	defer rows.Close()
+
+	lines := make([]SupplierScorecardLine, 0)
+	for rows.Next() {
+		l := SupplierScorecardLine{}
+		rows.Scan(&l.SupplierId, &l.SupplierName, &l.Quantity, &l.Price, &l.DatePromised, &l.QuantityReceived, &l.DateLastReceived, &l.QuantityInvoiced, &l.AmountInvoiced, &l.QuantityReturned)
+		lines = append(lines, l)
+	}
+
+	return computeSupplierScorecard(lines)
+}
+
+func computeSupplierScorecard(lines []SupplierScorecardLine) []SupplierScorecard {
+	scorecards := make([]SupplierScorecard, 0)
+	index := make(map[int32]int) // Key: supplier ID, Value: position in the scorecards
+
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		j, ok := index[l.SupplierId]
+		if !ok {
+			j = len(scorecards)
+			index[l.SupplierId] = j
+			scorecards = append(scorecards, SupplierScorecard{SupplierId: l.SupplierId, SupplierName: l.SupplierName})
+		}
+		s := &scorecards[j]
+
+		s.Lines++
+		s.QuantityOrdered = roundQuantity(s.QuantityOrdered + l.Quantity)
+		s.QuantityReceived = roundQuantity(s.QuantityReceived + l.QuantityReceived)
+		s.QuantityReturned = roundQuantity(s.QuantityReturned + l.QuantityReturned)
+		s.AmountOrdered += l.Price * l.QuantityInvoiced
+		s.AmountInvoiced += l.AmountInvoiced
+
+		if l.QuantityReceived > 0 {
+			s.LinesReceived++
+			if l.QuantityReceived == l.Quantity {
+				s.LinesExact++
+			}
+		}
+		// a line is late if it has not been received completely before the promised date
+		if l.DatePromised != nil && l.QuantityReceived >= l.Quantity && l.DateLastReceived != nil {
+			s.LinesPromised++
+			received := l.DateLastReceived.In(l.DatePromised.Location())
+			if !truncateDate(received).After(truncateDate(*l.DatePromised)) {
+				s.LinesOnTime++
+			}
+		}
+	}
+
+	for i := 0; i < len(scorecards); i++ {
+		s := &scorecards[i]
+		if s.LinesPromised > 0 {
+			s.OnTimeRate = toFixed(float64(s.LinesOnTime)/float64(s.LinesPromised)*100, 2)
+		}
+		if s.LinesReceived > 0 {
+			s.QuantityAccuracy = toFixed(float64(s.LinesExact)/float64(s.LinesReceived)*100, 2)
+		}
+		if s.AmountOrdered > 0 {
+			s.PriceVariance = toFixed((s.AmountInvoiced-s.AmountOrdered)/s.AmountOrdered*100, 2)
+		}
+		if s.QuantityReceived > 0 {
+			s.RejectionRate = toFixed(s.QuantityReturned/s.QuantityReceived*100, 2)
+		}
+		s.AmountOrdered = toFixed(s.AmountOrdered, 2)
+		s.AmountInvoiced = toFixed(s.AmountInvoiced, 2)
+	}
+
+	sort.Slice(scorecards, func(i, j int) bool {
+		return scorecards[i].SupplierName < scorecards[j].SupplierName
+	})
+	return scorecards
+}
+
+func truncateDate(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+}
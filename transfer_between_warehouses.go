@@ -13,6 +13,7 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"math"
 	"time"
 
 	"gorm.io/gorm"
@@ -155,8 +156,8 @@ type TransferBetweenWarehousesDetail struct {
 	Enterprise                  Settings                  `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 	ProductId                   int32                     `json:"productId" gorm:"column:product;type:integer;not null;index:transfer_between_warehouses_detail_barcode,priority:3,where:quantity_transferred < quantity"`
 	Product                     Product                   `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
-	Quantity                    int32                     `json:"quantity" gorm:"column:quantity;type:integer;not null"`
-	QuantityTransferred         int32                     `json:"quantityTransferred" gorm:"column:quantity_transferred;type:integer;not null"`
+	Quantity                    float64                   `json:"quantity" gorm:"column:quantity;type:numeric(14,6);not null"`
+	QuantityTransferred         float64                   `json:"quantityTransferred" gorm:"column:quantity_transferred;type:numeric(14,6);not null"`
 	Finished                    bool                      `json:"finished" gorm:"column:finished;type:boolean;not null"`
 	WarehouseMovementOutId      *int64                    `json:"warehouseMovementOutId" gorm:"column:warehouse_movement_out;type:bigint"`
 	WarehouseMovementOut        *WarehouseMovement        `json:"warehouseMovementOut" gorm:"foreignKey:WarehouseMovementOutId,EnterpriseId;references:Id,EnterpriseId"`
@@ -164,6 +165,10 @@ type TransferBetweenWarehousesDetail struct {
 	WarehouseMovementIn         *WarehouseMovement        `json:"warehouseMovementIn" gorm:"foreignKey:WarehouseMovementInId,EnterpriseId;references:Id,EnterpriseId"`
 	SalesOrderDetailId          *int64                    `json:"salesOrderDetailId" gorm:"column:sales_order_detail;type:bigint"`
 	SalesOrderDetail            *SalesOrderDetail         `json:"-" gorm:"foreignKey:SalesOrderDetailId,EnterpriseId;references:Id,EnterpriseId"`
+	LocationOriginId            *int32                    `json:"locationOriginId" gorm:"column:location_origin;type:integer"`
+	LocationOrigin              *WarehouseLocation        `json:"locationOrigin" gorm:"foreignKey:LocationOriginId,EnterpriseId;references:Id,EnterpriseId"`
+	LocationDestinationId       *int32                    `json:"locationDestinationId" gorm:"column:location_destination;type:integer"`
+	LocationDestination         *WarehouseLocation        `json:"locationDestination" gorm:"foreignKey:LocationDestinationId,EnterpriseId;references:Id,EnterpriseId"`
 }
 
 func (t *TransferBetweenWarehousesDetail) TableName() string {
@@ -201,6 +206,7 @@ func (d *TransferBetweenWarehousesDetail) BeforeCreate(tx *gorm.DB) (err error)
 }
 
 func (d *TransferBetweenWarehousesDetail) insertTransferBetweenWarehousesDetail() bool {
+	d.Quantity = roundProductQuantity(d.ProductId, d.Quantity)
 	if !d.isValid() {
 		return false
 	}
@@ -296,6 +302,9 @@ func (d *TransferBetweenWarehousesDetail) deleteTransferBetweenWarehousesDetail(
 type TransferBetweenWarehousesDetailBarCodeQuery struct {
 	TransferBetweenWarehousesId int64  `json:"transferBetweenWarehousesId"`
 	BarCode                     string `json:"barCode"`
+	SerialNumber                string `json:"serialNumber"`               // Unit scanned, only for products with serial number tracking
+	LocationOriginBarCode       string `json:"locationOriginBarCode"`      // Location where the product is taken from in the origin warehouse
+	LocationDestinationBarCode  string `json:"locationDestinationBarCode"` // Location where the product is put away in the destination warehouse
 }
 
 func (q *TransferBetweenWarehousesDetailBarCodeQuery) isValid() bool {
@@ -315,13 +324,18 @@ func (detail *TransferBetweenWarehousesDetail) finishDetail(trans *gorm.DB, user
 		transfer.DateFinished = nil
 	}
 
+	// the units with serial number scanned in the transfer
+	serialNumbers := getSerialNumbersAssigned("transfer_between_warehouses_detail", detail.Id, detail.EnterpriseId, trans)
+
 	// make an output warehouse movement from the origin warehouse
 	wmOut := WarehouseMovement{
-		WarehouseId:  transfer.WarehouseOriginId,
-		ProductId:    detail.ProductId,
-		Quantity:     detail.Quantity,
-		Type:         "O",
-		EnterpriseId: detail.EnterpriseId,
+		WarehouseId:   transfer.WarehouseOriginId,
+		ProductId:     detail.ProductId,
+		Quantity:      detail.Quantity,
+		Type:          "O",
+		EnterpriseId:  detail.EnterpriseId,
+		SerialNumbers: serialNumbers,
+		LocationId:    detail.LocationOriginId,
 	}
 	if !wmOut.insertWarehouseMovement(userId, trans) {
 		trans.Rollback()
@@ -330,16 +344,22 @@ func (detail *TransferBetweenWarehousesDetail) finishDetail(trans *gorm.DB, user
 
 	// make an input warehouse movement to the destination warehouse
 	wmIn := WarehouseMovement{
-		WarehouseId:  transfer.WarehouseDestinationId,
-		ProductId:    detail.ProductId,
-		Quantity:     detail.Quantity,
-		Type:         "I",
-		EnterpriseId: detail.EnterpriseId,
+		WarehouseId:   transfer.WarehouseDestinationId,
+		ProductId:     detail.ProductId,
+		Quantity:      detail.Quantity,
+		Type:          "I",
+		EnterpriseId:  detail.EnterpriseId,
+		SerialNumbers: serialNumbers,
+		LocationId:    detail.LocationDestinationId,
+		CostAmount:    -wmOut.CostAmount, // the stock enters the destination warehouse at the cost it has left the origin warehouse
 	}
 	if !wmIn.insertWarehouseMovement(userId, trans) {
 		trans.Rollback()
 		return false
 	}
+	if !transferWarehouseMovementLots(&wmOut, &wmIn, *trans) {
+		return false
+	}
 
 	// save the transfer detail
 	detail.WarehouseMovementOutId = &wmOut.Id
@@ -403,7 +423,19 @@ func (q *TransferBetweenWarehousesDetailBarCodeQuery) transferBetweenWarehousesD
 	}
 	///
 
-	detail.QuantityTransferred += 1
+	if len(q.SerialNumber) > 0 {
+		ok := assignTransferSerialNumbers(&detail, []string{q.SerialNumber}, *trans)
+		if !ok {
+			return false
+		}
+	}
+	if !detail.setTransferLocations(q.LocationOriginBarCode, q.LocationDestinationBarCode) {
+		trans.Rollback()
+		return false
+	}
+
+	// each scan is one unit, the last scan completes the quantity if it's not a whole number
+	detail.QuantityTransferred = math.Min(roundQuantity(detail.QuantityTransferred+1), detail.Quantity)
 	detail.Finished = detail.QuantityTransferred == detail.Quantity
 
 	if detail.Finished {
@@ -413,7 +445,11 @@ func (q *TransferBetweenWarehousesDetailBarCodeQuery) transferBetweenWarehousesD
 			return false
 		}
 	} else {
-		result := trans.Model(&TransferBetweenWarehousesDetail{}).Where("id = ?", detail.Id).Update("quantity_transferred", detail.QuantityTransferred)
+		result := trans.Model(&TransferBetweenWarehousesDetail{}).Where("id = ?", detail.Id).Updates(map[string]interface{}{
+			"quantity_transferred": detail.QuantityTransferred,
+			"location_origin":      detail.LocationOriginId,
+			"location_destination": detail.LocationDestinationId,
+		})
 		if result.Error != nil {
 			log("DB", result.Error.Error())
 			trans.Rollback()
@@ -428,12 +464,15 @@ func (q *TransferBetweenWarehousesDetailBarCodeQuery) transferBetweenWarehousesD
 }
 
 type TransferBetweenWarehousesDetailQuantityQuery struct {
-	TransferBetweenWarehousesDetailId int64 `json:"transferBetweenWarehousesDetailId"`
-	Quantity                          int32 `json:"quantity"`
+	TransferBetweenWarehousesDetailId int64    `json:"transferBetweenWarehousesDetailId"`
+	Quantity                          float64  `json:"quantity"`
+	SerialNumbers                     []string `json:"serialNumbers"`              // Units transferred, only for products with serial number tracking
+	LocationOriginBarCode             string   `json:"locationOriginBarCode"`      // Location where the product is taken from in the origin warehouse
+	LocationDestinationBarCode        string   `json:"locationDestinationBarCode"` // Location where the product is put away in the destination warehouse
 }
 
 func (q *TransferBetweenWarehousesDetailQuantityQuery) isValid() bool {
-	return !(q.TransferBetweenWarehousesDetailId <= 0 || q.Quantity <= 0)
+	return !(q.TransferBetweenWarehousesDetailId <= 0 || q.Quantity <= 0 || len(q.SerialNumbers) > int(q.Quantity))
 }
 
 func (q *TransferBetweenWarehousesDetailQuantityQuery) transferBetweenWarehousesDetailQuantity(enterpriseId int32, userId int32) bool {
@@ -442,7 +481,7 @@ func (q *TransferBetweenWarehousesDetailQuantityQuery) transferBetweenWarehouses
 	}
 
 	detail := getTransferBetweenWarehousesDetailRow(q.TransferBetweenWarehousesDetailId)
-	if detail.Id <= 0 || detail.EnterpriseId != enterpriseId || detail.QuantityTransferred+q.Quantity > detail.Quantity {
+	if detail.Id <= 0 || detail.EnterpriseId != enterpriseId || roundQuantity(detail.QuantityTransferred+q.Quantity) > detail.Quantity {
 		return false
 	}
 
@@ -453,7 +492,18 @@ func (q *TransferBetweenWarehousesDetailQuantityQuery) transferBetweenWarehouses
 	}
 	///
 
-	detail.QuantityTransferred += q.Quantity
+	if len(q.SerialNumbers) > 0 {
+		ok := assignTransferSerialNumbers(&detail, q.SerialNumbers, *trans)
+		if !ok {
+			return false
+		}
+	}
+	if !detail.setTransferLocations(q.LocationOriginBarCode, q.LocationDestinationBarCode) {
+		trans.Rollback()
+		return false
+	}
+
+	detail.QuantityTransferred = roundQuantity(detail.QuantityTransferred + q.Quantity)
 	detail.Finished = detail.QuantityTransferred == detail.Quantity
 
 	if detail.Finished {
@@ -463,7 +513,11 @@ func (q *TransferBetweenWarehousesDetailQuantityQuery) transferBetweenWarehouses
 			return false
 		}
 	} else {
-		result := trans.Model(&TransferBetweenWarehousesDetail{}).Where("id = ?", q.TransferBetweenWarehousesDetailId).Update("quantity_transferred", detail.QuantityTransferred)
+		result := trans.Model(&TransferBetweenWarehousesDetail{}).Where("id = ?", q.TransferBetweenWarehousesDetailId).Updates(map[string]interface{}{
+			"quantity_transferred": detail.QuantityTransferred,
+			"location_origin":      detail.LocationOriginId,
+			"location_destination": detail.LocationDestinationId,
+		})
 		if result.Error != nil {
 			log("DB", result.Error.Error())
 			trans.Rollback()
@@ -477,6 +531,41 @@ func (q *TransferBetweenWarehousesDetailQuantityQuery) transferBetweenWarehouses
 	///
 }
 
+// Assigns the units scanned to the transfer detail, the units leave the origin warehouse when the detail is finished.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func assignTransferSerialNumbers(detail *TransferBetweenWarehousesDetail, serialNumbers []string, trans gorm.DB) bool {
+	if !getProductRow(detail.ProductId).TrackSerials {
+		trans.Rollback()
+		return false
+	}
+	transfer := getTransferBetweenWarehousesRow(detail.TransferBetweenWarehousesId)
+	return assignSerialNumbers(detail.ProductId, transfer.WarehouseOriginId, cleanSerialNumbers(serialNumbers), map[string]interface{}{"transfer_between_warehouses_detail": detail.Id}, "transfer_between_warehouses_detail", detail.EnterpriseId, trans)
+}
+
+// Sets the locations scanned in the origin and the destination warehouses, the locations that are not scanned are left as they are.
+func (detail *TransferBetweenWarehousesDetail) setTransferLocations(originBarCode string, destinationBarCode string) bool {
+	if len(originBarCode) == 0 && len(destinationBarCode) == 0 {
+		return true
+	}
+	transfer := getTransferBetweenWarehousesRow(detail.TransferBetweenWarehousesId)
+
+	if len(originBarCode) > 0 {
+		location := getWarehouseLocationByBarCode(transfer.WarehouseOriginId, originBarCode, detail.EnterpriseId)
+		if location.Id <= 0 {
+			return false
+		}
+		detail.LocationOriginId = &location.Id
+	}
+	if len(destinationBarCode) > 0 {
+		location := getWarehouseLocationByBarCode(transfer.WarehouseDestinationId, destinationBarCode, detail.EnterpriseId)
+		if location.Id <= 0 {
+			return false
+		}
+		detail.LocationDestinationId = &location.Id
+	}
+	return true
+}
+
 func getTransferBetweenWarehousesWarehouseMovements(transferBetweenWarehousesId int64, enterpriseId int32) []WarehouseMovement {
 	var movements []WarehouseMovement = make([]WarehouseMovement, 0)
 	if transferBetweenWarehousesId <= 0 {
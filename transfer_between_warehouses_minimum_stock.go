@@ -11,6 +11,8 @@ You should have received a copy of the GNU Affero General Public License along w
 package main
 
 import (
+	"math"
+
 	"gorm.io/gorm/clause"
 )
 
@@ -20,7 +22,7 @@ type TransferBetweenWarehousesMinimumStock struct {
 	Product                      Product    `json:"-" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
 	WarehouseDestinationId       string     `json:"warehouseDestinationId" gorm:"column:warehouse_destination;type:character(2);not null"`
 	WarehouseDestination         Warehouse  `json:"warehouseDestination" gorm:"foreignKey:WarehouseDestinationId,EnterpriseId;references:Id,EnterpriseId"`
-	Quantity                     int32      `json:"quantity" gorm:"column:quantity;type:integer;not null:true"`
+	Quantity                     float64    `json:"quantity" gorm:"column:quantity;type:numeric(14,6);not null:true"`
 	OriginWarehouseWithMoreStock bool       `json:"originWarehouseWithMoreStock" gorm:"column:origin_warehouse_with_more_stock;type:boolean;not null"`
 	WarehouseOriginId            *string    `json:"warehouseOriginId" gorm:"column:warehouse_origin;type:character(2)"` // only different from null when the "originWarehouseWithMoreStock" field is false
 	WarehouseOrigin              *Warehouse `json:"warehouseOrigin" gorm:"foreignKey:WarehouseOriginId,EnterpriseId;references:Id,EnterpriseId"`
@@ -186,7 +188,7 @@ func generateTransferBetweenWarehousesForMinimumStock(enterpriseId int32) bool {
 			TransferBetweenWarehousesId: transfersBetweenWarehouses[transferBetweenWarehousesMinimumStock.WarehouseDestinationId].Id,
 			EnterpriseId:                enterpriseId,
 			ProductId:                   transferBetweenWarehousesMinimumStock.ProductId,
-			Quantity:                    minInt32(transferBetweenWarehousesMinimumStock.Quantity, getStockRow(transferBetweenWarehousesMinimumStock.ProductId, warehouse, enterpriseId).QuantityAvaiable),
+			Quantity:                    math.Min(transferBetweenWarehousesMinimumStock.Quantity, getStockRow(transferBetweenWarehousesMinimumStock.ProductId, warehouse, enterpriseId).QuantityAvaiable),
 		}
 
 		ok = transferBetweenWarehousesDetail.insertTransferBetweenWarehousesDetail()
@@ -0,0 +1,812 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// THIS FILE CONTAINS THE EXPORT OF THE SALES INVOICES AND THE IMPORT OF THE PURCHASE INVOICES IN THE UBL 2.1 FORMAT, USING THE PEPPOL BIS BILLING 3.0 RULES.
+
+const UBL_INVOICE_NAMESPACE = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+const UBL_CREDIT_NOTE_NAMESPACE = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+const UBL_CAC_NAMESPACE = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+const UBL_CBC_NAMESPACE = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+const PEPPOL_CUSTOMIZATION_ID = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0"
+const PEPPOL_PROFILE_ID = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+
+// Electronic Address Scheme (EAS) of the VAT numbers of each country, used as the PEPPOL endpoint of the parties.
+var peppolVatEndpointSchemes map[string]string = map[string]string{
+	"AT": "9914", "BE": "9925", "BG": "9926", "CY": "9928", "CZ": "9929", "DE": "9930", "EE": "9931", "ES": "9920", "FR": "9957", "GB": "9932", "GR": "9933", "HR": "9934", "HU": "9910",
+	"IE": "9935", "IT": "0211", "LT": "9937", "LU": "9938", "LV": "9939", "MT": "9943", "NL": "9944", "PL": "9945", "PT": "9946", "RO": "9947", "SI": "9949", "SK": "9950",
+}
+
+type UBLInvoice struct {
+	XMLName                 xml.Name
+	Xmlns                   string               `xml:"xmlns,attr"`
+	XmlnsCac                string               `xml:"xmlns:cac,attr"`
+	XmlnsCbc                string               `xml:"xmlns:cbc,attr"`
+	CustomizationID         string               `xml:"cbc:CustomizationID"`
+	ProfileID               string               `xml:"cbc:ProfileID"`
+	ID                      string               `xml:"cbc:ID"`
+	IssueDate               string               `xml:"cbc:IssueDate"`
+	DueDate                 string               `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode         string               `xml:"cbc:InvoiceTypeCode,omitempty"`    // 380 = Commercial invoice
+	CreditNoteTypeCode      string               `xml:"cbc:CreditNoteTypeCode,omitempty"` // 381 = Credit note
+	DocumentCurrencyCode    string               `xml:"cbc:DocumentCurrencyCode"`
+	BuyerReference          string               `xml:"cbc:BuyerReference"`
+	BillingReference        *UBLBillingReference `xml:"cac:BillingReference,omitempty"`
+	AccountingSupplierParty UBLParty             `xml:"cac:AccountingSupplierParty>cac:Party"`
+	AccountingCustomerParty UBLParty             `xml:"cac:AccountingCustomerParty>cac:Party"`
+	PaymentTerms            *string              `xml:"cac:PaymentTerms>cbc:Note,omitempty"`
+	AllowanceCharge         []UBLAllowanceCharge `xml:"cac:AllowanceCharge"`
+	TaxTotal                UBLTaxTotal          `xml:"cac:TaxTotal"`
+	LegalMonetaryTotal      UBLMonetaryTotal     `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLine             []UBLLine            `xml:"cac:InvoiceLine"`
+	CreditNoteLine          []UBLLine            `xml:"cac:CreditNoteLine"`
+}
+
+type UBLBillingReference struct {
+	ID        string `xml:"cac:InvoiceDocumentReference>cbc:ID"`
+	IssueDate string `xml:"cac:InvoiceDocumentReference>cbc:IssueDate"`
+}
+
+type UBLParty struct {
+	EndpointID       *UBLIdentifier     `xml:"cbc:EndpointID,omitempty"`
+	PostalAddress    UBLAddress         `xml:"cac:PostalAddress"`
+	PartyTaxScheme   *UBLPartyTaxScheme `xml:"cac:PartyTaxScheme,omitempty"`
+	RegistrationName string             `xml:"cac:PartyLegalEntity>cbc:RegistrationName"`
+}
+
+type UBLIdentifier struct {
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type UBLAddress struct {
+	StreetName           string `xml:"cbc:StreetName,omitempty"`
+	AdditionalStreetName string `xml:"cbc:AdditionalStreetName,omitempty"`
+	CityName             string `xml:"cbc:CityName,omitempty"`
+	PostalZone           string `xml:"cbc:PostalZone,omitempty"`
+	CountrySubentity     string `xml:"cbc:CountrySubentity,omitempty"`
+	CountryCode          string `xml:"cac:Country>cbc:IdentificationCode"`
+}
+
+type UBLPartyTaxScheme struct {
+	CompanyID   string `xml:"cbc:CompanyID"`
+	TaxSchemeID string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+type UBLAmount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
+
+type UBLAllowanceCharge struct {
+	ChargeIndicator       bool           `xml:"cbc:ChargeIndicator"`
+	AllowanceChargeReason string         `xml:"cbc:AllowanceChargeReason"`
+	Amount                UBLAmount      `xml:"cbc:Amount"`
+	TaxCategory           UBLTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type UBLTaxCategory struct {
+	ID                     string `xml:"cbc:ID"` // S = Standard rate, Z = Zero rated, K = Intra-community supply, G = Export outside the EU
+	Percent                string `xml:"cbc:Percent"`
+	TaxExemptionReasonCode string `xml:"cbc:TaxExemptionReasonCode,omitempty"`
+	TaxSchemeID            string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+type UBLTaxTotal struct {
+	TaxAmount   UBLAmount        `xml:"cbc:TaxAmount"`
+	TaxSubtotal []UBLTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type UBLTaxSubtotal struct {
+	TaxableAmount UBLAmount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     UBLAmount      `xml:"cbc:TaxAmount"`
+	TaxCategory   UBLTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type UBLMonetaryTotal struct {
+	LineExtensionAmount  UBLAmount  `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount   UBLAmount  `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount   UBLAmount  `xml:"cbc:TaxInclusiveAmount"`
+	AllowanceTotalAmount *UBLAmount `xml:"cbc:AllowanceTotalAmount,omitempty"`
+	ChargeTotalAmount    *UBLAmount `xml:"cbc:ChargeTotalAmount,omitempty"`
+	PayableAmount        UBLAmount  `xml:"cbc:PayableAmount"`
+}
+
+type UBLLine struct {
+	ID                  string       `xml:"cbc:ID"`
+	InvoicedQuantity    *UBLQuantity `xml:"cbc:InvoicedQuantity,omitempty"`
+	CreditedQuantity    *UBLQuantity `xml:"cbc:CreditedQuantity,omitempty"`
+	LineExtensionAmount UBLAmount    `xml:"cbc:LineExtensionAmount"`
+	Item                UBLItem      `xml:"cac:Item"`
+	PriceAmount         UBLAmount    `xml:"cac:Price>cbc:PriceAmount"`
+}
+
+type UBLQuantity struct {
+	UnitCode string `xml:"unitCode,attr"` // C62 = One (units)
+	Value    string `xml:",chardata"`
+}
+
+type UBLItem struct {
+	Name                        string         `xml:"cbc:Name"`
+	SellersItemIdentification   *string        `xml:"cac:SellersItemIdentification>cbc:ID,omitempty"`
+	StandardItemIdentification  *UBLIdentifier `xml:"cac:StandardItemIdentification>cbc:ID,omitempty"`
+	ClassifiedTaxCategoryID     string         `xml:"cac:ClassifiedTaxCategory>cbc:ID"`
+	ClassifiedTaxCategoryPct    string         `xml:"cac:ClassifiedTaxCategory>cbc:Percent"`
+	ClassifiedTaxCategorySchema string         `xml:"cac:ClassifiedTaxCategory>cac:TaxScheme>cbc:ID"`
+}
+
+// Semantic model of the EN 16931 standard for the sales invoices, shared by the UBL and the CII (Factur-X) syntaxes.
+// The amounts of the amending invoices are negative, but the credit notes are written with positive amounts, so all the amounts are multiplied by the sign.
+type EN16931Invoice struct {
+	Invoice            SalesInvoice
+	AmendedInvoice     *SalesInvoice
+	Settings           Settings
+	Address            Address
+	CustomerName       string
+	CustomerVatNumber  string
+	BuyerReference     string
+	Sign               float64
+	Lines              []EN16931Line
+	Allowances         []EN16931Allowance
+	TaxSubtotals       []EN16931TaxSubtotal
+	LineTotalAmount    float64
+	AllowanceTotal     float64
+	ChargeTotal        float64
+	TaxTotal           float64
+	TaxExclusiveAmount float64
+	TaxInclusiveAmount float64
+}
+
+type EN16931TaxCategory struct {
+	Code    string // S = Standard rate, Z = Zero rated, K = Intra-community supply, G = Export outside the EU
+	Percent float64
+}
+
+type EN16931Line struct {
+	Detail      SalesInvoiceDetail
+	Name        string
+	Price       float64
+	Amount      float64
+	TaxCategory EN16931TaxCategory
+}
+
+type EN16931Allowance struct {
+	Charge      bool
+	Reason      string
+	Amount      float64
+	TaxCategory EN16931TaxCategory
+}
+
+type EN16931TaxSubtotal struct {
+	TaxableAmount float64
+	TaxAmount     float64
+	TaxCategory   EN16931TaxCategory
+}
+
+// ERROR CODES:
+// 1. The enterprise has no tax ID or country in the settings
+// 2. The invoice has no details
+func getEN16931Invoice(invoiceId int64, enterpriseId int32) (EN16931Invoice, OkAndErrorCodeReturn) {
+	return getEN16931InvoiceTransaction(invoiceId, enterpriseId, *dbOrm)
+}
+
+// Reads the invoice inside of the transaction, so the invoices that are being issued in the transaction can be read before the commit.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION
+func getEN16931InvoiceTransaction(invoiceId int64, enterpriseId int32, trans gorm.DB) (EN16931Invoice, OkAndErrorCodeReturn) {
+	e := EN16931Invoice{}
+	result := trans.Model(&SalesInvoice{}).Where("id = ? AND enterprise = ?", invoiceId, enterpriseId).Preload(clause.Associations).Limit(1).Find(&e.Invoice)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	if e.Invoice.Id <= 0 {
+		return e, OkAndErrorCodeReturn{Ok: false}
+	}
+
+	e.Settings = getSettingsRecordById(enterpriseId)
+	if len(e.Settings.EnterpriseTaxId) == 0 || e.Settings.EnterpriseCountry == nil {
+		return e, OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+	details := make([]SalesInvoiceDetail, 0)
+	result = trans.Model(&SalesInvoiceDetail{}).Where("invoice = ? AND enterprise = ?", e.Invoice.Id, enterpriseId).Order("id ASC").Preload(clause.Associations).Find(&details)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	if len(details) == 0 {
+		return e, OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+	}
+	result = trans.Model(&Address{}).Where("id = ?", e.Invoice.BillingAddressId).Preload(clause.Associations).Limit(1).Find(&e.Address)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+
+	e.Sign = 1
+	if e.Invoice.Amending {
+		e.Sign = -1
+		if e.Invoice.AmendedInvoiceId != nil {
+			amendedInvoice := SalesInvoice{}
+			result = trans.Model(&SalesInvoice{}).Where("id = ?", *e.Invoice.AmendedInvoiceId).Limit(1).Find(&amendedInvoice)
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+			}
+			e.AmendedInvoice = &amendedInvoice
+		}
+	}
+
+	e.CustomerVatNumber = e.Invoice.Customer.VatNumber
+	if len(e.CustomerVatNumber) == 0 {
+		e.CustomerVatNumber = e.Invoice.Customer.TaxId
+	}
+	e.CustomerName = e.Invoice.Customer.FiscalName
+	if len(e.CustomerName) == 0 {
+		e.CustomerName = e.Invoice.Customer.Name
+	}
+
+	// the buyer reference is the reference of the customer in the sale order if there is one
+	e.BuyerReference = strings.TrimSpace(e.Invoice.InvoiceName)
+	orderReferences := make([]string, 0)
+	result = trans.Model(&SalesInvoiceDetail{}).Joins("INNER JOIN sales_order_detail ON sales_order_detail.id = sales_invoice_detail.order_detail").Joins("INNER JOIN sales_order ON sales_order.id = sales_order_detail.\"order\"").Where("sales_invoice_detail.invoice = ? AND sales_invoice_detail.enterprise = ?", e.Invoice.Id, enterpriseId).Order("sales_invoice_detail.id ASC").Limit(1).Pluck("sales_order.reference", &orderReferences)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	if len(orderReferences) > 0 && len(orderReferences[0]) > 0 {
+		e.BuyerReference = orderReferences[0]
+	}
+
+	// lines, the taxable amounts are grouped by tax category
+	taxableAmounts := make(map[EN16931TaxCategory]float64)
+	taxCategories := make([]EN16931TaxCategory, 0)
+	for i := 0; i < len(details); i++ {
+		d := details[i]
+		line := EN16931Line{
+			Detail:      d,
+			Name:        d.Description,
+			Price:       d.Price * e.Sign,
+			Amount:      roundEN16931Amount(d.Price * d.Quantity * e.Sign),
+			TaxCategory: en16931TaxCategory(d.VatPercent, e.Address.Country.Zone),
+		}
+		if len(line.Name) == 0 && d.Product != nil {
+			line.Name = d.Product.Name
+		}
+		e.LineTotalAmount += line.Amount
+		if _, ok := taxableAmounts[line.TaxCategory]; !ok {
+			taxCategories = append(taxCategories, line.TaxCategory)
+		}
+		taxableAmounts[line.TaxCategory] += line.Amount
+		e.Lines = append(e.Lines, line)
+	}
+
+	// the discounts and the shipping of the invoice are applied to the tax category with the greatest taxable amount
+	mainTaxCategory := taxCategories[0]
+	for i := 1; i < len(taxCategories); i++ {
+		if math.Abs(taxableAmounts[taxCategories[i]]) > math.Abs(taxableAmounts[mainTaxCategory]) {
+			mainTaxCategory = taxCategories[i]
+		}
+	}
+	addAllowanceCharge := func(charge bool, reason string, amount float64) {
+		amount = roundEN16931Amount(amount * e.Sign)
+		if amount == 0 {
+			return
+		}
+		e.Allowances = append(e.Allowances, EN16931Allowance{Charge: charge, Reason: reason, Amount: amount, TaxCategory: mainTaxCategory})
+		if charge {
+			e.ChargeTotal += amount
+			taxableAmounts[mainTaxCategory] += amount
+		} else {
+			e.AllowanceTotal += amount
+			taxableAmounts[mainTaxCategory] -= amount
+		}
+	}
+	addAllowanceCharge(false, "Discount", e.Invoice.TotalProducts*(e.Invoice.DiscountPercent/100))
+	addAllowanceCharge(false, "Discount", e.Invoice.FixDiscount)
+	addAllowanceCharge(false, "Shipping discount", e.Invoice.ShippingDiscount)
+	addAllowanceCharge(true, "Shipping", e.Invoice.ShippingPrice)
+
+	// taxes
+	for i := 0; i < len(taxCategories); i++ {
+		subtotal := EN16931TaxSubtotal{TaxableAmount: roundEN16931Amount(taxableAmounts[taxCategories[i]]), TaxCategory: taxCategories[i]}
+		subtotal.TaxAmount = roundEN16931Amount(subtotal.TaxableAmount * (subtotal.TaxCategory.Percent / 100))
+		e.TaxTotal += subtotal.TaxAmount
+		e.TaxSubtotals = append(e.TaxSubtotals, subtotal)
+	}
+
+	// totals
+	e.LineTotalAmount = roundEN16931Amount(e.LineTotalAmount)
+	e.TaxTotal = roundEN16931Amount(e.TaxTotal)
+	e.TaxExclusiveAmount = roundEN16931Amount(e.LineTotalAmount - e.AllowanceTotal + e.ChargeTotal)
+	e.TaxInclusiveAmount = roundEN16931Amount(e.TaxExclusiveAmount + e.TaxTotal)
+	return e, OkAndErrorCodeReturn{Ok: true}
+}
+
+// Returns the UBL invoice of the sales invoice. The amending invoices are exported as a credit note of the amended invoice.
+// ERROR CODES:
+// 1. The enterprise has no tax ID or country in the settings
+// 2. The invoice has no details
+func generateSalesInvoiceUBL(invoiceId int64, enterpriseId int32) ([]byte, OkAndErrorCodeReturn) {
+	e, result := getEN16931Invoice(invoiceId, enterpriseId)
+	if !result.Ok {
+		return nil, result
+	}
+	invoice := e.Invoice
+	settings := e.Settings
+	address := e.Address
+	currency := invoice.Currency.IsoCode
+
+	ubl := UBLInvoice{
+		XMLName:              xml.Name{Local: "Invoice"},
+		Xmlns:                UBL_INVOICE_NAMESPACE,
+		XmlnsCac:             UBL_CAC_NAMESPACE,
+		XmlnsCbc:             UBL_CBC_NAMESPACE,
+		CustomizationID:      PEPPOL_CUSTOMIZATION_ID,
+		ProfileID:            PEPPOL_PROFILE_ID,
+		ID:                   strings.TrimSpace(invoice.InvoiceName),
+		IssueDate:            invoice.DateCreated.Format("2006-01-02"),
+		DocumentCurrencyCode: currency,
+		BuyerReference:       e.BuyerReference,
+	}
+	if len(invoice.PaymentMethod.Name) > 0 {
+		ubl.PaymentTerms = &invoice.PaymentMethod.Name
+	}
+	if invoice.Amending {
+		ubl.XMLName = xml.Name{Local: "CreditNote"}
+		ubl.Xmlns = UBL_CREDIT_NOTE_NAMESPACE
+		ubl.CreditNoteTypeCode = "381"
+		if e.AmendedInvoice != nil {
+			ubl.BillingReference = &UBLBillingReference{ID: strings.TrimSpace(e.AmendedInvoice.InvoiceName), IssueDate: e.AmendedInvoice.DateCreated.Format("2006-01-02")}
+		}
+	} else {
+		ubl.InvoiceTypeCode = "380"
+		ubl.DueDate = invoice.DateCreated.AddDate(0, 0, int(invoice.PaymentMethod.DaysExpiration)).Format("2006-01-02")
+	}
+
+	// parties
+	ubl.AccountingSupplierParty = UBLParty{
+		EndpointID:       ublEndpointId(settings.EnterpriseTaxId, settings.EnterpriseCountry.Iso2),
+		PostalAddress:    UBLAddress{StreetName: settings.EnterpriseAddress, CityName: settings.EnterpriseCity, PostalZone: settings.EnterpriseZipCode, CountrySubentity: settings.EnterpriseProvince, CountryCode: settings.EnterpriseCountry.Iso2},
+		PartyTaxScheme:   &UBLPartyTaxScheme{CompanyID: en16931VatNumber(settings.EnterpriseTaxId, settings.EnterpriseCountry.Iso2), TaxSchemeID: "VAT"},
+		RegistrationName: settings.EnterpriseName,
+	}
+	stateName := ""
+	if address.State != nil {
+		stateName = address.State.Name
+	}
+	ubl.AccountingCustomerParty = UBLParty{
+		EndpointID:       ublEndpointId(e.CustomerVatNumber, address.Country.Iso2),
+		PostalAddress:    UBLAddress{StreetName: address.Address, AdditionalStreetName: address.Address2, CityName: address.City, PostalZone: address.ZipCode, CountrySubentity: stateName, CountryCode: address.Country.Iso2},
+		RegistrationName: e.CustomerName,
+	}
+	if len(e.CustomerVatNumber) > 0 {
+		ubl.AccountingCustomerParty.PartyTaxScheme = &UBLPartyTaxScheme{CompanyID: en16931VatNumber(e.CustomerVatNumber, address.Country.Iso2), TaxSchemeID: "VAT"}
+	}
+
+	// lines
+	lines := make([]UBLLine, 0)
+	for i := 0; i < len(e.Lines); i++ {
+		l := e.Lines[i]
+		line := UBLLine{
+			ID:                  strconv.Itoa(i + 1),
+			LineExtensionAmount: ublAmount(l.Amount, currency),
+			Item: UBLItem{
+				Name:                        l.Name,
+				ClassifiedTaxCategoryID:     l.TaxCategory.Code,
+				ClassifiedTaxCategoryPct:    formatEN16931Percent(l.TaxCategory.Percent),
+				ClassifiedTaxCategorySchema: "VAT",
+			},
+			PriceAmount: UBLAmount{CurrencyID: currency, Value: strconv.FormatFloat(l.Price, 'f', -1, 64)},
+		}
+		quantity := &UBLQuantity{UnitCode: "C62", Value: formatQuantity(l.Detail.Quantity)}
+		if invoice.Amending {
+			line.CreditedQuantity = quantity
+		} else {
+			line.InvoicedQuantity = quantity
+		}
+		if l.Detail.Product != nil {
+			if len(l.Detail.Product.Reference) > 0 {
+				line.Item.SellersItemIdentification = &l.Detail.Product.Reference
+			}
+			if len(strings.TrimSpace(l.Detail.Product.BarCode)) > 0 {
+				line.Item.StandardItemIdentification = &UBLIdentifier{SchemeID: "0160", Value: strings.TrimSpace(l.Detail.Product.BarCode)} // 0160 = GTIN
+			}
+		}
+		lines = append(lines, line)
+	}
+	if invoice.Amending {
+		ubl.CreditNoteLine = lines
+	} else {
+		ubl.InvoiceLine = lines
+	}
+
+	// discounts and charges
+	for i := 0; i < len(e.Allowances); i++ {
+		a := e.Allowances[i]
+		ubl.AllowanceCharge = append(ubl.AllowanceCharge, UBLAllowanceCharge{ChargeIndicator: a.Charge, AllowanceChargeReason: a.Reason, Amount: ublAmount(a.Amount, currency), TaxCategory: ublTaxCategory(a.TaxCategory)})
+	}
+
+	// taxes
+	for i := 0; i < len(e.TaxSubtotals); i++ {
+		t := e.TaxSubtotals[i]
+		ubl.TaxTotal.TaxSubtotal = append(ubl.TaxTotal.TaxSubtotal, UBLTaxSubtotal{TaxableAmount: ublAmount(t.TaxableAmount, currency), TaxAmount: ublAmount(t.TaxAmount, currency), TaxCategory: ublTaxCategory(t.TaxCategory)})
+	}
+	ubl.TaxTotal.TaxAmount = ublAmount(e.TaxTotal, currency)
+
+	// totals
+	ubl.LegalMonetaryTotal = UBLMonetaryTotal{
+		LineExtensionAmount: ublAmount(e.LineTotalAmount, currency),
+		TaxExclusiveAmount:  ublAmount(e.TaxExclusiveAmount, currency),
+		TaxInclusiveAmount:  ublAmount(e.TaxInclusiveAmount, currency),
+		PayableAmount:       ublAmount(e.TaxInclusiveAmount, currency),
+	}
+	if e.AllowanceTotal != 0 {
+		allowanceTotal := ublAmount(e.AllowanceTotal, currency)
+		ubl.LegalMonetaryTotal.AllowanceTotalAmount = &allowanceTotal
+	}
+	if e.ChargeTotal != 0 {
+		chargeTotal := ublAmount(e.ChargeTotal, currency)
+		ubl.LegalMonetaryTotal.ChargeTotalAmount = &chargeTotal
+	}
+
+	data, err := xml.Marshal(ubl)
+	if err != nil {
+		log("UBL", err.Error())
+		return nil, OkAndErrorCodeReturn{Ok: false}
+	}
+	return []byte(xml.Header + string(data)), OkAndErrorCodeReturn{Ok: true}
+}
+
+func roundEN16931Amount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func formatEN16931Percent(percent float64) string {
+	return strconv.FormatFloat(percent, 'f', -1, 64)
+}
+
+func ublAmount(amount float64, currency string) UBLAmount {
+	return UBLAmount{CurrencyID: currency, Value: fmt.Sprintf("%.2f", amount)}
+}
+
+func ublTaxCategory(taxCategory EN16931TaxCategory) UBLTaxCategory {
+	return UBLTaxCategory{ID: taxCategory.Code, Percent: formatEN16931Percent(taxCategory.Percent), TaxExemptionReasonCode: en16931TaxExemptionReasonCode(taxCategory.Code), TaxSchemeID: "VAT"}
+}
+
+// The VAT numbers in the electronic invoices are prefixed with the ISO code of the country.
+func en16931VatNumber(vatNumber string, countryIso2 string) string {
+	vatNumber = strings.ToUpper(strings.Replace(strings.TrimSpace(vatNumber), " ", "", -1))
+	if countryIso2 == "GR" {
+		countryIso2 = "EL" // Greece uses the EL prefix in the VAT numbers
+	}
+	if !strings.HasPrefix(vatNumber, countryIso2) {
+		vatNumber = countryIso2 + vatNumber
+	}
+	return vatNumber
+}
+
+func ublEndpointId(vatNumber string, countryIso2 string) *UBLIdentifier {
+	scheme, ok := peppolVatEndpointSchemes[countryIso2]
+	if !ok || len(vatNumber) == 0 {
+		return nil
+	}
+	return &UBLIdentifier{SchemeID: scheme, Value: en16931VatNumber(vatNumber, countryIso2)}
+}
+
+// The lines without VAT are intra-community supplies for the European Union customers, exports for the customers outside of the EU,
+// or zero rated for the national customers.
+func en16931TaxCategory(vatPercent float64, countryZone string) EN16931TaxCategory {
+	taxCategory := EN16931TaxCategory{Code: "S", Percent: vatPercent}
+	if vatPercent == 0 {
+		switch countryZone {
+		case "U":
+			taxCategory.Code = "K"
+		case "E":
+			taxCategory.Code = "G"
+		default:
+			taxCategory.Code = "Z"
+		}
+	}
+	return taxCategory
+}
+
+func en16931TaxExemptionReasonCode(taxCategoryCode string) string {
+	switch taxCategoryCode {
+	case "K":
+		return "VATEX-EU-IC"
+	case "G":
+		return "VATEX-EU-G"
+	default:
+		return ""
+	}
+}
+
+func reportSalesInvoiceUBL(id int, enterpriseId int32) []byte {
+	document, result := generateSalesInvoiceUBL(int64(id), enterpriseId)
+	if !result.Ok {
+		return nil
+	}
+	return document
+}
+
+// UBL document received from a supplier. The namespaces are ignored, so the same struct is used for the invoices and the credit notes.
+type UBLImportDocument struct {
+	XMLName              xml.Name
+	ID                   string                  `xml:"ID"`
+	DocumentCurrencyCode string                  `xml:"DocumentCurrencyCode"`
+	BillingReference     string                  `xml:"BillingReference>InvoiceDocumentReference>ID"`
+	SupplierEndpointID   string                  `xml:"AccountingSupplierParty>Party>EndpointID"`
+	SupplierTaxCompanyID []string                `xml:"AccountingSupplierParty>Party>PartyTaxScheme>CompanyID"`
+	SupplierLegalID      string                  `xml:"AccountingSupplierParty>Party>PartyLegalEntity>CompanyID"`
+	AllowanceCharge      []UBLImportAllowance    `xml:"AllowanceCharge"`
+	PayableAmount        float64                 `xml:"LegalMonetaryTotal>PayableAmount"`
+	InvoiceLine          []UBLImportDocumentLine `xml:"InvoiceLine"`
+	CreditNoteLine       []UBLImportDocumentLine `xml:"CreditNoteLine"`
+}
+
+type UBLImportAllowance struct {
+	ChargeIndicator bool    `xml:"ChargeIndicator"`
+	Amount          float64 `xml:"Amount"`
+}
+
+type UBLImportDocumentLine struct {
+	ID                  string  `xml:"ID"`
+	InvoicedQuantity    float64 `xml:"InvoicedQuantity"`
+	CreditedQuantity    float64 `xml:"CreditedQuantity"`
+	LineExtensionAmount float64 `xml:"LineExtensionAmount"`
+	Name                string  `xml:"Item>Name"`
+	SellersItemID       string  `xml:"Item>SellersItemIdentification>ID"`
+	StandardItemID      string  `xml:"Item>StandardItemIdentification>ID"`
+	VatPercent          float64 `xml:"Item>ClassifiedTaxCategory>Percent"`
+}
+
+type UBLImportResult struct {
+	Ok                 bool            `json:"ok"`
+	ErrorCode          uint8           `json:"errorCode"`
+	InvoiceId          int64           `json:"invoiceId"`
+	PayableAmount      float64         `json:"payableAmount"`      // Total of the UBL document
+	InvoiceTotalAmount float64         `json:"invoiceTotalAmount"` // Total of the imported invoice, to check that all the amounts were imported
+	Lines              []UBLImportLine `json:"lines"`
+}
+
+// Result of the import of each line of the UBL document.
+// ERROR CODES:
+// 1. The product was not found, the line was imported as a text line (Ok = true)
+// 2. The quantity is not a positive whole number, the line was not imported
+// 3. There is already a line with the same product in the invoice, the line was not imported
+// 4. The product is deactivated, the line was not imported
+// 5. The line could not be inserted
+type UBLImportLine struct {
+	LineId    string `json:"lineId"`
+	ProductId *int32 `json:"productId"`
+	Ok        bool   `json:"ok"`
+	ErrorCode uint8  `json:"errorCode"`
+}
+
+// Imports an invoice or a credit note in UBL format as a purchase invoice that is not posted yet.
+// The supplier is found by the VAT number, and the products by the reference of the supplier or by the EAN code.
+// ERROR CODES:
+// 1. The document can't be read or it's not an invoice or a credit note
+// 2. The supplier could not be found by the VAT number
+// 3. The supplier has no main billing address, payment method or billing series
+// 4. The currency of the document doesn't exist
+// 5. The invoice could not be inserted
+func importPurchaseInvoiceUBL(document []byte, enterpriseId int32, userId int32) UBLImportResult {
+	var ubl UBLImportDocument
+	err := xml.Unmarshal(document, &ubl)
+	if err != nil || (ubl.XMLName.Local != "Invoice" && ubl.XMLName.Local != "CreditNote") {
+		return UBLImportResult{Ok: false, ErrorCode: 1}
+	}
+	creditNote := ubl.XMLName.Local == "CreditNote"
+
+	// supplier
+	vatNumbers := make([]string, 0)
+	for _, vatNumber := range append(ubl.SupplierTaxCompanyID, ubl.SupplierEndpointID, ubl.SupplierLegalID) {
+		vatNumber = strings.ToUpper(strings.Replace(strings.TrimSpace(vatNumber), " ", "", -1))
+		if len(vatNumber) == 0 {
+			continue
+		}
+		vatNumbers = append(vatNumbers, vatNumber)
+		// the VAT numbers can be stored without the prefix of the country
+		if len(vatNumber) > 2 && vatNumber[0] >= 'A' && vatNumber[0] <= 'Z' && vatNumber[1] >= 'A' && vatNumber[1] <= 'Z' {
+			vatNumbers = append(vatNumbers, vatNumber[2:])
+		}
+	}
+	if len(vatNumbers) == 0 {
+		return UBLImportResult{Ok: false, ErrorCode: 2}
+	}
+	var supplier Supplier
+	result := dbOrm.Model(&Supplier{}).Where("enterprise = ? AND (UPPER(REPLACE(vat_number,' ','')) IN ? OR UPPER(REPLACE(tax_id,' ','')) IN ?)", enterpriseId, vatNumbers, vatNumbers).Order("id ASC").First(&supplier)
+	if result.Error != nil || supplier.Id <= 0 {
+		return UBLImportResult{Ok: false, ErrorCode: 2}
+	}
+	if supplier.MainBillingAddressId == nil || supplier.PaymentMethodId == nil || supplier.BillingSeriesId == nil {
+		return UBLImportResult{Ok: false, ErrorCode: 3}
+	}
+
+	var currency Currency
+	result = dbOrm.Model(&Currency{}).Where("enterprise = ? AND iso_code = ?", enterpriseId, ubl.DocumentCurrencyCode).First(&currency)
+	if result.Error != nil || currency.Id <= 0 {
+		return UBLImportResult{Ok: false, ErrorCode: 4}
+	}
+
+	// invoice
+	supplierReference := ubl.ID
+	if len(supplierReference) > 50 {
+		supplierReference = supplierReference[:50]
+	}
+	invoice := PurchaseInvoice{
+		SupplierId:        supplier.Id,
+		PaymentMethodId:   *supplier.PaymentMethodId,
+		BillingSeriesId:   *supplier.BillingSeriesId,
+		CurrencyId:        currency.Id,
+		BillingAddressId:  *supplier.MainBillingAddressId,
+		SupplierReference: supplierReference,
+		EnterpriseId:      enterpriseId,
+	}
+	ok, invoiceId := invoice.insertPurchaseInvoice(userId, nil)
+	if !ok {
+		return UBLImportResult{Ok: false, ErrorCode: 5}
+	}
+
+	// the credit notes are amending invoices of the invoice of the supplier
+	if creditNote {
+		var amendedInvoiceId *int64
+		if len(ubl.BillingReference) > 0 {
+			var amendedInvoice PurchaseInvoice
+			result = dbOrm.Model(&PurchaseInvoice{}).Where("enterprise = ? AND supplier = ? AND supplier_reference = ?", enterpriseId, supplier.Id, ubl.BillingReference).First(&amendedInvoice)
+			if result.Error == nil && amendedInvoice.Id > 0 {
+				amendedInvoiceId = &amendedInvoice.Id
+			}
+		}
+		result = dbOrm.Model(&PurchaseInvoice{}).Where("id = ?", invoiceId).Updates(map[string]interface{}{
+			"amending":        true,
+			"amended_invoice": amendedInvoiceId,
+		})
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+		}
+	}
+
+	// lines, each line is inserted separately so one line with errors doesn't prevent the import of the others
+	documentLines := ubl.InvoiceLine
+	if creditNote {
+		documentLines = ubl.CreditNoteLine
+	}
+	lines := make([]UBLImportLine, 0)
+	for i := 0; i < len(documentLines); i++ {
+		documentLine := documentLines[i]
+		line := UBLImportLine{LineId: documentLine.ID}
+
+		quantity := documentLine.InvoicedQuantity
+		if creditNote {
+			quantity = documentLine.CreditedQuantity
+		}
+		if quantity <= 0 || quantity != math.Trunc(quantity) || quantity > MAX_INT32 {
+			line.ErrorCode = 2
+			lines = append(lines, line)
+			continue
+		}
+
+		detail := PurchaseInvoiceDetail{
+			InvoiceId:    invoiceId,
+			Quantity:     quantity,
+			Price:        documentLine.LineExtensionAmount / quantity,
+			VatPercent:   documentLine.VatPercent,
+			EnterpriseId: enterpriseId,
+		}
+		if creditNote {
+			detail.Price = -detail.Price
+		}
+
+		line.ProductId = findUBLProduct(documentLine.SellersItemID, documentLine.StandardItemID, supplier.Id, enterpriseId)
+		if line.ProductId == nil {
+			line.ErrorCode = 1
+			detail.Description = documentLine.Name
+			if len(detail.Description) == 0 {
+				detail.Description = documentLine.SellersItemID
+			}
+			if len(detail.Description) > 150 {
+				detail.Description = detail.Description[:150]
+			}
+		}
+		detail.ProductId = line.ProductId
+
+		okAndErr := detail.insertPurchaseInvoiceDetail(userId, nil)
+		if okAndErr.Ok {
+			line.Ok = true
+		} else if okAndErr.ErrorCode == 2 {
+			line.ErrorCode = 3
+		} else if okAndErr.ErrorCode == 1 {
+			line.ErrorCode = 4
+		} else {
+			line.ErrorCode = 5
+		}
+		lines = append(lines, line)
+	}
+
+	// discounts and shipping of the document
+	var fixDiscount float64
+	var shippingPrice float64
+	for i := 0; i < len(ubl.AllowanceCharge); i++ {
+		if ubl.AllowanceCharge[i].ChargeIndicator {
+			shippingPrice += ubl.AllowanceCharge[i].Amount
+		} else {
+			fixDiscount += ubl.AllowanceCharge[i].Amount
+		}
+	}
+	if creditNote {
+		fixDiscount = -fixDiscount
+		shippingPrice = -shippingPrice
+	}
+	if fixDiscount != 0 || shippingPrice != 0 {
+		///
+		trans := dbOrm.Begin()
+		if trans.Error != nil {
+			return UBLImportResult{Ok: false}
+		}
+		///
+		result = trans.Model(&PurchaseInvoice{}).Where("id = ?", invoiceId).Updates(map[string]interface{}{
+			"fix_discount":   fixDiscount,
+			"shipping_price": shippingPrice,
+		})
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			trans.Rollback()
+		} else if calcTotalsPurchaseInvoice(invoiceId, enterpriseId, userId, *trans) {
+			///
+			trans.Commit()
+			///
+		}
+	}
+
+	invoice = getPurchaseInvoiceRow(invoiceId)
+	payableAmount := ubl.PayableAmount
+	if creditNote {
+		payableAmount = -payableAmount
+	}
+	return UBLImportResult{Ok: true, InvoiceId: invoiceId, PayableAmount: payableAmount, InvoiceTotalAmount: invoice.TotalAmount, Lines: lines}
+}
+
+// Searches the product by the reference of the supplier, and then by the EAN code.
+func findUBLProduct(sellersItemId string, standardItemId string, supplierId int32, enterpriseId int32) *int32 {
+	var product Product
+	if len(sellersItemId) > 0 {
+		result := dbOrm.Model(&Product{}).Where("enterprise = ? AND supplier = ? AND reference = ?", enterpriseId, supplierId, sellersItemId).Order("id ASC").First(&product)
+		if result.Error == nil && product.Id > 0 {
+			return &product.Id
+		}
+		// the reference of the product in the product-supplier table
+		var productSupplier ProductSupplier
+		result = dbOrm.Model(&ProductSupplier{}).Where("enterprise = ? AND supplier = ? AND supplier_reference = ?", enterpriseId, supplierId, sellersItemId).Order("id ASC").Limit(1).Find(&productSupplier)
+		if result.Error == nil && productSupplier.ProductId > 0 {
+			return &productSupplier.ProductId
+		}
+	}
+	// the GTIN-14 codes of the EAN-13 products start with a zero
+	standardItemId = strings.TrimSpace(standardItemId)
+	if len(standardItemId) == 14 && standardItemId[0] == '0' {
+		standardItemId = standardItemId[1:]
+	}
+	if len(standardItemId) > 0 && len(standardItemId) <= 13 {
+		result := dbOrm.Model(&Product{}).Where("enterprise = ? AND barcode = ?", enterpriseId, standardItemId).First(&product)
+		if result.Error == nil && product.Id > 0 {
+			return &product.Id
+		}
+	}
+	return nil
+}
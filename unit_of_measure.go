@@ -0,0 +1,288 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"math"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A unit in which the quantities of the products are counted (units, boxes, packs, kilograms...)
+type UnitOfMeasure struct {
+	Id           int32    `json:"id" gorm:"index:unit_of_measure_id_enterprise,unique:true,priority:1"`
+	Name         string   `json:"name" gorm:"type:character varying(50);not null:true"`
+	Symbol       string   `json:"symbol" gorm:"type:character varying(10);not null:true;index:unit_of_measure_symbol,unique:true,priority:2"`
+	EnterpriseId int32    `json:"-" gorm:"column:enterprise;not null:true;index:unit_of_measure_id_enterprise,unique:true,priority:2;index:unit_of_measure_symbol,unique:true,priority:1"`
+	Enterprise   Settings `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (u *UnitOfMeasure) TableName() string {
+	return "unit_of_measure"
+}
+
+func getUnitsOfMeasure(enterpriseId int32) []UnitOfMeasure {
+	var units []UnitOfMeasure = make([]UnitOfMeasure, 0)
+	result := dbOrm.Model(&UnitOfMeasure{}).Where("enterprise = ?", enterpriseId).Order("id ASC").Find(&units)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return units
+}
+
+// Returns the symbol of all the units of measure of the enterprise, to print the units in the reports without a query for each line.
+// Key: unit of measure ID, Value: symbol
+func getUnitOfMeasureSymbols(enterpriseId int32) map[int32]string {
+	symbols := make(map[int32]string)
+	units := getUnitsOfMeasure(enterpriseId)
+	for i := 0; i < len(units); i++ {
+		symbols[units[i].Id] = units[i].Symbol
+	}
+	return symbols
+}
+
+func (u *UnitOfMeasure) isValid() bool {
+	u.Symbol = strings.TrimSpace(u.Symbol)
+	return !(len(u.Name) == 0 || len(u.Name) > 50 || len(u.Symbol) == 0 || len(u.Symbol) > 10)
+}
+
+func (u *UnitOfMeasure) BeforeCreate(tx *gorm.DB) (err error) {
+	var unit UnitOfMeasure
+	tx.Model(&UnitOfMeasure{}).Last(&unit)
+	u.Id = unit.Id + 1
+	return nil
+}
+
+func (u *UnitOfMeasure) insertUnitOfMeasure() bool {
+	if !u.isValid() {
+		return false
+	}
+
+	result := dbOrm.Create(&u)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (u *UnitOfMeasure) updateUnitOfMeasure() bool {
+	if u.Id <= 0 || !u.isValid() {
+		return false
+	}
+
+	var unit UnitOfMeasure
+	result := dbOrm.Where("id = ? AND enterprise = ?", u.Id, u.EnterpriseId).First(&unit)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	unit.Name = u.Name
+	unit.Symbol = u.Symbol
+
+	result = dbOrm.Save(&unit)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (u *UnitOfMeasure) deleteUnitOfMeasure() bool {
+	if u.Id <= 0 {
+		return false
+	}
+
+	result := dbOrm.Where("id = ? AND enterprise = ?", u.Id, u.EnterpriseId).Delete(&UnitOfMeasure{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func locateUnitsOfMeasure(enterpriseId int32) []NameInt32 {
+	var units []NameInt32 = make([]NameInt32, 0)
+	dbOrm.Model(&UnitOfMeasure{}).Where("enterprise = ?", enterpriseId).Order("id ASC").Find(&units)
+	return units
+}
+
+// An alternative unit in which a product is purchased or sold, and how many units of stock are in one of this unit.
+// The stock of the product is always counted in the unit of measure of the product.
+type ProductUnitOfMeasure struct {
+	Id              int32         `json:"id" gorm:"index:product_unit_of_measure_id_enterprise,unique:true,priority:1"`
+	ProductId       int32         `json:"productId" gorm:"column:product;not null:true;index:product_unit_of_measure_product_unit,unique:true,priority:2"`
+	Product         Product       `json:"-" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	UnitOfMeasureId int32         `json:"unitOfMeasureId" gorm:"column:unit_of_measure;not null:true;index:product_unit_of_measure_product_unit,unique:true,priority:3"`
+	UnitOfMeasure   UnitOfMeasure `json:"unitOfMeasure" gorm:"foreignKey:UnitOfMeasureId,EnterpriseId;references:Id,EnterpriseId"`
+	Factor          int32         `json:"factor" gorm:"not null:true"`   // Units of stock in one of this unit, 12 = box of 12
+	Purchase        bool          `json:"purchase" gorm:"not null:true"` // Can be used in the purchase orders
+	Sales           bool          `json:"sales" gorm:"not null:true"`    // Can be used in the sales orders
+	EnterpriseId    int32         `json:"-" gorm:"column:enterprise;not null:true;index:product_unit_of_measure_id_enterprise,unique:true,priority:2;index:product_unit_of_measure_product_unit,unique:true,priority:1"`
+	Enterprise      Settings      `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (pu *ProductUnitOfMeasure) TableName() string {
+	return "product_unit_of_measure"
+}
+
+func getProductUnitsOfMeasure(productId int32, enterpriseId int32) []ProductUnitOfMeasure {
+	var units []ProductUnitOfMeasure = make([]ProductUnitOfMeasure, 0)
+	result := dbOrm.Model(&ProductUnitOfMeasure{}).Where("product = ? AND enterprise = ?", productId, enterpriseId).Order("factor ASC, id ASC").Preload(clause.Associations).Find(&units)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return units
+}
+
+func (pu *ProductUnitOfMeasure) isValid() bool {
+	return !(pu.ProductId <= 0 || pu.UnitOfMeasureId <= 0 || pu.Factor <= 0 || (!pu.Purchase && !pu.Sales))
+}
+
+func (pu *ProductUnitOfMeasure) BeforeCreate(tx *gorm.DB) (err error) {
+	var unit ProductUnitOfMeasure
+	tx.Model(&ProductUnitOfMeasure{}).Last(&unit)
+	pu.Id = unit.Id + 1
+	return nil
+}
+
+func (pu *ProductUnitOfMeasure) insertProductUnitOfMeasure() bool {
+	if !pu.isValid() {
+		return false
+	}
+
+	// the unit of stock of the product doesn't need a conversion
+	product := getProductRow(pu.ProductId)
+	if product.Id <= 0 || product.EnterpriseId != pu.EnterpriseId || (product.UnitOfMeasureId != nil && *product.UnitOfMeasureId == pu.UnitOfMeasureId) {
+		return false
+	}
+
+	result := dbOrm.Create(&pu)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (pu *ProductUnitOfMeasure) updateProductUnitOfMeasure() bool {
+	if pu.Id <= 0 || pu.Factor <= 0 || (!pu.Purchase && !pu.Sales) {
+		return false
+	}
+
+	var unit ProductUnitOfMeasure
+	result := dbOrm.Where("id = ? AND enterprise = ?", pu.Id, pu.EnterpriseId).First(&unit)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	// the lines that already used this unit keep the factor that they were created with
+	unit.Factor = pu.Factor
+	unit.Purchase = pu.Purchase
+	unit.Sales = pu.Sales
+
+	result = dbOrm.Save(&unit)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (pu *ProductUnitOfMeasure) deleteProductUnitOfMeasure() bool {
+	if pu.Id <= 0 {
+		return false
+	}
+
+	result := dbOrm.Where("id = ? AND enterprise = ?", pu.Id, pu.EnterpriseId).Delete(&ProductUnitOfMeasure{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+// Returns how many units of stock of the product are in one unit of the unit of measure.
+// The unit of stock of the product is always allowed, the other units must be in the conversion table of the product for purchases or for sales.
+func getProductUnitOfMeasureFactor(productId int32, unitOfMeasureId int32, sales bool, enterpriseId int32) (int32, bool) {
+	product := getProductRow(productId)
+	if product.Id <= 0 || product.EnterpriseId != enterpriseId {
+		return 0, false
+	}
+	if product.UnitOfMeasureId != nil && *product.UnitOfMeasureId == unitOfMeasureId {
+		return 1, true
+	}
+
+	var units []ProductUnitOfMeasure
+	result := dbOrm.Model(&ProductUnitOfMeasure{}).Where("product = ? AND unit_of_measure = ? AND enterprise = ?", productId, unitOfMeasureId, enterpriseId).Limit(1).Find(&units)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return 0, false
+	}
+	if len(units) == 0 || (sales && !units[0].Sales) || (!sales && !units[0].Purchase) {
+		return 0, false
+	}
+	return units[0].Factor, true
+}
+
+// Computes the quantity in units of stock of an order line entered in an alternative unit of measure.
+// If the line has no unit of measure, the quantity is already in units of stock.
+// Returns the quantity in units of stock and the factor of the unit used.
+func convertLineQuantity(productId int32, unitOfMeasureId *int32, unitQuantity float64, quantity float64, sales bool, enterpriseId int32) (float64, int32, bool) {
+	if unitOfMeasureId == nil {
+		return quantity, 0, true
+	}
+	if unitQuantity <= 0 {
+		return 0, 0, false
+	}
+	factor, ok := getProductUnitOfMeasureFactor(productId, *unitOfMeasureId, sales, enterpriseId)
+	if !ok {
+		return 0, 0, false
+	}
+	return roundQuantity(unitQuantity * float64(factor)), factor, true
+}
+
+// Formats a quantity in units of stock to be printed in a report.
+// If the line was entered in an alternative unit and the quantity is a whole number of this unit, both units are printed: "2 BOX (24 UN)"
+func formatQuantityWithUnit(quantity float64, stockSymbol string, lineSymbol string, lineFactor int32) string {
+	stock := strings.TrimSpace(formatQuantity(quantity) + " " + stockSymbol)
+	if len(lineSymbol) == 0 || lineFactor <= 1 {
+		return stock
+	}
+	lineQuantity := roundQuantity(quantity / float64(lineFactor))
+	if lineQuantity != math.Trunc(lineQuantity) {
+		return stock
+	}
+	return formatQuantity(lineQuantity) + " " + lineSymbol + " (" + stock + ")"
+}
+
+// Formats the quantity of a report line using the unit of stock of the product and the unit of measure of the order line (if any).
+func formatReportQuantity(quantity float64, product *Product, lineUnitOfMeasureId *int32, lineFactor int32, symbols map[int32]string) string {
+	var stockSymbol string
+	if product != nil && product.UnitOfMeasureId != nil {
+		stockSymbol = symbols[*product.UnitOfMeasureId]
+	}
+	var lineSymbol string
+	if lineUnitOfMeasureId != nil {
+		lineSymbol = symbols[*lineUnitOfMeasureId]
+	}
+	return formatQuantityWithUnit(quantity, stockSymbol, lineSymbol, lineFactor)
+}
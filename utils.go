@@ -20,6 +20,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
@@ -58,6 +59,43 @@ func absf(x float64) float64 {
 	return x
 }
 
+// Decimal places of the quantity columns in the database (numeric(14,6))
+const QUANTITY_MAX_DECIMALS = 6
+
+// Rounds a quantity to the decimal places of the quantity columns.
+// The quantities that are added or substracted in memory must be rounded before being compared or saved,
+// so the binary representation of the floats doesn't leave remainders (0.1 + 0.2 = 0.30000000000000004).
+func roundQuantity(quantity float64) float64 {
+	return roundQuantityDecimals(quantity, QUANTITY_MAX_DECIMALS)
+}
+
+// Rounds a quantity to the decimal places of a product.
+func roundQuantityDecimals(quantity float64, decimals int16) float64 {
+	if decimals < 0 {
+		decimals = 0
+	} else if decimals > QUANTITY_MAX_DECIMALS {
+		decimals = QUANTITY_MAX_DECIMALS
+	}
+	p := math.Pow10(int(decimals))
+	return math.Round(quantity*p) / p
+}
+
+// Formats a quantity to be printed or exported, without the trailing zeros of the decimals: 2, 1.5, 0.125
+func formatQuantity(quantity float64) string {
+	return strconv.FormatFloat(roundQuantity(quantity), 'f', -1, 64)
+}
+
+// Cuts a text to a maximum length in bytes without cutting a character in half, so the result is still valid UTF-8
+func truncateString(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+	for maxLength > 0 && !utf8.RuneStart(s[maxLength]) {
+		maxLength--
+	}
+	return s[:maxLength]
+}
+
 func isParameterPresent(parameter string) bool {
 	for i := 1; i < len(os.Args); i++ {
 		if os.Args[i] == parameter {
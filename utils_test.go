@@ -10,7 +10,10 @@ You should have received a copy of the GNU Affero General Public License along w
 
 package main
 
-import "testing"
+import (
+	"testing"
+	"unicode/utf8"
+)
 
 func TestEmailIsValid(t *testing.T) {
 	if !emailIsValid("user@enterprise.com") {
@@ -70,3 +73,41 @@ func TestGetParameterValue(t *testing.T) {
 		t.Error("Parameter value should not be OK")
 	}
 }
+
+func TestRoundQuantity(t *testing.T) {
+	// adding decimal quantities one by one must not drift from the total
+	var quantity float64
+	for i := 0; i < 10; i++ {
+		quantity = roundQuantity(quantity + 0.1)
+	}
+	if quantity != 1 {
+		t.Error("The quantity has drifted while adding", quantity)
+	}
+	if roundQuantity(0.1+0.2) != 0.3 {
+		t.Error("The quantity has not been rounded", roundQuantity(0.1+0.2))
+	}
+
+	if roundQuantityDecimals(2.345, 2) != 2.35 || roundQuantityDecimals(2.5, 0) != 3 || roundQuantityDecimals(-1.25, 1) != -1.3 {
+		t.Error("The quantity has not been rounded to the decimal places")
+	}
+	if roundQuantityDecimals(1.0000001, -1) != 1 || roundQuantityDecimals(1.0000001, 10) != 1 {
+		t.Error("The decimal places are not limited to the decimals of the database")
+	}
+
+	if formatQuantity(2) != "2" || formatQuantity(1.5) != "1.5" || formatQuantity(0.1+0.2) != "0.3" {
+		t.Error("The quantity has not been formatted correctly")
+	}
+}
+
+func TestTruncateString(t *testing.T) {
+	if truncateString("MARKETNET", 20) != "MARKETNET" || truncateString("MARKETNET", 6) != "MARKET" {
+		t.Error("The text has not been truncated")
+	}
+	// "é" takes two bytes, it can't be cut in half
+	if s := truncateString("Café", 4); s != "Caf" || !utf8.ValidString(s) {
+		t.Error("The text has been truncated in the middle of a character", s)
+	}
+	if truncateString("Café", 5) != "Café" {
+		t.Error("The text fits in the maximum length")
+	}
+}
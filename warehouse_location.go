@@ -0,0 +1,688 @@
+/*
+This file is part of MARKETNET.
+
+MARKETNET is free software: you can redistribute it and/or modify it under the terms of the GNU Affero General Public License as published by the Free Software Foundation, version 3 of the License.
+
+MARKETNET is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License along with MARKETNET. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A storage location (bin) inside a warehouse
+type WarehouseLocation struct {
+	Id           int32     `json:"id" gorm:"index:warehouse_location_id_enterprise,unique:true,priority:1"`
+	WarehouseId  string    `json:"warehouseId" gorm:"column:warehouse;type:character(2);not null:true;index:warehouse_location_code,unique:true,priority:2"`
+	Warehouse    Warehouse `json:"-" gorm:"foreignKey:WarehouseId,EnterpriseId;references:Id,EnterpriseId"`
+	Zone         string    `json:"zone" gorm:"column:zone;type:character varying(10);not null:true"`
+	Aisle        string    `json:"aisle" gorm:"column:aisle;type:character varying(10);not null:true"`
+	Rack         string    `json:"rack" gorm:"column:rack;type:character varying(10);not null:true"`
+	Level        string    `json:"level" gorm:"column:level;type:character varying(10);not null:true"`
+	Code         string    `json:"code" gorm:"column:code;type:character varying(43);not null:true;index:warehouse_location_code,unique:true,priority:3"` // Zone-Aisle-Rack-Level, the pickers walk the warehouse in the order of this code
+	BarCode      string    `json:"barCode" gorm:"column:barcode;type:character varying(50);not null:true;index:warehouse_location_barcode,unique:true,priority:2"`
+	Off          bool      `json:"off" gorm:"column:off;not null:true"`
+	EnterpriseId int32     `json:"-" gorm:"column:enterprise;not null:true;index:warehouse_location_id_enterprise,unique:true,priority:2;index:warehouse_location_code,unique:true,priority:1;index:warehouse_location_barcode,unique:true,priority:1"`
+	Enterprise   Settings  `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (l *WarehouseLocation) TableName() string {
+	return "warehouse_location"
+}
+
+func getWarehouseLocations(warehouseId string, enterpriseId int32) []WarehouseLocation {
+	var locations []WarehouseLocation = make([]WarehouseLocation, 0)
+	result := dbOrm.Model(&WarehouseLocation{}).Where("warehouse = ? AND enterprise = ?", warehouseId, enterpriseId).Order("code ASC").Find(&locations)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return locations
+}
+
+func getWarehouseLocationRow(locationId int32) WarehouseLocation {
+	l := WarehouseLocation{}
+	result := dbOrm.Model(&WarehouseLocation{}).Where("id = ?", locationId).First(&l)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return l
+}
+
+func getWarehouseLocationByBarCode(warehouseId string, barCode string, enterpriseId int32) WarehouseLocation {
+	var locations []WarehouseLocation
+	result := dbOrm.Model(&WarehouseLocation{}).Where("warehouse = ? AND barcode = ? AND enterprise = ? AND NOT off", warehouseId, strings.TrimSpace(barCode), enterpriseId).Limit(1).Find(&locations)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	if len(locations) == 0 {
+		return WarehouseLocation{}
+	}
+	return locations[0]
+}
+
+func (l *WarehouseLocation) isValid() bool {
+	l.Zone = strings.ToUpper(strings.TrimSpace(l.Zone))
+	l.Aisle = strings.ToUpper(strings.TrimSpace(l.Aisle))
+	l.Rack = strings.ToUpper(strings.TrimSpace(l.Rack))
+	l.Level = strings.ToUpper(strings.TrimSpace(l.Level))
+	l.BarCode = strings.TrimSpace(l.BarCode)
+	return !(len(l.WarehouseId) != 2 || len(l.Zone) == 0 || len(l.Zone) > 10 || len(l.Aisle) > 10 || len(l.Rack) > 10 || len(l.Level) > 10 || len(l.BarCode) > 50)
+}
+
+func (l *WarehouseLocation) BeforeCreate(tx *gorm.DB) (err error) {
+	var location WarehouseLocation
+	tx.Model(&WarehouseLocation{}).Last(&location)
+	l.Id = location.Id + 1
+	return nil
+}
+
+// Zone-Aisle-Rack-Level, without the parts that are empty
+func (l *WarehouseLocation) generateCode() string {
+	parts := make([]string, 0)
+	for _, part := range []string{l.Zone, l.Aisle, l.Rack, l.Level} {
+		if len(part) > 0 {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+func (l *WarehouseLocation) insertWarehouseLocation() bool {
+	if !l.isValid() {
+		return false
+	}
+
+	l.Code = l.generateCode()
+	if len(l.BarCode) == 0 {
+		l.BarCode = l.WarehouseId + "-" + l.Code
+	}
+
+	result := dbOrm.Create(&l)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+func (l *WarehouseLocation) updateWarehouseLocation() bool {
+	if l.Id <= 0 || !l.isValid() {
+		return false
+	}
+
+	var location WarehouseLocation
+	result := dbOrm.Where("id = ? AND enterprise = ?", l.Id, l.EnterpriseId).First(&location)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	location.Zone = l.Zone
+	location.Aisle = l.Aisle
+	location.Rack = l.Rack
+	location.Level = l.Level
+	location.Code = location.generateCode()
+	if len(l.BarCode) > 0 {
+		location.BarCode = l.BarCode
+	}
+	location.Off = l.Off
+
+	result = dbOrm.Save(&location)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return false
+	}
+
+	return true
+}
+
+// ERROR CODES:
+// 1. There is stock in the location
+func (l *WarehouseLocation) deleteWarehouseLocation() OkAndErrorCodeReturn {
+	if l.Id <= 0 {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	var stock int64
+	result := dbOrm.Model(&StockLocation{}).Where("location = ? AND enterprise = ? AND quantity <> 0", l.Id, l.EnterpriseId).Count(&stock)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	if stock > 0 {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	result = trans.Where("location = ? AND enterprise = ?", l.Id, l.EnterpriseId).Delete(&StockLocation{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	result = trans.Where("id = ? AND enterprise = ?", l.Id, l.EnterpriseId).Delete(&WarehouseLocation{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result = trans.Commit()
+	return OkAndErrorCodeReturn{Ok: result.Error == nil}
+	///
+}
+
+// Stock of a product in a location of a warehouse.
+// The stock of the warehouse that is not in any location is the stock that has not been put away yet.
+type StockLocation struct {
+	ProductId    int32             `json:"productId" gorm:"primaryKey;column:product;not null:true"`
+	Product      Product           `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	LocationId   int32             `json:"locationId" gorm:"primaryKey;column:location;not null:true;index:stock_location_location"`
+	Location     WarehouseLocation `json:"location" gorm:"foreignKey:LocationId,EnterpriseId;references:Id,EnterpriseId"`
+	WarehouseId  string            `json:"warehouseId" gorm:"column:warehouse;type:character(2);not null:true"`
+	Quantity     float64           `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
+	EnterpriseId int32             `json:"-" gorm:"primaryKey;column:enterprise;not null:true"`
+	Enterprise   Settings          `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (s *StockLocation) TableName() string {
+	return "stock_location"
+}
+
+func getStockLocation(productId int32, enterpriseId int32) []StockLocation {
+	var stock []StockLocation = make([]StockLocation, 0)
+	result := dbOrm.Model(&StockLocation{}).Where("stock_location.product = ? AND stock_location.enterprise = ? AND stock_location.quantity <> 0", productId, enterpriseId).Joins("Location").Order("stock_location.warehouse ASC, \"Location\".code ASC").Find(&stock)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return stock
+}
+
+func getWarehouseLocationStock(locationId int32, enterpriseId int32) []StockLocation {
+	var stock []StockLocation = make([]StockLocation, 0)
+	result := dbOrm.Model(&StockLocation{}).Where("location = ? AND enterprise = ? AND quantity <> 0", locationId, enterpriseId).Preload("Product").Order("product ASC").Find(&stock)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return stock
+}
+
+// Returns the locations with stock of the product in the warehouse, in the order that the pickers walk the warehouse.
+func getPickingStockLocations(productId int32, warehouseId string, enterpriseId int32, trans *gorm.DB) []StockLocation {
+	if trans == nil {
+		trans = dbOrm
+	}
+	var stock []StockLocation = make([]StockLocation, 0)
+	result := trans.Model(&StockLocation{}).Where("stock_location.product = ? AND stock_location.warehouse = ? AND stock_location.enterprise = ? AND stock_location.quantity > 0", productId, warehouseId, enterpriseId).Joins("Location").Order("\"Location\".code ASC").Find(&stock)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return stock
+}
+
+// Sets the stock of the product in the location, or adds the quantity to the current stock.
+// Creates the stock row if it doesn't exists.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func setQuantityStockLocation(productId int32, warehouseId string, locationId int32, quantity float64, add bool, enterpriseId int32, trans gorm.DB) bool {
+	var stock []StockLocation
+	result := trans.Model(&StockLocation{}).Where("product = ? AND location = ? AND enterprise = ?", productId, locationId, enterpriseId).Limit(1).Find(&stock)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	if len(stock) == 0 {
+		result = trans.Create(&StockLocation{
+			ProductId:    productId,
+			LocationId:   locationId,
+			WarehouseId:  warehouseId,
+			Quantity:     quantity,
+			EnterpriseId: enterpriseId,
+		})
+	} else {
+		if add {
+			quantity = roundQuantity(quantity + stock[0].Quantity)
+		}
+		result = trans.Model(&StockLocation{}).Where("product = ? AND location = ? AND enterprise = ?", productId, locationId, enterpriseId).Update("quantity", quantity)
+	}
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
+// Quantity of a product that has entered or left a location in a warehouse movement.
+// The quantity is positive if the product has entered the location, and negative if it has left.
+type WarehouseMovementLocation struct {
+	WarehouseMovementId int64             `json:"warehouseMovementId" gorm:"primaryKey;column:warehouse_movement;not null:true"`
+	WarehouseMovement   WarehouseMovement `json:"-" gorm:"foreignKey:WarehouseMovementId,EnterpriseId;references:Id,EnterpriseId"`
+	LocationId          int32             `json:"locationId" gorm:"primaryKey;column:location;not null:true"`
+	Location            WarehouseLocation `json:"location" gorm:"foreignKey:LocationId,EnterpriseId;references:Id,EnterpriseId"`
+	Quantity            float64           `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
+	EnterpriseId        int32             `json:"-" gorm:"primaryKey;column:enterprise;not null:true"`
+	Enterprise          Settings          `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (w *WarehouseMovementLocation) TableName() string {
+	return "warehouse_movement_location"
+}
+
+func getWarehouseMovementLocations(warehouseMovementId int64, enterpriseId int32) []WarehouseMovementLocation {
+	var locations []WarehouseMovementLocation = make([]WarehouseMovementLocation, 0)
+	result := dbOrm.Model(&WarehouseMovementLocation{}).Where("warehouse_movement_location.warehouse_movement = ? AND warehouse_movement_location.enterprise = ?", warehouseMovementId, enterpriseId).Joins("Location").Order("\"Location\".code ASC").Find(&locations)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return locations
+}
+
+// Updates the stock of the locations with a new warehouse movement.
+// Inputs put the quantity in the location of the movement (if specified), otherwise the quantity stays in the warehouse pending to be put away.
+// Outputs take the quantity from the location of the movement (if specified) and then from the locations in picking order.
+// Inventory regularizations set the stock of the locations when the inventory is finished.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func allocateWarehouseMovementLocations(m *WarehouseMovement, trans gorm.DB) bool {
+	if m.Type == "R" {
+		return true
+	}
+
+	if m.LocationId != nil {
+		var location WarehouseLocation
+		result := trans.Model(&WarehouseLocation{}).Where("id = ? AND enterprise = ?", m.LocationId, m.EnterpriseId).First(&location)
+		if result.Error != nil || location.WarehouseId != m.WarehouseId {
+			if result.Error != nil {
+				log("DB", result.Error.Error())
+			}
+			trans.Rollback()
+			return false
+		}
+	}
+
+	if m.Type == "I" {
+		if m.LocationId == nil {
+			return true
+		}
+		return addWarehouseMovementLocation(m, *m.LocationId, absf(m.Quantity), trans)
+	}
+
+	stock := getPickingStockLocations(m.ProductId, m.WarehouseId, m.EnterpriseId, &trans)
+	if m.LocationId != nil { // the location that has been chosen goes first
+		for i := 0; i < len(stock); i++ {
+			if stock[i].LocationId == *m.LocationId {
+				stock = append([]StockLocation{stock[i]}, append(stock[:i:i], stock[i+1:]...)...)
+				break
+			}
+		}
+	}
+
+	picking := pickStockLocations(stock, absf(m.Quantity))
+	for i := 0; i < len(picking); i++ {
+		if !addWarehouseMovementLocation(m, picking[i].LocationId, -picking[i].Quantity, trans) {
+			return false
+		}
+	}
+	return true
+}
+
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func addWarehouseMovementLocation(m *WarehouseMovement, locationId int32, quantity float64, trans gorm.DB) bool {
+	result := trans.Create(&WarehouseMovementLocation{
+		WarehouseMovementId: m.Id,
+		LocationId:          locationId,
+		Quantity:            quantity,
+		EnterpriseId:        m.EnterpriseId,
+	})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return setQuantityStockLocation(m.ProductId, m.WarehouseId, locationId, quantity, true, m.EnterpriseId, trans)
+}
+
+// Undoes the changes in the stock of the locations of a warehouse movement that is being deleted.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func deallocateWarehouseMovementLocations(m *WarehouseMovement, trans gorm.DB) bool {
+	var locations []WarehouseMovementLocation
+	result := trans.Model(&WarehouseMovementLocation{}).Where("warehouse_movement = ? AND enterprise = ?", m.Id, m.EnterpriseId).Find(&locations)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	for i := 0; i < len(locations); i++ {
+		if !setQuantityStockLocation(m.ProductId, m.WarehouseId, locations[i].LocationId, -locations[i].Quantity, true, m.EnterpriseId, trans) {
+			return false
+		}
+	}
+
+	result = trans.Where("warehouse_movement = ? AND enterprise = ?", m.Id, m.EnterpriseId).Delete(&WarehouseMovementLocation{})
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	return true
+}
+
+type PickingLocation struct {
+	LocationId int32   `json:"locationId"`
+	Code       string  `json:"code"`
+	Quantity   float64 `json:"quantity"`
+}
+
+// Takes the quantity from the locations in the order that they are given, until the quantity is completed or there are no more locations.
+func pickStockLocations(stock []StockLocation, quantity float64) []PickingLocation {
+	picking := make([]PickingLocation, 0)
+	for i := 0; i < len(stock) && quantity > 0; i++ {
+		if stock[i].Quantity <= 0 {
+			continue
+		}
+		q := stock[i].Quantity
+		if q > quantity {
+			q = quantity
+		}
+		picking = append(picking, PickingLocation{LocationId: stock[i].LocationId, Code: stock[i].Location.Code, Quantity: q})
+		quantity = roundQuantity(quantity - q)
+	}
+	return picking
+}
+
+type SalesOrderPickingLocations struct {
+	SalesOrderDetailId int64             `json:"salesOrderDetailId"`
+	ProductId          int32             `json:"productId"`
+	ProductName        string            `json:"productName"`
+	WarehouseId        string            `json:"warehouseId"`
+	QuantityPending    float64           `json:"quantityPending"` // Quantity not in a delivery note yet
+	Locations          []PickingLocation `json:"locations"`
+}
+
+// Returns the locations where the pickers can find the pending lines of a sales order, sorted in the order that the pickers walk the warehouse.
+func getSalesOrderPickingLocations(orderId int64, enterpriseId int32) []SalesOrderPickingLocations {
+	picking := make([]SalesOrderPickingLocations, 0)
+	order := getSalesOrderRow(orderId)
+	if order.Id <= 0 || order.EnterpriseId != enterpriseId {
+		return picking
+	}
+
+	details := getSalesOrderDetail(orderId, enterpriseId)
+	for i := 0; i < len(details); i++ {
+		d := details[i]
+		if d.QuantityDeliveryNote >= d.Quantity || d.Cancelled || d.Product.DigitalProduct {
+			continue
+		}
+
+		p := SalesOrderPickingLocations{
+			SalesOrderDetailId: d.Id,
+			ProductId:          d.ProductId,
+			ProductName:        d.Product.Name,
+			WarehouseId:        d.WarehouseId,
+			QuantityPending:    roundQuantity(d.Quantity - d.QuantityDeliveryNote),
+		}
+		p.Locations = pickStockLocations(getPickingStockLocations(d.ProductId, d.WarehouseId, enterpriseId, nil), p.QuantityPending)
+		picking = append(picking, p)
+	}
+
+	// the lines without locations go at the end
+	sort.SliceStable(picking, func(i, j int) bool {
+		if len(picking[i].Locations) == 0 || len(picking[j].Locations) == 0 {
+			return len(picking[j].Locations) == 0 && len(picking[i].Locations) > 0
+		}
+		return picking[i].Locations[0].Code < picking[j].Locations[0].Code
+	})
+	return picking
+}
+
+type PutAwayQuery struct {
+	ProductId   int32   `json:"productId"`
+	WarehouseId string  `json:"warehouseId"`
+	Quantity    float64 `json:"quantity"`
+}
+
+type PutAwaySuggestion struct {
+	LocationId int32   `json:"locationId"`
+	Code       string  `json:"code"`
+	BarCode    string  `json:"barCode"`
+	Quantity   float64 `json:"quantity"` // Current stock of the product in the location
+	Reason     string  `json:"reason"`   // S = There is already stock of the product, E = Empty location
+}
+
+// Suggests where to put away the product in the warehouse:
+// first the locations that already have stock of the product, then the empty locations, in picking order.
+func (q *PutAwayQuery) getPutAwaySuggestions(enterpriseId int32) []PutAwaySuggestion {
+	if q.ProductId <= 0 || len(q.WarehouseId) != 2 {
+		return make([]PutAwaySuggestion, 0)
+	}
+
+	var locations []WarehouseLocation
+	result := dbOrm.Model(&WarehouseLocation{}).Where("warehouse = ? AND enterprise = ? AND NOT off", q.WarehouseId, enterpriseId).Order("code ASC").Find(&locations)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return make([]PutAwaySuggestion, 0)
+	}
+
+	var stock []StockLocation
+	result = dbOrm.Model(&StockLocation{}).Where("warehouse = ? AND enterprise = ? AND quantity > 0", q.WarehouseId, enterpriseId).Find(&stock)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		return make([]PutAwaySuggestion, 0)
+	}
+
+	return suggestPutAwayLocations(locations, stock, q.ProductId)
+}
+
+// Ranks the locations to put away the product, the locations with stock of other products are not suggested.
+func suggestPutAwayLocations(locations []WarehouseLocation, stock []StockLocation, productId int32) []PutAwaySuggestion {
+	productStock := make(map[int32]float64) // Key: location ID, Value: stock of the product
+	occupied := make(map[int32]bool)        // Key: location ID, Value: there is stock of any product
+	for i := 0; i < len(stock); i++ {
+		if stock[i].Quantity <= 0 {
+			continue
+		}
+		occupied[stock[i].LocationId] = true
+		if stock[i].ProductId == productId {
+			productStock[stock[i].LocationId] = roundQuantity(productStock[stock[i].LocationId] + stock[i].Quantity)
+		}
+	}
+
+	same := make([]PutAwaySuggestion, 0)
+	empty := make([]PutAwaySuggestion, 0)
+	for i := 0; i < len(locations); i++ {
+		l := locations[i]
+		if l.Off {
+			continue
+		}
+		if quantity, ok := productStock[l.Id]; ok {
+			same = append(same, PutAwaySuggestion{LocationId: l.Id, Code: l.Code, BarCode: l.BarCode, Quantity: quantity, Reason: "S"})
+		} else if !occupied[l.Id] {
+			empty = append(empty, PutAwaySuggestion{LocationId: l.Id, Code: l.Code, BarCode: l.BarCode, Reason: "E"})
+		}
+	}
+	sort.SliceStable(same, func(i, j int) bool {
+		return same[i].Code < same[j].Code
+	})
+	sort.SliceStable(empty, func(i, j int) bool {
+		return empty[i].Code < empty[j].Code
+	})
+	return append(same, empty...)
+}
+
+type PurchaseDeliveryNotePutAway struct {
+	WarehouseMovementId int64               `json:"warehouseMovementId"`
+	ProductId           int32               `json:"productId"`
+	ProductName         string              `json:"productName"`
+	Quantity            float64             `json:"quantity"`
+	Suggestions         []PutAwaySuggestion `json:"suggestions"`
+}
+
+// Returns the put-away suggestions for the lines of a purchase delivery note that have not been put in a location when received.
+func getPurchaseDeliveryNotePutAway(noteId int64, enterpriseId int32) []PurchaseDeliveryNotePutAway {
+	putAway := make([]PurchaseDeliveryNotePutAway, 0)
+	movements := getWarehouseMovementByPurchaseDeliveryNote(noteId, enterpriseId)
+	for i := 0; i < len(movements); i++ {
+		m := movements[i]
+		if m.Type != "I" || len(getWarehouseMovementLocations(m.Id, enterpriseId)) > 0 {
+			continue
+		}
+
+		q := PutAwayQuery{ProductId: m.ProductId, WarehouseId: m.WarehouseId, Quantity: m.Quantity}
+		putAway = append(putAway, PurchaseDeliveryNotePutAway{
+			WarehouseMovementId: m.Id,
+			ProductId:           m.ProductId,
+			ProductName:         m.Product.Name,
+			Quantity:            m.Quantity,
+			Suggestions:         q.getPutAwaySuggestions(enterpriseId),
+		})
+	}
+	return putAway
+}
+
+// Moves stock of a product between locations of the same warehouse, or puts away stock that is not in any location (LocationOriginId = nil).
+// The stock of the warehouse doesn't change.
+type StockLocationMove struct {
+	ProductId             int32   `json:"productId"`
+	WarehouseId           string  `json:"warehouseId"`
+	LocationOriginId      *int32  `json:"locationOriginId"`
+	LocationDestinationId int32   `json:"locationDestinationId"`
+	Quantity              float64 `json:"quantity"`
+}
+
+// ERROR CODES:
+// 1. The location is not in the warehouse
+// 2. There is not enough stock in the origin location
+// 3. There is not enough stock pending to put away in the warehouse
+func (s *StockLocationMove) moveStockLocation(enterpriseId int32) OkAndErrorCodeReturn {
+	if s.ProductId <= 0 || len(s.WarehouseId) != 2 || s.LocationDestinationId <= 0 || s.Quantity <= 0 || (s.LocationOriginId != nil && *s.LocationOriginId == s.LocationDestinationId) {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	destination := getWarehouseLocationRow(s.LocationDestinationId)
+	if destination.Id <= 0 || destination.EnterpriseId != enterpriseId || destination.WarehouseId != s.WarehouseId || destination.Off {
+		return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+	}
+
+	if s.LocationOriginId != nil {
+		origin := getWarehouseLocationRow(*s.LocationOriginId)
+		if origin.Id <= 0 || origin.EnterpriseId != enterpriseId || origin.WarehouseId != s.WarehouseId {
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 1}
+		}
+
+		var stock []StockLocation
+		result := dbOrm.Model(&StockLocation{}).Where("product = ? AND location = ? AND enterprise = ?", s.ProductId, origin.Id, enterpriseId).Find(&stock)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		if len(stock) == 0 || stock[0].Quantity < s.Quantity {
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 2}
+		}
+	} else {
+		var located float64
+		result := dbOrm.Model(&StockLocation{}).Where("product = ? AND warehouse = ? AND enterprise = ?", s.ProductId, s.WarehouseId, enterpriseId).Select("COALESCE(SUM(quantity),0)").Scan(&located)
+		if result.Error != nil {
+			log("DB", result.Error.Error())
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+		if roundQuantity(getStockRow(s.ProductId, s.WarehouseId, enterpriseId).Quantity-located) < s.Quantity {
+			return OkAndErrorCodeReturn{Ok: false, ErrorCode: 3}
+		}
+	}
+
+	///
+	trans := dbOrm.Begin()
+	if trans.Error != nil {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+	///
+
+	if s.LocationOriginId != nil {
+		if !setQuantityStockLocation(s.ProductId, s.WarehouseId, *s.LocationOriginId, -s.Quantity, true, enterpriseId, *trans) {
+			return OkAndErrorCodeReturn{Ok: false}
+		}
+	}
+	if !setQuantityStockLocation(s.ProductId, s.WarehouseId, s.LocationDestinationId, s.Quantity, true, enterpriseId, *trans) {
+		return OkAndErrorCodeReturn{Ok: false}
+	}
+
+	///
+	result := trans.Commit()
+	return OkAndErrorCodeReturn{Ok: result.Error == nil}
+	///
+}
+
+// Quantity of a product counted in a location in an inventory.
+// The quantity in InventoryProducts is the sum of the quantities of the locations.
+type InventoryProductLocation struct {
+	InventoryId  int32             `json:"inventoryId" gorm:"primaryKey;column:inventory;not null:true"`
+	Inventory    Inventory         `json:"-" gorm:"foreignKey:InventoryId,EnterpriseId;references:Id,EnterpriseId"`
+	ProductId    int32             `json:"productId" gorm:"primaryKey;column:product;not null:true"`
+	Product      Product           `json:"-" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
+	LocationId   int32             `json:"locationId" gorm:"primaryKey;column:location;not null:true"`
+	Location     WarehouseLocation `json:"location" gorm:"foreignKey:LocationId,EnterpriseId;references:Id,EnterpriseId"`
+	Quantity     float64           `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null:true"`
+	EnterpriseId int32             `json:"-" gorm:"column:enterprise;not null:true"`
+	Enterprise   Settings          `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
+}
+
+func (i *InventoryProductLocation) TableName() string {
+	return "inventory_product_location"
+}
+
+func getInventoryProductLocations(inventoryId int32, enterpriseId int32) []InventoryProductLocation {
+	var locations []InventoryProductLocation = make([]InventoryProductLocation, 0)
+	result := dbOrm.Model(&InventoryProductLocation{}).Where("inventory_product_location.inventory = ? AND inventory_product_location.enterprise = ?", inventoryId, enterpriseId).Preload(clause.Associations).Order("inventory_product_location.location ASC, inventory_product_location.product ASC").Find(&locations)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+	}
+	return locations
+}
+
+// Sets the stock of the locations counted in the inventory. The other locations of the products counted by location are left empty.
+// THIS FUNCTION DOES NOT OPEN A TRANSACTION.
+func regularizeInventoryLocations(inventory Inventory, productId int32, trans gorm.DB) bool {
+	var counted []InventoryProductLocation
+	result := trans.Model(&InventoryProductLocation{}).Where("inventory = ? AND product = ?", inventory.Id, productId).Find(&counted)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+	if len(counted) == 0 {
+		return true
+	}
+
+	result = trans.Model(&StockLocation{}).Where("product = ? AND warehouse = ? AND enterprise = ?", productId, inventory.WarehouseId, inventory.EnterpriseId).Update("quantity", 0)
+	if result.Error != nil {
+		log("DB", result.Error.Error())
+		trans.Rollback()
+		return false
+	}
+
+	for i := 0; i < len(counted); i++ {
+		if !setQuantityStockLocation(productId, inventory.WarehouseId, counted[i].LocationId, counted[i].Quantity, false, inventory.EnterpriseId, trans) {
+			return false
+		}
+	}
+	return true
+}
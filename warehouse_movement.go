@@ -24,7 +24,7 @@ type WarehouseMovement struct {
 	Warehouse              Warehouse             `json:"warehouse" gorm:"foreignKey:WarehouseId,EnterpriseId;references:Id,EnterpriseId"`
 	ProductId              int32                 `json:"productId" gorm:"column:product;not null"`
 	Product                Product               `json:"product" gorm:"foreignKey:ProductId,EnterpriseId;references:Id,EnterpriseId"`
-	Quantity               int32                 `json:"quantity" gorm:"column:quantity;not null"`
+	Quantity               float64               `json:"quantity" gorm:"type:numeric(14,6);column:quantity;not null"`
 	DateCreated            time.Time             `json:"dateCreated" gorm:"column:date_created;not null;type:timestamp(3) with time zone"`
 	Type                   string                `json:"type" gorm:"column:type;type:character(1);not null:true"` // O = Out, I = In, R = Inventory regularization
 	SalesOrderId           *int64                `json:"salesOrderId" gorm:"column:sales_order"`
@@ -40,13 +40,18 @@ type WarehouseMovement struct {
 	PurchaseOrderDetail    *PurchaseOrderDetail  `json:"purchaseOrderDetail" gorm:"foreignKey:PurchaseOrderDetailId,EnterpriseId;references:Id,EnterpriseId"`
 	PurchaseDeliveryNoteId *int64                `json:"purchaseDeliveryNoteId" gorm:"column:purchase_delivery_note"`
 	PurchaseDeliveryNote   *PurchaseDeliveryNote `json:"purchaseDeliveryNote" gorm:"foreignKey:PurchaseDeliveryNoteId,EnterpriseId;references:Id,EnterpriseId"`
-	DraggedStock           int32                 `json:"draggedStock" gorm:"column:dragged_stock;not null:true"`
+	DraggedStock           float64               `json:"draggedStock" gorm:"type:numeric(14,6);column:dragged_stock;not null:true"`
 	Price                  float64               `json:"price" gorm:"column:price;not null:true;type:numeric(14,6)"`
 	VatPercent             float64               `json:"vatPercent" gorm:"column:vat_percent;not null:true;type:numeric(14,6)"`
 	TotalAmount            float64               `json:"totalAmount" gorm:"column:total_amount;not null:true;type:numeric(14,6)"`
 	EnterpriseId           int32                 `json:"-" gorm:"column:enterprise;not null:true;index:warehouse_movement_id_enterprise,unique:true,priority:2"`
 	Enterprise             Settings              `json:"-" gorm:"foreignKey:EnterpriseId;references:Id"`
 	Manual                 bool                  `json:"manual" gorm:"column:manual;not null:true;type:boolean;default:false"`
+	CostAmount             float64               `json:"costAmount" gorm:"column:cost_amount;not null:true;type:numeric(14,6);default:0"` // Value of the movement at cost, positive for the inputs and negative for the outputs
+	LotNumber              string                `json:"lotNumber" gorm:"-"`                                                              // Lot of the product, only for products with lot tracking. Inputs create the lot, outputs take the stock from this lot before the other lots.
+	ExpiryDate             *time.Time            `json:"expiryDate" gorm:"-"`                                                             // Expiry date of the lot, when the input creates the lot
+	SerialNumbers          []string              `json:"serialNumbers" gorm:"-"`                                                          // Units of the product, only for products with serial number tracking
+	LocationId             *int32                `json:"locationId" gorm:"-"`                                                             // Storage location in the warehouse. Inputs put the stock in this location, outputs take the stock from this location before the other locations.
 }
 
 func (w *WarehouseMovement) TableName() string {
@@ -192,11 +197,12 @@ func (wm *WarehouseMovement) BeforeCreate(tx *gorm.DB) (err error) {
 }
 
 func (m *WarehouseMovement) insertWarehouseMovement(userId int32, trans *gorm.DB) bool {
+	m.Quantity = roundProductQuantity(m.ProductId, m.Quantity)
 	if !m.isValid() {
 		return false
 	}
 
-	m.TotalAmount = absf((m.Price * float64(m.Quantity)) * (1 + (m.VatPercent / 100)))
+	m.TotalAmount = absf((m.Price * m.Quantity) * (1 + (m.VatPercent / 100)))
 
 	var beginTransaction bool = (trans == nil)
 	if beginTransaction {
@@ -210,14 +216,14 @@ func (m *WarehouseMovement) insertWarehouseMovement(userId int32, trans *gorm.DB
 
 	// get the dragged stock
 	if m.Type != "R" {
-		var dragged_stock int32
+		var dragged_stock float64
 		result := trans.Model(&WarehouseMovement{}).Where("warehouse = ? AND product = ?", m.WarehouseId, m.ProductId).Order("date_created DESC").Limit(1).Pluck("dragged_stock", &dragged_stock)
 		if result.Error != nil {
 			log("DB", result.Error.Error())
 			trans.Rollback()
 			return false
 		}
-		m.DraggedStock = dragged_stock + m.Quantity
+		m.DraggedStock = roundQuantity(dragged_stock + m.Quantity)
 	} else { // Inventory regularization
 		m.DraggedStock = m.Quantity
 	}
@@ -240,16 +246,36 @@ func (m *WarehouseMovement) insertWarehouseMovement(userId int32, trans *gorm.DB
 		trans.Rollback()
 		return false
 	}
+	// stock of the lots
+	ok = allocateWarehouseMovementLots(m, *trans)
+	if !ok {
+		return false
+	}
+	// units with serial number
+	ok = allocateWarehouseMovementSerials(m, *trans)
+	if !ok {
+		return false
+	}
+	// stock of the storage locations
+	ok = allocateWarehouseMovementLocations(m, *trans)
+	if !ok {
+		return false
+	}
+	// cost of the stock
+	ok = allocateWarehouseMovementCostLayers(m, *trans)
+	if !ok {
+		return false
+	}
 	// delivery notes generation
 	if m.SalesOrderDetailId != nil {
-		ok = addQuantityDeliveryNoteSalesOrderDetail(*m.SalesOrderDetailId, abs(m.Quantity), userId, *trans)
+		ok = addQuantityDeliveryNoteSalesOrderDetail(*m.SalesOrderDetailId, absf(m.Quantity), userId, *trans)
 		if !ok {
 			trans.Rollback()
 			return false
 		}
 	}
 	if m.PurchaseOrderDetailId != nil {
-		ok = addQuantityDeliveryNotePurchaseOrderDetail(*m.PurchaseOrderDetailId, abs(m.Quantity), m.EnterpriseId, userId, *trans)
+		ok = addQuantityDeliveryNotePurchaseOrderDetail(*m.PurchaseOrderDetailId, absf(m.Quantity), m.EnterpriseId, userId, *trans)
 		if !ok {
 			trans.Rollback()
 			return false
@@ -257,15 +283,19 @@ func (m *WarehouseMovement) insertWarehouseMovement(userId int32, trans *gorm.DB
 	}
 	// sales delivery note price
 	if m.SalesDeliveryNoteId != nil {
-		ok = addTotalProductsSalesDeliveryNote(*m.SalesDeliveryNoteId, absf(m.Price*float64(m.Quantity)), m.VatPercent, m.EnterpriseId, userId, *trans)
+		ok = addTotalProductsSalesDeliveryNote(*m.SalesDeliveryNoteId, absf(m.Price*m.Quantity), m.VatPercent, m.EnterpriseId, userId, *trans)
 		if !ok {
 			trans.Rollback()
 			return false
 		}
+		ok = addCostOfGoodsSoldSalesDeliveryNote(*m.SalesDeliveryNoteId, -m.CostAmount, m.EnterpriseId, *trans)
+		if !ok {
+			return false
+		}
 	}
 	// purchase delivery note price
 	if m.PurchaseDeliveryNoteId != nil {
-		ok = addTotalProductsPurchaseDeliveryNote(*m.PurchaseDeliveryNoteId, absf(m.Price*float64(m.Quantity)), m.VatPercent, m.EnterpriseId, userId, *trans)
+		ok = addTotalProductsPurchaseDeliveryNote(*m.PurchaseDeliveryNoteId, absf(m.Price*m.Quantity), m.VatPercent, m.EnterpriseId, userId, *trans)
 		if !ok {
 			trans.Rollback()
 			return false
@@ -303,6 +333,24 @@ func (m *WarehouseMovement) deleteWarehouseMovement(userId int32, trans *gorm.DB
 
 	insertTransactionalLog(m.EnterpriseId, "warehouse_movement", int(m.Id), userId, "D")
 
+	// give back the stock of the lots
+	ok := deallocateWarehouseMovementLots(&inMemoryMovement, *trans)
+	if !ok {
+		return false
+	}
+	ok = deallocateWarehouseMovementSerials(&inMemoryMovement, *trans)
+	if !ok {
+		return false
+	}
+	ok = deallocateWarehouseMovementLocations(&inMemoryMovement, *trans)
+	if !ok {
+		return false
+	}
+	ok = deallocateWarehouseMovementCostLayers(&inMemoryMovement, *trans)
+	if !ok {
+		return false
+	}
+
 	// delete the warehouse movement
 	result := trans.Delete(&WarehouseMovement{}, "id = ? AND enterprise = ?", m.Id, m.EnterpriseId)
 	if result.Error != nil {
@@ -312,9 +360,9 @@ func (m *WarehouseMovement) deleteWarehouseMovement(userId int32, trans *gorm.DB
 	}
 
 	// update the dragged stock
-	var draggedStock int32
+	var draggedStock float64
 	if inMemoryMovement.Type != "R" {
-		draggedStock = inMemoryMovement.DraggedStock - inMemoryMovement.Quantity
+		draggedStock = roundQuantity(inMemoryMovement.DraggedStock - inMemoryMovement.Quantity)
 	} else {
 		result = trans.Model(&WarehouseMovement{}).Where("warehouse = ? AND product = ? AND date_created <= ?", inMemoryMovement.WarehouseId, inMemoryMovement.ProductId, inMemoryMovement.DateCreated).Order("date_created DESC").Limit(1).Pluck("dragged_stock", &draggedStock)
 		if result.Error != nil {
@@ -338,7 +386,7 @@ func (m *WarehouseMovement) deleteWarehouseMovement(userId int32, trans *gorm.DB
 		if d.Type == "R" {
 			draggedStock = d.Quantity
 		} else {
-			draggedStock += d.Quantity
+			draggedStock = roundQuantity(draggedStock + d.Quantity)
 		}
 
 		result = trans.Model(&WarehouseMovement{}).Where("id = ?", d.Id).Update("dragged_stock", draggedStock)
@@ -352,21 +400,21 @@ func (m *WarehouseMovement) deleteWarehouseMovement(userId int32, trans *gorm.DB
 	///
 
 	// update the product quantity
-	ok := setQuantityStock(inMemoryMovement.ProductId, inMemoryMovement.WarehouseId, draggedStock, m.EnterpriseId, *trans)
+	ok = setQuantityStock(inMemoryMovement.ProductId, inMemoryMovement.WarehouseId, draggedStock, m.EnterpriseId, *trans)
 	if !ok {
 		trans.Rollback()
 		return false
 	}
 	// delivery note generation
 	if inMemoryMovement.SalesOrderDetailId != nil {
-		ok = addQuantityDeliveryNoteSalesOrderDetail(*inMemoryMovement.SalesOrderDetailId, -abs(inMemoryMovement.Quantity), userId, *trans)
+		ok = addQuantityDeliveryNoteSalesOrderDetail(*inMemoryMovement.SalesOrderDetailId, -absf(inMemoryMovement.Quantity), userId, *trans)
 		if !ok {
 			trans.Rollback()
 			return false
 		}
 	}
 	if inMemoryMovement.PurchaseOrderDetailId != nil {
-		ok = addQuantityDeliveryNotePurchaseOrderDetail(*inMemoryMovement.PurchaseOrderDetailId, -abs(inMemoryMovement.Quantity), m.EnterpriseId, userId, *trans)
+		ok = addQuantityDeliveryNotePurchaseOrderDetail(*inMemoryMovement.PurchaseOrderDetailId, -absf(inMemoryMovement.Quantity), m.EnterpriseId, userId, *trans)
 		if !ok {
 			trans.Rollback()
 			return false
@@ -374,15 +422,19 @@ func (m *WarehouseMovement) deleteWarehouseMovement(userId int32, trans *gorm.DB
 	}
 	// sales delivery note price
 	if inMemoryMovement.SalesDeliveryNoteId != nil {
-		ok = addTotalProductsSalesDeliveryNote(*inMemoryMovement.SalesDeliveryNoteId, -absf(inMemoryMovement.Price*float64(inMemoryMovement.Quantity)), inMemoryMovement.VatPercent, m.EnterpriseId, userId, *trans)
+		ok = addTotalProductsSalesDeliveryNote(*inMemoryMovement.SalesDeliveryNoteId, -absf(inMemoryMovement.Price*inMemoryMovement.Quantity), inMemoryMovement.VatPercent, m.EnterpriseId, userId, *trans)
 		if !ok {
 			trans.Rollback()
 			return false
 		}
+		ok = addCostOfGoodsSoldSalesDeliveryNote(*inMemoryMovement.SalesDeliveryNoteId, inMemoryMovement.CostAmount, m.EnterpriseId, *trans)
+		if !ok {
+			return false
+		}
 	}
 	// purchase delivery note price
 	if inMemoryMovement.PurchaseDeliveryNoteId != nil {
-		ok = addTotalProductsPurchaseDeliveryNote(*inMemoryMovement.PurchaseDeliveryNoteId, -absf(inMemoryMovement.Price*float64(inMemoryMovement.Quantity)), inMemoryMovement.VatPercent, inMemoryMovement.EnterpriseId, userId, *trans)
+		ok = addTotalProductsPurchaseDeliveryNote(*inMemoryMovement.PurchaseDeliveryNoteId, -absf(inMemoryMovement.Price*inMemoryMovement.Quantity), inMemoryMovement.VatPercent, inMemoryMovement.EnterpriseId, userId, *trans)
 		if !ok {
 			trans.Rollback()
 			return false
@@ -403,7 +455,7 @@ func (m *WarehouseMovement) deleteWarehouseMovement(userId int32, trans *gorm.DB
 
 type WarehouseMovementDraggedStock struct {
 	Id       int64
-	Quantity int32
+	Quantity float64
 	Type     string
 }
 
@@ -429,7 +481,7 @@ func regenerateDraggedStock(warehouseId string, enterpriseId int32) bool {
 	}
 
 	// for each product...
-	var draggedStock int32
+	var draggedStock float64
 	var productId int32
 	for i := 0; i < len(productIds); i++ {
 		draggedStock = 0
@@ -446,14 +498,14 @@ func regenerateDraggedStock(warehouseId string, enterpriseId int32) bool {
 		// for each warehouse movement...
 		for rows.Next() {
 			var movementId int64
-			var quantity int32
+			var quantity float64
 			var movementType string
 			rows.Scan(&movementId, &quantity, &movementType)
 
 			if movementType == "R" {
 				draggedStock = quantity
 			} else {
-				draggedStock += quantity
+				draggedStock = roundQuantity(draggedStock + quantity)
 			}
 
 			result = trans.Model(&WarehouseMovement{}).Where("id = ?", movementId).Update("dragged_stock", draggedStock)
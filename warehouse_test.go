@@ -10,7 +10,10 @@ You should have received a copy of the GNU Affero General Public License along w
 
 package main
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 // ===== WAREHOUSE
 
@@ -703,7 +706,7 @@ func TestWarehouseMovementInsertDelete(t *testing.T) {
 	}
 	s := getStockRow(p.Id, w.Id, 1)
 	if s.Quantity != 1 {
-		t.Errorf("The stock has not been updated %d", s.Quantity)
+		t.Errorf("The stock has not been updated %v", s.Quantity)
 		return
 	}
 	// delete the warehouse movement
@@ -793,7 +796,7 @@ func TestWarehouseMovementInsertDelete(t *testing.T) {
 	movements = q.getWarehouseMovementByWarehouse()
 	wm = movements.Movements[len(movements.Movements)-1]
 	sn = getSalesDeliveryNoteRow(sn.Id)
-	if sn.TotalAmount != wm.TotalAmount || sn.TotalProducts != float64(abs(wm.Quantity))*wm.Price {
+	if sn.TotalAmount != wm.TotalAmount || sn.TotalProducts != absf(wm.Quantity)*wm.Price {
 		t.Error("The totals in the sale delivery note has not updated successfully")
 		return
 	}
@@ -850,7 +853,7 @@ func TestWarehouseMovementInsertDelete(t *testing.T) {
 	movements = q.getWarehouseMovementByWarehouse()
 	wm = movements.Movements[len(movements.Movements)-1]
 	pn = getPurchaseDeliveryNoteRow(pn.Id)
-	if pn.TotalAmount != wm.TotalAmount || pn.TotalProducts != float64(abs(wm.Quantity))*wm.Price {
+	if pn.TotalAmount != wm.TotalAmount || pn.TotalProducts != absf(wm.Quantity)*wm.Price {
 		t.Error("The totals in the purchase delivery note has not updated successfully")
 		return
 	}
@@ -1962,3 +1965,540 @@ func TestTransferBetweenWarehousesUsingBarCode(t *testing.T) {
 		return
 	}
 }
+
+// ===== LOTS
+
+/* FUNCTIONALITY */
+
+func TestLotTracking(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	p := Product{
+		Name:         "Yogurt with lot tracking",
+		Reference:    "YOG-LOT",
+		ControlStock: true,
+		VatPercent:   10,
+		Price:        2,
+		TrackLots:    true,
+		EnterpriseId: 1,
+	}
+	okAndErr := p.insertProduct(0)
+	if !okAndErr.Ok {
+		t.Error("Insert error, could not insert product", okAndErr.ErrorCode)
+		return
+	}
+
+	late := time.Now().AddDate(0, 2, 0)
+	soon := time.Now().AddDate(0, 1, 0)
+
+	// receive two lots, the second one expires first
+	wmA := WarehouseMovement{WarehouseId: "W1", ProductId: p.Id, Quantity: 5, Type: "I", LotNumber: "LOT-A", ExpiryDate: &late, EnterpriseId: 1}
+	wmB := WarehouseMovement{WarehouseId: "W1", ProductId: p.Id, Quantity: 2, Type: "I", LotNumber: "LOT-B", ExpiryDate: &soon, EnterpriseId: 1}
+	if !wmA.insertWarehouseMovement(0, nil) || !wmB.insertWarehouseMovement(0, nil) {
+		t.Error("Insert error, the warehouse movements with lots could not be inserted")
+		return
+	}
+
+	lots := getProductLots(p.Id, 1)
+	if len(lots) != 2 || lots[0].LotNumber != "LOT-B" {
+		t.Error("The lots have not been created, or are not sorted by expiry date", lots)
+		return
+	}
+
+	// the output takes the lot that expires first, and then the next one
+	wmOut := WarehouseMovement{WarehouseId: "W1", ProductId: p.Id, Quantity: -3, Type: "O", EnterpriseId: 1}
+	if !wmOut.insertWarehouseMovement(0, nil) {
+		t.Error("Insert error, the output warehouse movement could not be inserted")
+		return
+	}
+
+	movementLots := getWarehouseMovementLots(wmOut.Id, 1)
+	if len(movementLots) != 2 {
+		t.Error("The output has not been allocated to the lots", movementLots)
+		return
+	}
+	stock := getStockLot(p.Id, 1)
+	if len(stock) != 1 || stock[0].Lot.LotNumber != "LOT-A" || stock[0].Quantity != 4 {
+		t.Error("The stock of the lots is not correct", stock)
+		return
+	}
+
+	recall := getLotRecall(lots[0].Id, 1)
+	if recall.Lot.Id != lots[0].Id {
+		t.Error("Can't get the recall of the lot", recall)
+		return
+	}
+
+	// deleting the output gives back the stock to the lots
+	if !wmOut.deleteWarehouseMovement(0, nil) {
+		t.Error("Delete error, the output warehouse movement could not be deleted")
+		return
+	}
+	stock = getStockLot(p.Id, 1)
+	if len(stock) != 2 {
+		t.Error("The stock of the lots has not been given back", stock)
+		return
+	}
+
+	// CLEAN UP
+	wmA.deleteWarehouseMovement(0, nil)
+	wmB.deleteWarehouseMovement(0, nil)
+	db.Exec(`DELETE FROM public.stock_lot WHERE product=$1`, p.Id)
+	db.Exec(`DELETE FROM public.product_lot WHERE product=$1`, p.Id)
+	okAndErr = p.deleteProduct(0)
+	if !okAndErr.Ok {
+		t.Error("Delete error, could not delete product", okAndErr.ErrorCode, okAndErr.ExtraData)
+		return
+	}
+}
+
+func TestAllocateFefo(t *testing.T) {
+	stock := []StockLot{
+		{LotId: 2, Quantity: 3, Lot: ProductLot{LotNumber: "B"}},
+		{LotId: 1, Quantity: 0, Lot: ProductLot{LotNumber: "A"}},
+		{LotId: 3, Quantity: 10, Lot: ProductLot{LotNumber: "C"}},
+	}
+
+	lots := allocateFefo(stock, 5)
+	if len(lots) != 2 || lots[0].LotId != 2 || lots[0].Quantity != 3 || lots[1].LotId != 3 || lots[1].Quantity != 2 {
+		t.Error("The quantity has not been taken from the lots in order", lots)
+		return
+	}
+
+	lots = allocateFefo(stock, 20)
+	if len(lots) != 2 || lots[1].Quantity != 10 {
+		t.Error("The lots can't give more quantity than their stock", lots)
+		return
+	}
+
+	lots = allocateFefo(nil, 5)
+	if len(lots) != 0 {
+		t.Error("There are no lots to allocate", lots)
+		return
+	}
+}
+
+// ===== SERIAL NUMBERS
+
+/* FUNCTIONALITY */
+
+func TestSerialNumberTracking(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	p := Product{
+		Name:         "Router with serial number",
+		Reference:    "RTR-SN",
+		ControlStock: true,
+		VatPercent:   21,
+		Price:        60,
+		TrackSerials: true,
+		EnterpriseId: 1,
+	}
+	okAndErr := p.insertProduct(0)
+	if !okAndErr.Ok {
+		t.Error("Insert error, could not insert product", okAndErr.ErrorCode)
+		return
+	}
+
+	wmIn := WarehouseMovement{WarehouseId: "W1", ProductId: p.Id, Quantity: 2, Type: "I", SerialNumbers: []string{"SN-0001", "SN-0002"}, EnterpriseId: 1}
+	if !wmIn.insertWarehouseMovement(0, nil) {
+		t.Error("Insert error, the warehouse movement with serial numbers could not be inserted")
+		return
+	}
+
+	// a unit that is already in stock can't enter again
+	wmDuplicated := WarehouseMovement{WarehouseId: "W1", ProductId: p.Id, Quantity: 1, Type: "I", SerialNumbers: []string{"SN-0002"}, EnterpriseId: 1}
+	if wmDuplicated.insertWarehouseMovement(0, nil) {
+		t.Error("A unit that is in stock has entered the warehouse again")
+		return
+	}
+
+	wmOut := WarehouseMovement{WarehouseId: "W1", ProductId: p.Id, Quantity: -1, Type: "O", SerialNumbers: []string{"SN-0001"}, EnterpriseId: 1}
+	if !wmOut.insertWarehouseMovement(0, nil) {
+		t.Error("Insert error, the output warehouse movement with serial numbers could not be inserted")
+		return
+	}
+
+	serials := (&ProductSerialQuery{ProductId: p.Id, InStock: true}).getProductSerials(1)
+	if len(serials) != 1 || serials[0].SerialNumber != "SN-0002" {
+		t.Error("The units in stock are not correct", serials)
+		return
+	}
+
+	history := getSerialNumberHistory("SN-0001", 1)
+	if len(history) != 1 || len(history[0].Movements) != 2 || history[0].Movements[1].Type != "O" {
+		t.Error("The history of the serial number is not correct", history)
+		return
+	}
+
+	// deleting the output puts the unit back in stock
+	if !wmOut.deleteWarehouseMovement(0, nil) {
+		t.Error("Delete error, the output warehouse movement could not be deleted")
+		return
+	}
+	serials = (&ProductSerialQuery{ProductId: p.Id, InStock: true}).getProductSerials(1)
+	if len(serials) != 2 {
+		t.Error("The unit has not been put back in stock", serials)
+		return
+	}
+
+	// CLEAN UP
+	wmIn.deleteWarehouseMovement(0, nil)
+	db.Exec(`DELETE FROM public.product_serial WHERE product=$1`, p.Id)
+	okAndErr = p.deleteProduct(0)
+	if !okAndErr.Ok {
+		t.Error("Delete error, could not delete product", okAndErr.ErrorCode, okAndErr.ExtraData)
+		return
+	}
+}
+
+func TestCleanSerialNumbers(t *testing.T) {
+	serialNumbers := cleanSerialNumbers([]string{" SN-1 ", "", "SN-2", "SN-1", "   "})
+	if len(serialNumbers) != 2 || serialNumbers[0] != "SN-1" || serialNumbers[1] != "SN-2" {
+		t.Error("The serial numbers have not been cleaned", serialNumbers)
+		return
+	}
+
+	serialNumbers = generateManufacturingSerialNumbers(15, 3)
+	if len(serialNumbers) != 3 || serialNumbers[0] != "15-1" || serialNumbers[2] != "15-3" {
+		t.Error("The serial numbers of the manufacturing order have not been generated correctly", serialNumbers)
+		return
+	}
+}
+
+// ===== STORAGE LOCATIONS
+
+/* FUNCTIONALITY */
+
+func TestWarehouseLocations(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	p := Product{
+		Name:         "Product in storage locations",
+		Reference:    "LOC-PRD",
+		ControlStock: true,
+		VatPercent:   21,
+		Price:        10,
+		EnterpriseId: 1,
+	}
+	okAndErr := p.insertProduct(0)
+	if !okAndErr.Ok {
+		t.Error("Insert error, could not insert product", okAndErr.ErrorCode)
+		return
+	}
+
+	locationA := WarehouseLocation{WarehouseId: "W1", Zone: "t", Aisle: "01", Rack: "01", Level: "1", EnterpriseId: 1}
+	locationB := WarehouseLocation{WarehouseId: "W1", Zone: "t", Aisle: "01", Rack: "02", Level: "1", EnterpriseId: 1}
+	if !locationA.insertWarehouseLocation() || !locationB.insertWarehouseLocation() {
+		t.Error("Insert error, the storage locations could not be inserted")
+		return
+	}
+	if locationA.Code != "T-01-01-1" || locationA.BarCode != "W1-T-01-01-1" {
+		t.Error("The code of the location is not correct", locationA.Code, locationA.BarCode)
+		return
+	}
+
+	wmIn := WarehouseMovement{WarehouseId: "W1", ProductId: p.Id, Quantity: 5, Type: "I", LocationId: &locationA.Id, EnterpriseId: 1}
+	if !wmIn.insertWarehouseMovement(0, nil) {
+		t.Error("Insert error, the input warehouse movement with location could not be inserted")
+		return
+	}
+
+	q := PutAwayQuery{ProductId: p.Id, WarehouseId: "W1", Quantity: 1}
+	suggestions := q.getPutAwaySuggestions(1)
+	if len(suggestions) < 2 || suggestions[0].LocationId != locationA.Id || suggestions[0].Reason != "S" || suggestions[0].Quantity != 5 {
+		t.Error("The put-away suggestions are not correct", suggestions)
+		return
+	}
+
+	move := StockLocationMove{ProductId: p.Id, WarehouseId: "W1", LocationOriginId: &locationA.Id, LocationDestinationId: locationB.Id, Quantity: 2}
+	okAndErr = move.moveStockLocation(1)
+	if !okAndErr.Ok {
+		t.Error("The stock could not be moved between the locations", okAndErr.ErrorCode)
+		return
+	}
+
+	// the output takes the stock in picking order
+	wmOut := WarehouseMovement{WarehouseId: "W1", ProductId: p.Id, Quantity: -4, Type: "O", EnterpriseId: 1}
+	if !wmOut.insertWarehouseMovement(0, nil) {
+		t.Error("Insert error, the output warehouse movement could not be inserted")
+		return
+	}
+	stock := getStockLocation(p.Id, 1)
+	if len(stock) != 1 || stock[0].LocationId != locationB.Id || stock[0].Quantity != 1 {
+		t.Error("The stock of the locations is not correct", stock)
+		return
+	}
+
+	okAndErr = locationB.deleteWarehouseLocation()
+	if okAndErr.Ok || okAndErr.ErrorCode != 1 {
+		t.Error("A location with stock has been deleted")
+		return
+	}
+
+	// CLEAN UP
+	wmOut.deleteWarehouseMovement(0, nil)
+	wmIn.deleteWarehouseMovement(0, nil)
+	db.Exec(`DELETE FROM public.stock_location WHERE product=$1`, p.Id)
+	locationA.deleteWarehouseLocation()
+	locationB.deleteWarehouseLocation()
+	okAndErr = p.deleteProduct(0)
+	if !okAndErr.Ok {
+		t.Error("Delete error, could not delete product", okAndErr.ErrorCode, okAndErr.ExtraData)
+		return
+	}
+}
+
+func TestSuggestPutAwayLocations(t *testing.T) {
+	locations := []WarehouseLocation{
+		{Id: 1, Code: "A-02"},
+		{Id: 2, Code: "A-01"},
+		{Id: 3, Code: "A-03"},
+		{Id: 4, Code: "A-04", Off: true},
+		{Id: 5, Code: "B-01"},
+	}
+	stock := []StockLocation{
+		{ProductId: 1, LocationId: 5, Quantity: 3},
+		{ProductId: 2, LocationId: 2, Quantity: 1},
+		{ProductId: 1, LocationId: 3, Quantity: 0},
+	}
+
+	suggestions := suggestPutAwayLocations(locations, stock, 1)
+	if len(suggestions) != 3 || suggestions[0].LocationId != 5 || suggestions[0].Reason != "S" || suggestions[1].LocationId != 1 || suggestions[2].LocationId != 3 {
+		t.Error("The put-away suggestions are not correct", suggestions)
+		return
+	}
+
+	picking := pickStockLocations([]StockLocation{{LocationId: 1, Quantity: 2}, {LocationId: 2, Quantity: 0}, {LocationId: 3, Quantity: 5}}, 4)
+	if len(picking) != 2 || picking[0].Quantity != 2 || picking[1].LocationId != 3 || picking[1].Quantity != 2 {
+		t.Error("The picking of the locations is not correct", picking)
+		return
+	}
+}
+
+// ===== DECIMAL QUANTITIES
+
+/* FUNCTIONALITY */
+
+func TestDecimalQuantityStock(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	p := Product{
+		Name:             "Cable sold by metres",
+		Reference:        "DEC-PRD",
+		ControlStock:     true,
+		VatPercent:       21,
+		Price:            1.5,
+		QuantityDecimals: 2,
+		EnterpriseId:     1,
+	}
+	p.TrackSerials = true
+	okAndErr := p.insertProduct(0)
+	if okAndErr.Ok {
+		t.Error("A product with serial numbers and decimal quantities has been inserted")
+		return
+	}
+	p.TrackSerials = false
+	okAndErr = p.insertProduct(0)
+	if !okAndErr.Ok {
+		t.Error("Insert error, could not insert product", okAndErr.ErrorCode)
+		return
+	}
+
+	movements := []WarehouseMovement{
+		{WarehouseId: "W1", ProductId: p.Id, Quantity: 1.5, Type: "I", EnterpriseId: 1},
+		{WarehouseId: "W1", ProductId: p.Id, Quantity: 0.1, Type: "I", EnterpriseId: 1},
+		{WarehouseId: "W1", ProductId: p.Id, Quantity: 0.2, Type: "I", EnterpriseId: 1},
+		{WarehouseId: "W1", ProductId: p.Id, Quantity: -0.304, Type: "O", EnterpriseId: 1},
+	}
+	for i := 0; i < len(movements); i++ {
+		if !movements[i].insertWarehouseMovement(0, nil) {
+			t.Error("Insert error, the warehouse movement could not be inserted")
+			return
+		}
+	}
+	if movements[3].Quantity != -0.3 {
+		t.Error("The quantity of the movement has not been rounded to the decimals of the product", movements[3].Quantity)
+		return
+	}
+
+	s := getStockRow(p.Id, "W1", 1)
+	if s.Quantity != 1.5 || s.QuantityAvaiable != 1.5 {
+		t.Error("The stock has not been updated without rounding errors", s.Quantity, s.QuantityAvaiable)
+		return
+	}
+	if getWarehouseMovementRow(movements[3].Id).DraggedStock != 1.5 {
+		t.Error("The dragged stock is not correct")
+		return
+	}
+
+	if !regenerateDraggedStock("W1", 1) {
+		t.Error("The dragged stock could not be regenerated")
+		return
+	}
+	if getWarehouseMovementRow(movements[3].Id).DraggedStock != 1.5 {
+		t.Error("The regenerated dragged stock is not correct")
+		return
+	}
+
+	// CLEAN UP
+	for i := len(movements) - 1; i >= 0; i-- {
+		if !movements[i].deleteWarehouseMovement(0, nil) {
+			t.Error("Delete error, the warehouse movement could not be deleted")
+			return
+		}
+	}
+	if getStockRow(p.Id, "W1", 1).Quantity != 0 {
+		t.Error("The stock has not been restored after deleting the movements")
+		return
+	}
+	okAndErr = p.deleteProduct(0)
+	if !okAndErr.Ok {
+		t.Error("Delete error, could not delete product", okAndErr.ErrorCode, okAndErr.ExtraData)
+		return
+	}
+}
+
+// ===== COSTING
+
+/* FUNCTIONALITY */
+
+func TestCostLayers(t *testing.T) {
+	if db == nil {
+		ConnectTestWithDB(t)
+	}
+
+	p := Product{
+		Name:         "Product with cost layers",
+		Reference:    "COST-PRD",
+		ControlStock: true,
+		VatPercent:   21,
+		Price:        10,
+		CostPrice:    1,
+		EnterpriseId: 1,
+	}
+	okAndErr := p.insertProduct(0)
+	if !okAndErr.Ok {
+		t.Error("Insert error, could not insert product", okAndErr.ErrorCode)
+		return
+	}
+
+	defer dbOrm.Model(&Settings{}).Where("id = ?", 1).Update("costing_method", COSTING_METHOD_WEIGHTED_AVERAGE)
+
+	for _, costingMethod := range []string{COSTING_METHOD_FIFO, COSTING_METHOD_WEIGHTED_AVERAGE} {
+		dbOrm.Model(&Settings{}).Where("id = ?", 1).Update("costing_method", costingMethod)
+
+		movements := []WarehouseMovement{
+			{WarehouseId: "W1", ProductId: p.Id, Quantity: 10, Type: "I", Price: 2, Manual: true, EnterpriseId: 1},
+			{WarehouseId: "W1", ProductId: p.Id, Quantity: 10, Type: "I", Price: 4, Manual: true, EnterpriseId: 1},
+			{WarehouseId: "W1", ProductId: p.Id, Quantity: -15, Type: "O", EnterpriseId: 1},
+		}
+		for i := 0; i < len(movements); i++ {
+			if !movements[i].insertWarehouseMovement(0, nil) {
+				t.Error("Insert error, the warehouse movement could not be inserted")
+				return
+			}
+		}
+
+		// FIFO: 10 units at 2 and 5 units at 4, weighted average: 15 units at 3
+		var expectedCost float64 = -40
+		if costingMethod == COSTING_METHOD_WEIGHTED_AVERAGE {
+			expectedCost = -45
+		}
+		if getWarehouseMovementRow(movements[2].Id).CostAmount != expectedCost {
+			t.Error("The output has not been costed correctly", costingMethod, getWarehouseMovementRow(movements[2].Id).CostAmount)
+			return
+		}
+
+		valuation := (&InventoyValuationQuery{}).getInventoyValuation(1)
+		for i := 0; i < len(valuation); i++ {
+			if valuation[i].Product == p.Id && (valuation[i].Quantity != 5 || valuation[i].Value != 60+expectedCost) {
+				t.Error("The inventory valuation doesn't use the cost layers", costingMethod, valuation[i])
+				return
+			}
+		}
+
+		// a landed cost of 1 per unit on the second input, with units of the input already sold:
+		// FIFO: the 5 units left of the second layer cost 4+1, weighted average: 5 of the 20 units are in stock, 2.5 of the 10 units of the input
+		trans := dbOrm.Begin()
+		if !addWarehouseMovementCostAmount(movements[1].Id, 1, 10, *trans) {
+			t.Error("The landed cost could not be added to the cost layers")
+			return
+		}
+		trans.Commit()
+		var expectedValue float64 = 25
+		if costingMethod == COSTING_METHOD_WEIGHTED_AVERAGE {
+			expectedValue = 17.5
+		}
+		var value float64
+		layers := getCostLayers(p.Id, 1)
+		for i := 0; i < len(layers); i++ {
+			value += layers[i].QuantityRemaining * layers[i].UnitCost
+		}
+		if absf(value-expectedValue) > 0.0001 {
+			t.Error("The landed cost of the units in stock is not correct", costingMethod, value)
+			return
+		}
+
+		// CLEAN UP
+		for i := len(movements) - 1; i >= 0; i-- {
+			if !movements[i].deleteWarehouseMovement(0, nil) {
+				t.Error("Delete error, the warehouse movement could not be deleted")
+				return
+			}
+		}
+		if len(getCostLayers(p.Id, 1)) != 0 {
+			t.Error("The cost layers have not been deleted with the movements")
+			return
+		}
+	}
+
+	okAndErr = p.deleteProduct(0)
+	if !okAndErr.Ok {
+		t.Error("Delete error, could not delete product", okAndErr.ErrorCode, okAndErr.ExtraData)
+		return
+	}
+}
+
+func TestConsumeCostLayers(t *testing.T) {
+	layers := []CostLayer{
+		{Id: 1, QuantityRemaining: 3, UnitCost: 2},
+		{Id: 2, QuantityRemaining: 0, UnitCost: 5},
+		{Id: 3, QuantityRemaining: 10, UnitCost: 4},
+	}
+
+	consumption, notCovered := consumeCostLayers(layers, 5)
+	if len(consumption) != 2 || consumption[0].CostLayerId != 1 || consumption[0].Quantity != 3 || consumption[0].UnitCost != 2 || consumption[1].CostLayerId != 3 || consumption[1].Quantity != 2 || notCovered != 0 {
+		t.Error("The quantity has not been taken from the oldest layers first", consumption, notCovered)
+		return
+	}
+
+	consumption, notCovered = consumeCostLayers(layers, 15)
+	if len(consumption) != 2 || consumption[1].Quantity != 10 || notCovered != 2 {
+		t.Error("The layers can't give more quantity than their stock", consumption, notCovered)
+		return
+	}
+}
+
+func TestWeightedAverageCost(t *testing.T) {
+	if cost := weightedAverageCost(10, 2, 10, 4); cost != 3 {
+		t.Error("The average cost is not correct", cost)
+		return
+	}
+	if cost := weightedAverageCost(20, 3, -10, 4); cost != 2 {
+		t.Error("Removing an input doesn't give back the previous cost", cost)
+		return
+	}
+	if cost := weightedAverageCost(10, 2, -10, 2); cost != 2 {
+		t.Error("The cost must not change when there is no stock left", cost)
+		return
+	}
+}
@@ -1465,9 +1465,9 @@ func copyWcOrders(enterpriseId int32) bool {
 		}
 
 		s.EnterpriseId = enterpriseId
-		ok, orderId := s.insertSalesOrder(0)
-		if !ok {
-			errors = append(errors, "Can't import order. The order could not be created in MARKETNET. Order id "+strconv.Itoa(int(id)))
+		okAndErr, orderId := s.insertSalesOrder(0, nil)
+		if !okAndErr.Ok {
+			errors = append(errors, "Can't import order. The order could not be created in MARKETNET. Order id "+strconv.Itoa(int(id))+getCustomerRiskErrorMessage(okAndErr))
 			continue
 		}
 
@@ -1514,8 +1514,12 @@ func copyWcOrders(enterpriseId int32) bool {
 			d := SalesOrderDetail{}
 			d.OrderId = orderId
 			d.ProductId = product
-			d.Quantity = quantity
+			d.Quantity = float64(quantity)
 			d.Price = price
+			// apply the price list of the customer, if there is any
+			if listPrice, ok := getProductPriceForSaleOrder(product, orderId, d.Quantity, enterpriseId); ok {
+				d.Price = listPrice
+			}
 
 			if totalTax == 0 {
 				d.VatPercent = 0
@@ -1525,7 +1529,7 @@ func copyWcOrders(enterpriseId int32) bool {
 
 			d.WooCommerceId = id
 			d.EnterpriseId = enterpriseId
-			d.insertSalesOrderDetail(0)
+			d.insertSalesOrderDetail(0, nil)
 
 		} // for rows.Next() {
 		rows.Close()